@@ -0,0 +1,205 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// AggregateOp is a bit mask of the aggregations to be run by Stream.Aggregate.
+type AggregateOp int
+
+const (
+	// AggregateCount counts the keys.
+	AggregateCount AggregateOp = 1 << iota
+	// AggregateSum sums up the values, which must be encoded with binary.PutVarint. This is the
+	// only aggregation which has to read the values.
+	AggregateSum
+	// AggregateUserMeta finds the smallest and the largest UserMeta of the keys.
+	AggregateUserMeta
+)
+
+// AggregatePartial holds the result of an aggregation over one of the key ranges the Stream was
+// split into. Partials are returned in key order, and can be merged with Merge.
+type AggregatePartial struct {
+	// FirstKey and LastKey are the smallest and the largest keys aggregated in this range.
+	FirstKey []byte
+	LastKey  []byte
+
+	Count       uint64
+	Sum         int64
+	MinUserMeta byte
+	MaxUserMeta byte
+}
+
+// Merge adds the result of other to p.
+func (p *AggregatePartial) Merge(other *AggregatePartial) {
+	if other.Count == 0 {
+		return
+	}
+	if p.Count == 0 {
+		*p = *other
+		return
+	}
+	if bytes.Compare(other.FirstKey, p.FirstKey) < 0 {
+		p.FirstKey = other.FirstKey
+	}
+	if bytes.Compare(other.LastKey, p.LastKey) > 0 {
+		p.LastKey = other.LastKey
+	}
+	p.Count += other.Count
+	p.Sum += other.Sum
+	if other.MinUserMeta < p.MinUserMeta {
+		p.MinUserMeta = other.MinUserMeta
+	}
+	if other.MaxUserMeta > p.MaxUserMeta {
+		p.MaxUserMeta = other.MaxUserMeta
+	}
+}
+
+func (p *AggregatePartial) add(item *Item, ops AggregateOp) error {
+	if ops&AggregateSum != 0 {
+		err := item.Value(func(val []byte) error {
+			v, n := binary.Varint(val)
+			if n <= 0 {
+				return errors.Errorf("value of key %q is not a varint", item.Key())
+			}
+			p.Sum += v
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if um := item.UserMeta(); ops&AggregateUserMeta != 0 {
+		if p.Count == 0 || um < p.MinUserMeta {
+			p.MinUserMeta = um
+		}
+		if p.Count == 0 || um > p.MaxUserMeta {
+			p.MaxUserMeta = um
+		}
+	}
+	if p.Count == 0 {
+		p.FirstKey = item.KeyCopy(nil)
+	}
+	p.LastKey = item.KeyCopy(p.LastKey)
+	p.Count++
+	return nil
+}
+
+// Aggregate runs the given aggregations over the latest version of the keys picked by the
+// Stream, without sending them out. Like Orchestrate, it splits the keys into ranges and
+// aggregates NumGo ranges concurrently. Only ChooseKey, Prefix and SinceTs are used; deleted and
+// expired keys are skipped. The values are only read if AggregateSum is asked for.
+//
+// Aggregate returns one partial per non-empty range, in key order. FirstKey, LastKey and Count
+// are always filled in, the other fields only if the corresponding aggregation is asked for.
+func (st *Stream) Aggregate(ctx context.Context, ops AggregateOp) ([]*AggregatePartial, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var txn *Txn
+	if st.readTs > 0 {
+		txn = st.db.NewTransactionAt(st.readTs, false)
+	} else {
+		txn = st.db.NewTransaction(false)
+	}
+	defer txn.Discard()
+
+	ranges := st.db.Ranges(st.Prefix, 16)
+	rangeCh := make(chan int, len(ranges))
+	for i := range ranges {
+		rangeCh <- i
+	}
+	close(rangeCh)
+	partials := make([]*AggregatePartial, len(ranges))
+
+	iterate := func(itr *Iterator, kr *keyRange) (*AggregatePartial, error) {
+		p := &AggregatePartial{}
+		for itr.Seek(kr.left); itr.Valid(); itr.Next() {
+			item := itr.Item()
+			if len(kr.right) > 0 && bytes.Compare(item.Key(), kr.right) >= 0 {
+				break
+			}
+			if st.ChooseKey != nil && !st.ChooseKey(item) {
+				continue
+			}
+			if err := p.add(item, ops); err != nil {
+				return nil, err
+			}
+			if p.Count%1000 == 0 && ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+		}
+		return p, nil
+	}
+
+	errCh := make(chan error, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < st.NumGo; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			opt := DefaultIteratorOptions
+			opt.PrefetchValues = false
+			opt.Prefix = st.Prefix
+			opt.SinceTs = st.SinceTs
+			itr := txn.NewIterator(opt)
+			defer itr.Close()
+
+			for idx := range rangeCh {
+				p, err := iterate(itr, ranges[idx])
+				if err != nil {
+					select {
+					case errCh <- err:
+					default:
+					}
+					cancel()
+					return
+				}
+				partials[idx] = p
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	out := partials[:0]
+	for _, p := range partials {
+		if p != nil && p.Count > 0 {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return bytes.Compare(out[i].FirstKey, out[j].FirstKey) < 0
+	})
+	return out, nil
+}
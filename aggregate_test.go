@@ -0,0 +1,84 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamAggregate(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		const n = 7000
+		wb := db.NewWriteBatch()
+		for i := 0; i < n; i++ {
+			val := make([]byte, binary.MaxVarintLen64)
+			val = val[:binary.PutVarint(val, int64(i))]
+			e := NewEntry([]byte(fmt.Sprintf("key-%05d", i)), val).WithMeta(byte(i % 7))
+			require.NoError(t, wb.SetEntry(e))
+		}
+		require.NoError(t, wb.Flush())
+		txnDelete(t, db, []byte("key-00000"))
+
+		stream := db.NewStream()
+		partials, err := stream.Aggregate(ctxb, AggregateCount|AggregateSum|AggregateUserMeta)
+		require.NoError(t, err)
+		require.NotEmpty(t, partials)
+
+		total := &AggregatePartial{}
+		for i, p := range partials {
+			if i > 0 {
+				require.True(t, bytes.Compare(partials[i-1].LastKey, p.FirstKey) < 0)
+			}
+			total.Merge(p)
+		}
+		require.Equal(t, uint64(n-1), total.Count)
+		require.Equal(t, int64(n*(n-1)/2), total.Sum)
+		require.Equal(t, byte(0), total.MinUserMeta)
+		require.Equal(t, byte(6), total.MaxUserMeta)
+		require.Equal(t, []byte("key-00001"), total.FirstKey)
+		require.Equal(t, []byte(fmt.Sprintf("key-%05d", n-1)), total.LastKey)
+
+		stream.ChooseKey = func(item *Item) bool { return item.UserMeta() == 3 }
+		partials, err = stream.Aggregate(ctxb, AggregateCount|AggregateUserMeta)
+		require.NoError(t, err)
+		total = &AggregatePartial{}
+		for _, p := range partials {
+			total.Merge(p)
+		}
+		require.Equal(t, uint64(n/7), total.Count)
+		require.Equal(t, int64(0), total.Sum)
+		require.Equal(t, byte(3), total.MinUserMeta)
+		require.Equal(t, byte(3), total.MaxUserMeta)
+	})
+}
+
+func TestStreamAggregateBadValue(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		txnSet(t, db, []byte("key"), []byte{0x80}, 0)
+		_, err := db.NewStream().Aggregate(ctxb, AggregateSum)
+		require.Error(t, err)
+		partials, err := db.NewStream().Aggregate(ctxb, AggregateCount)
+		require.NoError(t, err)
+		require.Len(t, partials, 1)
+		require.Equal(t, uint64(1), partials[0].Count)
+	})
+}
@@ -17,16 +17,14 @@
 package badger
 
 import (
-	"bufio"
 	"bytes"
 	"context"
-	"encoding/binary"
 	"io"
 
+	"github.com/dgraph-io/badger/v3/backup"
 	"github.com/dgraph-io/badger/v3/pb"
 	"github.com/dgraph-io/badger/v3/y"
 	"github.com/dgraph-io/ristretto/z"
-	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
 )
 
@@ -37,11 +35,12 @@ import (
 const flushThreshold = 100 << 20
 
 // Backup dumps a protobuf-encoded list of all entries in the database into the
-// given writer, that are newer than or equal to the specified version. It
-// returns a timestamp (version) indicating the version of last entry that is
-// dumped, which after incrementing by 1 can be passed into later invocation to
-// generate incremental backup of entries that have been added/modified since
-// the last invocation of DB.Backup().
+// given writer, that are newer than or equal to the specified version. The format
+// of the backup is described in the backup package. It returns a timestamp
+// (version) indicating the version of last entry that is dumped, which after
+// incrementing by 1 can be passed into later invocation to generate incremental
+// backup of entries that have been added/modified since the last invocation of
+// DB.Backup().
 // DB.Backup is a wrapper function over Stream.Backup to generate full and
 // incremental backups of the DB. For more control over how many goroutines are
 // used to generate the backup, or if you wish to backup only a certain range
@@ -90,8 +89,8 @@ func (stream *Stream) Backup(w io.Writer, since uint64) (uint64, error) {
 				}
 			}
 
-			// clear txn bits
-			meta := item.meta &^ (bitTxn | bitFinTxn)
+			// clear txn bits, and the bits of the stored value as the full value was read above.
+			meta := item.meta &^ (bitTxn | bitFinTxn | bitCompressed | bitDelta)
 			kv := y.NewKV(a)
 			*kv = pb.KV{
 				Key:       a.Copy(item.Key()),
@@ -121,6 +120,10 @@ func (stream *Stream) Backup(w io.Writer, since uint64) (uint64, error) {
 		return list, nil
 	}
 
+	bw, err := backup.NewWriter(w, since)
+	if err != nil {
+		return 0, err
+	}
 	var maxVersion uint64
 	stream.Send = func(buf *z.Buffer) error {
 		list, err := BufferToKVList(buf)
@@ -138,25 +141,18 @@ func (stream *Stream) Backup(w io.Writer, since uint64) (uint64, error) {
 			}
 		}
 		list.Kv = out
-		return writeTo(list, w)
+		return bw.Write(list)
 	}
 
 	if err := stream.Orchestrate(context.Background()); err != nil {
 		return 0, err
 	}
-	return maxVersion, nil
-}
-
-func writeTo(list *pb.KVList, w io.Writer) error {
-	if err := binary.Write(w, binary.LittleEndian, uint64(proto.Size(list))); err != nil {
-		return err
-	}
-	buf, err := proto.Marshal(list)
-	if err != nil {
-		return err
+	// The trailer is only written once all the data has been written, so that an interrupted
+	// backup can't be mistaken for a complete one.
+	if err := bw.Close(); err != nil {
+		return 0, err
 	}
-	_, err = w.Write(buf)
-	return err
+	return maxVersion, nil
 }
 
 // KVLoader is used to write KVList objects in to badger. It can be used to restore a backup.
@@ -184,7 +180,8 @@ func (l *KVLoader) Set(kv *pb.KV) error {
 		userMeta = kv.UserMeta[0]
 	}
 	if len(kv.Meta) > 0 {
-		meta = kv.Meta[0]
+		// The values of KVs are never compressed nor delta encoded.
+		meta = kv.Meta[0] &^ (bitCompressed | bitDelta)
 	}
 	e := &Entry{
 		Key:       y.KeyWithTs(kv.Key, kv.Version),
@@ -236,38 +233,28 @@ func (l *KVLoader) Finish() error {
 
 // Load reads a protobuf-encoded list of all entries from a reader and writes
 // them to the database. This can be used to restore the database from a backup
-// made by calling DB.Backup(). If more complex logic is needed to restore a badger
-// backup, the KVLoader interface should be used instead.
+// made by calling DB.Backup(). The backup is verified against its trailer, and an error is
+// returned if it is incomplete or corrupted. The entries read before the error is detected have
+// already been written by then. If more complex logic is needed to restore a badger backup, the
+// KVLoader interface should be used instead.
 //
 // DB.Load() should be called on a database that is not running any other
 // concurrent transactions while it is running.
 func (db *DB) Load(r io.Reader, maxPendingWrites int) error {
-	br := bufio.NewReaderSize(r, 16<<10)
-	unmarshalBuf := make([]byte, 1<<10)
+	br, err := backup.NewReader(r)
+	if err != nil {
+		return err
+	}
 
 	ldr := db.NewKVLoader(maxPendingWrites)
 	for {
-		var sz uint64
-		err := binary.Read(br, binary.LittleEndian, &sz)
+		list, err := br.Next()
 		if err == io.EOF {
 			break
 		} else if err != nil {
 			return err
 		}
 
-		if cap(unmarshalBuf) < int(sz) {
-			unmarshalBuf = make([]byte, sz)
-		}
-
-		if _, err = io.ReadFull(br, unmarshalBuf[:sz]); err != nil {
-			return err
-		}
-
-		list := &pb.KVList{}
-		if err := proto.Unmarshal(unmarshalBuf[:sz], list); err != nil {
-			return err
-		}
-
 		for _, kv := range list.Kv {
 			if err := ldr.Set(kv); err != nil {
 				return err
@@ -0,0 +1,297 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package backup reads and writes the backup format used by DB.Backup and DB.Load. It only
+// depends on the protobuf definitions in the pb package, so backups can be decoded without opening
+// a DB. The format is defined in pb/backup.proto, which can be used to read backups from other
+// languages.
+//
+// A backup starts with the magic bytes, followed by frames. Each frame is a pb.BackupFrame
+// preceded by its size as a little endian uint64. The first frame holds a header with the format
+// version, and the last frame holds a trailer with the number of KVs and a checksum of the frames
+// before it, so that truncated or corrupted backups are detected.
+//
+// Several backups can be concatenated, e.g. a full backup followed by incremental ones, and are
+// read one after the other by Reader.
+//
+// Backups written before the format was versioned have no magic bytes, header or trailer. They are
+// a sequence of pb.KVList messages, each preceded by its size. Reader reads them as version 0.
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/dgraph-io/badger/v3/pb"
+	"github.com/pkg/errors"
+)
+
+// Magic are the bytes a backup starts with.
+const Magic = "BDGRBKUP"
+
+// Version is the version of the backup format written by Writer.
+const Version = 1
+
+var (
+	// ErrUnsupportedVersion is returned when reading a backup written in a newer format.
+	ErrUnsupportedVersion = errors.New("Backup format version is not supported")
+
+	// ErrIncomplete is returned when a backup ends without a trailer.
+	ErrIncomplete = errors.New("Backup is incomplete")
+
+	// ErrCorrupted is returned when the contents of a backup don't match its trailer.
+	ErrCorrupted = errors.New("Backup is corrupted")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Writer writes a backup.
+type Writer struct {
+	w       io.Writer
+	crc     hash.Hash32
+	trailer pb.BackupTrailer
+	buf     []byte
+}
+
+// NewWriter writes the magic bytes and the header of a backup holding the versions since sinceTs
+// to w, and returns a Writer to write the rest of the backup.
+func NewWriter(w io.Writer, sinceTs uint64) (*Writer, error) {
+	bw := &Writer{w: w, crc: crc32.New(castagnoli)}
+	if _, err := io.WriteString(w, Magic); err != nil {
+		return nil, err
+	}
+	header := &pb.BackupHeader{
+		Version:   Version,
+		SinceTs:   sinceTs,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := bw.writeFrame(&pb.BackupFrame{Header: header}); err != nil {
+		return nil, err
+	}
+	return bw, nil
+}
+
+func (bw *Writer) writeFrame(frame *pb.BackupFrame) error {
+	sz := frame.Size()
+	if cap(bw.buf) < 8+sz {
+		bw.buf = make([]byte, 8+sz)
+	}
+	buf := bw.buf[:8+sz]
+	binary.LittleEndian.PutUint64(buf, uint64(sz))
+	if _, err := frame.MarshalToSizedBuffer(buf[8:]); err != nil {
+		return err
+	}
+	if frame.Trailer == nil {
+		bw.crc.Write(buf[8:])
+	}
+	_, err := bw.w.Write(buf)
+	return err
+}
+
+// Write writes a list of KVs to the backup.
+func (bw *Writer) Write(list *pb.KVList) error {
+	for _, kv := range list.Kv {
+		if kv.Version > bw.trailer.MaxVersion {
+			bw.trailer.MaxVersion = kv.Version
+		}
+	}
+	bw.trailer.NumKvs += uint64(len(list.Kv))
+	bw.trailer.NumLists++
+	return bw.writeFrame(&pb.BackupFrame{List: list})
+}
+
+// Close writes the trailer of the backup. It doesn't close the underlying writer.
+func (bw *Writer) Close() error {
+	bw.trailer.Checksum = bw.crc.Sum32()
+	return bw.writeFrame(&pb.BackupFrame{Trailer: &bw.trailer})
+}
+
+// Reader reads a backup.
+type Reader struct {
+	r       *bufio.Reader
+	legacy  bool
+	header  *pb.BackupHeader
+	trailer *pb.BackupTrailer
+	crc     hash.Hash32
+	seen    pb.BackupTrailer
+	buf     []byte
+}
+
+// NewReader reads the magic bytes and the header of the backup in r. Backups without magic bytes
+// are read as version 0.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := &Reader{r: bufio.NewReaderSize(r, 16<<10)}
+	ok, err := br.hasMagic()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		br.legacy = true
+		br.header = &pb.BackupHeader{}
+		return br, nil
+	}
+	if err := br.readHeader(); err != nil {
+		return nil, err
+	}
+	return br, nil
+}
+
+func (br *Reader) hasMagic() (bool, error) {
+	magic, err := br.r.Peek(len(Magic))
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return bytes.Equal(magic, []byte(Magic)), nil
+}
+
+// readHeader reads the magic bytes and the header of the next backup.
+func (br *Reader) readHeader() error {
+	if _, err := br.r.Discard(len(Magic)); err != nil {
+		return err
+	}
+	br.crc = crc32.New(castagnoli)
+	br.seen = pb.BackupTrailer{}
+	br.trailer = nil
+
+	frame, err := br.readFrame()
+	if err == io.EOF {
+		return ErrIncomplete
+	}
+	if err != nil {
+		return err
+	}
+	if frame.Header == nil {
+		return errors.Wrapf(ErrCorrupted, "first frame has no header")
+	}
+	if frame.Header.Version > Version {
+		return errors.Wrapf(ErrUnsupportedVersion, "backup has version %d, supported: %d",
+			frame.Header.Version, Version)
+	}
+	br.header = frame.Header
+	return nil
+}
+
+// Header returns the header of the backup being read. The header of a version 0 backup is empty.
+func (br *Reader) Header() *pb.BackupHeader {
+	return br.header
+}
+
+// Trailer returns the trailer of the last backup, once Next has returned io.EOF. It returns nil
+// for version 0 backups, which have no trailer.
+func (br *Reader) Trailer() *pb.BackupTrailer {
+	return br.trailer
+}
+
+// readFrame reads the next frame, or a KVList wrapped in a frame for version 0 backups. It returns
+// io.EOF if there are no more frames.
+func (br *Reader) readFrame() (*pb.BackupFrame, error) {
+	var szBuf [8]byte
+	if _, err := io.ReadFull(br.r, szBuf[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrIncomplete
+		}
+		return nil, err
+	}
+	sz := binary.LittleEndian.Uint64(szBuf[:])
+	if uint64(cap(br.buf)) < sz {
+		br.buf = make([]byte, sz)
+	}
+	buf := br.buf[:sz]
+	if _, err := io.ReadFull(br.r, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrIncomplete
+		}
+		return nil, err
+	}
+
+	frame := &pb.BackupFrame{}
+	if br.legacy {
+		frame.List = &pb.KVList{}
+		if err := frame.List.Unmarshal(buf); err != nil {
+			return nil, errors.Wrapf(ErrCorrupted, "while decoding list: %v", err)
+		}
+		return frame, nil
+	}
+	if err := frame.Unmarshal(buf); err != nil {
+		return nil, errors.Wrapf(ErrCorrupted, "while decoding frame: %v", err)
+	}
+	if frame.Trailer == nil {
+		br.crc.Write(buf)
+	}
+	return frame, nil
+}
+
+// Next returns the next list of KVs in the backup. It returns io.EOF once all the lists have been
+// read and verified against the trailer.
+func (br *Reader) Next() (*pb.KVList, error) {
+	if br.trailer != nil {
+		// Continue with the next backup, if any.
+		ok, err := br.hasMagic()
+		switch {
+		case err != nil:
+			return nil, err
+		case !ok:
+			if _, err := br.r.Peek(1); err != io.EOF {
+				return nil, errors.Wrapf(ErrCorrupted, "data found after the trailer")
+			}
+			return nil, io.EOF
+		}
+		if err := br.readHeader(); err != nil {
+			return nil, err
+		}
+	}
+	frame, err := br.readFrame()
+	switch {
+	case err == io.EOF && br.legacy:
+		return nil, io.EOF
+	case err == io.EOF:
+		return nil, ErrIncomplete
+	case err != nil:
+		return nil, err
+	}
+
+	if frame.Trailer != nil {
+		if err := br.verify(frame.Trailer); err != nil {
+			return nil, err
+		}
+		br.trailer = frame.Trailer
+		return br.Next()
+	}
+	if frame.List == nil {
+		return nil, errors.Wrapf(ErrCorrupted, "frame has neither a list nor a trailer")
+	}
+	for _, kv := range frame.List.Kv {
+		if kv.Version > br.seen.MaxVersion {
+			br.seen.MaxVersion = kv.Version
+		}
+	}
+	br.seen.NumKvs += uint64(len(frame.List.Kv))
+	br.seen.NumLists++
+	return frame.List, nil
+}
+
+func (br *Reader) verify(trailer *pb.BackupTrailer) error {
+	br.seen.Checksum = br.crc.Sum32()
+	if br.seen != *trailer {
+		return errors.Wrapf(ErrCorrupted, "read %+v, trailer has %+v", br.seen, *trailer)
+	}
+	return nil
+}
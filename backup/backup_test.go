@@ -0,0 +1,157 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3/pb"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func testLists() []*pb.KVList {
+	var lists []*pb.KVList
+	for i := 0; i < 3; i++ {
+		list := &pb.KVList{}
+		for j := 0; j < 10; j++ {
+			list.Kv = append(list.Kv, &pb.KV{
+				Key:     []byte(fmt.Sprintf("key%d-%d", i, j)),
+				Value:   []byte("value"),
+				Version: uint64(i*10 + j),
+			})
+		}
+		lists = append(lists, list)
+	}
+	return lists
+}
+
+func writeBackup(t *testing.T) []byte {
+	var buf bytes.Buffer
+	bw, err := NewWriter(&buf, 5)
+	require.NoError(t, err)
+	for _, list := range testLists() {
+		require.NoError(t, bw.Write(list))
+	}
+	require.NoError(t, bw.Close())
+	return buf.Bytes()
+}
+
+func readAll(data []byte) (*Reader, []*pb.KVList, error) {
+	br, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	var lists []*pb.KVList
+	for {
+		list, err := br.Next()
+		if err == io.EOF {
+			return br, lists, nil
+		}
+		if err != nil {
+			return br, lists, err
+		}
+		lists = append(lists, list)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := writeBackup(t)
+	require.Equal(t, Magic, string(data[:len(Magic)]))
+
+	br, lists, err := readAll(data)
+	require.NoError(t, err)
+	require.Equal(t, testLists(), lists)
+	require.Equal(t, uint32(Version), br.Header().Version)
+	require.Equal(t, uint64(5), br.Header().SinceTs)
+	require.Equal(t, uint64(30), br.Trailer().NumKvs)
+	require.Equal(t, uint64(3), br.Trailer().NumLists)
+	require.Equal(t, uint64(29), br.Trailer().MaxVersion)
+}
+
+func TestLegacy(t *testing.T) {
+	var data []byte
+	for _, list := range testLists() {
+		buf, err := list.Marshal()
+		require.NoError(t, err)
+		var sz [8]byte
+		binary.LittleEndian.PutUint64(sz[:], uint64(len(buf)))
+		data = append(append(data, sz[:]...), buf...)
+	}
+
+	br, lists, err := readAll(data)
+	require.NoError(t, err)
+	require.Equal(t, testLists(), lists)
+	require.Equal(t, uint32(0), br.Header().Version)
+	require.Nil(t, br.Trailer())
+
+	_, lists, err = readAll(nil)
+	require.NoError(t, err)
+	require.Empty(t, lists)
+}
+
+func TestDamaged(t *testing.T) {
+	data := writeBackup(t)
+
+	// Cut in the middle of the trailer, and without the trailer.
+	_, _, err := readAll(data[:len(data)-3])
+	require.Equal(t, ErrIncomplete, errors.Cause(err))
+	var sizes []int
+	for off := len(Magic); off < len(data); {
+		sz := int(binary.LittleEndian.Uint64(data[off:]))
+		sizes = append(sizes, sz)
+		off += 8 + sz
+	}
+	_, _, err = readAll(data[:len(data)-8-sizes[len(sizes)-1]])
+	require.Equal(t, ErrIncomplete, errors.Cause(err))
+
+	// A flipped bit in a value.
+	damaged := append([]byte{}, data...)
+	idx := bytes.Index(damaged, []byte("value"))
+	damaged[idx] ^= 1
+	_, _, err = readAll(damaged)
+	require.Equal(t, ErrCorrupted, errors.Cause(err))
+
+	// A newer format.
+	var buf bytes.Buffer
+	buf.WriteString(Magic)
+	frame, err := (&pb.BackupFrame{Header: &pb.BackupHeader{Version: Version + 1}}).Marshal()
+	require.NoError(t, err)
+	var sz [8]byte
+	binary.LittleEndian.PutUint64(sz[:], uint64(len(frame)))
+	buf.Write(sz[:])
+	buf.Write(frame)
+	_, _, err = readAll(buf.Bytes())
+	require.Equal(t, ErrUnsupportedVersion, errors.Cause(err))
+}
+
+func TestConcatenated(t *testing.T) {
+	data := writeBackup(t)
+	data = append(data, writeBackup(t)...)
+
+	br, lists, err := readAll(data)
+	require.NoError(t, err)
+	require.Equal(t, append(testLists(), testLists()...), lists)
+	require.Equal(t, uint64(3), br.Trailer().NumLists)
+
+	_, _, err = readAll(append(data, 1))
+	require.Equal(t, ErrCorrupted, errors.Cause(err))
+}
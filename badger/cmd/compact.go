@@ -0,0 +1,127 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/y"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var compactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "Compact a range of keys.",
+	Long: `
+This command compacts all the tables holding keys in the given range into the lowest level of the
+LSM tree, discarding the deleted and expired keys. All the versions of the keys are kept, unless
+--num_versions is set to discard the older ones. The DB must not be in use by another process.
+
+With --dry-run, the command instead prints the compactions which the compactors would pick next,
+along with their estimated I/O, without running them or modifying the DB.
+`,
+	RunE: compact,
+}
+
+var co = struct {
+	keyRange    []string
+	hex         bool
+	numVersions int
+	keyPath     string
+	dryRun      bool
+}{}
+
+func init() {
+	RootCmd.AddCommand(compactCmd)
+	compactCmd.Flags().StringSliceVar(&co.keyRange, "range", []string{"", ""},
+		"Range of keys to compact, given as start,end. The start is inclusive and the end is "+
+			"exclusive. An empty end means that the range is unbounded.")
+	compactCmd.Flags().BoolVar(&co.hex, "hex", false, "The start and end keys are hex encoded.")
+	compactCmd.Flags().IntVarP(&co.numVersions, "num_versions", "", 0,
+		"Maximum number of versions to keep per key. Values <= 0 keep all the versions.")
+	compactCmd.Flags().StringVarP(&co.keyPath, "encryption-key-file", "e", "",
+		"Path of the encryption key file.")
+	compactCmd.Flags().BoolVar(&co.dryRun, "dry-run", false,
+		"Print the compactions which would be picked next, without running them.")
+}
+
+func compact(cmd *cobra.Command, args []string) error {
+	if len(co.keyRange) != 2 {
+		return errors.Errorf("--range must be given as start,end. Got: %q", co.keyRange)
+	}
+	bounds := make([][]byte, 2)
+	for i, s := range co.keyRange {
+		bounds[i] = []byte(s)
+		if co.hex {
+			b, err := hex.DecodeString(s)
+			if err != nil {
+				return y.Wrapf(err, "failed to decode hex key: %q", s)
+			}
+			bounds[i] = b
+		}
+	}
+	if co.numVersions <= 0 {
+		co.numVersions = math.MaxInt32
+	}
+	encKey, err := getKey(co.keyPath)
+	if err != nil {
+		return err
+	}
+	opt := badger.DefaultOptions(sstDir).
+		WithValueDir(vlogDir).
+		WithNumVersionsToKeep(co.numVersions).
+		WithNumCompactors(0).
+		WithBlockCacheSize(100 << 20).
+		WithIndexCacheSize(200 << 20).
+		WithEncryptionKey(encKey).
+		WithReadOnly(co.dryRun)
+	db, err := badger.Open(opt)
+	if err != nil {
+		return y.Wrapf(err, "cannot open DB at %s", sstDir)
+	}
+	defer db.Close()
+
+	if co.dryRun {
+		printCompactionPlans(db)
+		return nil
+	}
+	return db.CompactRange(bounds[0], bounds[1])
+}
+
+func printCompactionPlans(db *badger.DB) {
+	fmt.Print(db.LevelsToString())
+	plans := db.PlanCompactions()
+	if len(plans) == 0 {
+		fmt.Println("No compactions would be picked.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FROM\tTO\tSCORE\tADJUSTED\tTOP TABLES\tBOTTOM TABLES\tREAD\tWRITE (MAX)")
+	for _, p := range plans {
+		fmt.Fprintf(w, "L%d\tL%d\t%.2f\t%.2f\t%d\t%d\t%s\t%s\n", p.Level, p.NextLevel,
+			p.Score, p.Adjusted, len(p.TopTables), len(p.BotTables),
+			humanize.IBytes(uint64(p.ReadBytes)), humanize.IBytes(uint64(p.WriteBytes)))
+	}
+	w.Flush()
+}
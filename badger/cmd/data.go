@@ -0,0 +1,246 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var getCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Print the value of a key.",
+	Long: `
+This command prints the value of a key to stdout. The DB is opened in read-only mode.
+`,
+	RunE: doGet,
+}
+
+var setCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set the value of a key.",
+	Long: `
+This command sets the value of a key. The DB must not be in use by another process.
+`,
+	RunE: doSet,
+}
+
+var delCmd = &cobra.Command{
+	Use:   "del",
+	Short: "Delete a key.",
+	Long: `
+This command deletes a key. The DB must not be in use by another process.
+`,
+	RunE: doDel,
+}
+
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Print the keys and values with a prefix.",
+	Long: `
+This command prints the keys with the given prefix in order, along with their values. The DB is
+opened in read-only mode.
+`,
+	RunE: doScan,
+}
+
+var do = struct {
+	key      string
+	value    string
+	prefix   string
+	hex      bool
+	ttl      time.Duration
+	limit    int
+	keysOnly bool
+	keyPath  string
+}{}
+
+func init() {
+	for _, cmd := range []*cobra.Command{getCmd, setCmd, delCmd, scanCmd} {
+		RootCmd.AddCommand(cmd)
+		cmd.Flags().BoolVar(&do.hex, "hex", false,
+			"Keys, prefixes and values are hex encoded, in the flags and in the output.")
+		cmd.Flags().StringVarP(&do.keyPath, "encryption-key-file", "e", "",
+			"Path of the encryption key file.")
+	}
+	for _, cmd := range []*cobra.Command{getCmd, setCmd, delCmd} {
+		cmd.Flags().StringVarP(&do.key, "key", "k", "", "Key to operate on. (required)")
+	}
+	setCmd.Flags().StringVarP(&do.value, "value", "v", "", "Value to set.")
+	setCmd.Flags().DurationVar(&do.ttl, "ttl", 0,
+		"Time after which the key expires. Zero means that the key never expires.")
+	scanCmd.Flags().StringVarP(&do.prefix, "prefix", "p", "",
+		"Only print the keys with this prefix.")
+	scanCmd.Flags().IntVarP(&do.limit, "limit", "n", 0,
+		"Maximum number of keys to print. Values <= 0 mean no limit.")
+	scanCmd.Flags().BoolVar(&do.keysOnly, "keys-only", false, "Only print the keys.")
+}
+
+func openDB(readOnly bool) (*badger.DB, error) {
+	encKey, err := getKey(do.keyPath)
+	if err != nil {
+		return nil, err
+	}
+	opt := badger.DefaultOptions(sstDir).
+		WithValueDir(vlogDir).
+		WithReadOnly(readOnly).
+		WithNumCompactors(0).
+		WithIndexCacheSize(100 << 20).
+		WithEncryptionKey(encKey).
+		WithLoggingLevel(badger.WARNING)
+	db, err := badger.Open(opt)
+	if err != nil {
+		return nil, y.Wrapf(err, "cannot open DB at %s", sstDir)
+	}
+	return db, nil
+}
+
+func decodeArg(name, s string) ([]byte, error) {
+	if !do.hex {
+		return []byte(s), nil
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, y.Wrapf(err, "failed to decode hex %s: %q", name, s)
+	}
+	return b, nil
+}
+
+func encodeArg(b []byte) string {
+	if do.hex {
+		return hex.EncodeToString(b)
+	}
+	return string(b)
+}
+
+func argKey() ([]byte, error) {
+	if do.key == "" {
+		return nil, errors.New("--key not specified")
+	}
+	return decodeArg("key", do.key)
+}
+
+func doGet(cmd *cobra.Command, args []string) error {
+	key, err := argKey()
+	if err != nil {
+		return err
+	}
+	db, err := openDB(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return y.Wrapf(err, "failed to get key %q", do.key)
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println(encodeArg(val))
+		return nil
+	})
+}
+
+func doSet(cmd *cobra.Command, args []string) error {
+	key, err := argKey()
+	if err != nil {
+		return err
+	}
+	val, err := decodeArg("value", do.value)
+	if err != nil {
+		return err
+	}
+	db, err := openDB(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(txn *badger.Txn) error {
+		e := badger.NewEntry(key, val)
+		if do.ttl > 0 {
+			e = e.WithTTL(do.ttl)
+		}
+		return txn.SetEntry(e)
+	})
+}
+
+func doDel(cmd *cobra.Command, args []string) error {
+	key, err := argKey()
+	if err != nil {
+		return err
+	}
+	db, err := openDB(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(key)
+	})
+}
+
+func doScan(cmd *cobra.Command, args []string) error {
+	prefix, err := decodeArg("prefix", do.prefix)
+	if err != nil {
+		return err
+	}
+	db, err := openDB(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(txn *badger.Txn) error {
+		iopt := badger.DefaultIteratorOptions
+		iopt.Prefix = prefix
+		iopt.PrefetchValues = !do.keysOnly
+		it := txn.NewIterator(iopt)
+		defer it.Close()
+
+		count := 0
+		for it.Rewind(); it.Valid(); it.Next() {
+			if do.limit > 0 && count >= do.limit {
+				break
+			}
+			item := it.Item()
+			if do.keysOnly {
+				fmt.Fprintln(os.Stdout, encodeArg(item.Key()))
+			} else {
+				val, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stdout, "%s\t%s\n", encodeArg(item.Key()), encodeArg(val))
+			}
+			count++
+		}
+		return nil
+	})
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Run value log garbage collection.",
+	Long: `
+This command rewrites the value log files which have at least the given ratio of discardable data,
+until no such file is left. The DB must not be in use by another process.
+`,
+	RunE: gc,
+}
+
+var gco = struct {
+	discardRatio float64
+	keyPath      string
+}{}
+
+func init() {
+	RootCmd.AddCommand(gcCmd)
+	gcCmd.Flags().Float64Var(&gco.discardRatio, "discard-ratio", 0.5,
+		"Rewrite a value log file if at least this ratio of its data can be discarded.")
+	gcCmd.Flags().StringVarP(&gco.keyPath, "encryption-key-file", "e", "",
+		"Path of the encryption key file.")
+}
+
+func gc(cmd *cobra.Command, args []string) error {
+	if gco.discardRatio <= 0 || gco.discardRatio >= 1 {
+		return errors.Errorf("--discard-ratio must be in the range (0, 1). Got: %v",
+			gco.discardRatio)
+	}
+	encKey, err := getKey(gco.keyPath)
+	if err != nil {
+		return err
+	}
+	opt := badger.DefaultOptions(sstDir).
+		WithValueDir(vlogDir).
+		WithIndexCacheSize(100 << 20).
+		WithEncryptionKey(encKey)
+	db, err := badger.Open(opt)
+	if err != nil {
+		return y.Wrapf(err, "cannot open DB at %s", sstDir)
+	}
+	defer db.Close()
+
+	var rewritten int
+	for {
+		err := db.RunValueLogGC(gco.discardRatio)
+		if err == badger.ErrNoRewrite {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rewritten++
+	}
+	fmt.Printf("Rewrote %d value log file(s).\n", rewritten)
+	return nil
+}
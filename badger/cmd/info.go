@@ -51,6 +51,7 @@ type flagOptions struct {
 	encryptionKey            string
 	checksumVerificationMode string
 	discard                  bool
+	validate                 bool
 }
 
 var (
@@ -82,6 +83,8 @@ func init() {
 		"[none, table, block, tableAndBlock] Specifies when the db should verify checksum for SST.")
 	infoCmd.Flags().BoolVar(&opt.discard, "discard", false,
 		"Parse and print DISCARD file from value logs.")
+	infoCmd.Flags().BoolVar(&opt.validate, "validate", false,
+		"Check the invariants of the DB and print a report. Fails if any of them is violated.")
 }
 
 var infoCmd = &cobra.Command{
@@ -136,6 +139,13 @@ func handleInfo(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return y.Wrapf(err, "failed to decode hex prefix: %s", opt.withPrefix)
 	}
+	if opt.validate {
+		r := db.CheckInvariants()
+		fmt.Print(r)
+		if err := r.Err(); err != nil {
+			return err
+		}
+	}
 	if opt.showHistogram {
 		db.PrintHistogram(prefix)
 	}
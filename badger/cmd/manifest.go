@@ -0,0 +1,232 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/options"
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/spf13/cobra"
+)
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Print the structure of the DB as JSON.",
+	Long: `
+This command prints the format versions, the options which can be derived from the files, the
+levels and tables of the LSM tree, and the value log files of the DB as JSON, so that the state of
+the DB can be described precisely in bug reports. The DB is opened in read-only mode to read the
+key ranges of the tables.
+`,
+	RunE: dumpManifest,
+}
+
+var mo = struct {
+	keyPath string
+}{}
+
+func init() {
+	RootCmd.AddCommand(manifestCmd)
+	manifestCmd.Flags().StringVarP(&mo.keyPath, "encryption-key-file", "e", "",
+		"Path of the encryption key file.")
+}
+
+type formatDump struct {
+	Manifest uint32 `json:"manifest"`
+	Table    uint32 `json:"table"`
+	Vlog     uint32 `json:"vlog"`
+}
+
+type manifestFileDump struct {
+	Size      int64 `json:"size"`
+	ValidSize int64 `json:"valid_size"`
+	Creations int   `json:"creations"`
+	Deletions int   `json:"deletions"`
+}
+
+type optionsDump struct {
+	MaxLevels   int      `json:"max_levels"`
+	Compression []string `json:"compression"`
+	Encrypted   bool     `json:"encrypted"`
+}
+
+type tableDump struct {
+	ID            uint64 `json:"id"`
+	Size          uint32 `json:"size"`
+	Compression   string `json:"compression"`
+	KeyID         uint64 `json:"key_id,omitempty"`
+	KeyCount      uint32 `json:"key_count"`
+	Smallest      string `json:"smallest"`
+	Biggest       string `json:"biggest"`
+	MinVersion    uint64 `json:"min_version"`
+	MaxVersion    uint64 `json:"max_version"`
+	StaleDataSize uint32 `json:"stale_data_size"`
+}
+
+type levelDump struct {
+	Level  int         `json:"level"`
+	Size   int64       `json:"size"`
+	Tables []tableDump `json:"tables"`
+}
+
+type fileDump struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+type dbDump struct {
+	Dir           string           `json:"dir"`
+	ValueDir      string           `json:"value_dir"`
+	Format        *formatDump      `json:"format"`
+	CurrentFormat formatDump       `json:"current_format"`
+	Manifest      manifestFileDump `json:"manifest"`
+	Options       optionsDump      `json:"options"`
+	Levels        []levelDump      `json:"levels"`
+	VlogFiles     []fileDump       `json:"vlog_files"`
+}
+
+func compressionName(c options.CompressionType) string {
+	switch c {
+	case options.None:
+		return "none"
+	case options.Snappy:
+		return "snappy"
+	case options.ZSTD:
+		return "zstd"
+	}
+	return strconv.Itoa(int(c))
+}
+
+// keyString returns the key without its version, with the non printable bytes escaped.
+func keyString(key []byte) string {
+	s := strconv.Quote(string(y.ParseKey(key)))
+	return s[1 : len(s)-1]
+}
+
+func dumpManifest(cmd *cobra.Command, args []string) error {
+	dump := dbDump{Dir: sstDir, ValueDir: vlogDir}
+
+	fv, ok, err := badger.ReadFormatVersion(sstDir)
+	if err != nil {
+		return err
+	}
+	if ok {
+		dump.Format = &formatDump{Manifest: fv.Manifest, Table: fv.Table, Vlog: fv.Vlog}
+	}
+	cur := badger.CurrentFormatVersion()
+	dump.CurrentFormat = formatDump{Manifest: cur.Manifest, Table: cur.Table, Vlog: cur.Vlog}
+
+	fp, err := os.Open(filepath.Join(sstDir, badger.ManifestFilename))
+	if err != nil {
+		return err
+	}
+	manifest, validSize, err := badger.ReplayManifestFile(fp)
+	fi, statErr := fp.Stat()
+	fp.Close()
+	if err != nil {
+		return y.Wrapf(err, "while reading the manifest")
+	}
+	if statErr != nil {
+		return statErr
+	}
+	dump.Manifest = manifestFileDump{
+		Size:      fi.Size(),
+		ValidSize: validSize,
+		Creations: manifest.Creations,
+		Deletions: manifest.Deletions,
+	}
+
+	dump.Options.Compression = []string{}
+	compressions := make(map[string]struct{})
+	for _, tm := range manifest.Tables {
+		compressions[compressionName(tm.Compression)] = struct{}{}
+		if tm.KeyID != 0 {
+			dump.Options.Encrypted = true
+		}
+	}
+	for c := range compressions {
+		dump.Options.Compression = append(dump.Options.Compression, c)
+	}
+	sort.Strings(dump.Options.Compression)
+
+	// Open the DB to read the key ranges of the tables.
+	encKey, err := getKey(mo.keyPath)
+	if err != nil {
+		return err
+	}
+	opt := badger.DefaultOptions(sstDir).
+		WithValueDir(vlogDir).
+		WithReadOnly(true).
+		WithNumCompactors(0).
+		WithIndexCacheSize(100 << 20).
+		WithEncryptionKey(encKey).
+		WithLoggingLevel(badger.WARNING)
+	if len(manifest.Levels) > opt.MaxLevels {
+		opt = opt.WithMaxLevels(len(manifest.Levels))
+	}
+	db, err := badger.Open(opt)
+	if err != nil {
+		return y.Wrapf(err, "cannot open DB at %s", sstDir)
+	}
+	defer db.Close()
+	dump.Options.MaxLevels = db.Opts().MaxLevels
+
+	dump.Levels = make([]levelDump, db.Opts().MaxLevels)
+	for i := range dump.Levels {
+		dump.Levels[i] = levelDump{Level: i, Tables: []tableDump{}}
+	}
+	for _, ti := range db.Tables() {
+		tm := manifest.Tables[ti.ID]
+		l := &dump.Levels[ti.Level]
+		l.Size += int64(ti.OnDiskSize)
+		l.Tables = append(l.Tables, tableDump{
+			ID:            ti.ID,
+			Size:          ti.OnDiskSize,
+			Compression:   compressionName(tm.Compression),
+			KeyID:         tm.KeyID,
+			KeyCount:      ti.KeyCount,
+			Smallest:      keyString(ti.Left),
+			Biggest:       keyString(ti.Right),
+			MinVersion:    ti.MinVersion,
+			MaxVersion:    ti.MaxVersion,
+			StaleDataSize: ti.StaleDataSize,
+		})
+	}
+
+	fileInfos, err := ioutil.ReadDir(vlogDir)
+	if err != nil {
+		return err
+	}
+	dump.VlogFiles = []fileDump{}
+	for _, fi := range fileInfos {
+		if strings.HasSuffix(fi.Name(), ".vlog") {
+			dump.VlogFiles = append(dump.VlogFiles, fileDump{Name: fi.Name(), Size: fi.Size()})
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dump)
+}
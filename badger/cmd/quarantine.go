@@ -0,0 +1,77 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/dgraph-io/badger/v3"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var quarantineCmd = &cobra.Command{
+	Use:   "quarantine",
+	Short: "List or purge the files moved to quarantine.",
+	Long: `
+On open, Badger moves the table files which aren't referenced by the MANIFEST to the quarantine
+subdirectory instead of deleting them. This command lists the quarantined files. Once they have
+been reviewed, they can be deleted with --purge.
+`,
+	RunE: handleQuarantine,
+}
+
+var qo = struct {
+	purge bool
+}{}
+
+func init() {
+	RootCmd.AddCommand(quarantineCmd)
+	quarantineCmd.Flags().BoolVar(&qo.purge, "purge", false, "Delete the quarantined files.")
+}
+
+func handleQuarantine(cmd *cobra.Command, args []string) error {
+	if qo.purge {
+		n, err := badger.PurgeQuarantine(sstDir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Deleted %d quarantined files.\n", n)
+		return nil
+	}
+
+	qdir := filepath.Join(sstDir, badger.QuarantineDir)
+	fileInfos, err := ioutil.ReadDir(qdir)
+	if os.IsNotExist(err) || (err == nil && len(fileInfos) == 0) {
+		fmt.Println("No quarantined files.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tSIZE\tMODIFIED")
+	for _, fi := range fileInfos {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", filepath.Join(qdir, fi.Name()),
+			humanize.IBytes(uint64(fi.Size())), fi.ModTime().Format("2006-01-02 15:04:05"))
+	}
+	return w.Flush()
+}
@@ -27,6 +27,9 @@ import (
 
 var sstDir, vlogDir string
 
+// dirAnnotation is set to "optional" in the annotations of the commands which don't need --dir.
+const dirAnnotation = "dir"
+
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
 	Use:               "badger",
@@ -56,6 +59,9 @@ func validateRootCmdArgs(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 	if sstDir == "" {
+		if cmd.Annotations[dirAnnotation] == "optional" {
+			return nil
+		}
 		return errors.New("--dir not specified")
 	}
 	if vlogDir == "" {
@@ -0,0 +1,214 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/server"
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the DB over HTTP.",
+	Long: `
+This command opens the DB and serves it over HTTP until it is interrupted. Other commands, such as
+tail, can attach to it while it is being written to.
+`,
+	RunE: serve,
+}
+
+var sro = struct {
+	addr     string
+	readOnly bool
+	keyPath  string
+	aclPath  string
+	tls      server.TLSOptions
+	insecure bool
+	limits   server.Options
+}{}
+
+func init() {
+	RootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringVar(&sro.addr, "addr", "localhost:9090",
+		"Address to listen on.")
+	serveCmd.Flags().BoolVar(&sro.readOnly, "read_only", false,
+		"Option to open the DB in read-only mode")
+	serveCmd.Flags().StringVarP(&sro.keyPath, "encryption-key-file", "e", "",
+		"Path of the encryption key file.")
+	serveCmd.Flags().StringVar(&sro.aclPath, "acl", "",
+		"Path of a JSON file mapping the tokens to identities, and the identities to the key "+
+			"prefixes they may read or write. If not set, all requests are allowed.")
+	serveCmd.Flags().StringVar(&sro.tls.CertFile, "tls-cert", "",
+		"Path of the PEM encoded TLS certificate of the server. It is reloaded when it changes.")
+	serveCmd.Flags().StringVar(&sro.tls.KeyFile, "tls-key", "",
+		"Path of the PEM encoded TLS private key of the server. It is reloaded when it changes.")
+	serveCmd.Flags().StringVar(&sro.tls.ClientCAFile, "tls-client-ca", "",
+		"Path of the PEM encoded CA certificates to verify client certificates with. If set, "+
+			"clients must present a valid certificate.")
+	serveCmd.Flags().Float64Var(&sro.limits.RateLimit, "rate-limit", 0,
+		"Requests per second allowed for each client identity, or IP address if it has none. "+
+			"0 means no limit.")
+	serveCmd.Flags().IntVar(&sro.limits.RateBurst, "rate-burst", 100,
+		"Number of requests each client may send at once, on top of --rate-limit.")
+	serveCmd.Flags().Float64Var(&sro.limits.AddrRateLimit, "addr-rate-limit", 0,
+		"Requests per second allowed for each client IP address, before authenticating them. "+
+			"0 means --rate-limit and --rate-burst.")
+	serveCmd.Flags().IntVar(&sro.limits.AddrRateBurst, "addr-rate-burst", 100,
+		"Number of requests each client IP address may send at once, on top of "+
+			"--addr-rate-limit.")
+	serveCmd.Flags().IntVar(&sro.limits.MaxConcurrentScans, "max-scans", 0,
+		"Number of scans and subscriptions each client may run at the same time. 0 means no "+
+			"limit.")
+	serveCmd.Flags().BoolVar(&sro.insecure, "insecure", false,
+		"Allow serving without TLS on an address which is not a loopback address.")
+}
+
+// isLoopback returns true if addr only accepts connections from the local host.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func serve(cmd *cobra.Command, args []string) error {
+	useTLS := sro.tls.CertFile != "" || sro.tls.KeyFile != ""
+	if !useTLS && sro.tls.ClientCAFile != "" {
+		return errors.New("--tls-client-ca needs --tls-cert and --tls-key")
+	}
+	if !useTLS && !sro.insecure && !isLoopback(sro.addr) {
+		return errors.Errorf("refusing to serve %s without TLS. Set --tls-cert and --tls-key, "+
+			"or --insecure", sro.addr)
+	}
+	srv := &http.Server{Addr: sro.addr}
+	if useTLS {
+		config, err := server.NewTLSConfig(sro.tls)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = config
+	}
+
+	encKey, err := getKey(sro.keyPath)
+	if err != nil {
+		return err
+	}
+	var sopt server.Options
+	if sro.aclPath != "" {
+		acl, err := server.LoadACL(sro.aclPath)
+		if err != nil {
+			return err
+		}
+		sopt = acl.Options()
+	}
+	opt := badger.DefaultOptions(sstDir).
+		WithValueDir(vlogDir).
+		WithReadOnly(sro.readOnly).
+		WithIndexCacheSize(100 << 20).
+		WithEncryptionKey(encKey)
+	db, err := badger.Open(opt)
+	if err != nil {
+		return y.Wrapf(err, "cannot open DB at %s", sstDir)
+	}
+	defer db.Close()
+
+	sopt.RateLimit = sro.limits.RateLimit
+	sopt.RateBurst = sro.limits.RateBurst
+	sopt.MaxConcurrentScans = sro.limits.MaxConcurrentScans
+	srv.Handler = server.New(db, sopt)
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		db.Opts().Logger.Infof("Shutting down the server")
+		// Subscriptions never finish on their own, so don't wait for them.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_ = srv.Shutdown(ctx)
+		_ = srv.Close()
+	}()
+
+	db.Opts().Logger.Infof("Serving %s on %s (TLS: %v)", sstDir, sro.addr, useTLS)
+	if useTLS {
+		// The certificates come from srv.TLSConfig.
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// clientFlags are the flags of the commands which connect to a server.
+type clientFlags struct {
+	addr     string
+	token    string
+	caFile   string
+	certFile string
+	keyFile  string
+}
+
+func (f *clientFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.addr, "addr", "localhost:9090",
+		"Address of the server. Use an https:// URL to connect with TLS.")
+	cmd.Flags().StringVar(&f.token, "token", "", "Token to authenticate to the server.")
+	cmd.Flags().StringVar(&f.caFile, "tls-ca", "",
+		"Path of the PEM encoded CA certificates to verify the server with. Implies TLS.")
+	cmd.Flags().StringVar(&f.certFile, "tls-cert", "",
+		"Path of the PEM encoded TLS client certificate. Implies TLS.")
+	cmd.Flags().StringVar(&f.keyFile, "tls-key", "",
+		"Path of the PEM encoded TLS client private key. Implies TLS.")
+}
+
+func (f *clientFlags) client() (*server.Client, error) {
+	useTLS := strings.HasPrefix(f.addr, "https://") ||
+		f.caFile != "" || f.certFile != "" || f.keyFile != ""
+	addr := f.addr
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+		if useTLS {
+			addr = "https://" + f.addr
+		}
+	}
+	c := &server.Client{Addr: addr, Token: f.token}
+	if useTLS {
+		config, err := server.NewClientTLSConfig(f.caFile, f.certFile, f.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.HTTPClient = &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	}
+	return c, nil
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/badgertest"
+	"github.com/dgraph-io/badger/v3/vfs"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var soakCmd = &cobra.Command{
+	Use:   "soak",
+	Short: "Run a long soak test of a configuration.",
+	Long: `
+This command runs random transactions mixing writes, reads and scans against a new DB for hours,
+checking every read against a model of the expected data. Along the way, it periodically:
+
+ - compares the whole DB to the model and runs the value log GC,
+ - closes and opens the DB again,
+ - takes crash images of the DB, as a kill -9 would leave it, and checks the recovered DB,
+ - simulates a full disk, during which writes may fail.
+
+Use it to validate a configuration and hardware before rolling them out to production. A failure
+can be reproduced by running again with the printed seed.
+`,
+	RunE: runSoak,
+}
+
+var sk = struct {
+	hours          float64
+	seed           int64
+	keys           int
+	maxValueSize   int
+	valueThreshold int64
+	syncWrites     bool
+	checkEvery     time.Duration
+	restartEvery   time.Duration
+	crashEvery     time.Duration
+	diskFullEvery  time.Duration
+	diskFullFor    time.Duration
+}{}
+
+func init() {
+	RootCmd.AddCommand(soakCmd)
+	soakCmd.Flags().Float64Var(&sk.hours, "hours", 1, "Duration of the test, in hours.")
+	soakCmd.Flags().Int64Var(&sk.seed, "seed", 0,
+		"Seed of the random transactions. A random seed is used if 0.")
+	soakCmd.Flags().IntVar(&sk.keys, "keys", 1000000, "Number of distinct keys.")
+	soakCmd.Flags().IntVar(&sk.maxValueSize, "max-value-size", 4<<10,
+		"Maximum size of a value, in bytes.")
+	soakCmd.Flags().Int64Var(&sk.valueThreshold, "value-threshold",
+		badger.DefaultOptions("").ValueThreshold,
+		"Values bigger than this are stored in the value log.")
+	soakCmd.Flags().BoolVar(&sk.syncWrites, "sync-writes", false, "Sync every write.")
+	soakCmd.Flags().DurationVar(&sk.checkEvery, "check-every", time.Minute,
+		"Interval between comparisons of the whole DB to the model. 0 to disable.")
+	soakCmd.Flags().DurationVar(&sk.restartEvery, "restart-every", 10*time.Minute,
+		"Interval between restarts of the DB. 0 to disable.")
+	soakCmd.Flags().DurationVar(&sk.crashEvery, "crash-every", 5*time.Minute,
+		"Interval between crash images. 0 to disable.")
+	soakCmd.Flags().DurationVar(&sk.diskFullEvery, "disk-full-every", 15*time.Minute,
+		"Interval between simulations of a full disk. 0 to disable.")
+	soakCmd.Flags().DurationVar(&sk.diskFullFor, "disk-full-for", 30*time.Second,
+		"Duration of a simulation of a full disk.")
+}
+
+// errDiskFull is returned by the writes while a full disk is simulated.
+var errDiskFull = errors.New("no space left on device (simulated)")
+
+// soakStats counts what a soak test did.
+type soakStats struct {
+	txns, failedTxns                     int
+	checks, restarts, crashes, diskFulls int
+}
+
+// ticker fires every interval, or never if interval is 0.
+type ticker struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newTicker(interval time.Duration) *ticker {
+	return &ticker{interval: interval, next: time.Now().Add(interval)}
+}
+
+func (t *ticker) fired(now time.Time) bool {
+	if t.interval <= 0 || now.Before(t.next) {
+		return false
+	}
+	t.next = now.Add(t.interval)
+	return true
+}
+
+func runSoak(cmd *cobra.Command, args []string) error {
+	for _, dir := range []string{sstDir, vlogDir} {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if len(infos) > 0 {
+			return errors.Errorf("%s must be empty, as the test needs to know all the keys", dir)
+		}
+	}
+	if sk.seed == 0 {
+		sk.seed = time.Now().UnixNano()
+	}
+	fmt.Printf("Running a soak test with seed %d\n", sk.seed)
+
+	var diskFull int32
+	crashFS := badgertest.NewCrashFS(vfs.OS)
+	opt := badger.DefaultOptions(sstDir).
+		WithValueDir(vlogDir).
+		WithValueThreshold(sk.valueThreshold).
+		WithSyncWrites(sk.syncWrites).
+		WithCheckInvariants(true).
+		WithLoggingLevel(badger.WARNING)
+	opt.FS = &vfs.FaultFS{FS: crashFS, Inject: func(op, path string) error {
+		if atomic.LoadInt32(&diskFull) == 1 &&
+			(op == "Write" || op == "Truncate" || op == "OpenMmapFile") {
+			return errDiskFull
+		}
+		return nil
+	}}
+	db, err := badger.Open(opt)
+	if err != nil {
+		return err
+	}
+	var st soakStats
+	err = soak(&db, opt, crashFS, &diskFull, &st)
+	if db != nil {
+		if cerr := db.Close(); err == nil {
+			err = cerr
+		}
+	}
+	fmt.Println(st.String())
+	return errors.Wrapf(err, "soak test failed after %d transactions, with seed %d", st.txns,
+		sk.seed)
+}
+
+func soak(db **badger.DB, opt badger.Options, crashFS *badgertest.CrashFS, diskFull *int32,
+	st *soakStats) error {
+	gen := badgertest.NewGenerator(badgertest.Config{
+		Keys:         sk.keys,
+		MaxValueSize: sk.maxValueSize,
+		MaxTxnOps:    badgertest.DefaultConfig.MaxTxnOps,
+	}, rand.NewSource(sk.seed))
+	m := badgertest.NewModel()
+	start := time.Now()
+	deadline := start.Add(time.Duration(sk.hours * float64(time.Hour)))
+	check, restart := newTicker(sk.checkEvery), newTicker(sk.restartEvery)
+	crash, full := newTicker(sk.crashEvery), newTicker(sk.diskFullEvery)
+
+	// Once the time is up, wait for the disk to be "freed" to check the DB a last time.
+	for now := start; now.Before(deadline) || atomic.LoadInt32(diskFull) == 1; now = time.Now() {
+		wasFull := atomic.LoadInt32(diskFull) == 1
+		err := badgertest.Apply(*db, m, gen.Txn())
+		switch {
+		case err == nil:
+		case errors.Cause(err) != badgertest.ErrMismatch &&
+			(wasFull || atomic.LoadInt32(diskFull) == 1):
+			// The transaction wasn't committed, so it isn't in the model either.
+			st.failedTxns++
+		default:
+			return err
+		}
+		st.txns++
+
+		if check.fired(now) {
+			if err := m.Check(*db); err != nil {
+				return err
+			}
+			if err := (*db).RunValueLogGC(0.5); err != nil && err != badger.ErrNoRewrite &&
+				err != badger.ErrRejected && atomic.LoadInt32(diskFull) == 0 {
+				return errors.Wrapf(err, "while running the value log GC")
+			}
+			st.checks++
+			fmt.Printf("%s: %d keys, %s\n", now.Sub(start).Round(time.Second), m.Len(), st)
+		}
+		if crash.fired(now) {
+			if err := badgertest.CheckCrash(crashFS, opt, m); err != nil {
+				return err
+			}
+			st.crashes++
+		}
+		// Closing the DB flushes the memtables, which can't be done while the disk is full.
+		if restart.fired(now) && atomic.LoadInt32(diskFull) == 0 {
+			err := (*db).Close()
+			*db = nil
+			if err != nil {
+				return errors.Wrapf(err, "while closing the DB")
+			}
+			if *db, err = badger.Open(opt); err != nil {
+				return errors.Wrapf(err, "while opening the DB")
+			}
+			st.restarts++
+		}
+		if full.fired(now) && atomic.CompareAndSwapInt32(diskFull, 0, 1) {
+			// Writes can block while the disk is full, so the disk is freed by a timer.
+			time.AfterFunc(sk.diskFullFor, func() { atomic.StoreInt32(diskFull, 0) })
+			st.diskFulls++
+		}
+	}
+	return m.Check(*db)
+}
+
+func (st *soakStats) String() string {
+	return fmt.Sprintf("%s transactions (%d failed on a full disk), %d checks, %d restarts, "+
+		"%d crashes, %d full disks", humanize.Comma(int64(st.txns)), st.failedTxns, st.checks,
+		st.restarts, st.crashes, st.diskFulls)
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/dgraph-io/badger/v3/server"
+	"github.com/spf13/cobra"
+)
+
+var tailCmd = &cobra.Command{
+	Use:   "tail",
+	Short: "Print the writes to a served DB as they are committed.",
+	Long: `
+This command attaches to a DB served by the serve command, and prints every write to a key with the
+given prefix as it is committed, until it is interrupted. It doesn't need --dir.
+`,
+	Annotations: map[string]string{dirAnnotation: "optional"},
+	RunE:        tail,
+}
+
+var to = struct {
+	clientFlags
+	prefix string
+}{}
+
+func init() {
+	RootCmd.AddCommand(tailCmd)
+	to.register(tailCmd)
+	tailCmd.Flags().StringVarP(&to.prefix, "prefix", "p", "",
+		"Only print the writes to keys with this prefix.")
+}
+
+func tail(cmd *cobra.Command, args []string) error {
+	c, err := to.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		cancel()
+	}()
+
+	err = c.Subscribe(ctx, []byte(to.prefix), func(kv *server.KV) error {
+		fmt.Printf("version=%d key=%q value=%q", kv.Version, kv.Key, kv.Value)
+		if kv.UserMeta != 0 {
+			fmt.Printf(" meta=%x", kv.UserMeta)
+		}
+		if kv.ExpiresAt != 0 {
+			fmt.Printf(" expires_at=%d", kv.ExpiresAt)
+		}
+		fmt.Println()
+		return nil
+	})
+	if err == context.Canceled {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Show the live performance of a served DB.",
+	Long: `
+This command polls the stats of a DB served by the serve command, and shows the rate of the
+operations, their latencies, the compaction activity and the cache hit ratios, until it is
+interrupted. It doesn't need --dir.
+`,
+	Annotations: map[string]string{dirAnnotation: "optional"},
+	RunE:        top,
+}
+
+var tpo = struct {
+	clientFlags
+	interval time.Duration
+}{}
+
+func init() {
+	RootCmd.AddCommand(topCmd)
+	tpo.register(topCmd)
+	topCmd.Flags().DurationVar(&tpo.interval, "interval", time.Second,
+		"How often to refresh the stats.")
+}
+
+func top(cmd *cobra.Command, args []string) error {
+	if tpo.interval <= 0 {
+		return errors.Errorf("--interval must be positive. Got: %v", tpo.interval)
+	}
+	c, err := tpo.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		cancel()
+	}()
+
+	prev, err := c.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	prevTime := time.Now()
+	ticker := time.NewTicker(tpo.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		cur, err := c.Stats(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		printTop(tpo.addr, prev, cur, now.Sub(prevTime))
+		prev, prevTime = cur, now
+	}
+}
+
+func printTop(addr string, prev, cur *badger.Stats, dur time.Duration) {
+	rate := func(prev, cur uint64) string {
+		return fmt.Sprintf("%.1f/s", float64(cur-prev)/dur.Seconds())
+	}
+	latency := func(s badger.LatencyStats) string {
+		return fmt.Sprintf("p50 %v  p90 %v  p99 %v  max %v", s.P50, s.P90, s.P99, s.Max)
+	}
+
+	// Clear the screen and move the cursor to the top left corner.
+	fmt.Print("\033[H\033[2J")
+	fmt.Printf("badger top - %s - %s\n\n", addr, time.Now().Format("15:04:05"))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Gets\t%s\t%s\n", rate(prev.Gets.Count, cur.Gets.Count), latency(cur.Gets))
+	fmt.Fprintf(w, "Commits\t%s\t%s\n",
+		rate(prev.Commits.Count, cur.Commits.Count), latency(cur.Commits))
+	fmt.Fprintf(w, "Writes\t%s\t\n", rate(prev.Writes, cur.Writes))
+	fmt.Fprintln(w, "\t\t")
+	fmt.Fprintf(w, "Compactions\t%s\t%d running, %d done, %s/s written\n",
+		rate(prev.Compactions, cur.Compactions), cur.RunningCompactions, cur.Compactions,
+		humanize.IBytes(uint64(float64(cur.CompactedBytes-prev.CompactedBytes)/dur.Seconds())))
+	fmt.Fprintf(w, "L0 tables\t%d\t\n", cur.NumLevelZeroTables)
+	fmt.Fprintln(w, "\t\t")
+	fmt.Fprintf(w, "Block cache\t%.1f%% hits\t\n", 100*cur.BlockCacheHitRatio)
+	fmt.Fprintf(w, "Index cache\t%.1f%% hits\t\n", 100*cur.IndexCacheHitRatio)
+	fmt.Fprintf(w, "Size\tLSM %s\tvlog %s\n",
+		humanize.IBytes(uint64(cur.LSMSize)), humanize.IBytes(uint64(cur.VlogSize)))
+	w.Flush()
+	if len(cur.KeyAdvice) > 0 {
+		fmt.Println()
+	}
+	for _, advice := range cur.KeyAdvice {
+		fmt.Println(advice)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/options"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade the DB to the current on-disk format.",
+	Long: `
+This command rewrites all the tables and value log files of the DB in the current on-disk format.
+The data is first written to a new DB next to the original one and verified against it. The new
+DB then takes the place of the original, which is kept with a .old suffix unless --delete-old is
+set. The compression and encryption of the new files can be changed along the way.
+
+The DB must not be in use while it is being upgraded.
+`,
+	RunE: upgrade,
+}
+
+var uo = struct {
+	keyPath         string
+	compressionType uint32
+	numVersions     int
+	deleteOld       bool
+}{}
+
+func init() {
+	RootCmd.AddCommand(upgradeCmd)
+	upgradeCmd.Flags().StringVarP(&uo.keyPath, "encryption-key-file", "e", "",
+		"Path of the encryption key file. The upgraded DB is encrypted with the same key.")
+	upgradeCmd.Flags().Uint32VarP(&uo.compressionType, "compression", "", 1,
+		"Option to configure the compression type in the upgraded DB. "+
+			"0 to disable, 1 for Snappy, and 2 for ZSTD.")
+	upgradeCmd.Flags().IntVarP(&uo.numVersions, "num_versions", "", 0,
+		"Option to configure the maximum number of versions per key. "+
+			"Values <= 0 will be considered to have the max number of versions.")
+	upgradeCmd.Flags().BoolVarP(&uo.deleteOld, "delete-old", "", false,
+		"Delete the original DB once the upgrade has been verified.")
+}
+
+func upgrade(cmd *cobra.Command, args []string) error {
+	if uo.compressionType > 2 {
+		return errors.Errorf(
+			"compression value must be one of 0 (disabled), 1 (Snappy), or 2 (ZSTD)")
+	}
+	if uo.numVersions <= 0 {
+		uo.numVersions = math.MaxInt32
+	}
+	encKey, err := getKey(uo.keyPath)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Clean(sstDir)
+	fv, ok, err := badger.ReadFormatVersion(dir)
+	if err != nil {
+		return err
+	}
+	if ok {
+		fmt.Printf("Current format: %+v\n", fv)
+	} else {
+		fmt.Println("Current format: unknown")
+	}
+	fmt.Printf("Upgrading to format: %+v\n", badger.CurrentFormatVersion())
+
+	outDir := dir + ".upgrade"
+	oldDir := dir + ".old"
+	for _, d := range []string{outDir, oldDir} {
+		if _, err := os.Stat(d); err == nil {
+			return errors.Errorf("%s already exists. Please remove it before upgrading", d)
+		}
+	}
+
+	opt := badger.DefaultOptions(dir).
+		WithValueDir(vlogDir).
+		WithNumVersionsToKeep(uo.numVersions).
+		WithBlockCacheSize(100 << 20).
+		WithIndexCacheSize(200 << 20).
+		WithEncryptionKey(encKey)
+	outOpt := opt.
+		WithDir(outDir).
+		WithValueDir(outDir).
+		WithCompression(options.CompressionType(uo.compressionType))
+	if err := badger.Upgrade(opt, outOpt); err != nil {
+		return err
+	}
+
+	if err := os.Rename(dir, oldDir); err != nil {
+		return err
+	}
+	if err := os.Rename(outDir, dir); err != nil {
+		return err
+	}
+	if filepath.Clean(vlogDir) != dir {
+		fmt.Printf("The value log files now live in %s. %s is no longer used.\n", dir, vlogDir)
+	}
+	if uo.deleteOld {
+		if err := os.RemoveAll(oldDir); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("The original DB has been kept at %s.\n", oldDir)
+	}
+	fmt.Println("Done.")
+	return nil
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/loadgen"
 	"github.com/dgraph-io/badger/v3/options"
 	"github.com/dgraph-io/badger/v3/pb"
 	"github.com/dgraph-io/badger/v3/y"
@@ -59,6 +60,11 @@ var (
 		sorted     bool
 		showLogs   bool
 
+		keyDist  string
+		keySpace float64
+		zipfS    float64
+		valDist  string
+
 		valueThreshold   int64
 		numVersions      int
 		vlogMaxEntries   uint32
@@ -102,6 +108,15 @@ func init() {
 		"Force compact level 0 on close.")
 	writeBenchCmd.Flags().BoolVarP(&wo.sorted, "sorted", "s", false, "Write keys in sorted order.")
 	writeBenchCmd.Flags().BoolVarP(&wo.showLogs, "verbose", "v", false, "Show Badger logs.")
+	writeBenchCmd.Flags().StringVar(&wo.keyDist, "key-dist", "uniform",
+		"Distribution of the keys: uniform, zipfian or sequential. Ignored with --sorted.")
+	writeBenchCmd.Flags().Float64Var(&wo.keySpace, "key-space-mil", 0,
+		"Number of distinct keys in millions. 0 means that random keys are almost never repeated.")
+	writeBenchCmd.Flags().Float64Var(&wo.zipfS, "zipf-s", 1.1,
+		"Skew of the zipfian key distribution, greater than 1.")
+	writeBenchCmd.Flags().StringVar(&wo.valDist, "val-dist", "uniform",
+		"Distribution of the value sizes: fixed, uniform (up to --val-size) or exponential "+
+			"(with mean --val-size).")
 	writeBenchCmd.Flags().Int64VarP(&wo.valueThreshold, "value-th", "t", 1<<10, "Value threshold")
 	writeBenchCmd.Flags().IntVarP(&wo.numVersions, "num-version", "n", 1, "Number of versions to keep")
 	writeBenchCmd.Flags().Int64Var(&wo.blockCacheSize, "block-cache-mb", 256,
@@ -132,21 +147,35 @@ func init() {
 }
 
 func writeRandom(db *badger.DB, num uint64) error {
-	value := make([]byte, wo.valSz)
-	y.Check2(rand.Read(value))
+	cfg := loadgen.Config{
+		Keys:      math.MaxUint64,
+		KeySize:   wo.keySz,
+		ZipfS:     wo.zipfS,
+		ValueSize: wo.valSz,
+	}
+	if wo.keySpace > 0 {
+		cfg.Keys = uint64(wo.keySpace * mil)
+	}
+	var err error
+	if cfg.KeyDist, err = loadgen.ParseKeyDistribution(wo.keyDist); err != nil {
+		return err
+	}
+	if cfg.ValueDist, err = loadgen.ParseValueDistribution(wo.valDist); err != nil {
+		return err
+	}
+	gen, err := loadgen.New(cfg, time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
 
-	es := uint64(wo.keySz + wo.valSz) // entry size is keySz + valSz
 	batch := db.NewManagedWriteBatch()
 
 	ttlPeriod, errParse := time.ParseDuration(wo.ttlDuration)
 	y.Check(errParse)
 
 	for i := uint64(1); i <= num; i++ {
-		key := make([]byte, wo.keySz)
-		y.Check2(rand.Read(key))
-
-		vsz := rand.Intn(wo.valSz) + 1
-		e := badger.NewEntry(key, value[:vsz])
+		key, value := gen.Next(make([]byte, 0, wo.keySz))
+		e := badger.NewEntry(key, value)
 
 		if ttlPeriod != 0 {
 			e.WithTTL(ttlPeriod)
@@ -162,7 +191,7 @@ func writeRandom(db *badger.DB, num uint64) error {
 		}
 
 		atomic.AddUint64(&entriesWritten, 1)
-		atomic.AddUint64(&sizeWritten, es)
+		atomic.AddUint64(&sizeWritten, uint64(len(key)+len(value)))
 	}
 	return batch.Flush()
 }
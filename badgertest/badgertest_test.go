@@ -0,0 +1,113 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badgertest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+var testRunOptions = RunOptions{
+	Config: Config{
+		Keys:         500,
+		MaxValueSize: 256,
+		MaxTxnOps:    8,
+	},
+	Seed:       1,
+	Txns:       5000,
+	CrashEvery: 1000,
+	CheckEvery: 250,
+}
+
+// testOptions returns the options of a DB in a new temporary directory, which the caller must
+// remove.
+func testOptions(t *testing.T) badger.Options {
+	dir, err := ioutil.TempDir("", "badgertest")
+	require.NoError(t, err)
+	return badger.DefaultOptions(dir).
+		WithMemTableSize(1 << 20).
+		WithValueLogFileSize(1 << 20).
+		WithValueThreshold(128).
+		WithLoggingLevel(badger.WARNING)
+}
+
+func TestRun(t *testing.T) {
+	opt := testOptions(t)
+	defer os.RemoveAll(opt.Dir)
+	require.NoError(t, Run(opt, testRunOptions))
+}
+
+func TestRunSyncWrites(t *testing.T) {
+	opt := testOptions(t)
+	defer os.RemoveAll(opt.Dir)
+	require.NoError(t, Run(opt.WithSyncWrites(true), testRunOptions))
+}
+
+func TestRunInMemory(t *testing.T) {
+	opt := badger.DefaultOptions("").WithInMemory(true).WithLoggingLevel(badger.WARNING)
+	require.NoError(t, Run(opt, testRunOptions))
+}
+
+func TestModelMismatch(t *testing.T) {
+	opt := testOptions(t)
+	defer os.RemoveAll(opt.Dir)
+	db, err := badger.Open(opt)
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := NewModel()
+	require.NoError(t, Apply(db, m, []Op{{Kind: OpSet, Key: []byte("a"), Value: []byte("1")}}))
+	v, ok := m.Get([]byte("a"))
+	require.True(t, ok)
+	require.Equal(t, []byte("1"), v)
+	require.NoError(t, m.Check(db))
+
+	// Change the DB behind the back of the model.
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("b"), nil)
+	}))
+	require.Equal(t, ErrMismatch, errors.Cause(m.Check(db)))
+	err = Apply(db, m, []Op{{Kind: OpGet, Key: []byte("b")}})
+	require.Equal(t, ErrMismatch, errors.Cause(err))
+	err = Apply(db, m, []Op{{Kind: OpDelete, Key: []byte("b")}, {Kind: OpScan}})
+	require.NoError(t, err)
+	require.NoError(t, m.Check(db))
+	require.Equal(t, 1, m.Len())
+}
+
+func TestDecodeOps(t *testing.T) {
+	ops := DecodeOps([]byte{0, 1, 3, 1, 1, 0, 2, 1, 0, 3, 1, 0, 4})
+	require.Len(t, ops, 4)
+	require.Equal(t, Op{Kind: OpSet, Key: []byte("key00000001"), Value: []byte{1, 0, 3}}, ops[0])
+	require.Equal(t, Op{Kind: OpDelete, Key: []byte("key00000001")}, ops[1])
+	require.Equal(t, Op{Kind: OpGet, Key: []byte("key00000001")}, ops[2])
+	require.Equal(t, Op{Kind: OpScan, Key: []byte("key000000")}, ops[3])
+
+	opt := testOptions(t)
+	defer os.RemoveAll(opt.Dir)
+	db, err := badger.Open(opt)
+	require.NoError(t, err)
+	defer db.Close()
+	m := NewModel()
+	require.NoError(t, Apply(db, m, ops))
+	require.NoError(t, m.Check(db))
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badgertest
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3/vfs"
+	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
+)
+
+// CrashFS wraps an FS to take crash images of directories: copies of the directories as a crash
+// of the process, e.g. via kill -9, would leave them. The operations changing files are paused
+// while an image is taken, so that the image matches a single point in time.
+//
+// The writes to memory-mapped files can't be paused. Badger only appends to them, and ignores the
+// partial entries at their end, so an image can hold a partial entry like after a real crash.
+type CrashFS struct {
+	vfs.FS
+	// Held in read mode by the operations changing files, and in write mode while taking an image.
+	mu sync.RWMutex
+}
+
+var _ vfs.FS = (*CrashFS)(nil)
+
+// NewCrashFS returns a CrashFS wrapping fs.
+func NewCrashFS(fs vfs.FS) *CrashFS {
+	return &CrashFS{FS: fs}
+}
+
+// Crash takes a crash image of each directory, which is a key of images, into the directory it
+// maps to, which must not exist. The lock and lease files aren't copied, so that the images can
+// be opened right away.
+func (fs *CrashFS) Crash(images map[string]string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for dir, image := range images {
+		if err := fs.copyDir(dir, image); err != nil {
+			return errors.Wrapf(err, "while taking a crash image of %q", dir)
+		}
+	}
+	return nil
+}
+
+func (fs *CrashFS) copyDir(dir, image string) error {
+	if err := fs.FS.MkdirAll(image, 0700); err != nil {
+		return err
+	}
+	infos, err := fs.FS.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		src, dst := filepath.Join(dir, info.Name()), filepath.Join(image, info.Name())
+		switch {
+		case info.Name() == "LOCK" || info.Name() == "LEASE":
+		case info.IsDir():
+			err = fs.copyDir(src, dst)
+		default:
+			err = fs.copyFile(src, dst)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyBlockSize is the size of the blocks copied by copyFile.
+const copyBlockSize = 64 << 10
+
+// copyFile copies a file, skipping the blocks of zeros. The memory-mapped files of Badger are
+// preallocated, and usually sparse, so this keeps the copy sparse too.
+func (fs *CrashFS) copyFile(src, dst string) error {
+	in, err := fs.FS.OpenFile(src, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := fs.FS.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	zeros := make([]byte, copyBlockSize)
+	buf := make([]byte, copyBlockSize)
+	var size int64
+	for {
+		n, err := io.ReadFull(in, buf)
+		if n > 0 && !bytes.Equal(buf[:n], zeros[:n]) {
+			if _, err := out.Seek(size, io.SeekStart); err != nil {
+				out.Close()
+				return err
+			}
+			if _, err := out.Write(buf[:n]); err != nil {
+				out.Close()
+				return err
+			}
+		}
+		size += int64(n)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := out.Truncate(size); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// changes returns true if opening a file with flag can change it.
+func changes(flag int) bool {
+	return flag&(os.O_CREATE|os.O_TRUNC) != 0
+}
+
+// OpenFile implements vfs.FS.
+func (fs *CrashFS) OpenFile(name string, flag int, perm os.FileMode) (vfs.File, error) {
+	if changes(flag) {
+		fs.mu.RLock()
+		defer fs.mu.RUnlock()
+	}
+	f, err := fs.FS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &crashFile{File: f, fs: fs}, nil
+}
+
+// OpenMmapFile implements vfs.FS.
+func (fs *CrashFS) OpenMmapFile(name string, flag int, maxSz int) (*z.MmapFile, error) {
+	if changes(flag) {
+		fs.mu.RLock()
+		defer fs.mu.RUnlock()
+	}
+	return fs.FS.OpenMmapFile(name, flag, maxSz)
+}
+
+// Remove implements vfs.FS.
+func (fs *CrashFS) Remove(name string) error {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.FS.Remove(name)
+}
+
+// RemoveAll implements vfs.FS.
+func (fs *CrashFS) RemoveAll(path string) error {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.FS.RemoveAll(path)
+}
+
+// Rename implements vfs.FS.
+func (fs *CrashFS) Rename(oldpath, newpath string) error {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.FS.Rename(oldpath, newpath)
+}
+
+// MkdirAll implements vfs.FS.
+func (fs *CrashFS) MkdirAll(path string, perm os.FileMode) error {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.FS.MkdirAll(path, perm)
+}
+
+type crashFile struct {
+	vfs.File
+	fs *CrashFS
+}
+
+func (f *crashFile) Write(p []byte) (int, error) {
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	return f.File.Write(p)
+}
+
+func (f *crashFile) Truncate(size int64) error {
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	return f.File.Truncate(size)
+}
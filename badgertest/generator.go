@@ -0,0 +1,160 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package badgertest is a correctness harness for Badger, which embedders can run against their
+// own Options and hardware.
+//
+// A Generator produces random transactions, which Apply runs against a DB and a Model, a reference
+// map of what the DB must contain. Apply checks the reads of every transaction against the Model,
+// and Model.Check compares the whole DB to it. CrashFS takes images of the directories of a DB as
+// a crash of the process would leave them, so that the recovery of acknowledged writes can be
+// checked too. Run puts it all together.
+package badgertest
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// OpKind is the kind of an Op.
+type OpKind byte
+
+const (
+	// OpSet sets Key to Value.
+	OpSet OpKind = iota
+	// OpDelete deletes Key.
+	OpDelete
+	// OpGet reads Key.
+	OpGet
+	// OpScan reads the keys starting with Key.
+	OpScan
+	numOpKinds
+)
+
+func (k OpKind) String() string {
+	switch k {
+	case OpSet:
+		return "Set"
+	case OpDelete:
+		return "Delete"
+	case OpGet:
+		return "Get"
+	case OpScan:
+		return "Scan"
+	}
+	return fmt.Sprintf("OpKind(%d)", k)
+}
+
+// Op is a single operation of a transaction.
+type Op struct {
+	Kind  OpKind
+	Key   []byte
+	Value []byte
+}
+
+func (op Op) String() string {
+	if op.Kind == OpSet {
+		return fmt.Sprintf("%s(%q, %d bytes)", op.Kind, op.Key, len(op.Value))
+	}
+	return fmt.Sprintf("%s(%q)", op.Kind, op.Key)
+}
+
+// Config sets the shape of the generated operations.
+type Config struct {
+	// Keys is the number of distinct keys. A small key space makes the operations of different
+	// transactions hit the same keys more often.
+	Keys int
+	// MaxValueSize is the maximum size of a value. Values bigger than Options.ValueThreshold are
+	// stored in the value log.
+	MaxValueSize int
+	// MaxTxnOps is the maximum number of operations of a transaction.
+	MaxTxnOps int
+}
+
+// DefaultConfig is a Config mixing values stored in the LSM tree and in the value log with the
+// default Options.
+var DefaultConfig = Config{
+	Keys:         10000,
+	MaxValueSize: 4 << 10,
+	MaxTxnOps:    16,
+}
+
+// scanPrefixDigits is the number of digits of a key removed to make the prefix of a scan, which
+// then covers up to 10^scanPrefixDigits keys.
+const scanPrefixDigits = 2
+
+// Generator generates random operations. The operations are determined by the source of
+// randomness, so that a failure can be reproduced from the seed which produced it.
+type Generator struct {
+	cfg  Config
+	rand *rand.Rand
+}
+
+// NewGenerator returns a Generator of operations shaped by cfg, drawing from the source of
+// randomness src.
+func NewGenerator(cfg Config, src rand.Source) *Generator {
+	return &Generator{cfg: cfg, rand: rand.New(src)}
+}
+
+// Op returns a random operation. Sets are the most frequent operations, so that the DB grows.
+func (g *Generator) Op() Op {
+	key := []byte(fmt.Sprintf("key%08d", g.rand.Intn(g.cfg.Keys)))
+	switch n := g.rand.Intn(10); {
+	case n < 5:
+		value := make([]byte, g.rand.Intn(g.cfg.MaxValueSize+1))
+		g.rand.Read(value)
+		return Op{Kind: OpSet, Key: key, Value: value}
+	case n < 7:
+		return Op{Kind: OpDelete, Key: key}
+	case n < 9:
+		return Op{Kind: OpGet, Key: key}
+	default:
+		return Op{Kind: OpScan, Key: key[:len(key)-scanPrefixDigits]}
+	}
+}
+
+// Txn returns the operations of a random transaction.
+func (g *Generator) Txn() []Op {
+	ops := make([]Op, 1+g.rand.Intn(g.cfg.MaxTxnOps))
+	for i := range ops {
+		ops[i] = g.Op()
+	}
+	return ops
+}
+
+// DecodeOps decodes operations from arbitrary data, so that fuzzers can generate transactions.
+// Every 3 bytes hold the kind of an operation, its key and the size of its value, and any
+// remaining bytes are ignored. The keys are limited to 256 and the values to 256 bytes.
+func DecodeOps(data []byte) []Op {
+	var ops []Op
+	for ; len(data) >= 3; data = data[3:] {
+		op := Op{
+			Kind: OpKind(data[0] % byte(numOpKinds)),
+			Key:  []byte(fmt.Sprintf("key%08d", data[1])),
+		}
+		switch op.Kind {
+		case OpSet:
+			op.Value = make([]byte, data[2])
+			for i := range op.Value {
+				op.Value[i] = byte(i) ^ data[1]
+			}
+		case OpScan:
+			op.Key = op.Key[:len(op.Key)-scanPrefixDigits]
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badgertest
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// ErrMismatch is returned when the DB doesn't match the Model.
+var ErrMismatch = errors.New("DB doesn't match the model")
+
+// Model is a reference map of the keys which a DB must contain, and of their values.
+type Model struct {
+	kv map[string][]byte
+}
+
+// NewModel returns an empty Model.
+func NewModel() *Model {
+	return &Model{kv: make(map[string][]byte)}
+}
+
+// Len returns the number of keys of the Model.
+func (m *Model) Len() int {
+	return len(m.kv)
+}
+
+// Get returns the value of key, and whether the key exists.
+func (m *Model) Get(key []byte) ([]byte, bool) {
+	v, ok := m.kv[string(key)]
+	return v, ok
+}
+
+// scan returns the sorted keys of the Model starting with prefix, as seen by a transaction which
+// wrote pending. A nil value in pending is a deletion.
+func (m *Model) scan(prefix []byte, pending map[string][]byte) []string {
+	var keys []string
+	for k := range m.kv {
+		if _, ok := pending[k]; !ok && strings.HasPrefix(k, string(prefix)) {
+			keys = append(keys, k)
+		}
+	}
+	for k, v := range pending {
+		if v != nil && strings.HasPrefix(k, string(prefix)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// get returns the value of key as seen by a transaction which wrote pending.
+func (m *Model) get(key string, pending map[string][]byte) ([]byte, bool) {
+	if v, ok := pending[key]; ok {
+		return v, v != nil
+	}
+	v, ok := m.kv[key]
+	return v, ok
+}
+
+// Check compares the keys and values of db to the Model. It returns an error wrapping ErrMismatch
+// for the first difference.
+func (m *Model) Check(db *badger.DB) error {
+	return db.View(func(txn *badger.Txn) error {
+		return m.checkScan(txn, nil, nil)
+	})
+}
+
+// checkScan compares the keys starting with prefix in txn to the Model, as seen by a transaction
+// which wrote pending.
+func (m *Model) checkScan(txn *badger.Txn, prefix []byte, pending map[string][]byte) error {
+	want := m.scan(prefix, pending)
+	opt := badger.DefaultIteratorOptions
+	opt.Prefix = prefix
+	itr := txn.NewIterator(opt)
+	defer itr.Close()
+	i := 0
+	for itr.Rewind(); itr.Valid(); itr.Next() {
+		key := string(itr.Item().Key())
+		switch {
+		case i == len(want) || key < want[i]:
+			return errors.Wrapf(ErrMismatch, "key %q found, but it doesn't exist", key)
+		case key > want[i]:
+			return errors.Wrapf(ErrMismatch, "key %q not found", want[i])
+		}
+		value, err := itr.Item().ValueCopy(nil)
+		if err != nil {
+			return errors.Wrapf(err, "while reading key %q", key)
+		}
+		if v, _ := m.get(key, pending); !bytes.Equal(value, v) {
+			return errors.Wrapf(ErrMismatch, "key %q has a value of %d bytes instead of %d",
+				key, len(value), len(v))
+		}
+		i++
+	}
+	if i < len(want) {
+		return errors.Wrapf(ErrMismatch, "key %q not found", want[i])
+	}
+	return nil
+}
+
+// checkGet compares the value of key in txn to the Model, as seen by a transaction which wrote
+// pending.
+func (m *Model) checkGet(txn *badger.Txn, key []byte, pending map[string][]byte) error {
+	v, ok := m.get(string(key), pending)
+	item, err := txn.Get(key)
+	switch {
+	case err == badger.ErrKeyNotFound && ok:
+		return errors.Wrapf(ErrMismatch, "key %q not found", key)
+	case err == badger.ErrKeyNotFound:
+		return nil
+	case err != nil:
+		return errors.Wrapf(err, "while getting key %q", key)
+	case !ok:
+		return errors.Wrapf(ErrMismatch, "key %q found, but it doesn't exist", key)
+	}
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return errors.Wrapf(err, "while reading key %q", key)
+	}
+	if !bytes.Equal(value, v) {
+		return errors.Wrapf(ErrMismatch, "key %q has a value of %d bytes instead of %d", key,
+			len(value), len(v))
+	}
+	return nil
+}
+
+// Apply runs the operations in a transaction of db, checking the results of the reads against the
+// Model, and applies the writes to the Model once the transaction is committed. It returns an
+// error wrapping ErrMismatch if a read doesn't match the Model. db must not use managed
+// transactions, and must not be written to concurrently.
+func Apply(db *badger.DB, m *Model, ops []Op) error {
+	pending := make(map[string][]byte)
+	err := db.Update(func(txn *badger.Txn) error {
+		for _, op := range ops {
+			var err error
+			switch op.Kind {
+			case OpSet:
+				err = txn.Set(op.Key, op.Value)
+				// The value of a deleted key is nil, so nil values are set as empty ones.
+				pending[string(op.Key)] = append([]byte{}, op.Value...)
+			case OpDelete:
+				err = txn.Delete(op.Key)
+				pending[string(op.Key)] = nil
+			case OpGet:
+				err = m.checkGet(txn, op.Key, pending)
+			case OpScan:
+				err = m.checkScan(txn, op.Key, pending)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "%s", op)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for k, v := range pending {
+		if v == nil {
+			delete(m.kv, k)
+		} else {
+			m.kv[k] = v
+		}
+	}
+	return nil
+}
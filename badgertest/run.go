@@ -0,0 +1,130 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badgertest
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/vfs"
+	"github.com/pkg/errors"
+)
+
+// RunOptions sets what Run does.
+type RunOptions struct {
+	Config
+	// Seed is the seed of the random operations. A failure can be reproduced by running again
+	// with the same seed and Options.
+	Seed int64
+	// Txns is the number of transactions to run.
+	Txns int
+	// CrashEvery is the number of transactions between two crash images, or zero for none. The DB
+	// recovered from every crash image is compared to the Model.
+	CrashEvery int
+	// CheckEvery is the number of transactions between two comparisons of the whole DB to the
+	// Model, or zero for none.
+	CheckEvery int
+}
+
+// Run opens a DB with opt and runs random transactions on it, checking them against a Model.
+// Along the way, the DB recovered from crash images is compared to the Model. The DB is also
+// compared to the Model after being closed and opened again at the end.
+//
+// The DB must be empty, and must not use managed transactions. Crash images are taken in the
+// temporary directory, and skipped in InMemory mode.
+func Run(opt badger.Options, ro RunOptions) error {
+	if opt.FS == nil {
+		opt.FS = vfs.OS
+	}
+	fs := NewCrashFS(opt.FS)
+	opt.FS = fs
+	db, err := badger.Open(opt)
+	if err != nil {
+		return err
+	}
+	gen := NewGenerator(ro.Config, rand.NewSource(ro.Seed))
+	m := NewModel()
+	for i := 1; i <= ro.Txns; i++ {
+		if err = Apply(db, m, gen.Txn()); err != nil {
+			break
+		}
+		if ro.CheckEvery > 0 && i%ro.CheckEvery == 0 {
+			if err = m.Check(db); err != nil {
+				break
+			}
+		}
+		if ro.CrashEvery > 0 && i%ro.CrashEvery == 0 && !opt.InMemory {
+			if err = CheckCrash(fs, opt, m); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		_ = db.Close()
+		return errors.Wrapf(err, "with seed %d", ro.Seed)
+	}
+	if err := m.Check(db); err != nil {
+		_ = db.Close()
+		return errors.Wrapf(err, "with seed %d", ro.Seed)
+	}
+	if err := db.Close(); err != nil {
+		return err
+	}
+	if opt.InMemory {
+		return nil
+	}
+	return errors.Wrapf(openAndCheck(opt, m), "after restart, with seed %d", ro.Seed)
+}
+
+// CheckCrash takes a crash image of the DB opened with opt, whose FS is fs or wraps it, and
+// compares the DB recovered from the image to the Model. The image is taken in the temporary
+// directory, and deleted afterwards.
+func CheckCrash(fs *CrashFS, opt badger.Options, m *Model) error {
+	tmp, err := ioutil.TempDir("", "badgertest")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	images := map[string]string{opt.Dir: filepath.Join(tmp, "dir")}
+	if opt.ValueDir != opt.Dir {
+		images[opt.ValueDir] = filepath.Join(tmp, "vlog")
+	}
+	if err := fs.Crash(images); err != nil {
+		return err
+	}
+	opt.FS = fs.FS
+	opt.Dir = images[opt.Dir]
+	opt.ValueDir = images[opt.ValueDir]
+	return errors.Wrapf(openAndCheck(opt, m), "after crash")
+}
+
+// openAndCheck opens a DB and compares it to the Model.
+func openAndCheck(opt badger.Options, m *Model) error {
+	db, err := badger.Open(opt)
+	if err != nil {
+		return err
+	}
+	if err := m.Check(db); err != nil {
+		_ = db.Close()
+		return err
+	}
+	return db.Close()
+}
@@ -34,9 +34,12 @@ type WriteBatch struct {
 	throttle *y.Throttle
 	err      atomic.Value
 
-	isManaged bool
-	commitTs  uint64
-	finished  bool
+	isManaged  bool
+	commitTs   uint64
+	maxVersion uint64
+	finished   bool
+	sync       syncMode
+	opID       []byte // Recorded by the last commit, see SetOperationID.
 }
 
 // NewWriteBatch creates a new WriteBatch. This provides a way to conveniently do a lot of writes,
@@ -67,6 +70,15 @@ func (wb *WriteBatch) SetMaxPendingTxns(max int) {
 	wb.throttle = y.NewThrottle(max)
 }
 
+// SetSyncWrites overrides Options.SyncWrites for the writes of the WriteBatch. See
+// Txn.SetSyncWrites. This function should be called before using WriteBatch.
+func (wb *WriteBatch) SetSyncWrites(val bool) {
+	wb.Lock()
+	defer wb.Unlock()
+	wb.txn.SetSyncWrites(val)
+	wb.sync = wb.txn.sync
+}
+
 // Cancel function must be called if there's a chance that Flush might not get
 // called. If neither Flush or Cancel is called, the transaction oracle would
 // never get a chance to clear out the row commit timestamp map, thus causing an
@@ -209,8 +221,12 @@ func (wb *WriteBatch) commit() error {
 		return err
 	}
 	wb.txn.CommitWith(wb.callback)
+	if ts := wb.txn.CommitTs(); ts > wb.maxVersion {
+		wb.maxVersion = ts
+	}
 	wb.txn = wb.db.newTransaction(true, wb.isManaged)
 	wb.txn.commitTs = wb.commitTs
+	wb.txn.sync = wb.sync
 	return wb.Error()
 }
 
@@ -218,6 +234,9 @@ func (wb *WriteBatch) commit() error {
 // returns any error stored by WriteBatch.
 func (wb *WriteBatch) Flush() error {
 	wb.Lock()
+	if wb.opID != nil && !wb.finished {
+		wb.txn.SetOperationID(wb.opID)
+	}
 	err := wb.commit()
 	if err != nil {
 		wb.Unlock()
@@ -237,6 +256,14 @@ func (wb *WriteBatch) Flush() error {
 	return wb.Error()
 }
 
+// MaxVersion returns the highest version assigned to the writes committed so far. Once Flush
+// returns without an error, all the writes done via the WriteBatch are visible at this version.
+func (wb *WriteBatch) MaxVersion() uint64 {
+	wb.Lock()
+	defer wb.Unlock()
+	return wb.maxVersion
+}
+
 // Error returns any errors encountered so far. No commits would be run once an error is detected.
 func (wb *WriteBatch) Error() error {
 	// If the interface conversion fails, the err will be nil.
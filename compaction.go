@@ -27,6 +27,15 @@ import (
 	"github.com/dgraph-io/badger/v3/y"
 )
 
+// CompactionFilter is used to drop keys during compactions. See Options.WithCompactionFilter.
+type CompactionFilter interface {
+	// Drop is called with the key and the user meta of the latest version of a key, in key order.
+	// If it returns true, the key is deleted. It is only called for the keys whose latest version
+	// in the tables being compacted is below the discard timestamp, so that no newer version is
+	// kept. Newer versions in the levels above, which aren't part of the compaction, aren't seen.
+	Drop(key []byte, userMeta byte) bool
+}
+
 type keyRange struct {
 	left  []byte
 	right []byte
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"bytes"
+	"context"
+)
+
+// Condition is a check on the latest value of a key, used by DB.WriteIf. By default, a Condition
+// only requires the key to exist. Setting Version and Value makes it also check them.
+type Condition struct {
+	Key []byte
+	// Version, if non-zero, must be equal to the version of the latest value of Key.
+	Version uint64
+	// Value, if non-nil, must be equal to the latest value of Key.
+	Value []byte
+	// Missing requires Key to not exist. Version and Value are ignored when it is set.
+	Missing bool
+}
+
+// check evaluates the condition within the given transaction. Reading the key within the
+// transaction makes the commit fail with ErrConflict if the key gets modified concurrently.
+func (c Condition) check(txn *Txn) (bool, error) {
+	item, err := txn.Get(c.Key)
+	switch {
+	case err == ErrKeyNotFound:
+		return c.Missing, nil
+	case err != nil:
+		return false, err
+	case c.Missing:
+		return false, nil
+	}
+	if c.Version != 0 && item.Version() != c.Version {
+		return false, nil
+	}
+	if c.Value == nil {
+		return true, nil
+	}
+	var equal bool
+	err = item.Value(func(val []byte) error {
+		equal = bytes.Equal(val, c.Value)
+		return nil
+	})
+	return equal, err
+}
+
+// WriteIf atomically writes the given entries if all the conditions hold, and returns the version
+// at which they were written. It returns ErrConditionFailed if any of the conditions doesn't hold,
+// in which case nothing is written.
+//
+// The conditions are evaluated within a transaction, along with the writes. If any of the keys
+// in the conditions is modified concurrently, the conditions are evaluated again. This makes
+// WriteIf a lightweight compare-and-set over a handful of keys. WriteIf requires conflict
+// detection to be enabled, and can't be used in managed mode.
+func (db *DB) WriteIf(conds []Condition, entries []*Entry) (uint64, error) {
+	return db.retryWriteIf(context.Background(), conds, entries)
+}
+
+// CompareAndSet atomically sets key to val if its latest value is expected, with respect to the
+// other writers. A nil expected requires key to not exist, and a nil val deletes key. It returns
+// ErrConditionFailed if the value of key isn't the expected one, in which case nothing is written.
+// Concurrent writes to key make CompareAndSet check the value again, until ctx is done. This gives
+// optimistic concurrency on single keys without handling transactions. CompareAndSet requires
+// conflict detection to be enabled, and can't be used in managed mode. See WriteIf.
+func (db *DB) CompareAndSet(ctx context.Context, key, expected, val []byte) error {
+	cond := Condition{Key: key, Value: expected, Missing: expected == nil}
+	e := NewEntry(key, val)
+	if val == nil {
+		e.meta = bitDelete
+	}
+	_, err := db.retryWriteIf(ctx, []Condition{cond}, []*Entry{e})
+	return err
+}
+
+// retryWriteIf runs writeIf until it doesn't fail with ErrConflict, or ctx is done.
+func (db *DB) retryWriteIf(ctx context.Context, conds []Condition,
+	entries []*Entry) (uint64, error) {
+	if db.opt.managedTxns {
+		return 0, ErrManagedTxn
+	}
+	if !db.opt.DetectConflicts {
+		return 0, ErrConflictDetectionDisabled
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		version, err := db.writeIf(conds, entries)
+		if err != ErrConflict {
+			return version, err
+		}
+	}
+}
+
+func (db *DB) writeIf(conds []Condition, entries []*Entry) (uint64, error) {
+	if db.IsClosed() {
+		return 0, ErrDBClosed
+	}
+	txn := db.NewTransaction(true)
+	defer txn.Discard()
+
+	for _, c := range conds {
+		ok, err := c.check(txn)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, ErrConditionFailed
+		}
+	}
+	for _, e := range entries {
+		// The transaction takes ownership of the entry, so pass a copy to allow retries.
+		ec := *e
+		if err := txn.SetEntry(&ec); err != nil {
+			return 0, err
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		return 0, err
+	}
+	return txn.CommitTs(), nil
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteIf(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		a, b := []byte("a"), []byte("b")
+
+		writeIf := func(conds []Condition, entries ...*Entry) error {
+			_, err := db.WriteIf(conds, entries)
+			return err
+		}
+
+		// Insert a only if it doesn't exist.
+		version, err := db.WriteIf([]Condition{{Key: a, Missing: true}},
+			[]*Entry{NewEntry(a, []byte("1"))})
+		require.NoError(t, err)
+		require.Equal(t, ErrConditionFailed, writeIf([]Condition{{Key: a, Missing: true}},
+			NewEntry(a, []byte("2"))))
+
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get(a)
+			require.NoError(t, err)
+			require.Equal(t, version, item.Version())
+			return nil
+		}))
+
+		// A failed condition on any key prevents all the writes.
+		require.Equal(t, ErrConditionFailed, writeIf(
+			[]Condition{{Key: a, Version: version}, {Key: b}},
+			NewEntry(a, []byte("2")), NewEntry(b, []byte("2"))))
+		require.Equal(t, ErrConditionFailed, writeIf(
+			[]Condition{{Key: a, Value: []byte("2")}}, NewEntry(b, []byte("2"))))
+
+		require.NoError(t, writeIf(
+			[]Condition{{Key: a, Version: version, Value: []byte("1")}, {Key: b, Missing: true}},
+			NewEntry(a, []byte("2")), NewEntry(b, []byte("2"))))
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for _, key := range [][]byte{a, b} {
+				item, err := txn.Get(key)
+				require.NoError(t, err)
+				require.Equal(t, []byte("2"), getItemValue(t, item))
+			}
+			return nil
+		}))
+
+		// The version has changed.
+		require.Equal(t, ErrConditionFailed, writeIf(
+			[]Condition{{Key: a, Version: version}}, NewEntry(a, []byte("3"))))
+	})
+}
+
+func TestWriteIfConcurrentIncrement(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		key := []byte("counter")
+		txnSet(t, db, key, y.U64ToBytes(0), 0)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					for {
+						var cur []byte
+						require.NoError(t, db.View(func(txn *Txn) error {
+							item, err := txn.Get(key)
+							require.NoError(t, err)
+							cur, err = item.ValueCopy(nil)
+							return err
+						}))
+						next := y.U64ToBytes(y.BytesToU64(cur) + 1)
+						_, err := db.WriteIf([]Condition{{Key: key, Value: cur}},
+							[]*Entry{NewEntry(key, next)})
+						if err == ErrConditionFailed {
+							continue
+						}
+						require.NoError(t, err)
+						break
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get(key)
+			require.NoError(t, err)
+			require.Equal(t, uint64(100), y.BytesToU64(getItemValue(t, item)))
+			return nil
+		}))
+	})
+}
+
+func TestWriteIfManaged(t *testing.T) {
+	opt := getTestOptions("")
+	opt.managedTxns = true
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		_, err := db.WriteIf(nil, nil)
+		require.Equal(t, ErrManagedTxn, err)
+	})
+}
+
+func TestCompareAndSet(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		ctx := context.Background()
+		key := []byte("key")
+		get := func() []byte {
+			var val []byte
+			err := db.View(func(txn *Txn) error {
+				item, err := txn.Get(key)
+				if err != nil {
+					return err
+				}
+				val, err = item.ValueCopy(nil)
+				return err
+			})
+			if err == ErrKeyNotFound {
+				return nil
+			}
+			require.NoError(t, err)
+			return val
+		}
+
+		require.NoError(t, db.CompareAndSet(ctx, key, nil, []byte("1")))
+		require.Equal(t, ErrConditionFailed, db.CompareAndSet(ctx, key, nil, []byte("2")))
+		require.Equal(t, ErrConditionFailed, db.CompareAndSet(ctx, key, []byte("2"), []byte("3")))
+		require.Equal(t, []byte("1"), get())
+
+		require.NoError(t, db.CompareAndSet(ctx, key, []byte("1"), []byte("2")))
+		require.Equal(t, []byte("2"), get())
+		require.NoError(t, db.CompareAndSet(ctx, key, []byte("2"), nil))
+		require.Nil(t, get())
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		require.Equal(t, context.Canceled, db.CompareAndSet(canceled, key, nil, []byte("1")))
+		require.Nil(t, get())
+	})
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+// CountRequest describes the keys to be counted by Count.
+type CountRequest struct {
+	// Prefix restricts the count to the keys having this prefix. Tables whose key range doesn't
+	// overlap the prefix are not read.
+	Prefix []byte
+	// Since restricts the count to the keys whose latest version is greater than Since. Tables
+	// whose max version is not greater than Since are not read.
+	Since uint64
+	// Filter, if set, is called for every key matching Prefix and Since. Only the keys for which
+	// it returns true are counted. The item's value is not read unless Filter asks for it.
+	Filter func(item *Item) bool
+}
+
+// Count returns the number of keys visible to the transaction which match the request. Only the
+// keys are iterated over, so no value is read unless the request's Filter reads it.
+func (txn *Txn) Count(req CountRequest) (int, error) {
+	if txn.discarded {
+		return 0, ErrDiscardedTxn
+	}
+	opt := DefaultIteratorOptions
+	opt.PrefetchValues = false
+	opt.Prefix = req.Prefix
+	opt.SinceTs = req.Since
+	itr := txn.NewIterator(opt)
+	defer itr.Close()
+
+	var count int
+	for itr.Rewind(); itr.Valid(); itr.Next() {
+		if req.Filter != nil && !req.Filter(itr.Item()) {
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Count returns the number of keys matching the request. See Txn.Count for details.
+func (db *DB) Count(req CountRequest) (int, error) {
+	var count int
+	err := db.View(func(txn *Txn) error {
+		var err error
+		count, err = txn.Count(req)
+		return err
+	})
+	return count, err
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCount(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		count := func(req CountRequest) int {
+			n, err := db.Count(req)
+			require.NoError(t, err)
+			return n
+		}
+		require.Equal(t, 0, count(CountRequest{}))
+
+		for i := 0; i < 10; i++ {
+			txnSet(t, db, []byte(fmt.Sprintf("a/%02d", i)), []byte("val"), byte(i%2))
+			txnSet(t, db, []byte(fmt.Sprintf("b/%02d", i)), []byte("val"), 0)
+		}
+		since := db.MaxVersion()
+		for i := 0; i < 3; i++ {
+			txnSet(t, db, []byte(fmt.Sprintf("a/%02d", i)), []byte("val2"), byte(i%2))
+		}
+		txnDelete(t, db, []byte("b/00"))
+
+		require.Equal(t, 19, count(CountRequest{}))
+		require.Equal(t, 10, count(CountRequest{Prefix: []byte("a/")}))
+		require.Equal(t, 9, count(CountRequest{Prefix: []byte("b/")}))
+		require.Equal(t, 0, count(CountRequest{Prefix: []byte("c/")}))
+		require.Equal(t, 3, count(CountRequest{Since: since}))
+		require.Equal(t, 5, count(CountRequest{
+			Prefix: []byte("a/"),
+			Filter: func(item *Item) bool { return item.UserMeta() == 1 },
+		}))
+		require.Equal(t, 1, count(CountRequest{
+			Prefix: []byte("a/"),
+			Since:  since,
+			Filter: func(item *Item) bool { return item.UserMeta() == 1 },
+		}))
+	})
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3/vfs"
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/pkg/errors"
+)
+
+const (
+	// OptionsFilename is the filename for the file which holds the options the DB was created with.
+	OptionsFilename        = "OPTIONS"
+	optionsRewriteFilename = "OPTIONS-REWRITE"
+)
+
+// creationOption is an option recorded in the OPTIONS file when the DB is created.
+type creationOption struct {
+	name  string
+	value func(opt Options) string
+	// compatible tells if a DB created with the value created can be opened with the value
+	// opened. It is nil for the options which can be changed freely.
+	compatible func(created, opened string) bool
+}
+
+func equalOption(created, opened string) bool {
+	return created == opened
+}
+
+var creationOptions = []creationOption{
+	{
+		name:  "BaseTableSize",
+		value: func(opt Options) string { return strconv.FormatInt(opt.BaseTableSize, 10) },
+	},
+	{
+		name:  "BlockSize",
+		value: func(opt Options) string { return strconv.Itoa(opt.BlockSize) },
+	},
+	{
+		name:  "Compression",
+		value: func(opt Options) string { return strconv.Itoa(int(opt.Compression)) },
+	},
+	{
+		name:  "ValueLogFileSize",
+		value: func(opt Options) string { return strconv.FormatInt(opt.ValueLogFileSize, 10) },
+	},
+	{
+		// The levels of the tables are recorded in the manifest, so the DB can't lose levels.
+		name:  "MaxLevels",
+		value: func(opt Options) string { return strconv.Itoa(opt.MaxLevels) },
+		compatible: func(created, opened string) bool {
+			c, err := strconv.Atoi(created)
+			o, err2 := strconv.Atoi(opened)
+			return err == nil && err2 == nil && o >= c
+		},
+	},
+	{
+		// Every file records the data key it is encrypted with, if any, and the KEYREGISTRY file
+		// checks the encryption key, so a DB can start or stop being encrypted.
+		name:  "Encrypted",
+		value: func(opt Options) string { return strconv.FormatBool(len(opt.EncryptionKey) > 0) },
+	},
+	{
+		// The banned namespaces are read at NamespaceOffset.
+		name:       "NamespaceOffset",
+		value:      func(opt Options) string { return strconv.Itoa(opt.NamespaceOffset) },
+		compatible: equalOption,
+	},
+}
+
+// Format of the OPTIONS file, with a line per option, sorted by name:
+//
+//	BaseTableSize=2097152
+//	BlockSize=4096
+func encodeCreationOptions(opt Options) []byte {
+	lines := make([]string, 0, len(creationOptions))
+	for _, o := range creationOptions {
+		lines = append(lines, o.name+"="+o.value(opt)+"\n")
+	}
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, ""))
+}
+
+func decodeCreationOptions(buf []byte) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("%s file has bad line %q", OptionsFilename, line)
+		}
+		out[kv[0]] = kv[1]
+	}
+	return out, nil
+}
+
+// ReadCreationOptions reads the options the DB in dir was created with, by name. It returns false
+// if the DB doesn't have an OPTIONS file, which is the case for DBs created before the options were
+// recorded.
+func ReadCreationOptions(dir string) (map[string]string, bool, error) {
+	return readCreationOptions(vfs.OS, dir)
+}
+
+func readCreationOptions(fs vfs.FS, dir string) (map[string]string, bool, error) {
+	buf, err := vfs.ReadFile(fs, filepath.Join(dir, OptionsFilename))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, y.Wrapf(err, "while reading %s file", OptionsFilename)
+	}
+	created, err := decodeCreationOptions(buf)
+	return created, err == nil, err
+}
+
+// checkCreationOptions verifies that opt is compatible with the options the DB was created with,
+// and logs the options which differ. DBs without an OPTIONS file get one with opt.
+func checkCreationOptions(opt Options) error {
+	if opt.InMemory {
+		return nil
+	}
+	created, ok, err := readCreationOptions(opt.FS, opt.Dir)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if opt.ReadOnly {
+			return nil
+		}
+		return rewriteFile(opt.FS, opt.Dir, OptionsFilename, optionsRewriteFilename,
+			encodeCreationOptions(opt))
+	}
+	var diffs []string
+	for _, o := range creationOptions {
+		c, ok := created[o.name]
+		opened := o.value(opt)
+		if !ok || c == opened {
+			continue
+		}
+		if o.compatible != nil && !o.compatible(c, opened) {
+			diffs = append(diffs, fmt.Sprintf("%s: created with %s, opened with %s",
+				o.name, c, opened))
+			continue
+		}
+		opt.Infof("Opening DB with %s=%s, it was created with %s", o.name, opened, c)
+	}
+	if len(diffs) > 0 {
+		return errors.Wrapf(ErrIncompatibleOptions, "%s", strings.Join(diffs, "; "))
+	}
+	return nil
+}
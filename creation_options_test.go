@@ -0,0 +1,58 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreationOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opt := getTestOptions(dir).WithNamespaceOffset(3).WithMaxLevels(7)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	created, ok, err := ReadCreationOptions(dir)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "3", created["NamespaceOffset"])
+	require.Equal(t, "7", created["MaxLevels"])
+	require.Equal(t, "false", created["Encrypted"])
+
+	// Options which don't change how the files are read can be changed.
+	db, err = Open(opt.WithBlockSize(8 << 10).WithMaxLevels(8))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	_, err = Open(opt.WithNamespaceOffset(-1).WithMaxLevels(6))
+	require.Equal(t, ErrIncompatibleOptions, errors.Cause(err))
+	require.Contains(t, err.Error(), "MaxLevels: created with 7, opened with 6; "+
+		"NamespaceOffset: created with 3, opened with -1")
+
+	// The recorded options are those the DB was created with.
+	created, _, err = ReadCreationOptions(dir)
+	require.NoError(t, err)
+	require.Equal(t, "7", created["MaxLevels"])
+}
@@ -0,0 +1,377 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/dgraph-io/ristretto/z"
+	humanize "github.com/dustin/go-humanize"
+)
+
+const (
+	// maxEvents is the number of recent events kept for the dashboard.
+	maxEvents = 100
+	// maxSamples is the number of stats samples kept for the charts of the dashboard. They are
+	// taken every second.
+	maxSamples = 120
+	// maxDashboardTables is the number of tables listed by the dashboard.
+	maxDashboardTables = 1000
+)
+
+type event struct {
+	Time time.Time
+	Msg  string
+}
+
+// eventLog keeps the most recent events, such as flushes and compactions. A nil eventLog drops
+// the events, so that they are only recorded when the dashboard is enabled.
+type eventLog struct {
+	sync.Mutex
+	events []event
+	next   int
+}
+
+func (l *eventLog) add(format string, args ...interface{}) {
+	if l == nil {
+		return
+	}
+	e := event{Time: time.Now(), Msg: fmt.Sprintf(format, args...)}
+	l.Lock()
+	defer l.Unlock()
+	if len(l.events) < maxEvents {
+		l.events = append(l.events, e)
+		return
+	}
+	l.events[l.next] = e
+	l.next = (l.next + 1) % maxEvents
+}
+
+// recent returns the events, the newest first.
+func (l *eventLog) recent() []event {
+	l.Lock()
+	defer l.Unlock()
+	res := make([]event, 0, len(l.events))
+	for i := len(l.events) - 1; i >= 0; i-- {
+		res = append(res, l.events[(l.next+i)%len(l.events)])
+	}
+	return res
+}
+
+type statsSample struct {
+	time  time.Time
+	stats *Stats
+}
+
+// dashboard serves a web page showing the state of the DB at Options.HTTPAddr.
+type dashboard struct {
+	db     *DB
+	ln     net.Listener
+	srv    *http.Server
+	closer *z.Closer
+
+	sync.Mutex
+	samples []statsSample
+}
+
+// newDashboard listens on Options.HTTPAddr. The dashboard is only served once start is called.
+func newDashboard(db *DB) (*dashboard, error) {
+	ln, err := net.Listen("tcp", db.opt.HTTPAddr)
+	if err != nil {
+		return nil, y.Wrapf(err, "while listening on %s for the dashboard", db.opt.HTTPAddr)
+	}
+	d := &dashboard{db: db, ln: ln, closer: z.NewCloser(2)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", d.serveIndex)
+	d.srv = &http.Server{Handler: mux}
+	return d, nil
+}
+
+func (d *dashboard) start() {
+	go func() {
+		defer d.closer.Done()
+		if err := d.srv.Serve(d.ln); err != http.ErrServerClosed {
+			d.db.opt.Errorf("Dashboard stopped serving: %v", err)
+		}
+	}()
+	go d.sample()
+	d.db.opt.Infof("Serving the dashboard at http://%s", d.ln.Addr())
+}
+
+func (d *dashboard) sample() {
+	defer d.closer.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.closer.HasBeenClosed():
+			return
+		case now := <-ticker.C:
+			s := statsSample{time: now, stats: d.db.Stats()}
+			d.Lock()
+			if len(d.samples) == maxSamples {
+				d.samples = append(d.samples[:0], d.samples[1:]...)
+			}
+			d.samples = append(d.samples, s)
+			d.Unlock()
+		}
+	}
+}
+
+// close stops the dashboard. It can be called on a nil dashboard, and before start.
+func (d *dashboard) close() {
+	if d == nil {
+		return
+	}
+	_ = d.srv.Close()
+	_ = d.ln.Close()
+	d.closer.Signal()
+}
+
+// wait waits for the dashboard to stop after close.
+func (d *dashboard) wait() {
+	if d == nil {
+		return
+	}
+	d.closer.Wait()
+}
+
+type dashboardVlogFile struct {
+	Fid     uint32
+	Size    string
+	Discard string
+}
+
+type dashboardChart struct {
+	Title  string
+	Max    string
+	Points string
+}
+
+type dashboardData struct {
+	Dir       string
+	Time      time.Time
+	Stats     *Stats
+	Levels    []LevelInfo
+	Tables    []TableInfo
+	NumTables int
+	VlogFiles []dashboardVlogFile
+	Charts    []dashboardChart
+	Events    []event
+}
+
+func (d *dashboard) vlogFiles() []dashboardVlogFile {
+	vlog := &d.db.vlog
+	discard := make(map[uint32]uint64)
+	if vlog.discardStats != nil {
+		vlog.discardStats.Lock()
+		vlog.discardStats.Iterate(func(fid, stats uint64) {
+			discard[uint32(fid)] = stats
+		})
+		vlog.discardStats.Unlock()
+	}
+
+	var files []dashboardVlogFile
+	vlog.filesLock.RLock()
+	for fid, lf := range vlog.filesMap {
+		size := atomic.LoadUint32(&lf.size)
+		if fid == vlog.maxFid {
+			// The file being written to is preallocated.
+			size = vlog.woffset()
+		}
+		files = append(files, dashboardVlogFile{
+			Fid:     fid,
+			Size:    humanize.IBytes(uint64(size)),
+			Discard: humanize.IBytes(discard[fid]),
+		})
+	}
+	vlog.filesLock.RUnlock()
+	sort.Slice(files, func(i, j int) bool { return files[i].Fid < files[j].Fid })
+	return files
+}
+
+// charts returns the rates of the operations over the samples, as SVG polylines.
+func (d *dashboard) charts() []dashboardChart {
+	d.Lock()
+	samples := append([]statsSample{}, d.samples...)
+	d.Unlock()
+
+	type series struct {
+		title string
+		value func(s *Stats) uint64
+		unit  func(v float64) string
+	}
+	perSec := func(v float64) string { return fmt.Sprintf("%.1f/s", v) }
+	all := []series{
+		{"Gets", func(s *Stats) uint64 { return s.Gets.Count }, perSec},
+		{"Commits", func(s *Stats) uint64 { return s.Commits.Count }, perSec},
+		{"Writes", func(s *Stats) uint64 { return s.Writes }, perSec},
+		{"Compaction writes", func(s *Stats) uint64 { return s.CompactedBytes },
+			func(v float64) string { return humanize.IBytes(uint64(v)) + "/s" }},
+	}
+	var charts []dashboardChart
+	for _, ser := range all {
+		var rates []float64
+		max := 0.0
+		for i := 1; i < len(samples); i++ {
+			dur := samples[i].time.Sub(samples[i-1].time).Seconds()
+			rate := float64(ser.value(samples[i].stats)-ser.value(samples[i-1].stats)) / dur
+			rates = append(rates, rate)
+			if rate > max {
+				max = rate
+			}
+		}
+		// The chart is 400x100, with the newest sample on the right.
+		var points []string
+		for i, rate := range rates {
+			x := 400 - float64(len(rates)-1-i)*400/float64(maxSamples-2)
+			y := 100.0
+			if max > 0 {
+				y -= rate * 100 / max
+			}
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+		charts = append(charts, dashboardChart{
+			Title:  ser.title,
+			Max:    ser.unit(max),
+			Points: strings.Join(points, " "),
+		})
+	}
+	return charts
+}
+
+func (d *dashboard) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	data := dashboardData{
+		Dir:       d.db.opt.Dir,
+		Time:      time.Now(),
+		Stats:     d.db.Stats(),
+		Levels:    d.db.Levels(),
+		Tables:    d.db.Tables(),
+		VlogFiles: d.vlogFiles(),
+		Charts:    d.charts(),
+		Events:    d.db.events.recent(),
+	}
+	data.NumTables = len(data.Tables)
+	if len(data.Tables) > maxDashboardTables {
+		data.Tables = data.Tables[:maxDashboardTables]
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		d.db.opt.Warningf("While rendering the dashboard: %v", err)
+	}
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"bytes": func(sz interface{}) string {
+		switch sz := sz.(type) {
+		case int64:
+			return humanize.IBytes(uint64(sz))
+		case uint32:
+			return humanize.IBytes(uint64(sz))
+		case uint64:
+			return humanize.IBytes(sz)
+		}
+		return fmt.Sprint(sz)
+	},
+	"key": func(k []byte) string {
+		k = y.ParseKey(k)
+		if len(k) > 40 {
+			return fmt.Sprintf("%q...", k[:40])
+		}
+		return fmt.Sprintf("%q", k)
+	},
+	"pct": func(r float64) string { return fmt.Sprintf("%.1f%%", 100*r) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>Badger: {{.Dir}}</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: right; }
+td.key { text-align: left; font-family: monospace; }
+.chart { display: inline-block; margin-right: 2em; }
+svg { border: 1px solid #ccc; }
+</style>
+</head>
+<body>
+<h1>Badger: {{.Dir}}</h1>
+<p>{{.Time.Format "2006-01-02 15:04:05"}}. LSM: {{bytes .Stats.LSMSize}}, value log:
+{{bytes .Stats.VlogSize}}. Block cache hits: {{pct .Stats.BlockCacheHitRatio}}, index cache hits:
+{{pct .Stats.IndexCacheHitRatio}}. Compactions: {{.Stats.RunningCompactions}} running,
+{{.Stats.Compactions}} done.</p>
+
+<h2>Metrics</h2>
+{{range .Charts}}<div class="chart"><div>{{.Title}} (max {{.Max}})</div>
+<svg width="400" height="100"><polyline fill="none" stroke="steelblue" points="{{.Points}}"/></svg>
+</div>{{end}}
+<table>
+<tr><th>Latency</th><th>Count</th><th>p50</th><th>p90</th><th>p99</th><th>Max</th></tr>
+{{with .Stats.Gets}}<tr><td>Get</td><td>{{.Count}}</td>
+<td>{{.P50}}</td><td>{{.P90}}</td><td>{{.P99}}</td><td>{{.Max}}</td></tr>{{end}}
+{{with .Stats.Commits}}<tr><td>Commit</td><td>{{.Count}}</td>
+<td>{{.P50}}</td><td>{{.P90}}</td><td>{{.P99}}</td><td>{{.Max}}</td></tr>{{end}}
+</table>
+
+<h2>Levels</h2>
+<table>
+<tr><th>Level</th><th>Tables</th><th>Size</th><th>Target size</th><th>Stale data</th>
+<th>Score</th></tr>
+{{range .Levels}}<tr><td>{{.Level}}{{if .IsBaseLevel}} (base){{end}}</td>
+<td>{{.NumTables}}</td><td>{{bytes .Size}}</td><td>{{bytes .TargetSize}}</td>
+<td>{{bytes .StaleDatSize}}</td><td>{{printf "%.2f" .Score}}</td></tr>
+{{end}}</table>
+
+<h2>Tables ({{.NumTables}})</h2>
+<table>
+<tr><th>ID</th><th>Level</th><th>Smallest key</th><th>Biggest key</th><th>Keys</th><th>Size</th>
+<th>Stale data</th><th>Versions</th></tr>
+{{range .Tables}}<tr><td>{{.ID}}</td><td>{{.Level}}</td>
+<td class="key">{{key .Left}}</td><td class="key">{{key .Right}}</td>
+<td>{{.KeyCount}}</td><td>{{bytes .OnDiskSize}}</td><td>{{bytes .StaleDataSize}}</td>
+<td>{{.MinVersion}}-{{.MaxVersion}}</td></tr>
+{{end}}</table>
+
+<h2>Value log files</h2>
+<table>
+<tr><th>Fid</th><th>Size</th><th>Discardable</th></tr>
+{{range .VlogFiles}}<tr><td>{{.Fid}}</td><td>{{.Size}}</td><td>{{.Discard}}</td></tr>
+{{end}}</table>
+
+<h2>Recent events</h2>
+<table>
+{{range .Events}}<tr><td>{{.Time.Format "15:04:05.000"}}</td><td class="key">{{.Msg}}</td></tr>
+{{else}}<tr><td>No events yet.</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
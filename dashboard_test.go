@@ -0,0 +1,67 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLog(t *testing.T) {
+	var nilLog *eventLog
+	nilLog.add("dropped")
+
+	l := &eventLog{}
+	for i := 0; i < maxEvents+10; i++ {
+		l.add("event %d", i)
+	}
+	events := l.recent()
+	require.Len(t, events, maxEvents)
+	require.Equal(t, fmt.Sprintf("event %d", maxEvents+9), events[0].Msg)
+	require.Equal(t, "event 10", events[maxEvents-1].Msg)
+}
+
+func TestDashboard(t *testing.T) {
+	opt := getTestOptions("").WithHTTPAddr("localhost:0")
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		txnSet(t, db, []byte("key"), []byte("val"), 0)
+		createAndOpen(db, []keyValVersion{{"tablekey", "a", 1, 0}}, 0)
+		require.NoError(t, db.CompactRange(nil, nil))
+
+		resp, err := http.Get(fmt.Sprintf("http://%s/", db.dashboard.ln.Addr()))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		page := string(body)
+		require.Contains(t, page, "<h2>Levels</h2>")
+		require.Contains(t, page, "&#34;tablekey&#34;")
+		require.Contains(t, page, "Compacted L0 -&gt; L6")
+	})
+
+	// Open fails if the address is in use.
+	opt = getTestOptions("").WithHTTPAddr("localhost:0")
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		_, err := Open(getTestOptions("").WithHTTPAddr(db.dashboard.ln.Addr().String()))
+		require.Error(t, err)
+	})
+}
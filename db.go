@@ -35,6 +35,7 @@ import (
 	"github.com/dgraph-io/badger/v3/pb"
 	"github.com/dgraph-io/badger/v3/skl"
 	"github.com/dgraph-io/badger/v3/table"
+	"github.com/dgraph-io/badger/v3/vfs"
 	"github.com/dgraph-io/badger/v3/y"
 	"github.com/dgraph-io/ristretto"
 	"github.com/dgraph-io/ristretto/z"
@@ -57,9 +58,11 @@ type closers struct {
 	compactors  *z.Closer
 	memtable    *z.Closer
 	writes      *z.Closer
+	syncer      *z.Closer
 	valueGC     *z.Closer
 	pub         *z.Closer
 	cacheHealth *z.Closer
+	eviction    *z.Closer
 }
 
 type lockedKeys struct {
@@ -95,9 +98,9 @@ func (lk *lockedKeys) all() []uint64 {
 type DB struct {
 	lock sync.RWMutex // Guards list of inmemory tables, not individual reads and writes.
 
-	dirLockGuard *directoryLockGuard
+	dirLockGuard dirLock
 	// nil if Dir and ValueDir are the same
-	valueDirGuard *directoryLockGuard
+	valueDirGuard dirLock
 
 	closers closers
 
@@ -112,6 +115,7 @@ type DB struct {
 	lc        *levelsController
 	vlog      valueLog
 	writeCh   chan *request
+	syncCh    chan struct{}  // Signals the writes to sync. See syncWrites.
 	flushChan chan flushTask // For flushing memtables.
 	closeOnce sync.Once      // For closing DB only once.
 
@@ -121,12 +125,24 @@ type DB struct {
 	orc              *oracle
 	bannedNamespaces *lockedKeys
 	threshold        *vlogThreshold
+	evictTracker     *prefixTracker // nil if eviction is disabled.
+	opIDs            *operationIDs  // See Txn.SetOperationID.
 
 	pub        *publisher
+	stats      *dbStats
+	events     *eventLog  // nil if the dashboard is disabled.
+	dashboard  *dashboard // nil if the dashboard is disabled.
 	registry   *KeyRegistry
 	blockCache *ristretto.Cache
 	indexCache *ristretto.Cache
 	allocPool  *z.AllocatorPool
+
+	dicts    *y.ZSTDDicts
+	dictIDs  atomic.Value // map[string]uint32 of the dictionary IDs to use, by namespace.
+	dictLock sync.Mutex   // Serializes TrainDictionaries.
+
+	shadow      *shadow      // nil unless Options.ShadowVerify is set.
+	maintenance *maintenance // Tells when the heavy maintenance may run.
 }
 
 const (
@@ -144,6 +160,9 @@ func checkAndSetOptions(opt *Options) error {
 	if opt.InMemory && (opt.Dir != "" || opt.ValueDir != "") {
 		return errors.New("Cannot use badger in Disk-less mode with Dir or ValueDir set")
 	}
+	if opt.FS == nil {
+		opt.FS = vfs.OS
+	}
 	opt.maxBatchSize = (15 * opt.MemTableSize) / 100
 	opt.maxBatchCount = opt.maxBatchSize / int64(skl.MaxNodeSize)
 
@@ -152,6 +171,12 @@ func checkAndSetOptions(opt *Options) error {
 	if opt.VLogPercentile < 0.0 || opt.VLogPercentile > 1.0 {
 		return errors.New("vlogPercentile must be within range of 0.0-1.0")
 	}
+	for level, fp := range opt.BloomFalsePositiveLevels {
+		if fp < 0 || fp >= 1 {
+			return errors.Errorf("Invalid BloomFalsePositiveLevels, %v of level %d must be "+
+				"within range [0, 1)", fp, level)
+		}
+	}
 
 	// We are limiting opt.ValueThreshold to maxValueThreshold for now.
 	if opt.ValueThreshold > maxValueThreshold {
@@ -171,10 +196,38 @@ func checkAndSetOptions(opt *Options) error {
 	if !(opt.ValueLogFileSize < 2<<30 && opt.ValueLogFileSize >= 1<<20) {
 		return ErrValueLogSize
 	}
+	if err := checkAddressSpace(opt, addressSpaceBudget); err != nil {
+		return err
+	}
 
 	if opt.ReadOnly {
 		// Do not perform compaction in read only mode.
 		opt.CompactL0OnClose = false
+		// Nor evict any data.
+		opt.EvictionMaxSize = 0
+	}
+	for _, w := range opt.MaintenanceWindows {
+		if err := w.validate(); err != nil {
+			return err
+		}
+	}
+	if opt.EvictionMaxSize > 0 && opt.EvictionPrefixLen <= 0 {
+		return errors.Errorf("EvictionPrefixLen %d should be greater than zero when "+
+			"EvictionMaxSize is set", opt.EvictionPrefixLen)
+	}
+
+	if opt.KeyProvider != nil {
+		if len(opt.EncryptionKey) > 0 {
+			return errors.New("Cannot set both EncryptionKey and KeyProvider")
+		}
+		key, err := opt.KeyProvider.EncryptionKey(context.Background())
+		if err != nil {
+			return y.Wrapf(err, "while fetching the encryption key")
+		}
+		// Keep only the fetched key, so that the options returned by DB.Opts can be used to
+		// open the DB again.
+		opt.EncryptionKey = key
+		opt.KeyProvider = nil
 	}
 
 	needCache := (opt.Compression != options.None) || (len(opt.EncryptionKey) > 0)
@@ -189,7 +242,7 @@ func Open(opt Options) (*DB, error) {
 	if err := checkAndSetOptions(&opt); err != nil {
 		return nil, err
 	}
-	var dirLockGuard, valueDirLockGuard *directoryLockGuard
+	var dirLockGuard, valueDirLockGuard dirLock
 
 	// Create directories and acquire lock on it only if badger is not running in InMemory mode.
 	// We don't have any directories/files in InMemory mode so we don't need to acquire
@@ -200,7 +253,7 @@ func Open(opt Options) (*DB, error) {
 		}
 		var err error
 		if !opt.BypassLockGuard {
-			dirLockGuard, err = acquireDirectoryLock(opt.Dir, lockFile, opt.ReadOnly)
+			dirLockGuard, err = lockDir(opt.Dir, opt)
 			if err != nil {
 				return nil, err
 			}
@@ -218,7 +271,7 @@ func Open(opt Options) (*DB, error) {
 				return nil, err
 			}
 			if absValueDir != absDir {
-				valueDirLockGuard, err = acquireDirectoryLock(opt.ValueDir, lockFile, opt.ReadOnly)
+				valueDirLockGuard, err = lockDir(opt.ValueDir, opt)
 				if err != nil {
 					return nil, err
 				}
@@ -240,20 +293,40 @@ func Open(opt Options) (*DB, error) {
 			_ = manifestFile.close()
 		}
 	}()
+	if err := checkFormatVersion(opt); err != nil {
+		return nil, err
+	}
+	if err := checkCreationOptions(opt); err != nil {
+		return nil, err
+	}
+	snapshots, err := openSnapshots(opt)
+	if err != nil {
+		return nil, err
+	}
 
 	db := &DB{
 		imm:              make([]*memTable, 0, opt.NumMemtables),
-		flushChan:        make(chan flushTask, opt.NumMemtables),
-		writeCh:          make(chan *request, kvWriteChCapacity),
 		opt:              opt,
 		manifest:         manifestFile,
 		dirLockGuard:     dirLockGuard,
 		valueDirGuard:    valueDirLockGuard,
 		orc:              newOracle(opt),
 		pub:              newPublisher(),
+		stats:            &dbStats{},
 		allocPool:        z.NewAllocatorPool(8),
 		bannedNamespaces: &lockedKeys{keys: make(map[uint64]struct{})},
 		threshold:        initVlogThreshold(&opt),
+		dicts:            y.NewZSTDDicts(opt.ZSTDCompressionLevel),
+		shadow:           newShadow(opt.ShadowVerify),
+		maintenance:      newMaintenance(opt.MaintenanceWindows),
+		opIDs:            &operationIDs{max: opt.MaxOperationIDs},
+	}
+	db.orc.snapshots = snapshots
+	// A read-only DB only serves the read path. It doesn't need the write channel or the
+	// memtable flush queue, so we don't allocate them.
+	if !opt.ReadOnly {
+		db.flushChan = make(chan flushTask, opt.NumMemtables)
+		db.writeCh = make(chan *request, kvWriteChCapacity)
 	}
 	// Cleanup all the goroutines started by badger in case of an error.
 	defer func() {
@@ -263,6 +336,12 @@ func Open(opt Options) (*DB, error) {
 			db = nil
 		}
 	}()
+	if opt.HTTPAddr != "" {
+		db.events = &eventLog{}
+		if db.dashboard, err = newDashboard(db); err != nil {
+			return nil, err
+		}
+	}
 
 	if opt.BlockCacheSize > 0 {
 		numInCache := opt.BlockCacheSize / int64(opt.BlockSize)
@@ -321,6 +400,7 @@ func Open(opt Options) (*DB, error) {
 		EncryptionKey:                 opt.EncryptionKey,
 		EncryptionKeyRotationDuration: opt.EncryptionKeyRotationDuration,
 		InMemory:                      opt.InMemory,
+		FS:                            opt.FS,
 	}
 
 	if db.registry, err = OpenKeyRegistry(krOpt); err != nil {
@@ -330,6 +410,10 @@ func Open(opt Options) (*DB, error) {
 	db.closers.updateSize = z.NewCloser(1)
 	go db.updateSize(db.closers.updateSize)
 
+	if err := db.loadDicts(manifest.Dicts); err != nil {
+		return nil, y.Wrapf(err, "while loading zstd dictionaries")
+	}
+
 	if err := db.openMemTables(db.opt); err != nil {
 		return nil, y.Wrapf(err, "while opening memtables")
 	}
@@ -377,23 +461,51 @@ func Open(opt Options) (*DB, error) {
 	db.orc.readMark.Done(db.orc.nextTxnTs)
 	db.orc.incrementNextTs()
 
-	go db.threshold.listenForValueThresholdUpdate()
-
 	if err := db.initBannedNamespaces(); err != nil {
 		return db, errors.Wrapf(err, "While setting banned keys")
 	}
+	if err := db.initPreparedTxns(); err != nil {
+		return db, errors.Wrapf(err, "While loading prepared txns")
+	}
+	if err := db.initOperationIDs(); err != nil {
+		return db, errors.Wrapf(err, "While loading operation ids")
+	}
 
-	db.closers.writes = z.NewCloser(1)
-	go db.doWrites(db.closers.writes)
+	if db.opt.ReadOnly {
+		// Nothing can be written in read-only mode. Block the writes so that any attempt to
+		// write fails early, instead of waiting on a write channel that is never drained.
+		atomic.StoreInt32(&db.blockWrites, 1)
+	} else {
+		go db.threshold.listenForValueThresholdUpdate()
+
+		db.closers.writes = z.NewCloser(1)
+		go db.doWrites(db.closers.writes)
 
-	if !db.opt.InMemory {
-		db.closers.valueGC = z.NewCloser(1)
-		go db.vlog.waitOnGC(db.closers.valueGC)
+		if db.opt.SyncWrites && !db.opt.syncEachWrite() {
+			db.syncCh = make(chan struct{}, 1)
+			db.closers.syncer = z.NewCloser(1)
+			go db.syncWrites(db.closers.syncer)
+		}
+
+		if !db.opt.InMemory {
+			db.closers.valueGC = z.NewCloser(1)
+			go db.vlog.waitOnGC(db.closers.valueGC)
+		}
+	}
+
+	if db.opt.EvictionMaxSize > 0 {
+		db.evictTracker = newPrefixTracker(db.opt.EvictionPrefixLen)
+		db.closers.eviction = z.NewCloser(1)
+		go db.runEviction(db.closers.eviction)
 	}
 
 	db.closers.pub = z.NewCloser(1)
 	go db.pub.listenForUpdates(db.closers.pub)
 
+	if db.dashboard != nil {
+		db.dashboard.start()
+	}
+
 	valueDirLockGuard = nil
 	dirLockGuard = nil
 	manifestFile = nil
@@ -481,6 +593,7 @@ func (db *DB) monitorCache(c *z.Closer) {
 // cleanup stops all the goroutines started by badger. This is used in open to
 // cleanup goroutines in case of an error.
 func (db *DB) cleanup() {
+	db.dashboard.close()
 	db.stopMemoryFlush()
 	db.stopCompactions()
 
@@ -495,9 +608,15 @@ func (db *DB) cleanup() {
 	if db.closers.writes != nil {
 		db.closers.writes.Signal()
 	}
+	if db.closers.syncer != nil {
+		db.closers.syncer.Signal()
+	}
 	if db.closers.pub != nil {
 		db.closers.pub.Signal()
 	}
+	if db.closers.eviction != nil {
+		db.closers.eviction.Signal()
+	}
 
 	db.orc.Stop()
 
@@ -543,18 +662,32 @@ func (db *DB) close() (err error) {
 	db.opt.Debugf("Closing database")
 	db.opt.Infof("Lifetime L0 stalled for: %s\n", time.Duration(atomic.LoadInt64(&db.lc.l0stallsMs)))
 
+	if db.closers.eviction != nil {
+		// Stop eviction before blocking writes, since eviction blocks and resumes the writes.
+		db.closers.eviction.SignalAndWait()
+	}
+
+	db.dashboard.close()
+	db.dashboard.wait()
+
 	atomic.StoreInt32(&db.blockWrites, 1)
 
-	if !db.opt.InMemory {
+	if db.closers.valueGC != nil {
 		// Stop value GC first.
 		db.closers.valueGC.SignalAndWait()
 	}
 
-	// Stop writes next.
-	db.closers.writes.SignalAndWait()
+	if db.closers.writes != nil {
+		// Stop writes next.
+		db.closers.writes.SignalAndWait()
 
-	// Don't accept any more write.
-	close(db.writeCh)
+		// Don't accept any more write.
+		close(db.writeCh)
+	}
+	if db.closers.syncer != nil {
+		// Sync the last writes.
+		db.closers.syncer.SignalAndWait()
+	}
 
 	db.closers.pub.SignalAndWait()
 	db.closers.cacheHealth.Signal()
@@ -628,9 +761,12 @@ func (db *DB) close() (err error) {
 	db.orc.Stop()
 	db.blockCache.Close()
 	db.indexCache.Close()
+	db.dicts.Close()
 
 	atomic.StoreUint32(&db.isClosed, 1)
-	db.threshold.close()
+	if !db.opt.ReadOnly {
+		db.threshold.close()
+	}
 
 	if db.opt.InMemory {
 		return
@@ -669,6 +805,9 @@ func (db *DB) close() (err error) {
 // VerifyChecksum verifies checksum for all tables on all levels.
 // This method can be used to verify checksum, if opt.ChecksumVerificationMode is NoVerification.
 func (db *DB) VerifyChecksum() error {
+	if !db.maintenance.allowed() {
+		return ErrMaintenanceWindow
+	}
 	return db.lc.verifyChecksum()
 }
 
@@ -723,7 +862,23 @@ func (db *DB) getMemTables() ([]*memTable, func()) {
 // do that. For every get("fooX") call where X is the version, we will search
 // for "fooX" in all the levels of the LSM tree. This is expensive but it
 // removes the overhead of handling move keys completely.
+// get looks up key in the memtables and the LSM tree, retrying on transient I/O errors.
 func (db *DB) get(key []byte) (y.ValueStruct, error) {
+	return db.getWithOptions(key, ReadOptions{})
+}
+
+// getWithOptions is like get, but reads as told by ro.
+func (db *DB) getWithOptions(key []byte, ro ReadOptions) (y.ValueStruct, error) {
+	var vs y.ValueStruct
+	err := db.retryIO(func() error {
+		var err error
+		vs, err = db.lookup(key, ro)
+		return err
+	})
+	return vs, err
+}
+
+func (db *DB) lookup(key []byte, ro ReadOptions) (y.ValueStruct, error) {
 	if db.IsClosed() {
 		return y.ValueStruct{}, ErrDBClosed
 	}
@@ -737,6 +892,9 @@ func (db *DB) get(key []byte) (y.ValueStruct, error) {
 	for i := 0; i < len(tables); i++ {
 		vs := tables[i].sl.Get(key)
 		y.NumMemtableGetsAdd(db.opt.MetricsEnabled, 1)
+		if ro.Trace != nil {
+			ro.Trace.Memtables++
+		}
 		if vs.Meta == 0 && vs.Value == nil {
 			continue
 		}
@@ -748,7 +906,15 @@ func (db *DB) get(key []byte) (y.ValueStruct, error) {
 			maxVs = vs
 		}
 	}
-	return db.lc.get(key, maxVs, 0)
+	if ro.Tier == ReadMemtables {
+		// The memtables are newer than the LSM tree, so the latest version found in them is the
+		// one to read.
+		if maxVs.Version == 0 {
+			return y.ValueStruct{}, ErrNotCached
+		}
+		return maxVs, nil
+	}
+	return db.lc.get(key, maxVs, 0, ro)
 }
 
 var requestPool = sync.Pool{
@@ -757,24 +923,42 @@ var requestPool = sync.Pool{
 	},
 }
 
-func (db *DB) writeToLSM(b *request) error {
+// needsSync returns true if the writes of reqs must be synced before they are acknowledged.
+func (db *DB) needsSync(reqs []*request) bool {
+	for _, req := range reqs {
+		switch req.sync {
+		case syncAlways:
+			return true
+		case syncDefault:
+			if db.opt.syncEachWrite() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (db *DB) writeToLSM(b *request, sync bool) error {
 	db.lock.RLock()
 	defer db.lock.RUnlock()
 	for i, entry := range b.Entries {
 		var err error
 		if db.opt.managedTxns || entry.skipVlogAndSetThreshold(db.valueThreshold()) {
 			// Will include deletion / tombstone case.
-			err = db.mt.Put(entry.Key,
-				y.ValueStruct{
-					Value: entry.Value,
-					// Ensure value pointer flag is removed. Otherwise, the value will fail
-					// to be retrieved during iterator prefetch. `bitValuePointer` is only
-					// known to be set in write to LSM when the entry is loaded from a backup
-					// with lower ValueThreshold and its value was stored in the value log.
-					Meta:      entry.meta &^ bitValuePointer,
-					UserMeta:  entry.UserMeta,
-					ExpiresAt: entry.ExpiresAt,
-				})
+			vs := y.ValueStruct{
+				Value: entry.Value,
+				// Ensure value pointer flag is removed. Otherwise, the value will fail
+				// to be retrieved during iterator prefetch. `bitValuePointer` is only
+				// known to be set in write to LSM when the entry is loaded from a backup
+				// with lower ValueThreshold and its value was stored in the value log.
+				Meta:      entry.meta &^ bitValuePointer,
+				UserMeta:  entry.UserMeta,
+				ExpiresAt: entry.ExpiresAt,
+			}
+			if entry.delta != nil {
+				vs.Value, vs.Meta = entry.delta, vs.Meta|bitDelta
+			}
+			err = db.mt.Put(entry.Key, db.compressValue(entry.Key, vs))
 		} else {
 			// Write pointer to Memtable.
 			err = db.mt.Put(entry.Key,
@@ -789,7 +973,7 @@ func (db *DB) writeToLSM(b *request) error {
 			return y.Wrapf(err, "while writing to memTable")
 		}
 	}
-	if db.opt.SyncWrites {
+	if sync {
 		return db.mt.SyncWAL()
 	}
 	return nil
@@ -807,9 +991,11 @@ func (db *DB) writeRequests(reqs []*request) error {
 			r.Wg.Done()
 		}
 	}
+	db.encodeDeltas(reqs)
 	db.opt.Debugf("writeRequests called. Writing to value log")
 	err := db.vlog.write(reqs)
 	if err != nil {
+		err = diskFull(err)
 		done(err)
 		return err
 	}
@@ -818,6 +1004,7 @@ func (db *DB) writeRequests(reqs []*request) error {
 	db.pub.sendUpdates(reqs)
 	db.opt.Debugf("Writing to memtable")
 	var count int
+	sync := db.needsSync(reqs)
 	for _, b := range reqs {
 		if len(b.Entries) == 0 {
 			continue
@@ -836,20 +1023,83 @@ func (db *DB) writeRequests(reqs []*request) error {
 			time.Sleep(10 * time.Millisecond)
 		}
 		if err != nil {
+			err = diskFull(err)
 			done(err)
 			return y.Wrap(err, "writeRequests")
 		}
-		if err := db.writeToLSM(b); err != nil {
+		if err := db.writeToLSMShadowed(b, sync); err != nil {
+			err = diskFull(err)
 			done(err)
 			return y.Wrap(err, "writeRequests")
 		}
 	}
 	done(nil)
+	if !sync && db.syncCh != nil {
+		select {
+		case db.syncCh <- struct{}{}:
+		default:
+			// A sync is already pending, which covers these writes.
+		}
+	}
 	db.opt.Debugf("%d entries written", count)
 	return nil
 }
 
+// syncWrites syncs the writes which were acknowledged without being synced at most
+// Options.MaxSyncDelay after they are written. One sync covers all the write batches written in
+// the meantime.
+func (db *DB) syncWrites(lc *z.Closer) {
+	defer lc.Done()
+	timer := time.NewTimer(db.opt.MaxSyncDelay)
+	timer.Stop()
+	for {
+		select {
+		case <-db.syncCh:
+		case <-lc.HasBeenClosed():
+			select {
+			case <-db.syncCh:
+				// Sync the last writes before returning.
+			default:
+				return
+			}
+		}
+		timer.Reset(db.opt.MaxSyncDelay)
+		select {
+		case <-timer.C:
+		case <-lc.HasBeenClosed():
+			timer.Stop()
+		}
+		if err := db.syncWAL(); err != nil {
+			db.opt.Errorf("While syncing writes: %v", err)
+		}
+	}
+}
+
+// syncWAL syncs the value log and the write-ahead logs of the memtables.
+func (db *DB) syncWAL() error {
+	if err := db.vlog.sync(); err != nil {
+		return err
+	}
+	mts, decr := db.getMemTables()
+	defer decr()
+	for _, mt := range mts {
+		if err := mt.SyncWAL(); err != nil {
+			return y.Wrapf(err, "while syncing WAL %s", mt.wal.path)
+		}
+	}
+	return nil
+}
+
 func (db *DB) sendToWriteCh(entries []*Entry) (*request, error) {
+	return db.sendToWriteChWithSync(entries, syncDefault)
+}
+
+// sendToWriteChWithSync is like sendToWriteCh, with sync overriding Options.SyncWrites for the
+// entries.
+func (db *DB) sendToWriteChWithSync(entries []*Entry, sync syncMode) (*request, error) {
+	if db.opt.ReadOnly {
+		return nil, ErrReadOnlyDB
+	}
 	if atomic.LoadInt32(&db.blockWrites) == 1 {
 		return nil, ErrBlockedWrites
 	}
@@ -858,7 +1108,7 @@ func (db *DB) sendToWriteCh(entries []*Entry) (*request, error) {
 		size += e.estimateSizeAndSetThreshold(db.valueThreshold())
 		count++
 	}
-	if count >= db.opt.maxBatchCount || size >= db.opt.maxBatchSize {
+	if db.tooBig(count, size) {
 		return nil, ErrTxnTooBig
 	}
 
@@ -867,6 +1117,7 @@ func (db *DB) sendToWriteCh(entries []*Entry) (*request, error) {
 	req := requestPool.Get().(*request)
 	req.reset()
 	req.Entries = entries
+	req.sync = sync
 	req.Wg.Add(1)
 	req.IncrRef()     // for db write
 	db.writeCh <- req // Handled in doWrites.
@@ -974,7 +1225,6 @@ var errNoRoom = errors.New("No room for write")
 
 // ensureRoomForWrite is always called serially.
 func (db *DB) ensureRoomForWrite() error {
-	var err error
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -983,28 +1233,34 @@ func (db *DB) ensureRoomForWrite() error {
 		return nil
 	}
 
-	select {
-	case db.flushChan <- flushTask{mt: db.mt}:
-		db.opt.Debugf("Flushing memtable, mt.size=%d size of flushChan: %d\n",
-			db.mt.sl.MemSize(), len(db.flushChan))
-		// We manage to push this task. Let's modify imm.
-		db.imm = append(db.imm, db.mt)
-		db.mt, err = db.newMemTable()
-		if err != nil {
-			return y.Wrapf(err, "cannot create new mem table")
-		}
-		// New memtable is empty. We certainly have room.
-		return nil
-	default:
+	// The flush tasks are only pushed while holding db.lock, so the push below can't block.
+	if len(db.flushChan) == cap(db.flushChan) {
 		// We need to do this to unlock and allow the flusher to modify imm.
 		return errNoRoom
 	}
+	// Create the new memtable first, so that db.mt stays valid if it fails, e.g. because the
+	// disk is full.
+	mt, err := db.newMemTable()
+	if err != nil {
+		return y.Wrapf(err, "cannot create new mem table")
+	}
+	db.flushChan <- flushTask{mt: db.mt}
+	db.opt.Debugf("Flushing memtable, mt.size=%d size of flushChan: %d\n",
+		db.mt.sl.MemSize(), len(db.flushChan))
+	// We manage to push this task. Let's modify imm.
+	db.imm = append(db.imm, db.mt)
+	// New memtable is empty. We certainly have room.
+	db.mt = mt
+	return nil
 }
 
 func (db *DB) HandoverSkiplist(skl *skl.Skiplist, callback func()) error {
 	if !db.opt.managedTxns {
 		panic("Handover Skiplist is only available in managed mode.")
 	}
+	if db.opt.ReadOnly {
+		return ErrReadOnlyDB
+	}
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -1092,6 +1348,7 @@ func buildL0Table(ft flushTask, bopts table.Options) *table.Builder {
 
 type flushTask struct {
 	mt           *memTable
+	mts          []*memTable // The memtables merged by itr, if set.
 	cb           func()
 	itr          y.Iterator
 	dropPrefixes [][]byte
@@ -1101,8 +1358,10 @@ type flushTask struct {
 func (db *DB) handleFlushTask(ft flushTask) error {
 	// ft.mt could be nil with ft.itr being the valid field.
 	bopts := buildTableOptions(db)
+	bopts.BloomFalsePositive = db.opt.bloomFalsePositive(0)
 	builder := buildL0Table(ft, bopts)
 	defer builder.Close()
+	db.stats.addKeyStats(builder)
 
 	// buildL0Table can return nil if the none of the items in the skiplist are
 	// added to the builder. This can happen when drop prefix is set and all
@@ -1113,9 +1372,10 @@ func (db *DB) handleFlushTask(ft flushTask) error {
 	}
 
 	fileID := db.lc.reserveFileID()
+	keepWALs := db.opt.KeepL0InMemory && !db.opt.InMemory
 	var tbl *table.Table
 	var err error
-	if db.opt.InMemory {
+	if db.opt.InMemory || keepWALs {
 		data := builder.Finish()
 		tbl, err = table.OpenInMemoryTable(data, fileID, &bopts)
 	} else {
@@ -1124,9 +1384,32 @@ func (db *DB) handleFlushTask(ft flushTask) error {
 	if err != nil {
 		return y.Wrap(err, "error while creating table")
 	}
+	if keepWALs {
+		// The write-ahead logs of the memtables stand in for the table on disk.
+		mts := ft.mts
+		if len(mts) == 0 {
+			mts = []*memTable{ft.mt}
+		}
+		db.lc.keepWALs(tbl, mts)
+	} else {
+		// The table must be visible in the directory before the MANIFEST refers to it.
+		if err := db.syncDir(db.opt.Dir); err != nil {
+			_ = tbl.DecrRef()
+			return y.Wrap(err, "while syncing the directory of the table")
+		}
+		if err := db.uploadTables([]*table.Table{tbl}); err != nil {
+			_ = tbl.DecrRef()
+			return err
+		}
+	}
 	// We own a ref on tbl.
 	err = db.lc.addLevel0Table(tbl) // This will incrRef
-	_ = tbl.DecrRef()               // Releases our ref.
+	if err == nil {
+		db.events.add("Flushed a memtable into L0 table %d (%s)",
+			tbl.ID(), humanize.IBytes(uint64(tbl.Size())))
+		db.lc.checkLevelInvariants(db.lc.levels[0])
+	}
+	_ = tbl.DecrRef() // Releases our ref.
 	return err
 }
 
@@ -1147,7 +1430,6 @@ func (db *DB) flushMemtable(lc *z.Closer) error {
 					return
 				}
 				sl := more.mt.sl
-				itrs = append(itrs, sl.NewUniIterator(false))
 				mts = append(mts, more.mt)
 				cbs = append(cbs, more.cb)
 
@@ -1168,8 +1450,7 @@ func (db *DB) flushMemtable(lc *z.Closer) error {
 		}
 		sz = ft.mt.sl.MemSize()
 		// Reset of itrs, mts etc. is being done below.
-		y.AssertTrue(len(itrs) == 0 && len(mts) == 0 && len(cbs) == 0)
-		itrs = append(itrs, ft.mt.sl.NewUniIterator(false))
+		y.AssertTrue(len(mts) == 0 && len(cbs) == 0)
 		mts = append(mts, ft.mt)
 		cbs = append(cbs, ft.cb)
 
@@ -1178,10 +1459,19 @@ func (db *DB) flushMemtable(lc *z.Closer) error {
 
 		// db.opt.Infof("Picked %d memtables. Size: %d\n", len(itrs), sz)
 		ft.mt = nil
-		ft.itr = table.NewMergeIterator(itrs, false)
 		ft.cb = nil
 
 		for {
+			// handleFlushTask closes the iterator, so a new one is needed for every attempt.
+			// The merge iterator prefers the first iterator on equal keys, so the newer memtables
+			// must come first. A skiplist handed over with the same versions as the memtable
+			// before it, like the delete markers of DropPrefixNonBlocking, must win.
+			itrs = itrs[:0]
+			for i := len(mts) - 1; i >= 0; i-- {
+				itrs = append(itrs, mts[i].sl.NewUniIterator(false))
+			}
+			ft.itr = table.NewMergeIterator(itrs, false)
+			ft.mts = mts
 			err := db.handleFlushTask(ft)
 			if err == nil {
 				// Update s.imm. Need a lock.
@@ -1215,8 +1505,8 @@ func (db *DB) flushMemtable(lc *z.Closer) error {
 	return nil
 }
 
-func exists(path string) (bool, error) {
-	_, err := os.Stat(path)
+func exists(fs vfs.FS, path string) (bool, error) {
+	_, err := fs.Stat(path)
 	if err == nil {
 		return true, nil
 	}
@@ -1318,9 +1608,15 @@ func (db *DB) RunValueLogGC(discardRatio float64) error {
 	if db.opt.InMemory {
 		return ErrGCInMemoryMode
 	}
+	if db.opt.ReadOnly {
+		return ErrReadOnlyDB
+	}
 	if discardRatio >= 1.0 || discardRatio <= 0.0 {
 		return ErrInvalidRequest
 	}
+	if !db.maintenance.allowed() {
+		return ErrMaintenanceWindow
+	}
 
 	// Pick a log file and run GC
 	return db.vlog.runGC(discardRatio)
@@ -1462,11 +1758,77 @@ func (db *DB) Tables() []TableInfo {
 	return db.lc.getTableInfo()
 }
 
+// prefixVersions returns the lowest and the highest versions that the keys having the given prefix
+// might have. The memtables are looked up exactly, while for the tables the versions recorded in
+// their metadata are used. It returns false if there are no keys with the prefix.
+func (db *DB) prefixVersions(prefix []byte) (uint64, uint64, bool) {
+	var min, max uint64
+	found := false
+	update := func(lo, hi uint64) {
+		if !found || lo < min {
+			min = lo
+		}
+		if !found || hi > max {
+			max = hi
+		}
+		found = true
+	}
+
+	tables, decr := db.getMemTables()
+	for _, mt := range tables {
+		itr := mt.sl.NewIterator()
+		for itr.Seek(y.KeyWithTs(prefix, math.MaxUint64)); itr.Valid(); itr.Next() {
+			key := itr.Key()
+			if !bytes.HasPrefix(y.ParseKey(key), prefix) {
+				break
+			}
+			ts := y.ParseTs(key)
+			update(ts, ts)
+		}
+		y.Check(itr.Close())
+	}
+	decr()
+
+	opt := IteratorOptions{Prefix: prefix}
+	for _, ti := range db.Tables() {
+		if opt.compareToPrefix(ti.Left) > 0 || opt.compareToPrefix(ti.Right) < 0 {
+			continue
+		}
+		update(ti.MinVersion, ti.MaxVersion)
+	}
+	return min, max, found
+}
+
+// OldestVersion returns a lower bound on the versions of the keys having the given prefix,
+// including the deleted ones. Like NewestVersion, it doesn't iterate over the keys. It returns
+// zero if there are no keys with the prefix.
+func (db *DB) OldestVersion(prefix []byte) uint64 {
+	min, _, _ := db.prefixVersions(prefix)
+	return min
+}
+
+// NewestVersion returns an upper bound on the versions of the keys having the given prefix,
+// including the deleted ones. It is computed from the memtables and the metadata of the tables,
+// without iterating over the keys on disk, so it is cheap to call. If it is not greater than the
+// version seen in a previous run, nothing has been written under the prefix since. It returns zero
+// if there are no keys with the prefix.
+func (db *DB) NewestVersion(prefix []byte) uint64 {
+	_, max, _ := db.prefixVersions(prefix)
+	return max
+}
+
 // Levels gets the LevelInfo.
 func (db *DB) Levels() []LevelInfo {
 	return db.lc.getLevelInfo()
 }
 
+// PlanCompactions returns the compactions which would be picked next by the compactors, in the
+// order of their priority, along with their estimated I/O. The compactions are not run. This is
+// useful to tune the level sizes and to understand why writes are stalling.
+func (db *DB) PlanCompactions() []CompactionPlan {
+	return db.lc.planCompactions()
+}
+
 // EstimateSize can be used to get rough estimate of data size for a given prefix.
 func (db *DB) EstimateSize(prefix []byte) (uint64, uint64) {
 	var onDiskSize, uncompressedSize uint64
@@ -1713,6 +2075,64 @@ func (db *DB) Flatten(workers int) error {
 	}
 }
 
+// CompactRange compacts all the tables holding keys in the range [start, end) into the lowest level
+// of the LSM tree, so that deleted, expired and older versions of the keys in the range are
+// discarded. An empty end means that the range is unbounded. Like Flatten, it stops the live
+// compactions while running, and is meant to be used when no writes are going on, e.g. on an
+// offline directory. Keys still in the memtables are not compacted.
+func (db *DB) CompactRange(start, end []byte) error {
+	if db.opt.ReadOnly {
+		return ErrReadOnlyDB
+	}
+	db.stopCompactions()
+	defer db.startCompactions()
+
+	// The tables of the last level which hold keys in the range. The tables compacted into the
+	// last level from the levels above are rewritten anyway, so only these need to be rewritten
+	// in place at the end.
+	last := len(db.lc.levels) - 1
+	lastLevel := db.lc.levels[last]
+	inLast := make(map[uint64]struct{})
+	lastLevel.RLock()
+	for _, t := range lastLevel.tables {
+		if tableInRange(t, start, end) {
+			inLast[t.ID()] = struct{}{}
+		}
+	}
+	lastLevel.RUnlock()
+
+	for db.lc.firstTableInRange(0, start, end) != nil {
+		cp := compactionPriority{level: 0, score: 1.71}
+		if err := db.lc.doCompact(175, cp); err != nil {
+			return y.Wrapf(err, "while compacting level 0")
+		}
+	}
+	for l := 1; l < last; l++ {
+		for t := db.lc.firstTableInRange(l, start, end); t != nil; {
+			if err := db.lc.compactTableDown(175, l, t); err != nil {
+				return y.Wrapf(err, "while compacting level %d", l)
+			}
+			t = db.lc.firstTableInRange(l, start, end)
+		}
+	}
+
+	var rewrite []*table.Table
+	lastLevel.RLock()
+	for _, t := range lastLevel.tables {
+		if _, ok := inLast[t.ID()]; ok {
+			rewrite = append(rewrite, t)
+		}
+	}
+	lastLevel.RUnlock()
+	for _, t := range rewrite {
+		if err := db.lc.compactTableDown(175, last, t); err != nil {
+			return y.Wrapf(err, "while compacting level %d", last)
+		}
+	}
+	db.opt.Infof("Compacted the range [%q, %q).\n", start, end)
+	return nil
+}
+
 func (db *DB) blockWrite() error {
 	// Stop accepting new writes.
 	if !atomic.CompareAndSwapInt32(&db.blockWrites, 0, 1) {
@@ -1783,6 +2203,7 @@ func (db *DB) DropAll() error {
 
 func (db *DB) dropAll() (func(), error) {
 	db.opt.Infof("DropAll called. Blocking writes...")
+	db.events.add("Dropping all data")
 	f, err := db.prepareToDrop()
 	if err != nil {
 		return f, err
@@ -1821,6 +2242,7 @@ func (db *DB) dropAll() (func(), error) {
 		return resume, err
 	}
 	db.lc.nextFileID = 1
+	db.shadow.dropPrefixes()
 	db.opt.Infof("Deleted %d value log files. DropAll done.\n", num)
 	db.blockCache.Clear()
 	db.indexCache.Clear()
@@ -1843,6 +2265,8 @@ func (db *DB) DropPrefixNonBlocking(prefixes ...[]byte) error {
 		return nil
 	}
 	db.opt.Infof("Non-blocking DropPrefix called for %s", prefixes)
+	db.events.add("Dropping prefixes %q", prefixes)
+	db.shadow.dropPrefixes(prefixes...)
 
 	cbuf := z.NewBuffer(int(db.opt.MemTableSize), "DropPrefixNonBlocking")
 	defer cbuf.Release()
@@ -1944,6 +2368,46 @@ func (db *DB) DropPrefix(prefixes ...[]byte) error {
 	return db.DropPrefixNonBlocking(prefixes...)
 }
 
+// DropRange deletes all the keys in the range [start, end). An empty end means that the range
+// extends to the last key. Writes are not blocked while the range is being dropped.
+//
+// Unlike DropPrefix, which can drop whole tables when Options.AllowStopTheWorld is set, DropRange
+// deletes the keys one by one: it iterates over the range and writes a delete marker for every key
+// in it via a WriteBatch. Its cost is proportional to the number of keys in the range, and the DB
+// grows by one delete marker per key until compactions and value log GC reclaim the space used by
+// the deleted keys. To drop a large number of keys sharing a prefix, prefer DropPrefix.
+//
+// DropRange can't be used in managed mode. Use a managed WriteBatch with DeleteAt instead.
+func (db *DB) DropRange(start, end []byte) error {
+	if db.opt.managedTxns {
+		return errors.New("DropRange can't be used in managed mode. Use DeleteAt instead")
+	}
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := db.View(func(txn *Txn) error {
+		opt := DefaultIteratorOptions
+		opt.PrefetchValues = false
+		itr := txn.NewIterator(opt)
+		defer itr.Close()
+
+		for itr.Seek(start); itr.Valid(); itr.Next() {
+			item := itr.Item()
+			if len(end) > 0 && bytes.Compare(item.Key(), end) >= 0 {
+				break
+			}
+			if err := wb.Delete(item.KeyCopy(nil)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "while dropping range [%#x, %#x)", start, end)
+	}
+	return wb.Flush()
+}
+
 // DropPrefix would drop all the keys with the provided prefix. It does this in the following way:
 // - Stop accepting new writes.
 // - Stop memtable flushes before acquiring lock. Because we're acquring lock here
@@ -1960,11 +2424,13 @@ func (db *DB) DropPrefixBlocking(prefixes ...[]byte) error {
 		return nil
 	}
 	db.opt.Infof("DropPrefix called for %s", prefixes)
+	db.events.add("Dropping prefixes %q", prefixes)
 	f, err := db.prepareToDrop()
 	if err != nil {
 		return err
 	}
 	defer f()
+	db.shadow.dropPrefixes(prefixes...)
 
 	var filtered [][]byte
 	if filtered, err = db.filterPrefixesToDrop(prefixes); err != nil {
@@ -2141,15 +2607,15 @@ func (db *DB) shouldEncrypt() bool {
 }
 
 func (db *DB) syncDir(dir string) error {
-	if db.opt.InMemory {
+	if db.opt.InMemory || !db.opt.SyncDirs {
 		return nil
 	}
-	return syncDir(dir)
+	return db.opt.FS.SyncDir(dir)
 }
 
 func createDirs(opt Options) error {
 	for _, path := range []string{opt.Dir, opt.ValueDir} {
-		dirExists, err := exists(path)
+		dirExists, err := exists(opt.FS, path)
 		if err != nil {
 			return y.Wrapf(err, "Invalid Dir: %q", path)
 		}
@@ -2158,7 +2624,7 @@ func createDirs(opt Options) error {
 				return errors.Errorf("Cannot find directory %q for read-only open", path)
 			}
 			// Try to create the directory
-			err = os.MkdirAll(path, 0700)
+			err = opt.FS.MkdirAll(path, 0700)
 			if err != nil {
 				return y.Wrapf(err, "Error Creating Dir: %q", path)
 			}
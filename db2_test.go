@@ -1150,3 +1150,27 @@ func TestDropPrefixNonBlockingNoError(t *testing.T) {
 	require.NoError(t, db.DropPrefixNonBlocking(prefixes...))
 	closer2.SignalAndWait()
 }
+
+func TestDropRange(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		for i := 0; i < 100; i++ {
+			txnSet(t, db, []byte(fmt.Sprintf("key%03d", i)), []byte("val"), 0)
+		}
+		require.NoError(t, db.DropRange([]byte("key010"), []byte("key020")))
+		require.NoError(t, db.DropRange([]byte("key090"), nil))
+
+		var keys []string
+		require.NoError(t, db.View(func(txn *Txn) error {
+			itr := txn.NewIterator(DefaultIteratorOptions)
+			defer itr.Close()
+			for itr.Rewind(); itr.Valid(); itr.Next() {
+				keys = append(keys, string(itr.Item().Key()))
+			}
+			return nil
+		}))
+		require.Len(t, keys, 80)
+		require.Equal(t, "key009", keys[9])
+		require.Equal(t, "key020", keys[10])
+		require.Equal(t, "key089", keys[79])
+	})
+}
@@ -30,6 +30,7 @@ import (
 	"runtime"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -37,8 +38,11 @@ import (
 
 	"github.com/dgraph-io/badger/v3/options"
 	"github.com/dgraph-io/badger/v3/pb"
+	"github.com/dgraph-io/badger/v3/table"
+	"github.com/dgraph-io/badger/v3/vfs"
 	"github.com/dgraph-io/badger/v3/y"
 	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
 )
 
 // summary is produced when DB is closed. Currently it is used only for testing.
@@ -64,8 +68,6 @@ func (s *levelHandler) getSummary(sum *summary) {
 	}
 }
 
-func (s *DB) validate() error { return s.lc.validate() }
-
 func getTestOptions(dir string) Options {
 	opt := DefaultOptions(dir).
 		WithSyncWrites(false).
@@ -543,7 +545,7 @@ func TestGetMore(t *testing.T) {
 			}
 			require.NoError(t, txn.Commit())
 		}
-		require.NoError(t, db.validate())
+		require.NoError(t, db.Validate())
 
 		for i := 0; i < n; i++ {
 			txn := db.NewTransaction(false)
@@ -565,7 +567,7 @@ func TestGetMore(t *testing.T) {
 			}
 			require.NoError(t, txn.Commit())
 		}
-		require.NoError(t, db.validate())
+		require.NoError(t, db.Validate())
 
 		for i := 0; i < n; i++ {
 			expectedValue := fmt.Sprintf("zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz%9d", i)
@@ -610,7 +612,7 @@ func TestGetMore(t *testing.T) {
 			}
 			require.NoError(t, txn.Commit())
 		}
-		db.validate()
+		db.Validate()
 		for i := 0; i < n; i++ {
 			if (i % 10000) == 0 {
 				// Display some progress. Right now, it's not very fast with no caching.
@@ -643,7 +645,7 @@ func TestExistsMore(t *testing.T) {
 			}
 			require.NoError(t, txn.Commit())
 		}
-		db.validate()
+		db.Validate()
 
 		for i := 0; i < n; i++ {
 			if (i % 1000) == 0 {
@@ -673,7 +675,7 @@ func TestExistsMore(t *testing.T) {
 			}
 			require.NoError(t, txn.Commit())
 		}
-		db.validate()
+		db.Validate()
 		for i := 0; i < n; i++ {
 			if (i % 10000) == 0 {
 				// Display some progress. Right now, it's not very fast with no caching.
@@ -819,7 +821,7 @@ func TestLoad(t *testing.T) {
 		summary := kv.lc.getSummary()
 
 		// Check that files are garbage collected.
-		idMap := getIDMap(dir)
+		idMap := getIDMap(vfs.OS, dir)
 		for fileID := range idMap {
 			// Check that name is in summary.filenames.
 			require.True(t, summary.fileIDs[fileID], "%d", fileID)
@@ -2208,6 +2210,137 @@ func TestUpdateMaxCost(t *testing.T) {
 	require.Equal(t, int64(4<<20), cost)
 }
 
+func TestReadOnlyNoWriteMachinery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opts := getTestOptions(dir)
+	db, err := Open(opts)
+	require.NoError(t, err)
+	txnSet(t, db, []byte("foo"), []byte("bar"), 0x00)
+	require.NoError(t, db.Close())
+
+	db, err = Open(opts.WithReadOnly(true))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	require.Nil(t, db.mt)
+	require.Nil(t, db.writeCh)
+	require.Nil(t, db.flushChan)
+	require.Nil(t, db.closers.writes)
+	require.Nil(t, db.closers.compactors)
+	require.Nil(t, db.closers.memtable)
+	require.Nil(t, db.closers.valueGC)
+
+	require.NoError(t, db.View(func(txn *Txn) error {
+		item, err := txn.Get([]byte("foo"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("bar"), getItemValue(t, item))
+		return nil
+	}))
+
+	_, err = db.sendToWriteCh([]*Entry{NewEntry([]byte("foo"), []byte("baz"))})
+	require.Equal(t, ErrReadOnlyDB, err)
+	require.Equal(t, ErrReadOnlyDB, db.RunValueLogGC(0.5))
+}
+
+func TestReadOnlyLiveWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opts := getTestOptions(dir).WithValueThreshold(32)
+	db, err := Open(opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	txnSet(t, db, []byte("small"), []byte("v"), 0x00)
+	txnSet(t, db, []byte("big"), bytes.Repeat([]byte("v"), 64), 0x00)
+
+	// A table the writer has published but not yet added to the MANIFEST, and one it is writing.
+	b := table.NewTableBuilder(buildTableOptions(db))
+	b.Add(y.KeyWithTs([]byte("new"), 1), y.ValueStruct{Value: []byte("v")}, 0)
+	tab, err := table.CreateTable(table.NewFilename(db.lc.reserveFileID(), dir), b)
+	require.NoError(t, err)
+	b.Close()
+	defer func() { require.NoError(t, tab.DecrRef()) }()
+	tmp := table.NewFilename(db.lc.reserveFileID(), dir) + table.TempSuffix
+	require.NoError(t, ioutil.WriteFile(tmp, []byte("partial"), 0600))
+
+	files := func() map[string]int64 {
+		infos, err := ioutil.ReadDir(dir)
+		require.NoError(t, err)
+		sizes := make(map[string]int64)
+		for _, info := range infos {
+			sizes[info.Name()] = info.Size()
+		}
+		return sizes
+	}
+	before := files()
+
+	ro, err := Open(opts.WithReadOnly(true).WithBypassLockGuard(true))
+	if err == ErrWindowsNotSupported {
+		return
+	}
+	require.NoError(t, err)
+	require.NoError(t, ro.View(func(txn *Txn) error {
+		item, err := txn.Get([]byte("small"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("v"), getItemValue(t, item))
+		item, err = txn.Get([]byte("big"))
+		require.NoError(t, err)
+		require.Equal(t, bytes.Repeat([]byte("v"), 64), getItemValue(t, item))
+		return nil
+	}))
+	require.NoError(t, ro.Close())
+	// The read-only DB left the files of the writer alone.
+	require.Equal(t, before, files())
+
+	txnSet(t, db, []byte("after"), []byte("v"), 0x00)
+}
+
+func TestPrefixVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opts := getTestOptions(dir)
+	db, err := Open(opts)
+	require.NoError(t, err)
+
+	require.Zero(t, db.NewestVersion([]byte("a/")))
+	require.Zero(t, db.OldestVersion([]byte("a/")))
+
+	version := func(key string) uint64 {
+		txn := db.NewTransaction(true)
+		require.NoError(t, txn.Set([]byte(key), []byte("val")))
+		require.NoError(t, txn.Commit())
+		return txn.CommitTs()
+	}
+	a1 := version("a/1")
+	a2 := version("a/2")
+	b1 := version("b/1")
+
+	// The memtable is looked up exactly.
+	require.Equal(t, a1, db.OldestVersion([]byte("a/")))
+	require.Equal(t, a2, db.NewestVersion([]byte("a/")))
+	require.Equal(t, b1, db.NewestVersion([]byte("b/")))
+	require.Zero(t, db.NewestVersion([]byte("c/")))
+
+	// Reopen the DB so that the memtable gets flushed to a table.
+	require.NoError(t, db.Close())
+	db, err = Open(opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	require.LessOrEqual(t, db.OldestVersion([]byte("a/")), a1)
+	require.GreaterOrEqual(t, db.NewestVersion([]byte("a/")), a2)
+	require.Zero(t, db.NewestVersion([]byte("c/")))
+
+	b2 := version("b/2")
+	require.Equal(t, b2, db.NewestVersion([]byte("b/")))
+}
+
 func TestOpenDBReadOnly(t *testing.T) {
 	dir, err := ioutil.TempDir("", "badger-test")
 	require.NoError(t, err)
@@ -2369,7 +2502,7 @@ func TestBannedPrefixes(t *testing.T) {
 // in-memory list. Simulate the skipping in in-memory list as well.
 func TestIterateWithBanned(t *testing.T) {
 	opt := DefaultOptions("").WithNamespaceOffset(3)
-	opt.NumVersionsToKeep = math.MaxInt64
+	opt.NumVersionsToKeep = math.MaxInt32
 
 	// We store the uint64 namespace at idx=3, so first 3 bytes are insignificant to us.
 	initialBytes := make([]byte, opt.NamespaceOffset)
@@ -2509,3 +2642,178 @@ func TestBannedAtZeroOffset(t *testing.T) {
 		require.NoError(t, err)
 	})
 }
+
+// Regression test for flushes being retried with the iterator closed by the failed attempt.
+func TestFlushRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	var failed int32
+	opt := getTestOptions(dir)
+	opt.FS = &vfs.FaultFS{FS: vfs.OS, Inject: func(op, path string) error {
+		if op == "OpenMmapFile" && filepath.Ext(path) == ".sst" &&
+			atomic.AddInt32(&failed, 1) <= 2 {
+			return errors.New("injected failure")
+		}
+		return nil
+	}}
+	db, err := Open(opt)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		txnSet(t, db, []byte(fmt.Sprintf("key%03d", i)), []byte("value"), 0)
+	}
+	// Close flushes the memtable, which fails twice.
+	require.NoError(t, db.Close())
+	require.Equal(t, int32(3), atomic.LoadInt32(&failed))
+
+	db, err = Open(getTestOptions(dir))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.View(func(txn *Txn) error {
+		for i := 0; i < 100; i++ {
+			if _, err := txn.Get([]byte(fmt.Sprintf("key%03d", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	require.Len(t, db.Tables(), 1)
+}
+
+// Regression test for the DB being left without a memtable when creating one fails.
+func TestMemtableCreationFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	var full int32
+	opt := getTestOptions(dir).WithMemTableSize(1 << 20).WithValueThreshold(1 << 10)
+	opt.FS = &vfs.FaultFS{FS: vfs.OS, Inject: func(op, path string) error {
+		if op == "OpenMmapFile" && filepath.Ext(path) == memFileExt &&
+			atomic.LoadInt32(&full) == 1 {
+			return errors.New("injected failure")
+		}
+		return nil
+	}}
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer db.Close()
+
+	atomic.StoreInt32(&full, 1)
+	val := make([]byte, 1<<10)
+	var i int
+	for ; ; i++ {
+		err := db.Update(func(txn *Txn) error {
+			return txn.Set([]byte(fmt.Sprintf("key%05d", i)), val)
+		})
+		if err != nil {
+			break
+		}
+	}
+	// The DB is still readable, and writable once memtables can be created again.
+	_, err = db.NewTransaction(false).Get([]byte("key00000"))
+	require.NoError(t, err)
+	atomic.StoreInt32(&full, 0)
+	txnSet(t, db, []byte(fmt.Sprintf("key%05d", i)), val, 0)
+}
+
+func TestMaxSyncDelay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opt := getTestOptions(dir).WithSyncWrites(true).WithMaxSyncDelay(time.Hour).
+		WithValueThreshold(1 << 10)
+	db, err := Open(opt)
+	require.NoError(t, err)
+
+	// The writes are acknowledged before they are synced.
+	val := make([]byte, 2<<10)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				txnSet(t, db, []byte(fmt.Sprintf("key%d-%d", i, j)), val, 0)
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.Len(t, db.syncCh, 1)
+
+	// The pending sync is done on close.
+	require.NoError(t, db.Close())
+	require.Len(t, db.syncCh, 0)
+
+	db, err = Open(opt.WithMaxSyncDelay(10 * time.Millisecond))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	require.NoError(t, db.View(func(txn *Txn) error {
+		for i := 0; i < 10; i++ {
+			for j := 0; j < 20; j++ {
+				item, err := txn.Get([]byte(fmt.Sprintf("key%d-%d", i, j)))
+				require.NoError(t, err)
+				require.Equal(t, val, getItemValue(t, item))
+			}
+		}
+		return nil
+	}))
+	txnSet(t, db, []byte("key"), val, 0)
+	require.Eventually(t, func() bool { return len(db.syncCh) == 0 }, time.Second,
+		time.Millisecond)
+}
+
+func TestKeepL0InMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	countFiles := func(ext string) int {
+		matches, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+		require.NoError(t, err)
+		return len(matches)
+	}
+	check := func(db *DB) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for i := 0; i < 100; i++ {
+				item, err := txn.Get([]byte(fmt.Sprintf("key%03d", i)))
+				require.NoError(t, err)
+				require.Equal(t, []byte(fmt.Sprintf("val%03d", i)), getItemValue(t, item))
+			}
+			return nil
+		}))
+	}
+
+	opt := getTestOptions(dir).WithKeepL0InMemory(true).WithNumCompactors(0)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		txnSet(t, db, []byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("val%03d", i)), 0)
+	}
+	// The memtable is flushed into an in-memory L0 table on close, and its log is kept instead.
+	require.NoError(t, db.Close())
+	require.Zero(t, countFiles(".sst"))
+	require.NotZero(t, countFiles(memFileExt))
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	check(db)
+	mems := countFiles(memFileExt)
+	require.Eventually(t, func() bool { return db.lc.levels[0].numTables() > 0 }, time.Second,
+		time.Millisecond)
+	require.True(t, db.lc.levels[0].tables[0].IsInmemory)
+
+	// Once the table is compacted, it is on disk and its log is deleted.
+	require.NoError(t, db.lc.doCompact(-1, compactionPriority{level: 0, t: db.lc.levelTargets()}))
+	require.NotZero(t, countFiles(".sst"))
+	require.Less(t, countFiles(memFileExt), mems)
+	check(db)
+	require.NoError(t, db.Close())
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	check(db)
+	require.NoError(t, db.Close())
+}
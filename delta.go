@@ -0,0 +1,299 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/pkg/errors"
+)
+
+const (
+	// deltaMinValueSize is the size below which the values aren't worth delta encoding.
+	deltaMinValueSize = 256
+	// deltaBlockSize is the size of the blocks of the previous version indexed to find the
+	// matches of a value.
+	deltaBlockSize = 16
+)
+
+// A delta encoded version of a key is stored inline in the LSM tree, without compression, as
+// +-----------------------+-------------------+---------------------------+-----+
+// | base version (uvarint)| depth (uvarint)   | value length (uvarint)    | ops |
+// +-----------------------+-------------------+---------------------------+-----+
+// with bitDelta set in its meta. The base version is the previous version of the key, which may
+// be delta encoded itself, and depth is the length of the chain of delta encoded versions ending
+// with this one. The ops rebuild the value from the value of the base version:
+//   - deltaCopy, offset (uvarint), length (uvarint): copies a range of the base value.
+//   - deltaInsert, length (uvarint), bytes: inserts new bytes.
+//
+// Compactions keep the base versions of the delta encoded versions they keep. The versions which
+// expire or discard the earlier ones are never used as bases, since a compaction of a lower level
+// may drop them while their deltas are in an upper level.
+const (
+	deltaCopy   byte = 0
+	deltaInsert byte = 1
+)
+
+// encodeDelta returns the delta encoding of val against base, the value of baseVersion.
+func encodeDelta(baseVersion uint64, depth int, base, val []byte) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	out := make([]byte, 0, 64)
+	putUvarint := func(x uint64) {
+		out = append(out, buf[:binary.PutUvarint(buf[:], x)]...)
+	}
+	putUvarint(baseVersion)
+	putUvarint(uint64(depth))
+	putUvarint(uint64(len(val)))
+
+	blockHash := func(b []byte) uint64 {
+		return binary.LittleEndian.Uint64(b)*0x9E3779B97F4A7C15 ^ binary.LittleEndian.Uint64(b[8:])
+	}
+	index := make(map[uint64]int, len(base)/deltaBlockSize)
+	for off := 0; off+deltaBlockSize <= len(base); off += deltaBlockSize {
+		if _, ok := index[blockHash(base[off:])]; !ok {
+			index[blockHash(base[off:])] = off
+		}
+	}
+	insert := func(b []byte) {
+		if len(b) > 0 {
+			out = append(out, deltaInsert)
+			putUvarint(uint64(len(b)))
+			out = append(out, b...)
+		}
+	}
+
+	lit := 0
+	for i := 0; i+deltaBlockSize <= len(val); {
+		off, ok := index[blockHash(val[i:])]
+		if !ok || !bytes.Equal(base[off:off+deltaBlockSize], val[i:i+deltaBlockSize]) {
+			i++
+			continue
+		}
+		// Extend the match backwards over the pending bytes, and forwards.
+		start, baseStart := i, off
+		for start > lit && baseStart > 0 && val[start-1] == base[baseStart-1] {
+			start--
+			baseStart--
+		}
+		end, baseEnd := i+deltaBlockSize, off+deltaBlockSize
+		for end < len(val) && baseEnd < len(base) && val[end] == base[baseEnd] {
+			end++
+			baseEnd++
+		}
+		insert(val[lit:start])
+		out = append(out, deltaCopy)
+		putUvarint(uint64(baseStart))
+		putUvarint(uint64(end - start))
+		i, lit = end, end
+	}
+	insert(val[lit:])
+	return out
+}
+
+// decodeDeltaHeader returns the base version, the depth and the value length of a delta encoded
+// version, and its ops.
+func decodeDeltaHeader(delta []byte) (uint64, int, int, []byte, error) {
+	var fields [3]uint64
+	for i := range fields {
+		x, n := binary.Uvarint(delta)
+		if n <= 0 {
+			return 0, 0, 0, nil, errors.New("invalid header of delta encoded value")
+		}
+		fields[i] = x
+		delta = delta[n:]
+	}
+	return fields[0], int(fields[1]), int(fields[2]), delta, nil
+}
+
+// applyDelta rebuilds a value of the given size from the value of its base version and the ops
+// of its delta encoding.
+func applyDelta(base, ops []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for len(ops) > 0 {
+		op := ops[0]
+		ops = ops[1:]
+		x, n := binary.Uvarint(ops)
+		if n <= 0 {
+			return nil, errors.New("invalid op of delta encoded value")
+		}
+		ops = ops[n:]
+		switch op {
+		case deltaCopy:
+			l, n := binary.Uvarint(ops)
+			if n <= 0 || x+l > uint64(len(base)) {
+				return nil, errors.Errorf("invalid copy of delta encoded value: [%d, +%d) of %d",
+					x, l, len(base))
+			}
+			ops = ops[n:]
+			out = append(out, base[x:x+l]...)
+		case deltaInsert:
+			if x > uint64(len(ops)) {
+				return nil, errors.New("invalid insert of delta encoded value")
+			}
+			out = append(out, ops[:x]...)
+			ops = ops[x:]
+		default:
+			return nil, errors.Errorf("unknown op of delta encoded value: %d", op)
+		}
+	}
+	if len(out) != size {
+		return nil, errors.Errorf("delta encoded value has %d bytes, expected %d", len(out), size)
+	}
+	return out, nil
+}
+
+// deltaBase returns the base version of a delta encoded version, or 0 if vs isn't one.
+func deltaBase(vs y.ValueStruct) uint64 {
+	if vs.Meta&bitDelta == 0 || vs.Meta&bitValuePointer > 0 {
+		return 0
+	}
+	base, _, _, _, err := decodeDeltaHeader(vs.Value)
+	if err != nil {
+		return 0
+	}
+	return base
+}
+
+// deltaValueSize returns the size of the value of a delta encoded version.
+func deltaValueSize(delta []byte) int {
+	_, _, size, _, err := decodeDeltaHeader(delta)
+	if err != nil {
+		return len(delta)
+	}
+	return size
+}
+
+// encodeDeltas delta encodes the values written by the transactions of reqs against the previous
+// versions of their keys, if Options.MaxDeltaChain allows it and the delta is small enough. The
+// deltas are set in Entry.delta, to be stored instead of the values in the LSM tree. It is called
+// by the write goroutine, before the requests are written, so the previous version of a key is
+// either in the LSM tree or an earlier entry of reqs.
+func (db *DB) encodeDeltas(reqs []*request) {
+	if db.opt.MaxDeltaChain <= 0 {
+		return
+	}
+	latest := make(map[string]deltaVersion)
+	// The transaction only serves to read the values of the previous versions. It has no read
+	// timestamp to release, so it isn't discarded.
+	txn := db.newTransaction(false, true)
+	for _, req := range reqs {
+		for _, e := range req.Entries {
+			key, ts := y.ParseKey(e.Key), y.ParseTs(e.Key)
+			// The values of GC rewrites and loads may be stored values, or value pointers.
+			var value []byte
+			const stored = bitCompressed | bitDelta | bitValuePointer
+			if e.meta&(bitDelete|bitFinTxn|bitMergeEntry|stored) == 0 {
+				value = e.Value
+			}
+			// A compaction of a lower level may drop an expiring version, or the versions below a
+			// discard marker, while the newer versions are in an upper level. Such a version
+			// can't be a base, and a version discarding the earlier ones can't have one.
+			discard := e.meta&BitDiscardEarlierVersions > 0
+			base := value
+			if e.ExpiresAt > 0 || discard {
+				base = nil
+			}
+			// Only the transactions are delta encoded, which leaves out GC rewrites and loads.
+			if e.meta&bitTxn == 0 || value == nil || len(value) < deltaMinValueSize || discard {
+				latest[string(key)] = deltaVersion{version: ts, value: base}
+				continue
+			}
+			prev, ok := latest[string(key)]
+			if !ok {
+				prev = db.previousVersion(txn, key, ts)
+			}
+			latest[string(key)] = deltaVersion{version: ts, value: base}
+			if prev.value == nil || prev.version >= ts || prev.depth >= db.opt.MaxDeltaChain {
+				continue
+			}
+			delta := encodeDelta(prev.version, prev.depth+1, prev.value, e.Value)
+			if len(delta) > len(e.Value)/2 || int64(len(delta)) >= e.valThreshold {
+				continue
+			}
+			e.delta = delta
+			latest[string(key)] = deltaVersion{version: ts, value: base, depth: prev.depth + 1}
+		}
+	}
+}
+
+// deltaVersion is a candidate base version of a delta encoded version.
+type deltaVersion struct {
+	version uint64
+	value   []byte // nil if the version can't be a base.
+	depth   int
+}
+
+// previousVersion returns the latest version of key before ts in the LSM tree, or a version with
+// a nil value if there is none usable as a base.
+func (db *DB) previousVersion(txn *Txn, key []byte, ts uint64) (v deltaVersion) {
+	vs, err := db.get(y.KeyWithTs(key, ts-1))
+	if err != nil || vs.Version == 0 || vs.ExpiresAt > 0 || isDeletedOrExpired(vs.Meta, 0) ||
+		vs.Meta&(bitMergeEntry|BitDiscardEarlierVersions) > 0 {
+		return v
+	}
+	if vs.Meta&bitDelta > 0 {
+		if _, v.depth, _, _, err = decodeDeltaHeader(vs.Value); err != nil {
+			return v
+		}
+	}
+	if v.value, err = db.versionValue(txn, key, vs); err != nil {
+		db.opt.Warningf("Not delta encoding key %q: %v", key, err)
+		v.value = nil
+	}
+	v.version = vs.Version
+	return v
+}
+
+// versionValue returns a copy of the value of the version vs of key, read like an Item of txn
+// would.
+func (db *DB) versionValue(txn *Txn, key []byte, vs y.ValueStruct) ([]byte, error) {
+	item := &Item{
+		key:     key,
+		version: vs.Version,
+		meta:    vs.Meta,
+		vptr:    y.SafeCopy(nil, vs.Value),
+		txn:     txn,
+	}
+	val, cb, err := item.yieldItemValue()
+	defer runCallback(cb)
+	if err != nil {
+		return nil, err
+	}
+	return y.SafeCopy(nil, val), nil
+}
+
+// undelta rebuilds the value of a delta encoded version of key from the value of its base version.
+func (db *DB) undelta(txn *Txn, key, delta []byte) ([]byte, error) {
+	baseVersion, _, size, ops, err := decodeDeltaHeader(delta)
+	if err != nil {
+		return nil, err
+	}
+	vs, err := db.get(y.KeyWithTs(key, baseVersion))
+	if err != nil {
+		return nil, err
+	}
+	if vs.Version != baseVersion {
+		return nil, errors.Errorf("base version %d of delta encoded value not found", baseVersion)
+	}
+	base, err := db.versionValue(txn, key, vs)
+	if err != nil {
+		return nil, y.Wrapf(err, "while reading base version %d", baseVersion)
+	}
+	return applyDelta(base, ops, size)
+}
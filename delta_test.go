@@ -0,0 +1,236 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaEncoding(t *testing.T) {
+	base := make([]byte, 4<<10)
+	rand.Read(base)
+	edit := func(val []byte) []byte {
+		out := append([]byte{}, val[:100]...)
+		out = append(out, "inserted"...)
+		out = append(out, val[100:2000]...)
+		out = append(out, val[2100:]...)
+		return append(out, "appended"...)
+	}
+
+	for _, val := range [][]byte{edit(base), base, {}, []byte("short"), base[1000:]} {
+		delta := encodeDelta(7, 2, base, val)
+		baseVersion, depth, size, ops, err := decodeDeltaHeader(delta)
+		require.NoError(t, err)
+		require.Equal(t, uint64(7), baseVersion)
+		require.Equal(t, 2, depth)
+		require.Equal(t, len(val), size)
+		require.Equal(t, len(val), deltaValueSize(delta))
+		got, err := applyDelta(base, ops, size)
+		require.NoError(t, err)
+		require.Equal(t, val, got)
+	}
+	require.Less(t, len(encodeDelta(7, 1, base, edit(base))), 64)
+
+	// Corrupted deltas are rejected.
+	_, _, size, ops, err := decodeDeltaHeader(encodeDelta(7, 1, base, edit(base)))
+	require.NoError(t, err)
+	_, err = applyDelta(base[:1000], ops, size)
+	require.Error(t, err)
+	_, err = applyDelta(base, ops, size+1)
+	require.Error(t, err)
+	_, err = applyDelta(base, []byte{9, 1}, 1)
+	require.Error(t, err)
+}
+
+func TestMaxDeltaChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+	opt := getTestOptions(dir).WithValueThreshold(1 << 10).WithMaxDeltaChain(3)
+	db, err := Open(opt)
+	require.NoError(t, err)
+
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%02d", i)) }
+	vals := make(map[string][][]byte)
+	for i := 0; i < 20; i++ {
+		v := make([]byte, 4<<10)
+		rand.Read(v)
+		for j := 0; j < 10; j++ {
+			v = append([]byte{}, v...)
+			copy(v[j*100:], fmt.Sprintf("version %d", j))
+			txnSet(t, db, key(i), v, 0)
+			vals[string(key(i))] = append(vals[string(key(i))], v)
+		}
+	}
+	// Some versions are written by the same transaction.
+	txn := db.NewTransaction(true)
+	v := append([]byte{}, vals[string(key(0))][9]...)
+	copy(v, "same txn")
+	require.NoError(t, txn.Set(key(0), v))
+	require.NoError(t, txn.Set(key(1), v))
+	require.NoError(t, txn.Commit())
+	vals[string(key(0))] = append(vals[string(key(0))], v)
+	vals[string(key(1))] = append(vals[string(key(1))], v)
+
+	check := func(t *testing.T, deltas bool) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for i := 0; i < 20; i++ {
+				want := vals[string(key(i))]
+				item, err := txn.Get(key(i))
+				require.NoError(t, err)
+				require.Equal(t, want[len(want)-1], getItemValue(t, item))
+				require.Equal(t, int64(len(want[len(want)-1])), item.ValueSize())
+				if deltas && i > 1 {
+					// Every 4th version is stored as a full value, the others as deltas.
+					require.Equal(t, bitDelta, item.meta&bitDelta)
+					require.Less(t, len(item.vptr), 64)
+				}
+			}
+
+			opt := DefaultIteratorOptions
+			opt.AllVersions = true
+			it := txn.NewIterator(opt)
+			defer it.Close()
+			n := make(map[string]int)
+			for it.Rewind(); it.Valid(); it.Next() {
+				item := it.Item()
+				want := vals[string(item.Key())]
+				n[string(item.Key())]++
+				require.Equal(t, want[len(want)-n[string(item.Key())]], getItemValue(t, item))
+				if item.meta&bitDelta > 0 {
+					_, depth, _, _, err := decodeDeltaHeader(item.vptr)
+					require.NoError(t, err)
+					require.LessOrEqual(t, depth, 3)
+				}
+			}
+			return nil
+		}))
+	}
+	check(t, true)
+
+	// Only the latest version is kept by the compactions, with the versions it is based on.
+	require.NoError(t, db.Close())
+	db, err = Open(opt)
+	require.NoError(t, err)
+	require.NotZero(t, db.lc.levels[0].numTables())
+	require.NoError(t, db.lc.doCompact(-1, compactionPriority{level: 0, t: db.lc.levelTargets()}))
+	for i := 0; i < 20; i++ {
+		want := vals[string(key(i))]
+		vals[string(key(i))] = want[len(want)-(len(want)-1)%4-1:]
+	}
+	// The last version of key01 isn't a delta, as it has nothing in common with the previous one.
+	vals[string(key(1))] = vals[string(key(1))][2:]
+	check(t, false)
+
+	var buf bytes.Buffer
+	_, err = db.Backup(&buf, 0)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	dir2, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir2)
+	db, err = Open(getTestOptions(dir2))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	require.NoError(t, db.Load(&buf, 16))
+	check(t, false)
+}
+
+func TestDeltaBaseInLowerLevel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+	db, err := Open(getTestOptions(dir).WithValueThreshold(1 << 10).WithMaxDeltaChain(3))
+	require.NoError(t, err)
+
+	base := make([]byte, 500)
+	rand.Read(base)
+	val := append(append([]byte{}, base...), "new"...)
+	for _, key := range []string{"plain", "ttl", "discard"} {
+		e := NewEntry([]byte(key), base)
+		if key == "ttl" {
+			e = e.WithTTL(time.Hour)
+		}
+		require.NoError(t, db.Update(func(txn *Txn) error { return txn.SetEntry(e) }))
+		e = NewEntry([]byte(key), val)
+		if key == "discard" {
+			e = e.WithDiscard()
+		}
+		require.NoError(t, db.Update(func(txn *Txn) error { return txn.SetEntry(e) }))
+	}
+
+	// Only the versions of plain are delta encoded: an expiring version can't be a base, and a
+	// version discarding the earlier ones can't have one.
+	versions := make(map[string][]y.ValueStruct)
+	require.NoError(t, db.View(func(txn *Txn) error {
+		opt := DefaultIteratorOptions
+		opt.AllVersions = true
+		it := txn.NewIterator(opt)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			require.Equal(t, item.Version() == 2 && string(item.Key()) == "plain",
+				item.meta&bitDelta > 0, "key %q version %d", item.Key(), item.Version())
+			versions[string(item.Key())] = append(versions[string(item.Key())], y.ValueStruct{
+				Meta:      item.meta,
+				UserMeta:  item.userMeta,
+				ExpiresAt: item.expiresAt,
+				Value:     y.SafeCopy(nil, item.vptr),
+				Version:   item.Version(),
+			})
+		}
+		return nil
+	}))
+	require.NoError(t, db.Close())
+
+	// Once the older version of ttl has expired, compacting the lower level holding it drops it,
+	// while its newer version in an upper level can still be read.
+	opt := DefaultOptions("").WithNumCompactors(0)
+	opt.managedTxns = true
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		newer, older := versions["ttl"][0], versions["ttl"][1]
+		older.ExpiresAt = uint64(time.Now().Add(-time.Minute).Unix())
+		addTableAt(t, db, 5, []byte("ttl"), older.Version, older)
+		addTableAt(t, db, 1, []byte("ttl"), newer.Version, newer)
+		db.SetDiscardTs(newer.Version)
+		require.NoError(t, db.lc.doCompact(-1, compactionPriority{level: 5, t: db.lc.levelTargets()}))
+
+		require.NoError(t, db.View(func(txn *Txn) error {
+			opt := DefaultIteratorOptions
+			opt.AllVersions = true
+			it := txn.NewIterator(opt)
+			defer it.Close()
+			var n int
+			for it.Rewind(); it.Valid(); it.Next() {
+				require.Equal(t, newer.Version, it.Item().Version())
+				require.Equal(t, val, getItemValue(t, it.Item()))
+				n++
+			}
+			require.Equal(t, 1, n)
+			return nil
+		}))
+	})
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3/options"
+	"github.com/dgraph-io/badger/v3/pb"
+	"github.com/dgraph-io/badger/v3/y"
+)
+
+const (
+	// dictMaxSamples is the number of values sampled per namespace to train a dictionary.
+	dictMaxSamples = 10000
+	// dictMaxSampleSize is the size of the largest values sampled. Dictionaries help the small
+	// values, the large ones compress well on their own.
+	dictMaxSampleSize = 16 << 10
+)
+
+// TrainDictionaries trains zstd dictionaries of at most dictSize bytes over a sample of the values
+// of the DB, stores them in the MANIFEST, and uses them to compress the values and the table
+// blocks written afterwards with zstd. Small values with a common structure, like JSON documents,
+// compress several times better with a dictionary. A few KB are enough for dictSize.
+//
+// A dictionary is trained on the values of all namespaces, and used for the table blocks and the
+// values outside any namespace. If Options.NamespaceOffset is set, a dictionary is also trained
+// per namespace, and used for its values. The dictionaries of a previous call are superseded, but
+// kept to read the data compressed with them, so the DB should be retrained only when its data
+// changes shape.
+//
+// It returns ErrNoZSTD unless Options.Compression or Options.ValueCompression is options.ZSTD.
+func (db *DB) TrainDictionaries(dictSize int) error {
+	if db.opt.ReadOnly {
+		return ErrReadOnlyDB
+	}
+	if db.opt.Compression != options.ZSTD && db.opt.ValueCompression != options.ZSTD {
+		return ErrNoZSTD
+	}
+	db.dictLock.Lock()
+	defer db.dictLock.Unlock()
+
+	samples, err := db.sampleValues()
+	if err != nil {
+		return y.Wrapf(err, "while sampling values")
+	}
+	if _, ok := samples[""]; !ok {
+		samples[""] = nil // Report that there are too few samples.
+	}
+	namespaces := make([]string, 0, len(samples))
+	for ns := range samples {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	var nextID uint32
+	for _, id := range db.loadDictIDs() {
+		if id > nextID {
+			nextID = id
+		}
+	}
+	var changes []*pb.ManifestChange
+	for _, ns := range namespaces {
+		nextID++
+		dict, err := y.TrainZSTDDict(nextID, samples[ns], dictSize)
+		if err != nil {
+			if ns == "" {
+				return y.Wrapf(err, "while training the dictionary of all namespaces")
+			}
+			db.opt.Warningf("Not training a dictionary for namespace %x: %v", ns, err)
+			nextID--
+			continue
+		}
+		var namespace []byte
+		if ns != "" {
+			namespace = []byte(ns)
+		}
+		changes = append(changes, newCreateDictChange(nextID, namespace, dict))
+	}
+	if err := db.manifest.addChanges(changes); err != nil {
+		return y.Wrapf(err, "while adding the dictionaries to the MANIFEST")
+	}
+
+	ids := make(map[string]uint32)
+	for ns, id := range db.loadDictIDs() {
+		ids[ns] = id
+	}
+	for _, change := range changes {
+		if err := db.dicts.Add(change.Dict); err != nil {
+			return err
+		}
+		ids[string(change.Namespace)] = uint32(change.Id)
+		db.opt.Infof("Trained zstd dictionary %d of %d bytes for namespace %x", change.Id,
+			len(change.Dict), change.Namespace)
+	}
+	db.dictIDs.Store(ids)
+	return nil
+}
+
+// loadDicts adds the dictionaries of the MANIFEST to db.dicts, and uses the latest one of every
+// namespace.
+func (db *DB) loadDicts(dicts map[uint32]DictManifest) error {
+	ids := make(map[string]uint32)
+	for id, dm := range dicts {
+		if err := db.dicts.Add(dm.Dict); err != nil {
+			return err
+		}
+		if ns := string(dm.Namespace); id > ids[ns] {
+			ids[ns] = id
+		}
+	}
+	db.dictIDs.Store(ids)
+	return nil
+}
+
+func (db *DB) loadDictIDs() map[string]uint32 {
+	ids, _ := db.dictIDs.Load().(map[string]uint32)
+	return ids
+}
+
+// dictID returns the ID of the dictionary to compress the value of a user key with, or the one
+// of the table blocks if key is nil. It returns 0 if there is none.
+func (db *DB) dictID(key []byte) uint32 {
+	ids := db.loadDictIDs()
+	if ns := db.namespace(key); ns != nil {
+		if id, ok := ids[string(ns)]; ok {
+			return id
+		}
+	}
+	return ids[""]
+}
+
+// namespace returns the namespace of a user key, or nil if it has none.
+func (db *DB) namespace(key []byte) []byte {
+	if db.opt.NamespaceOffset < 0 || len(key) <= db.opt.NamespaceOffset+8 {
+		return nil
+	}
+	return key[db.opt.NamespaceOffset : db.opt.NamespaceOffset+8]
+}
+
+// sampleValues returns a uniform sample of the values of the latest versions of the keys, by
+// namespace, with the sample of all namespaces under "".
+func (db *DB) sampleValues() (map[string][][]byte, error) {
+	var txn *Txn
+	if db.opt.managedTxns {
+		txn = db.NewTransactionAt(math.MaxUint64, false)
+	} else {
+		txn = db.NewTransaction(false)
+	}
+	defer txn.Discard()
+
+	type reservoir struct {
+		seen    int
+		samples [][]byte
+	}
+	reservoirs := make(map[string]*reservoir)
+	var val []byte
+	sample := func(ns string, item *Item) error {
+		r, ok := reservoirs[ns]
+		if !ok {
+			r = &reservoir{}
+			reservoirs[ns] = r
+		}
+		r.seen++
+		i := len(r.samples)
+		if i == dictMaxSamples {
+			if i = rand.Intn(r.seen); i >= dictMaxSamples {
+				return nil
+			}
+		}
+		if val == nil {
+			var err error
+			if val, err = item.ValueCopy(nil); err != nil {
+				return err
+			}
+		}
+		if i == len(r.samples) {
+			r.samples = append(r.samples, val)
+		} else {
+			r.samples[i] = val
+		}
+		return nil
+	}
+
+	opt := DefaultIteratorOptions
+	opt.PrefetchValues = false
+	itr := txn.NewIterator(opt)
+	defer itr.Close()
+	for itr.Rewind(); itr.Valid(); itr.Next() {
+		item := itr.Item()
+		if item.IsDeletedOrExpired() {
+			continue
+		}
+		if sz := item.ValueSize(); sz < minCompressedValueSize || sz > dictMaxSampleSize {
+			continue
+		}
+		val = nil
+		if err := sample("", item); err != nil {
+			return nil, err
+		}
+		if ns := db.namespace(item.Key()); ns != nil {
+			if err := sample(string(ns), item); err != nil {
+				return nil, err
+			}
+		}
+	}
+	samples := make(map[string][][]byte, len(reservoirs))
+	for ns, r := range reservoirs {
+		samples[ns] = r.samples
+	}
+	return samples, nil
+}
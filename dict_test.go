@@ -0,0 +1,170 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3/options"
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/stretchr/testify/require"
+)
+
+func jsonValue(r *rand.Rand, padding int) []byte {
+	return []byte(fmt.Sprintf(`{"id":%d,"name":"user-%d","email":"user%d@example.com",`+
+		`"active":%v,"roles":["reader","writer"],"created_at":"2021-%02d-%02dT10:%02d:00Z",`+
+		`"bio":"%0*d"}`, r.Intn(1e6), r.Intn(1e4), r.Intn(1e4), r.Intn(2) == 0, 1+r.Intn(12),
+		1+r.Intn(28), r.Intn(60), padding, 0))
+}
+
+func TestTrainDictionaries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+	opt := getTestOptions(dir).
+		WithValueThreshold(512).
+		WithCompression(options.ZSTD).
+		WithValueCompression(options.ZSTD)
+	db, err := Open(opt)
+	require.NoError(t, err)
+
+	r := rand.New(rand.NewSource(1))
+	vals := make(map[string][]byte)
+	write := func(n int) {
+		wb := db.NewWriteBatch()
+		for i := 0; i < n; i++ {
+			key := fmt.Sprintf("key%05d", len(vals))
+			// Every fourth value goes to the value log.
+			val := jsonValue(r, 10+(i%4/3)*500)
+			vals[key] = val
+			require.NoError(t, wb.Set([]byte(key), val))
+		}
+		require.NoError(t, wb.Flush())
+	}
+	storedSize := func(key string) int {
+		var n int
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get([]byte(key))
+			require.NoError(t, err)
+			require.Zero(t, item.meta&bitValuePointer)
+			n = len(item.vptr)
+			return nil
+		}))
+		return n
+	}
+	check := func() {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for key, val := range vals {
+				item, err := txn.Get([]byte(key))
+				require.NoError(t, err)
+				require.Equal(t, val, getItemValue(t, item), "key: %s", key)
+			}
+			return nil
+		}))
+	}
+
+	write(1000)
+	before := storedSize("key00998")
+	require.NoError(t, db.TrainDictionaries(4<<10))
+	write(1000)
+	after := storedSize("key01998")
+	require.Less(t, after*3, before*2, "before: %d, after: %d", before, after)
+	require.NotZero(t, buildTableOptions(db).ZSTDDictID)
+	check()
+
+	// The dictionaries are loaded from the MANIFEST, including after it is rewritten.
+	require.NoError(t, db.Close())
+	db, err = Open(opt)
+	require.NoError(t, err)
+	require.Len(t, db.loadDictIDs(), 1)
+	check()
+	db.manifest.appendLock.Lock()
+	require.NoError(t, db.manifest.rewrite())
+	db.manifest.appendLock.Unlock()
+	require.NoError(t, db.Close())
+
+	// A retrained dictionary supersedes the previous one, which is still read.
+	db, err = Open(opt)
+	require.NoError(t, err)
+	check()
+	id := db.dictID(nil)
+	require.NoError(t, db.TrainDictionaries(4<<10))
+	require.Equal(t, id+1, db.dictID(nil))
+	write(100)
+	require.NoError(t, db.Flatten(2))
+	check()
+	require.NoError(t, db.Close())
+}
+
+func TestTrainDictionariesNamespaces(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		require.Equal(t, ErrNoZSTD, db.TrainDictionaries(4<<10))
+	})
+
+	opt := getTestOptions("").
+		WithInMemory(true).
+		WithNamespaceOffset(0).
+		WithValueCompression(options.ZSTD)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	// Too few values to train a dictionary.
+	require.Error(t, db.TrainDictionaries(4<<10))
+
+	r := rand.New(rand.NewSource(1))
+	key := func(ns uint64, i int) []byte {
+		return append(y.U64ToBytes(ns), fmt.Sprintf("key%05d", i)...)
+	}
+	wb := db.NewWriteBatch()
+	for i := 0; i < 500; i++ {
+		require.NoError(t, wb.Set(key(1, i), jsonValue(r, 10)))
+		require.NoError(t, wb.Set(key(2, i), []byte(fmt.Sprintf(
+			`<event><ts>%d</ts><level>info</level><msg>request served in %dms</msg></event>`,
+			r.Int63(), r.Intn(1000)))))
+		// Namespace 3 has too few values for a dictionary of its own.
+		if i < 3 {
+			require.NoError(t, wb.Set(key(3, i), jsonValue(r, 10)))
+		}
+	}
+	require.NoError(t, wb.Flush())
+	require.NoError(t, db.TrainDictionaries(4<<10))
+
+	ids := db.loadDictIDs()
+	require.Len(t, ids, 3)
+	all := ids[""]
+	require.NotZero(t, all)
+	require.NotEqual(t, all, db.dictID(key(1, 0)))
+	require.NotEqual(t, all, db.dictID(key(2, 0)))
+	require.NotEqual(t, db.dictID(key(1, 0)), db.dictID(key(2, 0)))
+	require.Equal(t, all, db.dictID(key(3, 0)))
+	require.Equal(t, all, db.dictID([]byte("short")))
+
+	require.NoError(t, db.Update(func(txn *Txn) error {
+		return txn.Set(key(2, 1000), []byte(`<event><ts>1</ts><level>info</level>`+
+			`<msg>request served in 3ms</msg></event>`))
+	}))
+	require.NoError(t, db.View(func(txn *Txn) error {
+		item, err := txn.Get(key(2, 1000))
+		require.NoError(t, err)
+		require.Equal(t, bitCompressed, item.meta&bitCompressed)
+		return nil
+	}))
+}
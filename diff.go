@@ -0,0 +1,115 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"bytes"
+)
+
+// DiffOp tells how a key has changed between two versions of the DB.
+type DiffOp int
+
+const (
+	// DiffAdded means that the key didn't exist in the older version.
+	DiffAdded DiffOp = iota
+	// DiffUpdated means that the key has been written again since the older version.
+	DiffUpdated
+	// DiffDeleted means that the key has been deleted since the older version, or that the version
+	// written since then has expired.
+	DiffDeleted
+)
+
+func (op DiffOp) String() string {
+	switch op {
+	case DiffAdded:
+		return "added"
+	case DiffUpdated:
+		return "updated"
+	case DiffDeleted:
+		return "deleted"
+	}
+	return "unknown"
+}
+
+// Diff calls fn for every key which has changed between sinceTs and the read timestamp of the
+// transaction, in key order. The item passed to fn is the latest version of the key, and is only
+// valid for the duration of the call. Keys which were added and then deleted within that window
+// are skipped. Tables whose max version is not greater than sinceTs are not read.
+//
+// Whether a key has been added or updated is found by looking the key up as of sinceTs. If the
+// versions at sinceTs have already been discarded by compaction, which can happen when
+// Options.NumVersionsToKeep is low, updated keys are reported as added.
+//
+// If fn returns an error, Diff stops and returns that error.
+func (txn *Txn) Diff(sinceTs uint64, fn func(op DiffOp, item *Item) error) error {
+	if txn.discarded {
+		return ErrDiscardedTxn
+	}
+	old := txn.db.newTransaction(false, true)
+	old.readTs = sinceTs
+	// The read timestamp of old hasn't been registered with the oracle, so it must not be
+	// marked as done on Discard.
+	old.doneRead = true
+	defer old.Discard()
+
+	opt := DefaultIteratorOptions
+	opt.AllVersions = true
+	opt.PrefetchValues = false
+	opt.SinceTs = sinceTs
+	itr := txn.NewIterator(opt)
+	defer itr.Close()
+
+	var lastKey []byte
+	for itr.Rewind(); itr.Valid(); itr.Next() {
+		item := itr.Item()
+		if lastKey != nil && bytes.Equal(item.Key(), lastKey) {
+			// Only the latest version of the key matters.
+			continue
+		}
+		lastKey = item.KeyCopy(lastKey)
+
+		existed := true
+		if _, err := old.Get(item.Key()); err == ErrKeyNotFound {
+			existed = false
+		} else if err != nil {
+			return err
+		}
+
+		var op DiffOp
+		switch {
+		case item.IsDeletedOrExpired() && !existed:
+			continue
+		case item.IsDeletedOrExpired():
+			op = DiffDeleted
+		case existed:
+			op = DiffUpdated
+		default:
+			op = DiffAdded
+		}
+		if err := fn(op, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Diff calls fn for every key which has changed since sinceTs. See Txn.Diff for details.
+func (db *DB) Diff(sinceTs uint64, fn func(op DiffOp, item *Item) error) error {
+	return db.View(func(txn *Txn) error {
+		return txn.Diff(sinceTs, fn)
+	})
+}
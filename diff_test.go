@@ -0,0 +1,76 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		txnSet(t, db, []byte("unchanged"), []byte("v1"), 0)
+		txnSet(t, db, []byte("updated"), []byte("v1"), 0)
+		txnSet(t, db, []byte("deleted"), []byte("v1"), 0)
+		since := db.MaxVersion()
+
+		txnSet(t, db, []byte("added"), []byte("v1"), 0)
+		txnSet(t, db, []byte("updated"), []byte("v2"), 0)
+		txnSet(t, db, []byte("updated"), []byte("v3"), 0)
+		txnDelete(t, db, []byte("deleted"))
+		txnSet(t, db, []byte("transient"), []byte("v1"), 0)
+		txnDelete(t, db, []byte("transient"))
+
+		type change struct {
+			key string
+			op  DiffOp
+			val string
+		}
+		var changes []change
+		require.NoError(t, db.Diff(since, func(op DiffOp, item *Item) error {
+			c := change{key: string(item.Key()), op: op}
+			if op != DiffDeleted {
+				val, err := item.ValueCopy(nil)
+				require.NoError(t, err)
+				c.val = string(val)
+			}
+			changes = append(changes, c)
+			return nil
+		}))
+		require.Equal(t, []change{
+			{"added", DiffAdded, "v1"},
+			{"deleted", DiffDeleted, ""},
+			{"updated", DiffUpdated, "v3"},
+		}, changes)
+
+		// Everything is new since the beginning.
+		var count int
+		require.NoError(t, db.Diff(0, func(op DiffOp, item *Item) error {
+			require.Equal(t, DiffAdded, op)
+			count++
+			return nil
+		}))
+		require.Equal(t, 3, count)
+
+		errStop := errors.New("stop")
+		require.Equal(t, errStop, db.Diff(since, func(op DiffOp, item *Item) error {
+			return errStop
+		}))
+	})
+}
@@ -23,6 +23,7 @@ import (
 	"sort"
 	"sync"
 
+	"github.com/dgraph-io/badger/v3/vfs"
 	"github.com/dgraph-io/badger/v3/y"
 	"github.com/dgraph-io/ristretto/z"
 )
@@ -42,8 +43,12 @@ const discardFname string = "DISCARD"
 func InitDiscardStats(opt Options) (*discardStats, error) {
 	fname := filepath.Join(opt.ValueDir, discardFname)
 
+	if opt.FS == nil {
+		opt.FS = vfs.OS
+	}
+
 	// 1GB file can store 67M discard entries. Each entry is 16 bytes.
-	mf, err := z.OpenMmapFile(fname, os.O_CREATE|os.O_RDWR, 1<<20)
+	mf, err := opt.FS.OpenMmapFile(fname, os.O_CREATE|os.O_RDWR, 1<<20)
 	lf := &discardStats{
 		MmapFile: mf,
 		opt:      opt,
@@ -0,0 +1,367 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package encrypted encrypts keys and values with a user key before they are written to Badger.
+// Unlike Options.EncryptionKey, which encrypts the files on disk, the data is encrypted before it
+// reaches the DB, so the key never has to be handed to Badger or to whoever runs the process
+// holding the DB.
+//
+// Values are encrypted with AES-GCM, using the plaintext key as associated data, so that a value
+// can't be moved to another key without being detected. Keys are left as is by default. If
+// Options.EncryptKeys is set, keys are encrypted deterministically, so they can still be looked
+// up, but their order is lost: iteration returns the keys in an arbitrary order, and prefix
+// iteration is not possible. Order-preserving encryption is deliberately not offered, since it
+// leaks the order and the approximate value of the keys.
+//
+// If the DB stores a namespace in its keys (see badger.Options.NamespaceOffset), each namespace
+// can have its own key, set with Options.NamespaceKey. The data of a namespace can then only be
+// read with the key of that namespace, so destroying that key makes the data unreadable. With
+// Options.EncryptKeys, the bytes up to and including the namespace are left in the clear, so that
+// the namespace of a key is known, and the keys of a namespace can be iterated over.
+package encrypted
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrCorrupted is returned when a key or a value can't be decrypted, because it has been
+	// tampered with or was encrypted with a different key.
+	ErrCorrupted = errors.New("encrypted data can't be decrypted with the given key")
+
+	// ErrPrefixWithEncryptedKeys is returned when iterating over a prefix while keys are
+	// encrypted, unless the prefix lies within the namespaced part of the keys.
+	ErrPrefixWithEncryptedKeys = errors.New("prefix iteration is not possible with encrypted keys")
+)
+
+// Options control what gets encrypted.
+type Options struct {
+	// EncryptKeys encrypts the keys in addition to the values.
+	EncryptKeys bool
+
+	// NamespaceKey, if set, returns the key used to encrypt the data of the given namespace. It is
+	// called once per namespace, the first time the namespace is accessed. The key passed to Wrap
+	// is used for the keys which don't hold a namespace. NamespaceKey is only used if the DB has
+	// a NamespaceOffset.
+	NamespaceKey func(ns uint64) ([]byte, error)
+}
+
+// DB wraps a badger.DB, encrypting the data written to it and decrypting the data read from it.
+type DB struct {
+	db       *badger.DB
+	opt      Options
+	nsOffset int
+
+	defaultCipher *keyCipher
+	sync.RWMutex
+	nsCiphers map[uint64]*keyCipher
+	shredded  map[uint64]struct{} // The namespaces shredded by Shred, never to be cached again.
+}
+
+// keyCipher encrypts keys and values with the sub-keys derived from a user key.
+type keyCipher struct {
+	value  cipher.AEAD
+	key    []byte
+	keyMAC []byte
+}
+
+// deriveKey derives a sub-key for the given purpose, so that the same user key is never used
+// for two different things.
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)[:len(key)]
+}
+
+func newKeyCipher(key []byte) (*keyCipher, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, badger.ErrInvalidEncryptionKey
+	}
+	block, err := aes.NewCipher(deriveKey(key, "badger value"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &keyCipher{
+		value:  aead,
+		key:    deriveKey(key, "badger key"),
+		keyMAC: deriveKey(key, "badger key mac"),
+	}, nil
+}
+
+// Wrap returns a DB which encrypts the data with key before writing it to db. key must be 16, 24
+// or 32 bytes long, to select AES-128, AES-192 or AES-256.
+func Wrap(db *badger.DB, key []byte, opt Options) (*DB, error) {
+	c, err := newKeyCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nsOffset := db.Opts().NamespaceOffset
+	if opt.NamespaceKey == nil {
+		nsOffset = -1
+	}
+	return &DB{
+		db:            db,
+		opt:           opt,
+		nsOffset:      nsOffset,
+		defaultCipher: c,
+		nsCiphers:     make(map[uint64]*keyCipher),
+		shredded:      make(map[uint64]struct{}),
+	}, nil
+}
+
+// cipherFor returns the cipher for the given plaintext key, along with the length of the part of
+// the key which is left in the clear. Like badger.DB, a key only holds a namespace if it is longer
+// than NamespaceOffset+8.
+func (db *DB) cipherFor(key []byte) (*keyCipher, int, error) {
+	if db.nsOffset < 0 || len(key) <= db.nsOffset+8 {
+		return db.defaultCipher, 0, nil
+	}
+	c, err := db.namespaceCipher(y.BytesToU64(key[db.nsOffset:]))
+	return c, db.nsOffset + 8, err
+}
+
+func (db *DB) namespaceCipher(ns uint64) (*keyCipher, error) {
+	db.RLock()
+	c, ok := db.nsCiphers[ns]
+	db.RUnlock()
+	if ok {
+		return c, nil
+	}
+	key, err := db.opt.NamespaceKey(ns)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while fetching the key of namespace %d", ns)
+	}
+	if c, err = newKeyCipher(key); err != nil {
+		return nil, err
+	}
+	db.Lock()
+	defer db.Unlock()
+	// The key may have been fetched before Shred destroyed it.
+	if _, ok := db.shredded[ns]; ok {
+		return nil, errors.Wrapf(ErrKeyDestroyed, "while fetching the key of namespace %d", ns)
+	}
+	db.nsCiphers[ns] = c
+	return c, nil
+}
+
+// encryptKey encrypts the key with AES-CTR, using a MAC of the key as the IV. This makes the
+// encryption deterministic, as required for lookups, and lets decryptKey authenticate the key.
+func (db *DB) encryptKey(key []byte) ([]byte, error) {
+	if !db.opt.EncryptKeys {
+		return key, nil
+	}
+	c, clear, err := db.cipherFor(key)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, c.keyMAC)
+	mac.Write(key)
+	iv := mac.Sum(nil)[:aes.BlockSize]
+	ct, err := y.XORBlockAllocate(key[clear:], c.key, iv)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, clear+len(iv)+len(ct))
+	out = append(out, key[:clear]...)
+	out = append(out, iv...)
+	return append(out, ct...), nil
+}
+
+func (db *DB) decryptKey(key []byte) ([]byte, error) {
+	if !db.opt.EncryptKeys {
+		return key, nil
+	}
+	// The key holds a namespace if the encrypted part of it isn't empty.
+	c, clear := db.defaultCipher, 0
+	if db.nsOffset >= 0 && len(key) > db.nsOffset+8+aes.BlockSize {
+		var err error
+		clear = db.nsOffset + 8
+		if c, err = db.namespaceCipher(y.BytesToU64(key[db.nsOffset:])); err != nil {
+			return nil, err
+		}
+	}
+	if len(key) < clear+aes.BlockSize {
+		return nil, ErrCorrupted
+	}
+	iv := key[clear : clear+aes.BlockSize]
+	rest, err := y.XORBlockAllocate(key[clear+aes.BlockSize:], c.key, iv)
+	if err != nil {
+		return nil, err
+	}
+	plain := append(append(make([]byte, 0, clear+len(rest)), key[:clear]...), rest...)
+	mac := hmac.New(sha256.New, c.keyMAC)
+	mac.Write(plain)
+	if !hmac.Equal(mac.Sum(nil)[:aes.BlockSize], iv) {
+		return nil, ErrCorrupted
+	}
+	return plain, nil
+}
+
+// Format of an encrypted value:
+// +-----------+------------------------+
+// | Nonce(12) | Ciphertext and GCM tag |
+// +-----------+------------------------+
+func (db *DB) encryptValue(key, val []byte) ([]byte, error) {
+	c, _, err := db.cipherFor(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, c.value.NonceSize(), c.value.NonceSize()+len(val)+c.value.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.value.Seal(nonce, nonce, val, key), nil
+}
+
+func (db *DB) decryptValue(key, val []byte) ([]byte, error) {
+	c, _, err := db.cipherFor(key)
+	if err != nil {
+		return nil, err
+	}
+	ns := c.value.NonceSize()
+	if len(val) < ns {
+		return nil, ErrCorrupted
+	}
+	plain, err := c.value.Open(nil, val[:ns], val[ns:], key)
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	return plain, nil
+}
+
+// Txn wraps a badger.Txn, encrypting and decrypting the data as it goes.
+type Txn struct {
+	db  *DB
+	txn *badger.Txn
+}
+
+// Txn returns a Txn which encrypts the data written to txn and decrypts the data read from it.
+// This can be used along with transactions created by the caller, e.g. in managed mode.
+func (db *DB) Txn(txn *badger.Txn) *Txn {
+	return &Txn{db: db, txn: txn}
+}
+
+// View runs fn in a read-only transaction. See badger.DB.View.
+func (db *DB) View(fn func(txn *Txn) error) error {
+	return db.db.View(func(txn *badger.Txn) error {
+		return fn(db.Txn(txn))
+	})
+}
+
+// Update runs fn in a read-write transaction. See badger.DB.Update.
+func (db *DB) Update(fn func(txn *Txn) error) error {
+	return db.db.Update(func(txn *badger.Txn) error {
+		return fn(db.Txn(txn))
+	})
+}
+
+// Set encrypts the value, and the key if Options.EncryptKeys is set, and adds them to the
+// transaction.
+func (txn *Txn) Set(key, val []byte) error {
+	ekey, err := txn.db.encryptKey(key)
+	if err != nil {
+		return err
+	}
+	eval, err := txn.db.encryptValue(key, val)
+	if err != nil {
+		return err
+	}
+	return txn.txn.Set(ekey, eval)
+}
+
+// Get returns a decrypted copy of the value of key. It returns badger.ErrKeyNotFound if the key
+// doesn't exist.
+func (txn *Txn) Get(key []byte) ([]byte, error) {
+	ekey, err := txn.db.encryptKey(key)
+	if err != nil {
+		return nil, err
+	}
+	item, err := txn.txn.Get(ekey)
+	if err != nil {
+		return nil, err
+	}
+	var val []byte
+	err = item.Value(func(eval []byte) error {
+		val, err = txn.db.decryptValue(key, eval)
+		return err
+	})
+	return val, err
+}
+
+// Delete deletes the key.
+func (txn *Txn) Delete(key []byte) error {
+	ekey, err := txn.db.encryptKey(key)
+	if err != nil {
+		return err
+	}
+	return txn.txn.Delete(ekey)
+}
+
+// Iterate calls fn with the decrypted key and value of every key having the given prefix. The
+// keys are passed in order, unless Options.EncryptKeys is set, in which case the order is
+// arbitrary and prefix must not go beyond the namespace of the keys. Keys of shredded namespaces
+// are skipped. The slices passed to fn can be kept by the caller. If fn returns an error, Iterate
+// stops and returns that error.
+func (txn *Txn) Iterate(prefix []byte, fn func(key, val []byte) error) error {
+	if txn.db.opt.EncryptKeys && len(prefix) > 0 &&
+		(txn.db.nsOffset < 0 || len(prefix) > txn.db.nsOffset+8) {
+		return ErrPrefixWithEncryptedKeys
+	}
+	opt := badger.DefaultIteratorOptions
+	opt.Prefix = prefix
+	itr := txn.txn.NewIterator(opt)
+	defer itr.Close()
+
+	for itr.Rewind(); itr.Valid(); itr.Next() {
+		item := itr.Item()
+		key, err := txn.db.decryptKey(item.KeyCopy(nil))
+		if errors.Cause(err) == ErrKeyDestroyed {
+			// The namespace has been shredded.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var val []byte
+		if err := item.Value(func(eval []byte) error {
+			val, err = txn.db.decryptValue(key, eval)
+			return err
+		}); errors.Cause(err) == ErrKeyDestroyed {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := fn(key, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
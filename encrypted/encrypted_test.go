@@ -0,0 +1,217 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package encrypted
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/stretchr/testify/require"
+)
+
+func openDB(t *testing.T) *badger.DB {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	return db
+}
+
+var testKey = bytes.Repeat([]byte("k"), 32)
+
+func TestEncrypted(t *testing.T) {
+	for _, encryptKeys := range []bool{false, true} {
+		t.Run(fmt.Sprintf("EncryptKeys=%v", encryptKeys), func(t *testing.T) {
+			db := openDB(t)
+			defer db.Close()
+			edb, err := Wrap(db, testKey, Options{EncryptKeys: encryptKeys})
+			require.NoError(t, err)
+
+			require.NoError(t, edb.Update(func(txn *Txn) error {
+				for i := 0; i < 10; i++ {
+					key := []byte(fmt.Sprintf("key%d", i))
+					if err := txn.Set(key, []byte(fmt.Sprintf("val%d", i))); err != nil {
+						return err
+					}
+				}
+				return txn.Delete([]byte("key5"))
+			}))
+
+			require.NoError(t, edb.View(func(txn *Txn) error {
+				val, err := txn.Get([]byte("key3"))
+				require.NoError(t, err)
+				require.Equal(t, []byte("val3"), val)
+				_, err = txn.Get([]byte("key5"))
+				require.Equal(t, badger.ErrKeyNotFound, err)
+
+				var keys []string
+				require.NoError(t, txn.Iterate(nil, func(key, val []byte) error {
+					require.Equal(t, "val"+string(key[3:]), string(val))
+					keys = append(keys, string(key))
+					return nil
+				}))
+				sort.Strings(keys)
+				require.Equal(t, []string{"key0", "key1", "key2", "key3", "key4", "key6", "key7",
+					"key8", "key9"}, keys)
+
+				err = txn.Iterate([]byte("key"), func(key, val []byte) error { return nil })
+				if encryptKeys {
+					require.Equal(t, ErrPrefixWithEncryptedKeys, err)
+				} else {
+					require.NoError(t, err)
+				}
+				return nil
+			}))
+
+			// Nothing in the underlying DB is readable.
+			require.NoError(t, db.View(func(txn *badger.Txn) error {
+				itr := txn.NewIterator(badger.DefaultIteratorOptions)
+				defer itr.Close()
+				for itr.Rewind(); itr.Valid(); itr.Next() {
+					item := itr.Item()
+					require.Equal(t, !encryptKeys, bytes.HasPrefix(item.Key(), []byte("key")))
+					val, err := item.ValueCopy(nil)
+					require.NoError(t, err)
+					require.False(t, bytes.Contains(val, []byte("val")))
+				}
+				return nil
+			}))
+
+			// A different key can't read the data.
+			other, err := Wrap(db, bytes.Repeat([]byte("o"), 32), Options{})
+			require.NoError(t, err)
+			if !encryptKeys {
+				require.NoError(t, other.View(func(txn *Txn) error {
+					_, err := txn.Get([]byte("key3"))
+					require.Equal(t, ErrCorrupted, err)
+					return nil
+				}))
+			}
+		})
+	}
+}
+
+func TestEncryptedSwappedValue(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	edb, err := Wrap(db, testKey, Options{})
+	require.NoError(t, err)
+	require.NoError(t, edb.Update(func(txn *Txn) error {
+		return txn.Set([]byte("a"), []byte("secret"))
+	}))
+
+	// Copy the encrypted value of a over to b.
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("a"))
+		require.NoError(t, err)
+		val, err := item.ValueCopy(nil)
+		require.NoError(t, err)
+		return txn.Set([]byte("b"), val)
+	}))
+	require.NoError(t, edb.View(func(txn *Txn) error {
+		_, err := txn.Get([]byte("b"))
+		require.Equal(t, ErrCorrupted, err)
+		return nil
+	}))
+}
+
+func TestWrapInvalidKey(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	_, err := Wrap(db, []byte("short"), Options{})
+	require.Equal(t, badger.ErrInvalidEncryptionKey, err)
+}
+
+func nsKey(ns uint64, key string) []byte {
+	return append(y.U64ToBytes(ns), key...)
+}
+
+func TestNamespaceKeys(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil).
+		WithNamespaceOffset(0))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	keys := map[uint64][]byte{
+		1: bytes.Repeat([]byte("1"), 32),
+		2: bytes.Repeat([]byte("2"), 32),
+	}
+	opt := Options{
+		EncryptKeys: true,
+		NamespaceKey: func(ns uint64) ([]byte, error) {
+			key, ok := keys[ns]
+			if !ok {
+				return nil, fmt.Errorf("no key for namespace %d", ns)
+			}
+			return key, nil
+		},
+	}
+	edb, err := Wrap(db, testKey, opt)
+	require.NoError(t, err)
+	require.NoError(t, edb.Update(func(txn *Txn) error {
+		require.NoError(t, txn.Set(nsKey(1, "a"), []byte("one")))
+		require.NoError(t, txn.Set(nsKey(2, "a"), []byte("two")))
+		require.NoError(t, txn.Set([]byte("short"), []byte("default")))
+		require.Error(t, txn.Set(nsKey(3, "a"), []byte("three")))
+		return nil
+	}))
+
+	require.NoError(t, edb.View(func(txn *Txn) error {
+		var got []string
+		require.NoError(t, txn.Iterate(y.U64ToBytes(2), func(key, val []byte) error {
+			require.Equal(t, nsKey(2, "a"), key)
+			got = append(got, string(val))
+			return nil
+		}))
+		require.Equal(t, []string{"two"}, got)
+		val, err := txn.Get([]byte("short"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("default"), val)
+		return nil
+	}))
+
+	// The namespace is kept in the clear.
+	require.NoError(t, db.View(func(txn *badger.Txn) error {
+		itr := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer itr.Close()
+		var n int
+		for itr.Seek(y.U64ToBytes(1)); itr.ValidForPrefix(y.U64ToBytes(1)); itr.Next() {
+			require.False(t, bytes.HasSuffix(itr.Item().Key(), []byte("a")) &&
+				len(itr.Item().Key()) == 9)
+			n++
+		}
+		require.Equal(t, 1, n)
+		return nil
+	}))
+
+	// Without the key of namespace 1, its data can't be read, while namespace 2 still can.
+	keys[1] = bytes.Repeat([]byte("x"), 32)
+	edb, err = Wrap(db, testKey, opt)
+	require.NoError(t, err)
+	require.NoError(t, edb.View(func(txn *Txn) error {
+		_, err := txn.Get(nsKey(1, "a"))
+		require.Equal(t, badger.ErrKeyNotFound, err)
+		val, err := txn.Get(nsKey(2, "a"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("two"), val)
+		require.Equal(t, ErrCorrupted, txn.Iterate(y.U64ToBytes(1),
+			func(key, val []byte) error { return nil }))
+		return nil
+	}))
+}
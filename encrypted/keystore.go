@@ -0,0 +1,228 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package encrypted
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/pkg/errors"
+)
+
+// ErrKeyDestroyed is returned when accessing a namespace whose key has been destroyed.
+var ErrKeyDestroyed = errors.New("the key of the namespace has been destroyed")
+
+// Keystore holds the keys of the namespaces of a DB in a file, encrypted with a master key. It
+// is kept outside of the DB, so that a key can be destroyed right away: the data of a DB is only
+// removed from disk by compactions and value log GC, but a destroyed key is gone as soon as
+// Destroy returns, which makes the data of its namespace unrecoverable. This is known as
+// crypto-shredding.
+//
+// Keystore.Key can be used as Options.NamespaceKey. Keys are generated on first use.
+type Keystore struct {
+	sync.Mutex
+	path   string
+	master cipher.AEAD
+	keys   map[uint64][]byte
+	// destroyed keeps the namespaces whose key has been destroyed, so that no new key is
+	// generated for them.
+	destroyed map[uint64]struct{}
+}
+
+type keystoreFile struct {
+	Keys      map[string][]byte `json:"keys"`
+	Destroyed []uint64          `json:"destroyed"`
+}
+
+// OpenKeystore opens the keystore at path, creating it if it doesn't exist. The keys are
+// encrypted with master, which must be 16, 24 or 32 bytes long.
+func OpenKeystore(path string, master []byte) (*Keystore, error) {
+	switch len(master) {
+	case 16, 24, 32:
+	default:
+		return nil, badger.ErrInvalidEncryptionKey
+	}
+	block, err := aes.NewCipher(master)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	ks := &Keystore{
+		path:      path,
+		master:    aead,
+		keys:      make(map[uint64][]byte),
+		destroyed: make(map[uint64]struct{}),
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ks, nil
+	}
+	if err != nil {
+		return nil, y.Wrapf(err, "while reading keystore %s", path)
+	}
+	var f keystoreFile
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return nil, y.Wrapf(err, "while decoding keystore %s", path)
+	}
+	ns := aead.NonceSize()
+	for nsStr, wrapped := range f.Keys {
+		id, err := strconv.ParseUint(nsStr, 10, 64)
+		if err != nil {
+			return nil, y.Wrapf(err, "while decoding keystore %s", path)
+		}
+		if len(wrapped) < ns {
+			return nil, ErrCorrupted
+		}
+		key, err := aead.Open(nil, wrapped[:ns], wrapped[ns:], []byte(nsStr))
+		if err != nil {
+			return nil, ErrCorrupted
+		}
+		ks.keys[id] = key
+	}
+	for _, id := range f.Destroyed {
+		ks.destroyed[id] = struct{}{}
+	}
+	return ks, nil
+}
+
+// Key returns the key of the given namespace, generating and persisting a new 32 bytes key if the
+// namespace has none yet. It returns ErrKeyDestroyed if the key has been destroyed. The returned
+// key is a copy, which Destroy doesn't clear.
+func (ks *Keystore) Key(ns uint64) ([]byte, error) {
+	ks.Lock()
+	defer ks.Unlock()
+	if _, ok := ks.destroyed[ns]; ok {
+		return nil, ErrKeyDestroyed
+	}
+	if key, ok := ks.keys[ns]; ok {
+		return append([]byte{}, key...), nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	ks.keys[ns] = key
+	if err := ks.save(); err != nil {
+		delete(ks.keys, ns)
+		return nil, err
+	}
+	return append([]byte{}, key...), nil
+}
+
+// Destroy deletes the key of the given namespace from the keystore, and syncs the keystore to
+// disk. Once Destroy returns, the data written with that key can no longer be decrypted.
+func (ks *Keystore) Destroy(ns uint64) error {
+	ks.Lock()
+	defer ks.Unlock()
+	key, had := ks.keys[ns]
+	delete(ks.keys, ns)
+	ks.destroyed[ns] = struct{}{}
+	if err := ks.save(); err != nil {
+		if had {
+			ks.keys[ns] = key
+		}
+		delete(ks.destroyed, ns)
+		return err
+	}
+	// Don't leave the key around in memory.
+	for i := range key {
+		key[i] = 0
+	}
+	return nil
+}
+
+// save atomically replaces the keystore file. Must be called with the lock held.
+func (ks *Keystore) save() error {
+	f := keystoreFile{Keys: make(map[string][]byte, len(ks.keys))}
+	for id, key := range ks.keys {
+		nsStr := strconv.FormatUint(id, 10)
+		nonce := make([]byte, ks.master.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		f.Keys[nsStr] = ks.master.Seal(nonce, nonce, key, []byte(nsStr))
+	}
+	for id := range ks.destroyed {
+		f.Destroyed = append(f.Destroyed, id)
+	}
+	buf, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := ks.path + ".tmp"
+	fp, err := y.OpenTruncFile(tmpPath, false)
+	if err != nil {
+		return err
+	}
+	if _, err := fp.Write(buf); err != nil {
+		fp.Close()
+		return err
+	}
+	if err := fp.Sync(); err != nil {
+		fp.Close()
+		return err
+	}
+	// In Windows the files should be closed before doing a Rename.
+	if err := fp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, ks.path); err != nil {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(ks.path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// Shred destroys the key of the given namespace in ks, making the data of the namespace
+// unrecoverable right away. ks must be the keystore whose Key method is used as the
+// Options.NamespaceKey of db. If the namespace is at the start of the keys, the namespace is also
+// dropped from the underlying DB, so that its files get rewritten without it. Otherwise the data
+// stays on disk, unreadable, until it is overwritten or deleted.
+func (db *DB) Shred(ks *Keystore, ns uint64) error {
+	if db.nsOffset < 0 {
+		return badger.ErrNamespaceMode
+	}
+	if err := ks.Destroy(ns); err != nil {
+		return err
+	}
+	db.Lock()
+	delete(db.nsCiphers, ns)
+	db.shredded[ns] = struct{}{}
+	db.Unlock()
+	if db.nsOffset == 0 {
+		return db.db.DropPrefix(y.U64ToBytes(ns))
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package encrypted
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeystore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys")
+
+	ks, err := OpenKeystore(path, testKey)
+	require.NoError(t, err)
+	k1, err := ks.Key(1)
+	require.NoError(t, err)
+	k2, err := ks.Key(2)
+	require.NoError(t, err)
+	require.NotEqual(t, k1, k2)
+	// Destroy doesn't clear the keys returned by Key.
+	k2Copy := append([]byte{}, k2...)
+	require.NoError(t, ks.Destroy(2))
+	require.Equal(t, k2Copy, k2)
+	_, err = ks.Key(2)
+	require.Equal(t, ErrKeyDestroyed, err)
+
+	// The keys survive a reopen, and so does the destruction.
+	ks, err = OpenKeystore(path, testKey)
+	require.NoError(t, err)
+	got, err := ks.Key(1)
+	require.NoError(t, err)
+	require.Equal(t, k1, got)
+	_, err = ks.Key(2)
+	require.Equal(t, ErrKeyDestroyed, err)
+
+	buf, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(buf, k1))
+
+	_, err = OpenKeystore(path, bytes.Repeat([]byte("x"), 32))
+	require.Equal(t, ErrCorrupted, err)
+}
+
+func TestShred(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ks, err := OpenKeystore(filepath.Join(dir, "keys"), testKey)
+	require.NoError(t, err)
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil).
+		WithNamespaceOffset(0))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	edb, err := Wrap(db, testKey, Options{NamespaceKey: ks.Key})
+	require.NoError(t, err)
+
+	require.NoError(t, edb.Update(func(txn *Txn) error {
+		require.NoError(t, txn.Set(nsKey(1, "a"), []byte("one")))
+		return txn.Set(nsKey(2, "a"), []byte("two"))
+	}))
+	require.NoError(t, edb.Shred(ks, 1))
+
+	require.NoError(t, edb.View(func(txn *Txn) error {
+		// The namespace has been dropped too.
+		_, err := txn.Get(nsKey(1, "a"))
+		require.Equal(t, badger.ErrKeyNotFound, err)
+		var n int
+		require.NoError(t, txn.Iterate(nil, func(key, val []byte) error {
+			require.Equal(t, nsKey(2, "a"), key)
+			n++
+			return nil
+		}))
+		require.Equal(t, 1, n)
+		return nil
+	}))
+	require.NoError(t, db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(nsKey(1, "a"))
+		require.Equal(t, badger.ErrKeyNotFound, err)
+		return nil
+	}))
+
+	err = edb.Update(func(txn *Txn) error {
+		return txn.Set(nsKey(1, "b"), []byte("new"))
+	})
+	require.Equal(t, ErrKeyDestroyed, errors.Cause(err))
+}
+
+func TestShredKeepsData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ks, err := OpenKeystore(filepath.Join(dir, "keys"), testKey)
+	require.NoError(t, err)
+	// The namespace isn't at the start of the keys, so it can't be dropped.
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil).
+		WithNamespaceOffset(1))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	edb, err := Wrap(db, testKey, Options{NamespaceKey: ks.Key})
+	require.NoError(t, err)
+
+	key := func(ns uint64) []byte { return append([]byte("p"), nsKey(ns, "a")...) }
+	require.NoError(t, edb.Update(func(txn *Txn) error {
+		require.NoError(t, txn.Set(key(1), []byte("one")))
+		return txn.Set(key(2), []byte("two"))
+	}))
+	require.NoError(t, edb.Shred(ks, 1))
+
+	require.NoError(t, edb.View(func(txn *Txn) error {
+		_, err := txn.Get(key(1))
+		require.Equal(t, ErrKeyDestroyed, errors.Cause(err))
+		var keys [][]byte
+		require.NoError(t, txn.Iterate(nil, func(key, val []byte) error {
+			keys = append(keys, key)
+			return nil
+		}))
+		require.Equal(t, [][]byte{key(2)}, keys)
+		return nil
+	}))
+}
+
+func TestShredConcurrentGet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ks, err := OpenKeystore(filepath.Join(dir, "keys"), testKey)
+	require.NoError(t, err)
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil).
+		WithNamespaceOffset(1))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	edb, err := Wrap(db, testKey, Options{NamespaceKey: ks.Key})
+	require.NoError(t, err)
+
+	key := append([]byte("p"), nsKey(1, "a")...)
+	require.NoError(t, edb.Update(func(txn *Txn) error {
+		return txn.Set(key, []byte("one"))
+	}))
+
+	// The reader fetches the key of the namespace, and then waits for Shred to return before
+	// building its cipher.
+	fetched, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	reader, err := Wrap(db, testKey, Options{NamespaceKey: func(ns uint64) ([]byte, error) {
+		k, err := ks.Key(ns)
+		once.Do(func() {
+			close(fetched)
+			<-release
+		})
+		return k, err
+	}})
+	require.NoError(t, err)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- reader.View(func(txn *Txn) error {
+			_, err := txn.Get(key)
+			return err
+		})
+	}()
+	<-fetched
+	require.NoError(t, reader.Shred(ks, 1))
+	close(release)
+	<-errCh
+
+	// The cipher built from the fetched key isn't cached once Shred has returned.
+	require.NoError(t, reader.View(func(txn *Txn) error {
+		_, err := txn.Get(key)
+		require.Equal(t, ErrKeyDestroyed, errors.Cause(err))
+		return nil
+	}))
+}
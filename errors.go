@@ -18,7 +18,11 @@ package badger
 
 import (
 	"math"
+	"os"
+	"syscall"
 
+	"github.com/dgraph-io/badger/v3/vfs"
+	"github.com/dgraph-io/badger/v3/y"
 	"github.com/pkg/errors"
 )
 
@@ -32,6 +36,11 @@ var (
 	// range.
 	ErrValueLogSize = errors.New("Invalid ValueLogFileSize, must be in range [1MB, 2GB)")
 
+	// ErrAddressSpace is returned by Open on 32-bit platforms when the memory maps and caches
+	// allocated up front by the options wouldn't leave enough address space for the rest of the
+	// DB and the application.
+	ErrAddressSpace = errors.New("Options need too much address space for a 32-bit platform")
+
 	// ErrKeyNotFound is returned when key isn't found on a txn.Get.
 	ErrKeyNotFound = errors.New("Key not found")
 
@@ -91,10 +100,10 @@ var (
 	ErrZeroBandwidth = errors.New("Bandwidth must be greater than zero")
 
 	// ErrWindowsNotSupported is returned when opt.ReadOnly is used on Windows
-	ErrWindowsNotSupported = errors.New("Read-only mode is not supported on Windows")
+	ErrWindowsNotSupported = vfs.ErrWindowsNotSupported
 
 	// ErrPlan9NotSupported is returned when opt.ReadOnly is used on Plan 9
-	ErrPlan9NotSupported = errors.New("Read-only mode is not supported on Plan 9")
+	ErrPlan9NotSupported = vfs.ErrPlan9NotSupported
 
 	// ErrTruncateNeeded is returned when the value log gets corrupt, and requires truncation of
 	// corrupt data to allow Badger to run properly.
@@ -121,6 +130,114 @@ var (
 	// ErrGCInMemoryMode is returned when db.RunValueLogGC is called in in-memory mode.
 	ErrGCInMemoryMode = errors.New("Cannot run value log GC when DB is opened in InMemory mode")
 
+	// ErrReadOnlyDB is returned when a write or a value log GC is attempted on a DB opened in
+	// read-only mode.
+	ErrReadOnlyDB = errors.New("Writes are not allowed when DB is opened in read-only mode")
+
+	// ErrAppendOnly is returned when a write would delete, expire or overwrite a key in a DB
+	// opened in append-only mode.
+	ErrAppendOnly = errors.New("Only new keys can be written when DB is opened in append-only mode")
+
+	// ErrOpenRequiresUpgrade is returned by Open if the DB was written in an older on-disk format
+	// which this version of Badger can't read. Such a DB needs to be upgraded first.
+	ErrOpenRequiresUpgrade = errors.New("DB format is too old and requires an upgrade")
+
+	// ErrConditionFailed is returned by DB.WriteIf if any of the conditions doesn't hold.
+	ErrConditionFailed = errors.New("Write condition failed")
+
+	// ErrConflictDetectionDisabled is returned if an API which relies on conflict detection is
+	// called while Options.DetectConflicts is false.
+	ErrConflictDetectionDisabled = errors.New(
+		"Invalid API request. Not allowed to perform this action when DetectConflicts is false")
+
 	// ErrDBClosed is returned when a get operation is performed after closing the DB.
 	ErrDBClosed = errors.New("DB Closed")
+
+	// ErrIOFault is returned when reading a memory-mapped file faults, e.g. because the storage
+	// holding the file is unreachable.
+	ErrIOFault = errors.New("I/O fault while reading a memory-mapped file")
+
+	// ErrInvariantViolated is returned by DB.Validate if an invariant of the DB doesn't hold.
+	ErrInvariantViolated = errors.New("DB invariant violated")
+
+	// ErrShadowMismatch is returned by DB.VerifyShadow if a key doesn't have the value which was
+	// written last.
+	ErrShadowMismatch = errors.New("Key doesn't match the reference map")
+
+	// ErrNotCached is returned by reads limited to memory which would have to read the disk.
+	// See ReadOptions.
+	ErrNotCached = errors.New("Key isn't in memory")
+
+	// ErrDiskFull is returned when a write fails because the disk holding the DB is full.
+	ErrDiskFull = errors.New("No space left on the disk of the DB")
+
+	// ErrNoZSTD is returned by DB.TrainDictionaries if the DB doesn't compress with ZSTD.
+	ErrNoZSTD = errors.New("Dictionaries are only used with ZSTD compression. See " +
+		"Options.WithCompression and Options.WithValueCompression")
+
+	// ErrSnapshotExists is returned when creating a snapshot with the name of an existing one.
+	ErrSnapshotExists = errors.New("Snapshot already exists")
+
+	// ErrSnapshotNotFound is returned when using a snapshot which doesn't exist.
+	ErrSnapshotNotFound = errors.New("Snapshot not found")
+
+	// ErrMaintenanceWindow is returned by heavy maintenance requested outside of the maintenance
+	// windows. See Options.WithMaintenanceWindows.
+	ErrMaintenanceWindow = errors.New("Maintenance is only allowed in the maintenance windows")
+
+	// ErrIncompatibleOptions is returned by Open if the options are incompatible with the ones the
+	// DB was created with. See ReadCreationOptions.
+	ErrIncompatibleOptions = errors.New("Options are incompatible with the ones the DB was " +
+		"created with")
+
+	// ErrTxnPrepared is returned when preparing a transaction twice, or writing to a transaction
+	// which is prepared. See Txn.Prepare.
+	ErrTxnPrepared = errors.New("Transaction is prepared")
+
+	// ErrTxnNotPrepared is returned when rolling back a transaction which isn't prepared.
+	ErrTxnNotPrepared = errors.New("Transaction isn't prepared")
+
+	// ErrPreparedTxnExists is returned when preparing a transaction with the id of another one
+	// which is still prepared.
+	ErrPreparedTxnExists = errors.New("A transaction is already prepared with this id")
+
+	// ErrPreparedTxnNotFound is returned when resuming a prepared transaction which doesn't exist.
+	ErrPreparedTxnNotFound = errors.New("Prepared transaction not found")
 )
+
+// CorruptionError is the error returned when the data read from a file of the DB doesn't match its
+// checksum. It is usually wrapped, see AsCorruption.
+type CorruptionError = y.CorruptionError
+
+// AsCorruption returns the CorruptionError wrapped by err, if any. The errors returned by the DB
+// wrap the errors they are caused by, so that errors.Cause returns the sentinel errors above, and
+// errors.Is and errors.As match them.
+func AsCorruption(err error) (*CorruptionError, bool) {
+	for err != nil {
+		if e, ok := err.(*CorruptionError); ok {
+			return e, true
+		}
+		c, ok := err.(interface{ Cause() error })
+		if !ok {
+			return nil, false
+		}
+		err = c.Cause()
+	}
+	return nil, false
+}
+
+// diskFull returns err wrapped with ErrDiskFull if it is caused by the disk being full, and err
+// otherwise.
+func diskFull(err error) error {
+	cause := errors.Cause(err)
+	switch e := cause.(type) {
+	case *os.PathError:
+		cause = e.Err
+	case *os.SyscallError:
+		cause = e.Err
+	}
+	if cause != syscall.ENOSPC {
+		return err
+	}
+	return errors.Wrapf(ErrDiskFull, "%v", err)
+}
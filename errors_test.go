@@ -0,0 +1,52 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/badger/v3/y"
+)
+
+func TestAsCorruption(t *testing.T) {
+	corrupt := &CorruptionError{File: "000001.vlog", Offset: 20, Err: y.ErrChecksumMismatch}
+	err := errors.Wrap(y.Wrapf(corrupt, "while reading"), "Get")
+	got, ok := AsCorruption(err)
+	require.True(t, ok)
+	require.Equal(t, corrupt, got)
+	require.Equal(t, y.ErrChecksumMismatch, errors.Cause(err))
+	require.Contains(t, err.Error(), "corrupted data in 000001.vlog at offset 20")
+
+	_, ok = AsCorruption(y.Wrap(ErrKeyNotFound, "Get"))
+	require.False(t, ok)
+	_, ok = AsCorruption(nil)
+	require.False(t, ok)
+}
+
+func TestDiskFull(t *testing.T) {
+	full := y.Wrap(&os.PathError{Op: "truncate", Path: "000001.vlog", Err: syscall.ENOSPC}, "write")
+	require.Equal(t, ErrDiskFull, errors.Cause(diskFull(full)))
+	require.Contains(t, diskFull(full).Error(), "000001.vlog")
+
+	other := y.Wrap(&os.PathError{Op: "open", Path: "x", Err: os.ErrNotExist}, "write")
+	require.Equal(t, other, diskFull(other))
+}
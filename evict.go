@@ -0,0 +1,217 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
+)
+
+// evictionInterval is how often the DB checks if it has grown beyond Options.EvictionMaxSize.
+const evictionInterval = 10 * time.Second
+
+// prefixTracker keeps track of the last time a key prefix was read or written. It is used to
+// find the coldest prefix when the DB has to evict data.
+type prefixTracker struct {
+	sync.Mutex
+	prefixLen  int
+	lastAccess map[string]int64
+}
+
+func newPrefixTracker(prefixLen int) *prefixTracker {
+	return &prefixTracker{
+		prefixLen:  prefixLen,
+		lastAccess: make(map[string]int64),
+	}
+}
+
+// prefix returns the eviction prefix of the given key. It returns nil if the key is shorter than
+// the prefix, since such a key can't be dropped without dropping the longer keys starting with it.
+func (pt *prefixTracker) prefix(key []byte) []byte {
+	if len(key) < pt.prefixLen {
+		return nil
+	}
+	return key[:pt.prefixLen]
+}
+
+// touch marks the prefix of the key as accessed now. It is a no-op if eviction is disabled.
+func (pt *prefixTracker) touch(key []byte) {
+	if pt == nil {
+		return
+	}
+	prefix := pt.prefix(key)
+	if prefix == nil {
+		return
+	}
+	now := time.Now().UnixNano()
+	pt.Lock()
+	pt.lastAccess[string(prefix)] = now
+	pt.Unlock()
+}
+
+func (pt *prefixTracker) get(prefix []byte) int64 {
+	pt.Lock()
+	defer pt.Unlock()
+	return pt.lastAccess[string(prefix)]
+}
+
+func (pt *prefixTracker) remove(prefix []byte) {
+	pt.Lock()
+	defer pt.Unlock()
+	delete(pt.lastAccess, string(prefix))
+}
+
+// nextPrefix returns the smallest key which is greater than all the keys having the given prefix.
+// It returns nil if there is no such key.
+func nextPrefix(prefix []byte) []byte {
+	next := append([]byte{}, prefix...)
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i] != 0xff {
+			next[i]++
+			return next[:i+1]
+		}
+	}
+	return nil
+}
+
+// diskSize returns the number of bytes used by the LSM tree and the value log.
+func (db *DB) diskSize() int64 {
+	var size int64
+	for _, ti := range db.Tables() {
+		size += int64(ti.OnDiskSize)
+	}
+	if db.opt.InMemory {
+		return size
+	}
+	db.vlog.filesLock.RLock()
+	for _, lf := range db.vlog.filesMap {
+		size += int64(atomic.LoadUint32(&lf.size))
+	}
+	db.vlog.filesLock.RUnlock()
+	return size
+}
+
+// evictionCandidates returns the prefixes of all the keys in the DB, ordered from the coldest to
+// the hottest. Prefixes which haven't been accessed since the DB was opened are considered colder
+// than any accessed prefix. Keys shorter than the prefix are skipped.
+func (db *DB) evictionCandidates() ([][]byte, error) {
+	type candidate struct {
+		prefix     []byte
+		lastAccess int64
+	}
+	var candidates []candidate
+	err := db.View(func(txn *Txn) error {
+		opt := DefaultIteratorOptions
+		opt.PrefetchValues = false
+		itr := txn.NewIterator(opt)
+		defer itr.Close()
+
+		// Visit each prefix only once by seeking past all the keys having the same prefix.
+		for itr.Rewind(); itr.Valid(); {
+			prefix := db.evictTracker.prefix(itr.Item().Key())
+			if prefix == nil {
+				itr.Next()
+				continue
+			}
+			prefix = append([]byte{}, prefix...)
+			candidates = append(candidates, candidate{prefix, db.evictTracker.get(prefix)})
+			next := nextPrefix(prefix)
+			if next == nil {
+				break
+			}
+			itr.Seek(next)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].lastAccess < candidates[j].lastAccess
+	})
+	prefixes := make([][]byte, 0, len(candidates))
+	for _, c := range candidates {
+		prefixes = append(prefixes, c.prefix)
+	}
+	return prefixes, nil
+}
+
+// evict drops the coldest prefixes until the DB fits in Options.EvictionMaxSize again.
+func (db *DB) evict() error {
+	size := db.diskSize()
+	if size <= db.opt.EvictionMaxSize {
+		return nil
+	}
+	prefixes, err := db.evictionCandidates()
+	if err != nil {
+		return errors.Wrapf(err, "while looking for the prefixes to evict")
+	}
+	for _, prefix := range prefixes {
+		if size <= db.opt.EvictionMaxSize {
+			return nil
+		}
+		db.opt.Infof("DB size %d exceeds eviction budget %d. Evicting prefix: %#x",
+			size, db.opt.EvictionMaxSize, prefix)
+		if err := db.evictPrefix(prefix); err != nil {
+			return err
+		}
+		size = db.diskSize()
+	}
+	return nil
+}
+
+// evictPrefix drops all the keys having the given prefix and reclaims the space they took.
+func (db *DB) evictPrefix(prefix []byte) error {
+	if err := db.DropPrefixBlocking(prefix); err != nil {
+		return errors.Wrapf(err, "while evicting prefix: %#x", prefix)
+	}
+	db.evictTracker.remove(prefix)
+	if db.opt.InMemory {
+		return nil
+	}
+	// Reclaim the space taken by the dropped values.
+	for {
+		if err := db.RunValueLogGC(0.5); err != nil {
+			if err == ErrNoRewrite || err == ErrRejected {
+				return nil
+			}
+			return errors.Wrapf(err, "while running value log GC after eviction")
+		}
+	}
+}
+
+func (db *DB) runEviction(lc *z.Closer) {
+	defer lc.Done()
+
+	ticker := time.NewTicker(evictionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lc.HasBeenClosed():
+			return
+		case <-ticker.C:
+			if err := db.evict(); err != nil {
+				db.opt.Errorf("While evicting data: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextPrefix(t *testing.T) {
+	require.Equal(t, []byte("abd"), nextPrefix([]byte("abc")))
+	require.Equal(t, []byte("b"), nextPrefix([]byte{'a', 0xff, 0xff}))
+	require.Nil(t, nextPrefix([]byte{0xff, 0xff}))
+}
+
+func TestEvictColdestPrefix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opts := getTestOptions(dir).WithEvictionMaxSize(math.MaxInt64).WithEvictionPrefixLen(4)
+	db, err := Open(opts)
+	require.NoError(t, err)
+	for _, prefix := range []string{"aaa-", "bbb-", "ccc-"} {
+		for i := 0; i < 100; i++ {
+			txnSet(t, db, []byte(fmt.Sprintf("%s%03d", prefix, i)), []byte("value"), 0x00)
+		}
+	}
+	// Keys shorter than the prefix are never evicted.
+	txnSet(t, db, []byte("bb"), []byte("value"), 0x00)
+	// Reopen the DB so that the memtables get flushed to disk.
+	require.NoError(t, db.Close())
+	db, err = Open(opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	count := func(prefix string) int {
+		var n int
+		require.NoError(t, db.View(func(txn *Txn) error {
+			itr := txn.NewIterator(DefaultIteratorOptions)
+			defer itr.Close()
+			for itr.Seek([]byte(prefix)); itr.ValidForPrefix([]byte(prefix)); itr.Next() {
+				n++
+			}
+			return nil
+		}))
+		return n
+	}
+
+	// aaa- wasn't accessed after the DB was opened, so it is the coldest one.
+	for _, key := range []string{"ccc-000", "bbb-000"} {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			_, err := txn.Get([]byte(key))
+			return err
+		}))
+	}
+	prefixes, err := db.evictionCandidates()
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("aaa-"), []byte("ccc-"), []byte("bbb-")}, prefixes)
+
+	// Evicting the coldest prefix is enough to fit in the budget.
+	db.opt.EvictionMaxSize = db.diskSize() - 1
+	require.NoError(t, db.evict())
+	require.Equal(t, 0, count("aaa-"))
+	require.Equal(t, 100, count("bbb-"))
+	require.Equal(t, 100, count("ccc-"))
+
+	// All the prefixes are evicted in a single run if needed.
+	db.opt.EvictionMaxSize = 1
+	require.NoError(t, db.evict())
+	require.Equal(t, 0, count("bbb-"))
+	require.Equal(t, 0, count("ccc-"))
+	require.Equal(t, 1, count("bb"))
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+
+	"github.com/dgraph-io/badger/v3/vfs"
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/pkg/errors"
+)
+
+const (
+	// FormatFilename is the filename for the file which holds the on-disk format versions.
+	FormatFilename        = "FORMAT"
+	formatRewriteFilename = "FORMAT-REWRITE"
+	formatFileSize        = 20
+
+	// TableFormatVersion is the version of the SSTable format written by this version of Badger.
+	// Version 2 added the minimum version and the expiry time to the table index, and the
+	// compressed and delta encoded values.
+	TableFormatVersion uint32 = 2
+	// VlogFormatVersion is the version of the value log format written by this version of Badger.
+	// Version 2 added the compressed and delta encoded values.
+	VlogFormatVersion uint32 = 2
+
+	// minTableFormatVersion and minVlogFormatVersion are the oldest formats this version of
+	// Badger can read. Any change to the table or the value log format must bump the
+	// corresponding format version. The minimum version should only be bumped if the older
+	// format can no longer be read, in which case the files have to be upgraded.
+	minTableFormatVersion uint32 = 1
+	minVlogFormatVersion  uint32 = 1
+)
+
+// FormatVersion holds the versions of the on-disk formats used by a DB.
+type FormatVersion struct {
+	Manifest uint32
+	Table    uint32
+	Vlog     uint32
+}
+
+// CurrentFormatVersion returns the format versions written by this version of Badger.
+func CurrentFormatVersion() FormatVersion {
+	return FormatVersion{
+		Manifest: magicVersion,
+		Table:    TableFormatVersion,
+		Vlog:     VlogFormatVersion,
+	}
+}
+
+// Format of the FORMAT file:
+// +-----------+------------------+---------------+--------------+---------+
+// | Magic (4) | Manifest Ver (4) | Table Ver (4) | Vlog Ver (4) | CRC (4) |
+// +-----------+------------------+---------------+--------------+---------+
+func (fv FormatVersion) encode() []byte {
+	buf := make([]byte, formatFileSize)
+	copy(buf[0:4], magicText[:])
+	binary.BigEndian.PutUint32(buf[4:8], fv.Manifest)
+	binary.BigEndian.PutUint32(buf[8:12], fv.Table)
+	binary.BigEndian.PutUint32(buf[12:16], fv.Vlog)
+	binary.BigEndian.PutUint32(buf[16:20], crc32.Checksum(buf[:16], y.CastagnoliCrcTable))
+	return buf
+}
+
+func (fv *FormatVersion) decode(buf []byte) error {
+	if len(buf) != formatFileSize || !bytes.Equal(buf[0:4], magicText[:]) {
+		return errors.Errorf("%s file has bad magic", FormatFilename)
+	}
+	if crc32.Checksum(buf[:16], y.CastagnoliCrcTable) != y.BytesToU32(buf[16:20]) {
+		return errors.Errorf("%s file has bad checksum", FormatFilename)
+	}
+	fv.Manifest = y.BytesToU32(buf[4:8])
+	fv.Table = y.BytesToU32(buf[8:12])
+	fv.Vlog = y.BytesToU32(buf[12:16])
+	return nil
+}
+
+// check returns ErrOpenRequiresUpgrade if any of the formats is too old to be read, and an error
+// if any of them is newer than the ones this version of Badger knows about.
+func (fv FormatVersion) check() error {
+	cur := CurrentFormatVersion()
+	if fv.Manifest > cur.Manifest || fv.Table > cur.Table || fv.Vlog > cur.Vlog {
+		return errors.Errorf("DB has format %+v which is newer than the supported format %+v. "+
+			"Please use a newer version of Badger", fv, cur)
+	}
+	if fv.Manifest < cur.Manifest || fv.Table < minTableFormatVersion ||
+		fv.Vlog < minVlogFormatVersion {
+		return errors.Wrapf(ErrOpenRequiresUpgrade, "DB has format %+v, current format is %+v",
+			fv, cur)
+	}
+	return nil
+}
+
+// ReadFormatVersion reads the format versions of the DB in dir. It returns false if the DB
+// doesn't have a FORMAT file, which is the case for DBs created before format versioning was
+// introduced.
+func ReadFormatVersion(dir string) (FormatVersion, bool, error) {
+	return readFormatVersion(vfs.OS, dir)
+}
+
+func readFormatVersion(fs vfs.FS, dir string) (FormatVersion, bool, error) {
+	var fv FormatVersion
+	buf, err := vfs.ReadFile(fs, filepath.Join(dir, FormatFilename))
+	if os.IsNotExist(err) {
+		return fv, false, nil
+	}
+	if err != nil {
+		return fv, false, y.Wrapf(err, "while reading %s file", FormatFilename)
+	}
+	return fv, true, fv.decode(buf)
+}
+
+// WriteFormatVersion atomically replaces the FORMAT file in dir with the given versions.
+func WriteFormatVersion(dir string, fv FormatVersion) error {
+	return writeFormatVersion(vfs.OS, dir, fv)
+}
+
+func writeFormatVersion(fs vfs.FS, dir string, fv FormatVersion) error {
+	return rewriteFile(fs, dir, FormatFilename, formatRewriteFilename, fv.encode())
+}
+
+// checkFormatVersion verifies that the DB can be opened by this version of Badger. DBs without a
+// FORMAT file get one with the current versions, since their manifest has already been checked
+// to be of the current version. So do DBs with older formats which can still be read, before
+// anything is written in the current formats, so that older versions of Badger refuse them.
+func checkFormatVersion(opt Options) error {
+	if opt.InMemory {
+		return nil
+	}
+	fv, ok, err := readFormatVersion(opt.FS, opt.Dir)
+	if err != nil {
+		return err
+	}
+	if ok {
+		err := fv.check()
+		if opt.allowUpgrade && errors.Cause(err) == ErrOpenRequiresUpgrade {
+			opt.Infof("Opening DB with format %+v for upgrade", fv)
+			return nil
+		}
+		if err != nil || fv == CurrentFormatVersion() {
+			return err
+		}
+	}
+	if opt.ReadOnly {
+		return nil
+	}
+	if ok {
+		opt.Infof("Updating DB format from %+v to %+v", fv, CurrentFormatVersion())
+	}
+	return writeFormatVersion(opt.FS, opt.Dir, CurrentFormatVersion())
+}
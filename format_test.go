@@ -0,0 +1,200 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3/options"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opts := getTestOptions(dir)
+	db, err := Open(opts)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	fv, ok, err := ReadFormatVersion(dir)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, CurrentFormatVersion(), fv)
+
+	// A DB created before format versioning gets the current format.
+	require.NoError(t, os.Remove(filepath.Join(dir, FormatFilename)))
+	db, err = Open(opts)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	_, ok, err = ReadFormatVersion(dir)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// A DB with older formats which can still be read is opened, and gets the current format so
+	// that older versions of Badger refuse it, unless it is opened read-only.
+	readable := CurrentFormatVersion()
+	readable.Table, readable.Vlog = minTableFormatVersion, minVlogFormatVersion
+	require.NotEqual(t, CurrentFormatVersion(), readable)
+	require.NoError(t, WriteFormatVersion(dir, readable))
+	db, err = Open(opts.WithReadOnly(true))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	fv, _, err = ReadFormatVersion(dir)
+	require.NoError(t, err)
+	require.Equal(t, readable, fv)
+	db, err = Open(opts)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	fv, _, err = ReadFormatVersion(dir)
+	require.NoError(t, err)
+	require.Equal(t, CurrentFormatVersion(), fv)
+
+	old := CurrentFormatVersion()
+	old.Table = minTableFormatVersion - 1
+	require.NoError(t, WriteFormatVersion(dir, old))
+	_, err = Open(opts)
+	require.Equal(t, ErrOpenRequiresUpgrade, errors.Cause(err))
+
+	newer := CurrentFormatVersion()
+	newer.Vlog++
+	require.NoError(t, WriteFormatVersion(dir, newer))
+	_, err = Open(opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "newer than the supported format")
+}
+
+// setManifestVersion overwrites the version of the MANIFEST file in dir.
+func setManifestVersion(t *testing.T, dir string, version uint32) {
+	path := filepath.Join(dir, ManifestFilename)
+	buf, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	binary.BigEndian.PutUint32(buf[4:8], version)
+	require.NoError(t, ioutil.WriteFile(path, buf, 0600))
+}
+
+func TestFormatVersionOldManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opts := getTestOptions(dir)
+	db, err := Open(opts)
+	require.NoError(t, err)
+	txnSet(t, db, []byte("key"), []byte("val"), 0)
+	require.NoError(t, db.Close())
+
+	// A DB created before format versioning, with an older manifest.
+	require.NoError(t, os.Remove(filepath.Join(dir, FormatFilename)))
+	setManifestVersion(t, dir, magicVersion-1)
+	_, err = Open(opts)
+	require.Equal(t, ErrOpenRequiresUpgrade, errors.Cause(err))
+
+	// It can still be read to be upgraded.
+	opts.ReadOnly = true
+	opts.allowUpgrade = true
+	db, err = Open(opts)
+	require.NoError(t, err)
+	require.NoError(t, db.View(func(txn *Txn) error {
+		item, err := txn.Get([]byte("key"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("val"), getItemValue(t, item))
+		return nil
+	}))
+	require.NoError(t, db.Close())
+	_, ok, err := ReadFormatVersion(dir)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestFormatVersionCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	require.NoError(t, WriteFormatVersion(dir, CurrentFormatVersion()))
+	path := filepath.Join(dir, FormatFilename)
+	buf, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	buf[9] ^= 0xff
+	require.NoError(t, ioutil.WriteFile(path, buf, 0600))
+
+	_, _, err = ReadFormatVersion(dir)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "bad checksum")
+}
+
+func TestUpgrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+	outDir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(outDir)
+
+	opts := getTestOptions(dir)
+	db, err := Open(opts)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		txnSet(t, db, []byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("val%d", i)), 0x01)
+	}
+	txnDelete(t, db, []byte("key050"))
+	require.NoError(t, db.Close())
+
+	// Make it a DB created before format versioning, with an older manifest.
+	require.NoError(t, os.Remove(filepath.Join(dir, FormatFilename)))
+	setManifestVersion(t, dir, magicVersion-1)
+	manifest, err := ioutil.ReadFile(filepath.Join(dir, ManifestFilename))
+	require.NoError(t, err)
+	_, err = Open(opts)
+	require.Equal(t, ErrOpenRequiresUpgrade, errors.Cause(err))
+
+	require.NoError(t, Upgrade(opts, getTestOptions(outDir).WithCompression(options.ZSTD)))
+
+	// The original DB is left untouched.
+	_, ok, err := ReadFormatVersion(dir)
+	require.NoError(t, err)
+	require.False(t, ok)
+	after, err := ioutil.ReadFile(filepath.Join(dir, ManifestFilename))
+	require.NoError(t, err)
+	require.Equal(t, manifest, after)
+	fv, ok, err := ReadFormatVersion(outDir)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, CurrentFormatVersion(), fv)
+
+	db, err = Open(getTestOptions(outDir))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	require.NoError(t, db.View(func(txn *Txn) error {
+		_, err := txn.Get([]byte("key050"))
+		require.Equal(t, ErrKeyNotFound, err)
+		item, err := txn.Get([]byte("key099"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("val99"), getItemValue(t, item))
+		require.Equal(t, byte(0x01), item.UserMeta())
+		return nil
+	}))
+}
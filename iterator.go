@@ -160,15 +160,39 @@ func (item *Item) yieldItemValue() ([]byte, func(), error) {
 	}
 
 	if (item.meta & bitValuePointer) == 0 {
+		if item.meta&bitDelta > 0 {
+			val, err := item.txn.db.undelta(item.txn, key, item.vptr)
+			return val, nil, y.Wrapf(err, "key: %q, version: %d", key, item.version)
+		}
+		if item.meta&bitCompressed > 0 {
+			val, err := decompressValue(item.txn.db.dicts, item.slice, item.vptr)
+			return val, nil, y.Wrapf(err, "key: %q", key)
+		}
 		val := item.slice.Resize(len(item.vptr))
 		copy(val, item.vptr)
 		return val, nil, nil
 	}
 
+	if item.txn.readOpt.Tier.inMemory() {
+		return nil, nil, ErrNotCached
+	}
 	var vp valuePointer
 	vp.Decode(item.vptr)
 	db := item.txn.db
-	result, cb, err := db.vlog.Read(vp, item.slice)
+	if item.txn.readOpt.Trace != nil || db.opt.MetricsEnabled {
+		item.txn.traceRead(&ReadTrace{ValueLogReads: 1})
+	}
+	var result []byte
+	var cb func()
+	err := db.retryIO(func() error {
+		var err error
+		verify := db.opt.VerifyValueChecksum || item.txn.readOpt.VerifyChecksum
+		if result, cb, err = db.vlog.read(vp, item.slice, verify); err != nil {
+			runCallback(cb)
+			cb = nil
+		}
+		return err
+	})
 	if err != nil {
 		db.opt.Logger.Errorf("Unable to read: Key: %v, Version : %v, meta: %v, userMeta: %v"+
 			" Error: %v", key, item.version, item.meta, item.userMeta, err)
@@ -231,6 +255,12 @@ func (item *Item) EstimatedSize() int64 {
 		return 0
 	}
 	if (item.meta & bitValuePointer) == 0 {
+		switch {
+		case item.meta&bitDelta > 0:
+			return int64(len(item.key) + deltaValueSize(item.vptr))
+		case item.meta&bitCompressed > 0:
+			return int64(len(item.key) + uncompressedValueSize(item.vptr))
+		}
 		return int64(len(item.key) + len(item.vptr))
 	}
 	var vp valuePointer
@@ -253,6 +283,12 @@ func (item *Item) ValueSize() int64 {
 		return 0
 	}
 	if (item.meta & bitValuePointer) == 0 {
+		switch {
+		case item.meta&bitDelta > 0:
+			return int64(deltaValueSize(item.vptr))
+		case item.meta&bitCompressed > 0:
+			return int64(uncompressedValueSize(item.vptr))
+		}
 		return int64(len(item.vptr))
 	}
 	var vp valuePointer
@@ -331,6 +367,13 @@ type IteratorOptions struct {
 	prefixIsKey bool   // If set, use the prefix for bloom filter lookup.
 	Prefix      []byte // Only iterate over this given prefix.
 	SinceTs     uint64 // Only read data that has version > SinceTs.
+
+	// Filter, if set, is called with the key and the UserMeta of every item before its value is
+	// read. Items for which it returns false are skipped, so their values are never fetched from
+	// the value log. The key is only valid for the duration of the call.
+	Filter func(key []byte, userMeta byte) bool
+
+	readOpt ReadOptions // Set from the options of the txn. See Txn.SetReadOptions.
 }
 
 func (opt *IteratorOptions) compareToPrefix(key []byte) int {
@@ -479,6 +522,7 @@ func (txn *Txn) NewIterator(opt IteratorOptions) *Iterator {
 
 	// Keep track of the number of active iterators.
 	atomic.AddInt32(&txn.numIterators, 1)
+	txn.db.evictTracker.touch(opt.Prefix)
 
 	// TODO: If Prefix is set, only pick those memtables which have keys with
 	// the prefix.
@@ -492,7 +536,10 @@ func (txn *Txn) NewIterator(opt IteratorOptions) *Iterator {
 	for i := 0; i < len(tables); i++ {
 		iters = append(iters, tables[i].sl.NewUniIterator(opt.Reverse))
 	}
-	iters = append(iters, txn.db.lc.iterators(&opt)...) // This will increment references.
+	opt.readOpt = txn.readOpt
+	if opt.readOpt.Tier != ReadMemtables {
+		iters = append(iters, txn.db.lc.iterators(&opt)...) // This will increment references.
+	}
 	res := &Iterator{
 		txn:    txn,
 		iitr:   table.NewMergeIterator(iters, opt.Reverse),
@@ -620,12 +667,24 @@ func (it *Iterator) parseItem() bool {
 	mi := it.iitr
 	key := mi.Key()
 
-	setItem := func(item *Item) {
+	setItem := func(item *Item) bool {
+		if it.opt.Filter != nil && !it.opt.Filter(item.key, item.userMeta) {
+			return false
+		}
+		if it.opt.PrefetchValues {
+			item.wg.Add(1)
+			go func() {
+				// FIXME we are not handling errors here.
+				item.prefetchValue()
+				item.wg.Done()
+			}()
+		}
 		if it.item == nil {
 			it.item = item
 		} else {
 			it.data.push(item)
 		}
+		return true
 	}
 
 	isInternalKey := bytes.HasPrefix(key, badgerPrefix)
@@ -654,9 +713,8 @@ func (it *Iterator) parseItem() bool {
 		// whether the key was deleted.
 		item := it.newItem()
 		it.fill(item)
-		setItem(item)
 		mi.Next()
-		return true
+		return setItem(item)
 	}
 
 	// If iterating in forward direction, then just checking the last key against current key would
@@ -689,8 +747,7 @@ FILL:
 
 	mi.Next()                           // Advance but no fill item yet.
 	if !it.opt.Reverse || !mi.Valid() { // Forward direction, or invalid.
-		setItem(item)
-		return true
+		return setItem(item)
 	}
 
 	// Reverse direction.
@@ -701,8 +758,7 @@ FILL:
 		goto FILL
 	}
 	// Ignore the next candidate. Return the current one.
-	setItem(item)
-	return true
+	return setItem(item)
 }
 
 func (it *Iterator) fill(item *Item) {
@@ -716,14 +772,6 @@ func (it *Iterator) fill(item *Item) {
 
 	item.vptr = y.SafeCopy(item.vptr, vs.Value)
 	item.val = nil
-	if it.opt.PrefetchValues {
-		item.wg.Add(1)
-		go func() {
-			// FIXME we are not handling errors here.
-			item.prefetchValue()
-			item.wg.Done()
-		}()
-	}
 }
 
 func (it *Iterator) prefetch() {
@@ -124,6 +124,61 @@ func TestPickSortTables(t *testing.T) {
 	require.Equal(t, y.ParseKey(filtered[0].Biggest()), []byte("abc"))
 }
 
+func TestIteratorFilter(t *testing.T) {
+	opt := getTestOptions("")
+	opt.ValueThreshold = 32
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		val := bytes.Repeat([]byte("v"), 64)
+		for i := 0; i < 20; i++ {
+			txnSet(t, db, []byte(fmt.Sprintf("key%02d", i)), val, byte(i%2))
+		}
+		// Newer versions with a different UserMeta must be the ones being filtered.
+		txnSet(t, db, []byte("key00"), val, 1)
+		txnSet(t, db, []byte("key01"), val, 0)
+		txnDelete(t, db, []byte("key03"))
+
+		iterate := func(iopt IteratorOptions) []string {
+			var keys []string
+			require.NoError(t, db.View(func(txn *Txn) error {
+				itr := txn.NewIterator(iopt)
+				defer itr.Close()
+				for itr.Rewind(); itr.Valid(); itr.Next() {
+					item := itr.Item()
+					require.Equal(t, byte(1), item.UserMeta())
+					got, err := item.ValueCopy(nil)
+					require.NoError(t, err)
+					require.Equal(t, val, got)
+					keys = append(keys, string(item.Key()))
+				}
+				return nil
+			}))
+			return keys
+		}
+
+		iopt := DefaultIteratorOptions
+		iopt.Filter = func(key []byte, userMeta byte) bool { return userMeta == 1 }
+		want := []string{"key00", "key05", "key07", "key09", "key11", "key13", "key15",
+			"key17", "key19"}
+		require.Equal(t, want, iterate(iopt))
+
+		iopt.Reverse = true
+		got := iterate(iopt)
+		for i, j := 0, len(got)-1; i < j; i, j = i+1, j-1 {
+			got[i], got[j] = got[j], got[i]
+		}
+		require.Equal(t, want, got)
+
+		iopt = DefaultIteratorOptions
+		iopt.Prefix = []byte("key1")
+		iopt.PrefetchValues = false
+		iopt.Filter = func(key []byte, userMeta byte) bool {
+			require.True(t, bytes.HasPrefix(key, []byte("key1")))
+			return userMeta == 1
+		}
+		require.Equal(t, want[4:], iterate(iopt))
+	})
+}
+
 func TestIterateSinceTs(t *testing.T) {
 	bkey := func(i int) []byte {
 		return []byte(fmt.Sprintf("%04d", i))
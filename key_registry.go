@@ -29,6 +29,7 @@ import (
 	"time"
 
 	"github.com/dgraph-io/badger/v3/pb"
+	"github.com/dgraph-io/badger/v3/vfs"
 	"github.com/dgraph-io/badger/v3/y"
 	"github.com/pkg/errors"
 )
@@ -49,7 +50,7 @@ type KeyRegistry struct {
 	dataKeys    map[uint64]*pb.DataKey
 	lastCreated int64 //lastCreated is the timestamp(seconds) of the last data key generated.
 	nextKeyID   uint64
-	fp          *os.File
+	fp          vfs.File
 	opt         KeyRegistryOptions
 }
 
@@ -59,6 +60,7 @@ type KeyRegistryOptions struct {
 	EncryptionKey                 []byte
 	EncryptionKeyRotationDuration time.Duration
 	InMemory                      bool
+	FS                            vfs.FS // Defaults to vfs.OS.
 }
 
 // newKeyRegistry returns KeyRegistry.
@@ -86,6 +88,9 @@ func OpenKeyRegistry(opt KeyRegistryOptions) (*KeyRegistry, error) {
 	if opt.InMemory {
 		return newKeyRegistry(opt), nil
 	}
+	if opt.FS == nil {
+		opt.FS = vfs.OS
+	}
 	path := filepath.Join(opt.Dir, KeyRegistryFileName)
 	var flags y.Flags
 	if opt.ReadOnly {
@@ -93,7 +98,7 @@ func OpenKeyRegistry(opt KeyRegistryOptions) (*KeyRegistry, error) {
 	} else {
 		flags |= y.Sync
 	}
-	fp, err := y.OpenExistingFile(path, flags)
+	fp, err := openExistingFile(opt.FS, path, flags)
 	// OpenExistingFile just open file.
 	// So checking whether the file exist or not. If not
 	// We'll create new keyregistry.
@@ -107,7 +112,7 @@ func OpenKeyRegistry(opt KeyRegistryOptions) (*KeyRegistry, error) {
 		if err := WriteKeyRegistry(kr, opt); err != nil {
 			return nil, y.Wrapf(err, "Error while writing key registry.")
 		}
-		fp, err = y.OpenExistingFile(path, flags)
+		fp, err = openExistingFile(opt.FS, path, flags)
 		if err != nil {
 			return nil, y.Wrapf(err, "Error while opening newly created key registry.")
 		}
@@ -132,14 +137,14 @@ func OpenKeyRegistry(opt KeyRegistryOptions) (*KeyRegistry, error) {
 // keyRegistryIterator reads all the datakey from the key registry
 type keyRegistryIterator struct {
 	encryptionKey []byte
-	fp            *os.File
+	fp            vfs.File
 	// lenCrcBuf contains crc buf and data length to move forward.
 	lenCrcBuf [8]byte
 }
 
 // newKeyRegistryIterator returns iterator which will allow you to iterate
 // over the data key of the key registry.
-func newKeyRegistryIterator(fp *os.File, encryptionKey []byte) (*keyRegistryIterator, error) {
+func newKeyRegistryIterator(fp vfs.File, encryptionKey []byte) (*keyRegistryIterator, error) {
 	return &keyRegistryIterator{
 		encryptionKey: encryptionKey,
 		fp:            fp,
@@ -148,7 +153,7 @@ func newKeyRegistryIterator(fp *os.File, encryptionKey []byte) (*keyRegistryIter
 }
 
 // validRegistry checks that given encryption key is valid or not.
-func validRegistry(fp *os.File, encryptionKey []byte) error {
+func validRegistry(fp vfs.File, encryptionKey []byte) error {
 	iv := make([]byte, aes.BlockSize)
 	var err error
 	if _, err = fp.Read(iv); err != nil {
@@ -209,7 +214,7 @@ func (kri *keyRegistryIterator) next() (*pb.DataKey, error) {
 }
 
 // readKeyRegistry will read the key registry file and build the key registry struct.
-func readKeyRegistry(fp *os.File, opt KeyRegistryOptions) (*KeyRegistry, error) {
+func readKeyRegistry(fp vfs.File, opt KeyRegistryOptions) (*KeyRegistry, error) {
 	itr, err := newKeyRegistryIterator(fp, opt.EncryptionKey)
 	if err != nil {
 		return nil, err
@@ -269,9 +274,12 @@ func WriteKeyRegistry(reg *KeyRegistry, opt KeyRegistryOptions) error {
 			return y.Wrapf(err, "Error while storing datakey in WriteKeyRegistry")
 		}
 	}
+	if opt.FS == nil {
+		opt.FS = vfs.OS
+	}
 	tmpPath := filepath.Join(opt.Dir, KeyRegistryRewriteFileName)
 	// Open temporary file to write the data and do atomic rename.
-	fp, err := y.OpenTruncFile(tmpPath, true)
+	fp, err := openTruncFile(opt.FS, tmpPath, true)
 	if err != nil {
 		return y.Wrapf(err, "Error while opening tmp file in WriteKeyRegistry")
 	}
@@ -288,11 +296,11 @@ func WriteKeyRegistry(reg *KeyRegistry, opt KeyRegistryOptions) error {
 		return y.Wrapf(err, "Error while closing tmp file in WriteKeyRegistry")
 	}
 	// Rename to the original file.
-	if err = os.Rename(tmpPath, filepath.Join(opt.Dir, KeyRegistryFileName)); err != nil {
+	if err = opt.FS.Rename(tmpPath, filepath.Join(opt.Dir, KeyRegistryFileName)); err != nil {
 		return y.Wrapf(err, "Error while renaming file in WriteKeyRegistry")
 	}
 	// Sync Dir.
-	return syncDir(opt.Dir)
+	return opt.FS.SyncDir(opt.Dir)
 }
 
 // DataKey returns datakey of the given key id.
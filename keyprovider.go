@@ -0,0 +1,55 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"context"
+	"time"
+)
+
+// KeyProvider supplies the encryption key of a DB. The encryption key is only used to encrypt the
+// data keys, which encrypt the data and are rotated by Badger itself every
+// Options.EncryptionKeyRotationDuration. See Options.WithKeyProvider.
+type KeyProvider interface {
+	// EncryptionKey returns the current encryption key. It must be 16, 24 or 32 bytes long.
+	EncryptionKey(ctx context.Context) ([]byte, error)
+}
+
+// RotateEncryptionKey re-encrypts the data keys of the DB in dir with the key supplied by newKey.
+// oldKey must supply the key the DB is currently encrypted with. The DB must not be open while its
+// key is being rotated.
+func RotateEncryptionKey(ctx context.Context, dir string, oldKey, newKey KeyProvider) error {
+	old, err := oldKey.EncryptionKey(ctx)
+	if err != nil {
+		return err
+	}
+	opt := KeyRegistryOptions{
+		Dir:                           dir,
+		ReadOnly:                      true,
+		EncryptionKey:                 old,
+		EncryptionKeyRotationDuration: 10 * 24 * time.Hour,
+	}
+	kr, err := OpenKeyRegistry(opt)
+	if err != nil {
+		return err
+	}
+	defer kr.Close()
+	if opt.EncryptionKey, err = newKey.EncryptionKey(ctx); err != nil {
+		return err
+	}
+	return WriteKeyRegistry(kr, opt)
+}
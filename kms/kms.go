@@ -0,0 +1,173 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package kms provides implementations of badger.KeyProvider, which fetch the encryption key of a
+// DB from an environment variable, a file, HashiCorp Vault or AWS KMS.
+package kms
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+func checkKey(key []byte) ([]byte, error) {
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, badger.ErrInvalidEncryptionKey
+}
+
+// Env fetches the key from the environment variable with the given name. The variable must hold
+// the base64 encoded key.
+type Env string
+
+var _ badger.KeyProvider = Env("")
+
+// EncryptionKey implements badger.KeyProvider.
+func (e Env) EncryptionKey(_ context.Context) ([]byte, error) {
+	val, ok := os.LookupEnv(string(e))
+	if !ok {
+		return nil, errors.Errorf("environment variable %s is not set", string(e))
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(val))
+	if err != nil {
+		return nil, errors.Wrapf(err, "while decoding the key in %s", string(e))
+	}
+	return checkKey(key)
+}
+
+// File fetches the key from the file at the given path. The file must hold the raw key, as used
+// by the badger command line tool.
+type File string
+
+var _ badger.KeyProvider = File("")
+
+// EncryptionKey implements badger.KeyProvider.
+func (f File) EncryptionKey(_ context.Context) ([]byte, error) {
+	key, err := ioutil.ReadFile(string(f))
+	if err != nil {
+		return nil, errors.Wrapf(err, "while reading the key file")
+	}
+	return checkKey(key)
+}
+
+// Vault fetches the key from a secret of the key/value version 2 secrets engine of HashiCorp
+// Vault. The secret field must hold the base64 encoded key.
+type Vault struct {
+	// Addr is the address of the Vault server, like https://vault.example.com:8200.
+	Addr string
+	// Token is the Vault token used to read the secret.
+	Token string
+	// Mount is the path the secrets engine is mounted at. Defaults to "secret".
+	Mount string
+	// Path is the path of the secret within the secrets engine.
+	Path string
+	// Field is the field of the secret holding the key. Defaults to "key".
+	Field string
+	// Client is the HTTP client used to talk to Vault. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+var _ badger.KeyProvider = (*Vault)(nil)
+
+// EncryptionKey implements badger.KeyProvider.
+func (v *Vault) EncryptionKey(ctx context.Context) ([]byte, error) {
+	mount, field, client := v.Mount, v.Field, v.Client
+	if mount == "" {
+		mount = "secret"
+	}
+	if field == "" {
+		field = "key"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	url := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimRight(v.Addr, "/"),
+		strings.Trim(mount, "/"), strings.Trim(v.Path, "/"))
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-Vault-Token", v.Token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while reading the key from Vault")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Vault returned status %s for %s", resp.Status, url)
+	}
+
+	var secret struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, errors.Wrapf(err, "while decoding the Vault response")
+	}
+	val, ok := secret.Data.Data[field]
+	if !ok {
+		return nil, errors.Errorf("Vault secret %s has no field %s", v.Path, field)
+	}
+	key, err := base64.StdEncoding.DecodeString(val)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while decoding the key from Vault")
+	}
+	return checkKey(key)
+}
+
+// Decrypter decrypts a ciphertext using a key held by a KMS. The Decrypt call of the AWS SDK's KMS
+// client can be adapted to it with a few lines of code, which keeps the AWS SDK out of Badger's
+// dependencies.
+type Decrypter interface {
+	Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error)
+}
+
+// AWSKMS fetches the key by decrypting an encrypted data key with AWS KMS. The encrypted data key
+// is created once with the GenerateDataKey call of AWS KMS, and stored along with the DB, e.g. in
+// a file or in the configuration of the application. The plaintext key never has to be stored.
+type AWSKMS struct {
+	// Client decrypts the data key, usually by calling the Decrypt API of AWS KMS.
+	Client Decrypter
+	// EncryptedKey is the CiphertextBlob returned by GenerateDataKey.
+	EncryptedKey []byte
+}
+
+var _ badger.KeyProvider = (*AWSKMS)(nil)
+
+// EncryptionKey implements badger.KeyProvider.
+func (a *AWSKMS) EncryptionKey(ctx context.Context) ([]byte, error) {
+	if a.Client == nil {
+		return nil, errors.New("AWSKMS has no client")
+	}
+	key, err := a.Client.Decrypt(ctx, a.EncryptedKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while decrypting the key with AWS KMS")
+	}
+	return checkKey(key)
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	ctx     = context.Background()
+	testKey = bytes.Repeat([]byte("k"), 32)
+)
+
+func TestEnv(t *testing.T) {
+	const name = "BADGER_KMS_TEST_KEY"
+	_, err := Env(name).EncryptionKey(ctx)
+	require.Error(t, err)
+
+	require.NoError(t, os.Setenv(name, base64.StdEncoding.EncodeToString(testKey)))
+	defer os.Unsetenv(name)
+	key, err := Env(name).EncryptionKey(ctx)
+	require.NoError(t, err)
+	require.Equal(t, testKey, key)
+
+	require.NoError(t, os.Setenv(name, base64.StdEncoding.EncodeToString([]byte("short"))))
+	_, err = Env(name).EncryptionKey(ctx)
+	require.Equal(t, badger.ErrInvalidEncryptionKey, err)
+}
+
+func TestVault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/badger" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"data": {"data": {"key": %q}}}`,
+			base64.StdEncoding.EncodeToString(testKey))
+	}))
+	defer srv.Close()
+
+	v := &Vault{Addr: srv.URL, Token: "token", Path: "badger"}
+	key, err := v.EncryptionKey(ctx)
+	require.NoError(t, err)
+	require.Equal(t, testKey, key)
+
+	v.Field = "other"
+	_, err = v.EncryptionKey(ctx)
+	require.Error(t, err)
+
+	v = &Vault{Addr: srv.URL, Token: "wrong", Path: "badger"}
+	_, err = v.EncryptionKey(ctx)
+	require.Error(t, err)
+}
+
+type fakeKMS struct{}
+
+func (fakeKMS) Decrypt(_ context.Context, ciphertext []byte) ([]byte, error) {
+	if !bytes.HasPrefix(ciphertext, []byte("encrypted:")) {
+		return nil, fmt.Errorf("bad ciphertext")
+	}
+	return ciphertext[len("encrypted:"):], nil
+}
+
+func TestAWSKMS(t *testing.T) {
+	a := &AWSKMS{Client: fakeKMS{}, EncryptedKey: append([]byte("encrypted:"), testKey...)}
+	key, err := a.EncryptionKey(ctx)
+	require.NoError(t, err)
+	require.Equal(t, testKey, key)
+
+	a.EncryptedKey = testKey
+	_, err = a.EncryptionKey(ctx)
+	require.Error(t, err)
+}
+
+func TestFileWithDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	oldPath, newPath := filepath.Join(dir, "old.key"), filepath.Join(dir, "new.key")
+	require.NoError(t, ioutil.WriteFile(oldPath, testKey, 0600))
+	require.NoError(t, ioutil.WriteFile(newPath, bytes.Repeat([]byte("n"), 32), 0600))
+
+	dbDir := filepath.Join(dir, "db")
+	open := func(p badger.KeyProvider) (*badger.DB, error) {
+		return badger.Open(badger.DefaultOptions(dbDir).WithKeyProvider(p).WithLogger(nil).
+			WithIndexCacheSize(1 << 20))
+	}
+	db, err := open(File(oldPath))
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("key"), []byte("val"))
+	}))
+	require.NoError(t, db.Close())
+
+	require.NoError(t, badger.RotateEncryptionKey(ctx, dbDir, File(oldPath), File(newPath)))
+	_, err = open(File(oldPath))
+	require.Error(t, err)
+
+	db, err = open(File(newPath))
+	require.NoError(t, err)
+	require.NoError(t, db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte("key"))
+		return err
+	}))
+	require.NoError(t, db.Close())
+
+	// The options of an open DB can be used to open it again.
+	db, err = badger.Open(db.Opts())
+	require.NoError(t, err)
+	require.Nil(t, db.Opts().KeyProvider)
+	require.NoError(t, db.Close())
+
+	_, err = badger.Open(badger.DefaultOptions(dbDir).WithKeyProvider(File(newPath)).
+		WithEncryptionKey(testKey))
+	require.Error(t, err)
+}
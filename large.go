@@ -0,0 +1,111 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"sort"
+	"sync/atomic"
+
+	humanize "github.com/dustin/go-humanize"
+
+	"github.com/dgraph-io/badger/v3/table"
+	"github.com/dgraph-io/badger/v3/y"
+)
+
+// SetLarge lifts the limit on the size of the transaction, which otherwise fails with ErrTxnTooBig
+// once its writes don't fit in a fraction of a memtable. A large transaction whose writes would
+// fail with ErrTxnTooBig is committed by building them into a level 0 table directly, rather than
+// going through the value log and many memtable flushes. The table is added to the LSM tree in a
+// single MANIFEST change, so the transaction stays atomic across crashes.
+//
+// The writes of a large transaction are held in memory until it commits, and its table is built
+// in memory too, so the transaction must fit in memory and in a table of at most 4GB. Values are
+// stored in the table, whatever the value threshold.
+func (txn *Txn) SetLarge() {
+	txn.large = true
+}
+
+// tooBig tells if a batch of count entries of the given size is too big to be written at once to
+// the memtable.
+func (db *DB) tooBig(count, size int64) bool {
+	return count >= db.opt.maxBatchCount || size >= db.opt.maxBatchSize
+}
+
+// writeLevel0 writes the entries of a large transaction into a new level 0 table. The keys of the
+// entries have their versions set.
+func (db *DB) writeLevel0(entries []*Entry) error {
+	if db.opt.ReadOnly {
+		return ErrReadOnlyDB
+	}
+	if atomic.LoadInt32(&db.blockWrites) == 1 {
+		return ErrBlockedWrites
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return y.CompareKeys(entries[i].Key, entries[j].Key) < 0
+	})
+
+	bopts := buildTableOptions(db)
+	bopts.BloomFalsePositive = db.opt.bloomFalsePositive(0)
+	builder := table.NewTableBuilder(bopts)
+	defer builder.Close()
+	for _, e := range entries {
+		vs := y.ValueStruct{
+			Value:     e.Value,
+			Meta:      e.meta &^ bitValuePointer,
+			UserMeta:  e.UserMeta,
+			ExpiresAt: e.ExpiresAt,
+		}
+		builder.Add(e.Key, db.compressValue(e.Key, vs), 0)
+	}
+	db.stats.addKeyStats(builder)
+
+	fileID := db.lc.reserveFileID()
+	var tbl *table.Table
+	var err error
+	if db.opt.InMemory {
+		tbl, err = table.OpenInMemoryTable(builder.Finish(), fileID, &bopts)
+	} else {
+		tbl, err = table.CreateTable(table.NewFilename(fileID, db.opt.Dir), builder)
+	}
+	if err != nil {
+		return diskFull(y.Wrap(err, "while creating the table of a large transaction"))
+	}
+	defer func() { _ = tbl.DecrRef() }()
+	if !db.opt.InMemory {
+		// The table must be visible in the directory before the MANIFEST refers to it.
+		if err := db.syncDir(db.opt.Dir); err != nil {
+			return y.Wrap(err, "while syncing the directory of the table")
+		}
+		if err := db.uploadTables([]*table.Table{tbl}); err != nil {
+			return err
+		}
+	}
+
+	if s := db.shadow; s != nil {
+		s.Lock()
+		defer s.Unlock()
+		s.record(entries)
+	}
+	if err := db.lc.addLevel0Table(tbl); err != nil {
+		return err
+	}
+	db.events.add("Wrote a large transaction into L0 table %d (%s)",
+		tbl.ID(), humanize.IBytes(uint64(tbl.Size())))
+	db.pub.sendUpdates([]*request{{Entries: entries}})
+	y.NumPutsAdd(db.opt.MetricsEnabled, int64(len(entries)))
+	return nil
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLargeTxn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opt := getTestOptions(dir).WithMemTableSize(1 << 20).WithValueThreshold(1 << 10)
+	db, err := Open(opt)
+	require.NoError(t, err)
+
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%05d", i)) }
+	val := func(i int) []byte { return []byte(fmt.Sprintf("%01000d", i)) }
+	const n = 5000
+
+	// A transaction doesn't fit in a memtable unless it is large.
+	txn := db.NewTransaction(true)
+	for i := 0; err == nil && i < n; i++ {
+		err = txn.Set(key(i), val(i))
+	}
+	require.Equal(t, ErrTxnTooBig, err)
+	txn.Discard()
+
+	txnSet(t, db, key(0), []byte("old"), 0)
+	reader := db.NewTransaction(true)
+	_, err = reader.Get(key(1))
+	require.Equal(t, ErrKeyNotFound, err)
+
+	txn = db.NewTransaction(true)
+	txn.SetLarge()
+	for i := 0; i < n; i++ {
+		require.NoError(t, txn.Set(key(i), val(i)))
+	}
+	require.NoError(t, txn.Delete(key(n-1)))
+	require.NoError(t, txn.Commit())
+
+	// The transaction went into a table of its own.
+	var l0 int
+	for _, ti := range db.Tables() {
+		if ti.Level == 0 {
+			l0++
+			require.Equal(t, uint32(n), ti.KeyCount)
+		}
+	}
+	require.Equal(t, 1, l0)
+
+	// A transaction which read a key written by the large transaction conflicts.
+	require.NoError(t, reader.Set(key(1), []byte("conflict")))
+	require.Equal(t, ErrConflict, reader.Commit())
+
+	check := func(db *DB) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for i := 0; i < n-1; i++ {
+				item, err := txn.Get(key(i))
+				require.NoError(t, err)
+				require.Equal(t, val(i), getItemValue(t, item))
+			}
+			_, err := txn.Get(key(n - 1))
+			require.Equal(t, ErrKeyNotFound, err)
+			return nil
+		}))
+	}
+	check(db)
+
+	// Later writes take precedence over the large transaction.
+	txnSet(t, db, key(0), []byte("new"), 0)
+	require.NoError(t, db.View(func(txn *Txn) error {
+		item, err := txn.Get(key(0))
+		require.NoError(t, err)
+		require.Equal(t, []byte("new"), getItemValue(t, item))
+		return nil
+	}))
+	txnSet(t, db, key(0), val(0), 0)
+	require.NoError(t, db.Close())
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	check(db)
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v3/vfs"
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
+)
+
+// dirLock is a lock on a directory of the DB, held while the DB is open.
+type dirLock interface {
+	release() error
+}
+
+// lockDir locks the directory dir, using a lease in network filesystem mode and flock otherwise.
+func lockDir(dir string, opt Options) (dirLock, error) {
+	if opt.NetworkFS {
+		l, err := acquireLease(dir, opt)
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+	c, err := opt.FS.Lock(dir, lockFile, opt.ReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	return closerLock{c}, nil
+}
+
+// closerLock is a lock returned by vfs.FS.Lock.
+type closerLock struct {
+	io.Closer
+}
+
+func (l closerLock) release() error {
+	return l.Close()
+}
+
+const leaseFile = "LEASE"
+
+var (
+	// leaseDuration is how long a lease is valid without being renewed. Leases are renewed every
+	// third of it.
+	leaseDuration = 30 * time.Second
+	// leaseSettleTime is how long to wait after writing a new lease before checking that another
+	// process didn't take it concurrently.
+	leaseSettleTime = 100 * time.Millisecond
+)
+
+// lease replaces flock on network filesystems, where flock is often unsupported or unreliable. The
+// lease file holds the owner of the lease and its expiry time, and is renewed periodically while
+// the DB is open. A lease which expired, e.g. because its owner crashed, can be taken over. This
+// relies on the clocks of the hosts sharing the filesystem being roughly synchronized.
+type lease struct {
+	path   string
+	owner  string
+	opt    Options
+	closer *z.Closer
+}
+
+func readLease(fs vfs.FS, path string) (string, time.Time, error) {
+	data, err := vfs.ReadFile(fs, path)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	fields := bytes.Fields(data)
+	if len(fields) != 2 {
+		return "", time.Time{}, errors.Errorf("invalid lease file %q", path)
+	}
+	expiry, err := strconv.ParseInt(string(fields[1]), 10, 64)
+	if err != nil {
+		return "", time.Time{}, y.Wrapf(err, "invalid lease file %q", path)
+	}
+	return string(fields[0]), time.Unix(0, expiry), nil
+}
+
+// acquireLease acquires the lease on dir. In read-only mode, the lease is only checked to not be
+// held by a writer.
+func acquireLease(dir string, opt Options) (*lease, error) {
+	path, err := filepath.Abs(filepath.Join(dir, leaseFile))
+	if err != nil {
+		return nil, y.Wrapf(err, "cannot get absolute path for lease file")
+	}
+	owner, expiry, err := readLease(opt.FS, path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	case time.Now().Before(expiry):
+		return nil, errors.Errorf("Cannot acquire lease %q held by %s until %s. Another "+
+			"process is using this Badger database.", path, owner, expiry.Format(time.RFC3339))
+	default:
+		opt.Warningf("Taking over lease %q held by %s, which expired at %s", path, owner,
+			expiry.Format(time.RFC3339))
+	}
+	if opt.ReadOnly {
+		return &lease{}, nil
+	}
+
+	host, _ := os.Hostname()
+	l := &lease{
+		path:  path,
+		owner: fmt.Sprintf("%s/%d/%x", host, os.Getpid(), rand.Uint32()),
+		opt:   opt,
+	}
+	if err := l.renew(); err != nil {
+		return nil, err
+	}
+	// Another process could have written the lease at the same time.
+	time.Sleep(leaseSettleTime)
+	if err := l.check(); err != nil {
+		return nil, err
+	}
+	l.closer = z.NewCloser(1)
+	go l.keepAlive()
+	return l, nil
+}
+
+// renew writes the lease with a new expiry time. The lease is written to a temporary file which is
+// renamed, so that readers never see a partial lease.
+func (l *lease) renew() error {
+	expiry := time.Now().Add(leaseDuration).UnixNano()
+	tmp := fmt.Sprintf("%s.%x", l.path, rand.Uint32())
+	data := []byte(fmt.Sprintf("%s %d\n", l.owner, expiry))
+	if err := vfs.WriteFile(l.opt.FS, tmp, data, 0666); err != nil {
+		return y.Wrapf(err, "cannot write lease file %q", tmp)
+	}
+	if err := l.opt.FS.Rename(tmp, l.path); err != nil {
+		_ = l.opt.FS.Remove(tmp)
+		return y.Wrapf(err, "cannot write lease file %q", l.path)
+	}
+	return l.opt.FS.SyncDir(filepath.Dir(l.path))
+}
+
+// check returns an error if the lease is now held by another process.
+func (l *lease) check() error {
+	owner, _, err := readLease(l.opt.FS, l.path)
+	if err != nil {
+		return err
+	}
+	if owner != l.owner {
+		return errors.Errorf("Lost lease %q to %s. Another process is using this Badger "+
+			"database.", l.path, owner)
+	}
+	return nil
+}
+
+func (l *lease) keepAlive() {
+	defer l.closer.Done()
+	ticker := time.NewTicker(leaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := l.check()
+			if err == nil {
+				err = l.renew()
+			}
+			if err != nil {
+				l.opt.Errorf("While renewing lease: %v", err)
+			}
+		case <-l.closer.HasBeenClosed():
+			return
+		}
+	}
+}
+
+// release stops renewing the lease and deletes it.
+func (l *lease) release() error {
+	if l.closer == nil {
+		return nil
+	}
+	l.closer.SignalAndWait()
+	l.closer = nil
+	if err := l.check(); err != nil {
+		return err
+	}
+	return l.opt.FS.Remove(l.path)
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLease(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opt := getTestOptions(dir).WithNetworkFS(true)
+	l, err := acquireLease(dir, opt)
+	require.NoError(t, err)
+
+	// The lease is exclusive, even for readers.
+	_, err = acquireLease(dir, opt)
+	require.Error(t, err)
+	_, err = acquireLease(dir, opt.WithReadOnly(true))
+	require.Error(t, err)
+
+	require.NoError(t, l.release())
+	ro, err := acquireLease(dir, opt.WithReadOnly(true))
+	require.NoError(t, err)
+	require.NoError(t, ro.release())
+
+	// An expired lease can be taken over.
+	expired := time.Now().Add(-time.Second).UnixNano()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, leaseFile),
+		[]byte(fmt.Sprintf("crashed/1/0 %d\n", expired)), 0666))
+	l, err = acquireLease(dir, opt)
+	require.NoError(t, err)
+	require.NoError(t, l.release())
+}
+
+func TestNetworkFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opt := getTestOptions(dir).WithNetworkFS(true)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	_, err = Open(opt)
+	require.Error(t, err)
+	for i := 0; i < 100; i++ {
+		txnSet(t, db, []byte(fmt.Sprintf("key%03d", i)), []byte("val"), 0)
+	}
+	require.NoError(t, db.Close())
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer db.Close()
+	tables := db.lc.levels[0].tables
+	require.Len(t, tables, 1)
+	// The table is read with file I/O instead of being mapped in memory.
+	require.Nil(t, tables[0].Data)
+	require.NoError(t, db.View(func(txn *Txn) error {
+		item, err := txn.Get([]byte("key042"))
+		if err != nil {
+			return err
+		}
+		require.Equal(t, []byte("val"), getItemValue(t, item))
+		return nil
+	}))
+
+	// Compactions write tables with file I/O too.
+	require.NoError(t, db.CompactRange(nil, nil))
+	require.Equal(t, 0, db.lc.levels[0].numTables())
+	for _, lh := range db.lc.levels {
+		for _, tbl := range lh.tables {
+			require.Nil(t, tbl.Data)
+		}
+	}
+	require.NoError(t, db.View(func(txn *Txn) error {
+		_, err := txn.Get([]byte("key099"))
+		return err
+	}))
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"sync"
+
+	"github.com/dgraph-io/badger/v3/table"
+)
+
+// l0WALs holds the write-ahead logs of the memtables flushed into the in-memory tables of L0, by
+// table ID. See Options.KeepL0InMemory. The logs are deleted once their table has been compacted
+// into tables on disk. They are left on disk otherwise, to be replayed like the logs of the
+// memtables which weren't flushed when the DB is opened again.
+type l0WALs struct {
+	sync.Mutex
+	m map[uint64][]*logFile
+}
+
+// keepWALs hands the write-ahead logs of the memtables mts over to the in-memory L0 table t they
+// are flushed into. It must be called before t is added to L0.
+func (s *levelsController) keepWALs(t *table.Table, mts []*memTable) {
+	wals := make([]*logFile, 0, len(mts))
+	for _, mt := range mts {
+		mt.walKept = true
+		wals = append(wals, mt.wal)
+	}
+	s.l0WALs.Lock()
+	defer s.l0WALs.Unlock()
+	if s.l0WALs.m == nil {
+		s.l0WALs.m = make(map[uint64][]*logFile)
+	}
+	s.l0WALs.m[t.ID()] = wals
+}
+
+// deleteWALs deletes the write-ahead logs kept for the tables, once the changes removing them
+// have been written to the manifest.
+func (s *levelsController) deleteWALs(tables []*table.Table) {
+	var wals []*logFile
+	s.l0WALs.Lock()
+	for _, t := range tables {
+		wals = append(wals, s.l0WALs.m[t.ID()]...)
+		delete(s.l0WALs.m, t.ID())
+	}
+	s.l0WALs.Unlock()
+	if len(wals) == 0 {
+		return
+	}
+	for _, lf := range wals {
+		// The memtable of the log could still be referenced, and its log synced.
+		lf.lock.Lock()
+		err := lf.Delete()
+		lf.lock.Unlock()
+		if err != nil {
+			s.kv.opt.Errorf("while deleting file: %s, err: %v", lf.path, err)
+		}
+	}
+	// Don't let a crash bring back the logs, which could resurrect dropped data.
+	if err := s.kv.syncDir(s.kv.opt.Dir); err != nil {
+		s.kv.opt.Errorf("while syncing dir after deleting memtable files: %v", err)
+	}
+}
+
+// closeWALs closes the write-ahead logs kept for the in-memory L0 tables, leaving them on disk.
+func (s *levelsController) closeWALs() error {
+	s.l0WALs.Lock()
+	defer s.l0WALs.Unlock()
+	var firstErr error
+	for id, wals := range s.l0WALs.m {
+		for _, lf := range wals {
+			if err := lf.Close(-1); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		delete(s.l0WALs.m, id)
+	}
+	return firstErr
+}
@@ -274,23 +274,49 @@ func (s *levelHandler) getTableForKey(key []byte) ([]*table.Table, func() error)
 }
 
 // get returns value for a given key or the key after that. If not found, return nil.
-func (s *levelHandler) get(key []byte) (y.ValueStruct, error) {
+func (s *levelHandler) get(key []byte, ro ReadOptions) (maxVs y.ValueStruct, err error) {
 	tables, decr := s.getTableForKey(key)
+	// Release the tables even if reading them faults. See catchFault.
+	defer func() {
+		if decrErr := decr(); err == nil {
+			err = decrErr
+		}
+	}()
 	keyNoTs := y.ParseKey(key)
 
 	hash := y.Hash(keyNoTs)
-	var maxVs y.ValueStruct
 	for _, th := range tables {
+		if ro.Trace != nil {
+			ro.Trace.Tables++
+		}
 		if th.DoesNotHave(hash) {
 			y.NumLSMBloomHitsAdd(s.db.opt.MetricsEnabled, s.strLevel, 1)
+			if ro.Trace != nil {
+				ro.Trace.BloomNegatives++
+			}
 			continue
 		}
 
-		it := th.NewIterator(0)
+		it := th.NewIterator(ro.tableFlags())
 		defer it.Close()
 
 		y.NumLSMGetsAdd(s.db.opt.MetricsEnabled, s.strLevel, 1)
 		it.Seek(key)
+		if ro.Trace != nil {
+			blocks, reads := it.BlockReads()
+			ro.Trace.Blocks += uint64(blocks)
+			ro.Trace.BlockReads += uint64(reads)
+		}
+		if err := it.Error(); err == table.ErrNotCached {
+			return y.ValueStruct{}, ErrNotCached
+		} else if err != nil {
+			s.db.lc.reportCorruption(th, key, err)
+			if ro.VerifyChecksum {
+				// The caller asked for checked reads, so don't hide the corruption.
+				return y.ValueStruct{}, err
+			}
+			continue
+		}
 		if !it.Valid() {
 			continue
 		}
@@ -301,7 +327,7 @@ func (s *levelHandler) get(key []byte) (y.ValueStruct, error) {
 			}
 		}
 	}
-	return maxVs, decr()
+	return maxVs, nil
 }
 
 // iterators returns an array of iterators, for merging.
@@ -310,9 +336,9 @@ func (s *levelHandler) iterators(opt *IteratorOptions) []y.Iterator {
 	s.RLock()
 	defer s.RUnlock()
 
-	var topt int
+	topt := opt.readOpt.tableFlags()
 	if opt.Reverse {
-		topt = table.REVERSED
+		topt |= table.REVERSED
 	}
 	if s.level == 0 {
 		// Remember to add in reverse order!
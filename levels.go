@@ -23,7 +23,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
-	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
@@ -49,11 +49,13 @@ type levelsController struct {
 	kv     *DB
 
 	cstatus compactStatus
+	corrupt corruptTables
+	l0WALs  l0WALs
 }
 
-// revertToManifest checks that all necessary table files exist and removes all table files not
-// referenced by the manifest. idMap is a set of table file id's that were read from the directory
-// listing.
+// revertToManifest checks that all necessary table files exist and moves all table files not
+// referenced by the manifest to the quarantine directory. idMap is a set of table file id's that
+// were read from the directory listing. In read-only mode, the files are only checked.
 func revertToManifest(kv *DB, mf *Manifest, idMap map[uint64]struct{}) error {
 	// 1. Check all files in manifest exist.
 	for id := range mf.Tables {
@@ -62,14 +64,36 @@ func revertToManifest(kv *DB, mf *Manifest, idMap map[uint64]struct{}) error {
 		}
 	}
 
-	// 2. Delete files that shouldn't exist.
+	// 2. Quarantine files that shouldn't exist. A read-only DB may be opened next to a live writer,
+	// whose new tables exist before the manifest refers to them, so it leaves them alone.
 	for id := range idMap {
-		if _, ok := mf.Tables[id]; !ok {
-			kv.opt.Debugf("Table file %d not referenced in MANIFEST\n", id)
-			filename := table.NewFilename(id, kv.opt.Dir)
-			if err := os.Remove(filename); err != nil {
-				return y.Wrapf(err, "While removing table %d", id)
-			}
+		if _, ok := mf.Tables[id]; ok || kv.opt.ReadOnly {
+			continue
+		}
+		kv.opt.Debugf("Table file %d not referenced in MANIFEST\n", id)
+		if err := kv.quarantineFile(table.NewFilename(id, kv.opt.Dir)); err != nil {
+			return y.Wrapf(err, "While quarantining table %d", id)
+		}
+	}
+
+	// 3. Delete the tables which were being written when the DB crashed. They were never renamed
+	// to their final names, so they can't be referenced by the manifest. A read-only DB leaves
+	// them alone, as they may be tables a live writer is writing.
+	if kv.opt.ReadOnly {
+		return nil
+	}
+	fileInfos, err := kv.opt.FS.ReadDir(kv.opt.Dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range fileInfos {
+		if !strings.HasSuffix(info.Name(), ".sst"+table.TempSuffix) {
+			continue
+		}
+		name := filepath.Join(kv.opt.Dir, info.Name())
+		kv.opt.Infof("Removing partially written table: %s", name)
+		if err := kv.opt.FS.Remove(name); err != nil {
+			return y.Wrapf(err, "While removing partially written table %s", name)
 		}
 	}
 
@@ -93,8 +117,12 @@ func newLevelsController(db *DB, mf *Manifest) (*levelsController, error) {
 	if db.opt.InMemory {
 		return s, nil
 	}
+	idMap := getIDMap(db.opt.FS, db.opt.Dir)
+	if err := db.restoreTables(mf, idMap); err != nil {
+		return nil, err
+	}
 	// Compare manifest against directory, check for existent/non-existent files, and remove.
-	if err := revertToManifest(db, mf, getIDMap(db.opt.Dir)); err != nil {
+	if err := revertToManifest(db, mf, idMap); err != nil {
 		return nil, err
 	}
 
@@ -143,16 +171,11 @@ func newLevelsController(db *DB, mf *Manifest) (*levelsController, error) {
 			topt.Compression = tf.Compression
 			topt.DataKey = dk
 
-			mf, err := z.OpenMmapFile(fname, db.opt.getFileFlags(), 0)
-			if err != nil {
-				rerr = y.Wrapf(err, "Opening file: %q", fname)
-				return
-			}
-			t, err := table.OpenTable(mf, topt)
+			t, err := table.OpenTableFile(fname, db.opt.getFileFlags(), topt)
 			if err != nil {
 				if strings.HasPrefix(err.Error(), "CHECKSUM_MISMATCH:") {
 					db.opt.Errorf(err.Error())
-					db.opt.Errorf("Ignoring table %s", mf.Fd.Name())
+					db.opt.Errorf("Ignoring table %s", fname)
 					// Do not set rerr. We will continue without this table.
 				} else {
 					rerr = y.Wrapf(err, "Opening table: %q", fname)
@@ -184,7 +207,7 @@ func newLevelsController(db *DB, mf *Manifest) (*levelsController, error) {
 
 	// Sync directory (because we have at least removed some files, or previously created the
 	// manifest file).
-	if err := syncDir(db.opt.Dir); err != nil {
+	if err := db.opt.FS.SyncDir(db.opt.Dir); err != nil {
 		_ = s.close()
 		return nil, err
 	}
@@ -242,6 +265,8 @@ func (s *levelsController) dropTree() (int, error) {
 	}
 
 	// Now that manifest has been successfully written, we can delete the tables.
+	s.kv.deleteRemoteTables(all)
+	s.deleteWALs(all)
 	for _, l := range s.levels {
 		l.Lock()
 		l.totalSize = 0
@@ -475,6 +500,12 @@ func (s *levelsController) runCompactor(id int, lc *z.Closer) {
 		return false
 	}
 	runOnce := func() bool {
+		if s.repairCorruptTable(id) {
+			return true
+		}
+		if s.dropExpiredTables(id) {
+			return true
+		}
 		prios := s.pickCompactLevels()
 		if id == 0 {
 			// Worker ID zero prefers to compact L0 always.
@@ -486,6 +517,10 @@ func (s *levelsController) runCompactor(id int, lc *z.Closer) {
 			} else if p.adjusted < 1.0 {
 				break
 			}
+			if p.level > 0 && !s.kv.maintenance.allowed() {
+				// Only the compactions of level 0 are needed to keep the writes flowing.
+				continue
+			}
 			if run(p) {
 				return true
 			}
@@ -641,6 +676,11 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 	// that would affect the snapshot view guarantee provided by transactions.
 	discardTs := s.kv.orc.discardAtOrBelow()
 
+	var filter CompactionFilter
+	if s.kv.opt.CompactionFilter != nil {
+		filter = s.kv.opt.CompactionFilter()
+	}
+
 	// Try to collect stats so that we can inform value log about GC. That would help us find which
 	// value log file should be GCed.
 	discardStats := make(map[uint32]int64)
@@ -675,9 +715,14 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 	var (
 		lastKey, skipKey       []byte
 		numBuilds, numVersions int
+		// The number of versions of lastKey processed, including the ones above discardTs.
+		numKeyVersions int
 		// Denotes if the first key is a series of duplicate keys had
 		// "DiscardEarlierVersions" set
 		firstKeyHasDiscardSet bool
+		// The versions of lastKey that delta encoded versions already added are based on. They
+		// are kept whatever the other rules say, so that the deltas can still be read.
+		deltaBases = make(map[uint64]struct{})
 	)
 
 	addKeys := func(builder *table.Builder) {
@@ -693,6 +738,22 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 				continue
 			}
 
+			if y.SameKey(it.Key(), lastKey) && len(deltaBases) > 0 {
+				if _, ok := deltaBases[y.ParseTs(it.Key())]; ok {
+					vs := it.Value()
+					var vp valuePointer
+					if vs.Meta&bitValuePointer > 0 {
+						vp.Decode(vs.Value)
+					}
+					numKeys++
+					builder.Add(it.Key(), vs, vp.Len)
+					if base := deltaBase(vs); base > 0 {
+						deltaBases[base] = struct{}{}
+					}
+					continue
+				}
+			}
+
 			// See if we need to skip this key.
 			if len(skipKey) > 0 {
 				if y.SameKey(it.Key(), skipKey) {
@@ -717,6 +778,10 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 				}
 				lastKey = y.SafeCopy(lastKey, it.Key())
 				numVersions = 0
+				numKeyVersions = 0
+				for version := range deltaBases {
+					delete(deltaBases, version)
+				}
 				firstKeyHasDiscardSet = it.Value().Meta&BitDiscardEarlierVersions > 0
 
 				if len(tableKr.left) == 0 {
@@ -736,10 +801,16 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 						break
 					}
 				}
+			} else if s.kv.opt.AppendOnly && !bytes.HasPrefix(it.Key(), badgerPrefix) {
+				// In append-only mode, every key must be written exactly once. A second version
+				// means the write path check was bypassed, e.g. via the StreamWriter.
+				s.kv.opt.Errorf("Append-only violation: key %q has more than one version",
+					y.ParseKey(it.Key()))
 			}
 
 			vs := it.Value()
 			version := y.ParseTs(it.Key())
+			numKeyVersions++
 
 			isExpired := isDeletedOrExpired(vs.Meta, vs.ExpiresAt)
 
@@ -750,6 +821,17 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 				// versions which are below the minReadTs, otherwise, we might end up discarding the
 				// only valid version for a running transaction.
 				numVersions++
+
+				// Let the compaction filter drop the key by turning its latest version into a
+				// delete marker, which is then handled like any other deleted key. The filter
+				// isn't called if a newer version, above discardTs, is kept.
+				if filter != nil && numKeyVersions == 1 && !isExpired &&
+					!bytes.HasPrefix(it.Key(), badgerPrefix) &&
+					filter.Drop(y.ParseKey(it.Key()), vs.UserMeta) {
+					updateStats(vs)
+					vs = y.ValueStruct{Meta: bitDelete, Version: vs.Version}
+					isExpired = true
+				}
 				// Keep the current version and discard all the next versions if
 				// - The `discardEarlierVersions` bit is set OR
 				// - We've already processed `NumVersionsToKeep` number of versions
@@ -784,6 +866,13 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 			var vp valuePointer
 			if vs.Meta&bitValuePointer > 0 {
 				vp.Decode(vs.Value)
+				if s.kv.opt.ValueFolding && !isExpired {
+					if folded, ok := s.kv.foldValue(it.Key(), vs, vp); ok {
+						// The entry left in the value log is garbage now.
+						updateStats(vs)
+						vs, vp = folded, valuePointer{}
+					}
+				}
 			}
 			switch {
 			case firstKeyHasDiscardSet:
@@ -798,6 +887,9 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 			default:
 				builder.Add(it.Key(), vs, vp.Len)
 			}
+			if base := deltaBase(vs); base > 0 {
+				deltaBases[base] = struct{}{}
+			}
 		}
 		s.kv.opt.Debugf("[%d] LOG Compact. Added %d keys. Skipped %d keys. Iteration took: %v",
 			cd.compactorId, numKeys, numSkips, time.Since(timeStart).Round(time.Millisecond))
@@ -816,10 +908,12 @@ func (s *levelsController) subcompact(it y.Iterator, kr keyRange, cd compactDef,
 		bopts := buildTableOptions(s.kv)
 		// Set TableSize to the target file size for that level.
 		bopts.TableSize = uint64(cd.t.fileSz[cd.nextLevel.level])
+		bopts.BloomFalsePositive = s.kv.opt.bloomFalsePositive(cd.nextLevel.level)
 		builder := table.NewTableBuilder(bopts)
 
 		// This would do the iteration and add keys to builder.
 		addKeys(builder)
+		s.kv.stats.addKeyStats(builder)
 
 		// It was true that it.Valid() at least once in the loop above, which means we
 		// called Add() at least once, and builder is not Empty().
@@ -891,18 +985,22 @@ func (s *levelsController) compactBuildTables(
 		}
 	}
 
+	topt := table.NOCACHE
+	if cd.skipCorrupt {
+		topt |= table.SKIPCORRUPT
+	}
 	newIterator := func() []y.Iterator {
 		// Create iterators across all the tables involved first.
 		var iters []y.Iterator
 		switch {
 		case lev == 0:
-			iters = append(iters, iteratorsReversed(topTables, table.NOCACHE)...)
+			iters = append(iters, iteratorsReversed(topTables, topt)...)
 		case len(topTables) > 0:
 			y.AssertTrue(len(topTables) == 1)
-			iters = []y.Iterator{topTables[0].NewIterator(table.NOCACHE)}
+			iters = []y.Iterator{topTables[0].NewIterator(topt)}
 		}
 		// Next level has level>=1 and we can use ConcatIterator as key ranges do not overlap.
-		return append(iters, table.NewConcatIterator(valid, table.NOCACHE))
+		return append(iters, table.NewConcatIterator(valid, topt))
 	}
 
 	res := make(chan *table.Table, 3)
@@ -942,6 +1040,9 @@ func (s *levelsController) compactBuildTables(
 		// background operation.
 		err = s.kv.syncDir(s.kv.opt.Dir)
 	}
+	if err == nil {
+		err = s.kv.uploadTables(newTables)
+	}
 
 	if err != nil {
 		// An error happened.  Delete all the newly created table files (by calling DecrRef
@@ -1047,6 +1148,8 @@ type compactDef struct {
 	thisSize int64
 
 	dropPrefixes [][]byte
+	// skipCorrupt is set if some of the tables have corrupted blocks, which are then skipped.
+	skipCorrupt bool
 }
 
 // addSplits can allow us to run multiple sub-compactions in parallel across the split key ranges.
@@ -1399,6 +1502,8 @@ func (s *levelsController) runCompactDef(id, l int, cd compactDef) (err error) {
 		return errors.New("Filesizes cannot be zero. Targets are not set")
 	}
 	timeStart := time.Now()
+	atomic.AddInt64(&s.kv.stats.runningCompactions, 1)
+	defer atomic.AddInt64(&s.kv.stats.runningCompactions, -1)
 
 	thisLevel := cd.thisLevel
 	nextLevel := cd.nextLevel
@@ -1416,6 +1521,7 @@ func (s *levelsController) runCompactDef(id, l int, cd compactDef) (err error) {
 	// Table should never be moved directly between levels, always be rewritten to allow discarding
 	// invalid versions.
 
+	cd.skipCorrupt = s.hasCorruptTable(cd.allTables())
 	newTables, decr, err := s.compactBuildTables(l, cd)
 	if err != nil {
 		return err
@@ -1441,6 +1547,20 @@ func (s *levelsController) runCompactDef(id, l int, cd compactDef) (err error) {
 	if err := thisLevel.deleteTables(cd.top); err != nil {
 		return err
 	}
+	s.kv.deleteRemoteTables(cd.allTables())
+	s.deleteWALs(cd.top)
+	s.checkLevelInvariants(thisLevel, nextLevel)
+	if cd.skipCorrupt {
+		s.forgetCorruptTables(cd.allTables())
+		s.kv.events.add("Rewrote the corrupt tables among %s", strings.Join(
+			append(tablesToString(cd.top), tablesToString(cd.bot)...), " "))
+	}
+	s.kv.events.add("Compacted L%d -> L%d: %d + %d tables -> %d tables", thisLevel.level,
+		nextLevel.level, len(cd.top), len(cd.bot), len(newTables))
+	atomic.AddUint64(&s.kv.stats.compactions, 1)
+	for _, t := range newTables {
+		atomic.AddUint64(&s.kv.stats.compactedBytes, uint64(t.Size()))
+	}
 
 	// Note: For level 0, while doCompact is running, it is possible that new tables are added.
 	// However, the tables are added only to the end, so it is ok to just delete the first table.
@@ -1529,6 +1649,184 @@ func (s *levelsController) doCompact(id int, p compactionPriority) error {
 	return nil
 }
 
+// tableInRange returns true if the table t holds keys in the range [start, end). An empty end
+// means that the range is unbounded.
+func tableInRange(t *table.Table, start, end []byte) bool {
+	if bytes.Compare(y.ParseKey(t.Biggest()), start) < 0 {
+		return false
+	}
+	return len(end) == 0 || bytes.Compare(y.ParseKey(t.Smallest()), end) < 0
+}
+
+// firstTableInRange returns the first table of level l holding keys in the range [start, end).
+func (s *levelsController) firstTableInRange(l int, start, end []byte) *table.Table {
+	lh := s.levels[l]
+	lh.RLock()
+	defer lh.RUnlock()
+	for _, t := range lh.tables {
+		if tableInRange(t, start, end) {
+			return t
+		}
+	}
+	return nil
+}
+
+// compactTableDown compacts the table t of level l >= 1 into the first level below l holding keys
+// which overlap with t, or into the last level if there is no such level. If l is the last level,
+// the table is rewritten in place. It must only be called while the compactors are stopped.
+func (s *levelsController) compactTableDown(id, l int, t *table.Table) error {
+	y.AssertTrue(l > 0)
+	_, span := otrace.StartSpan(context.Background(), "Badger.Compaction")
+	defer span.End()
+
+	tgts := s.levelTargets()
+	cd := compactDef{
+		compactorId: id,
+		span:        span,
+		p:           compactionPriority{level: l, t: tgts},
+		t:           tgts,
+		thisLevel:   s.levels[l],
+		nextLevel:   s.levels[l],
+		top:         []*table.Table{t},
+		thisRange:   getKeyRange(t),
+		thisSize:    t.Size(),
+	}
+	for next := l + 1; next < len(s.levels); next++ {
+		cd.nextLevel = s.levels[next]
+		cd.nextLevel.RLock()
+		left, right := cd.nextLevel.overlappingTables(levelHandlerRLocked{}, cd.thisRange)
+		cd.bot = make([]*table.Table, right-left)
+		copy(cd.bot, cd.nextLevel.tables[left:right])
+		cd.nextLevel.RUnlock()
+		if len(cd.bot) > 0 {
+			break
+		}
+	}
+	cd.nextRange = cd.thisRange
+	if len(cd.bot) > 0 {
+		cd.nextRange = getKeyRange(cd.bot...)
+	}
+	if !s.cstatus.compareAndAdd(thisAndNextLevelRLocked{}, cd) {
+		return errFillTables
+	}
+	defer s.cstatus.delete(cd)
+	// The table could have been compacted away by a live compaction before being marked above.
+	if found, _ := s.findTable(t.ID()); found != t {
+		return errFillTables
+	}
+
+	span.Annotatef(nil, "Compaction: %+v", cd)
+	if err := s.runCompactDef(id, l, cd); err != nil {
+		s.kv.opt.Warningf("[Compactor: %d] LOG Compact FAILED with error: %+v: %+v", id, err, cd)
+		return err
+	}
+	return nil
+}
+
+// dropExpiredTables deletes a table of a level below L0 whose keys have all expired, without
+// compacting it. The table must be older than the discard timestamp, and the levels below it must
+// not hold keys in its range, as the expired keys hide their older versions. It returns true if a
+// table was deleted. The value log entries of the deleted keys aren't added to the discard stats.
+// Like the compactions, it keeps the merge entries and the base versions of the delta encoded
+// versions, see keepsVersions.
+func (s *levelsController) dropExpiredTables(id int) bool {
+	now := uint64(time.Now().Unix())
+	discardTs := s.kv.orc.discardAtOrBelow()
+	for _, lh := range s.levels[1:] {
+		var expired []*table.Table
+		lh.RLock()
+		for _, t := range lh.tables {
+			if exp := t.MaxExpiresAt(); exp > 0 && exp <= now && t.MaxVersion() <= discardTs {
+				expired = append(expired, t)
+			}
+		}
+		lh.RUnlock()
+		for _, t := range expired {
+			if s.checkOverlap([]*table.Table{t}, lh.level+1) || s.keepsVersions(t, lh.level) {
+				continue
+			}
+			if err := s.dropExpiredTable(id, lh, t); err == nil {
+				return true
+			} else if err != errFillTables {
+				s.kv.opt.Warningf("[Compactor: %d] While dropping expired table %d: %v",
+					id, t.ID(), err)
+			}
+		}
+	}
+	return false
+}
+
+// keepsVersions returns true if the table t of the given level holds merge entries, or versions
+// which newer delta encoded versions are based on. The delta encoded versions are looked up in the
+// memtables and the levels above, over the key range of t. The levels below must not overlap t,
+// so the deltas based on versions up to the max version of t are based on versions of t.
+func (s *levelsController) keepsVersions(t *table.Table, level int) bool {
+	it := t.NewIterator(0)
+	for it.Rewind(); it.Valid(); it.Next() {
+		if it.Value().Meta&bitMergeEntry > 0 {
+			it.Close()
+			return true
+		}
+	}
+	it.Close()
+
+	mts, decr := s.kv.getMemTables()
+	defer decr()
+	var iters []y.Iterator
+	for _, mt := range mts {
+		iters = append(iters, mt.sl.NewUniIterator(false))
+	}
+	opt := &IteratorOptions{}
+	for _, lh := range s.levels[:level] {
+		iters = append(iters, lh.iterators(opt)...)
+	}
+	mi := table.NewMergeIterator(iters, false)
+	defer mi.Close()
+	biggest := y.ParseKey(t.Biggest())
+	// The newer versions of the smallest key of t sort before it.
+	for mi.Seek(y.KeyWithTs(y.ParseKey(t.Smallest()), math.MaxUint64)); mi.Valid(); mi.Next() {
+		if bytes.Compare(y.ParseKey(mi.Key()), biggest) > 0 {
+			break
+		}
+		if base := deltaBase(mi.Value()); base > 0 && base <= t.MaxVersion() {
+			return true
+		}
+	}
+	return false
+}
+
+// dropExpiredTable deletes the expired table t of the level lh.
+func (s *levelsController) dropExpiredTable(id int, lh *levelHandler, t *table.Table) error {
+	cd := compactDef{
+		compactorId: id,
+		thisLevel:   lh,
+		nextLevel:   lh,
+		top:         []*table.Table{t},
+		thisRange:   getKeyRange(t),
+		thisSize:    t.Size(),
+	}
+	cd.nextRange = cd.thisRange
+	if !s.cstatus.compareAndAdd(thisAndNextLevelRLocked{}, cd) {
+		return errFillTables
+	}
+	defer s.cstatus.delete(cd)
+	// The table could have been compacted away before being marked above.
+	if found, _ := s.findTable(t.ID()); found != t {
+		return errFillTables
+	}
+
+	changeSet := buildChangeSet(&cd, nil)
+	if err := s.kv.manifest.addChanges(changeSet.Changes); err != nil {
+		return err
+	}
+	if err := lh.deleteTables(cd.top); err != nil {
+		return err
+	}
+	s.kv.deleteRemoteTables(cd.top)
+	s.kv.events.add("Dropped expired table %05d of L%d", t.ID(), lh.level)
+	return nil
+}
+
 func (s *levelsController) addLevel0Table(t *table.Table) error {
 	// Add table to manifest file only if it is not opened in memory. We don't want to add a table
 	// to the manifest file if it exists only in memory.
@@ -1563,13 +1861,16 @@ func (s *levelsController) addLevel0Table(t *table.Table) error {
 
 func (s *levelsController) close() error {
 	err := s.cleanupLevels()
+	if werr := s.closeWALs(); err == nil {
+		err = werr
+	}
 	return y.Wrap(err, "levelsController.Close")
 }
 
 // get searches for a given key in all the levels of the LSM tree. It returns
 // key version <= the expected version (maxVs). If not found, it returns an empty
 // y.ValueStruct.
-func (s *levelsController) get(key []byte, maxVs y.ValueStruct, startLevel int) (
+func (s *levelsController) get(key []byte, maxVs y.ValueStruct, startLevel int, ro ReadOptions) (
 	y.ValueStruct, error) {
 	if s.kv.IsClosed() {
 		return y.ValueStruct{}, ErrDBClosed
@@ -1585,7 +1886,7 @@ func (s *levelsController) get(key []byte, maxVs y.ValueStruct, startLevel int)
 		if h.level < startLevel {
 			continue
 		}
-		vs, err := h.get(key) // Calls h.RLock() and h.RUnlock().
+		vs, err := h.get(key, ro) // Calls h.RLock() and h.RUnlock().
 		if err != nil {
 			return y.ValueStruct{}, y.Wrapf(err, "get key: %q", key)
 		}
@@ -1643,6 +1944,8 @@ type TableInfo struct {
 	StaleDataSize    uint32
 	UncompressedSize uint32
 	MaxVersion       uint64
+	MinVersion       uint64
+	MaxExpiresAt     uint64 // Zero if some key doesn't expire.
 	IndexSz          int
 	BloomFilterSize  int
 }
@@ -1663,6 +1966,8 @@ func (s *levelsController) getTableInfo() (result []TableInfo) {
 				BloomFilterSize:  t.BloomFilterSize(),
 				UncompressedSize: t.UncompressedSize(),
 				MaxVersion:       t.MaxVersion(),
+				MinVersion:       t.MinVersion(),
+				MaxExpiresAt:     t.MaxExpiresAt(),
 			}
 			result = append(result, info)
 		}
@@ -1713,6 +2018,79 @@ func (s *levelsController) getLevelInfo() []LevelInfo {
 	return result
 }
 
+// CompactionPlan describes a compaction which would be run next by the compactors.
+type CompactionPlan struct {
+	Level     int
+	NextLevel int
+	Score     float64
+	Adjusted  float64
+	// TopTables and BotTables are the IDs of the tables picked from Level and NextLevel.
+	TopTables []uint64
+	BotTables []uint64
+	// ReadBytes is the size of the tables read by the compaction. WriteBytes is an upper bound of
+	// the size of the tables written, as the compaction only discards data.
+	ReadBytes  int64
+	WriteBytes int64
+}
+
+// planCompactions picks the compactions the compactors would run next, in the order of their
+// priority, without running them. The picked tables are marked as being compacted while planning,
+// so that the plan doesn't hold overlapping compactions, just like concurrent compactors.
+func (s *levelsController) planCompactions() []CompactionPlan {
+	var plans []CompactionPlan
+	var picked []compactDef
+	defer func() {
+		for _, cd := range picked {
+			s.cstatus.delete(cd)
+		}
+	}()
+
+	for _, p := range s.pickCompactLevels() {
+		// fillTablesL0ToL0 changes the file size of L0. Copy the targets so that the
+		// targets of the other levels aren't changed.
+		p.t.fileSz = append([]int64{}, p.t.fileSz...)
+		cd := compactDef{
+			p:            p,
+			t:            p.t,
+			thisLevel:    s.levels[p.level],
+			dropPrefixes: p.dropPrefixes,
+		}
+		var ok bool
+		if p.level == 0 {
+			cd.nextLevel = s.levels[p.t.baseLevel]
+			ok = s.fillTablesL0(&cd)
+		} else {
+			cd.nextLevel = cd.thisLevel
+			if !cd.thisLevel.isLastLevel() {
+				cd.nextLevel = s.levels[p.level+1]
+			}
+			ok = s.fillTables(&cd)
+		}
+		if !ok {
+			continue
+		}
+		picked = append(picked, cd)
+
+		plan := CompactionPlan{
+			Level:     cd.thisLevel.level,
+			NextLevel: cd.nextLevel.level,
+			Score:     p.score,
+			Adjusted:  p.adjusted,
+		}
+		for _, t := range cd.top {
+			plan.TopTables = append(plan.TopTables, t.ID())
+			plan.ReadBytes += t.Size()
+		}
+		for _, t := range cd.bot {
+			plan.BotTables = append(plan.BotTables, t.ID())
+			plan.ReadBytes += t.Size()
+		}
+		plan.WriteBytes = plan.ReadBytes
+		plans = append(plans, plan)
+	}
+	return plans
+}
+
 // verifyChecksum verifies checksum for all tables on all levels.
 func (s *levelsController) verifyChecksum() error {
 	var tables []*table.Table
@@ -1784,6 +2162,10 @@ func (lc *levelsController) AddTable(
 		if tbl, err = table.CreateTableFromBuffer(fname, kv.Value, opts); err != nil {
 			return errors.Wrap(err, "while creating table from buffer")
 		}
+		if err := lc.kv.uploadTables([]*table.Table{tbl}); err != nil {
+			_ = tbl.DecrRef()
+			return err
+		}
 	}
 
 	lc.levels[lev].addTable(tbl)
@@ -17,11 +17,13 @@
 package badger
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"math"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"sort"
 	"testing"
 	"time"
@@ -29,6 +31,7 @@ import (
 	"github.com/dgraph-io/badger/v3/options"
 	"github.com/dgraph-io/badger/v3/pb"
 	"github.com/dgraph-io/badger/v3/table"
+	"github.com/dgraph-io/badger/v3/vfs"
 	"github.com/dgraph-io/badger/v3/y"
 	"github.com/stretchr/testify/require"
 )
@@ -769,6 +772,200 @@ func TestDiscardFirstVersion(t *testing.T) {
 	})
 }
 
+type prefixFilter []byte
+
+func (f prefixFilter) Drop(key []byte, userMeta byte) bool {
+	return bytes.HasPrefix(key, f)
+}
+
+func TestCompactionFilter(t *testing.T) {
+	opt := DefaultOptions("").WithNumCompactors(0).WithNumVersionsToKeep(math.MaxInt32).
+		WithCompactionFilter(func() CompactionFilter { return prefixFilter("drop") })
+	opt.managedTxns = true
+
+	compact := func(db *DB) {
+		cdef := compactDef{
+			thisLevel: db.lc.levels[0],
+			nextLevel: db.lc.levels[1],
+			top:       db.lc.levels[0].tables,
+			bot:       db.lc.levels[1].tables,
+			t:         db.lc.levelTargets(),
+		}
+		cdef.t.baseLevel = 1
+		require.NoError(t, db.lc.runCompactDef(-1, 0, cdef))
+	}
+	t.Run("no overlap", func(t *testing.T) {
+		runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+			l0 := []keyValVersion{{"drop1", "a", 3, 0}, {"drop2", "b", 8, 0}, {"keep", "c", 3, 0}}
+			l1 := []keyValVersion{{"drop1", "d", 1, 0}, {"drop2", "e", 2, 0}}
+			createAndOpen(db, l0, 0)
+			createAndOpen(db, l1, 1)
+			db.SetDiscardTs(5)
+
+			compact(db)
+			// The latest version of drop2 is above discardTs, so it is still visible to
+			// transactions and must be kept, along with the version it shadows, as the filter
+			// only sees the latest version of a key.
+			getAllAndCheck(t, db, []keyValVersion{
+				{"drop2", "b", 8, 0}, {"drop2", "e", 2, 0}, {"keep", "c", 3, 0},
+			})
+		})
+	})
+	t.Run("overlap", func(t *testing.T) {
+		runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+			l0 := []keyValVersion{{"drop1", "a", 3, 0}, {"keep", "c", 3, 0}}
+			l2 := []keyValVersion{{"drop1", "d", 1, 0}}
+			createAndOpen(db, l0, 0)
+			createAndOpen(db, l2, 2)
+			db.SetDiscardTs(5)
+
+			compact(db)
+			// The delete marker hides the version in the lower level.
+			getAllAndCheck(t, db, []keyValVersion{
+				{"drop1", "", 3, bitDelete}, {"drop1", "d", 1, 0}, {"keep", "c", 3, 0},
+			})
+			txn := db.NewTransactionAt(5, false)
+			defer txn.Discard()
+			_, err := txn.Get([]byte("drop1"))
+			require.Equal(t, ErrKeyNotFound, err)
+		})
+	})
+}
+
+func TestCompactRange(t *testing.T) {
+	opt := DefaultOptions("").WithNumCompactors(0)
+	opt.managedTxns = true
+
+	t.Run("move down", func(t *testing.T) {
+		runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+			createAndOpen(db, []keyValVersion{{"c", "c2", 4, 0}}, 0)
+			createAndOpen(db, []keyValVersion{{"b1", "", 3, bitDelete}, {"b2", "x", 3, 0}}, 5)
+			createAndOpen(db, []keyValVersion{{"a", "a", 1, 0}}, 6)
+			createAndOpen(db, []keyValVersion{{"b1", "y", 1, 0}, {"b2", "z", 1, 0}}, 6)
+			createAndOpen(db, []keyValVersion{{"c", "c", 1, 0}}, 6)
+			db.SetDiscardTs(10)
+
+			require.NoError(t, db.CompactRange([]byte("b"), []byte("c")))
+			getAllAndCheck(t, db, []keyValVersion{
+				{"a", "a", 1, 0}, {"b2", "x", 3, 0}, {"c", "c2", 4, 0}, {"c", "c", 1, 0},
+			})
+			require.Equal(t, 1, db.lc.levels[0].numTables())
+			require.Equal(t, 0, db.lc.levels[5].numTables())
+		})
+	})
+	t.Run("rewrite last level", func(t *testing.T) {
+		runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+			createAndOpen(db, []keyValVersion{{"b1", "new", 3, 0}}, 0)
+			createAndOpen(db, []keyValVersion{{"b1", "y", 2, 0}, {"b1", "old", 1, 0}}, 6)
+			createAndOpen(db, []keyValVersion{{"d", "", 2, bitDelete}, {"d", "v", 1, 0}}, 6)
+			db.SetDiscardTs(10)
+
+			require.NoError(t, db.CompactRange([]byte("b"), nil))
+			getAllAndCheck(t, db, []keyValVersion{{"b1", "new", 3, 0}})
+			require.Equal(t, 0, db.lc.levels[0].numTables())
+		})
+	})
+}
+
+func TestPlanCompactions(t *testing.T) {
+	opt := DefaultOptions("").WithNumCompactors(0).WithNumLevelZeroTables(2)
+	opt.managedTxns = true
+
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		require.Empty(t, db.PlanCompactions())
+
+		createAndOpen(db, []keyValVersion{{"a", "a3", 3, 0}}, 0)
+		createAndOpen(db, []keyValVersion{{"a", "a2", 2, 0}}, 0)
+		createAndOpen(db, []keyValVersion{{"a", "a1", 1, 0}}, 0)
+		createAndOpen(db, []keyValVersion{{"a", "a0", 0, 0}}, 6)
+
+		plans := db.PlanCompactions()
+		require.Len(t, plans, 1)
+		plan := plans[0]
+		require.Equal(t, 0, plan.Level)
+		require.Equal(t, 6, plan.NextLevel)
+		require.Equal(t, 1.5, plan.Score)
+		require.Len(t, plan.TopTables, 3)
+		require.Len(t, plan.BotTables, 1)
+		var size int64
+		for _, l := range []int{0, 6} {
+			for _, tbl := range db.lc.levels[l].tables {
+				size += tbl.Size()
+			}
+		}
+		require.Equal(t, size, plan.ReadBytes)
+
+		// Planning doesn't run the compactions, nor leave the tables marked as being compacted.
+		require.Equal(t, 3, db.lc.levels[0].numTables())
+		require.Equal(t, plans, db.PlanCompactions())
+	})
+}
+
+func TestPartialTableRemovedOnOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opt := getTestOptions(dir)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	txnSet(t, db, []byte("key"), []byte("val"), 0)
+	require.NoError(t, db.Close())
+
+	// Closing the DB flushes the memtable into a table, which must have been published.
+	tmpFiles, err := filepath.Glob(filepath.Join(dir, "*"+table.TempSuffix))
+	require.NoError(t, err)
+	require.Empty(t, tmpFiles)
+
+	// Simulate a crash while writing a table.
+	partial := table.NewFilename(100, dir) + table.TempSuffix
+	require.NoError(t, ioutil.WriteFile(partial, []byte("partial"), 0644))
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = os.Stat(partial)
+	require.True(t, os.IsNotExist(err))
+	require.NoError(t, db.View(func(txn *Txn) error {
+		_, err := txn.Get([]byte("key"))
+		return err
+	}))
+}
+
+func TestOrphanTableQuarantined(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opt := getTestOptions(dir)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	txnSet(t, db, []byte("key"), []byte("val"), 0)
+	require.NoError(t, db.Close())
+
+	// Copy a table to an ID which isn't referenced by the MANIFEST.
+	ids := getIDMap(vfs.OS, dir)
+	require.Len(t, ids, 1)
+	for id := range ids {
+		data, err := ioutil.ReadFile(table.NewFilename(id, dir))
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(table.NewFilename(100, dir), data, 0644))
+	}
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	require.Len(t, getIDMap(vfs.OS, dir), 1)
+	_, err = os.Stat(filepath.Join(dir, QuarantineDir, table.IDToFilename(100)))
+	require.NoError(t, err)
+
+	n, err := PurgeQuarantine(dir)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	_, err = os.Stat(filepath.Join(dir, QuarantineDir))
+	require.True(t, os.IsNotExist(err))
+}
+
 // This test ensures we don't stall when L1's size is greater than opt.LevelOneSize.
 // We should stall only when L0 tables more than the opt.NumLevelZeroTableStall.
 func TestL1Stall(t *testing.T) {
@@ -1239,6 +1436,98 @@ func TestStaleDataCleanup(t *testing.T) {
 	})
 }
 
+func TestDropExpiredTables(t *testing.T) {
+	opt := DefaultOptions("").WithNumCompactors(0)
+	opt.managedTxns = true
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		expired := uint64(time.Now().Add(-time.Hour).Unix())
+		addTable := func(level int, prefix string, expiresAt uint64) *table.Table {
+			b := table.NewTableBuilder(buildTableOptions(db))
+			defer b.Close()
+			for i := 0; i < 100; i++ {
+				key := y.KeyWithTs([]byte(fmt.Sprintf("%s%03d", prefix, i)), 10)
+				b.Add(key, y.ValueStruct{Value: []byte("val"), ExpiresAt: expiresAt}, 0)
+			}
+			tab, err := table.CreateTable(table.NewFilename(db.lc.reserveFileID(), db.opt.Dir), b)
+			require.NoError(t, err)
+			require.NoError(t, db.manifest.addChanges([]*pb.ManifestChange{
+				newCreateChange(tab.ID(), level, 0, tab.CompressionType()),
+			}))
+			db.lc.levels[level].addTable(tab)
+			db.lc.levels[level].sortTables()
+			return tab
+		}
+		addTable(5, "a", expired)
+		addTable(5, "b", expired)
+		addTable(5, "c", uint64(time.Now().Add(time.Hour).Unix()))
+		// The expired keys of the table of "b" hide the older versions in L6.
+		addTable(6, "b", 0)
+		require.NoError(t, db.lc.validate())
+
+		// The tables can still be read below the discard timestamp.
+		require.False(t, db.lc.dropExpiredTables(0))
+
+		db.SetDiscardTs(10)
+		require.True(t, db.lc.dropExpiredTables(0))
+		require.False(t, db.lc.dropExpiredTables(0))
+		require.Equal(t, 2, db.lc.levels[5].numTables())
+		for _, tab := range db.lc.levels[5].tables {
+			require.NotEqual(t, "a", string(y.ParseKey(tab.Smallest())[:1]))
+		}
+		require.NoError(t, db.View(func(txn *Txn) error {
+			_, err := txn.Get([]byte("b000"))
+			require.Equal(t, ErrKeyNotFound, err)
+			return nil
+		}))
+	})
+}
+
+// addTableAt adds a table holding a single version of key to the given level.
+func addTableAt(t *testing.T, db *DB, level int, key []byte, version uint64, vs y.ValueStruct) {
+	b := table.NewTableBuilder(buildTableOptions(db))
+	defer b.Close()
+	b.Add(y.KeyWithTs(key, version), vs, 0)
+	tab, err := table.CreateTable(table.NewFilename(db.lc.reserveFileID(), db.opt.Dir), b)
+	require.NoError(t, err)
+	require.NoError(t, db.manifest.addChanges([]*pb.ManifestChange{
+		newCreateChange(tab.ID(), level, 0, tab.CompressionType()),
+	}))
+	db.lc.levels[level].addTable(tab)
+	db.lc.levels[level].sortTables()
+}
+
+func TestDropExpiredTablesKeepsBases(t *testing.T) {
+	opt := DefaultOptions("").WithNumCompactors(0)
+	opt.managedTxns = true
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		expired := uint64(time.Now().Add(-time.Hour).Unix())
+		addTable := func(level int, key []byte, version uint64, vs y.ValueStruct) {
+			addTableAt(t, db, level, key, version, vs)
+		}
+		// A delta chain crossing the TTL boundary: the expired version is the base of a newer
+		// version which doesn't expire.
+		base := bytes.Repeat([]byte("0123456789"), 50)
+		val := append(append([]byte{}, base...), "new"...)
+		addTable(5, []byte("d"), 10, y.ValueStruct{Value: base, ExpiresAt: expired})
+		addTable(1, []byte("d"), 20, y.ValueStruct{Value: encodeDelta(10, 1, base, val),
+			Meta: bitDelta})
+		// Merge entries aren't discarded either.
+		addTable(5, []byte("m"), 10, y.ValueStruct{Value: []byte("1"), ExpiresAt: expired,
+			Meta: bitMergeEntry})
+		require.NoError(t, db.lc.validate())
+
+		db.SetDiscardTs(30)
+		require.False(t, db.lc.dropExpiredTables(0))
+		require.Equal(t, 2, db.lc.levels[5].numTables())
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get([]byte("d"))
+			require.NoError(t, err)
+			require.Equal(t, val, getItemValue(t, item))
+			return nil
+		}))
+	})
+}
+
 func TestStreamWithFullCopy(t *testing.T) {
 	dbopts := DefaultOptions("")
 	dbopts.managedTxns = true
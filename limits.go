@@ -0,0 +1,66 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	humanize "github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+
+	"github.com/dgraph-io/badger/v3/y"
+)
+
+// addressSpaceBudget is how much address space the DB may reserve up front, or zero for no limit.
+// On 32-bit platforms, the rest of the 2-3GB of user address space is left to the tables and the
+// value log files, which are mapped at their size, and to the application.
+var addressSpaceBudget = func() int64 {
+	if y.Is32Bit {
+		return 1 << 30
+	}
+	return 0
+}()
+
+// reservedAddressSpace estimates the address space reserved up front by the memtables, their WALs,
+// the value log file being written and the caches.
+func reservedAddressSpace(opt *Options) int64 {
+	perMemtable := arenaSize(*opt)
+	if !opt.InMemory {
+		// The WAL of a memtable is mapped at twice MemTableSize.
+		perMemtable += 2 * opt.MemTableSize
+	}
+	// NumMemtables immutable memtables, plus the one being written.
+	reserved := int64(opt.NumMemtables+1) * perMemtable
+	if !opt.InMemory {
+		// The value log file being written is mapped at twice ValueLogFileSize.
+		reserved += 2 * opt.ValueLogFileSize
+	}
+	return reserved + opt.BlockCacheSize + opt.IndexCacheSize
+}
+
+// checkAddressSpace returns ErrAddressSpace if the options reserve more than budget bytes of
+// address space. A zero budget means no limit.
+func checkAddressSpace(opt *Options, budget int64) error {
+	if budget == 0 {
+		return nil
+	}
+	if reserved := reservedAddressSpace(opt); reserved > budget {
+		return errors.Wrapf(ErrAddressSpace, "the memtables, the value log and the caches would "+
+			"reserve %s out of %s. Lower NumMemtables, MemTableSize, ValueLogFileSize, "+
+			"BlockCacheSize or IndexCacheSize", humanize.IBytes(uint64(reserved)),
+			humanize.IBytes(uint64(budget)))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckAddressSpace(t *testing.T) {
+	opt := DefaultOptions("")
+	require.NoError(t, checkAddressSpace(&opt, 0))
+
+	opt.MemTableSize = 16 << 20
+	opt.NumMemtables = 5
+	opt.ValueLogFileSize = 128 << 20
+	opt.BlockCacheSize = 32 << 20
+	opt.IndexCacheSize = 0
+	require.NoError(t, checkAddressSpace(&opt, 1<<30))
+
+	opt.ValueLogFileSize = 1 << 30
+	err := checkAddressSpace(&opt, 1<<30)
+	require.Error(t, err)
+	require.Equal(t, ErrAddressSpace, errors.Cause(err))
+
+	// The WALs aren't mapped in memory mode.
+	opt.InMemory = true
+	require.NoError(t, checkAddressSpace(&opt, 1<<30))
+}
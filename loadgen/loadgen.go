@@ -0,0 +1,255 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package loadgen generates randomized keys and values to load into Badger, for benchmarks which
+// should model the skew of real workloads rather than writing keys in sequence.
+//
+// Keys are drawn from a key space of Config.Keys keys following a KeyDistribution. With Zipfian,
+// a few keys are drawn much more often than the others, like in most real workloads. The hot keys
+// are scattered over the key space rather than being next to each other. Value sizes follow a
+// ValueDistribution.
+package loadgen
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+
+	"github.com/pkg/errors"
+)
+
+// KeyDistribution is the distribution the keys are drawn from.
+type KeyDistribution int
+
+const (
+	// Uniform draws every key of the key space with the same probability.
+	Uniform KeyDistribution = iota
+	// Zipfian draws the key of rank k with a probability proportional to 1/(k+1)^s, where s is
+	// Config.ZipfS. The keys are ranked by a permutation of the key space.
+	Zipfian
+	// Sequential draws the keys of the key space in ascending order, wrapping around at the end.
+	Sequential
+)
+
+// ValueDistribution is the distribution the value sizes are drawn from.
+type ValueDistribution int
+
+const (
+	// Fixed makes every value Config.ValueSize bytes long.
+	Fixed ValueDistribution = iota
+	// UniformSize draws value sizes uniformly in [1, Config.ValueSize].
+	UniformSize
+	// Exponential draws value sizes exponentially distributed with mean Config.ValueSize, so that
+	// most values are small and a few are large. Sizes are capped at 16 times the mean.
+	Exponential
+)
+
+// ParseKeyDistribution returns the KeyDistribution with the given name: "uniform", "zipfian" or
+// "sequential".
+func ParseKeyDistribution(name string) (KeyDistribution, error) {
+	switch name {
+	case "uniform":
+		return Uniform, nil
+	case "zipfian":
+		return Zipfian, nil
+	case "sequential":
+		return Sequential, nil
+	}
+	return 0, errors.Errorf("unknown key distribution %q", name)
+}
+
+// ParseValueDistribution returns the ValueDistribution with the given name: "fixed", "uniform" or
+// "exponential".
+func ParseValueDistribution(name string) (ValueDistribution, error) {
+	switch name {
+	case "fixed":
+		return Fixed, nil
+	case "uniform":
+		return UniformSize, nil
+	case "exponential":
+		return Exponential, nil
+	}
+	return 0, errors.Errorf("unknown value distribution %q", name)
+}
+
+// Config configures a Generator.
+type Config struct {
+	// Keys is the number of distinct keys in the key space.
+	Keys uint64
+	// KeySize is the size of the keys, at least 8 bytes. The keys are padded with zeroes.
+	KeySize int
+	// KeyDist is the distribution of the keys.
+	KeyDist KeyDistribution
+	// ZipfS is the skew of the Zipfian distribution, greater than 1. The greater, the more skewed.
+	ZipfS float64
+
+	// ValueSize is the size of the values, see ValueDistribution.
+	ValueSize int
+	// ValueDist is the distribution of the value sizes.
+	ValueDist ValueDistribution
+}
+
+// DefaultConfig returns a Config drawing 32 byte keys out of a million with a Zipfian
+// distribution, with values of 128 bytes.
+func DefaultConfig() Config {
+	return Config{
+		Keys:      1000000,
+		KeySize:   32,
+		KeyDist:   Zipfian,
+		ZipfS:     1.1,
+		ValueSize: 128,
+		ValueDist: Fixed,
+	}
+}
+
+func (c Config) validate() error {
+	switch {
+	case c.Keys == 0:
+		return errors.New("the key space can't be empty")
+	case c.KeySize < 8:
+		return errors.Errorf("key size %d is less than 8 bytes", c.KeySize)
+	case c.KeyDist == Zipfian && !(c.ZipfS > 1):
+		return errors.Errorf("zipfian skew %v must be greater than 1", c.ZipfS)
+	case c.ValueSize < 1:
+		return errors.Errorf("value size %d is less than 1 byte", c.ValueSize)
+	case c.KeyDist < Uniform || c.KeyDist > Sequential:
+		return errors.Errorf("unknown key distribution %d", c.KeyDist)
+	case c.ValueDist < Fixed || c.ValueDist > Exponential:
+		return errors.Errorf("unknown value distribution %d", c.ValueDist)
+	}
+	return nil
+}
+
+// Generator generates keys and values following a Config. A Generator isn't safe for concurrent
+// use, concurrent loaders should use a Generator each, with different seeds.
+type Generator struct {
+	cfg  Config
+	rng  *rand.Rand
+	zipf *rand.Zipf
+	next uint64
+	// values holds random bytes which the values are sliced from.
+	values []byte
+}
+
+// New returns a Generator following cfg, whose randomness is seeded with seed.
+func New(cfg Config, seed int64) (*Generator, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	g := &Generator{
+		cfg: cfg,
+		rng: rand.New(rand.NewSource(seed)),
+	}
+	if cfg.KeyDist == Zipfian {
+		g.zipf = rand.NewZipf(g.rng, cfg.ZipfS, 1, cfg.Keys-1)
+	}
+	g.values = make([]byte, 2*g.maxValueSize())
+	g.rng.Read(g.values)
+	return g, nil
+}
+
+func (g *Generator) maxValueSize() int {
+	if g.cfg.ValueDist == Exponential {
+		return 16 * g.cfg.ValueSize
+	}
+	return g.cfg.ValueSize
+}
+
+// KeyIndex draws the index of the next key, in [0, Config.Keys).
+func (g *Generator) KeyIndex() uint64 {
+	switch g.cfg.KeyDist {
+	case Zipfian:
+		return g.scatter(g.zipf.Uint64())
+	case Sequential:
+		idx := g.next
+		g.next = (g.next + 1) % g.cfg.Keys
+		return idx
+	}
+	if g.cfg.Keys&(g.cfg.Keys-1) == 0 {
+		return g.rng.Uint64() & (g.cfg.Keys - 1)
+	}
+	return g.rng.Uint64() % g.cfg.Keys
+}
+
+// scatter maps the rank of a key to its index via a permutation of the key space, so that the
+// hottest keys don't all sit next to each other. It cycle-walks an odd multiplier modulo the next
+// power of two, which is a bijection of [0, Keys).
+func (g *Generator) scatter(rank uint64) uint64 {
+	mask := uint64(1)<<uint(bitLen(g.cfg.Keys-1)) - 1
+	idx := rank
+	for {
+		idx = (idx*0x9E3779B97F4A7C15 + 0x632BE59BD9B4E019) & mask
+		if idx < g.cfg.Keys {
+			return idx
+		}
+	}
+}
+
+func bitLen(x uint64) int {
+	n := 0
+	for ; x != 0; x >>= 1 {
+		n++
+	}
+	return n
+}
+
+// Key returns the key with the given index, appended to dst. Keys sort in the order of their
+// indexes.
+func (g *Generator) Key(dst []byte, idx uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], idx)
+	dst = append(dst, b[:]...)
+	for i := 8; i < g.cfg.KeySize; i++ {
+		dst = append(dst, 0)
+	}
+	return dst
+}
+
+// NextKey draws the next key and appends it to dst.
+func (g *Generator) NextKey(dst []byte) []byte {
+	return g.Key(dst, g.KeyIndex())
+}
+
+// ValueSize draws the size of the next value.
+func (g *Generator) ValueSize() int {
+	switch g.cfg.ValueDist {
+	case UniformSize:
+		return g.rng.Intn(g.cfg.ValueSize) + 1
+	case Exponential:
+		sz := int(math.Ceil(g.rng.ExpFloat64() * float64(g.cfg.ValueSize)))
+		if max := g.maxValueSize(); sz > max {
+			sz = max
+		}
+		if sz < 1 {
+			sz = 1
+		}
+		return sz
+	}
+	return g.cfg.ValueSize
+}
+
+// NextValue draws the next value. Values share a buffer of random bytes which is never written
+// again, so they stay valid but must not be modified.
+func (g *Generator) NextValue() []byte {
+	sz := g.ValueSize()
+	off := g.rng.Intn(len(g.values) - sz + 1)
+	return g.values[off : off+sz]
+}
+
+// Next draws the next key, appended to dst, and value.
+func (g *Generator) Next(dst []byte) (key, value []byte) {
+	return g.NextKey(dst), g.NextValue()
+}
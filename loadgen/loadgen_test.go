@@ -0,0 +1,133 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScatterIsPermutation(t *testing.T) {
+	for _, keys := range []uint64{1, 2, 7, 64, 1000} {
+		g, err := New(Config{Keys: keys, KeySize: 8, KeyDist: Zipfian, ZipfS: 1.5, ValueSize: 1}, 1)
+		require.NoError(t, err)
+		seen := make(map[uint64]bool)
+		for rank := uint64(0); rank < keys; rank++ {
+			idx := g.scatter(rank)
+			require.Less(t, idx, keys)
+			require.False(t, seen[idx], "index %d drawn twice", idx)
+			seen[idx] = true
+		}
+	}
+}
+
+func TestKeyDistributions(t *testing.T) {
+	const keys, draws = 1000, 100000
+	count := func(dist KeyDistribution) []int {
+		cfg := DefaultConfig()
+		cfg.Keys = keys
+		cfg.KeyDist = dist
+		g, err := New(cfg, 1)
+		require.NoError(t, err)
+		counts := make([]int, keys)
+		for i := 0; i < draws; i++ {
+			idx := g.KeyIndex()
+			require.Less(t, idx, uint64(keys))
+			counts[idx]++
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(counts)))
+		return counts
+	}
+
+	// The hottest 1% of the keys get about 1% of the draws with Uniform, and most of them with
+	// Zipfian, about half of them with the default skew.
+	top := func(counts []int) int {
+		n := 0
+		for _, c := range counts[:keys/100] {
+			n += c
+		}
+		return n
+	}
+	require.Less(t, top(count(Uniform)), draws/50)
+	require.Greater(t, top(count(Zipfian)), draws/3)
+
+	for _, c := range count(Sequential) {
+		require.Equal(t, draws/keys, c)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.KeyDist = Sequential
+	g, err := New(cfg, 1)
+	require.NoError(t, err)
+	prev := g.NextKey(nil)
+	require.Len(t, prev, cfg.KeySize)
+	for i := 0; i < 100; i++ {
+		key := g.NextKey(nil)
+		require.Len(t, key, cfg.KeySize)
+		require.Equal(t, -1, bytes.Compare(prev, key))
+		prev = key
+	}
+}
+
+func TestValueSizes(t *testing.T) {
+	for _, dist := range []ValueDistribution{Fixed, UniformSize, Exponential} {
+		cfg := DefaultConfig()
+		cfg.ValueDist = dist
+		g, err := New(cfg, 1)
+		require.NoError(t, err)
+		total := 0
+		for i := 0; i < 10000; i++ {
+			v := g.NextValue()
+			require.GreaterOrEqual(t, len(v), 1)
+			require.LessOrEqual(t, len(v), g.maxValueSize())
+			if dist == Fixed {
+				require.Len(t, v, cfg.ValueSize)
+			}
+			total += len(v)
+		}
+		mean := total / 10000
+		switch dist {
+		case UniformSize:
+			require.InDelta(t, cfg.ValueSize/2, mean, 10)
+		case Exponential:
+			require.InDelta(t, cfg.ValueSize, mean, 10)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ZipfS = 1
+	_, err := New(cfg, 1)
+	require.Error(t, err)
+
+	cfg = DefaultConfig()
+	cfg.KeySize = 4
+	_, err = New(cfg, 1)
+	require.Error(t, err)
+
+	_, err = ParseKeyDistribution("gaussian")
+	require.Error(t, err)
+	dist, err := ParseValueDistribution("exponential")
+	require.NoError(t, err)
+	require.Equal(t, Exponential, dist)
+}
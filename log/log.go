@@ -0,0 +1,297 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package log provides named append-only logs on top of a Badger DB. Every record appended to a
+// log gets the next offset of the log, starting from 0. Records can be read back by offset, and
+// the head of a log can be truncated to drop old records, similar to a Kafka partition.
+//
+// Each record is stored under its own key, made of the name of the log followed by the offset in
+// big endian, so the records of a log are sorted by offset. Truncated records are deleted via
+// DB.DropRange. A log must only be written to by a single Log value at a time, which assigns the
+// offsets.
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidName is returned when the name of a log is empty or contains a zero byte.
+	ErrInvalidName = errors.New("Log name must be non-empty and must not contain a zero byte")
+
+	// ErrTruncated is returned when reading an offset which has been truncated.
+	ErrTruncated = errors.New("Offset has been truncated")
+
+	// ErrOutOfRange is returned when reading an offset which hasn't been written yet.
+	ErrOutOfRange = errors.New("Offset is out of range")
+)
+
+// keyPrefix is the prefix of all the keys written by this package.
+var keyPrefix = []byte("!log!")
+
+// The keys of a log are the key prefix, the name, a zero byte and one of these tags. Record keys
+// are followed by the offset.
+const (
+	recordTag = 'r'
+	startTag  = 's'
+)
+
+// Record is a record read from a log.
+type Record struct {
+	Offset uint64
+	Value  []byte
+}
+
+// Log is a named append-only log. It is safe for concurrent use.
+type Log struct {
+	db   *badger.DB
+	name string
+	base []byte
+
+	sync.Mutex
+	start uint64 // The first offset which hasn't been truncated.
+	next  uint64 // The offset of the next record to be appended.
+}
+
+// Open opens the log with the given name in db, creating it if it doesn't exist.
+func Open(db *badger.DB, name string) (*Log, error) {
+	if len(name) == 0 || bytes.IndexByte([]byte(name), 0) >= 0 {
+		return nil, ErrInvalidName
+	}
+	l := &Log{
+		db:   db,
+		name: name,
+		base: logKey(name),
+	}
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(l.startKey())
+		switch {
+		case err == badger.ErrKeyNotFound:
+		case err != nil:
+			return err
+		default:
+			if err := item.Value(func(val []byte) error {
+				l.start = binary.BigEndian.Uint64(val)
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		l.next = l.start
+
+		// The next offset is one after the last record.
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+		opt.Reverse = true
+		opt.Prefix = l.recordPrefix()
+		itr := txn.NewIterator(opt)
+		defer itr.Close()
+		itr.Seek(l.recordKey(^uint64(0)))
+		if itr.Valid() {
+			if off := l.offset(itr.Item().Key()) + 1; off > l.next {
+				l.next = off
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "while opening log %q", name)
+	}
+	return l, nil
+}
+
+// Name returns the name of the log.
+func (l *Log) Name() string {
+	return l.name
+}
+
+// Offsets returns the first offset which can be read and the offset which the next record will
+// get. The log is empty if both are equal.
+func (l *Log) Offsets() (first, next uint64) {
+	l.Lock()
+	defer l.Unlock()
+	return l.start, l.next
+}
+
+func logKey(name string) []byte {
+	key := append(append([]byte{}, keyPrefix...), name...)
+	return append(key, 0)
+}
+
+func (l *Log) recordPrefix() []byte {
+	return append(append([]byte{}, l.base...), recordTag)
+}
+
+func (l *Log) recordKey(offset uint64) []byte {
+	key := l.recordPrefix()
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], offset)
+	return append(key, buf[:]...)
+}
+
+func (l *Log) startKey() []byte {
+	return append(append([]byte{}, l.base...), startTag)
+}
+
+func (l *Log) offset(key []byte) uint64 {
+	return binary.BigEndian.Uint64(key[len(key)-8:])
+}
+
+// Append appends the values to the log in a single transaction and returns the offset of the
+// first one. The values get consecutive offsets. It returns badger.ErrTxnTooBig if the values
+// don't fit in a single transaction.
+func (l *Log) Append(values ...[]byte) (uint64, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	first := l.next
+	err := l.db.Update(func(txn *badger.Txn) error {
+		for i, val := range values {
+			if err := txn.Set(l.recordKey(first+uint64(i)), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "while appending to log %q", l.name)
+	}
+	l.next += uint64(len(values))
+	return first, nil
+}
+
+// Get returns the value of the record at the given offset. It returns ErrTruncated if the offset
+// has been truncated, and ErrOutOfRange if it hasn't been written yet.
+func (l *Log) Get(offset uint64) ([]byte, error) {
+	if _, next := l.Offsets(); offset >= next {
+		return nil, ErrOutOfRange
+	}
+	recs, err := l.Read(offset, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, ErrTruncated
+	}
+	return recs[0].Value, nil
+}
+
+// Read returns up to max records starting from the given offset. It returns ErrTruncated if the
+// offset has been truncated, and ErrOutOfRange if the offset is beyond the next offset of the log.
+// Reading the next offset returns no records.
+func (l *Log) Read(offset uint64, max int) ([]Record, error) {
+	first, next := l.Offsets()
+	switch {
+	case offset < first:
+		return nil, ErrTruncated
+	case offset > next:
+		return nil, ErrOutOfRange
+	}
+
+	var recs []Record
+	err := l.db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.Prefix = l.recordPrefix()
+		itr := txn.NewIterator(opt)
+		defer itr.Close()
+
+		for itr.Seek(l.recordKey(offset)); itr.Valid() && len(recs) < max; itr.Next() {
+			item := itr.Item()
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			recs = append(recs, Record{Offset: l.offset(item.Key()), Value: val})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "while reading log %q", l.name)
+	}
+	// A concurrent truncation may have removed the records.
+	if len(recs) > 0 && recs[0].Offset != offset {
+		return nil, ErrTruncated
+	}
+	return recs, nil
+}
+
+// Truncate drops all the records with an offset lower than the given one. Truncating beyond the
+// next offset drops all the records, and the next record appended gets the given offset.
+func (l *Log) Truncate(before uint64) error {
+	l.Lock()
+	defer l.Unlock()
+	if before <= l.start {
+		return nil
+	}
+
+	// Persist the new start first, so that the truncated records are never visible again even if
+	// dropping them fails midway.
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], before)
+	if err := l.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(l.startKey(), buf[:])
+	}); err != nil {
+		return errors.Wrapf(err, "while truncating log %q", l.name)
+	}
+	start := l.start
+	l.start = before
+	if before > l.next {
+		l.next = before
+	}
+	if err := l.db.DropRange(l.recordKey(start), l.recordKey(before)); err != nil {
+		return errors.Wrapf(err, "while truncating log %q", l.name)
+	}
+	return nil
+}
+
+// Drop deletes the log with all its records. The Log must not be used afterwards.
+func (l *Log) Drop() error {
+	l.Lock()
+	defer l.Unlock()
+	if err := l.db.DropPrefix(l.base); err != nil {
+		return errors.Wrapf(err, "while dropping log %q", l.name)
+	}
+	return nil
+}
+
+// Names returns the names of all the logs in db, including empty ones which have been truncated.
+func Names(db *badger.DB) ([]string, error) {
+	var names []string
+	err := db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+		opt.Prefix = keyPrefix
+		itr := txn.NewIterator(opt)
+		defer itr.Close()
+
+		for itr.Rewind(); itr.Valid(); {
+			rest := itr.Item().Key()[len(keyPrefix):]
+			name := string(rest[:bytes.IndexByte(rest, 0)])
+			names = append(names, name)
+			// Skip over all the other keys of this log.
+			next := logKey(name)
+			next[len(next)-1] = 1
+			itr.Seek(next)
+		}
+		return nil
+	})
+	return names, err
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package log
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = Open(db, "bad\x00name")
+	require.Equal(t, ErrInvalidName, err)
+
+	l, err := Open(db, "events")
+	require.NoError(t, err)
+	other, err := Open(db, "events2")
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		off, err := l.Append([]byte(fmt.Sprintf("event%d", i)))
+		require.NoError(t, err)
+		require.Equal(t, uint64(i), off)
+	}
+	off, err := other.Append([]byte("a"), []byte("b"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), off)
+
+	val, err := l.Get(3)
+	require.NoError(t, err)
+	require.Equal(t, []byte("event3"), val)
+	_, err = l.Get(10)
+	require.Equal(t, ErrOutOfRange, err)
+
+	recs, err := l.Read(8, 5)
+	require.NoError(t, err)
+	require.Equal(t, []Record{{8, []byte("event8")}, {9, []byte("event9")}}, recs)
+	recs, err = l.Read(10, 5)
+	require.NoError(t, err)
+	require.Empty(t, recs)
+
+	require.NoError(t, l.Truncate(5))
+	_, err = l.Get(4)
+	require.Equal(t, ErrTruncated, err)
+	first, next := l.Offsets()
+	require.Equal(t, uint64(5), first)
+	require.Equal(t, uint64(10), next)
+
+	// The offsets survive reopening the log.
+	l, err = Open(db, "events")
+	require.NoError(t, err)
+	first, next = l.Offsets()
+	require.Equal(t, uint64(5), first)
+	require.Equal(t, uint64(10), next)
+
+	// Truncating everything keeps the offsets increasing.
+	require.NoError(t, l.Truncate(20))
+	off, err = l.Append([]byte("event20"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), off)
+
+	names, err := Names(db)
+	require.NoError(t, err)
+	require.Equal(t, []string{"events", "events2"}, names)
+
+	require.NoError(t, other.Drop())
+	names, err = Names(db)
+	require.NoError(t, err)
+	require.Equal(t, []string{"events"}, names)
+}
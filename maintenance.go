@@ -0,0 +1,199 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MaintenanceWindow is a recurring period of time in which the DB may run its heavy maintenance:
+// the compactions below level 0, the value log GC and the checksum verification. See
+// Options.WithMaintenanceWindows.
+type MaintenanceWindow struct {
+	// Days are the days on which the window starts. The window starts every day if Days is empty.
+	Days []time.Weekday
+	// Start is the time of the day at which the window starts, as a duration since midnight in
+	// the local time zone.
+	Start time.Duration
+	// Duration is the length of the window. A window can span midnight.
+	Duration time.Duration
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseMaintenanceWindow parses a window written as "<days> <start>-<end>", like a crontab entry.
+// The days are either "*" for every day, or a comma separated list of days and ranges of days,
+// e.g. "mon-fri,sun". The start and end are times of the day, written as "15:04". A window ending
+// at or before its start ends on the next day, e.g. "sat 22:00-02:00".
+func ParseMaintenanceWindow(s string) (MaintenanceWindow, error) {
+	var w MaintenanceWindow
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return w, errors.Errorf("maintenance window %q should be <days> <start>-<end>", s)
+	}
+	if fields[0] != "*" {
+		for _, days := range strings.Split(fields[0], ",") {
+			bounds := strings.SplitN(days, "-", 2)
+			first, err := parseWeekday(bounds[0])
+			if err != nil {
+				return w, err
+			}
+			last := first
+			if len(bounds) == 2 {
+				if last, err = parseWeekday(bounds[1]); err != nil {
+					return w, err
+				}
+			}
+			for d := first; ; d = (d + 1) % 7 {
+				w.Days = append(w.Days, d)
+				if d == last {
+					break
+				}
+			}
+		}
+	}
+	times := strings.SplitN(fields[1], "-", 2)
+	if len(times) != 2 {
+		return w, errors.Errorf("maintenance window %q should be <days> <start>-<end>", s)
+	}
+	start, err := parseTimeOfDay(times[0])
+	if err != nil {
+		return w, err
+	}
+	end, err := parseTimeOfDay(times[1])
+	if err != nil {
+		return w, err
+	}
+	if end <= start {
+		end += 24 * time.Hour
+	}
+	w.Start, w.Duration = start, end-start
+	return w, nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	for i, day := range weekdays {
+		if strings.ToLower(s) == day {
+			return time.Weekday(i), nil
+		}
+	}
+	return 0, errors.Errorf("invalid day %q in maintenance window", s)
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.Errorf("invalid time %q in maintenance window", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w MaintenanceWindow) validate() error {
+	if w.Start < 0 || w.Start >= 24*time.Hour || w.Duration <= 0 {
+		return errors.Errorf("invalid maintenance window %+v", w)
+	}
+	return nil
+}
+
+func (w MaintenanceWindow) startsOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// contains tells if t is within an occurrence of the window.
+func (w MaintenanceWindow) contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	// Look for an occurrence started on one of the previous days, for windows spanning midnight.
+	for back := 0; back <= int(w.Duration/(24*time.Hour))+1; back++ {
+		day := midnight.AddDate(0, 0, -back)
+		start := day.Add(w.Start)
+		if w.startsOn(day.Weekday()) && !t.Before(start) && t.Before(start.Add(w.Duration)) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaintenanceMode tells when the DB may run its heavy maintenance. See DB.SetMaintenanceMode.
+type MaintenanceMode int32
+
+const (
+	// MaintenanceScheduled runs the maintenance in the maintenance windows of the options, or any
+	// time if there are none. This is the default.
+	MaintenanceScheduled MaintenanceMode = iota
+	// MaintenanceAllowed runs the maintenance now, whatever the windows.
+	MaintenanceAllowed
+	// MaintenanceSuspended doesn't run any maintenance, whatever the windows.
+	MaintenanceSuspended
+)
+
+type maintenance struct {
+	windows []MaintenanceWindow
+	mode    int32 // MaintenanceMode, accessed atomically.
+	now     func() time.Time
+}
+
+func newMaintenance(windows []MaintenanceWindow) *maintenance {
+	return &maintenance{windows: windows, now: time.Now}
+}
+
+// allowed tells if the heavy maintenance may run now.
+func (m *maintenance) allowed() bool {
+	if m == nil {
+		return true
+	}
+	switch MaintenanceMode(atomic.LoadInt32(&m.mode)) {
+	case MaintenanceAllowed:
+		return true
+	case MaintenanceSuspended:
+		return false
+	}
+	if len(m.windows) == 0 {
+		return true
+	}
+	now := m.now()
+	for _, w := range m.windows {
+		if w.contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMaintenanceMode overrides the maintenance windows of the options, e.g. to run a value log GC
+// outside of the windows, or to suspend the maintenance during a traffic peak. The compactions
+// of level 0 always run, as the writes would stall otherwise.
+func (db *DB) SetMaintenanceMode(mode MaintenanceMode) {
+	atomic.StoreInt32(&db.maintenance.mode, int32(mode))
+}
+
+// MaintenanceAllowed tells if the DB may run its heavy maintenance now. See
+// Options.WithMaintenanceWindows.
+func (db *DB) MaintenanceAllowed() bool {
+	return db.maintenance.allowed()
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	w, err := ParseMaintenanceWindow("* 02:00-04:30")
+	require.NoError(t, err)
+	require.Equal(t, MaintenanceWindow{Start: 2 * time.Hour, Duration: 150 * time.Minute}, w)
+
+	w, err = ParseMaintenanceWindow("fri-mon,Wed 22:00-02:00")
+	require.NoError(t, err)
+	require.Equal(t, MaintenanceWindow{
+		Days: []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday,
+			time.Wednesday},
+		Start:    22 * time.Hour,
+		Duration: 4 * time.Hour,
+	}, w)
+
+	for _, s := range []string{"", "* 02:00", "mon 25:00-26:00", "someday 01:00-02:00",
+		"mon 01:00-02:00 extra"} {
+		_, err := ParseMaintenanceWindow(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	w, err := ParseMaintenanceWindow("sat 22:00-02:00")
+	require.NoError(t, err)
+	// 2021-01-02 is a Saturday.
+	at := func(day, hour int) time.Time { return time.Date(2021, 1, day, hour, 30, 0, 0, time.UTC) }
+	require.False(t, w.contains(at(2, 21)))
+	require.True(t, w.contains(at(2, 22)))
+	require.True(t, w.contains(at(3, 1)))
+	require.False(t, w.contains(at(3, 2)))
+	require.False(t, w.contains(at(3, 22)))
+	require.True(t, w.contains(at(9, 23)))
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	w, err := ParseMaintenanceWindow("* 02:00-03:00")
+	require.NoError(t, err)
+	// No compactors, as the test replaces the clock.
+	opt := getTestOptions("").WithMaintenanceWindows(w).WithNumCompactors(0)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		now := time.Date(2021, 1, 2, 12, 0, 0, 0, time.Local)
+		db.maintenance.now = func() time.Time { return now }
+		require.False(t, db.MaintenanceAllowed())
+		require.Equal(t, ErrMaintenanceWindow, db.RunValueLogGC(0.5))
+		require.Equal(t, ErrMaintenanceWindow, db.VerifyChecksum())
+
+		db.SetMaintenanceMode(MaintenanceAllowed)
+		require.True(t, db.MaintenanceAllowed())
+		require.Equal(t, ErrNoRewrite, db.RunValueLogGC(0.5))
+		require.NoError(t, db.VerifyChecksum())
+
+		db.SetMaintenanceMode(MaintenanceScheduled)
+		now = time.Date(2021, 1, 2, 2, 30, 0, 0, time.Local)
+		require.True(t, db.MaintenanceAllowed())
+		db.SetMaintenanceMode(MaintenanceSuspended)
+		require.False(t, db.MaintenanceAllowed())
+	})
+
+	opt = getTestOptions("").WithMaintenanceWindows(MaintenanceWindow{Start: time.Hour})
+	_, err = Open(opt)
+	require.Error(t, err)
+}
@@ -16,6 +16,8 @@
 
 package badger
 
+import "github.com/dgraph-io/badger/v3/y"
+
 // OpenManaged returns a new DB, which allows more control over setting
 // transaction timestamps, aka managed mode.
 //
@@ -40,6 +42,34 @@ func (db *DB) NewTransactionAt(readTs uint64, update bool) *Txn {
 	return txn
 }
 
+// NewReadTxnAt follows the same logic as DB.NewReadTxn, but uses the provided read timestamp.
+//
+// This is only useful for databases built on top of Badger (like Dgraph), and
+// can be ignored by most users.
+func (db *DB) NewReadTxnAt(readTs uint64) *ReadTxn {
+	if !db.opt.managedTxns {
+		panic("Cannot use NewReadTxnAt with managedDB=false. Use NewReadTxn instead.")
+	}
+	return newReadTxn(db.NewTransactionAt(readTs, false))
+}
+
+// CreateSnapshotAt follows the same logic as DB.CreateSnapshot, but uses the provided read
+// timestamp. The read timestamp can't be below the discard timestamp of the DB, whose versions
+// might already be discarded. The snapshot holds the discard timestamp at its read timestamp.
+//
+// This is only useful for databases built on top of Badger (like Dgraph), and
+// can be ignored by most users.
+func (db *DB) CreateSnapshotAt(name string, readTs uint64) error {
+	if !db.opt.managedTxns {
+		panic("Cannot use CreateSnapshotAt with managedDB=false. Use CreateSnapshot instead.")
+	}
+	if discardTs := db.orc.discardAtOrBelow(); readTs < discardTs {
+		return y.Wrapf(ErrInvalidRequest,
+			"snapshot read ts %d is below the discard ts %d", readTs, discardTs)
+	}
+	return db.createSnapshot(name, readTs)
+}
+
 // NewWriteBatchAt is similar to NewWriteBatch but it allows user to set the commit timestamp.
 // NewWriteBatchAt is supposed to be used only in the managed mode.
 func (db *DB) NewWriteBatchAt(commitTs uint64) *WriteBatch {
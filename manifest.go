@@ -29,6 +29,7 @@ import (
 
 	"github.com/dgraph-io/badger/v3/options"
 	"github.com/dgraph-io/badger/v3/pb"
+	"github.com/dgraph-io/badger/v3/vfs"
 	"github.com/dgraph-io/badger/v3/y"
 	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
@@ -45,6 +46,8 @@ import (
 type Manifest struct {
 	Levels []levelManifest
 	Tables map[uint64]TableManifest
+	// Dicts holds the zstd dictionaries by ID. See DB.TrainDictionaries.
+	Dicts map[uint32]DictManifest
 
 	// Contains total number of creation and deletion changes in the manifest -- used to compute
 	// whether it'd be useful to rewrite the manifest.
@@ -57,6 +60,7 @@ func createManifest() Manifest {
 	return Manifest{
 		Levels: levels,
 		Tables: make(map[uint64]TableManifest),
+		Dicts:  make(map[uint32]DictManifest),
 	}
 }
 
@@ -74,10 +78,19 @@ type TableManifest struct {
 	Compression options.CompressionType
 }
 
+// DictManifest contains a zstd dictionary in the MANIFEST file.
+type DictManifest struct {
+	// Namespace is the namespace whose values the dictionary was trained on, or empty if it was
+	// trained on the values of all namespaces.
+	Namespace []byte
+	Dict      []byte
+}
+
 // manifestFile holds the file pointer (and other info) about the manifest file, which is a log
 // file we append to.
 type manifestFile struct {
-	fp        *os.File
+	fp        vfs.File
+	fs        vfs.FS
 	directory string
 	// We make this configurable so that unit tests can hit rewrite() code quickly
 	deletionsRewriteThreshold int
@@ -103,7 +116,10 @@ const (
 // asChanges returns a sequence of changes that could be used to recreate the Manifest in its
 // present state.
 func (m *Manifest) asChanges() []*pb.ManifestChange {
-	changes := make([]*pb.ManifestChange, 0, len(m.Tables))
+	changes := make([]*pb.ManifestChange, 0, len(m.Dicts)+len(m.Tables))
+	for id, dm := range m.Dicts {
+		changes = append(changes, newCreateDictChange(id, dm.Namespace, dm.Dict))
+	}
 	for id, tm := range m.Tables {
 		changes = append(changes, newCreateChange(id, int(tm.Level), tm.KeyID, tm.Compression))
 	}
@@ -124,18 +140,22 @@ func openOrCreateManifestFile(opt Options) (
 	if opt.InMemory {
 		return &manifestFile{inMemory: true, manifest: createManifest()}, Manifest{}, nil
 	}
-	return helpOpenOrCreateManifestFile(opt.Dir, opt.ReadOnly, manifestDeletionsRewriteThreshold)
+	return helpOpenOrCreateManifestFile(opt.FS, opt.Dir, opt.ReadOnly, opt.allowUpgrade,
+		manifestDeletionsRewriteThreshold)
 }
 
-func helpOpenOrCreateManifestFile(dir string, readOnly bool, deletionsThreshold int) (
-	*manifestFile, Manifest, error) {
+// helpOpenOrCreateManifestFile opens the manifest file in dir, or creates it. With allowUpgrade,
+// a manifest older than the current version is read anyway, to upgrade the DB. See Upgrade.
+func helpOpenOrCreateManifestFile(fs vfs.FS, dir string, readOnly, allowUpgrade bool,
+	deletionsThreshold int) (*manifestFile, Manifest, error) {
 
 	path := filepath.Join(dir, ManifestFilename)
 	var flags y.Flags
 	if readOnly {
 		flags |= y.ReadOnly
 	}
-	fp, err := y.OpenExistingFile(path, flags) // We explicitly sync in addChanges, outside the lock.
+	// We explicitly sync in addChanges, outside the lock.
+	fp, err := openExistingFile(fs, path, flags)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			return nil, Manifest{}, err
@@ -144,13 +164,14 @@ func helpOpenOrCreateManifestFile(dir string, readOnly bool, deletionsThreshold
 			return nil, Manifest{}, fmt.Errorf("no manifest found, required for read-only db")
 		}
 		m := createManifest()
-		fp, netCreations, err := helpRewrite(dir, &m)
+		fp, netCreations, err := helpRewrite(fs, dir, &m)
 		if err != nil {
 			return nil, Manifest{}, err
 		}
 		y.AssertTrue(netCreations == 0)
 		mf := &manifestFile{
 			fp:                        fp,
+			fs:                        fs,
 			directory:                 dir,
 			manifest:                  m.clone(),
 			deletionsRewriteThreshold: deletionsThreshold,
@@ -158,7 +179,7 @@ func helpOpenOrCreateManifestFile(dir string, readOnly bool, deletionsThreshold
 		return mf, m, nil
 	}
 
-	manifest, truncOffset, err := ReplayManifestFile(fp)
+	manifest, truncOffset, err := replayManifestFile(fp, allowUpgrade)
 	if err != nil {
 		_ = fp.Close()
 		return nil, Manifest{}, err
@@ -178,6 +199,7 @@ func helpOpenOrCreateManifestFile(dir string, readOnly bool, deletionsThreshold
 
 	mf := &manifestFile{
 		fp:                        fp,
+		fs:                        fs,
 		directory:                 dir,
 		manifest:                  manifest.clone(),
 		deletionsRewriteThreshold: deletionsThreshold,
@@ -240,10 +262,10 @@ var magicText = [4]byte{'B', 'd', 'g', 'r'}
 // The magic version number.
 const magicVersion = 8
 
-func helpRewrite(dir string, m *Manifest) (*os.File, int, error) {
+func helpRewrite(fs vfs.FS, dir string, m *Manifest) (vfs.File, int, error) {
 	rewritePath := filepath.Join(dir, manifestRewriteFilename)
 	// We explicitly sync.
-	fp, err := y.OpenTruncFile(rewritePath, false)
+	fp, err := openTruncFile(fs, rewritePath, false)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -280,10 +302,10 @@ func helpRewrite(dir string, m *Manifest) (*os.File, int, error) {
 		return nil, 0, err
 	}
 	manifestPath := filepath.Join(dir, ManifestFilename)
-	if err := os.Rename(rewritePath, manifestPath); err != nil {
+	if err := fs.Rename(rewritePath, manifestPath); err != nil {
 		return nil, 0, err
 	}
-	fp, err = y.OpenExistingFile(manifestPath, 0)
+	fp, err = openExistingFile(fs, manifestPath, 0)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -291,7 +313,7 @@ func helpRewrite(dir string, m *Manifest) (*os.File, int, error) {
 		fp.Close()
 		return nil, 0, err
 	}
-	if err := syncDir(dir); err != nil {
+	if err := fs.SyncDir(dir); err != nil {
 		fp.Close()
 		return nil, 0, err
 	}
@@ -305,7 +327,7 @@ func (mf *manifestFile) rewrite() error {
 	if err := mf.fp.Close(); err != nil {
 		return err
 	}
-	fp, netCreations, err := helpRewrite(mf.directory, &mf.manifest)
+	fp, netCreations, err := helpRewrite(mf.fs, mf.directory, &mf.manifest)
 	if err != nil {
 		return err
 	}
@@ -345,7 +367,11 @@ var (
 // Also, returns the last offset after a completely read manifest entry -- the file must be
 // truncated at that point before further appends are made (if there is a partial entry after
 // that).  In normal conditions, truncOffset is the file size.
-func ReplayManifestFile(fp *os.File) (Manifest, int64, error) {
+func ReplayManifestFile(fp vfs.File) (Manifest, int64, error) {
+	return replayManifestFile(fp, false)
+}
+
+func replayManifestFile(fp vfs.File, allowUpgrade bool) (Manifest, int64, error) {
 	r := countingReader{wrapped: bufio.NewReader(fp)}
 
 	var magicBuf [8]byte
@@ -356,7 +382,11 @@ func ReplayManifestFile(fp *os.File) (Manifest, int64, error) {
 		return Manifest{}, 0, errBadMagic
 	}
 	version := y.BytesToU32(magicBuf[4:8])
-	if version != magicVersion {
+	if version < magicVersion && !allowUpgrade {
+		return Manifest{}, 0, errors.Wrapf(ErrOpenRequiresUpgrade,
+			"manifest has version: %d (we support %d)", version, magicVersion)
+	}
+	if version > magicVersion {
 		return Manifest{}, 0,
 			//nolint:lll
 			fmt.Errorf("manifest has unsupported version: %d (we support %d).\n"+
@@ -397,7 +427,8 @@ func ReplayManifestFile(fp *os.File) (Manifest, int64, error) {
 			return Manifest{}, 0, err
 		}
 		if crc32.Checksum(buf, y.CastagnoliCrcTable) != y.BytesToU32(lenCrcBuf[4:8]) {
-			return Manifest{}, 0, errBadChecksum
+			return Manifest{}, 0, &y.CorruptionError{File: fp.Name(), Offset: offset,
+				Err: errBadChecksum}
 		}
 
 		var changeSet pb.ManifestChangeSet
@@ -437,6 +468,11 @@ func applyManifestChange(build *Manifest, tc *pb.ManifestChange) error {
 		delete(build.Levels[tm.Level].Tables, tc.Id)
 		delete(build.Tables, tc.Id)
 		build.Deletions++
+	case pb.ManifestChange_CREATE_DICT:
+		if _, ok := build.Dicts[uint32(tc.Id)]; ok {
+			return fmt.Errorf("MANIFEST invalid, dictionary %d exists", tc.Id)
+		}
+		build.Dicts[uint32(tc.Id)] = DictManifest{Namespace: tc.Namespace, Dict: tc.Dict}
 	default:
 		return fmt.Errorf("MANIFEST file has invalid manifestChange op")
 	}
@@ -467,6 +503,15 @@ func newCreateChange(
 	}
 }
 
+func newCreateDictChange(id uint32, namespace, dict []byte) *pb.ManifestChange {
+	return &pb.ManifestChange{
+		Id:        uint64(id),
+		Op:        pb.ManifestChange_CREATE_DICT,
+		Dict:      dict,
+		Namespace: namespace,
+	}
+}
+
 func newDeleteChange(id uint64) *pb.ManifestChange {
 	return &pb.ManifestChange{
 		Id: id,
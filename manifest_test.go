@@ -31,6 +31,7 @@ import (
 	"github.com/dgraph-io/badger/v3/options"
 	"github.com/dgraph-io/badger/v3/pb"
 	"github.com/dgraph-io/badger/v3/table"
+	"github.com/dgraph-io/badger/v3/vfs"
 	"github.com/dgraph-io/badger/v3/y"
 	"github.com/stretchr/testify/require"
 )
@@ -53,7 +54,7 @@ func TestManifestBasic(t *testing.T) {
 			txnSet(t, kv, k, k, 0x00)
 		}
 		txnSet(t, kv, []byte("testkey"), []byte("testval"), 0x05)
-		kv.validate()
+		kv.Validate()
 		require.NoError(t, kv.Close())
 	}
 
@@ -213,7 +214,7 @@ func TestManifestRewrite(t *testing.T) {
 	require.NoError(t, err)
 	defer removeDir(dir)
 	deletionsThreshold := 10
-	mf, m, err := helpOpenOrCreateManifestFile(dir, false, deletionsThreshold)
+	mf, m, err := helpOpenOrCreateManifestFile(vfs.OS, dir, false, false, deletionsThreshold)
 	defer func() {
 		if mf != nil {
 			mf.close()
@@ -239,7 +240,7 @@ func TestManifestRewrite(t *testing.T) {
 	err = mf.close()
 	require.NoError(t, err)
 	mf = nil
-	mf, m, err = helpOpenOrCreateManifestFile(dir, false, deletionsThreshold)
+	mf, m, err = helpOpenOrCreateManifestFile(vfs.OS, dir, false, false, deletionsThreshold)
 	require.NoError(t, err)
 	require.Equal(t, map[uint64]TableManifest{
 		uint64(deletionsThreshold * 3): {Level: 0},
@@ -25,7 +25,6 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
@@ -48,6 +47,7 @@ type memTable struct {
 	// TODO: Give skiplist z.Calloc'd []byte.
 	sl         *skl.Skiplist
 	wal        *logFile
+	walKept    bool // Set if the WAL is kept for an in-memory L0 table, see l0WALs.
 	maxVersion uint64
 	opt        Options
 	buf        *bytes.Buffer
@@ -58,7 +58,7 @@ func (db *DB) openMemTables(opt Options) error {
 	if db.opt.InMemory {
 		return nil
 	}
-	files, err := ioutil.ReadDir(db.opt.Dir)
+	files, err := db.opt.FS.ReadDir(db.opt.Dir)
 	if err != nil {
 		return errFile(err, db.opt.Dir, "Unable to open mem dir.")
 	}
@@ -135,8 +135,22 @@ func (db *DB) openMemTable(fid, flags int) (*memTable, error) {
 	// Have a callback set to delete WAL when skiplist reference count goes down to zero. That is,
 	// when it gets flushed to L0.
 	s.OnClose = func() {
+		if mt.walKept {
+			return
+		}
 		if err := mt.wal.Delete(); err != nil {
 			db.opt.Errorf("while deleting file: %s, err: %v", filepath, err)
+			return
+		}
+		// Don't let a crash bring back the memtable file, which could resurrect dropped data.
+		if err := db.syncDir(db.opt.Dir); err != nil {
+			db.opt.Errorf("while syncing dir after deleting file: %s, err: %v", filepath, err)
+		}
+	}
+
+	if lerr == z.NewFile {
+		if err := db.syncDir(db.opt.Dir); err != nil {
+			return nil, y.Wrapf(err, "while syncing dir for memtable: %s", filepath)
 		}
 	}
 
@@ -168,6 +182,9 @@ func (db *DB) mtFilePath(fid int) string {
 }
 
 func (mt *memTable) SyncWAL() error {
+	// The WAL could be kept for an in-memory L0 table, and deleted with it.
+	mt.wal.lock.RLock()
+	defer mt.wal.lock.RUnlock()
 	return mt.wal.Sync()
 }
 
@@ -221,6 +238,11 @@ func (mt *memTable) UpdateSkipList() error {
 		return y.Wrapf(err, "while iterating wal: %s", mt.wal.Fd.Name())
 	}
 	if endOff < mt.wal.size && mt.opt.ReadOnly {
+		if mt.opt.BypassLockGuard {
+			// Another process may be writing the WAL, so its tail isn't garbage. Read the
+			// entries written so far, without truncating.
+			return nil
+		}
 		return y.Wrapf(ErrTruncateNeeded, "end offset: %d < size: %d", endOff, mt.wal.size)
 	}
 	return mt.wal.Truncate(int64(endOff))
@@ -423,8 +445,9 @@ func (lf *logFile) generateIV(offset uint32) []byte {
 	return iv
 }
 
-func (lf *logFile) doneWriting(offset uint32) error {
-	if lf.opt.SyncWrites {
+// doneWriting syncs the log file if sync is set, and truncates it to offset once it is full.
+func (lf *logFile) doneWriting(offset uint32, sync bool) error {
+	if sync {
 		if err := lf.Sync(); err != nil {
 			return y.Wrapf(err, "Unable to sync value log: %q", lf.path)
 		}
@@ -553,12 +576,15 @@ func (lf *logFile) zeroNextEntry() {
 }
 
 func (lf *logFile) open(path string, flags int, fsize int64) error {
-	mf, ferr := z.OpenMmapFile(path, flags, int(fsize))
+	if int64(int(fsize)) != fsize {
+		return errors.Wrapf(ErrAddressSpace, "cannot map %s with %d bytes", path, fsize)
+	}
+	mf, ferr := lf.opt.FS.OpenMmapFile(path, flags, int(fsize))
 	lf.MmapFile = mf
 
 	if ferr == z.NewFile {
 		if err := lf.bootstrap(); err != nil {
-			os.Remove(path)
+			lf.opt.FS.Remove(path)
 			return err
 		}
 		lf.size = vlogHeaderSize
@@ -0,0 +1,235 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package objstore
+
+import (
+	"container/list"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Cache keeps local copies of the files of another FileSystem, usually a remote one like S3, in a
+// directory. The least recently used copies are evicted once they take more than the configured
+// number of bytes. Writes go through to the other FileSystem before Put returns, so losing the
+// cache directory loses no data.
+type Cache struct {
+	fs       FileSystem
+	dir      string
+	maxBytes int64
+
+	// fetchMu serializes the downloads of missing files.
+	fetchMu sync.Mutex
+
+	sync.Mutex
+	lru     *list.List // of *cacheEntry, the most recently used first.
+	entries map[string]*list.Element
+	size    int64
+}
+
+type cacheEntry struct {
+	name string
+	size int64
+}
+
+var _ FileSystem = (*Cache)(nil)
+
+// NewCache returns a Cache of fs, keeping at most maxBytes of local copies in dir. The copies
+// already in dir, left by a previous Cache, are reused.
+func NewCache(fs FileSystem, dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "while creating the cache directory")
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while reading the cache directory")
+	}
+	c := &Cache{
+		fs:       fs,
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if strings.HasSuffix(info.Name(), tempSuffix) {
+			_ = os.Remove(filepath.Join(dir, info.Name()))
+			continue
+		}
+		c.add(info.Name(), info.Size())
+	}
+	c.Lock()
+	c.evict()
+	c.Unlock()
+	return c, nil
+}
+
+// Size returns the number of bytes taken by the local copies.
+func (c *Cache) Size() int64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.size
+}
+
+func (c *Cache) path(name string) string {
+	return filepath.Join(c.dir, name)
+}
+
+// add records a local copy as the most recently used one.
+func (c *Cache) add(name string, size int64) {
+	c.Lock()
+	defer c.Unlock()
+	if el, ok := c.entries[name]; ok {
+		c.size -= el.Value.(*cacheEntry).size
+		c.lru.Remove(el)
+	}
+	c.entries[name] = c.lru.PushFront(&cacheEntry{name: name, size: size})
+	c.size += size
+}
+
+// remove forgets the local copy of name. c must be locked.
+func (c *Cache) remove(name string) {
+	if el, ok := c.entries[name]; ok {
+		c.size -= el.Value.(*cacheEntry).size
+		c.lru.Remove(el)
+		delete(c.entries, name)
+	}
+}
+
+// evict deletes the least recently used copies until they fit in maxBytes. The most recently used
+// copy is always kept, even if it is larger than maxBytes on its own. c must be locked.
+func (c *Cache) evict() {
+	for c.size > c.maxBytes && c.lru.Len() > 1 {
+		e := c.lru.Back().Value.(*cacheEntry)
+		c.remove(e.name)
+		// Files opened by Get stay readable on Unix. Elsewhere the removal can fail, which leaves
+		// an untracked file behind until the next NewCache.
+		_ = os.Remove(c.path(e.name))
+	}
+}
+
+// Put implements FileSystem. The file is written to the cache directory, then uploaded from there.
+func (c *Cache) Put(name string, r io.Reader, size int64) error {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	c.Lock()
+	c.remove(name)
+	c.Unlock()
+	if err := writeFile(c.path(name), r, size); err != nil {
+		return errors.Wrapf(err, "while writing %s to the cache", name)
+	}
+	f, err := os.Open(c.path(name))
+	if err != nil {
+		return err
+	}
+	err = c.fs.Put(name, f, size)
+	_ = f.Close()
+	if err != nil {
+		_ = os.Remove(c.path(name))
+		return err
+	}
+	c.add(name, size)
+	c.Lock()
+	c.evict()
+	c.Unlock()
+	return nil
+}
+
+// Get implements FileSystem. A missing local copy is downloaded first.
+func (c *Cache) Get(name string) (io.ReadCloser, error) {
+	if f, ok := c.open(name); ok {
+		return f, nil
+	}
+
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	// Another Get could have downloaded the file while we waited.
+	if f, ok := c.open(name); ok {
+		return f, nil
+	}
+	rc, err := c.fs.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	err = writeFile(c.path(name), rc, -1)
+	_ = rc.Close()
+	if err != nil {
+		return nil, errors.Wrapf(err, "while writing %s to the cache", name)
+	}
+	f, err := os.Open(c.path(name))
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	c.add(name, info.Size())
+	c.Lock()
+	c.evict()
+	c.Unlock()
+	return f, nil
+}
+
+// open opens the local copy of name, if any, and marks it as the most recently used one.
+func (c *Cache) open(name string) (*os.File, bool) {
+	c.Lock()
+	defer c.Unlock()
+	el, ok := c.entries[name]
+	if !ok {
+		return nil, false
+	}
+	f, err := os.Open(c.path(name))
+	if err != nil {
+		// The copy was removed behind our back.
+		c.remove(name)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return f, true
+}
+
+// Delete implements FileSystem.
+func (c *Cache) Delete(name string) error {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	c.Lock()
+	c.remove(name)
+	c.Unlock()
+	if err := os.Remove(c.path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return c.fs.Delete(name)
+}
+
+// List implements FileSystem. It lists the files of the underlying FileSystem.
+func (c *Cache) List() ([]string, error) {
+	return c.fs.List()
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package objstore provides the FileSystem abstraction Badger uses to keep a durable copy of its
+// tables on object storage, along with implementations for a local directory, S3 and a local
+// cache in front of another FileSystem.
+package objstore
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FileSystem stores immutable files by name. The names never contain a path separator.
+type FileSystem interface {
+	// Put stores the size bytes read from r under name, replacing any existing file. The file
+	// must be durable once Put returns.
+	Put(name string, r io.Reader, size int64) error
+	// Get opens the file with the given name. It returns an error for which os.IsNotExist is true
+	// if there is no such file.
+	Get(name string) (io.ReadCloser, error)
+	// Delete removes the file with the given name. Deleting a missing file is not an error.
+	Delete(name string) error
+	// List returns the names of all the files, in lexical order.
+	List() ([]string, error)
+}
+
+// Local stores the files in a directory of the local filesystem. It is mostly useful for tests,
+// and for storage mounted as a local directory.
+type Local string
+
+var _ FileSystem = Local("")
+
+// Put implements FileSystem. The file is written to a temporary file first, so a crash can't
+// leave a partial file behind.
+func (l Local) Put(name string, r io.Reader, size int64) error {
+	if err := os.MkdirAll(string(l), 0700); err != nil {
+		return err
+	}
+	path := filepath.Join(string(l), name)
+	if err := writeFile(path, r, size); err != nil {
+		return err
+	}
+	return syncDir(string(l))
+}
+
+// Get implements FileSystem.
+func (l Local) Get(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(l), name))
+}
+
+// Delete implements FileSystem.
+func (l Local) Delete(name string) error {
+	if err := os.Remove(filepath.Join(string(l), name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List implements FileSystem.
+func (l Local) List() ([]string, error) {
+	infos, err := ioutil.ReadDir(string(l))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, info := range infos {
+		if info.Mode().IsRegular() && !strings.HasSuffix(info.Name(), tempSuffix) {
+			names = append(names, info.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+const tempSuffix = ".tmp"
+
+// writeFile writes size bytes from r to path through a temporary file, which is synced and
+// renamed into place. A negative size means that the size is unknown.
+func writeFile(path string, r io.Reader, size int64) error {
+	tmp := path + tempSuffix
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, r)
+	if err == nil && size >= 0 && n != size {
+		err = errors.Errorf("wrote %d bytes to %s, expected %d", n, path, size)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		// Directories can't be synced on Windows, and renames are durable on NTFS.
+		return nil
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
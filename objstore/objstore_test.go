@@ -0,0 +1,202 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memS3 is an in-memory S3Client.
+type memS3 struct {
+	sync.Mutex
+	objects map[string][]byte
+	gets    int
+}
+
+func newMemS3() *memS3 {
+	return &memS3{objects: make(map[string][]byte)}
+}
+
+func (m *memS3) PutObject(_ context.Context, bucket, key string, body io.Reader,
+	size int64) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != size {
+		return io.ErrUnexpectedEOF
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.objects[bucket+"/"+key] = data
+	return nil
+}
+
+func (m *memS3) GetObject(_ context.Context, bucket, key string) (io.ReadCloser, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.gets++
+	data, ok := m.objects[bucket+"/"+key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memS3) DeleteObject(_ context.Context, bucket, key string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.objects, bucket+"/"+key)
+	return nil
+}
+
+func (m *memS3) ListObjects(_ context.Context, bucket, prefix string) ([]string, error) {
+	m.Lock()
+	defer m.Unlock()
+	var keys []string
+	for k := range m.objects {
+		if strings.HasPrefix(k, bucket+"/"+prefix) {
+			keys = append(keys, strings.TrimPrefix(k, bucket+"/"))
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func put(t *testing.T, fs FileSystem, name, data string) {
+	require.NoError(t, fs.Put(name, strings.NewReader(data), int64(len(data))))
+}
+
+func get(t *testing.T, fs FileSystem, name string) string {
+	rc, err := fs.Get(name)
+	require.NoError(t, err)
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	require.NoError(t, err)
+	return string(data)
+}
+
+// testFileSystem checks the behavior shared by all the implementations of FileSystem.
+func testFileSystem(t *testing.T, fs FileSystem) {
+	names, err := fs.List()
+	require.NoError(t, err)
+	require.Empty(t, names)
+
+	put(t, fs, "b.sst", "bbb")
+	put(t, fs, "a.sst", "aaa")
+	put(t, fs, "a.sst", "AAAA")
+	require.Equal(t, "AAAA", get(t, fs, "a.sst"))
+	require.Equal(t, "bbb", get(t, fs, "b.sst"))
+
+	names, err = fs.List()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.sst", "b.sst"}, names)
+
+	_, err = fs.Get("c.sst")
+	require.True(t, os.IsNotExist(err), "%v", err)
+
+	require.NoError(t, fs.Delete("a.sst"))
+	require.NoError(t, fs.Delete("a.sst"))
+	_, err = fs.Get("a.sst")
+	require.True(t, os.IsNotExist(err), "%v", err)
+	names, err = fs.List()
+	require.NoError(t, err)
+	require.Equal(t, []string{"b.sst"}, names)
+
+	err = fs.Put("d.sst", strings.NewReader("dd"), 3)
+	require.Error(t, err)
+}
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "objstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	testFileSystem(t, Local(filepath.Join(dir, "store")))
+}
+
+func TestS3(t *testing.T) {
+	client := newMemS3()
+	put(t, &S3{Client: client, Bucket: "other", Prefix: "db/"}, "x.sst", "x")
+	put(t, &S3{Client: client, Bucket: "bucket", Prefix: "db/sub/"}, "y.sst", "y")
+
+	testFileSystem(t, &S3{Client: client, Bucket: "bucket", Prefix: "db/"})
+	require.Contains(t, client.objects, "bucket/db/b.sst")
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "objstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c, err := NewCache(&S3{Client: newMemS3(), Bucket: "bucket"}, dir, 1<<20)
+	require.NoError(t, err)
+	testFileSystem(t, c)
+}
+
+func TestCacheEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "objstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	client := newMemS3()
+	remote := &S3{Client: client, Bucket: "bucket"}
+	c, err := NewCache(remote, dir, 10)
+	require.NoError(t, err)
+
+	put(t, c, "1", "xxxx")
+	put(t, c, "2", "xxxx")
+	require.Equal(t, int64(8), c.Size())
+
+	// Reading 1 makes 2 the least recently used copy, so it is evicted by 3.
+	require.Equal(t, "xxxx", get(t, c, "1"))
+	put(t, c, "3", "xxxx")
+	require.Equal(t, int64(8), c.Size())
+	_, err = os.Stat(filepath.Join(dir, "2"))
+	require.True(t, os.IsNotExist(err))
+	require.Equal(t, 0, client.gets)
+
+	// 2 is still in S3, and is downloaded again.
+	require.Equal(t, "xxxx", get(t, c, "2"))
+	require.Equal(t, 1, client.gets)
+	require.Equal(t, "xxxx", get(t, c, "2"))
+	require.Equal(t, 1, client.gets)
+
+	// The copies are reused by a new Cache.
+	c, err = NewCache(remote, dir, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(8), c.Size())
+	require.Equal(t, "xxxx", get(t, c, "2"))
+	require.Equal(t, 1, client.gets)
+
+	// A copy larger than the cache is kept until the next one.
+	put(t, c, "4", strings.Repeat("x", 20))
+	require.Equal(t, int64(20), c.Size())
+	put(t, c, "5", "x")
+	require.Equal(t, int64(1), c.Size())
+}
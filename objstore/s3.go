@@ -0,0 +1,102 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package objstore
+
+import (
+	"context"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// S3Client is the subset of the S3 API used by S3. The corresponding calls of the AWS SDK's S3
+// client, or of any client for an S3 compatible store like MinIO, can be adapted to it with a few
+// lines of code, which keeps those SDKs out of Badger's dependencies.
+type S3Client interface {
+	// PutObject uploads the size bytes read from body to the given key.
+	PutObject(ctx context.Context, bucket, key string, body io.Reader, size int64) error
+	// GetObject downloads the object with the given key. It must return an error for which
+	// os.IsNotExist is true, like os.ErrNotExist, if there is no such object.
+	GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+	// DeleteObject deletes the object with the given key.
+	DeleteObject(ctx context.Context, bucket, key string) error
+	// ListObjects returns the keys of all the objects whose key starts with prefix, following
+	// the continuation tokens of ListObjectsV2 if needed.
+	ListObjects(ctx context.Context, bucket, prefix string) ([]string, error)
+}
+
+// S3 stores the files as objects of an S3 bucket. Objects written by S3 are immediately
+// visible, as S3 provides strong read-after-write consistency.
+type S3 struct {
+	// Client talks to S3.
+	Client S3Client
+	// Bucket is the name of the bucket holding the objects.
+	Bucket string
+	// Prefix is prepended to the names of the files to get the keys of the objects, like
+	// "dbs/users/". It must not be shared with anything else, as the objects under it that the
+	// DB doesn't know about are deleted.
+	Prefix string
+}
+
+var _ FileSystem = (*S3)(nil)
+
+func (s *S3) key(name string) string {
+	return s.Prefix + name
+}
+
+// Put implements FileSystem.
+func (s *S3) Put(name string, r io.Reader, size int64) error {
+	err := s.Client.PutObject(context.Background(), s.Bucket, s.key(name), r, size)
+	return errors.Wrapf(err, "while uploading s3://%s", path.Join(s.Bucket, s.key(name)))
+}
+
+// Get implements FileSystem.
+func (s *S3) Get(name string) (io.ReadCloser, error) {
+	rc, err := s.Client.GetObject(context.Background(), s.Bucket, s.key(name))
+	if err != nil {
+		// Not wrapped, so that os.IsNotExist keeps working.
+		return nil, err
+	}
+	return rc, nil
+}
+
+// Delete implements FileSystem.
+func (s *S3) Delete(name string) error {
+	err := s.Client.DeleteObject(context.Background(), s.Bucket, s.key(name))
+	return errors.Wrapf(err, "while deleting s3://%s", path.Join(s.Bucket, s.key(name)))
+}
+
+// List implements FileSystem. Objects in "subdirectories" of the prefix are skipped.
+func (s *S3) List() ([]string, error) {
+	keys, err := s.Client.ListObjects(context.Background(), s.Bucket, s.Prefix)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while listing s3://%s", path.Join(s.Bucket, s.Prefix))
+	}
+	var names []string
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, s.Prefix)
+		if name == "" || strings.Contains(name, "/") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
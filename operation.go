@@ -0,0 +1,210 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
+)
+
+// operationKey is the prefix of the keys recording the operation ids applied. See
+// Txn.SetOperationID.
+var operationKey = []byte("!badger!op!")
+
+// operationIDs tracks the operation ids recorded in the DB, oldest first, to bound their number
+// to Options.MaxOperationIDs.
+type operationIDs struct {
+	sync.Mutex
+	max      int
+	ids      [][]byte
+	evicting map[string]struct{} // The ids reserved by the commits in flight, see evict.
+}
+
+// evict returns the oldest ids to forget to make room for a new one. They are reserved, not
+// forgotten, until the commit deleting them is done, see done.
+func (o *operationIDs) evict() [][]byte {
+	o.Lock()
+	defer o.Unlock()
+	n := len(o.ids) - len(o.evicting) - o.max + 1
+	var evicted [][]byte
+	for _, id := range o.ids {
+		if len(evicted) >= n {
+			break
+		}
+		if _, ok := o.evicting[string(id)]; ok {
+			continue
+		}
+		if o.evicting == nil {
+			o.evicting = make(map[string]struct{})
+		}
+		o.evicting[string(id)] = struct{}{}
+		evicted = append(evicted, id)
+	}
+	return evicted
+}
+
+// done releases the ids reserved by evict once the commit recording id is done. If it was
+// committed, the evicted ids are forgotten and id is tracked. Otherwise, they are tracked still.
+func (o *operationIDs) done(id []byte, evicted [][]byte, committed bool) {
+	o.Lock()
+	defer o.Unlock()
+	for _, id := range evicted {
+		delete(o.evicting, string(id))
+	}
+	if !committed {
+		return
+	}
+	if len(evicted) > 0 {
+		drop := make(map[string]struct{}, len(evicted))
+		for _, id := range evicted {
+			drop[string(id)] = struct{}{}
+		}
+		ids := o.ids[:0]
+		for _, id := range o.ids {
+			if _, ok := drop[string(id)]; !ok {
+				ids = append(ids, id)
+			}
+		}
+		o.ids = ids
+	}
+	o.ids = append(o.ids, id)
+}
+
+func opKey(id []byte) []byte {
+	return append(append([]byte{}, operationKey...), id...)
+}
+
+// SetOperationID attaches an operation id, such as an idempotency key supplied by a client, to the
+// writes of the transaction. If a transaction with the same id was committed already, Commit
+// acknowledges the transaction without applying its writes again: it returns nil and CommitTs stays
+// zero. This makes retries safe for at-least-once ingestion pipelines. The id is recorded along
+// with the writes, atomically, and only the last Options.MaxOperationIDs ids are remembered.
+//
+// With conflict detection, concurrent transactions with the same id are serialized, one of them
+// failing with ErrConflict, and retrying it acknowledges it. Without, both might be applied.
+// Operation ids aren't supported by prepared transactions, see Prepare.
+func (txn *Txn) SetOperationID(id []byte) {
+	txn.opID = append([]byte{}, id...)
+}
+
+// applyOperation checks if the operation of txn was applied already. If it wasn't, it adds the
+// record of its id to the writes of txn, along with the deletion of the oldest ids. These stay
+// tracked until the commit is done, see finishOperation.
+func (txn *Txn) applyOperation() (bool, error) {
+	if txn.db.opt.MaxOperationIDs <= 0 {
+		return false, errors.New("Operation ids are disabled, see Options.MaxOperationIDs")
+	}
+	if len(txn.opID) == 0 {
+		return false, errors.New("Operation id can't be empty")
+	}
+	if txn.prepared != nil {
+		return false, ErrTxnPrepared
+	}
+	key := opKey(txn.opID)
+	_, err := txn.Get(key)
+	switch {
+	case err == nil:
+		return true, nil
+	case err != ErrKeyNotFound:
+		return false, err
+	}
+	txn.pendingWrites[string(key)] = &Entry{Key: key}
+	if txn.conflictKeys != nil {
+		txn.conflictKeys[z.MemHash(key)] = struct{}{}
+	}
+	txn.opEvicted = txn.db.opIDs.evict()
+	for _, id := range txn.opEvicted {
+		key := opKey(id)
+		txn.pendingWrites[string(key)] = &Entry{Key: key, meta: bitDelete}
+	}
+	return false, nil
+}
+
+// SetOperationID attaches an operation id to the writes of the WriteBatch, like
+// Txn.SetOperationID. It must be called before any write. It returns true if the operation was
+// applied already, in which case the WriteBatch should be cancelled. Otherwise, the id is recorded
+// along with the writes committed by Flush, so that a WriteBatch which fails part way is applied
+// again in full when retried. It isn't supported in managed mode.
+func (wb *WriteBatch) SetOperationID(id []byte) (bool, error) {
+	if wb.isManaged {
+		return false, ErrManagedTxn
+	}
+	var applied bool
+	err := wb.db.View(func(txn *Txn) error {
+		_, err := txn.Get(opKey(id))
+		if err == ErrKeyNotFound {
+			return nil
+		}
+		applied = err == nil
+		return err
+	})
+	if err != nil || applied {
+		return applied, err
+	}
+	wb.Lock()
+	defer wb.Unlock()
+	wb.opID = append([]byte{}, id...)
+	return false, nil
+}
+
+// finishOperation tracks the id of the operation of txn once its commit is done, and forgets the
+// ids it deleted, unless the commit failed.
+func (txn *Txn) finishOperation(err error) {
+	if txn.opID == nil {
+		return
+	}
+	txn.db.opIDs.done(txn.opID, txn.opEvicted, err == nil)
+	txn.opEvicted = nil
+}
+
+// initOperationIDs loads the operation ids recorded in the DB, oldest first.
+func (db *DB) initOperationIDs() error {
+	type op struct {
+		id      []byte
+		version uint64
+	}
+	var ops []op
+	err := db.View(func(txn *Txn) error {
+		iopts := DefaultIteratorOptions
+		iopts.Prefix = operationKey
+		iopts.PrefetchValues = false
+		iopts.InternalAccess = true
+		itr := txn.NewIterator(iopts)
+		defer itr.Close()
+		for itr.Rewind(); itr.Valid(); itr.Next() {
+			item := itr.Item()
+			ops = append(ops, op{
+				id:      item.KeyCopy(nil)[len(operationKey):],
+				version: item.Version(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].version < ops[j].version
+	})
+	for _, op := range ops {
+		db.opIDs.ids = append(db.opIDs.ids, op.id)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnOperationID(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		commit := func(val string) uint64 {
+			txn := db.NewTransaction(true)
+			defer txn.Discard()
+			txn.SetOperationID([]byte("op1"))
+			require.NoError(t, txn.Set([]byte("key"), []byte(val)))
+			require.NoError(t, txn.Commit())
+			return txn.CommitTs()
+		}
+		require.NotZero(t, commit("first"))
+		// The retry is acknowledged without being applied.
+		require.Zero(t, commit("second"))
+
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get([]byte("key"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("first"), getItemValue(t, item))
+			return nil
+		}))
+
+		// The ids are internal keys.
+		require.NoError(t, db.View(func(txn *Txn) error {
+			itr := txn.NewIterator(DefaultIteratorOptions)
+			defer itr.Close()
+			var n int
+			for itr.Rewind(); itr.Valid(); itr.Next() {
+				n++
+			}
+			require.Equal(t, 1, n)
+			return nil
+		}))
+
+		done := make(chan error)
+		txn := db.NewTransaction(true)
+		txn.SetOperationID([]byte("op1"))
+		require.NoError(t, txn.Set([]byte("key"), []byte("third")))
+		txn.CommitWith(func(err error) { done <- err })
+		require.NoError(t, <-done)
+		require.Zero(t, txn.CommitTs())
+	})
+}
+
+func TestTxnOperationIDConflict(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		txn1 := db.NewTransaction(true)
+		defer txn1.Discard()
+		txn2 := db.NewTransaction(true)
+		defer txn2.Discard()
+		for i, txn := range []*Txn{txn1, txn2} {
+			txn.SetOperationID([]byte("op"))
+			require.NoError(t, txn.Set([]byte(fmt.Sprintf("key%d", i)), nil))
+		}
+		require.NoError(t, txn1.Commit())
+		require.Equal(t, ErrConflict, txn2.Commit())
+	})
+}
+
+func TestOperationIDsBounded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	opt := getTestOptions(dir).WithMaxOperationIDs(3)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	apply := func(db *DB, i int) bool {
+		txn := db.NewTransaction(true)
+		defer txn.Discard()
+		txn.SetOperationID([]byte(fmt.Sprintf("op%d", i)))
+		require.NoError(t, txn.Set([]byte("key"), []byte(fmt.Sprintf("val%d", i))))
+		require.NoError(t, txn.Commit())
+		return txn.CommitTs() != 0
+	}
+	for i := 0; i < 5; i++ {
+		require.True(t, apply(db, i))
+	}
+	// Only the last 3 ids are remembered.
+	require.True(t, apply(db, 0))
+	require.False(t, apply(db, 4))
+	require.NoError(t, db.Close())
+
+	db, err = Open(opt.WithMaxOperationIDs(2))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	require.False(t, apply(db, 0))
+	require.True(t, apply(db, 5))
+	require.True(t, apply(db, 3))
+	require.Equal(t, 2, len(db.opIDs.ids))
+	require.Equal(t, 2, countOperationIDs(t, db))
+}
+
+// countOperationIDs returns the number of operation ids recorded in db.
+func countOperationIDs(t *testing.T, db *DB) int {
+	var n int
+	require.NoError(t, db.View(func(txn *Txn) error {
+		iopt := DefaultIteratorOptions
+		iopt.Prefix = operationKey
+		iopt.InternalAccess = true
+		itr := txn.NewIterator(iopt)
+		defer itr.Close()
+		for itr.Rewind(); itr.Valid(); itr.Next() {
+			n++
+		}
+		return nil
+	}))
+	return n
+}
+
+func TestOperationIDsFailedCommit(t *testing.T) {
+	opt := getTestOptions("").WithMaxOperationIDs(2)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		for i := 0; i < 2; i++ {
+			txn := db.NewTransaction(true)
+			txn.SetOperationID([]byte(fmt.Sprintf("op%d", i)))
+			require.NoError(t, txn.Set([]byte("key"), nil))
+			require.NoError(t, txn.Commit())
+		}
+
+		// The commit deleting op0 fails with a conflict, so op0 is still tracked.
+		txn := db.NewTransaction(true)
+		defer txn.Discard()
+		_, err := txn.Get([]byte("key"))
+		require.NoError(t, err)
+		txnSet(t, db, []byte("key"), []byte("other"), 0)
+		txn.SetOperationID([]byte("op2"))
+		require.NoError(t, txn.Set([]byte("key2"), nil))
+		require.Equal(t, ErrConflict, txn.Commit())
+		require.Equal(t, [][]byte{[]byte("op0"), []byte("op1")}, db.opIDs.ids)
+		require.Empty(t, db.opIDs.evicting)
+
+		// And the next commit deletes it.
+		txn = db.NewTransaction(true)
+		defer txn.Discard()
+		txn.SetOperationID([]byte("op3"))
+		require.NoError(t, txn.Set([]byte("key3"), nil))
+		require.NoError(t, txn.Commit())
+		require.Equal(t, [][]byte{[]byte("op1"), []byte("op3")}, db.opIDs.ids)
+		require.Equal(t, 2, countOperationIDs(t, db))
+	})
+}
+
+func TestWriteBatchOperationID(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		write := func(val string) bool {
+			wb := db.NewWriteBatch()
+			defer wb.Cancel()
+			applied, err := wb.SetOperationID([]byte("batch"))
+			require.NoError(t, err)
+			if applied {
+				return false
+			}
+			for i := 0; i < 100; i++ {
+				require.NoError(t, wb.Set([]byte(fmt.Sprintf("key%03d", i)), []byte(val)))
+			}
+			require.NoError(t, wb.Flush())
+			return true
+		}
+		require.True(t, write("first"))
+		require.False(t, write("second"))
+
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get([]byte("key099"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("first"), getItemValue(t, item))
+			return nil
+		}))
+	})
+}
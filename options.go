@@ -18,6 +18,7 @@ package badger
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"reflect"
 	"strconv"
@@ -27,8 +28,10 @@ import (
 	"github.com/dgraph-io/ristretto/z"
 	"github.com/pkg/errors"
 
+	"github.com/dgraph-io/badger/v3/objstore"
 	"github.com/dgraph-io/badger/v3/options"
 	"github.com/dgraph-io/badger/v3/table"
+	"github.com/dgraph-io/badger/v3/vfs"
 	"github.com/dgraph-io/badger/v3/y"
 )
 
@@ -50,12 +53,17 @@ type Options struct {
 	// Usually modified options.
 
 	SyncWrites        bool
+	MaxSyncDelay      time.Duration
+	SyncDirs          bool
 	NumVersionsToKeep int
 	ReadOnly          bool
 	Logger            Logger
 	Compression       options.CompressionType
+	ValueCompression  options.CompressionType
+	MaxDeltaChain     int
 	InMemory          bool
 	MetricsEnabled    bool
+	HTTPAddr          string
 	// Sets the Stream.numGo field
 	NumGoroutines int
 
@@ -70,13 +78,17 @@ type Options struct {
 
 	VLogPercentile float64
 	ValueThreshold int64
+	ValueFolding   bool
 	NumMemtables   int
 	// Changing BlockSize across DB runs will not break badger. The block size is
 	// read from the block index stored at the end of the table.
 	BlockSize          int
 	BloomFalsePositive float64
-	BlockCacheSize     int64
-	IndexCacheSize     int64
+	// BloomFalsePositiveLevels and AdaptiveBloom tune BloomFalsePositive per level.
+	BloomFalsePositiveLevels []float64
+	AdaptiveBloom            bool
+	BlockCacheSize           int64
+	IndexCacheSize           int64
 
 	NumLevelZeroTables      int
 	NumLevelZeroTablesStall int
@@ -86,24 +98,42 @@ type Options struct {
 
 	NumCompactors        int
 	CompactL0OnClose     bool
+	KeepL0InMemory       bool
 	LmaxCompaction       bool
 	ZSTDCompressionLevel int
 
 	// When set, checksum will be validated for each entry read from the value log file.
 	VerifyValueChecksum bool
+	// When set, the invariants of the levels are checked after every flush and compaction.
+	CheckInvariants bool
 
 	// Encryption related options.
 	EncryptionKey                 []byte        // encryption key
 	EncryptionKeyRotationDuration time.Duration // key rotation duration
+	KeyProvider                   KeyProvider   // fetches EncryptionKey on Open
 
 	// BypassLockGuard will bypass the lock guard on badger. Bypassing lock
 	// guard can cause data corruption if multiple badger instances are using
 	// the same directory. Use this options with caution.
 	BypassLockGuard bool
 
+	// NetworkFS enables the network filesystem compatibility mode.
+	NetworkFS bool
+
+	// FS is the filesystem holding Dir and ValueDir.
+	FS vfs.FS
+
+	// TableFS keeps a durable copy of the tables, usually on object storage.
+	TableFS objstore.FileSystem
+
 	// ChecksumVerificationMode decides when db should verify checksums for SSTable blocks.
 	ChecksumVerificationMode options.ChecksumVerificationMode
 
+	// IORetries and IORetryBackoff control how reads failing with a transient I/O error are
+	// retried. See IsTransientError.
+	IORetries      int
+	IORetryBackoff time.Duration
+
 	// AllowStopTheWorld determines whether the DropPrefix will be blocking/non-blocking.
 	AllowStopTheWorld bool
 
@@ -115,11 +145,33 @@ type Options struct {
 	// NamespaceOffset specifies the offset from where the next 8 bytes contains the namespace.
 	NamespaceOffset int
 
+	// Eviction related options.
+	EvictionMaxSize   int64
+	EvictionPrefixLen int
+
+	AppendOnly bool
+
+	CompactionFilter func() CompactionFilter
+
+	// ShadowVerify is the number of writes between two checks of the reference map. See
+	// WithShadowVerify.
+	ShadowVerify int
+
+	// MaintenanceWindows are the periods in which the heavy maintenance runs. See
+	// WithMaintenanceWindows.
+	MaintenanceWindows []MaintenanceWindow
+
+	// MaxOperationIDs is the number of operation ids remembered. See WithMaxOperationIDs.
+	MaxOperationIDs int
+
 	// Transaction start and commit timestamps are managed by end-user.
 	// This is only useful for databases built on top of Badger (like Dgraph).
 	// Not recommended for most users.
 	managedTxns bool
 
+	// Set by Upgrade to open a DB whose on-disk format requires an upgrade.
+	allowUpgrade bool
+
 	// 4. Flags for testing purposes
 	// ------------------------------
 	maxBatchCount int64 // max entries in batch
@@ -131,7 +183,7 @@ type Options struct {
 // DefaultOptions sets a list of recommended options for good performance.
 // Feel free to modify these to suit your needs with the WithX methods.
 func DefaultOptions(path string) Options {
-	return Options{
+	opt := Options{
 		Dir:      path,
 		ValueDir: path,
 
@@ -152,9 +204,13 @@ func DefaultOptions(path string) Options {
 		BloomFalsePositive:      0.01,
 		BlockSize:               4 * 1024,
 		SyncWrites:              false,
+		SyncDirs:                true,
+		FS:                      vfs.OS,
 		NumVersionsToKeep:       1,
 		CompactL0OnClose:        false,
 		VerifyValueChecksum:     false,
+		IORetries:               3,
+		IORetryBackoff:          10 * time.Millisecond,
 		Compression:             options.Snappy,
 		BlockCacheSize:          256 << 20,
 		IndexCacheSize:          0,
@@ -187,7 +243,17 @@ func DefaultOptions(path string) Options {
 		EncryptionKeyRotationDuration: 10 * 24 * time.Hour, // Default 10 days.
 		DetectConflicts:               true,
 		NamespaceOffset:               -1,
+		EvictionPrefixLen:             8,
+		MaxOperationIDs:               100000,
+	}
+	if y.Is32Bit {
+		// Fit in the address space of 32-bit platforms, see checkAddressSpace.
+		opt.MemTableSize = 16 << 20
+		opt.NumMemtables = 5
+		opt.ValueLogFileSize = 128 << 20
+		opt.BlockCacheSize = 32 << 20
 	}
+	return opt
 }
 
 func buildTableOptions(db *DB) table.Options {
@@ -197,6 +263,8 @@ func buildTableOptions(db *DB) table.Options {
 	return table.Options{
 		ReadOnly:             opt.ReadOnly,
 		MetricsEnabled:       db.opt.MetricsEnabled,
+		FileIO:               opt.NetworkFS,
+		FS:                   opt.FS,
 		TableSize:            uint64(opt.BaseTableSize),
 		BlockSize:            opt.BlockSize,
 		BloomFalsePositive:   opt.BloomFalsePositive,
@@ -207,7 +275,37 @@ func buildTableOptions(db *DB) table.Options {
 		IndexCache:           db.indexCache,
 		AllocPool:            db.allocPool,
 		DataKey:              dk,
+		ZSTDDicts:            db.dicts,
+		ZSTDDictID:           db.dictID(nil),
+	}
+}
+
+// minBloomFalsePositive caps the bits per key of the bloom filters of the top levels with
+// AdaptiveBloom, at about 19 bits.
+const minBloomFalsePositive = 0.0001
+
+// bloomFalsePositive returns the false positive probability of the bloom filters of the tables
+// built for the given level.
+func (opt *Options) bloomFalsePositive(level int) float64 {
+	if n := len(opt.BloomFalsePositiveLevels); n > 0 {
+		if level >= n {
+			level = n - 1
+		}
+		return opt.BloomFalsePositiveLevels[level]
 	}
+	fp := opt.BloomFalsePositive
+	if !opt.AdaptiveBloom || fp == 0 {
+		return fp
+	}
+	// The last level holds most keys, so its filters get twice the false positive probability,
+	// and each level above is LevelSizeMultiplier times smaller and gets a probability that many
+	// times smaller. This uses less memory overall, and a lookup of an absent key goes through
+	// fewer false positives summed over the levels.
+	fp = math.Min(2*fp, 0.5)
+	for l := opt.MaxLevels - 1; l > level && fp > minBloomFalsePositive; l-- {
+		fp /= float64(opt.LevelSizeMultiplier)
+	}
+	return math.Max(fp, minBloomFalsePositive)
 }
 
 const (
@@ -394,6 +492,39 @@ func (opt Options) WithSyncWrites(val bool) Options {
 	return opt
 }
 
+// WithMaxSyncDelay returns a new Options value with MaxSyncDelay set to the given value.
+//
+// MaxSyncDelay only applies when SyncWrites is set. When MaxSyncDelay is positive, the writes are
+// acknowledged without waiting for the msync, and the value log and the write-ahead logs are
+// synced at most MaxSyncDelay after the first write which isn't synced yet. One sync then covers
+// all the write batches of that window, which speeds up the small synced writes a lot, at the cost
+// of losing the writes of the last MaxSyncDelay on a hard reboot.
+//
+// The default value of MaxSyncDelay is 0, which syncs every write batch before acknowledging it.
+func (opt Options) WithMaxSyncDelay(d time.Duration) Options {
+	opt.MaxSyncDelay = d
+	return opt
+}
+
+// syncEachWrite returns true if every write batch is synced before it is acknowledged.
+func (opt *Options) syncEachWrite() bool {
+	return opt.SyncWrites && opt.MaxSyncDelay <= 0
+}
+
+// WithSyncDirs returns a new Options value with SyncDirs set to the given value.
+//
+// When set to true, Badger fsyncs the parent directory after creating or deleting tables, value log
+// files and memtable files, so that the directory entries survive hard reboots. Without it, a
+// filesystem like ext4 with the default mount options can lose a newly created table which is
+// already referenced by the MANIFEST, or bring back a deleted memtable file. The MANIFEST, the key
+// registry and the FORMAT file are always synced after being written or renamed.
+//
+// The default value of SyncDirs is true.
+func (opt Options) WithSyncDirs(val bool) Options {
+	opt.SyncDirs = val
+	return opt
+}
+
 // WithNumVersionsToKeep returns a new Options value with NumVersionsToKeep set to the given value.
 //
 // NumVersionsToKeep sets how many versions to keep per key at most.
@@ -416,9 +547,17 @@ func (opt Options) WithNumGoroutines(val int) Options {
 //
 // When ReadOnly is true the DB will be opened on read-only mode.
 // Multiple processes can open the same Badger DB.
+// A read-only DB only sets up the read path: no mutable memtable, write channel, compactors
+// or value log GC are started, and any write returns ErrReadOnlyDB.
 // Note: if the DB being opened had crashed before and has vlog data to be replayed,
 // ReadOnly will cause Open to fail with an appropriate message.
 //
+// Along with BypassLockGuard, a read-only DB can be opened while another process holds the
+// directory lock to write the DB, e.g. to inspect production data from an analysis job. The
+// read-only DB doesn't create, truncate or delete any file, and reads the writes done up to its
+// Open. Open might fail if a compaction deletes a table while the DB is being opened, in which
+// case it should be retried.
+//
 // The default value of ReadOnly is false.
 func (opt Options) WithReadOnly(val bool) Options {
 	opt.ReadOnly = val
@@ -440,6 +579,19 @@ func (opt Options) WithMetricsEnabled(val bool) Options {
 	return opt
 }
 
+// WithHTTPAddr returns a new Options value with HTTPAddr set to the given value.
+//
+// When HTTPAddr is set, the DB serves a web dashboard at this address, e.g. "localhost:8081". The
+// dashboard shows the levels of the LSM tree, the key ranges of the tables, the value log files,
+// charts of the operation rates, and recent events such as flushes and compactions. The charts
+// need MetricsEnabled to be set. Open fails if it can't listen on the address.
+//
+// The default value of HTTPAddr is "", which disables the dashboard.
+func (opt Options) WithHTTPAddr(val string) Options {
+	opt.HTTPAddr = val
+	return opt
+}
+
 // WithLogger returns a new Options value with Logger set to the given value.
 //
 // Logger provides a way to configure what logger each value of badger.DB uses.
@@ -505,6 +657,19 @@ func (opt Options) WithValueThreshold(val int64) Options {
 	return opt
 }
 
+// WithValueFolding returns a new Options value with ValueFolding set to the given value.
+//
+// When ValueFolding is set, compactions read the values in the value log which are below the
+// current value threshold, e.g. because ValueThreshold was raised or VLogPercentile adjusted it,
+// and store them back in the tables. Reading them then takes no value log lookup, and the value
+// log entries they leave behind are accounted for as garbage, to be reclaimed by RunValueLogGC.
+//
+// The default value of ValueFolding is false.
+func (opt Options) WithValueFolding(val bool) Options {
+	opt.ValueFolding = val
+	return opt
+}
+
 // WithVLogPercentile returns a new Options value with ValLogPercentile set to given value.
 //
 // VLogPercentile with 0.0 means no dynamic thresholding is enabled.
@@ -526,7 +691,7 @@ func (opt Options) WithVLogPercentile(t float64) Options {
 //
 // NumMemtables sets the maximum number of tables to keep in memory before stalling.
 //
-// The default value of NumMemtables is 5.
+// The default value of NumMemtables is 15, or 5 on 32-bit platforms.
 func (opt Options) WithNumMemtables(val int) Options {
 	opt.NumMemtables = val
 	return opt
@@ -536,7 +701,7 @@ func (opt Options) WithNumMemtables(val int) Options {
 //
 // MemTableSize sets the maximum size in bytes for memtable table.
 //
-// The default value of MemTableSize is 64MB.
+// The default value of MemTableSize is 64MB, or 16MB on 32-bit platforms.
 func (opt Options) WithMemTableSize(val int64) Options {
 	opt.MemTableSize = val
 	return opt
@@ -558,6 +723,34 @@ func (opt Options) WithBloomFalsePositive(val float64) Options {
 	return opt
 }
 
+// WithBloomFalsePositiveLevels returns a new Options value with BloomFalsePositiveLevels set to
+// the given value.
+//
+// BloomFalsePositiveLevels sets the false positive probability of the bloom filters per level,
+// starting with level 0, overriding BloomFalsePositive and AdaptiveBloom. The levels past the end
+// use the last value. A value of 0 disables the bloom filters of its levels.
+//
+// The default value of BloomFalsePositiveLevels is nil.
+func (opt Options) WithBloomFalsePositiveLevels(val []float64) Options {
+	opt.BloomFalsePositiveLevels = val
+	return opt
+}
+
+// WithAdaptiveBloom returns a new Options value with AdaptiveBloom set to the given value.
+//
+// When AdaptiveBloom is true, the bloom filters of the last level, which holds most of the keys,
+// use twice the BloomFalsePositive probability, and the filters of each level above use a
+// probability LevelSizeMultiplier times smaller than the level below, down to 0.0001. Upper
+// levels are small and checked by every lookup, so their extra bits are cheap and save more disk
+// reads than the bits taken from the last level cost. Overall this uses less memory for fewer
+// false positives. BloomFalsePositiveLevels overrides AdaptiveBloom.
+//
+// The default value of AdaptiveBloom is false.
+func (opt Options) WithAdaptiveBloom(val bool) Options {
+	opt.AdaptiveBloom = val
+	return opt
+}
+
 // WithBlockSize returns a new Options value with BlockSize set to the given value.
 //
 // BlockSize sets the size of any block in SSTable. SSTable is divided into multiple blocks
@@ -596,7 +789,7 @@ func (opt Options) WithBaseLevelSize(val int64) Options {
 
 // WithValueLogFileSize sets the maximum size of a single value log file.
 //
-// The default value of ValueLogFileSize is 1GB.
+// The default value of ValueLogFileSize is 1GB, or 128MB on 32-bit platforms.
 func (opt Options) WithValueLogFileSize(val int64) Options {
 	opt.ValueLogFileSize = val
 	return opt
@@ -630,6 +823,20 @@ func (opt Options) WithCompactL0OnClose(val bool) Options {
 	return opt
 }
 
+// WithKeepL0InMemory returns a new Options value with KeepL0InMemory set to the given value.
+//
+// When KeepL0InMemory is set, the memtables are flushed into L0 tables kept in memory only,
+// which are written to disk when they are compacted into the next level. This saves writing
+// every key once more, at the cost of the memory of up to NumLevelZeroTablesStall tables. The
+// write-ahead logs of the memtables are kept until then, and replayed if the DB is closed or
+// crashes before, so no data is lost. It has no effect in InMemory mode.
+//
+// The default value of KeepL0InMemory is false.
+func (opt Options) WithKeepL0InMemory(val bool) Options {
+	opt.KeepL0InMemory = val
+	return opt
+}
+
 // WithEncryptionKey is used to encrypt the data with AES. Type of AES is used based on the key
 // size. For example 16 bytes will use AES-128. 24 bytes will use AES-192. 32 bytes will
 // use AES-256.
@@ -638,6 +845,19 @@ func (opt Options) WithEncryptionKey(key []byte) Options {
 	return opt
 }
 
+// WithKeyProvider returns a new Options value with KeyProvider set to the given value.
+//
+// KeyProvider is used to fetch the encryption key when the DB is opened, instead of passing it
+// in EncryptionKey, so that the key can be kept in a key management system. See the kms package
+// for the available providers. EncryptionKey must not be set along with KeyProvider. The options
+// returned by DB.Opts hold the fetched key in EncryptionKey and no KeyProvider.
+//
+// The default value of KeyProvider is nil.
+func (opt Options) WithKeyProvider(p KeyProvider) Options {
+	opt.KeyProvider = p
+	return opt
+}
+
 // WithEncryptionKeyRotationDuration returns new Options value with the duration set to
 // the given value.
 //
@@ -658,6 +878,36 @@ func (opt Options) WithCompression(cType options.CompressionType) Options {
 	return opt
 }
 
+// WithValueCompression returns a new Options value with ValueCompression set to the given value.
+//
+// When ValueCompression is set, every value is compressed on its own with the given algorithm, if
+// that makes it smaller, whether it is stored inline in the LSM tree or in the value log. This
+// keeps the tables small when ValueThreshold is raised. Block compression (see WithCompression)
+// compresses the blocks of the tables, but not the memtables and the WAL, and works poorly on
+// encrypted tables. The compressed values are marked, so this option can be changed across DB
+// runs. With options.ZSTD, the values are compressed with the dictionaries trained by
+// DB.TrainDictionaries.
+//
+// The default value of ValueCompression is options.None.
+func (opt Options) WithValueCompression(cType options.CompressionType) Options {
+	opt.ValueCompression = cType
+	return opt
+}
+
+// WithMaxDeltaChain returns a new Options value with MaxDeltaChain set to the given value.
+//
+// When MaxDeltaChain is positive, a new version of a key written by a transaction is stored in the
+// LSM tree as a binary diff against the previous version, if the value is large and the diff is
+// much smaller than it, and the value is rebuilt from the previous version when it is read.
+// MaxDeltaChain bounds how many diffs have to be applied to read a value. The versions that diffs
+// are based on are kept by compactions while they are needed, whatever NumVersionsToKeep is.
+//
+// The default value of MaxDeltaChain is 0.
+func (opt Options) WithMaxDeltaChain(val int) Options {
+	opt.MaxDeltaChain = val
+	return opt
+}
+
 // WithVerifyValueChecksum is used to set VerifyValueChecksum. When VerifyValueChecksum is set to
 // true, checksum will be verified for every entry read from the value log. If the value is stored
 // in SST (value size less than value threshold) then the checksum validation will not be done.
@@ -668,6 +918,19 @@ func (opt Options) WithVerifyValueChecksum(val bool) Options {
 	return opt
 }
 
+// WithCheckInvariants returns a new Options value with CheckInvariants set to the given value.
+//
+// When CheckInvariants is set to true, the invariants of the levels changed by every flush and
+// compaction are checked as DB.CheckInvariants does, without the value pointer reachability
+// check. Violations are logged as errors, and shown in the dashboard. The checks are cheap enough
+// to run in production, to catch a violation close to the compaction causing it.
+//
+// The default value of CheckInvariants is false.
+func (opt Options) WithCheckInvariants(val bool) Options {
+	opt.CheckInvariants = val
+	return opt
+}
+
 // WithChecksumVerificationMode returns a new Options value with ChecksumVerificationMode set to
 // the given value.
 //
@@ -679,6 +942,84 @@ func (opt Options) WithChecksumVerificationMode(cvMode options.ChecksumVerificat
 	return opt
 }
 
+// WithNetworkFS returns a new Options value with NetworkFS set to the given value.
+//
+// NetworkFS enables a compatibility mode for network filesystems like NFS or EFS, which Badger is
+// not designed for. In this mode:
+//
+//   - The directories are locked with a lease file renewed by the DB instead of flock, which is
+//     often unsupported or unreliable on network filesystems. A lease held by a crashed process
+//     expires after 30 seconds. The hosts sharing the filesystem must have synchronized clocks.
+//   - The tables are read and written with regular file I/O instead of being mapped in memory.
+//
+// The value log and the memtable files are still mapped in memory, so a network outage can still
+// fail the reads of values, see WithIORetries. Never open the same directory from two hosts
+// without this mode, as flock can silently let both of them write.
+//
+// The default value of NetworkFS is false.
+func (opt Options) WithNetworkFS(val bool) Options {
+	opt.NetworkFS = val
+	return opt
+}
+
+// WithFS returns a new Options value with FS set to the given value.
+//
+// FS is the filesystem through which the DB accesses its files, including the directory lock. It
+// can wrap vfs.OS to inject faults, like vfs.FaultFS, or to trace the file operations. The files
+// mapped in memory, namely the tables, the value log, the memtable WAL and the discard stats, are
+// opened through FS but then accessed directly, so they must be files of the operating system.
+//
+// The default value of FS is vfs.OS.
+func (opt Options) WithFS(fs vfs.FS) Options {
+	opt.FS = fs
+	return opt
+}
+
+// WithTableFS returns a new Options value with TableFS set to the given value.
+//
+// TableFS keeps a copy of every table on another storage, like an S3 bucket via objstore.S3. Each
+// table is uploaded before the MANIFEST refers to it, and deleted from TableFS once it is no longer
+// referenced. When the DB is opened, the tables missing from Dir are downloaded from TableFS. This
+// lets a DB recover from the loss of its table files, or move to a new disk by copying only the
+// MANIFEST and the value log. The tables are still read from Dir, as they are mapped in memory, so
+// Dir must have room for all of them.
+//
+// The value log and the MANIFEST are not copied, use a small ValueThreshold to keep most of the
+// data in the tables. ReadOnly DBs neither download nor delete anything.
+// TableFS must not be shared with another DB, as the files the DB doesn't know about are deleted
+// when it is opened.
+//
+// The default value of TableFS is nil, which keeps the tables in Dir only.
+func (opt Options) WithTableFS(fs objstore.FileSystem) Options {
+	opt.TableFS = fs
+	return opt
+}
+
+// WithIORetries returns a new Options value with IORetries set to the given value.
+//
+// IORetries is the number of times a read is retried when it fails with a transient I/O error, such
+// as a fault while reading a memory-mapped file on network-attached storage. The retries apply to
+// the lookups of keys in the LSM tree and to the reads of values from the value log. Setting it to
+// zero disables the retries, but the faults are still returned as ErrIOFault instead of crashing
+// the process.
+//
+// The default value of IORetries is 3.
+func (opt Options) WithIORetries(val int) Options {
+	opt.IORetries = val
+	return opt
+}
+
+// WithIORetryBackoff returns a new Options value with IORetryBackoff set to the given value.
+//
+// IORetryBackoff is the delay before the first retry of a read which failed with a transient I/O
+// error. The delay doubles with each retry.
+//
+// The default value of IORetryBackoff is 10ms.
+func (opt Options) WithIORetryBackoff(val time.Duration) Options {
+	opt.IORetryBackoff = val
+	return opt
+}
+
 // WithAllowStopTheWorld returns a new Options value with AllowStopTheWorld set to the given value.
 //
 // AllowStopTheWorld indicates whether the call to DropPrefix should block the writes or not.
@@ -702,7 +1043,7 @@ func (opt Options) WithAllowStopTheWorld(b bool) Options {
 // unnecessary overhead which will affect the read performance. Setting size to
 // zero disables the cache altogether.
 //
-// Default value of BlockCacheSize is zero.
+// The default value of BlockCacheSize is 256MB, or 32MB on 32-bit platforms.
 func (opt Options) WithBlockCacheSize(size int64) Options {
 	opt.BlockCacheSize = size
 	return opt
@@ -796,6 +1137,106 @@ func (opt Options) WithNamespaceOffset(offset int) Options {
 	return opt
 }
 
+// WithEvictionMaxSize returns a new Options value with EvictionMaxSize set to the given value.
+//
+// EvictionMaxSize is the size budget in bytes for the LSM tree and the value log. When the DB
+// grows beyond it, Badger drops the keys of the least recently accessed prefix (see
+// WithEvictionPrefixLen) until the DB fits in the budget again. This turns Badger into a
+// bounded disk cache. A prefix is accessed when one of its keys is read via Txn.Get or written,
+// or when it is iterated over via IteratorOptions.Prefix. The size is checked periodically, so
+// the DB can temporarily exceed it.
+// Eviction is never run in read-only mode.
+//
+// The default value of EvictionMaxSize is 0, which disables eviction.
+func (opt Options) WithEvictionMaxSize(size int64) Options {
+	opt.EvictionMaxSize = size
+	return opt
+}
+
+// WithEvictionPrefixLen returns a new Options value with EvictionPrefixLen set to the given value.
+//
+// EvictionPrefixLen is the length of the key prefix by which accesses are tracked and data is
+// evicted. All the keys sharing the same prefix are evicted together. Keys shorter than
+// EvictionPrefixLen are never evicted. This option has no effect unless EvictionMaxSize is set.
+//
+// The default value of EvictionPrefixLen is 8.
+func (opt Options) WithEvictionPrefixLen(n int) Options {
+	opt.EvictionPrefixLen = n
+	return opt
+}
+
+// WithAppendOnly returns a new Options value with AppendOnly set to the given value.
+//
+// In append-only mode, every key can be written only once. Deletes, entries with a TTL and
+// writes to an existing key are rejected with ErrAppendOnly. This suits ledger-like workloads
+// which require the data to be immutable once written. The check is done on the write path of
+// transactions and write batches. Compactions additionally log an error for any key found with
+// more than one version, e.g. when the data was loaded via the StreamWriter, which isn't checked.
+// With conflict detection disabled, two concurrent transactions can both write the same new key.
+// DropAll and DropPrefix remain available as administrative operations.
+//
+// The default value of AppendOnly is false.
+func (opt Options) WithAppendOnly(b bool) Options {
+	opt.AppendOnly = b
+	return opt
+}
+
+// WithCompactionFilter returns a new Options value with CompactionFilter set to the given value.
+//
+// CompactionFilter is called at the start of every compaction to create a CompactionFilter, which
+// is then asked about every key the compaction goes over. Keys the filter drops are deleted as if
+// a delete marker had been written for them. Only the versions which are no longer visible to any
+// transaction can be dropped, so a key whose latest version was written recently may be dropped by
+// a later compaction. Compactions run concurrently on disjoint key ranges, each one with its own
+// filter. The keys written by Badger itself are never passed to the filter.
+//
+// The default value of CompactionFilter is nil, which disables the filtering.
+func (opt Options) WithCompactionFilter(f func() CompactionFilter) Options {
+	opt.CompactionFilter = f
+	return opt
+}
+
+// WithShadowVerify returns a new Options value with ShadowVerify set to the given value.
+//
+// When ShadowVerify is greater than zero, the DB keeps the latest version of every key written in
+// a reference map, and checks a sample of the keys against it every ShadowVerify writes. The
+// mismatches are logged, and returned by DB.VerifyShadow, which also checks all the keys. It is
+// meant to catch regressions in tests, as the map holds a copy of every value. Keys dropped by a
+// CompactionFilter or written by a StreamWriter or DB.HandoverSkiplist are reported as
+// mismatches.
+//
+// The default value of ShadowVerify is 0, which disables the reference map.
+func (opt Options) WithShadowVerify(val int) Options {
+	opt.ShadowVerify = val
+	return opt
+}
+
+// WithMaintenanceWindows returns a new Options value with MaintenanceWindows set to the given
+// value.
+//
+// MaintenanceWindows confine the heavy maintenance of the DB to the given windows, which can be
+// parsed from a crontab-like syntax with ParseMaintenanceWindow. Outside of the windows, the
+// compactors only compact level 0, which is needed to keep the writes flowing, and RunValueLogGC
+// and VerifyChecksum fail with ErrMaintenanceWindow. DB.SetMaintenanceMode overrides the windows.
+//
+// The default value of MaintenanceWindows is nil, which allows the maintenance at any time.
+func (opt Options) WithMaintenanceWindows(windows ...MaintenanceWindow) Options {
+	opt.MaintenanceWindows = windows
+	return opt
+}
+
+// WithMaxOperationIDs returns a new Options value with MaxOperationIDs set to the given value.
+//
+// MaxOperationIDs bounds the number of operation ids remembered by the DB to acknowledge the writes
+// applied already, see Txn.SetOperationID. Once there are more, the oldest ids are forgotten, so
+// it should cover the operations which might be retried. Each id takes a small internal key.
+//
+// The default value of MaxOperationIDs is 100000.
+func (opt Options) WithMaxOperationIDs(val int) Options {
+	opt.MaxOperationIDs = val
+	return opt
+}
+
 func (opt Options) getFileFlags() int {
 	var flags int
 	// opt.SyncWrites would be using msync to sync. All writes go through mmap.
@@ -17,9 +17,13 @@
 package badger
 
 import (
+	"fmt"
+	"io/ioutil"
 	"reflect"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	"github.com/dgraph-io/badger/v3/options"
 )
 
@@ -92,3 +96,58 @@ func optionsEqual(o1, o2 Options) bool {
 	}
 	return true
 }
+
+func TestBloomFalsePositive(t *testing.T) {
+	opt := DefaultOptions("").WithMaxLevels(5).WithLevelSizeMultiplier(10)
+	for level := 0; level < 5; level++ {
+		require.Equal(t, 0.01, opt.bloomFalsePositive(level))
+	}
+
+	opt = opt.WithAdaptiveBloom(true)
+	require.InDelta(t, 0.02, opt.bloomFalsePositive(4), 1e-12)
+	require.InDelta(t, 0.002, opt.bloomFalsePositive(3), 1e-12)
+	require.InDelta(t, 0.0002, opt.bloomFalsePositive(2), 1e-12)
+	require.Equal(t, minBloomFalsePositive, opt.bloomFalsePositive(1))
+	require.Equal(t, minBloomFalsePositive, opt.bloomFalsePositive(0))
+
+	opt = opt.WithBloomFalsePositive(0)
+	require.Equal(t, 0.0, opt.bloomFalsePositive(0))
+
+	opt = opt.WithBloomFalsePositiveLevels([]float64{0.001, 0.1, 0})
+	require.Equal(t, 0.001, opt.bloomFalsePositive(0))
+	require.Equal(t, 0.1, opt.bloomFalsePositive(1))
+	require.Equal(t, 0.0, opt.bloomFalsePositive(4))
+
+	_, err := Open(DefaultOptions("").WithInMemory(true).
+		WithBloomFalsePositiveLevels([]float64{0.01, 1}))
+	require.Error(t, err)
+}
+
+func TestBloomFalsePositiveLevels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	// Level 0 tables get a bloom filter and the others don't.
+	opt := getTestOptions(dir).WithBloomFalsePositiveLevels([]float64{0.01, 0})
+	db, err := Open(opt)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		txnSet(t, db, []byte(fmt.Sprintf("key%03d", i)), []byte("value"), 0)
+	}
+	require.NoError(t, db.Close())
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	tables := db.Tables()
+	require.Len(t, tables, 1)
+	require.Equal(t, 0, tables[0].Level)
+	require.NotZero(t, tables[0].BloomFilterSize)
+
+	require.NoError(t, db.lc.doCompact(-1, compactionPriority{level: 0, t: db.lc.levelTargets()}))
+	tables = db.Tables()
+	require.Len(t, tables, 1)
+	require.NotEqual(t, 0, tables[0].Level)
+	require.Zero(t, tables[0].BloomFilterSize)
+}
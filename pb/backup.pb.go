@@ -0,0 +1,949 @@
+// Code generated by protoc-gen-gogo. DO NOT EDIT.
+// source: backup.proto
+
+package pb
+
+import (
+	fmt "fmt"
+	proto "github.com/gogo/protobuf/proto"
+	io "io"
+	math "math"
+	math_bits "math/bits"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
+
+// A backup starts with the 8 bytes "BDGRBKUP", followed by a sequence of frames. Each frame is a
+// BackupFrame message, preceded by its size as a little endian uint64. The first frame holds the
+// header, the last one holds the trailer, and all the others hold a list of KVs.
+type BackupFrame struct {
+	Header  *BackupHeader  `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	List    *KVList        `protobuf:"bytes,2,opt,name=list,proto3" json:"list,omitempty"`
+	Trailer *BackupTrailer `protobuf:"bytes,3,opt,name=trailer,proto3" json:"trailer,omitempty"`
+}
+
+func (m *BackupFrame) Reset()         { *m = BackupFrame{} }
+func (m *BackupFrame) String() string { return proto.CompactTextString(m) }
+func (*BackupFrame) ProtoMessage()    {}
+func (*BackupFrame) Descriptor() ([]byte, []int) {
+	return fileDescriptor_65240d19de191688, []int{0}
+}
+func (m *BackupFrame) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *BackupFrame) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_BackupFrame.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *BackupFrame) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BackupFrame.Merge(m, src)
+}
+func (m *BackupFrame) XXX_Size() int {
+	return m.Size()
+}
+func (m *BackupFrame) XXX_DiscardUnknown() {
+	xxx_messageInfo_BackupFrame.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BackupFrame proto.InternalMessageInfo
+
+func (m *BackupFrame) GetHeader() *BackupHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *BackupFrame) GetList() *KVList {
+	if m != nil {
+		return m.List
+	}
+	return nil
+}
+
+func (m *BackupFrame) GetTrailer() *BackupTrailer {
+	if m != nil {
+		return m.Trailer
+	}
+	return nil
+}
+
+type BackupHeader struct {
+	// Version of the backup format.
+	Version uint32 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	// The backup holds the versions of the keys starting from since_ts.
+	SinceTs uint64 `protobuf:"varint,2,opt,name=since_ts,json=sinceTs,proto3" json:"since_ts,omitempty"`
+	// Unix time in seconds at which the backup was started.
+	CreatedAt int64 `protobuf:"varint,3,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+}
+
+func (m *BackupHeader) Reset()         { *m = BackupHeader{} }
+func (m *BackupHeader) String() string { return proto.CompactTextString(m) }
+func (*BackupHeader) ProtoMessage()    {}
+func (*BackupHeader) Descriptor() ([]byte, []int) {
+	return fileDescriptor_65240d19de191688, []int{1}
+}
+func (m *BackupHeader) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *BackupHeader) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_BackupHeader.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *BackupHeader) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BackupHeader.Merge(m, src)
+}
+func (m *BackupHeader) XXX_Size() int {
+	return m.Size()
+}
+func (m *BackupHeader) XXX_DiscardUnknown() {
+	xxx_messageInfo_BackupHeader.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BackupHeader proto.InternalMessageInfo
+
+func (m *BackupHeader) GetVersion() uint32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *BackupHeader) GetSinceTs() uint64 {
+	if m != nil {
+		return m.SinceTs
+	}
+	return 0
+}
+
+func (m *BackupHeader) GetCreatedAt() int64 {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return 0
+}
+
+type BackupTrailer struct {
+	// Number of KVs in all the lists.
+	NumKvs uint64 `protobuf:"varint,1,opt,name=num_kvs,json=numKvs,proto3" json:"num_kvs,omitempty"`
+	// Number of frames holding a list.
+	NumLists uint64 `protobuf:"varint,2,opt,name=num_lists,json=numLists,proto3" json:"num_lists,omitempty"`
+	// Highest version of all the KVs.
+	MaxVersion uint64 `protobuf:"varint,3,opt,name=max_version,json=maxVersion,proto3" json:"max_version,omitempty"`
+	// CRC32 checksum, using the Castagnoli polynomial, of all the frames before the trailer,
+	// excluding their sizes.
+	Checksum uint32 `protobuf:"varint,4,opt,name=checksum,proto3" json:"checksum,omitempty"`
+}
+
+func (m *BackupTrailer) Reset()         { *m = BackupTrailer{} }
+func (m *BackupTrailer) String() string { return proto.CompactTextString(m) }
+func (*BackupTrailer) ProtoMessage()    {}
+func (*BackupTrailer) Descriptor() ([]byte, []int) {
+	return fileDescriptor_65240d19de191688, []int{2}
+}
+func (m *BackupTrailer) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *BackupTrailer) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_BackupTrailer.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *BackupTrailer) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BackupTrailer.Merge(m, src)
+}
+func (m *BackupTrailer) XXX_Size() int {
+	return m.Size()
+}
+func (m *BackupTrailer) XXX_DiscardUnknown() {
+	xxx_messageInfo_BackupTrailer.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BackupTrailer proto.InternalMessageInfo
+
+func (m *BackupTrailer) GetNumKvs() uint64 {
+	if m != nil {
+		return m.NumKvs
+	}
+	return 0
+}
+
+func (m *BackupTrailer) GetNumLists() uint64 {
+	if m != nil {
+		return m.NumLists
+	}
+	return 0
+}
+
+func (m *BackupTrailer) GetMaxVersion() uint64 {
+	if m != nil {
+		return m.MaxVersion
+	}
+	return 0
+}
+
+func (m *BackupTrailer) GetChecksum() uint32 {
+	if m != nil {
+		return m.Checksum
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*BackupFrame)(nil), "badgerpb3.BackupFrame")
+	proto.RegisterType((*BackupHeader)(nil), "badgerpb3.BackupHeader")
+	proto.RegisterType((*BackupTrailer)(nil), "badgerpb3.BackupTrailer")
+}
+
+func init() { proto.RegisterFile("backup.proto", fileDescriptor_65240d19de191688) }
+
+var fileDescriptor_65240d19de191688 = []byte{
+	// 345 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x64, 0x91, 0xb1, 0x6e, 0xea, 0x30,
+	0x18, 0x85, 0xc9, 0x25, 0x22, 0xf0, 0x03, 0xba, 0xba, 0x5e, 0xc8, 0xa5, 0x6a, 0xda, 0x22, 0x55,
+	0xea, 0x52, 0x22, 0xc1, 0xd8, 0xa9, 0x0c, 0x55, 0x25, 0x3a, 0x59, 0x88, 0xa1, 0x4b, 0x64, 0x27,
+	0x16, 0xb1, 0xc0, 0x49, 0x64, 0x3b, 0x11, 0x73, 0x9f, 0xa0, 0x6b, 0xdf, 0xa8, 0x23, 0x63, 0xc7,
+	0x0a, 0x5e, 0xa4, 0xc2, 0x21, 0x94, 0xaa, 0x9b, 0x8f, 0xcf, 0x67, 0x9f, 0xf3, 0xdb, 0xd0, 0xa1,
+	0x24, 0x5c, 0xe6, 0xd9, 0x30, 0x93, 0xa9, 0x4e, 0x51, 0x8b, 0x92, 0x68, 0xc1, 0x64, 0x46, 0xc7,
+	0xfd, 0xbf, 0xc7, 0x65, 0xe9, 0x0d, 0xde, 0x2c, 0x68, 0x4f, 0x0c, 0xfc, 0x20, 0x89, 0x60, 0xc8,
+	0x87, 0x46, 0xcc, 0x48, 0xc4, 0xa4, 0x6b, 0x5d, 0x5a, 0x37, 0xed, 0x51, 0x6f, 0xf8, 0x7d, 0xa2,
+	0xe4, 0x1e, 0x8d, 0x8d, 0x0f, 0x18, 0xba, 0x06, 0x7b, 0xc5, 0x95, 0x76, 0xff, 0x18, 0xfc, 0xdf,
+	0x09, 0x3e, 0x9d, 0x3f, 0x71, 0xa5, 0xb1, 0xb1, 0xd1, 0x08, 0x1c, 0x2d, 0x09, 0x5f, 0x31, 0xe9,
+	0xd6, 0x0d, 0xe9, 0xfe, 0xba, 0x78, 0x56, 0xfa, 0xb8, 0x02, 0x07, 0x14, 0x3a, 0xa7, 0x91, 0xc8,
+	0x05, 0xa7, 0x60, 0x52, 0xf1, 0x34, 0x31, 0xe5, 0xba, 0xb8, 0x92, 0xe8, 0x3f, 0x34, 0x15, 0x4f,
+	0x42, 0x16, 0x68, 0x65, 0x8a, 0xd8, 0xd8, 0x31, 0x7a, 0xa6, 0xd0, 0x39, 0x40, 0x28, 0x19, 0xd1,
+	0x2c, 0x0a, 0x88, 0x36, 0xd9, 0x75, 0xdc, 0x3a, 0xec, 0xdc, 0xeb, 0xc1, 0x8b, 0x05, 0xdd, 0x1f,
+	0xf1, 0xa8, 0x07, 0x4e, 0x92, 0x8b, 0x60, 0x59, 0x28, 0x93, 0x62, 0xe3, 0x46, 0x92, 0x8b, 0x69,
+	0xa1, 0xd0, 0x19, 0xb4, 0xf6, 0xc6, 0x7e, 0x9c, 0x2a, 0xa5, 0x99, 0xe4, 0x62, 0x3f, 0xa4, 0x42,
+	0x17, 0xd0, 0x16, 0x64, 0x1d, 0x54, 0xfd, 0xea, 0xc6, 0x06, 0x41, 0xd6, 0xf3, 0x43, 0xc5, 0x3e,
+	0x34, 0xc3, 0x98, 0x85, 0x4b, 0x95, 0x0b, 0xd7, 0x36, 0xed, 0x8f, 0x7a, 0x72, 0xf7, 0xbe, 0xf5,
+	0xac, 0xcd, 0xd6, 0xb3, 0x3e, 0xb7, 0x9e, 0xf5, 0xba, 0xf3, 0x6a, 0x9b, 0x9d, 0x57, 0xfb, 0xd8,
+	0x79, 0xb5, 0xe7, 0xab, 0x05, 0xd7, 0x71, 0x4e, 0x87, 0x61, 0x2a, 0xfc, 0x68, 0x21, 0x49, 0x16,
+	0xdf, 0xf2, 0xd4, 0x2f, 0x5f, 0xce, 0x2f, 0xc6, 0x7e, 0x46, 0x69, 0xc3, 0x7c, 0xe4, 0xf8, 0x6b,
+	0x00, 0x04, 0xd3, 0xce, 0x23, 0xf4, 0x01, 0x00, 0x00,
+}
+
+func (m *BackupFrame) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *BackupFrame) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *BackupFrame) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.Trailer != nil {
+		{
+			size, err := m.Trailer.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintBackup(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x1a
+	}
+	if m.List != nil {
+		{
+			size, err := m.List.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintBackup(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x12
+	}
+	if m.Header != nil {
+		{
+			size, err := m.Header.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintBackup(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *BackupHeader) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *BackupHeader) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *BackupHeader) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.CreatedAt != 0 {
+		i = encodeVarintBackup(dAtA, i, uint64(m.CreatedAt))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.SinceTs != 0 {
+		i = encodeVarintBackup(dAtA, i, uint64(m.SinceTs))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.Version != 0 {
+		i = encodeVarintBackup(dAtA, i, uint64(m.Version))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *BackupTrailer) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *BackupTrailer) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *BackupTrailer) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.Checksum != 0 {
+		i = encodeVarintBackup(dAtA, i, uint64(m.Checksum))
+		i--
+		dAtA[i] = 0x20
+	}
+	if m.MaxVersion != 0 {
+		i = encodeVarintBackup(dAtA, i, uint64(m.MaxVersion))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.NumLists != 0 {
+		i = encodeVarintBackup(dAtA, i, uint64(m.NumLists))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.NumKvs != 0 {
+		i = encodeVarintBackup(dAtA, i, uint64(m.NumKvs))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func encodeVarintBackup(dAtA []byte, offset int, v uint64) int {
+	offset -= sovBackup(v)
+	base := offset
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return base
+}
+func (m *BackupFrame) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Header != nil {
+		l = m.Header.Size()
+		n += 1 + l + sovBackup(uint64(l))
+	}
+	if m.List != nil {
+		l = m.List.Size()
+		n += 1 + l + sovBackup(uint64(l))
+	}
+	if m.Trailer != nil {
+		l = m.Trailer.Size()
+		n += 1 + l + sovBackup(uint64(l))
+	}
+	return n
+}
+
+func (m *BackupHeader) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Version != 0 {
+		n += 1 + sovBackup(uint64(m.Version))
+	}
+	if m.SinceTs != 0 {
+		n += 1 + sovBackup(uint64(m.SinceTs))
+	}
+	if m.CreatedAt != 0 {
+		n += 1 + sovBackup(uint64(m.CreatedAt))
+	}
+	return n
+}
+
+func (m *BackupTrailer) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.NumKvs != 0 {
+		n += 1 + sovBackup(uint64(m.NumKvs))
+	}
+	if m.NumLists != 0 {
+		n += 1 + sovBackup(uint64(m.NumLists))
+	}
+	if m.MaxVersion != 0 {
+		n += 1 + sovBackup(uint64(m.MaxVersion))
+	}
+	if m.Checksum != 0 {
+		n += 1 + sovBackup(uint64(m.Checksum))
+	}
+	return n
+}
+
+func sovBackup(x uint64) (n int) {
+	return (math_bits.Len64(x|1) + 6) / 7
+}
+func sozBackup(x uint64) (n int) {
+	return sovBackup(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *BackupFrame) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowBackup
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: BackupFrame: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: BackupFrame: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Header", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBackup
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthBackup
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthBackup
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Header == nil {
+				m.Header = &BackupHeader{}
+			}
+			if err := m.Header.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field List", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBackup
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthBackup
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthBackup
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.List == nil {
+				m.List = &KVList{}
+			}
+			if err := m.List.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Trailer", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBackup
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthBackup
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthBackup
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Trailer == nil {
+				m.Trailer = &BackupTrailer{}
+			}
+			if err := m.Trailer.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipBackup(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthBackup
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *BackupHeader) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowBackup
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: BackupHeader: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: BackupHeader: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Version", wireType)
+			}
+			m.Version = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBackup
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Version |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SinceTs", wireType)
+			}
+			m.SinceTs = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBackup
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SinceTs |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CreatedAt", wireType)
+			}
+			m.CreatedAt = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBackup
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.CreatedAt |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipBackup(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthBackup
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *BackupTrailer) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowBackup
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: BackupTrailer: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: BackupTrailer: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field NumKvs", wireType)
+			}
+			m.NumKvs = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBackup
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.NumKvs |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field NumLists", wireType)
+			}
+			m.NumLists = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBackup
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.NumLists |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MaxVersion", wireType)
+			}
+			m.MaxVersion = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBackup
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MaxVersion |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Checksum", wireType)
+			}
+			m.Checksum = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBackup
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Checksum |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipBackup(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthBackup
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func skipBackup(dAtA []byte) (n int, err error) {
+	l := len(dAtA)
+	iNdEx := 0
+	depth := 0
+	for iNdEx < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, ErrIntOverflowBackup
+			}
+			if iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType := int(wire & 0x7)
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowBackup
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				iNdEx++
+				if dAtA[iNdEx-1] < 0x80 {
+					break
+				}
+			}
+		case 1:
+			iNdEx += 8
+		case 2:
+			var length int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowBackup
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				length |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if length < 0 {
+				return 0, ErrInvalidLengthBackup
+			}
+			iNdEx += length
+		case 3:
+			depth++
+		case 4:
+			if depth == 0 {
+				return 0, ErrUnexpectedEndOfGroupBackup
+			}
+			depth--
+		case 5:
+			iNdEx += 4
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+		if iNdEx < 0 {
+			return 0, ErrInvalidLengthBackup
+		}
+		if depth == 0 {
+			return iNdEx, nil
+		}
+	}
+	return 0, io.ErrUnexpectedEOF
+}
+
+var (
+	ErrInvalidLengthBackup        = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowBackup          = fmt.Errorf("proto: integer overflow")
+	ErrUnexpectedEndOfGroupBackup = fmt.Errorf("proto: unexpected end of group")
+)
@@ -75,18 +75,21 @@ func (KV_Kind) EnumDescriptor() ([]byte, []int) {
 type ManifestChange_Operation int32
 
 const (
-	ManifestChange_CREATE ManifestChange_Operation = 0
-	ManifestChange_DELETE ManifestChange_Operation = 1
+	ManifestChange_CREATE      ManifestChange_Operation = 0
+	ManifestChange_DELETE      ManifestChange_Operation = 1
+	ManifestChange_CREATE_DICT ManifestChange_Operation = 2
 )
 
 var ManifestChange_Operation_name = map[int32]string{
 	0: "CREATE",
 	1: "DELETE",
+	2: "CREATE_DICT",
 }
 
 var ManifestChange_Operation_value = map[string]int32{
-	"CREATE": 0,
-	"DELETE": 1,
+	"CREATE":      0,
+	"DELETE":      1,
+	"CREATE_DICT": 2,
 }
 
 func (x ManifestChange_Operation) String() string {
@@ -337,6 +340,8 @@ type ManifestChange struct {
 	KeyId          uint64                   `protobuf:"varint,4,opt,name=key_id,json=keyId,proto3" json:"key_id,omitempty"`
 	EncryptionAlgo EncryptionAlgo           `protobuf:"varint,5,opt,name=encryption_algo,json=encryptionAlgo,proto3,enum=badgerpb3.EncryptionAlgo" json:"encryption_algo,omitempty"`
 	Compression    uint32                   `protobuf:"varint,6,opt,name=compression,proto3" json:"compression,omitempty"`
+	Dict           []byte                   `protobuf:"bytes,7,opt,name=dict,proto3" json:"dict,omitempty"`
+	Namespace      []byte                   `protobuf:"bytes,8,opt,name=namespace,proto3" json:"namespace,omitempty"`
 }
 
 func (m *ManifestChange) Reset()         { *m = ManifestChange{} }
@@ -414,6 +419,20 @@ func (m *ManifestChange) GetCompression() uint32 {
 	return 0
 }
 
+func (m *ManifestChange) GetDict() []byte {
+	if m != nil {
+		return m.Dict
+	}
+	return nil
+}
+
+func (m *ManifestChange) GetNamespace() []byte {
+	if m != nil {
+		return m.Namespace
+	}
+	return nil
+}
+
 type Checksum struct {
 	Algo Checksum_Algorithm `protobuf:"varint,1,opt,name=algo,proto3,enum=badgerpb3.Checksum_Algorithm" json:"algo,omitempty"`
 	Sum  uint64             `protobuf:"varint,2,opt,name=sum,proto3" json:"sum,omitempty"`
@@ -603,52 +622,53 @@ func init() {
 func init() { proto.RegisterFile("badgerpb3.proto", fileDescriptor_6d729c99bbc38987) }
 
 var fileDescriptor_6d729c99bbc38987 = []byte{
-	// 705 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x54, 0xdd, 0x6e, 0xda, 0x58,
-	0x10, 0xc6, 0xc6, 0xfc, 0x0d, 0x84, 0xb0, 0x47, 0xbb, 0x2b, 0x47, 0xab, 0xb0, 0xc4, 0xd1, 0xee,
-	0xa2, 0x95, 0x16, 0xb4, 0x50, 0xf5, 0xa6, 0x57, 0xfc, 0xb8, 0x0a, 0x82, 0x28, 0xd2, 0x69, 0x14,
-	0xa5, 0xbd, 0x41, 0x07, 0x7b, 0x00, 0x0b, 0xb0, 0xad, 0xe3, 0x83, 0x15, 0x1e, 0xa2, 0x52, 0x5f,
-	0xa2, 0xef, 0xd2, 0xcb, 0x5c, 0xf6, 0xb2, 0x4a, 0x5e, 0xa4, 0x3a, 0xc7, 0x0e, 0x85, 0x8b, 0xde,
-	0xcd, 0xf7, 0xcd, 0x78, 0x66, 0x3c, 0xdf, 0xcc, 0x81, 0xd3, 0x19, 0x73, 0x17, 0xc8, 0xc3, 0x59,
-	0xb7, 0x15, 0xf2, 0x40, 0x04, 0xa4, 0xb4, 0x27, 0xac, 0xcf, 0x3a, 0xe8, 0xe3, 0x3b, 0x52, 0x83,
-	0xec, 0x0a, 0x77, 0xa6, 0xd6, 0xd0, 0x9a, 0x15, 0x2a, 0x4d, 0xf2, 0x2b, 0xe4, 0x62, 0xb6, 0xde,
-	0xa2, 0xa9, 0x2b, 0x2e, 0x01, 0xe4, 0x0f, 0x28, 0x6d, 0x23, 0xe4, 0xd3, 0x0d, 0x0a, 0x66, 0x66,
-	0x95, 0xa7, 0x28, 0x89, 0x6b, 0x14, 0x8c, 0x98, 0x50, 0x88, 0x91, 0x47, 0x5e, 0xe0, 0x9b, 0x46,
-	0x43, 0x6b, 0x1a, 0xf4, 0x05, 0x92, 0x73, 0x00, 0x7c, 0x08, 0x3d, 0x8e, 0xd1, 0x94, 0x09, 0x33,
-	0xa7, 0x9c, 0xa5, 0x94, 0xe9, 0x09, 0x42, 0xc0, 0x50, 0x09, 0xf3, 0x2a, 0xa1, 0xb2, 0x65, 0xa5,
-	0x48, 0x70, 0x64, 0x9b, 0xa9, 0xe7, 0x9a, 0xd0, 0xd0, 0x9a, 0x27, 0xb4, 0x98, 0x10, 0x23, 0x97,
-	0xfc, 0x09, 0xe5, 0xd4, 0xe9, 0x06, 0x3e, 0x9a, 0xe5, 0x86, 0xd6, 0x2c, 0x52, 0x48, 0xa8, 0x61,
-	0xe0, 0x23, 0xf9, 0x1b, 0x8c, 0x95, 0xe7, 0xbb, 0x66, 0xa5, 0xa1, 0x35, 0xab, 0x1d, 0xd2, 0xfa,
-	0x31, 0x81, 0xf1, 0x5d, 0x6b, 0xec, 0xf9, 0x2e, 0x55, 0x7e, 0xeb, 0x1f, 0x30, 0x24, 0x22, 0x05,
-	0xc8, 0x8e, 0xed, 0xf7, 0xb5, 0x0c, 0xa9, 0x40, 0x71, 0xd8, 0xbb, 0xed, 0x4d, 0x25, 0xd2, 0x48,
-	0x11, 0x8c, 0xb7, 0xa3, 0x89, 0x5d, 0xd3, 0xad, 0x21, 0xe4, 0xc7, 0x77, 0x13, 0x2f, 0x12, 0xe4,
-	0x1c, 0xf4, 0x55, 0x6c, 0x6a, 0x8d, 0x6c, 0xb3, 0xdc, 0x39, 0x39, 0x4a, 0x4c, 0xf5, 0x55, 0x2c,
-	0xfb, 0x66, 0xeb, 0x75, 0xe0, 0x4c, 0x39, 0xce, 0x55, 0xdf, 0x06, 0x2d, 0x2a, 0x82, 0xe2, 0xdc,
-	0xba, 0x82, 0x5f, 0xae, 0x99, 0xef, 0xcd, 0x31, 0x12, 0x83, 0x25, 0xf3, 0x17, 0xf8, 0x0e, 0x05,
-	0xe9, 0x42, 0xc1, 0x51, 0x20, 0x4a, 0xb3, 0x9e, 0x1d, 0x64, 0x3d, 0x0e, 0xa7, 0x2f, 0x91, 0xd6,
-	0x47, 0x1d, 0xaa, 0xc7, 0x3e, 0x52, 0x05, 0x7d, 0xe4, 0x2a, 0x09, 0x0d, 0xaa, 0x8f, 0x5c, 0xd2,
-	0x05, 0xfd, 0x26, 0x54, 0xf2, 0x55, 0x3b, 0x97, 0x3f, 0x4d, 0xd9, 0xba, 0x09, 0x91, 0x33, 0xe1,
-	0x05, 0x3e, 0xd5, 0x6f, 0x42, 0x29, 0xfb, 0x04, 0x63, 0x5c, 0x2b, 0x71, 0x4f, 0x68, 0x02, 0xc8,
-	0x6f, 0x90, 0x5f, 0xe1, 0x4e, 0x2a, 0x91, 0x08, 0x9b, 0x5b, 0xe1, 0x6e, 0xe4, 0x92, 0x3e, 0x9c,
-	0xa2, 0xef, 0xf0, 0x5d, 0x28, 0x3f, 0x9f, 0xb2, 0xf5, 0x22, 0x50, 0xda, 0x56, 0x8f, 0xfe, 0xc0,
-	0xde, 0x47, 0xf4, 0xd6, 0x8b, 0x80, 0x56, 0xf1, 0x08, 0x93, 0x06, 0x94, 0x9d, 0x60, 0x13, 0x72,
-	0x8c, 0xd4, 0xe2, 0xe4, 0x55, 0xd9, 0x43, 0xca, 0xba, 0x84, 0xd2, 0xbe, 0x47, 0x02, 0x90, 0x1f,
-	0x50, 0xbb, 0x77, 0x6b, 0xd7, 0x32, 0xd2, 0x1e, 0xda, 0x13, 0xfb, 0xd6, 0xae, 0x69, 0x56, 0x0c,
-	0xc5, 0xc1, 0x12, 0x9d, 0x55, 0xb4, 0xdd, 0x90, 0xff, 0xc1, 0x50, 0xbd, 0x68, 0xaa, 0x97, 0xf3,
-	0x83, 0x5e, 0x5e, 0x42, 0x5a, 0xb2, 0x34, 0xf7, 0xc4, 0x72, 0x43, 0x55, 0xa8, 0xdc, 0xff, 0x68,
-	0xbb, 0x51, 0xc3, 0x32, 0xa8, 0x34, 0xad, 0xbf, 0xa0, 0xb4, 0x0f, 0x4a, 0xaa, 0x0e, 0xba, 0x9d,
-	0x41, 0xb2, 0x21, 0xf7, 0xf7, 0x57, 0x2c, 0x5a, 0xbe, 0x7e, 0x55, 0xd3, 0x2c, 0x07, 0x0a, 0x43,
-	0x26, 0xd8, 0x18, 0x77, 0x07, 0x43, 0xd2, 0x0e, 0x87, 0x44, 0xc0, 0x70, 0x99, 0x60, 0xe9, 0x1d,
-	0x29, 0x5b, 0x4a, 0xe5, 0xc5, 0xe9, 0xfd, 0xe8, 0x5e, 0x2c, 0xef, 0xc3, 0xe1, 0xc8, 0x04, 0xba,
-	0xf2, 0x3e, 0xe4, 0x8c, 0xb3, 0xb4, 0x94, 0x32, 0x3d, 0x61, 0xf5, 0x21, 0x77, 0xcd, 0x84, 0xb3,
-	0x24, 0xbf, 0x43, 0x3e, 0xe4, 0x38, 0xf7, 0x1e, 0xd2, 0x4b, 0x4d, 0x11, 0xb9, 0x80, 0x8a, 0xb7,
-	0xf0, 0x03, 0x8e, 0xd3, 0xd9, 0x4e, 0x60, 0xa4, 0x6a, 0x95, 0x68, 0x39, 0xe1, 0xfa, 0x92, 0xfa,
-	0xf7, 0x0c, 0xaa, 0xc7, 0x4a, 0xc8, 0x9d, 0x67, 0x18, 0xd5, 0x32, 0xfd, 0x37, 0x5f, 0x9e, 0xea,
-	0xda, 0xe3, 0x53, 0x5d, 0xfb, 0xf6, 0x54, 0xd7, 0x3e, 0x3d, 0xd7, 0x33, 0x8f, 0xcf, 0xf5, 0xcc,
-	0xd7, 0xe7, 0x7a, 0xe6, 0xc3, 0xc5, 0xc2, 0x13, 0xcb, 0xed, 0xac, 0xe5, 0x04, 0x9b, 0xb6, 0xbb,
-	0xe0, 0x2c, 0x5c, 0xfe, 0xe7, 0x05, 0xed, 0x64, 0x9e, 0xed, 0xb8, 0xdb, 0x0e, 0x67, 0xb3, 0xbc,
-	0x7a, 0x52, 0xba, 0xdf, 0x03, 0x00, 0x00, 0xff, 0xff, 0x43, 0xc8, 0xf6, 0xac, 0x65, 0x04, 0x00,
-	0x00,
+	// 735 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x54, 0x4f, 0x6f, 0xea, 0x46,
+	0x10, 0xc7, 0xc6, 0x01, 0x7b, 0x48, 0x88, 0xbb, 0x6a, 0x2b, 0x3f, 0xb5, 0xa1, 0x3c, 0x57, 0x6d,
+	0x51, 0xa5, 0x12, 0x35, 0x3c, 0xf5, 0xd2, 0x13, 0x01, 0x57, 0x0f, 0x41, 0x14, 0x69, 0x8b, 0xa2,
+	0xd7, 0x5e, 0xac, 0xc5, 0x1e, 0x60, 0x05, 0xfe, 0x23, 0x7b, 0xb1, 0x1e, 0xdf, 0xa2, 0x5f, 0xa2,
+	0xdf, 0xa5, 0xc7, 0x1c, 0x7b, 0xac, 0x92, 0x2f, 0x52, 0xed, 0xda, 0x21, 0x70, 0x78, 0xb7, 0xf9,
+	0xfd, 0x66, 0x3c, 0x3b, 0x33, 0xbf, 0x19, 0xc3, 0xe5, 0x82, 0x85, 0x2b, 0xcc, 0xd2, 0xc5, 0xa0,
+	0x9f, 0x66, 0x89, 0x48, 0x88, 0x75, 0x20, 0xdc, 0xbf, 0x75, 0xd0, 0xa7, 0x0f, 0xc4, 0x86, 0xfa,
+	0x06, 0xf7, 0x8e, 0xd6, 0xd5, 0x7a, 0xe7, 0x54, 0x9a, 0xe4, 0x73, 0x38, 0x2b, 0xd8, 0x76, 0x87,
+	0x8e, 0xae, 0xb8, 0x12, 0x90, 0xaf, 0xc0, 0xda, 0xe5, 0x98, 0xf9, 0x11, 0x0a, 0xe6, 0xd4, 0x95,
+	0xc7, 0x94, 0xc4, 0x1d, 0x0a, 0x46, 0x1c, 0x68, 0x16, 0x98, 0xe5, 0x3c, 0x89, 0x1d, 0xa3, 0xab,
+	0xf5, 0x0c, 0xfa, 0x02, 0xc9, 0x15, 0x00, 0x7e, 0x4c, 0x79, 0x86, 0xb9, 0xcf, 0x84, 0x73, 0xa6,
+	0x9c, 0x56, 0xc5, 0x0c, 0x05, 0x21, 0x60, 0xa8, 0x84, 0x0d, 0x95, 0x50, 0xd9, 0xf2, 0xa5, 0x5c,
+	0x64, 0xc8, 0x22, 0x9f, 0x87, 0x0e, 0x74, 0xb5, 0xde, 0x05, 0x35, 0x4b, 0x62, 0x12, 0x92, 0x6f,
+	0xa0, 0x55, 0x39, 0xc3, 0x24, 0x46, 0xa7, 0xd5, 0xd5, 0x7a, 0x26, 0x85, 0x92, 0x1a, 0x27, 0x31,
+	0x92, 0xef, 0xc1, 0xd8, 0xf0, 0x38, 0x74, 0xce, 0xbb, 0x5a, 0xaf, 0x7d, 0x43, 0xfa, 0xaf, 0x13,
+	0x98, 0x3e, 0xf4, 0xa7, 0x3c, 0x0e, 0xa9, 0xf2, 0xbb, 0x3f, 0x80, 0x21, 0x11, 0x69, 0x42, 0x7d,
+	0xea, 0xfd, 0x61, 0xd7, 0xc8, 0x39, 0x98, 0xe3, 0xe1, 0x7c, 0xe8, 0x4b, 0xa4, 0x11, 0x13, 0x8c,
+	0xdf, 0x26, 0x33, 0xcf, 0xd6, 0xdd, 0x31, 0x34, 0xa6, 0x0f, 0x33, 0x9e, 0x0b, 0x72, 0x05, 0xfa,
+	0xa6, 0x70, 0xb4, 0x6e, 0xbd, 0xd7, 0xba, 0xb9, 0x38, 0x49, 0x4c, 0xf5, 0x4d, 0x21, 0xeb, 0x66,
+	0xdb, 0x6d, 0x12, 0xf8, 0x19, 0x2e, 0x55, 0xdd, 0x06, 0x35, 0x15, 0x41, 0x71, 0xe9, 0xbe, 0x87,
+	0xcf, 0xee, 0x58, 0xcc, 0x97, 0x98, 0x8b, 0xd1, 0x9a, 0xc5, 0x2b, 0xfc, 0x1d, 0x05, 0x19, 0x40,
+	0x33, 0x50, 0x20, 0xaf, 0xb2, 0xbe, 0x39, 0xca, 0x7a, 0x1a, 0x4e, 0x5f, 0x22, 0xdd, 0x47, 0x1d,
+	0xda, 0xa7, 0x3e, 0xd2, 0x06, 0x7d, 0x12, 0x2a, 0x09, 0x0d, 0xaa, 0x4f, 0x42, 0x32, 0x00, 0xfd,
+	0x3e, 0x55, 0xf2, 0xb5, 0x6f, 0xbe, 0xfd, 0x64, 0xca, 0xfe, 0x7d, 0x8a, 0x19, 0x13, 0x3c, 0x89,
+	0xa9, 0x7e, 0x9f, 0x4a, 0xd9, 0x67, 0x58, 0xe0, 0x56, 0x89, 0x7b, 0x41, 0x4b, 0x40, 0xbe, 0x80,
+	0xc6, 0x06, 0xf7, 0x52, 0x89, 0x52, 0xd8, 0xb3, 0x0d, 0xee, 0x27, 0x21, 0xb9, 0x85, 0x4b, 0x8c,
+	0x83, 0x6c, 0x9f, 0xca, 0xcf, 0x7d, 0xb6, 0x5d, 0x25, 0x4a, 0xdb, 0xf6, 0x49, 0x07, 0xde, 0x21,
+	0x62, 0xb8, 0x5d, 0x25, 0xb4, 0x8d, 0x27, 0x98, 0x74, 0xa1, 0x15, 0x24, 0x51, 0x9a, 0x61, 0xae,
+	0x16, 0xa7, 0xa1, 0x9e, 0x3d, 0xa6, 0xe4, 0x76, 0x84, 0x3c, 0x10, 0x4e, 0xb3, 0xdc, 0x0e, 0x69,
+	0x93, 0xaf, 0xc1, 0x8a, 0x59, 0x84, 0x79, 0xca, 0x02, 0x74, 0x4c, 0xe5, 0x78, 0x25, 0xdc, 0x77,
+	0x60, 0x1d, 0xba, 0x22, 0x00, 0x8d, 0x11, 0xf5, 0x86, 0x73, 0xcf, 0xae, 0x49, 0x7b, 0xec, 0xcd,
+	0xbc, 0xb9, 0x67, 0x6b, 0xe4, 0x12, 0x5a, 0x25, 0xef, 0x8f, 0x27, 0xa3, 0xb9, 0xad, 0xbb, 0x05,
+	0x98, 0xa3, 0x35, 0x06, 0x9b, 0x7c, 0x17, 0x91, 0x9f, 0xc1, 0x50, 0xed, 0x68, 0xaa, 0x9d, 0xab,
+	0xa3, 0x76, 0x5e, 0x42, 0xfa, 0xb2, 0xfa, 0x8c, 0x8b, 0x75, 0x44, 0x55, 0xa8, 0x3c, 0xa1, 0x7c,
+	0x17, 0xa9, 0x79, 0x1b, 0x54, 0x9a, 0xee, 0x77, 0x60, 0x1d, 0x82, 0xca, 0x32, 0x46, 0x83, 0x9b,
+	0x51, 0xb9, 0x64, 0x1f, 0x3e, 0xbc, 0x67, 0xf9, 0xfa, 0x97, 0x77, 0xb6, 0xe6, 0x06, 0xd0, 0x1c,
+	0x33, 0xc1, 0xa6, 0xb8, 0x3f, 0x9a, 0xb3, 0x76, 0x3c, 0x67, 0x39, 0x01, 0x26, 0x58, 0x75, 0x8a,
+	0xca, 0x96, 0x6a, 0xf3, 0xa2, 0x3a, 0x41, 0x9d, 0x17, 0xf2, 0xc4, 0x82, 0x0c, 0x99, 0xc0, 0x50,
+	0x9e, 0x98, 0x94, 0xa9, 0x4e, 0xad, 0x8a, 0x19, 0x0a, 0xf7, 0x16, 0xce, 0xee, 0x98, 0x08, 0xd6,
+	0xe4, 0x4b, 0x68, 0xa4, 0x19, 0x2e, 0xf9, 0xc7, 0xea, 0xd8, 0x2b, 0x44, 0xde, 0xc2, 0x39, 0x5f,
+	0xc5, 0x49, 0x86, 0xfe, 0x62, 0x2f, 0x30, 0x57, 0x6f, 0x59, 0xb4, 0x55, 0x72, 0xb7, 0x92, 0xfa,
+	0xf1, 0x0d, 0xb4, 0x4f, 0xc5, 0x94, 0x67, 0xc3, 0x30, 0xb7, 0x6b, 0xb7, 0xbf, 0xfe, 0xf3, 0xd4,
+	0xd1, 0x1e, 0x9f, 0x3a, 0xda, 0x7f, 0x4f, 0x1d, 0xed, 0xaf, 0xe7, 0x4e, 0xed, 0xf1, 0xb9, 0x53,
+	0xfb, 0xf7, 0xb9, 0x53, 0xfb, 0xf3, 0xed, 0x8a, 0x8b, 0xf5, 0x6e, 0xd1, 0x0f, 0x92, 0xe8, 0x3a,
+	0x5c, 0x65, 0x2c, 0x5d, 0xff, 0xc4, 0x93, 0xeb, 0x72, 0x9e, 0xd7, 0xc5, 0xe0, 0x3a, 0x5d, 0x2c,
+	0x1a, 0xea, 0xaf, 0x34, 0xf8, 0x7f, 0x00, 0xce, 0x80, 0x5b, 0x30, 0xa8, 0x04, 0x00, 0x00,
 }
 
 func (m *KV) Marshal() (dAtA []byte, err error) {
@@ -831,6 +851,20 @@ func (m *ManifestChange) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Namespace) > 0 {
+		i -= len(m.Namespace)
+		copy(dAtA[i:], m.Namespace)
+		i = encodeVarintBadgerpb3(dAtA, i, uint64(len(m.Namespace)))
+		i--
+		dAtA[i] = 0x42
+	}
+	if len(m.Dict) > 0 {
+		i -= len(m.Dict)
+		copy(dAtA[i:], m.Dict)
+		i = encodeVarintBadgerpb3(dAtA, i, uint64(len(m.Dict)))
+		i--
+		dAtA[i] = 0x3a
+	}
 	if m.Compression != 0 {
 		i = encodeVarintBadgerpb3(dAtA, i, uint64(m.Compression))
 		i--
@@ -1089,6 +1123,14 @@ func (m *ManifestChange) Size() (n int) {
 	if m.Compression != 0 {
 		n += 1 + sovBadgerpb3(uint64(m.Compression))
 	}
+	l = len(m.Dict)
+	if l > 0 {
+		n += 1 + l + sovBadgerpb3(uint64(l))
+	}
+	l = len(m.Namespace)
+	if l > 0 {
+		n += 1 + l + sovBadgerpb3(uint64(l))
+	}
 	return n
 }
 
@@ -1765,6 +1807,74 @@ func (m *ManifestChange) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Dict", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBadgerpb3
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthBadgerpb3
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthBadgerpb3
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Dict = append(m.Dict[:0], dAtA[iNdEx:postIndex]...)
+			if m.Dict == nil {
+				m.Dict = []byte{}
+			}
+			iNdEx = postIndex
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Namespace", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBadgerpb3
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthBadgerpb3
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthBadgerpb3
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Namespace = append(m.Namespace[:0], dAtA[iNdEx:postIndex]...)
+			if m.Namespace == nil {
+				m.Namespace = []byte{}
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipBadgerpb3(dAtA[iNdEx:])
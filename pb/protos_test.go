@@ -35,7 +35,8 @@ func TestProtosRegenerate(t *testing.T) {
 	err := Exec("./gen.sh")
 	require.NoError(t, err, "Got error while regenerating protos: %v\n", err)
 
-	generatedProtos := "badgerpb3.pb.go"
-	err = Exec("git", "diff", "--quiet", "--", generatedProtos)
-	require.NoError(t, err, "badgerpb3.pb.go changed after regenerating")
+	for _, generatedProtos := range []string{"badgerpb3.pb.go", "backup.pb.go"} {
+		err = Exec("git", "diff", "--quiet", "--", generatedProtos)
+		require.NoError(t, err, "%s changed after regenerating", generatedProtos)
+	}
 }
@@ -0,0 +1,217 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"bytes"
+
+	"github.com/dgraph-io/badger/v3/y"
+)
+
+// PurgeReport describes the outcome of Purge. Its Remaining* fields are filled in by checking the
+// files on disk once the purge is over, so they prove that no data with the prefix is left in the
+// DB, as opposed to being merely marked as deleted.
+type PurgeReport struct {
+	Prefix []byte
+	// TablesRewritten is the number of tables which held keys with the prefix.
+	TablesRewritten int
+	// VlogFilesRewritten are the IDs of the value log files which held values of keys with the
+	// prefix.
+	VlogFilesRewritten []uint32
+	// DiskSizeBefore and DiskSizeAfter are the sizes of the tables and the value log files.
+	DiskSizeBefore int64
+	DiskSizeAfter  int64
+
+	// RemainingKeys is the number of versions of keys with the prefix, including delete markers,
+	// still found in the memtables and the tables.
+	RemainingKeys int
+	// RemainingValues is the number of values of keys with the prefix still found in the value
+	// log files.
+	RemainingValues int
+	// PendingVlogFiles are the IDs of the rewritten value log files which couldn't be deleted yet,
+	// because some iterators were reading them. They are deleted once those iterators are closed.
+	PendingVlogFiles []uint32
+}
+
+// Verified returns true if no data with the prefix is left on disk.
+func (r *PurgeReport) Verified() bool {
+	return r.RemainingKeys == 0 && r.RemainingValues == 0 && len(r.PendingVlogFiles) == 0
+}
+
+// Purge deletes all the keys with the given prefix and makes sure that their data is removed from
+// disk, instead of waiting for compactions and value log GC to get rid of it. The tables holding
+// keys with the prefix are rewritten without them, like DropPrefix does, and so are the value log
+// files holding their values. The returned report tells what was rewritten and whether any data
+// with the prefix is left on disk.
+//
+// Like DropPrefix, Purge blocks writes while the tables are being rewritten. Keys with the prefix
+// written while Purge is running may or may not be purged.
+func (db *DB) Purge(prefix []byte) (*PurgeReport, error) {
+	if len(prefix) == 0 {
+		return nil, ErrEmptyKey
+	}
+	if db.opt.ReadOnly {
+		return nil, ErrReadOnlyDB
+	}
+	report := &PurgeReport{
+		Prefix:         y.SafeCopy(nil, prefix),
+		DiskSizeBefore: db.diskSize(),
+	}
+	opt := IteratorOptions{Prefix: prefix}
+	for _, ti := range db.Tables() {
+		if opt.compareToPrefix(ti.Left) <= 0 && opt.compareToPrefix(ti.Right) >= 0 {
+			report.TablesRewritten++
+		}
+	}
+
+	var fids []uint32
+	if !db.opt.InMemory {
+		// Look for the value log files holding values with the prefix while writes are blocked,
+		// so that the current file can be set aside for rewriting if needed.
+		resume, err := db.prepareToDrop()
+		if err != nil {
+			return nil, err
+		}
+		fids, err = db.vlog.fidsWithPrefix(prefix)
+		if err == nil && len(fids) > 0 && fids[len(fids)-1] == db.vlog.maxFid {
+			err = db.vlog.rotate()
+		}
+		resume()
+		if err != nil {
+			return nil, y.Wrapf(err, "while looking for value log files to purge")
+		}
+	}
+
+	if err := db.DropPrefixBlocking(prefix); err != nil {
+		return nil, err
+	}
+
+	if len(fids) > 0 {
+		// Wait for any running value log GC, and keep it from running meanwhile.
+		db.vlog.garbageCh <- struct{}{}
+		for _, fid := range fids {
+			db.vlog.filesLock.RLock()
+			lf, ok := db.vlog.filesMap[fid]
+			db.vlog.filesLock.RUnlock()
+			if !ok {
+				// Already deleted by value log GC.
+				continue
+			}
+			if err := db.vlog.doRunGC(lf); err != nil {
+				<-db.vlog.garbageCh
+				return nil, y.Wrapf(err, "while rewriting value log file %d", fid)
+			}
+			report.VlogFilesRewritten = append(report.VlogFilesRewritten, fid)
+		}
+		<-db.vlog.garbageCh
+	}
+
+	// Check that nothing is left.
+	err := db.View(func(txn *Txn) error {
+		iopt := DefaultIteratorOptions
+		iopt.Prefix = prefix
+		iopt.AllVersions = true
+		iopt.PrefetchValues = false
+		itr := txn.NewIterator(iopt)
+		defer itr.Close()
+		for itr.Rewind(); itr.Valid(); itr.Next() {
+			report.RemainingKeys++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !db.opt.InMemory {
+		if report.RemainingValues, err = db.vlog.countPrefix(prefix); err != nil {
+			return nil, err
+		}
+		db.vlog.filesLock.RLock()
+		for _, fid := range db.vlog.filesToBeDeleted {
+			for _, rewritten := range report.VlogFilesRewritten {
+				if fid == rewritten {
+					report.PendingVlogFiles = append(report.PendingVlogFiles, fid)
+				}
+			}
+		}
+		db.vlog.filesLock.RUnlock()
+	}
+	report.DiskSizeAfter = db.diskSize()
+	db.opt.Infof("Purged prefix %#x. Verified: %v", prefix, report.Verified())
+	return report, nil
+}
+
+// iteratePrefix calls fn with the ID of every value log file not marked for deletion, along with
+// the number of its entries whose key has the given prefix.
+func (vlog *valueLog) iteratePrefix(prefix []byte, fn func(fid uint32, count int)) error {
+	vlog.filesLock.RLock()
+	fids := vlog.sortedFids()
+	vlog.filesLock.RUnlock()
+	for _, fid := range fids {
+		vlog.filesLock.RLock()
+		lf, ok := vlog.filesMap[fid]
+		vlog.filesLock.RUnlock()
+		if !ok {
+			continue
+		}
+		var count int
+		_, err := lf.iterate(true, 0, func(e Entry, _ valuePointer) error {
+			if bytes.HasPrefix(y.ParseKey(e.Key), prefix) {
+				count++
+			}
+			return nil
+		})
+		if err != nil {
+			return y.Wrapf(err, "while iterating over value log file %d", fid)
+		}
+		fn(fid, count)
+	}
+	return nil
+}
+
+// fidsWithPrefix returns the IDs of the value log files holding values of keys with the prefix.
+func (vlog *valueLog) fidsWithPrefix(prefix []byte) ([]uint32, error) {
+	var fids []uint32
+	err := vlog.iteratePrefix(prefix, func(fid uint32, count int) {
+		if count > 0 {
+			fids = append(fids, fid)
+		}
+	})
+	return fids, err
+}
+
+// countPrefix returns the number of values of keys with the prefix in the value log files.
+func (vlog *valueLog) countPrefix(prefix []byte) (int, error) {
+	var total int
+	err := vlog.iteratePrefix(prefix, func(_ uint32, count int) {
+		total += count
+	})
+	return total, err
+}
+
+// rotate starts a new value log file, so that the current one can be rewritten. Writes must be
+// blocked while rotate runs.
+func (vlog *valueLog) rotate() error {
+	vlog.filesLock.RLock()
+	curlf := vlog.filesMap[vlog.maxFid]
+	vlog.filesLock.RUnlock()
+	if err := curlf.doneWriting(vlog.woffset(), vlog.opt.SyncWrites); err != nil {
+		return err
+	}
+	_, err := vlog.createVlogFile()
+	return err
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurge(t *testing.T) {
+	opt := getTestOptions("")
+	opt.ValueThreshold = 32
+	// Keep the value log files small, since the test reads them whole.
+	opt.ValueLogFileSize = 1 << 20
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		secret := bytes.Repeat([]byte("secret"), 20)
+		other := bytes.Repeat([]byte("public"), 20)
+		for i := 0; i < 100; i++ {
+			txnSet(t, db, []byte(fmt.Sprintf("a/%03d", i)), secret, 0)
+			txnSet(t, db, []byte(fmt.Sprintf("b/%03d", i)), other, 0)
+		}
+		// Have some of the data in the tables.
+		require.NoError(t, db.Flatten(1))
+
+		report, err := db.Purge([]byte("a/"))
+		require.NoError(t, err)
+		require.True(t, report.Verified(), "%+v", report)
+		require.NotEmpty(t, report.VlogFilesRewritten)
+		require.Equal(t, 0, report.RemainingKeys)
+		require.Equal(t, 0, report.RemainingValues)
+
+		// The secret is gone from all the files.
+		files, err := filepath.Glob(filepath.Join(db.opt.Dir, "*"))
+		require.NoError(t, err)
+		for _, f := range files {
+			buf, err := ioutil.ReadFile(f)
+			require.NoError(t, err)
+			require.False(t, bytes.Contains(buf, secret), "found the secret in %s", f)
+		}
+
+		require.NoError(t, db.View(func(txn *Txn) error {
+			_, err := txn.Get([]byte("a/000"))
+			require.Equal(t, ErrKeyNotFound, err)
+			return nil
+		}))
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for i := 0; i < 100; i++ {
+				item, err := txn.Get([]byte(fmt.Sprintf("b/%03d", i)))
+				require.NoError(t, err)
+				require.Equal(t, other, getItemValue(t, item))
+			}
+			return nil
+		}))
+
+		// Nothing left to purge.
+		report, err = db.Purge([]byte("a/"))
+		require.NoError(t, err)
+		require.True(t, report.Verified())
+		require.Empty(t, report.VlogFilesRewritten)
+
+		_, err = db.Purge(nil)
+		require.Equal(t, ErrEmptyKey, err)
+	})
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dgraph-io/badger/v3/vfs"
+	"github.com/dgraph-io/badger/v3/y"
+)
+
+// QuarantineDir is the subdirectory of Options.Dir to which the table files which aren't
+// referenced by the MANIFEST are moved on open. Such files are normally left behind by a crash, but
+// they could also be the result of a corrupted MANIFEST, so they are kept for the operator to
+// review instead of being deleted. See PurgeQuarantine.
+const QuarantineDir = "quarantine"
+
+// quarantineFile moves the file at path into the quarantine directory of the DB. If a file with
+// the same name is already quarantined, the current time is appended to the name.
+func (db *DB) quarantineFile(path string) error {
+	qdir := filepath.Join(db.opt.Dir, QuarantineDir)
+	if err := db.opt.FS.MkdirAll(qdir, 0700); err != nil {
+		return y.Wrapf(err, "while creating quarantine directory %s", qdir)
+	}
+	dst := filepath.Join(qdir, filepath.Base(path))
+	if _, err := db.opt.FS.Stat(dst); err == nil {
+		dst = fmt.Sprintf("%s.%s", dst, time.Now().UTC().Format("20060102T150405.000000000"))
+	}
+	if err := db.opt.FS.Rename(path, dst); err != nil {
+		return y.Wrapf(err, "while moving %s to quarantine", path)
+	}
+	db.opt.Warningf("Moved %s, which isn't referenced by the MANIFEST, to %s", path, dst)
+	return db.syncDir(qdir)
+}
+
+// PurgeQuarantine deletes the files moved to the quarantine directory of the DB in dir, and
+// returns the number of deleted files. It should be called once the operator has checked that the
+// quarantined files aren't needed.
+func PurgeQuarantine(dir string) (int, error) {
+	qdir := filepath.Join(dir, QuarantineDir)
+	fileInfos, err := ioutil.ReadDir(qdir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	for i, fi := range fileInfos {
+		if err := os.RemoveAll(filepath.Join(qdir, fi.Name())); err != nil {
+			return i, err
+		}
+	}
+	if err := os.Remove(qdir); err != nil {
+		return len(fileInfos), err
+	}
+	return len(fileInfos), vfs.OS.SyncDir(dir)
+}
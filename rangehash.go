@@ -0,0 +1,75 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// RangeHash returns a SHA-256 hash of the keys visible to the transaction in the range
+// [start, end). A nil end means that the range has no upper bound. The hash covers the key, value,
+// UserMeta and expiry of the latest version of every key, but not the version itself, so two DBs
+// holding the same data hash to the same value even if the data was written at different
+// versions. This can be used to find the ranges which differ between two DBs, by comparing the
+// hashes of ever smaller ranges.
+func (txn *Txn) RangeHash(start, end []byte) ([]byte, error) {
+	if txn.discarded {
+		return nil, ErrDiscardedTxn
+	}
+	opt := DefaultIteratorOptions
+	opt.PrefetchValues = false
+	itr := txn.NewIterator(opt)
+	defer itr.Close()
+
+	h := sha256.New()
+	var buf [binary.MaxVarintLen64]byte
+	writeBytes := func(b []byte) {
+		n := binary.PutUvarint(buf[:], uint64(len(b)))
+		h.Write(buf[:n])
+		h.Write(b)
+	}
+	for itr.Seek(start); itr.Valid(); itr.Next() {
+		item := itr.Item()
+		if end != nil && bytes.Compare(item.Key(), end) >= 0 {
+			break
+		}
+		writeBytes(item.Key())
+		if err := item.Value(func(val []byte) error {
+			writeBytes(val)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		n := binary.PutUvarint(buf[:], item.ExpiresAt())
+		h.Write(buf[:n])
+		h.Write([]byte{item.UserMeta()})
+	}
+	return h.Sum(nil), nil
+}
+
+// RangeHash returns a hash of the keys in the range [start, end). See Txn.RangeHash for details.
+func (db *DB) RangeHash(start, end []byte) ([]byte, error) {
+	var hash []byte
+	err := db.View(func(txn *Txn) error {
+		var err error
+		hash, err = txn.RangeHash(start, end)
+		return err
+	})
+	return hash, err
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRangeHash(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db1 *DB) {
+		runBadgerTest(t, nil, func(t *testing.T, db2 *DB) {
+			for i := 0; i < 100; i++ {
+				key := []byte(fmt.Sprintf("key%03d", i))
+				txnSet(t, db1, key, []byte("val"), 0)
+				txnSet(t, db2, key, []byte("val"), 0)
+			}
+			// An extra version in one of the DBs doesn't change the hash.
+			txnSet(t, db2, []byte("key010"), []byte("val"), 0)
+
+			hash := func(db *DB, start, end string) []byte {
+				var e []byte
+				if end != "" {
+					e = []byte(end)
+				}
+				h, err := db.RangeHash([]byte(start), e)
+				require.NoError(t, err)
+				return h
+			}
+			require.Equal(t, hash(db1, "", ""), hash(db2, "", ""))
+
+			txnSet(t, db2, []byte("key042"), []byte("other"), 0)
+			require.NotEqual(t, hash(db1, "", ""), hash(db2, "", ""))
+			require.Equal(t, hash(db1, "", "key042"), hash(db2, "", "key042"))
+			require.NotEqual(t, hash(db1, "key042", "key043"), hash(db2, "key042", "key043"))
+			require.Equal(t, hash(db1, "key043", ""), hash(db2, "key043", ""))
+
+			txnDelete(t, db1, []byte("key042"))
+			txnDelete(t, db2, []byte("key042"))
+			require.Equal(t, hash(db1, "", ""), hash(db2, "", ""))
+			require.NotEqual(t, hash(db1, "key000", "key001"), hash(db1, "key042", "key043"))
+			require.Equal(t, hash(db1, "key042", "key043"), hash(db1, "zzz", ""))
+		})
+	})
+}
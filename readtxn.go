@@ -0,0 +1,99 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+// ReadTxn is a read-only transaction, through which a snapshot of the DB is read. Unlike a Txn,
+// which can be used for both reads and writes, its type guarantees that the reads see a single
+// consistent view of the DB:
+//
+//   - Every Get and iterator of a ReadTxn sees the DB as of ReadTs: the writes of the transactions
+//     committed before the ReadTxn was created are visible, and the ones committed afterwards are
+//     not, even if they are committed while an iterator is being advanced.
+//   - The view doesn't change for as long as the ReadTxn is open. Reading a key twice returns the
+//     same value, and the versions read are kept by the compactions and the value log GC until the
+//     ReadTxn is discarded. In managed mode, this only holds if the discard timestamp of the DB
+//     stays below ReadTs. The value log files rewritten by the GC are only deleted once all the
+//     ReadTxns and iterators reading them are done.
+//
+// A long-lived ReadTxn keeps old versions around, so it should be discarded as soon as possible.
+// Like a Txn, a ReadTxn isn't safe for concurrent use, and its iterators must be closed before
+// it is discarded.
+type ReadTxn struct {
+	txn     *Txn
+	release func() // Releases the snapshot read, if any. See DB.NewSnapshotTxn.
+}
+
+// NewReadTxn returns a ReadTxn reading the DB as of now. It must be discarded with Discard.
+func (db *DB) NewReadTxn() *ReadTxn {
+	if db.opt.managedTxns {
+		panic("Cannot use NewReadTxn with managedDB=true. Use NewReadTxnAt instead.")
+	}
+	return newReadTxn(db.newTransaction(false, false))
+}
+
+func newReadTxn(txn *Txn) *ReadTxn {
+	// Like an iterator, a ReadTxn can read any value log file.
+	txn.db.vlog.incrIteratorCount()
+	return &ReadTxn{txn: txn}
+}
+
+// ReadView runs fn with a ReadTxn, which is discarded when fn returns. It returns the error of fn.
+func (db *DB) ReadView(fn func(rt *ReadTxn) error) error {
+	if db.IsClosed() {
+		return ErrDBClosed
+	}
+	rt := db.NewReadTxn()
+	defer rt.Discard()
+	return fn(rt)
+}
+
+// ReadTs returns the timestamp as of which the ReadTxn reads the DB.
+func (rt *ReadTxn) ReadTs() uint64 {
+	return rt.txn.ReadTs()
+}
+
+// Get looks up key, and returns the corresponding Item as of ReadTs. If key isn't found, it
+// returns ErrKeyNotFound.
+func (rt *ReadTxn) Get(key []byte) (*Item, error) {
+	return rt.txn.Get(key)
+}
+
+// NewIterator returns an iterator over the DB as of ReadTs. See Txn.NewIterator.
+func (rt *ReadTxn) NewIterator(opt IteratorOptions) *Iterator {
+	return rt.txn.NewIterator(opt)
+}
+
+// NewKeyIterator returns an iterator over the versions of key as of ReadTs. See
+// Txn.NewKeyIterator.
+func (rt *ReadTxn) NewKeyIterator(key []byte, opt IteratorOptions) *Iterator {
+	return rt.txn.NewKeyIterator(key, opt)
+}
+
+// Discard releases the snapshot read by the ReadTxn. It must be called once the reads are done.
+// Calling it multiple times is fine.
+func (rt *ReadTxn) Discard() {
+	if rt.txn.discarded {
+		return
+	}
+	rt.txn.Discard()
+	if err := rt.txn.db.vlog.decrIteratorCount(); err != nil {
+		rt.txn.db.opt.Errorf("While discarding a ReadTxn: %v", err)
+	}
+	if rt.release != nil {
+		rt.release()
+	}
+}
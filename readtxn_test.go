@@ -0,0 +1,121 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTxnSnapshot(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		key := func(i int) []byte { return []byte(fmt.Sprintf("key%03d", i)) }
+		for i := 0; i < 100; i++ {
+			txnSet(t, db, key(i), []byte("v1"), 0)
+		}
+
+		rt := db.NewReadTxn()
+		itr := rt.NewIterator(DefaultIteratorOptions)
+		var n int
+		for itr.Rewind(); itr.Valid(); itr.Next() {
+			if n == 50 {
+				// Neither the updates nor the new keys committed while iterating are visible.
+				for i := 0; i < 150; i++ {
+					txnSet(t, db, key(i), []byte("v2"), 0)
+				}
+			}
+			require.Equal(t, key(n), itr.Item().Key())
+			require.Equal(t, []byte("v1"), getItemValue(t, itr.Item()))
+			n++
+		}
+		itr.Close()
+		require.Equal(t, 100, n)
+
+		item, err := rt.Get(key(0))
+		require.NoError(t, err)
+		require.Equal(t, []byte("v1"), getItemValue(t, item))
+		_, err = rt.Get(key(120))
+		require.Equal(t, ErrKeyNotFound, err)
+		rt.Discard()
+		rt.Discard()
+
+		require.NoError(t, db.ReadView(func(rt *ReadTxn) error {
+			item, err := rt.Get(key(120))
+			require.NoError(t, err)
+			require.Equal(t, []byte("v2"), getItemValue(t, item))
+			return nil
+		}))
+	})
+}
+
+func TestReadTxnValueLogGC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+	opt := getTestOptions(dir)
+	opt.ValueLogFileSize = 1 << 20
+	opt.ValueThreshold = 1 << 10
+	db, err := Open(opt)
+	require.NoError(t, err)
+	defer db.Close()
+
+	for i := 0; i < 100; i++ {
+		txnSet(t, db, []byte(fmt.Sprintf("key%d", i)), make([]byte, 32<<10), 0)
+	}
+	rt := db.NewReadTxn()
+	for i := 0; i < 45; i++ {
+		txnDelete(t, db, []byte(fmt.Sprintf("key%d", i)))
+	}
+	item, err := rt.Get([]byte("key0"))
+	require.NoError(t, err)
+	db.vlog.filesLock.RLock()
+	fid := db.vlog.sortedFids()[0]
+	lf := db.vlog.filesMap[fid]
+	db.vlog.filesLock.RUnlock()
+	require.NoError(t, db.vlog.rewrite(lf))
+
+	// The item points to the rewritten file, which is only deleted once rt is discarded.
+	require.Len(t, getItemValue(t, item), 32<<10)
+	rt.Discard()
+	db.vlog.filesLock.RLock()
+	_, ok := db.vlog.filesMap[fid]
+	db.vlog.filesLock.RUnlock()
+	require.False(t, ok)
+}
+
+func TestReadTxnManaged(t *testing.T) {
+	opt := getTestOptions("")
+	opt.managedTxns = true
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		for ts := uint64(1); ts <= 3; ts++ {
+			txn := db.NewTransactionAt(ts, true)
+			require.NoError(t, txn.Set([]byte("key"), []byte(fmt.Sprintf("v%d", ts))))
+			require.NoError(t, txn.CommitAt(ts, nil))
+		}
+		require.Panics(t, func() { db.NewReadTxn() })
+
+		rt := db.NewReadTxnAt(2)
+		defer rt.Discard()
+		require.Equal(t, uint64(2), rt.ReadTs())
+		item, err := rt.Get([]byte("key"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("v2"), getItemValue(t, item))
+	})
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/dgraph-io/badger/v3/table"
+	"github.com/dgraph-io/badger/v3/y"
+)
+
+// corruptTables holds the IDs of the tables in which a read found a corrupted block. Such tables
+// are rewritten by the compactors, skipping the corrupted blocks.
+type corruptTables struct {
+	sync.Mutex
+	ids map[uint64]struct{}
+}
+
+// reportCorruption records that reading key from the table t failed with err, typically because
+// of a checksum mismatch. The read goes on with the other tables, so that an older version of the
+// key can be served, and the table is scheduled to be rewritten.
+func (s *levelsController) reportCorruption(t *table.Table, key []byte, err error) {
+	s.corrupt.Lock()
+	if s.corrupt.ids == nil {
+		s.corrupt.ids = make(map[uint64]struct{})
+	}
+	_, seen := s.corrupt.ids[t.ID()]
+	s.corrupt.ids[t.ID()] = struct{}{}
+	s.corrupt.Unlock()
+
+	atomic.AddUint64(&s.kv.stats.corruptReads, 1)
+	s.kv.opt.Warningf("Unable to read key %q from table %d: %v. Reading it from the other "+
+		"tables instead.", y.ParseKey(key), t.ID(), err)
+	if !seen {
+		s.kv.events.add("Scheduled table %d for repair after a failed read: %v", t.ID(), err)
+	}
+}
+
+// hasCorruptTable returns true if any of the tables is known to have corrupted blocks.
+func (s *levelsController) hasCorruptTable(tables []*table.Table) bool {
+	s.corrupt.Lock()
+	defer s.corrupt.Unlock()
+	for _, t := range tables {
+		if _, ok := s.corrupt.ids[t.ID()]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetCorruptTables removes the tables from the set of corrupt tables, once they have been
+// compacted away.
+func (s *levelsController) forgetCorruptTables(tables []*table.Table) {
+	s.corrupt.Lock()
+	defer s.corrupt.Unlock()
+	for _, t := range tables {
+		delete(s.corrupt.ids, t.ID())
+	}
+}
+
+// repairCorruptTable rewrites one of the tables known to have corrupted blocks by compacting it
+// into the next level, skipping the corrupted blocks. The tables in L0 are left to the regular L0
+// compactions, which also skip the corrupted blocks. It returns true if a table was rewritten.
+func (s *levelsController) repairCorruptTable(id int) bool {
+	s.corrupt.Lock()
+	ids := make([]uint64, 0, len(s.corrupt.ids))
+	for tid := range s.corrupt.ids {
+		ids = append(ids, tid)
+	}
+	s.corrupt.Unlock()
+
+	for _, tid := range ids {
+		t, l := s.findTable(tid)
+		if t == nil {
+			// The table was compacted away in the meantime.
+			s.corrupt.Lock()
+			delete(s.corrupt.ids, tid)
+			s.corrupt.Unlock()
+			continue
+		}
+		if l == 0 {
+			continue
+		}
+		if err := s.compactTableDown(id, l, t); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// findTable returns the table with the given ID along with its level, or nil if there is no such
+// table.
+func (s *levelsController) findTable(id uint64) (*table.Table, int) {
+	for _, lh := range s.levels {
+		lh.RLock()
+		for _, t := range lh.tables {
+			if t.ID() == id {
+				lh.RUnlock()
+				return t, lh.level
+			}
+		}
+		lh.RUnlock()
+	}
+	return nil, 0
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v3/options"
+	"github.com/dgraph-io/badger/v3/table"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRepair(t *testing.T) {
+	opt := DefaultOptions("").WithNumCompactors(0).WithBlockCacheSize(0).
+		WithCompression(options.None)
+	opt.managedTxns = true
+
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		topt := buildTableOptions(db)
+		topt.ChkMode = options.OnBlockRead
+		createAndOpenWithOptions(db, []keyValVersion{{"a", "new", 2, 0}, {"b", "b", 2, 0}}, 5, &topt)
+		createAndOpenWithOptions(db, []keyValVersion{{"a", "old", 1, 0}}, 6, &topt)
+
+		// Corrupt the only block of the table in L5.
+		bad := db.lc.levels[5].tables[0]
+		bad.Data[0] ^= 0xff
+
+		txn := db.NewTransactionAt(3, false)
+		item, err := txn.Get([]byte("a"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("old"), getItemValue(t, item))
+		_, err = txn.Get([]byte("b"))
+		require.Equal(t, ErrKeyNotFound, err)
+		txn.Discard()
+		require.Equal(t, uint64(2), db.Stats().CorruptReads)
+		require.True(t, db.lc.hasCorruptTable([]*table.Table{bad}))
+
+		// The corrupt table is compacted away, and the corrupted block is dropped.
+		require.True(t, db.lc.repairCorruptTable(0))
+		require.Equal(t, 0, db.lc.levels[5].numTables())
+		require.False(t, db.lc.hasCorruptTable([]*table.Table{bad}))
+		require.False(t, db.lc.repairCorruptTable(0))
+		getAllAndCheck(t, db, []keyValVersion{{"a", "old", 1, 0}})
+	})
+}
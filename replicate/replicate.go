@@ -0,0 +1,369 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package replicate reconciles two Badger DBs over a network connection. One side runs Serve on its
+// DB, the other side runs Pull to make its DB hold the same keys as the served DB. Pull compares
+// the range hashes of both DBs (see DB.RangeHash), splitting the key space into smaller ranges
+// until the differing ranges are small enough to be transferred, so only the data which differs
+// is sent over the connection. The served DB reads those ranges with a Stream (see DB.NewStream).
+//
+// The DBs are not locked while they are being synced. Keys written to either DB during a sync may
+// or may not be reconciled; running Pull again picks them up.
+package replicate
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"io"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/pb"
+	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
+)
+
+const (
+	opInfo = iota + 1
+	opSplit
+	opFetch
+)
+
+type request struct {
+	Op    int
+	Start []byte
+	End   []byte
+}
+
+type response struct {
+	Err   string
+	Hash  []byte
+	Count int
+	Split []byte
+	KVs   []kv
+}
+
+type kv struct {
+	Key       []byte
+	Value     []byte
+	UserMeta  byte
+	ExpiresAt uint64
+}
+
+// Serve answers the requests sent by Pull over conn using db. It returns nil once conn has been
+// closed by the other side. db must not be in managed mode.
+func Serve(db *badger.DB, conn io.ReadWriter) error {
+	dec := gob.NewDecoder(conn)
+	enc := gob.NewEncoder(conn)
+	for {
+		var req request
+		if err := dec.Decode(&req); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return errors.Wrap(err, "while reading sync request")
+		}
+		resp, err := handle(db, req)
+		if err != nil {
+			resp = &response{Err: err.Error()}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return errors.Wrap(err, "while sending sync response")
+		}
+	}
+}
+
+func handle(db *badger.DB, req request) (*response, error) {
+	if req.Op == opFetch {
+		kvs, err := fetch(db, req.Start, req.End)
+		if err != nil {
+			return nil, err
+		}
+		return &response{KVs: kvs}, nil
+	}
+	resp := &response{}
+	err := db.View(func(txn *badger.Txn) error {
+		switch req.Op {
+		case opInfo:
+			hash, err := txn.RangeHash(req.Start, req.End)
+			if err != nil {
+				return err
+			}
+			resp.Hash = hash
+			resp.Count = countRange(txn, req.Start, req.End)
+			return nil
+		case opSplit:
+			n := countRange(txn, req.Start, req.End)
+			split := func(i int, item *badger.Item) error {
+				if i == n/2 {
+					resp.Split = item.KeyCopy(nil)
+					return errStop
+				}
+				return nil
+			}
+			return iterateRange(txn, req.Start, req.End, false, split)
+		}
+		return errors.Errorf("unknown sync op: %d", req.Op)
+	})
+	return resp, err
+}
+
+// fetch returns the latest version of every key in [start, end), using a Stream over db.
+func fetch(db *badger.DB, start, end []byte) ([]kv, error) {
+	var (
+		mu     sync.Mutex
+		kvs    []kv
+		valErr error
+	)
+	stream := db.NewStream()
+	stream.LogPrefix = "Replicate.Fetch"
+	// All the keys in [start, end) share the common prefix of start and end.
+	if end != nil {
+		stream.Prefix = commonPrefix(start, end)
+	}
+	stream.ChooseKey = func(item *badger.Item) bool {
+		key := item.Key()
+		if bytes.Compare(key, start) < 0 || end != nil && bytes.Compare(key, end) >= 0 {
+			return false
+		}
+		return !item.IsDeletedOrExpired()
+	}
+	stream.KeyToList = func(key []byte, itr *badger.Iterator) (*pb.KVList, error) {
+		item := itr.Item()
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			// Stream skips the keys failing KeyToList, which would make Pull delete them.
+			mu.Lock()
+			valErr = err
+			mu.Unlock()
+			return nil, err
+		}
+		return &pb.KVList{Kv: []*pb.KV{{
+			Key:       key,
+			Value:     val,
+			UserMeta:  []byte{item.UserMeta()},
+			ExpiresAt: item.ExpiresAt(),
+		}}}, nil
+	}
+	stream.Send = func(buf *z.Buffer) error {
+		list, err := badger.BufferToKVList(buf)
+		if err != nil {
+			return err
+		}
+		for _, e := range list.Kv {
+			kvs = append(kvs, kv{
+				Key:       e.Key,
+				Value:     e.Value,
+				UserMeta:  e.UserMeta[0],
+				ExpiresAt: e.ExpiresAt,
+			})
+		}
+		return nil
+	}
+	if err := stream.Orchestrate(context.Background()); err != nil {
+		return nil, errors.Wrap(err, "while streaming the range")
+	}
+	if valErr != nil {
+		return nil, errors.Wrap(valErr, "while reading a value")
+	}
+	return kvs, nil
+}
+
+func commonPrefix(a, b []byte) []byte {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return a[:n]
+}
+
+var errStop = errors.New("stop iteration")
+
+// iterateRange calls fn for every key in [start, end), along with its position in the range.
+func iterateRange(txn *badger.Txn, start, end []byte, values bool,
+	fn func(i int, item *badger.Item) error) error {
+
+	opt := badger.DefaultIteratorOptions
+	opt.PrefetchValues = values
+	itr := txn.NewIterator(opt)
+	defer itr.Close()
+
+	var i int
+	for itr.Seek(start); itr.Valid(); itr.Next() {
+		item := itr.Item()
+		if end != nil && bytes.Compare(item.Key(), end) >= 0 {
+			break
+		}
+		if err := fn(i, item); err != nil {
+			if err == errStop {
+				return nil
+			}
+			return err
+		}
+		i++
+	}
+	return nil
+}
+
+func countRange(txn *badger.Txn, start, end []byte) int {
+	var n int
+	_ = iterateRange(txn, start, end, false, func(_ int, _ *badger.Item) error {
+		n++
+		return nil
+	})
+	return n
+}
+
+// Options control how Pull reconciles the DBs.
+type Options struct {
+	// LeafSize is the number of keys below which a differing range is transferred as a whole
+	// instead of being split further. Smaller values transfer less data, at the cost of more
+	// round trips. Defaults to 1000.
+	LeafSize int
+}
+
+// DefaultOptions are the recommended options for Pull.
+var DefaultOptions = Options{
+	LeafSize: 1000,
+}
+
+// Stats tells how much work Pull had to do.
+type Stats struct {
+	RangesCompared int
+	RangesFetched  int
+	KeysSet        int
+	KeysDeleted    int
+}
+
+type puller struct {
+	db    *badger.DB
+	opt   Options
+	enc   *gob.Encoder
+	dec   *gob.Decoder
+	stats Stats
+}
+
+// Pull makes db hold the same keys as the DB served by Serve on the other side of conn. Keys
+// which only exist in db are deleted. The keys are written to db with new versions, so their
+// versions don't match the versions in the served DB. db must not be in managed mode.
+func Pull(db *badger.DB, conn io.ReadWriter, opt Options) (Stats, error) {
+	if opt.LeafSize <= 0 {
+		opt.LeafSize = DefaultOptions.LeafSize
+	}
+	p := &puller{
+		db:  db,
+		opt: opt,
+		enc: gob.NewEncoder(conn),
+		dec: gob.NewDecoder(conn),
+	}
+	err := p.syncRange(nil, nil)
+	return p.stats, err
+}
+
+func (p *puller) call(req request) (*response, error) {
+	if err := p.enc.Encode(req); err != nil {
+		return nil, errors.Wrap(err, "while sending sync request")
+	}
+	var resp response
+	if err := p.dec.Decode(&resp); err != nil {
+		return nil, errors.Wrap(err, "while reading sync response")
+	}
+	if resp.Err != "" {
+		return nil, errors.Errorf("sync server: %s", resp.Err)
+	}
+	return &resp, nil
+}
+
+// syncRange reconciles the keys in [start, end). A nil end means that the range has no upper
+// bound.
+func (p *puller) syncRange(start, end []byte) error {
+	remote, err := p.call(request{Op: opInfo, Start: start, End: end})
+	if err != nil {
+		return err
+	}
+	local, err := p.db.RangeHash(start, end)
+	if err != nil {
+		return err
+	}
+	p.stats.RangesCompared++
+	if bytes.Equal(local, remote.Hash) {
+		return nil
+	}
+	if remote.Count <= p.opt.LeafSize {
+		return p.fetchRange(start, end)
+	}
+
+	resp, err := p.call(request{Op: opSplit, Start: start, End: end})
+	if err != nil {
+		return err
+	}
+	if resp.Split == nil {
+		// The range has shrunk in the meantime.
+		return p.fetchRange(start, end)
+	}
+	if err := p.syncRange(start, resp.Split); err != nil {
+		return err
+	}
+	return p.syncRange(resp.Split, end)
+}
+
+// fetchRange replaces the keys in [start, end) with the keys of the served DB.
+func (p *puller) fetchRange(start, end []byte) error {
+	resp, err := p.call(request{Op: opFetch, Start: start, End: end})
+	if err != nil {
+		return err
+	}
+	p.stats.RangesFetched++
+
+	remote := make(map[string]struct{}, len(resp.KVs))
+	for _, kv := range resp.KVs {
+		remote[string(kv.Key)] = struct{}{}
+	}
+	var toDelete [][]byte
+	err = p.db.View(func(txn *badger.Txn) error {
+		return iterateRange(txn, start, end, false, func(_ int, item *badger.Item) error {
+			if _, ok := remote[string(item.Key())]; !ok {
+				toDelete = append(toDelete, item.KeyCopy(nil))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	wb := p.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, key := range toDelete {
+		if err := wb.Delete(key); err != nil {
+			return err
+		}
+	}
+	for _, kv := range resp.KVs {
+		e := badger.NewEntry(kv.Key, kv.Value).WithMeta(kv.UserMeta)
+		e.ExpiresAt = kv.ExpiresAt
+		if err := wb.SetEntry(e); err != nil {
+			return err
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		return err
+	}
+	p.stats.KeysDeleted += len(toDelete)
+	p.stats.KeysSet += len(resp.KVs)
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package replicate
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func openDB(t *testing.T) *badger.DB {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	return db
+}
+
+func set(t *testing.T, db *badger.DB, key, val string) {
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(key), []byte(val))
+	}))
+}
+
+func del(t *testing.T, db *badger.DB, key string) {
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(key))
+	}))
+}
+
+func pull(t *testing.T, src, dst *badger.DB, opt Options) Stats {
+	client, server := net.Pipe()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Serve(src, server)
+	}()
+	stats, err := Pull(dst, client, opt)
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+	require.NoError(t, <-errCh)
+	return stats
+}
+
+func TestPull(t *testing.T) {
+	src, dst := openDB(t), openDB(t)
+	defer src.Close()
+	defer dst.Close()
+	wb := src.NewWriteBatch()
+	wb2 := dst.NewWriteBatch()
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key%04d", i))
+		require.NoError(t, wb.Set(key, []byte("val")))
+		require.NoError(t, wb2.Set(key, []byte("val")))
+	}
+	require.NoError(t, wb.Flush())
+	require.NoError(t, wb2.Flush())
+
+	set(t, src, "key0100", "new")
+	set(t, src, "key0500a", "added")
+	del(t, src, "key0900")
+	set(t, dst, "key0700a", "stale")
+
+	opt := Options{LeafSize: 10}
+	stats := pull(t, src, dst, opt)
+	require.Equal(t, 4, stats.RangesFetched)
+	require.Equal(t, 2, stats.KeysDeleted)
+	require.Less(t, stats.KeysSet, 40)
+
+	srcHash, err := src.RangeHash(nil, nil)
+	require.NoError(t, err)
+	dstHash, err := dst.RangeHash(nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, srcHash, dstHash)
+
+	require.NoError(t, dst.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("key0100"))
+		require.NoError(t, err)
+		val, err := item.ValueCopy(nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte("new"), val)
+		_, err = txn.Get([]byte("key0900"))
+		require.Equal(t, badger.ErrKeyNotFound, err)
+		_, err = txn.Get([]byte("key0700a"))
+		require.Equal(t, badger.ErrKeyNotFound, err)
+		return nil
+	}))
+
+	// Nothing to do once the DBs are in sync.
+	stats = pull(t, src, dst, opt)
+	require.Equal(t, Stats{RangesCompared: 1}, stats)
+}
+
+func TestPullEmpty(t *testing.T) {
+	src, dst := openDB(t), openDB(t)
+	defer src.Close()
+	defer dst.Close()
+	set(t, dst, "key", "val")
+	stats := pull(t, src, dst, DefaultOptions)
+	require.Equal(t, 1, stats.KeysDeleted)
+
+	set(t, src, "key", "val")
+	stats = pull(t, src, dst, DefaultOptions)
+	require.Equal(t, 1, stats.KeysSet)
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IsTransientError returns true if err is an I/O error which could go away when the operation is
+// retried, such as ErrIOFault, a timeout or an interrupted system call. Other errors, e.g. checksum
+// mismatches or missing files, are permanent.
+func IsTransientError(err error) bool {
+	err = errors.Cause(err)
+	if err == ErrIOFault {
+		return true
+	}
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	}
+	if e, ok := err.(interface{ Timeout() bool }); ok && e.Timeout() {
+		return true
+	}
+	if e, ok := err.(interface{ Temporary() bool }); ok && e.Temporary() {
+		return true
+	}
+	return false
+}
+
+// catchFault runs fn, and returns ErrIOFault if it faults while accessing memory, which happens
+// when a memory-mapped file can't be read. Other panics are propagated.
+func catchFault(fn func() error) (err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			// The runtime errors caused by faults carry the faulting address.
+			if _, ok := r.(interface{ Addr() uintptr }); !ok {
+				panic(r)
+			}
+			err = errors.Wrapf(ErrIOFault, "%v", r)
+		}
+	}()
+	return fn()
+}
+
+// retryIO runs fn, retrying it as configured by Options.IORetries and Options.IORetryBackoff as
+// long as it fails with a transient error.
+func (db *DB) retryIO(fn func() error) error {
+	backoff := db.opt.IORetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := catchFault(fn)
+		if err == nil || attempt > db.opt.IORetries || !IsTransientError(err) {
+			return err
+		}
+		db.opt.Warningf("Retrying read after transient I/O error (attempt %d of %d): %v",
+			attempt, db.opt.IORetries, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
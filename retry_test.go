@@ -0,0 +1,106 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary" }
+func (temporaryError) Temporary() bool { return true }
+
+func TestIsTransientError(t *testing.T) {
+	require.True(t, IsTransientError(ErrIOFault))
+	require.True(t, IsTransientError(errors.Wrap(ErrIOFault, "while reading")))
+	require.True(t, IsTransientError(&os.PathError{Op: "read", Path: "x", Err: temporaryError{}}))
+	require.False(t, IsTransientError(ErrKeyNotFound))
+	require.False(t, IsTransientError(&os.PathError{Op: "open", Path: "x", Err: os.ErrNotExist}))
+}
+
+func TestCatchFault(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Mapped files can't be truncated on Windows")
+	}
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	mf, err := z.OpenMmapFile(filepath.Join(dir, "file"), os.O_RDWR|os.O_CREATE, 1<<16)
+	require.Equal(t, z.NewFile, err)
+	defer mf.Close(-1)
+	require.NoError(t, mf.Fd.Truncate(0))
+
+	// Reading the mapped memory past the end of the file faults.
+	var b byte
+	err = catchFault(func() error {
+		b = mf.Data[1<<15]
+		return nil
+	})
+	require.Equal(t, ErrIOFault, errors.Cause(err))
+	require.Zero(t, b)
+
+	// Other panics are propagated.
+	require.Panics(t, func() {
+		_ = catchFault(func() error {
+			var m map[string]int
+			m["a"] = 1
+			return nil
+		})
+	})
+}
+
+func TestRetryIO(t *testing.T) {
+	opt := getTestOptions("").WithIORetries(2).WithIORetryBackoff(0)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		var attempts int
+		err := db.retryIO(func() error {
+			attempts++
+			return &os.PathError{Op: "read", Path: "x", Err: temporaryError{}}
+		})
+		require.Error(t, err)
+		require.Equal(t, 3, attempts)
+
+		attempts = 0
+		err = db.retryIO(func() error {
+			attempts++
+			if attempts < 2 {
+				return ErrIOFault
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, attempts)
+
+		attempts = 0
+		err = db.retryIO(func() error {
+			attempts++
+			return ErrKeyNotFound
+		})
+		require.Equal(t, ErrKeyNotFound, err)
+		require.Equal(t, 1, attempts)
+	})
+}
@@ -0,0 +1,410 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package roaring
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// arrayMaxSize is the cardinality up to which a container is stored as a sorted array. Denser
+// containers are stored as a bitmap of 1<<16 bits, which takes the same 8 KiB.
+const arrayMaxSize = 4096
+
+const bitmapWords = 1 << 16 / 64
+
+const (
+	typeArray  = 0
+	typeBitmap = 1
+)
+
+// container holds the members of a Bitmap sharing the same 16 high bits.
+type container struct {
+	key    uint16
+	n      int
+	array  []uint16 // Sorted members, if the container is stored as an array.
+	bitmap []uint64 // Members as bits, if the container is stored as a bitmap.
+}
+
+func (c *container) contains(x uint16) bool {
+	if c.bitmap != nil {
+		return c.bitmap[x/64]&(1<<(x%64)) != 0
+	}
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= x })
+	return i < len(c.array) && c.array[i] == x
+}
+
+func (c *container) add(x uint16) {
+	if c.bitmap != nil {
+		if c.bitmap[x/64]&(1<<(x%64)) == 0 {
+			c.bitmap[x/64] |= 1 << (x % 64)
+			c.n++
+		}
+		return
+	}
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= x })
+	if i < len(c.array) && c.array[i] == x {
+		return
+	}
+	c.array = append(c.array, 0)
+	copy(c.array[i+1:], c.array[i:])
+	c.array[i] = x
+	c.n++
+	c.normalize()
+}
+
+func (c *container) remove(x uint16) {
+	if c.bitmap != nil {
+		if c.bitmap[x/64]&(1<<(x%64)) != 0 {
+			c.bitmap[x/64] &^= 1 << (x % 64)
+			c.n--
+			c.normalize()
+		}
+		return
+	}
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= x })
+	if i < len(c.array) && c.array[i] == x {
+		c.array = append(c.array[:i], c.array[i+1:]...)
+		c.n--
+	}
+}
+
+// words returns the members of the container as a bitmap.
+func (c *container) words() []uint64 {
+	if c.bitmap != nil {
+		return c.bitmap
+	}
+	words := make([]uint64, bitmapWords)
+	for _, x := range c.array {
+		words[x/64] |= 1 << (x % 64)
+	}
+	return words
+}
+
+// normalize switches between the array and the bitmap representation as per the cardinality.
+func (c *container) normalize() {
+	switch {
+	case c.bitmap == nil && c.n > arrayMaxSize:
+		c.bitmap = c.words()
+		c.array = nil
+	case c.bitmap != nil && c.n <= arrayMaxSize:
+		array := make([]uint16, 0, c.n)
+		c.iterate(func(x uint16) bool {
+			array = append(array, x)
+			return true
+		})
+		c.array, c.bitmap = array, nil
+	}
+}
+
+func (c *container) iterate(fn func(x uint16) bool) bool {
+	if c.bitmap == nil {
+		for _, x := range c.array {
+			if !fn(x) {
+				return false
+			}
+		}
+		return true
+	}
+	for i, w := range c.bitmap {
+		for w != 0 {
+			t := bits.TrailingZeros64(w)
+			if !fn(uint16(i*64 + t)) {
+				return false
+			}
+			w &= w - 1
+		}
+	}
+	return true
+}
+
+func fromWords(key uint16, words []uint64) *container {
+	c := &container{key: key, bitmap: words}
+	for _, w := range words {
+		c.n += bits.OnesCount64(w)
+	}
+	c.normalize()
+	return c
+}
+
+func (c *container) or(o *container) *container {
+	if c.bitmap == nil && o.bitmap == nil && c.n+o.n <= arrayMaxSize {
+		res := &container{key: c.key, array: make([]uint16, 0, c.n+o.n)}
+		i, j := 0, 0
+		for i < len(c.array) || j < len(o.array) {
+			switch {
+			case j == len(o.array) || (i < len(c.array) && c.array[i] < o.array[j]):
+				res.array = append(res.array, c.array[i])
+				i++
+			case i == len(c.array) || o.array[j] < c.array[i]:
+				res.array = append(res.array, o.array[j])
+				j++
+			default:
+				res.array = append(res.array, c.array[i])
+				i++
+				j++
+			}
+		}
+		res.n = len(res.array)
+		return res
+	}
+	words := append([]uint64{}, c.words()...)
+	for i, w := range o.words() {
+		words[i] |= w
+	}
+	return fromWords(c.key, words)
+}
+
+func (c *container) andNot(o *container) *container {
+	if c.bitmap == nil {
+		res := &container{key: c.key}
+		for _, x := range c.array {
+			if !o.contains(x) {
+				res.array = append(res.array, x)
+			}
+		}
+		res.n = len(res.array)
+		return res
+	}
+	words := append([]uint64{}, c.bitmap...)
+	for i, w := range o.words() {
+		words[i] &^= w
+	}
+	return fromWords(c.key, words)
+}
+
+func (c *container) clone() *container {
+	return &container{
+		key:    c.key,
+		n:      c.n,
+		array:  append([]uint16{}, c.array...),
+		bitmap: append([]uint64(nil), c.bitmap...),
+	}
+}
+
+// Bitmap is a compressed set of uint32 members. The members are split into containers by their
+// 16 high bits. Each container is stored either as a sorted array or as a bitmap, whichever is
+// smaller. The zero value is an empty bitmap.
+type Bitmap struct {
+	containers []*container // Sorted by key.
+}
+
+// New returns a bitmap holding the given members.
+func New(members ...uint32) *Bitmap {
+	b := &Bitmap{}
+	for _, x := range members {
+		b.Add(x)
+	}
+	return b
+}
+
+func (b *Bitmap) find(key uint16) (int, bool) {
+	i := sort.Search(len(b.containers), func(i int) bool { return b.containers[i].key >= key })
+	return i, i < len(b.containers) && b.containers[i].key == key
+}
+
+// Add adds x to the bitmap.
+func (b *Bitmap) Add(x uint32) {
+	i, ok := b.find(uint16(x >> 16))
+	if !ok {
+		b.containers = append(b.containers, nil)
+		copy(b.containers[i+1:], b.containers[i:])
+		b.containers[i] = &container{key: uint16(x >> 16)}
+	}
+	b.containers[i].add(uint16(x))
+}
+
+// Remove removes x from the bitmap.
+func (b *Bitmap) Remove(x uint32) {
+	i, ok := b.find(uint16(x >> 16))
+	if !ok {
+		return
+	}
+	c := b.containers[i]
+	c.remove(uint16(x))
+	if c.n == 0 {
+		b.containers = append(b.containers[:i], b.containers[i+1:]...)
+	}
+}
+
+// Contains returns true if x is in the bitmap.
+func (b *Bitmap) Contains(x uint32) bool {
+	i, ok := b.find(uint16(x >> 16))
+	return ok && b.containers[i].contains(uint16(x))
+}
+
+// Cardinality returns the number of members of the bitmap.
+func (b *Bitmap) Cardinality() int {
+	var n int
+	for _, c := range b.containers {
+		n += c.n
+	}
+	return n
+}
+
+// Iterate calls fn for every member of the bitmap in increasing order, until fn returns false.
+func (b *Bitmap) Iterate(fn func(x uint32) bool) {
+	for _, c := range b.containers {
+		high := uint32(c.key) << 16
+		if !c.iterate(func(x uint16) bool { return fn(high | uint32(x)) }) {
+			return
+		}
+	}
+}
+
+// ToArray returns the members of the bitmap in increasing order.
+func (b *Bitmap) ToArray() []uint32 {
+	res := make([]uint32, 0, b.Cardinality())
+	b.Iterate(func(x uint32) bool {
+		res = append(res, x)
+		return true
+	})
+	return res
+}
+
+// Or returns the union of b and o.
+func Or(b, o *Bitmap) *Bitmap {
+	res := &Bitmap{}
+	i, j := 0, 0
+	for i < len(b.containers) || j < len(o.containers) {
+		switch {
+		case j == len(o.containers) ||
+			(i < len(b.containers) && b.containers[i].key < o.containers[j].key):
+			res.containers = append(res.containers, b.containers[i].clone())
+			i++
+		case i == len(b.containers) || o.containers[j].key < b.containers[i].key:
+			res.containers = append(res.containers, o.containers[j].clone())
+			j++
+		default:
+			res.containers = append(res.containers, b.containers[i].or(o.containers[j]))
+			i++
+			j++
+		}
+	}
+	return res
+}
+
+// AndNot returns the members of b which are not in o.
+func AndNot(b, o *Bitmap) *Bitmap {
+	res := &Bitmap{}
+	for _, c := range b.containers {
+		if j, ok := o.find(c.key); ok {
+			c = c.andNot(o.containers[j])
+		} else {
+			c = c.clone()
+		}
+		if c.n > 0 {
+			res.containers = append(res.containers, c)
+		}
+	}
+	return res
+}
+
+// Format of a marshalled bitmap:
+// +----------------------+--------------------------------------------------------+
+// | Num containers (var) | Key (2) | Type (1) | Cardinality (var) | Members  ...   |
+// +----------------------+--------------------------------------------------------+
+// The members of an array container are 2 bytes each, the bits of a bitmap container take 8 KiB.
+// All the fixed size integers are little endian.
+
+// MarshalBinary encodes the bitmap.
+func (b *Bitmap) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, 16)
+	buf = appendUvarint(buf, uint64(len(b.containers)))
+	for _, c := range b.containers {
+		buf = append(buf, byte(c.key), byte(c.key>>8))
+		if c.bitmap != nil {
+			buf = append(buf, typeBitmap)
+			buf = appendUvarint(buf, uint64(c.n))
+			for _, w := range c.bitmap {
+				var tmp [8]byte
+				binary.LittleEndian.PutUint64(tmp[:], w)
+				buf = append(buf, tmp[:]...)
+			}
+			continue
+		}
+		buf = append(buf, typeArray)
+		buf = appendUvarint(buf, uint64(c.n))
+		for _, x := range c.array {
+			buf = append(buf, byte(x), byte(x>>8))
+		}
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a bitmap encoded by MarshalBinary, replacing the members of b.
+func (b *Bitmap) UnmarshalBinary(data []byte) error {
+	_, err := b.unmarshal(data)
+	return err
+}
+
+// unmarshal decodes a bitmap from the start of data and returns the number of bytes read.
+func (b *Bitmap) unmarshal(data []byte) (int, error) {
+	errCorrupt := errors.New("Corrupted bitmap")
+	num, off := binary.Uvarint(data)
+	if off <= 0 || num > 1<<16 {
+		return 0, errCorrupt
+	}
+	b.containers = make([]*container, 0, num)
+	for i := uint64(0); i < num; i++ {
+		if len(data[off:]) < 3 {
+			return 0, errCorrupt
+		}
+		c := &container{key: binary.LittleEndian.Uint16(data[off:])}
+		typ := data[off+2]
+		off += 3
+		n, sz := binary.Uvarint(data[off:])
+		if sz <= 0 || n > 1<<16 {
+			return 0, errCorrupt
+		}
+		off += sz
+		c.n = int(n)
+		switch typ {
+		case typeArray:
+			if n > arrayMaxSize || len(data[off:]) < 2*c.n {
+				return 0, errCorrupt
+			}
+			c.array = make([]uint16, c.n)
+			for j := range c.array {
+				c.array[j] = binary.LittleEndian.Uint16(data[off+2*j:])
+			}
+			off += 2 * c.n
+		case typeBitmap:
+			if len(data[off:]) < 8*bitmapWords {
+				return 0, errCorrupt
+			}
+			c.bitmap = make([]uint64, bitmapWords)
+			for j := range c.bitmap {
+				c.bitmap[j] = binary.LittleEndian.Uint64(data[off+8*j:])
+			}
+			off += 8 * bitmapWords
+		default:
+			return 0, errCorrupt
+		}
+		b.containers = append(b.containers, c)
+	}
+	return off, nil
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return append(buf, tmp[:n]...)
+}
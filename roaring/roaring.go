@@ -0,0 +1,175 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package roaring stores sets of uint32 members, such as posting lists, as roaring bitmaps in
+// Badger values. Members are added and removed via a Badger merge operator, so an update only
+// writes the members being changed instead of rewriting the whole set.
+//
+// Every update is stored as a delta holding the members added and the members removed. Merge
+// combines the deltas in the order they were written, and the merge operator periodically
+// compacts them into a single bitmap.
+package roaring
+
+import (
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// Format of a value:
+// +----------+---------------------+-----------------------------------+
+// | Kind (1) | Added members (var) | Removed members (var, delta only) |
+// +----------+---------------------+-----------------------------------+
+// A full value holds the whole set, so it has no removed members.
+const (
+	kindDelta = 0
+	kindFull  = 1
+)
+
+type value struct {
+	full    bool
+	added   *Bitmap
+	removed *Bitmap
+}
+
+func decodeValue(data []byte) (*value, error) {
+	if len(data) == 0 {
+		return nil, errors.New("Empty value")
+	}
+	v := &value{full: data[0] == kindFull, added: &Bitmap{}, removed: &Bitmap{}}
+	n, err := v.added.unmarshal(data[1:])
+	if err != nil {
+		return nil, err
+	}
+	if !v.full {
+		if _, err := v.removed.unmarshal(data[1+n:]); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func (v *value) encode() []byte {
+	buf := []byte{kindDelta}
+	if v.full {
+		buf[0] = kindFull
+	}
+	added, _ := v.added.MarshalBinary()
+	buf = append(buf, added...)
+	if !v.full {
+		removed, _ := v.removed.MarshalBinary()
+		buf = append(buf, removed...)
+	}
+	return buf
+}
+
+// AddOp returns a value which adds the members to the set when merged via Merge.
+func AddOp(members ...uint32) []byte {
+	return (&value{added: New(members...), removed: &Bitmap{}}).encode()
+}
+
+// RemoveOp returns a value which removes the members from the set when merged via Merge.
+func RemoveOp(members ...uint32) []byte {
+	return (&value{added: &Bitmap{}, removed: New(members...)}).encode()
+}
+
+// FullValue returns a value which holds the whole set.
+func FullValue(b *Bitmap) []byte {
+	return (&value{full: true, added: b}).encode()
+}
+
+// Merge is a badger.MergeFunc which applies the updates in newVal on top of existingVal. If
+// either value can't be decoded, newVal is returned as is.
+func Merge(existingVal, newVal []byte) []byte {
+	old, err := decodeValue(existingVal)
+	if err != nil {
+		return newVal
+	}
+	nv, err := decodeValue(newVal)
+	if err != nil || nv.full {
+		return newVal
+	}
+	// Applying old and then new to a set x gives (x - old.removed - new.removed) + added, where
+	// added is (old.added - new.removed) + new.added.
+	res := &value{
+		full:  old.full,
+		added: Or(AndNot(old.added, nv.removed), nv.added),
+	}
+	if !res.full {
+		// Members added back don't need to be removed first.
+		res.removed = AndNot(Or(old.removed, nv.removed), res.added)
+	}
+	return res.encode()
+}
+
+// Decode returns the set held by a value, after all its updates have been merged.
+func Decode(val []byte) (*Bitmap, error) {
+	v, err := decodeValue(val)
+	if err != nil {
+		return nil, err
+	}
+	return v.added, nil
+}
+
+// Set is a set of uint32 members stored under a single key.
+type Set struct {
+	db  *badger.DB
+	key []byte
+	op  *badger.MergeOperator
+}
+
+// NewSet returns the set stored under key, and starts a merge operator which compacts the updates
+// every dur. If the key doesn't exist yet, an empty set is written to it. Stop must be called once
+// the set is no longer used.
+func NewSet(db *badger.DB, key []byte, dur time.Duration) (*Set, error) {
+	err := db.Update(func(txn *badger.Txn) error {
+		_, err := txn.Get(key)
+		if err != badger.ErrKeyNotFound {
+			return err
+		}
+		// Writing a full value first lets the merged values drop the removed members.
+		return txn.Set(key, FullValue(&Bitmap{}))
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "while initializing set")
+	}
+	return &Set{db: db, key: key, op: db.GetMergeOperator(key, Merge, dur)}, nil
+}
+
+// Add adds the members to the set.
+func (s *Set) Add(members ...uint32) error {
+	return s.op.Add(AddOp(members...))
+}
+
+// Remove removes the members from the set.
+func (s *Set) Remove(members ...uint32) error {
+	return s.op.Add(RemoveOp(members...))
+}
+
+// Get returns the current members of the set.
+func (s *Set) Get() (*Bitmap, error) {
+	val, err := s.op.Get()
+	if err != nil {
+		return nil, err
+	}
+	return Decode(val)
+}
+
+// Stop stops the merge operator of the set.
+func (s *Set) Stop() {
+	s.op.Stop()
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package roaring
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitmap(t *testing.T) {
+	want := make(map[uint32]struct{})
+	b := New()
+	for i := 0; i < 20000; i++ {
+		// Make the first container dense enough to be stored as a bitmap.
+		x := uint32(rand.Intn(8000))
+		if i%2 == 0 {
+			x = rand.Uint32()
+		}
+		b.Add(x)
+		want[x] = struct{}{}
+	}
+	for i := 0; i < 5000; i++ {
+		x := uint32(rand.Intn(8000))
+		b.Remove(x)
+		delete(want, x)
+	}
+
+	check := func(b *Bitmap) {
+		var members []uint32
+		for x := range want {
+			members = append(members, x)
+			require.True(t, b.Contains(x))
+		}
+		sort.Slice(members, func(i, j int) bool { return members[i] < members[j] })
+		require.Equal(t, len(want), b.Cardinality())
+		require.Equal(t, members, b.ToArray())
+	}
+	check(b)
+
+	buf, err := b.MarshalBinary()
+	require.NoError(t, err)
+	decoded := &Bitmap{}
+	require.NoError(t, decoded.UnmarshalBinary(buf))
+	check(decoded)
+	require.Error(t, decoded.UnmarshalBinary(buf[:len(buf)-1]))
+
+	or := Or(New(1, 2, 1<<20), New(2, 3))
+	require.Equal(t, []uint32{1, 2, 3, 1 << 20}, or.ToArray())
+	andNot := AndNot(New(1, 2, 1<<20), New(2, 3, 1<<20))
+	require.Equal(t, []uint32{1}, andNot.ToArray())
+}
+
+func TestMerge(t *testing.T) {
+	// Merging the updates pairwise from the newest to the oldest, as the merge operator does,
+	// gives the same result as applying them in order.
+	updates := [][]byte{
+		FullValue(New(1, 2)),
+		AddOp(3, 4),
+		RemoveOp(1, 3),
+		AddOp(1),
+		RemoveOp(5),
+	}
+	val := updates[len(updates)-1]
+	for i := len(updates) - 2; i >= 0; i-- {
+		val = Merge(updates[i], val)
+	}
+	b, err := Decode(val)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{1, 2, 4}, b.ToArray())
+	// The full value doesn't keep the removed members around.
+	require.Equal(t, FullValue(b), val)
+
+	// Without a full value, the deltas are composed.
+	val = Merge(AddOp(1, 2), RemoveOp(2))
+	val = Merge(val, AddOp(2))
+	b, err = Decode(val)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{1, 2}, b.ToArray())
+}
+
+func TestSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	s, err := NewSet(db, []byte("posting/1"), 10*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, s.Add(1, 2, 3))
+	require.NoError(t, s.Remove(2))
+	require.NoError(t, s.Add(100000))
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, s.Remove(3))
+
+	b, err := s.Get()
+	require.NoError(t, err)
+	require.Equal(t, []uint32{1, 100000}, b.ToArray())
+	s.Stop()
+
+	// The set survives restarting the merge operator.
+	s, err = NewSet(db, []byte("posting/1"), time.Hour)
+	require.NoError(t, err)
+	defer s.Stop()
+	b, err = s.Get()
+	require.NoError(t, err)
+	require.Equal(t, []uint32{1, 100000}, b.ToArray())
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Permission is a kind of access to keys.
+type Permission int
+
+const (
+	// Read allows reading keys, and subscribing to their writes.
+	Read Permission = iota
+	// Write allows setting and deleting keys. It implies Read.
+	Write
+)
+
+func (p Permission) String() string {
+	if p == Write {
+		return "write"
+	}
+	return "read"
+}
+
+var (
+	// ErrUnauthenticated is returned by an authentication hook when the token is missing or
+	// invalid. The server responds with 401 Unauthorized.
+	ErrUnauthenticated = errors.New("Invalid or missing token")
+
+	// ErrForbidden is returned by an authorization hook when the access is denied. The server
+	// responds with 403 Forbidden.
+	ErrForbidden = errors.New("Access denied")
+)
+
+// Options holds the hooks used by a Server to control the access to the DB. The zero value allows
+// all requests.
+type Options struct {
+	// Authenticate returns the identity of the client holding the token. The token is empty if
+	// the request doesn't have one. If nil, the clients have an empty identity.
+	Authenticate func(token string) (identity string, err error)
+
+	// Authorize returns an error if the client with the identity may not access the keys with
+	// the prefix with the permission. The prefix is empty for requests spanning all the keys,
+	// such as /stats, and is the key itself for requests on a single key. If nil, all accesses
+	// are allowed.
+	Authorize func(identity string, perm Permission, prefix []byte) error
+
+	// RateLimit is the number of requests per second allowed for each client, with bursts of
+	// up to RateBurst requests. Clients are told apart by their identity, or by their IP address
+	// if their identity is empty. If zero, the requests are not limited.
+	RateLimit float64
+	RateBurst int
+
+	// AddrRateLimit is the number of requests per second allowed for each IP address, with
+	// bursts of up to AddrRateBurst requests. It is applied before the Authenticate and
+	// Authorize hooks, so that requests failing them are limited too. If zero, RateLimit and
+	// RateBurst are used.
+	AddrRateLimit float64
+	AddrRateBurst int
+
+	// MaxConcurrentScans is the number of scans and subscriptions each client may run at the
+	// same time. Clients are told apart by their identity, or by their IP address if their
+	// identity is empty. If zero, it is not limited.
+	MaxConcurrentScans int
+}
+
+// authorize runs the hooks for the request, and returns the identity of the client. It writes an
+// error response if the hooks fail.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, perm Permission,
+	prefix []byte) (string, bool) {
+	var identity string
+	if s.opt.Authenticate != nil {
+		token := r.Header.Get("Authorization")
+		if strings.HasPrefix(token, "Bearer ") {
+			token = token[len("Bearer "):]
+		} else {
+			token = ""
+		}
+		var err error
+		if identity, err = s.opt.Authenticate(token); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return "", false
+		}
+	}
+	if s.opt.Authorize != nil {
+		if err := s.opt.Authorize(identity, perm, prefix); err != nil {
+			code := http.StatusForbidden
+			if errors.Cause(err) == ErrUnauthenticated {
+				code = http.StatusUnauthorized
+			}
+			http.Error(w, err.Error(), code)
+			return "", false
+		}
+	}
+	return identity, true
+}
+
+// Grant gives access to the keys with a prefix.
+type Grant struct {
+	Prefix string `json:"prefix"`
+	Write  bool   `json:"write"`
+}
+
+// ACL is a static access control list, which isolates tenants by giving each of them access to
+// their own key prefixes. Its Authenticate and Authorize methods can be used as the hooks of
+// Options. It can be loaded from a JSON file such as:
+//
+//	{
+//	  "tokens": {"secret1": "tenant1", "secret2": "admin"},
+//	  "grants": {
+//	    "tenant1": [{"prefix": "t1/", "write": true}],
+//	    "admin": [{"prefix": ""}]
+//	  }
+//	}
+type ACL struct {
+	// Tokens maps the tokens to the identities of their holders.
+	Tokens map[string]string `json:"tokens"`
+	// Grants maps the identities to the prefixes they may access.
+	Grants map[string][]Grant `json:"grants"`
+}
+
+// LoadACL reads an ACL from a JSON file.
+func LoadACL(path string) (*ACL, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	acl := &ACL{}
+	if err := json.Unmarshal(data, acl); err != nil {
+		return nil, errors.Wrapf(err, "while parsing ACL file %s", path)
+	}
+	return acl, nil
+}
+
+// Authenticate returns the identity the token belongs to.
+func (a *ACL) Authenticate(token string) (string, error) {
+	identity, ok := a.Tokens[token]
+	if token == "" || !ok {
+		return "", ErrUnauthenticated
+	}
+	return identity, nil
+}
+
+// Authorize allows the access if the identity has a grant for a prefix of the given prefix, with
+// write access if perm is Write.
+func (a *ACL) Authorize(identity string, perm Permission, prefix []byte) error {
+	for _, g := range a.Grants[identity] {
+		if bytes.HasPrefix(prefix, []byte(g.Prefix)) && (perm == Read || g.Write) {
+			return nil
+		}
+	}
+	return errors.Wrapf(ErrForbidden, "%s access to prefix %q", perm, prefix)
+}
+
+// Options returns the Options enforcing the ACL.
+func (a *ACL) Options() Options {
+	return Options{Authenticate: a.Authenticate, Authorize: a.Authorize}
+}
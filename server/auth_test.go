@@ -0,0 +1,96 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	aclPath := filepath.Join(dir, "acl.json")
+	require.NoError(t, ioutil.WriteFile(aclPath, []byte(`{
+		"tokens": {"s1": "tenant1", "s2": "tenant2", "sa": "admin"},
+		"grants": {
+			"tenant1": [{"prefix": "t1/", "write": true}],
+			"tenant2": [{"prefix": "t2/", "write": true}, {"prefix": "t1/shared/"}],
+			"admin": [{"prefix": ""}]
+		}
+	}`), 0600))
+	acl, err := LoadACL(aclPath)
+	require.NoError(t, err)
+
+	db, err := badger.Open(badger.DefaultOptions(filepath.Join(dir, "db")).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+	srv := httptest.NewServer(New(db, acl.Options()))
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := func(token string) *Client {
+		return &Client{Addr: srv.URL, Token: token}
+	}
+	requireStatus := func(err error, status string) {
+		require.Error(t, err)
+		require.Contains(t, err.Error(), status)
+	}
+
+	// Unknown or missing tokens.
+	requireStatus(client("").Set(ctx, []byte("t1/a"), []byte("v")), "401")
+	requireStatus(client("bad").Set(ctx, []byte("t1/a"), []byte("v")), "401")
+
+	t1, t2, admin := client("s1"), client("s2"), client("sa")
+	require.NoError(t, t1.Set(ctx, []byte("t1/a"), []byte("v1")))
+	require.NoError(t, t1.Set(ctx, []byte("t1/shared/b"), []byte("v2")))
+	requireStatus(t1.Set(ctx, []byte("t2/a"), []byte("v")), "403")
+
+	val, err := t2.Get(ctx, []byte("t1/shared/b"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("v2"), val)
+	_, err = t2.Get(ctx, []byte("t1/a"))
+	requireStatus(err, "403")
+	requireStatus(t2.Delete(ctx, []byte("t1/shared/b")), "403")
+	_, err = t2.Get(ctx, []byte("t2/missing"))
+	require.Equal(t, ErrNotFound, err)
+
+	// Subscriptions and stats are checked too.
+	err = t2.Subscribe(ctx, []byte("t1/"), func(*KV) error { return nil })
+	requireStatus(err, "403")
+	_, err = t1.Stats(ctx)
+	requireStatus(err, "403")
+	_, err = admin.Stats(ctx)
+	require.NoError(t, err)
+	requireStatus(admin.Set(ctx, []byte("t1/a"), []byte("v")), "403")
+
+	require.NoError(t, t1.Delete(ctx, []byte("t1/a")))
+	_, err = admin.Get(ctx, []byte("t1/a"))
+	require.Equal(t, ErrNotFound, err)
+
+	require.Equal(t, ErrForbidden, errors.Cause(acl.Authorize("nobody", Read, []byte("x"))))
+}
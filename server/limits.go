@@ -0,0 +1,177 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// limiterIdleTime is the time after which the state of an idle client is dropped.
+const limiterIdleTime = time.Minute
+
+// clientState holds the rate limit and scan cap state of a client.
+type clientState struct {
+	tokens   float64
+	lastSeen time.Time
+	scans    int
+}
+
+// limiter enforces a rate limit and a scan cap for each client.
+type limiter struct {
+	rate     float64
+	burst    int
+	maxScans int
+
+	sync.Mutex
+	clients   map[string]*clientState
+	lastPrune time.Time
+}
+
+func newLimiter(rate float64, burst, maxScans int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{
+		rate:      rate,
+		burst:     burst,
+		maxScans:  maxScans,
+		clients:   make(map[string]*clientState),
+		lastPrune: time.Now(),
+	}
+}
+
+// client returns the state of a client. It must be called with the lock held.
+func (l *limiter) client(id string, now time.Time) *clientState {
+	if now.Sub(l.lastPrune) > limiterIdleTime {
+		for id, c := range l.clients {
+			if c.scans == 0 && now.Sub(c.lastSeen) > limiterIdleTime {
+				delete(l.clients, id)
+			}
+		}
+		l.lastPrune = now
+	}
+	c, ok := l.clients[id]
+	if !ok {
+		c = &clientState{tokens: float64(l.burst), lastSeen: now}
+		l.clients[id] = c
+	}
+	return c
+}
+
+// allow takes a token from the bucket of the client. If there is none, it returns the time after
+// which the next one will be available.
+func (l *limiter) allow(id string) (time.Duration, bool) {
+	if l.rate <= 0 {
+		return 0, true
+	}
+	now := time.Now()
+	l.Lock()
+	defer l.Unlock()
+	c := l.client(id, now)
+	c.tokens += now.Sub(c.lastSeen).Seconds() * l.rate
+	c.tokens = math.Min(c.tokens, float64(l.burst))
+	c.lastSeen = now
+	if c.tokens < 1 {
+		return time.Duration((1 - c.tokens) / l.rate * float64(time.Second)), false
+	}
+	c.tokens--
+	return 0, true
+}
+
+// startScan counts a scan of the client. It returns false if the client already runs the
+// maximum number of scans. Otherwise, endScan must be called once the scan is done.
+func (l *limiter) startScan(id string) bool {
+	if l.maxScans <= 0 {
+		return true
+	}
+	l.Lock()
+	defer l.Unlock()
+	c := l.client(id, time.Now())
+	if c.scans >= l.maxScans {
+		return false
+	}
+	c.scans++
+	return true
+}
+
+func (l *limiter) endScan(id string) {
+	if l.maxScans <= 0 {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	c := l.client(id, time.Now())
+	c.scans--
+	c.lastSeen = time.Now()
+}
+
+// clientID returns the identity of the client, or its IP address if it has none.
+func clientID(identity string, r *http.Request) string {
+	if identity != "" {
+		return "id:" + identity
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// allow takes a token from the bucket of the client in l. It writes an error response if there
+// is none.
+func allow(w http.ResponseWriter, l *limiter, id string) bool {
+	wait, ok := l.allow(id)
+	if !ok {
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, fmt.Sprintf("Rate limit of %g requests/s exceeded for client %s. "+
+			"Retry in %v", l.rate, id, wait.Round(time.Millisecond)), http.StatusTooManyRequests)
+	}
+	return ok
+}
+
+// begin applies the limits of the client and authorizes the request. It writes an error response
+// if the request may not proceed. Otherwise, done must be called once the request is served.
+func (s *Server) begin(w http.ResponseWriter, r *http.Request, perm Permission, prefix []byte,
+	scan bool) (done func(), ok bool) {
+	// The rate limit of the IP address is applied before running the hooks, so that requests
+	// failing them are limited too. The rate limit of the client applies once it is identified.
+	if !allow(w, s.addrLimiter, clientID("", r)) {
+		return nil, false
+	}
+	identity, ok := s.authorize(w, r, perm, prefix)
+	if !ok {
+		return nil, false
+	}
+	id := clientID(identity, r)
+	if !allow(w, s.limiter, id) {
+		return nil, false
+	}
+	if !scan {
+		return func() {}, true
+	}
+	if !s.limiter.startScan(id) {
+		http.Error(w, fmt.Sprintf("Client %s already runs %d scans or subscriptions, which is "+
+			"the maximum", id, s.opt.MaxConcurrentScans), http.StatusTooManyRequests)
+		return nil, false
+	}
+	return func() { s.limiter.endScan(id) }, true
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	acl := &ACL{
+		Tokens: map[string]string{"s1": "c1", "s2": "c2"},
+		Grants: map[string][]Grant{"c1": {{Write: true}}, "c2": {{Write: true}}},
+	}
+	opt := acl.Options()
+	opt.RateLimit = 10
+	opt.RateBurst = 5
+	opt.MaxConcurrentScans = 1
+	srv := httptest.NewServer(New(db, opt))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c1 := &Client{Addr: srv.URL, Token: "s1"}
+	c2 := &Client{Addr: srv.URL, Token: "s2"}
+
+	// The burst is allowed, and the next request is rejected until a token is refilled.
+	for i := 0; i < 4; i++ {
+		require.NoError(t, c1.Set(ctx, []byte(fmt.Sprintf("key%d", i)), []byte("val")))
+	}
+	// Requests failing the hooks count too.
+	bad := &Client{Addr: srv.URL, Token: "wrong"}
+	err = bad.Set(ctx, []byte("key"), []byte("val"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "401")
+	err = c2.Set(ctx, []byte("key"), []byte("val"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "429")
+	require.Contains(t, err.Error(), "Rate limit of 10 requests/s exceeded for client ip:127.0.0.1")
+	time.Sleep(150 * time.Millisecond)
+	require.NoError(t, c1.Set(ctx, []byte("key4"), []byte("val")))
+	time.Sleep(150 * time.Millisecond)
+
+	var keys []string
+	require.NoError(t, c2.Scan(ctx, []byte("key"), 3, func(kv *KV) error {
+		keys = append(keys, string(kv.Key))
+		return nil
+	}))
+	require.Equal(t, []string{"key0", "key1", "key2"}, keys)
+
+	// A running subscription counts as a scan.
+	subCtx, cancel := context.WithCancel(ctx)
+	subErr := make(chan error, 1)
+	go func() {
+		subErr <- c2.Subscribe(subCtx, nil, func(*KV) error { return nil })
+	}()
+	require.Eventually(t, func() bool {
+		err := c2.Scan(ctx, nil, 1, func(*KV) error { return nil })
+		return err != nil && strings.Contains(err.Error(), "already runs 1 scans")
+	}, 5*time.Second, 50*time.Millisecond)
+	cancel()
+	require.Equal(t, context.Canceled, <-subErr)
+	require.Eventually(t, func() bool {
+		return c2.Scan(ctx, nil, 1, func(*KV) error { return nil }) == nil
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestLimitsPerIdentity(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	acl := &ACL{
+		Tokens: map[string]string{"s1": "c1", "s2": "c2"},
+		Grants: map[string][]Grant{"c1": {{Write: true}}, "c2": {{Write: true}}},
+	}
+	opt := acl.Options()
+	opt.RateLimit = 1
+	opt.RateBurst = 3
+	opt.AddrRateLimit = 1
+	opt.AddrRateBurst = 8
+	srv := httptest.NewServer(New(db, opt))
+	defer srv.Close()
+
+	// The two clients share their IP address, but each has its own rate limit.
+	ctx := context.Background()
+	for _, id := range []string{"1", "2"} {
+		c := &Client{Addr: srv.URL, Token: "s" + id}
+		for i := 0; i < 3; i++ {
+			require.NoError(t, c.Set(ctx, []byte(fmt.Sprintf("key%d", i)), []byte("val")))
+		}
+		err = c.Set(ctx, []byte("key"), []byte("val"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "429")
+		require.Contains(t, err.Error(), "exceeded for client id:c"+id)
+	}
+
+	// The requests rejected by the rate limit of the clients count for their IP address.
+	c := &Client{Addr: srv.URL, Token: "s1"}
+	err = c.Set(ctx, []byte("key"), []byte("val"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Rate limit of 1 requests/s exceeded for client ip:127.0.0.1")
+}
@@ -0,0 +1,418 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package server exposes a Badger DB over HTTP, and provides a client for it. It is used by the
+// badger serve command.
+//
+// The server has the following endpoints:
+//
+//	GET /kv?key=k            Returns the value of the key k.
+//	PUT /kv?key=k            Sets the value of the key k to the request body.
+//	DELETE /kv?key=k         Deletes the key k.
+//	GET /scan?prefix=p&n=n   Returns the first n keys with prefix p and their values, as
+//	                         newline-delimited JSON encoded KV objects. All of them if n is 0.
+//	GET /stats               Returns the DB.Stats of the DB, JSON encoded.
+//	GET /subscribe?prefix=p  Streams the writes to keys with prefix p as they are committed, as
+//	                         newline-delimited JSON encoded KV objects.
+//
+// Access to the endpoints can be restricted via the hooks in Options. Clients send their token in
+// an "Authorization: Bearer <token>" header. Options also limits the rate of the requests and the
+// number of concurrent scans of each client. Requests over the limits get a 429 Too Many Requests
+// response.
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/pb"
+	"github.com/pkg/errors"
+)
+
+// KV is a key-value pair sent by the server. Byte slices are base64 encoded in JSON.
+type KV struct {
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value,omitempty"`
+	Version   uint64 `json:"version"`
+	UserMeta  byte   `json:"user_meta,omitempty"`
+	ExpiresAt uint64 `json:"expires_at,omitempty"`
+	// Error is only set on the last record of a stream which failed on the server, which has no
+	// other field set.
+	Error string `json:"error,omitempty"`
+}
+
+// Server serves a DB over HTTP.
+type Server struct {
+	db          *badger.DB
+	opt         Options
+	addrLimiter *limiter // Limits the requests of each IP address, before the hooks.
+	limiter     *limiter // Limits the requests and scans of each client.
+	mux         *http.ServeMux
+}
+
+// New returns a Server for db.
+func New(db *badger.DB, opt Options) *Server {
+	addrRate, addrBurst := opt.AddrRateLimit, opt.AddrRateBurst
+	if addrRate == 0 {
+		addrRate, addrBurst = opt.RateLimit, opt.RateBurst
+	}
+	s := &Server{
+		db:          db,
+		opt:         opt,
+		addrLimiter: newLimiter(addrRate, addrBurst, 0),
+		limiter:     newLimiter(opt.RateLimit, opt.RateBurst, opt.MaxConcurrentScans),
+		mux:         http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/kv", s.kv)
+	s.mux.HandleFunc("/scan", s.scan)
+	s.mux.HandleFunc("/stats", s.stats)
+	s.mux.HandleFunc("/subscribe", s.subscribe)
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) kv(w http.ResponseWriter, r *http.Request) {
+	key := []byte(r.URL.Query().Get("key"))
+	perm := Write
+	if r.Method == http.MethodGet {
+		perm = Read
+	}
+	done, ok := s.begin(w, r, perm, key, false)
+	if !ok {
+		return
+	}
+	defer done()
+
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		err = s.db.View(func(txn *badger.Txn) error {
+			item, err := txn.Get(key)
+			if err != nil {
+				return err
+			}
+			return item.Value(func(val []byte) error {
+				w.Header().Set("Content-Type", "application/octet-stream")
+				_, err := w.Write(val)
+				return err
+			})
+		})
+	case http.MethodPut:
+		var val []byte
+		if val, err = ioutil.ReadAll(r.Body); err == nil {
+			err = s.db.Update(func(txn *badger.Txn) error {
+				return txn.Set(key, val)
+			})
+		}
+	case http.MethodDelete:
+		err = s.db.Update(func(txn *badger.Txn) error {
+			return txn.Delete(key)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case err == badger.ErrKeyNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err == badger.ErrEmptyKey || err == badger.ErrInvalidKey || err == badger.ErrTxnTooBig:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) scan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	prefix := []byte(r.URL.Query().Get("prefix"))
+	var n int
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("Invalid n: %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+	done, ok := s.begin(w, r, Read, prefix, true)
+	if !ok {
+		return
+	}
+	defer done()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	err := s.db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.Prefix = prefix
+		it := txn.NewIterator(opt)
+		defer it.Close()
+		count := 0
+		for it.Rewind(); it.Valid() && (n == 0 || count < n); it.Next() {
+			item := it.Item()
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			err = enc.Encode(&KV{
+				Key:       item.KeyCopy(nil),
+				Value:     val,
+				Version:   item.Version(),
+				UserMeta:  item.UserMeta(),
+				ExpiresAt: item.ExpiresAt(),
+			})
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		// The response has already started, so the error is sent as the last record.
+		s.warningf("Scan of prefix %q failed: %v", prefix, err)
+		_ = enc.Encode(&KV{Error: err.Error()})
+	}
+}
+
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// The stats cover the whole DB, so they need read access to all the keys.
+	done, ok := s.begin(w, r, Read, nil, false)
+	if !ok {
+		return
+	}
+	defer done()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.db.Stats()); err != nil {
+		s.warningf("While sending stats: %v", err)
+	}
+}
+
+func (s *Server) subscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	prefix := []byte(r.URL.Query().Get("prefix"))
+	done, ok := s.begin(w, r, Read, prefix, true)
+	if !ok {
+		return
+	}
+	defer done()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	enc := json.NewEncoder(w)
+	cb := func(list *badger.KVList) error {
+		for _, kv := range list.Kv {
+			out := &KV{
+				Key:       kv.Key,
+				Value:     kv.Value,
+				Version:   kv.Version,
+				ExpiresAt: kv.ExpiresAt,
+			}
+			if len(kv.Meta) > 0 {
+				out.UserMeta = kv.Meta[0]
+			}
+			if err := enc.Encode(out); err != nil {
+				return err
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	// The subscription ends when the client goes away.
+	err := s.db.Subscribe(r.Context(), cb, []pb.Match{{Prefix: prefix}})
+	if err != nil && err != context.Canceled {
+		s.warningf("Subscription for prefix %q ended: %v", prefix, err)
+		_ = enc.Encode(&KV{Error: err.Error()})
+	}
+}
+
+// warningf logs a warning with the logger of the DB, if it has one.
+func (s *Server) warningf(format string, args ...interface{}) {
+	opt := s.db.Opts()
+	opt.Warningf(format, args...)
+}
+
+// Client talks to a Server.
+type Client struct {
+	// Addr is the base URL of the server, e.g. http://localhost:9090.
+	Addr string
+	// Token is sent to the server to authenticate the client, if not empty.
+	Token string
+	// HTTPClient is used to send the requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// ErrNotFound is returned by Client.Get when the key doesn't exist.
+var ErrNotFound = errors.New("Key not found")
+
+func (c *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, path, query, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values,
+	body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.Addr+path+"?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound && path == "/kv" {
+			return nil, ErrNotFound
+		}
+		var msg [512]byte
+		n, _ := resp.Body.Read(msg[:])
+		return nil, errors.Errorf("%s %s: %s: %s", req.Method, path, resp.Status,
+			strings.TrimSpace(string(msg[:n])))
+	}
+	return resp, nil
+}
+
+// Get returns the value of key, or ErrNotFound if it doesn't exist.
+func (c *Client) Get(ctx context.Context, key []byte) ([]byte, error) {
+	resp, err := c.get(ctx, "/kv", url.Values{"key": {string(key)}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Set sets the value of key.
+func (c *Client) Set(ctx context.Context, key, val []byte) error {
+	resp, err := c.do(ctx, http.MethodPut, "/kv", url.Values{"key": {string(key)}}, val)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Delete deletes key.
+func (c *Client) Delete(ctx context.Context, key []byte) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/kv", url.Values{"key": {string(key)}}, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Stats returns the stats of the DB served by the server.
+func (c *Client) Stats(ctx context.Context) (*badger.Stats, error) {
+	resp, err := c.get(ctx, "/stats", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var stats badger.Stats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, errors.Wrapf(err, "while reading stats")
+	}
+	return &stats, nil
+}
+
+// Scan calls fn for the first n keys with the given prefix, or all of them if n is 0.
+func (c *Client) Scan(ctx context.Context, prefix []byte, n int, fn func(kv *KV) error) error {
+	query := url.Values{"prefix": {string(prefix)}, "n": {strconv.Itoa(n)}}
+	resp, err := c.get(ctx, "/scan", query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var kv KV
+		if err := dec.Decode(&kv); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "while reading scan")
+		}
+		if kv.Error != "" {
+			return errors.Errorf("scan failed on the server: %s", kv.Error)
+		}
+		if err := fn(&kv); err != nil {
+			return err
+		}
+	}
+}
+
+// Subscribe calls fn for every write to a key with the given prefix, as they are committed on the
+// server. It blocks until ctx is done, fn returns an error or the connection is lost.
+func (c *Client) Subscribe(ctx context.Context, prefix []byte, fn func(kv *KV) error) error {
+	resp, err := c.get(ctx, "/subscribe", url.Values{"prefix": {string(prefix)}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var kv KV
+		if err := dec.Decode(&kv); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.Wrapf(err, "while reading subscription")
+		}
+		if kv.Error != "" {
+			return errors.Errorf("subscription failed on the server: %s", kv.Error)
+		}
+		if err := fn(&kv); err != nil {
+			return err
+		}
+	}
+}
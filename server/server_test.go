@@ -0,0 +1,131 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	srv := httptest.NewServer(New(db, Options{}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	kvs := make(chan *KV, 100)
+	errCh := make(chan error, 1)
+	go func() {
+		c := &Client{Addr: srv.URL}
+		errCh <- c.Subscribe(ctx, []byte("p/"), func(kv *KV) error {
+			kvs <- kv
+			return nil
+		})
+	}()
+
+	set := func(key string, meta byte) {
+		require.NoError(t, db.Update(func(txn *badger.Txn) error {
+			return txn.SetEntry(badger.NewEntry([]byte(key), []byte("v-"+key)).WithMeta(meta))
+		}))
+	}
+	// The subscription might not be registered yet, so write until the first write is received.
+	func() {
+		for {
+			set("p/first", 0)
+			select {
+			case kv := <-kvs:
+				require.Equal(t, []byte("p/first"), kv.Key)
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}()
+	for len(kvs) > 0 {
+		<-kvs
+	}
+
+	for i := 0; i < 5; i++ {
+		set(fmt.Sprintf("q/%d", i), 0)
+		set(fmt.Sprintf("p/%d", i), byte(i))
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case kv := <-kvs:
+			require.Equal(t, fmt.Sprintf("p/%d", i), string(kv.Key))
+			require.Equal(t, fmt.Sprintf("v-p/%d", i), string(kv.Value))
+			require.Equal(t, byte(i), kv.UserMeta)
+			require.NotZero(t, kv.Version)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for write %d", i)
+		}
+	}
+
+	cancel()
+	require.Equal(t, context.Canceled, <-errCh)
+}
+
+func TestStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	srv := httptest.NewServer(New(db, Options{}))
+	defer srv.Close()
+
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("key"), []byte("val"))
+	}))
+	c := &Client{Addr: srv.URL}
+	stats, err := c.Stats(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), stats.Commits.Count)
+	require.Equal(t, uint64(2), stats.Writes)
+}
+
+func TestStreamError(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	srv := httptest.NewServer(New(db, Options{}))
+	defer srv.Close()
+	require.NoError(t, db.Close())
+
+	// The scan fails once the response has started, so the error is sent as its last record.
+	c := &Client{Addr: srv.URL}
+	err = c.Scan(context.Background(), nil, 0, func(*KV) error { return nil })
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "scan failed on the server: DB Closed")
+}
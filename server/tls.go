@@ -0,0 +1,155 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// reloadInterval is how often the files of a TLS config are checked for changes.
+const reloadInterval = time.Second
+
+// TLSOptions configures TLS for a server.
+type TLSOptions struct {
+	// CertFile and KeyFile are the PEM encoded certificate and private key of the server.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile holds the PEM encoded CA certificates used to verify client certificates. If
+	// set, clients must present a valid certificate (mutual TLS).
+	ClientCAFile string
+}
+
+// tlsReloader holds the certificates of a TLS config, and reloads them when their files change,
+// so that certificates can be rotated without restarting the server.
+type tlsReloader struct {
+	opt TLSOptions
+
+	sync.Mutex
+	config    *tls.Config
+	modTimes  []time.Time
+	checkedAt time.Time
+}
+
+func (r *tlsReloader) files() []string {
+	files := []string{r.opt.CertFile, r.opt.KeyFile}
+	if r.opt.ClientCAFile != "" {
+		files = append(files, r.opt.ClientCAFile)
+	}
+	return files
+}
+
+func (r *tlsReloader) load() error {
+	var modTimes []time.Time
+	for _, f := range r.files() {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		modTimes = append(modTimes, fi.ModTime())
+	}
+	cert, err := tls.LoadX509KeyPair(r.opt.CertFile, r.opt.KeyFile)
+	if err != nil {
+		return errors.Wrapf(err, "while loading TLS certificate")
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if r.opt.ClientCAFile != "" {
+		if config.ClientCAs, err = loadCertPool(r.opt.ClientCAFile); err != nil {
+			return err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	r.config, r.modTimes = config, modTimes
+	return nil
+}
+
+// get returns the current config, reloading it first if its files changed. If reloading fails,
+// the previous config is kept.
+func (r *tlsReloader) get() *tls.Config {
+	r.Lock()
+	defer r.Unlock()
+	if time.Since(r.checkedAt) < reloadInterval {
+		return r.config
+	}
+	r.checkedAt = time.Now()
+	for i, f := range r.files() {
+		if fi, err := os.Stat(f); err == nil && !fi.ModTime().Equal(r.modTimes[i]) {
+			_ = r.load()
+			break
+		}
+	}
+	return r.config
+}
+
+// NewTLSConfig returns a TLS config for a server. The certificates are reloaded when their files
+// change.
+func NewTLSConfig(opt TLSOptions) (*tls.Config, error) {
+	r := &tlsReloader{opt: opt}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.checkedAt = time.Now()
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.get(), nil
+		},
+	}, nil
+}
+
+// NewClientTLSConfig returns a TLS config for a client. The server certificate is verified with
+// the CA certificates in caFile, or with the system CAs if caFile is empty. The client presents
+// the certificate in certFile and keyFile to the server, if they are set.
+func NewClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while loading TLS client certificate")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate signed by parent, or a self-signed CA if parent is nil.
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+// write writes the certificate and the key to dir/name.crt and dir/name.key.
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	certPath, keyPath := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	require.NoError(t, ioutil.WriteFile(certPath, certPEM, 0600))
+	der, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	require.NoError(t, ioutil.WriteFile(keyPath, keyPEM, 0600))
+	return certPath, keyPath
+}
+
+func TestTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "ca", nil)
+	// The server reads the client CAs from clientCAPath, which is replaced later on.
+	caPath, _ := ca.write(t, dir, "ca")
+	clientCAPath, _ := ca.write(t, dir, "client-ca")
+	srvCert, srvKey := newTestCert(t, "server", ca).write(t, dir, "server")
+	cliCert, cliKey := newTestCert(t, "client", ca).write(t, dir, "client")
+
+	db, err := badger.Open(badger.DefaultOptions(filepath.Join(dir, "db")).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	config, err := NewTLSConfig(TLSOptions{
+		CertFile: srvCert, KeyFile: srvKey, ClientCAFile: clientCAPath,
+	})
+	require.NoError(t, err)
+	srv := httptest.NewUnstartedServer(New(db, Options{}))
+	srv.TLS = config
+	srv.StartTLS()
+	defer srv.Close()
+
+	ctx := context.Background()
+	set := func(caFile, certFile, keyFile string) error {
+		config, err := NewClientTLSConfig(caFile, certFile, keyFile)
+		require.NoError(t, err)
+		c := &Client{
+			Addr:       srv.URL,
+			HTTPClient: &http.Client{Transport: &http.Transport{TLSClientConfig: config}},
+		}
+		return c.Set(ctx, []byte("key"), []byte("val"))
+	}
+	require.NoError(t, set(caPath, cliCert, cliKey))
+	// The client must present a certificate.
+	require.Error(t, set(caPath, "", ""))
+
+	// Replace the certificates with ones from another CA, and wait for them to be reloaded.
+	ca2 := newTestCert(t, "ca2", nil)
+	ca2Path, _ := ca2.write(t, dir, "ca2")
+	newTestCert(t, "server", ca2).write(t, dir, "server")
+	_, _ = ca2.write(t, dir, "client-ca")
+	cli2Cert, cli2Key := newTestCert(t, "client", ca2).write(t, dir, "client2")
+	time.Sleep(reloadInterval + 100*time.Millisecond)
+
+	require.NoError(t, set(ca2Path, cli2Cert, cli2Key))
+	// The old client certificate and the old server CA are no longer valid.
+	require.Error(t, set(ca2Path, cliCert, cliKey))
+	require.Error(t, set(caPath, cli2Cert, cli2Key))
+}
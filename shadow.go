@@ -0,0 +1,187 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"bytes"
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/dgraph-io/badger/v3/y"
+)
+
+// shadowSampleSize is the number of keys checked every Options.ShadowVerify writes.
+const shadowSampleSize = 32
+
+// shadow is the reference map of the latest version of every key written, kept when
+// Options.ShadowVerify is set. The write goroutine holds its lock while writing to the memtable and
+// recording the entries, so that the LSM tree and the map agree whenever the lock is free.
+type shadow struct {
+	sync.Mutex
+	every    int
+	writes   int
+	keys     map[string]shadowVersion
+	mismatch error // The first mismatch found by the periodic checks.
+}
+
+// shadowVersion is the latest version of a key known to the shadow.
+type shadowVersion struct {
+	version   uint64
+	value     []byte
+	meta      byte
+	expiresAt uint64
+}
+
+func newShadow(every int) *shadow {
+	if every <= 0 {
+		return nil
+	}
+	return &shadow{every: every, keys: make(map[string]shadowVersion)}
+}
+
+// record records the entries written to the memtable. It must be called with the lock held.
+func (s *shadow) record(entries []*Entry) {
+	for _, e := range entries {
+		if e.meta&bitFinTxn > 0 || bytes.HasPrefix(e.Key, badgerPrefix) {
+			continue
+		}
+		key, version := string(y.ParseKey(e.Key)), y.ParseTs(e.Key)
+		prev, ok := s.keys[key]
+		if ok && prev.version > version {
+			continue
+		}
+		s.writes++
+		switch {
+		case e.meta&bitMergeEntry > 0:
+			// The value is only known once the merge operator merges the entries.
+			delete(s.keys, key)
+		case e.meta&(bitValuePointer|bitCompressed|bitDelta) > 0:
+			// The values of GC rewrites and loads may be stored values. A rewrite doesn't change
+			// the value of the version.
+			if !ok || prev.version != version {
+				delete(s.keys, key)
+			}
+		default:
+			s.keys[key] = shadowVersion{
+				version:   version,
+				value:     y.SafeCopy(nil, e.Value),
+				meta:      e.meta,
+				expiresAt: e.ExpiresAt,
+			}
+		}
+	}
+}
+
+// dropPrefixes forgets the keys with any of the prefixes, or all the keys if there is none.
+func (s *shadow) dropPrefixes(prefixes ...[]byte) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	for key := range s.keys {
+		if len(prefixes) == 0 || hasAnyPrefixes([]byte(key), prefixes) {
+			delete(s.keys, key)
+		}
+	}
+}
+
+// writeToLSMShadowed writes the request to the memtable like writeToLSM, and records its entries
+// in the shadow if there is one. It checks a sample of keys every Options.ShadowVerify writes.
+func (db *DB) writeToLSMShadowed(b *request, sync bool) error {
+	s := db.shadow
+	if s == nil {
+		return db.writeToLSM(b, sync)
+	}
+	s.Lock()
+	defer s.Unlock()
+	if err := db.writeToLSM(b, sync); err != nil {
+		return err
+	}
+	s.record(b.Entries)
+	if s.writes < s.every {
+		return nil
+	}
+	s.writes = 0
+	n := 0
+	// The iteration order of the map makes a random enough sample.
+	for key, sv := range s.keys {
+		if n++; n > shadowSampleSize {
+			break
+		}
+		if err := db.checkShadowKey(key, sv); err != nil && s.mismatch == nil {
+			db.opt.Errorf("Shadow verification failed: %v", err)
+			s.mismatch = err
+		}
+	}
+	return nil
+}
+
+// VerifyShadow checks every key of the reference map kept when Options.ShadowVerify is set against
+// the DB. It returns an error wrapping ErrShadowMismatch if a key doesn't have the value written
+// last, or if one of the periodic checks found such a key. It returns nil if ShadowVerify isn't
+// set.
+func (db *DB) VerifyShadow() error {
+	s := db.shadow
+	if s == nil {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.mismatch != nil {
+		return s.mismatch
+	}
+	for key, sv := range s.keys {
+		if err := db.checkShadowKey(key, sv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkShadowKey checks that the latest version of key in the DB is sv.
+func (db *DB) checkShadowKey(key string, sv shadowVersion) error {
+	vs, err := db.get(y.KeyWithTs([]byte(key), math.MaxUint64))
+	if err != nil {
+		return y.Wrapf(err, "while reading key %q", key)
+	}
+	wantLive := !isDeletedOrExpired(sv.meta, sv.expiresAt)
+	live := vs.Version > 0 && !isDeletedOrExpired(vs.Meta, vs.ExpiresAt)
+	switch {
+	case wantLive != live:
+		return errors.Wrapf(ErrShadowMismatch, "key %q is live: %v, expected: %v", key, live,
+			wantLive)
+	case !live:
+		return nil
+	case vs.Version != sv.version:
+		return errors.Wrapf(ErrShadowMismatch, "key %q has version %d, expected %d", key,
+			vs.Version, sv.version)
+	}
+	// The transaction only serves to read the value. It has no read timestamp to release, so it
+	// isn't discarded.
+	val, err := db.versionValue(db.newTransaction(false, true), []byte(key), vs)
+	if err != nil {
+		return y.Wrapf(err, "while reading the value of key %q", key)
+	}
+	if !bytes.Equal(val, sv.value) {
+		return errors.Wrapf(ErrShadowMismatch, "key %q has value %q, expected %q", key, val,
+			sv.value)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShadowVerify(t *testing.T) {
+	opt := getTestOptions("").WithShadowVerify(10).WithValueThreshold(1 << 10)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		key := func(i int) []byte { return []byte(fmt.Sprintf("key%02d", i)) }
+		big := make([]byte, 2<<10)
+		for i := 0; i < 20; i++ {
+			txnSet(t, db, key(i), []byte(fmt.Sprintf("val%d", i)), 0)
+		}
+		require.NoError(t, db.Update(func(txn *Txn) error {
+			require.NoError(t, txn.Set(key(0), big))
+			require.NoError(t, txn.Delete(key(1)))
+			return txn.SetEntry(NewEntry(key(2), []byte("ttl")).WithTTL(time.Hour))
+		}))
+		require.NoError(t, db.VerifyShadow())
+		require.NoError(t, db.DropPrefix([]byte("key1")))
+		require.NoError(t, db.VerifyShadow())
+
+		// A key which doesn't have the value written last is a mismatch.
+		db.shadow.Lock()
+		sv := db.shadow.keys[string(key(3))]
+		sv.value = []byte("lost")
+		db.shadow.keys[string(key(3))] = sv
+		db.shadow.Unlock()
+		require.Equal(t, ErrShadowMismatch, errors.Cause(db.VerifyShadow()))
+		require.Nil(t, db.shadow.mismatch)
+
+		// The periodic checks sample all the keys, as there are fewer than shadowSampleSize.
+		for i := 0; i < 10; i++ {
+			txnSet(t, db, []byte("other"), []byte(fmt.Sprintf("val%d", i)), 0)
+		}
+		require.Equal(t, ErrShadowMismatch, errors.Cause(db.shadow.mismatch))
+		require.Equal(t, db.shadow.mismatch, db.VerifyShadow())
+	})
+}
+
+func TestShadowVerifyDisabled(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		txnSet(t, db, []byte("key"), []byte("val"), 0)
+		require.Nil(t, db.shadow)
+		require.NoError(t, db.VerifyShadow())
+	})
+}
@@ -50,6 +50,10 @@ const (
 // MaxNodeSize is the memory footprint of a node of maximum height.
 const MaxNodeSize = int(unsafe.Sizeof(node{}))
 
+// maxInlineValueSize is the largest encoded value which is allocated inline with its node when the
+// node is created. See Arena.putNodeInline.
+const maxInlineValueSize = 64
+
 type node struct {
 	// Multiple parts of the value are encoded as a single uint64 so that it
 	// can be atomically loaded and stored:
@@ -103,10 +107,18 @@ func (s *Skiplist) DecrRef() {
 }
 
 func newNode(arena *Arena, key []byte, v y.ValueStruct, height int) *node {
-	// The base level is already allocated in the node struct.
-	nodeOffset := arena.putNode(height)
-	keyOffset := arena.putKey(key)
-	val := encodeValue(arena.putVal(v), v.EncodedSize())
+	var nodeOffset, keyOffset uint32
+	var val uint64
+	if v.EncodedSize() <= maxInlineValueSize {
+		var valOffset uint32
+		nodeOffset, keyOffset, valOffset = arena.putNodeInline(height, key, v)
+		val = encodeValue(valOffset, v.EncodedSize())
+	} else {
+		// The base level is already allocated in the node struct.
+		nodeOffset = arena.putNode(height)
+		keyOffset = arena.putKey(key)
+		val = encodeValue(arena.putVal(v), v.EncodedSize())
+	}
 
 	node := arena.getNode(nodeOffset)
 	node.keyOffset = keyOffset
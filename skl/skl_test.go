@@ -129,6 +129,42 @@ func TestBasic(t *testing.T) {
 	require.EqualValues(t, 60, v.Meta)
 }
 
+func TestInlineValues(t *testing.T) {
+	l := NewSkiplist(arenaSize)
+	// Get sets the version of the values it returns.
+	small := y.ValueStruct{Value: newValue(1), Meta: 1, Version: 1}
+	large := y.ValueStruct{Value: bytes.Repeat([]byte("a"), maxInlineValueSize), Meta: 2, Version: 1}
+	l.Put(y.KeyWithTs([]byte("small"), 1), small)
+	l.Put(y.KeyWithTs([]byte("large"), 1), large)
+
+	require.Equal(t, small, l.Get(y.KeyWithTs([]byte("small"), 1)))
+	require.Equal(t, large, l.Get(y.KeyWithTs([]byte("large"), 1)))
+
+	// The key and the value of the small value follow the tower of its node.
+	n, found := l.findNear(y.KeyWithTs([]byte("small"), 1), false, true)
+	require.True(t, found)
+	nodeSize := MaxNodeSize - (maxHeight-int(n.height))*offsetSize
+	require.Equal(t, l.arena.getNodeOffset(n)+uint32(nodeSize), n.keyOffset)
+	valOffset, valSize := n.getValueOffset()
+	require.Equal(t, n.keyOffset+uint32(n.keySize), valOffset)
+	require.Equal(t, small.EncodedSize(), valSize)
+
+	// Overwrites allocate the value on its own.
+	small.Value = newValue(2)
+	l.Put(y.KeyWithTs([]byte("small"), 1), small)
+	require.Equal(t, small, l.Get(y.KeyWithTs([]byte("small"), 1)))
+
+	// The inline values are laid out with their nodes in growing skiplists too.
+	g := NewGrowingSkiplist(1 << 10)
+	for i := 0; i < 1000; i++ {
+		g.Put(y.KeyWithTs([]byte(fmt.Sprintf("%05d", i)), 1), y.ValueStruct{Value: newValue(i)})
+	}
+	for i := 0; i < 1000; i++ {
+		v := g.Get(y.KeyWithTs([]byte(fmt.Sprintf("%05d", i)), 1))
+		require.Equal(t, newValue(i), v.Value)
+	}
+}
+
 // TestConcurrentBasic tests concurrent writes followed by concurrent reads.
 func TestConcurrentBasic(t *testing.T) {
 	const n = 1000
@@ -0,0 +1,259 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3/vfs"
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SnapshotsFilename is the filename for the file which holds the named snapshots of the DB.
+	SnapshotsFilename        = "SNAPSHOTS"
+	snapshotsRewriteFilename = "SNAPSHOTS-REWRITE"
+)
+
+// snapshots tracks the named snapshots of the DB and the ReadTxns reading them. The versions
+// visible as of the read timestamp of a snapshot are kept by the compactions, and thus by the
+// value log GC, until the snapshot is released and its ReadTxns are discarded.
+type snapshots struct {
+	sync.Mutex
+	opt   Options
+	names map[string]uint64 // Read timestamps of the snapshots, by name.
+	refs  map[uint64]int    // Number of snapshots and ReadTxns holding each read timestamp.
+}
+
+// openSnapshots loads the snapshots persisted in the directory of the DB.
+func openSnapshots(opt Options) (*snapshots, error) {
+	s := &snapshots{
+		opt:   opt,
+		names: make(map[string]uint64),
+		refs:  make(map[uint64]int),
+	}
+	if opt.InMemory {
+		return s, nil
+	}
+	buf, err := vfs.ReadFile(opt.FS, filepath.Join(opt.Dir, SnapshotsFilename))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, y.Wrapf(err, "while reading %s file", SnapshotsFilename)
+	}
+	if err := s.decode(buf); err != nil {
+		return nil, err
+	}
+	for _, readTs := range s.names {
+		s.refs[readTs]++
+	}
+	return s, nil
+}
+
+// Format of the SNAPSHOTS file, with an entry per snapshot:
+// +-----------------+----------+-------------+-----+---------+
+// | Name length (4) | Name     | Read ts (8) | ... | CRC (4) |
+// +-----------------+----------+-------------+-----+---------+
+func (s *snapshots) encode() []byte {
+	names := make([]string, 0, len(s.names))
+	for name := range s.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf []byte
+	for _, name := range names {
+		buf = append(buf, y.U32ToBytes(uint32(len(name)))...)
+		buf = append(buf, name...)
+		buf = append(buf, y.U64ToBytes(s.names[name])...)
+	}
+	return append(buf, y.U32ToBytes(crc32.Checksum(buf, y.CastagnoliCrcTable))...)
+}
+
+func (s *snapshots) decode(buf []byte) error {
+	if len(buf) < 4 ||
+		crc32.Checksum(buf[:len(buf)-4], y.CastagnoliCrcTable) != y.BytesToU32(buf[len(buf)-4:]) {
+		return errors.Errorf("%s file has bad checksum", SnapshotsFilename)
+	}
+	buf = buf[:len(buf)-4]
+	for len(buf) > 0 {
+		if len(buf) < 4 || len(buf) < 4+int(y.BytesToU32(buf))+8 {
+			return errors.Errorf("%s file is truncated", SnapshotsFilename)
+		}
+		n := int(y.BytesToU32(buf))
+		s.names[string(buf[4:4+n])] = y.BytesToU64(buf[4+n:])
+		buf = buf[4+n+8:]
+	}
+	return nil
+}
+
+// persist atomically replaces the SNAPSHOTS file. It must be called with s locked.
+func (s *snapshots) persist() error {
+	if s.opt.InMemory {
+		return nil
+	}
+	return rewriteFile(s.opt.FS, s.opt.Dir, SnapshotsFilename, snapshotsRewriteFilename,
+		s.encode())
+}
+
+func (s *snapshots) create(name string, readTs uint64) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.names[name]; ok {
+		return ErrSnapshotExists
+	}
+	s.names[name] = readTs
+	if err := s.persist(); err != nil {
+		delete(s.names, name)
+		return y.Wrapf(err, "while creating snapshot %q", name)
+	}
+	s.refs[readTs]++
+	return nil
+}
+
+func (s *snapshots) release(name string) error {
+	s.Lock()
+	defer s.Unlock()
+	readTs, ok := s.names[name]
+	if !ok {
+		return ErrSnapshotNotFound
+	}
+	delete(s.names, name)
+	if err := s.persist(); err != nil {
+		s.names[name] = readTs
+		return y.Wrapf(err, "while releasing snapshot %q", name)
+	}
+	s.decrRefLocked(readTs)
+	return nil
+}
+
+// acquire returns the read timestamp of the snapshot name, which is held until decrRef is called.
+func (s *snapshots) acquire(name string) (uint64, error) {
+	s.Lock()
+	defer s.Unlock()
+	readTs, ok := s.names[name]
+	if !ok {
+		return 0, ErrSnapshotNotFound
+	}
+	s.refs[readTs]++
+	return readTs, nil
+}
+
+func (s *snapshots) decrRef(readTs uint64) {
+	s.Lock()
+	defer s.Unlock()
+	s.decrRefLocked(readTs)
+}
+
+func (s *snapshots) decrRefLocked(readTs uint64) {
+	if s.refs[readTs]--; s.refs[readTs] == 0 {
+		delete(s.refs, readTs)
+	}
+}
+
+func (s *snapshots) all() map[string]uint64 {
+	s.Lock()
+	defer s.Unlock()
+	out := make(map[string]uint64, len(s.names))
+	for name, readTs := range s.names {
+		out[name] = readTs
+	}
+	return out
+}
+
+// discardAtOrBelow lowers discardTs so that the compactions keep the versions read by the
+// snapshots.
+func (s *snapshots) discardAtOrBelow(discardTs uint64) uint64 {
+	if s == nil {
+		return discardTs
+	}
+	s.Lock()
+	defer s.Unlock()
+	for readTs := range s.refs {
+		if readTs < discardTs {
+			discardTs = readTs
+		}
+	}
+	return discardTs
+}
+
+// CreateSnapshot creates a snapshot of the DB as of now, named name, and returns its read
+// timestamp. Unlike a ReadTxn, a snapshot is persisted in the directory of the DB, so that it
+// survives restarts until it is released with ReleaseSnapshot. The versions read by the
+// snapshot are kept by the compactions and the value log GC in the meantime, so a snapshot
+// should be released as soon as it isn't needed anymore. DropAll and DropPrefix drop the data of
+// the snapshots too. Use NewSnapshotTxn to read a snapshot.
+func (db *DB) CreateSnapshot(name string) (uint64, error) {
+	if db.opt.managedTxns {
+		panic("Cannot use CreateSnapshot with managedDB=true. Use CreateSnapshotAt instead.")
+	}
+	readTs := db.orc.readTs()
+	// Hold the read watermark until the snapshot holds readTs.
+	defer db.orc.readMark.Done(readTs)
+	return readTs, db.createSnapshot(name, readTs)
+}
+
+func (db *DB) createSnapshot(name string, readTs uint64) error {
+	if db.IsClosed() {
+		return ErrDBClosed
+	}
+	if db.opt.ReadOnly {
+		return ErrReadOnlyDB
+	}
+	if name == "" {
+		return ErrInvalidRequest
+	}
+	return db.orc.snapshots.create(name, readTs)
+}
+
+// ReleaseSnapshot releases the snapshot name. The ReadTxns reading it keep their view of the DB
+// until they are discarded.
+func (db *DB) ReleaseSnapshot(name string) error {
+	if db.opt.ReadOnly {
+		return ErrReadOnlyDB
+	}
+	return db.orc.snapshots.release(name)
+}
+
+// Snapshots returns the read timestamps of the snapshots of the DB, by name.
+func (db *DB) Snapshots() map[string]uint64 {
+	return db.orc.snapshots.all()
+}
+
+// NewSnapshotTxn returns a ReadTxn reading the DB as of the snapshot name. It must be discarded
+// with Discard.
+func (db *DB) NewSnapshotTxn(name string) (*ReadTxn, error) {
+	if db.IsClosed() {
+		return nil, ErrDBClosed
+	}
+	readTs, err := db.orc.snapshots.acquire(name)
+	if err != nil {
+		return nil, err
+	}
+	txn := db.newTransaction(false, true)
+	txn.readTs = readTs
+	// The snapshot holds readTs, so the txn doesn't take part in the read watermark.
+	txn.doneRead = true
+	rt := newReadTxn(txn)
+	rt.release = func() { db.orc.snapshots.decrRef(readTs) }
+	return rt, nil
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"io/ioutil"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+	opt := getTestOptions(dir).WithNumCompactors(0)
+
+	db, err := Open(opt)
+	require.NoError(t, err)
+	txnSet(t, db, []byte("key"), []byte("v1"), 0)
+	readTs, err := db.CreateSnapshot("daily")
+	require.NoError(t, err)
+	_, err = db.CreateSnapshot("daily")
+	require.Equal(t, ErrSnapshotExists, err)
+	txnSet(t, db, []byte("key"), []byte("v2"), 0)
+	require.NoError(t, db.Close())
+
+	// The snapshot survives the restart, and the compactions keep the version it reads.
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	require.Equal(t, map[string]uint64{"daily": readTs}, db.Snapshots())
+	// Move the read watermark past the snapshot.
+	require.NoError(t, db.View(func(txn *Txn) error { return nil }))
+	require.Eventually(t, func() bool { return db.orc.discardAtOrBelow() == readTs },
+		time.Second, time.Millisecond)
+	require.NoError(t, db.lc.doCompact(-1, compactionPriority{level: 0, t: db.lc.levelTargets()}))
+
+	rt, err := db.NewSnapshotTxn("daily")
+	require.NoError(t, err)
+	item, err := rt.Get([]byte("key"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("v1"), getItemValue(t, item))
+
+	// The snapshot read keeps the version once the snapshot is released.
+	require.NoError(t, db.ReleaseSnapshot("daily"))
+	require.Equal(t, ErrSnapshotNotFound, db.ReleaseSnapshot("daily"))
+	_, err = db.NewSnapshotTxn("daily")
+	require.Equal(t, ErrSnapshotNotFound, err)
+	require.Empty(t, db.Snapshots())
+	require.Equal(t, readTs, db.orc.snapshots.discardAtOrBelow(math.MaxUint64))
+	rt.Discard()
+	require.Equal(t, uint64(math.MaxUint64), db.orc.snapshots.discardAtOrBelow(math.MaxUint64))
+
+	require.NoError(t, db.View(func(txn *Txn) error {
+		item, err := txn.Get([]byte("key"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("v2"), getItemValue(t, item))
+		return nil
+	}))
+}
+
+func TestSnapshotsEncoding(t *testing.T) {
+	s := &snapshots{names: map[string]uint64{"a": 1, "snapshot": 1 << 40}}
+	buf := s.encode()
+	got := &snapshots{names: make(map[string]uint64)}
+	require.NoError(t, got.decode(buf))
+	require.Equal(t, s.names, got.names)
+
+	buf[0] ^= 0xff
+	require.Error(t, got.decode(buf))
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v3/table"
+)
+
+// numLatencyBuckets is the number of buckets of a latencyHistogram. Bucket i holds the latencies
+// in [2^(i-1), 2^i) microseconds, so the last bucket starts at about 17 minutes.
+const numLatencyBuckets = 32
+
+// latencyHistogram records latencies in buckets of exponentially growing sizes. It is safe for
+// concurrent use, and only uses atomic operations so it can be updated on hot paths.
+type latencyHistogram struct {
+	buckets [numLatencyBuckets]uint64
+	max     int64
+}
+
+// since records the time elapsed since start. It is meant to be deferred.
+func (h *latencyHistogram) since(start time.Time) {
+	d := time.Since(start)
+	idx := bits.Len64(uint64(d / time.Microsecond))
+	if idx >= numLatencyBuckets {
+		idx = numLatencyBuckets - 1
+	}
+	atomic.AddUint64(&h.buckets[idx], 1)
+	for {
+		max := atomic.LoadInt64(&h.max)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&h.max, max, int64(d)) {
+			return
+		}
+	}
+}
+
+func (h *latencyHistogram) stats() LatencyStats {
+	var counts [numLatencyBuckets]uint64
+	var total uint64
+	for i := range counts {
+		counts[i] = atomic.LoadUint64(&h.buckets[i])
+		total += counts[i]
+	}
+	max := time.Duration(atomic.LoadInt64(&h.max))
+	// percentile returns the upper bound of the bucket holding the p-th percentile.
+	percentile := func(p float64) time.Duration {
+		if total == 0 {
+			return 0
+		}
+		want := uint64(p * float64(total))
+		var seen uint64
+		for i, c := range counts {
+			seen += c
+			if seen > want {
+				d := time.Duration(uint64(1)<<uint(i)) * time.Microsecond
+				if d > max {
+					d = max
+				}
+				return d
+			}
+		}
+		return max
+	}
+	return LatencyStats{
+		Count: total,
+		P50:   percentile(0.5),
+		P90:   percentile(0.9),
+		P99:   percentile(0.99),
+		Max:   max,
+	}
+}
+
+// dbStats holds the counters behind DB.Stats.
+type dbStats struct {
+	writes             uint64
+	compactions        uint64
+	compactedBytes     uint64
+	runningCompactions int64
+	corruptReads       uint64
+	reads              ReadTrace
+
+	getLatency    latencyHistogram
+	commitLatency latencyHistogram
+
+	keyLock  sync.Mutex
+	keyStats map[string]table.KeyStats // By table.KeyPrefix.
+}
+
+// addKeyStats accounts for the keys of a table built by b.
+func (s *dbStats) addKeyStats(b *table.Builder) {
+	stats := b.KeyStats()
+	if len(stats) == 0 {
+		return
+	}
+	s.keyLock.Lock()
+	defer s.keyLock.Unlock()
+	if s.keyStats == nil {
+		s.keyStats = make(map[string]table.KeyStats)
+	}
+	for prefix, ks := range stats {
+		total := s.keyStats[prefix]
+		total.Add(ks)
+		s.keyStats[prefix] = total
+	}
+}
+
+func (s *dbStats) keyPrefixes() map[string]table.KeyStats {
+	s.keyLock.Lock()
+	defer s.keyLock.Unlock()
+	if len(s.keyStats) == 0 {
+		return nil
+	}
+	out := make(map[string]table.KeyStats, len(s.keyStats))
+	for prefix, ks := range s.keyStats {
+		out[prefix] = ks
+	}
+	return out
+}
+
+const (
+	// minAdviceKeys is the number of keys of a prefix measured before advising on its keys.
+	minAdviceKeys = 1000
+	// The keys of a prefix are advised to be reordered if they differ by more than
+	// maxUnsharedKeyBytes bytes on average from the first key of their block, and share less
+	// than a quarter of their bytes with it.
+	maxUnsharedKeyBytes = 16
+	// The keys of a prefix are advised to be shortened if they share more than
+	// maxSharedKeyBytes bytes on average with the first key of their block.
+	maxSharedKeyBytes = 48
+)
+
+// keyAdvice returns advice on the design of the keys, from the way they are encoded in tables.
+func keyAdvice(prefixes map[string]table.KeyStats) []string {
+	var advice []string
+	for prefix, ks := range prefixes {
+		if ks.Keys < minAdviceKeys {
+			continue
+		}
+		shared := float64(ks.SharedBytes) / float64(ks.Keys)
+		unshared := float64(ks.KeyBytes-ks.SharedBytes) / float64(ks.Keys)
+		switch {
+		case unshared > maxUnsharedKeyBytes && 4*ks.SharedBytes < ks.KeyBytes:
+			advice = append(advice, fmt.Sprintf("Keys with prefix %q share only %.1f of their "+
+				"%.1f bytes with their neighbours, so prefix compression saves little in the "+
+				"tables. Put the parts of the keys which vary the most, like timestamps and "+
+				"hashes, after the parts which vary the least.", prefix, shared, shared+unshared))
+		case shared > maxSharedKeyBytes:
+			advice = append(advice, fmt.Sprintf("Keys with prefix %q share %.1f of their %.1f "+
+				"bytes with their neighbours. Prefix compression saves them in the table blocks, "+
+				"but not in the memtables, the write-ahead logs, the table indexes and the "+
+				"iterators. Consider shortening the common parts of the keys.",
+				prefix, shared, shared+unshared))
+		}
+	}
+	sort.Strings(advice)
+	return advice
+}
+
+// LatencyStats summarizes the latencies of an operation. The percentiles are approximated by
+// rounding them up to the next power of two microseconds.
+type LatencyStats struct {
+	Count uint64        `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// Stats holds statistics about the operations on a DB since it was opened. Gets, Commits, Writes,
+// Reads, LSMSize and VlogSize are only collected if Options.MetricsEnabled is set. The other
+// fields are always available.
+type Stats struct {
+	// Gets holds the latencies of Txn.Get.
+	Gets LatencyStats `json:"gets"`
+	// Commits holds the latencies of transaction commits, including write batches.
+	Commits LatencyStats `json:"commits"`
+	// Writes is the number of entries written by the commits.
+	Writes uint64 `json:"writes"`
+
+	// Compactions is the number of compactions which completed, and CompactedBytes is the size of
+	// the tables they wrote.
+	Compactions        uint64 `json:"compactions"`
+	CompactedBytes     uint64 `json:"compacted_bytes"`
+	RunningCompactions int64  `json:"running_compactions"`
+	NumLevelZeroTables int    `json:"num_level_zero_tables"`
+
+	BlockCacheHitRatio float64 `json:"block_cache_hit_ratio"`
+	IndexCacheHitRatio float64 `json:"index_cache_hit_ratio"`
+
+	LSMSize  int64 `json:"lsm_size"`
+	VlogSize int64 `json:"vlog_size"`
+
+	// CorruptReads is the number of reads which found a corrupted block, and were served from the
+	// other tables instead.
+	CorruptReads uint64 `json:"corrupt_reads"`
+
+	// Reads sums up what the Gets and the value log reads touched. Dividing its counts by
+	// Reads.Gets gives the average read amplification of a Get.
+	Reads ReadTrace `json:"reads"`
+
+	// KeyPrefixes measures how the keys are encoded in the tables written since the DB was opened,
+	// by table.KeyPrefix, and KeyAdvice holds the advice on the design of the keys derived from
+	// it. The tables store every key as the bytes that differ from the first key of its block,
+	// so keys which share little with their neighbours waste space.
+	KeyPrefixes map[string]table.KeyStats `json:"key_prefixes,omitempty"`
+	KeyAdvice   []string                  `json:"key_advice,omitempty"`
+}
+
+// Stats returns statistics about the operations on the DB since it was opened. The counters only
+// grow, so rates can be computed by calling Stats periodically.
+func (db *DB) Stats() *Stats {
+	s := &Stats{
+		Gets:               db.stats.getLatency.stats(),
+		Commits:            db.stats.commitLatency.stats(),
+		Writes:             atomic.LoadUint64(&db.stats.writes),
+		Compactions:        atomic.LoadUint64(&db.stats.compactions),
+		CompactedBytes:     atomic.LoadUint64(&db.stats.compactedBytes),
+		RunningCompactions: atomic.LoadInt64(&db.stats.runningCompactions),
+		NumLevelZeroTables: db.lc.levels[0].numTables(),
+		CorruptReads:       atomic.LoadUint64(&db.stats.corruptReads),
+		Reads:              db.stats.reads.load(),
+		KeyPrefixes:        db.stats.keyPrefixes(),
+	}
+	s.KeyAdvice = keyAdvice(s.KeyPrefixes)
+	if m := db.BlockCacheMetrics(); m != nil {
+		s.BlockCacheHitRatio = m.Ratio()
+	}
+	if m := db.IndexCacheMetrics(); m != nil {
+		s.IndexCacheHitRatio = m.Ratio()
+	}
+	s.LSMSize, s.VlogSize = db.Size()
+	return s
+}
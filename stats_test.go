@@ -0,0 +1,129 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	var h latencyHistogram
+	require.Equal(t, LatencyStats{}, h.stats())
+
+	now := time.Now()
+	for i := 0; i < 90; i++ {
+		h.since(now.Add(-10 * time.Microsecond))
+	}
+	for i := 0; i < 10; i++ {
+		h.since(now.Add(-time.Second))
+	}
+	s := h.stats()
+	require.Equal(t, uint64(100), s.Count)
+	// 10us falls into the bucket [8us, 16us).
+	require.Equal(t, 16*time.Microsecond, s.P50)
+	require.True(t, s.P99 >= time.Second, "p99: %v", s.P99)
+	require.True(t, s.Max >= time.Second, "max: %v", s.Max)
+	require.True(t, s.P99 <= s.Max)
+}
+
+func TestStats(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		for i := 0; i < 10; i++ {
+			txnSet(t, db, []byte(fmt.Sprintf("key%d", i)), []byte("val"), 0)
+		}
+		require.NoError(t, db.View(func(txn *Txn) error {
+			_, err := txn.Get([]byte("key1"))
+			return err
+		}))
+
+		s := db.Stats()
+		require.Equal(t, uint64(1), s.Gets.Count)
+		require.Equal(t, uint64(10), s.Commits.Count)
+		// Every commit writes a key and a transaction marker.
+		require.Equal(t, uint64(20), s.Writes)
+
+		createAndOpen(db, []keyValVersion{{"a", "a", 1, 0}}, 0)
+		require.NoError(t, db.CompactRange(nil, nil))
+		s = db.Stats()
+		require.Equal(t, uint64(1), s.Compactions)
+		require.NotZero(t, s.CompactedBytes)
+		require.Zero(t, s.RunningCompactions)
+	})
+}
+
+func TestStatsWithoutMetrics(t *testing.T) {
+	opt := getTestOptions("").WithMetricsEnabled(false)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		txnSet(t, db, []byte("key"), []byte("val"), 0)
+		require.NoError(t, db.View(func(txn *Txn) error {
+			_, err := txn.Get([]byte("key"))
+			return err
+		}))
+		createAndOpen(db, []keyValVersion{{"a", "a", 1, 0}}, 0)
+		require.NoError(t, db.CompactRange(nil, nil))
+
+		// The latencies and the writes are not collected, but the compactions are.
+		s := db.Stats()
+		require.Zero(t, s.Gets.Count)
+		require.Zero(t, s.Commits.Count)
+		require.Zero(t, s.Writes)
+		require.Equal(t, uint64(1), s.Compactions)
+		require.NotZero(t, s.CompactedBytes)
+	})
+}
+
+func TestKeyAdvice(t *testing.T) {
+	opt := getTestOptions("").WithMetricsEnabled(true).
+		WithMemTableSize(64 << 10).WithValueThreshold(1 << 10)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		wb := db.NewWriteBatch()
+		for i := 0; i < 2000; i++ {
+			// The timestamps at the front of the keys defeat prefix compression.
+			key := fmt.Sprintf("event:%x:%08d", rand.Int63(), i)
+			require.NoError(t, wb.Set([]byte(key), []byte("val")))
+			key = fmt.Sprintf("common:%s:%06d", strings.Repeat("x", 60), i)
+			require.NoError(t, wb.Set([]byte(key), []byte("val")))
+			require.NoError(t, wb.Set([]byte(fmt.Sprintf("ok:%06d", i)), []byte("val")))
+		}
+		require.NoError(t, wb.Flush())
+		require.NoError(t, db.CompactRange(nil, nil))
+
+		// The keys are measured in the tables flushed from the memtables, and then compacted.
+		s := db.Stats()
+		require.Len(t, s.KeyPrefixes, 3)
+		require.True(t, s.KeyPrefixes["ok:"].Keys > 2000)
+		require.Len(t, s.KeyAdvice, 2)
+		require.Contains(t, s.KeyAdvice[0], `"common:"`)
+		require.Contains(t, s.KeyAdvice[0], "shortening")
+		require.Contains(t, s.KeyAdvice[1], `"event:"`)
+		require.Contains(t, s.KeyAdvice[1], "timestamps")
+	})
+}
+
+func TestKeyAdviceMetricsDisabled(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		txnSet(t, db, []byte("key"), []byte("val"), 0)
+		require.NoError(t, db.CompactRange(nil, nil))
+		require.Empty(t, db.Stats().KeyPrefixes)
+	})
+}
@@ -176,7 +176,8 @@ func (sw *StreamWriter) Write(buf *z.Buffer) error {
 		}
 		var meta, userMeta byte
 		if len(kv.Meta) > 0 {
-			meta = kv.Meta[0]
+			// The values of KVs are never compressed nor delta encoded.
+			meta = kv.Meta[0] &^ (bitCompressed | bitDelta)
 		}
 		if len(kv.UserMeta) > 0 {
 			userMeta = kv.UserMeta[0]
@@ -282,10 +283,12 @@ func (sw *StreamWriter) Flush() error {
 	}
 
 	if !sw.db.opt.managedTxns {
+		orc := newOracle(sw.db.opt)
 		if sw.db.orc != nil {
 			sw.db.orc.Stop()
+			orc.snapshots = sw.db.orc.snapshots
 		}
-		sw.db.orc = newOracle(sw.db.opt)
+		sw.db.orc = orc
 		sw.db.orc.nextTxnTs = sw.maxVersion
 		sw.db.orc.txnMark.Done(sw.maxVersion)
 		sw.db.orc.readMark.Done(sw.maxVersion)
@@ -361,6 +364,7 @@ func (sw *StreamWriter) newWriter(streamID uint32) (*sortedWriter, error) {
 	for i := 2; i < sw.db.opt.MaxLevels; i++ {
 		bopts.TableSize *= uint64(sw.db.opt.TableSizeMultiplier)
 	}
+	bopts.BloomFalsePositive = sw.db.opt.bloomFalsePositive(sw.db.opt.MaxLevels - 1)
 	w := &sortedWriter{
 		db:       sw.db,
 		opts:     bopts,
@@ -388,12 +392,12 @@ func (w *sortedWriter) handleRequests() {
 			// only. In managed mode, we do not write values to vlog and hence we would not have
 			// req.Ptrs initialized.
 			if w.db.opt.managedTxns || e.skipVlogAndSetThreshold(w.db.valueThreshold()) {
-				vs = y.ValueStruct{
+				vs = w.db.compressValue(e.Key, y.ValueStruct{
 					Value:     e.Value,
 					Meta:      e.meta,
 					UserMeta:  e.UserMeta,
 					ExpiresAt: e.ExpiresAt,
-				}
+				})
 			} else {
 				vptr := req.Ptrs[i]
 				vs = y.ValueStruct{
@@ -502,6 +506,10 @@ func (w *sortedWriter) createTable(builder *table.Builder) error {
 		if tbl, err = table.CreateTable(fname, builder); err != nil {
 			return err
 		}
+		if err = w.db.uploadTables([]*table.Table{tbl}); err != nil {
+			_ = tbl.DecrRef()
+			return err
+		}
 	}
 	lc := w.db.lc
 
@@ -149,6 +149,7 @@ type Entry struct {
 	// Fields maintained internally.
 	hlen         int // Length of the header.
 	valThreshold int64
+	delta        []byte // Stored instead of Value in the LSM tree if set. See DB.encodeDeltas.
 }
 
 func (e *Entry) isZero() bool {
@@ -171,7 +172,8 @@ func (e *Entry) skipVlogAndSetThreshold(threshold int64) bool {
 	if e.valThreshold == 0 {
 		e.valThreshold = threshold
 	}
-	return int64(len(e.Value)) < e.valThreshold
+	// A delta is only set if it is below the threshold.
+	return e.delta != nil || int64(len(e.Value)) < e.valThreshold
 }
 
 func (e Entry) print(prefix string) {
@@ -88,8 +88,12 @@ type Builder struct {
 	keyHashes     []uint32 // Used for building the bloomfilter.
 	opts          *Options
 	maxVersion    uint64
+	minVersion    uint64
+	maxExpiresAt  uint64
+	noExpiry      bool // Set if some key doesn't expire.
 	onDiskSize    uint32
 	staleDataSize int
+	keyStats      map[string]*KeyStats // Only set if opts.MetricsEnabled is.
 
 	// Used to concurrently compress/encrypt blocks.
 	wg        sync.WaitGroup
@@ -217,9 +221,18 @@ func (b *Builder) keyDiff(newKey []byte) []byte {
 func (b *Builder) addHelper(key []byte, v y.ValueStruct, vpLen uint32) {
 	b.keyHashes = append(b.keyHashes, y.Hash(y.ParseKey(key)))
 
-	if version := y.ParseTs(key); version > b.maxVersion {
+	version := y.ParseTs(key)
+	if version > b.maxVersion {
 		b.maxVersion = version
 	}
+	if b.minVersion == 0 || version < b.minVersion {
+		b.minVersion = version
+	}
+	if v.ExpiresAt == 0 {
+		b.noExpiry = true
+	} else if v.ExpiresAt > b.maxExpiresAt {
+		b.maxExpiresAt = v.ExpiresAt
+	}
 
 	// diffKey stores the difference of key with baseKey.
 	var diffKey []byte
@@ -246,6 +259,9 @@ func (b *Builder) addHelper(key []byte, v y.ValueStruct, vpLen uint32) {
 	// Layout: header, diffKey, value.
 	b.append(h.Encode())
 	b.append(diffKey)
+	if b.opts.MetricsEnabled {
+		b.addKeyStats(key, diffKey)
+	}
 
 	dst := b.allocate(int(v.EncodedSize()))
 	v.Encode(dst)
@@ -527,6 +543,9 @@ func (b *Builder) compressData(data []byte) ([]byte, error) {
 	case options.ZSTD:
 		sz := y.ZSTDCompressBound(len(data))
 		dst := b.alloc.Allocate(sz)
+		if b.opts.ZSTDDictID != 0 {
+			return b.opts.ZSTDDicts.Compress(dst, data, b.opts.ZSTDDictID)
+		}
 		return y.ZSTDCompress(dst, data, b.opts.ZSTDCompressionLevel)
 	}
 	return nil, errors.New("Unsupported compression type")
@@ -555,6 +574,10 @@ func (b *Builder) buildIndex(bloom []byte) ([]byte, uint32) {
 	fb.TableIndexAddOffsets(builder, boEnd)
 	fb.TableIndexAddBloomFilter(builder, bfoff)
 	fb.TableIndexAddMaxVersion(builder, b.maxVersion)
+	fb.TableIndexAddMinVersion(builder, b.minVersion)
+	if !b.noExpiry {
+		fb.TableIndexAddMaxExpiresAt(builder, b.maxExpiresAt)
+	}
 	fb.TableIndexAddUncompressedSize(builder, b.uncompressedSize)
 	fb.TableIndexAddKeyCount(builder, uint32(len(b.keyHashes)))
 	fb.TableIndexAddOnDiskSize(builder, b.onDiskSize)
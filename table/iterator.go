@@ -24,6 +24,7 @@ import (
 
 	"github.com/dgraph-io/badger/v3/fb"
 	"github.com/dgraph-io/badger/v3/y"
+	"github.com/pkg/errors"
 )
 
 type blockIterator struct {
@@ -182,6 +183,10 @@ type Iterator struct {
 	// Internally, Iterator is bidirectional. However, we only expose the
 	// unidirectional functionality for now.
 	opt int // Valid options are REVERSED and NOCACHE.
+
+	// blocks counts the blocks the iterator went through, and blockReads the ones it didn't find
+	// in the block cache.
+	blocks, blockReads int
 }
 
 // NewIterator returns a new iterator of the Table
@@ -207,10 +212,53 @@ func (itr *Iterator) Valid() bool {
 	return itr.err == nil
 }
 
+// Error returns the error which made the iterator invalid, e.g. a checksum mismatch while reading
+// a block. It returns nil if the iterator is valid, or if it reached the end of the table.
+func (itr *Iterator) Error() error {
+	if itr.err == io.EOF {
+		return nil
+	}
+	return itr.err
+}
+
+// skipBlock returns true if the iterator should move past a block which failed to be read.
+func (itr *Iterator) skipBlock() bool {
+	return itr.opt&SKIPCORRUPT != 0
+}
+
 func (itr *Iterator) useCache() bool {
 	return itr.opt&NOCACHE == 0
 }
 
+// BlockReads returns the number of blocks the iterator went through so far, and how many of them
+// it read from the table data rather than from the block cache.
+func (itr *Iterator) BlockReads() (blocks, fromFile int) {
+	return itr.blocks, itr.blockReads
+}
+
+// block returns the block idx of the table, verifying its checksum if VERIFY is set and the table
+// doesn't verify it on read already.
+func (itr *Iterator) block(idx int) (*block, error) {
+	itr.blocks++
+	blk, ok := itr.t.cachedBlock(idx)
+	var err error
+	if !ok {
+		if itr.opt&CACHEONLY != 0 && !itr.t.IsInmemory {
+			return nil, ErrNotCached
+		}
+		itr.blockReads++
+		blk, err = itr.t.readBlock(idx, itr.useCache())
+	}
+	if err != nil || itr.opt&VERIFY == 0 || itr.t.verifiesBlocks() {
+		return blk, err
+	}
+	if err = blk.verifyCheckSum(); err != nil {
+		blk.decrRef()
+		return nil, &y.CorruptionError{File: itr.t.Filename(), Offset: int64(blk.offset), Err: err}
+	}
+	return blk, nil
+}
+
 func (itr *Iterator) seekToFirst() {
 	numBlocks := itr.t.offsetsLength()
 	if numBlocks == 0 {
@@ -218,7 +266,13 @@ func (itr *Iterator) seekToFirst() {
 		return
 	}
 	itr.bpos = 0
-	block, err := itr.t.block(itr.bpos, itr.useCache())
+	block, err := itr.block(itr.bpos)
+	if err != nil && itr.skipBlock() {
+		itr.bpos++
+		itr.bi.data = nil
+		itr.next()
+		return
+	}
 	if err != nil {
 		itr.err = err
 		return
@@ -237,7 +291,7 @@ func (itr *Iterator) seekToLast() {
 		return
 	}
 	itr.bpos = numBlocks - 1
-	block, err := itr.t.block(itr.bpos, itr.useCache())
+	block, err := itr.block(itr.bpos)
 	if err != nil {
 		itr.err = err
 		return
@@ -251,7 +305,13 @@ func (itr *Iterator) seekToLast() {
 
 func (itr *Iterator) seekHelper(blockIdx int, key []byte) {
 	itr.bpos = blockIdx
-	block, err := itr.t.block(blockIdx, itr.useCache())
+	block, err := itr.block(blockIdx)
+	if err != nil && itr.skipBlock() {
+		itr.bpos++
+		itr.bi.data = nil
+		itr.next()
+		return
+	}
 	if err != nil {
 		itr.err = err
 		return
@@ -328,7 +388,12 @@ func (itr *Iterator) next() {
 	}
 
 	if len(itr.bi.data) == 0 {
-		block, err := itr.t.block(itr.bpos, itr.useCache())
+		block, err := itr.block(itr.bpos)
+		if err != nil && itr.skipBlock() {
+			itr.bpos++
+			itr.next()
+			return
+		}
 		if err != nil {
 			itr.err = err
 			return
@@ -358,7 +423,7 @@ func (itr *Iterator) prev() {
 	}
 
 	if len(itr.bi.data) == 0 {
-		block, err := itr.t.block(itr.bpos, itr.useCache())
+		block, err := itr.block(itr.bpos)
 		if err != nil {
 			itr.err = err
 			return
@@ -430,8 +495,20 @@ func (itr *Iterator) Seek(key []byte) {
 var (
 	REVERSED int = 2
 	NOCACHE  int = 4
+	// SKIPCORRUPT makes a forward iterator skip the blocks which fail to be read, e.g. because of a
+	// checksum mismatch, instead of stopping.
+	SKIPCORRUPT int = 8
+	// VERIFY makes the iterator verify the checksums of the blocks it reads, whatever the
+	// checksum verification mode of the table.
+	VERIFY int = 16
+	// CACHEONLY makes the iterator fail with ErrNotCached instead of reading the blocks of
+	// on-disk tables which aren't in the block cache.
+	CACHEONLY int = 32
 )
 
+// ErrNotCached is returned by CACHEONLY iterators which would have to read a block from the disk.
+var ErrNotCached = errors.New("Block isn't cached")
+
 // ConcatIterator concatenates the sequences defined by several iterators.  (It only works with
 // TableIterators, probably just because it's faster to not be so generic.)
 type ConcatIterator struct {
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package table
+
+// maxKeyPrefixes bounds the number of prefixes a Builder accounts for separately. The keys of the
+// other prefixes are accounted for under the empty prefix.
+const maxKeyPrefixes = 256
+
+// maxKeyPrefixLen bounds the length of the prefixes returned by KeyPrefix.
+const maxKeyPrefixLen = 32
+
+// KeyStats accounts for the space taken by keys in the blocks of tables. A block stores every key
+// as the bytes it shares with the first key of the block, which are not stored again, and the
+// bytes that differ. The keys include their 8 bytes of version.
+type KeyStats struct {
+	Keys        uint64 `json:"keys"`
+	KeyBytes    uint64 `json:"key_bytes"`
+	SharedBytes uint64 `json:"shared_bytes"`
+}
+
+// Add adds the counts of o to s.
+func (s *KeyStats) Add(o KeyStats) {
+	s.Keys += o.Keys
+	s.KeyBytes += o.KeyBytes
+	s.SharedBytes += o.SharedBytes
+}
+
+// KeyPrefix returns the prefix of a user key that its KeyStats are grouped by: the leading
+// letters followed by a separator, like "user:" or "orders/", or the first byte of keys starting
+// with a non printable byte, which is how binary keys usually encode their type. It returns an
+// empty prefix for the other keys, like the ones starting with a number or a timestamp.
+func KeyPrefix(key []byte) []byte {
+	if len(key) > 0 && (key[0] < ' ' || key[0] > '~') {
+		return key[:1]
+	}
+	for i := 0; i < len(key) && i < maxKeyPrefixLen; i++ {
+		switch c := key[i]; {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+			continue
+		case i > 0 && (c == ':' || c == '/' || c == '|' || c == '#' || c == '.' || c == '-' ||
+			c == '_'):
+			return key[:i+1]
+		}
+		return nil
+	}
+	return nil
+}
+
+// addKeyStats accounts for a key stored as diffKey in the current block.
+func (b *Builder) addKeyStats(key, diffKey []byte) {
+	if b.keyStats == nil {
+		b.keyStats = make(map[string]*KeyStats)
+	}
+	prefix := KeyPrefix(key[:len(key)-8])
+	s, ok := b.keyStats[string(prefix)]
+	if !ok {
+		if len(b.keyStats) >= maxKeyPrefixes {
+			prefix = nil
+		}
+		if s, ok = b.keyStats[string(prefix)]; !ok {
+			s = &KeyStats{}
+			b.keyStats[string(prefix)] = s
+		}
+	}
+	s.Keys++
+	s.KeyBytes += uint64(len(key))
+	s.SharedBytes += uint64(len(key) - len(diffKey))
+}
+
+// KeyStats returns the KeyStats of the keys added to the table, by KeyPrefix. They are only
+// collected if Options.MetricsEnabled is set.
+func (b *Builder) KeyStats() map[string]KeyStats {
+	if len(b.keyStats) == 0 {
+		return nil
+	}
+	out := make(map[string]KeyStats, len(b.keyStats))
+	for prefix, s := range b.keyStats {
+		out[prefix] = *s
+	}
+	return out
+}
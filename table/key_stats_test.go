@@ -0,0 +1,61 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package table
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyPrefix(t *testing.T) {
+	for key, prefix := range map[string]string{
+		"user:1234":           "user:",
+		"orders/2021/01":      "orders/",
+		"user12:x":            "",
+		"2021-01-01T00:00:00": "",
+		"abc":                 "",
+		":abc":                "",
+		"\x01abc":             "\x01",
+		"":                    "",
+	} {
+		require.Equal(t, prefix, string(KeyPrefix([]byte(key))), "key: %q", key)
+	}
+}
+
+func TestBuilderKeyStats(t *testing.T) {
+	opts := Options{BlockSize: 4 * 1024, BloomFalsePositive: 0.01}
+	b := NewTableBuilder(opts)
+	b.Add(y.KeyWithTs([]byte("user:1"), 1), y.ValueStruct{}, 0)
+	require.Nil(t, b.KeyStats())
+	b.Close()
+
+	opts.MetricsEnabled = true
+	b = NewTableBuilder(opts)
+	defer b.Close()
+	for i := 0; i < 100; i++ {
+		b.Add(y.KeyWithTs([]byte(fmt.Sprintf("user:%04d", i)), 1), y.ValueStruct{}, 0)
+	}
+	b.Add(y.KeyWithTs([]byte("zzz"), 1), y.ValueStruct{}, 0)
+	stats := b.KeyStats()
+	require.Len(t, stats, 2)
+	require.Equal(t, KeyStats{Keys: 1, KeyBytes: 11}, stats[""])
+	// The first key is stored in full, the others share "user:000" or "user:00" with it.
+	require.Equal(t, KeyStats{Keys: 100, KeyBytes: 1700, SharedBytes: 9*8 + 90*7}, stats["user:"])
+}
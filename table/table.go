@@ -38,12 +38,17 @@ import (
 	"github.com/dgraph-io/badger/v3/fb"
 	"github.com/dgraph-io/badger/v3/options"
 	"github.com/dgraph-io/badger/v3/pb"
+	"github.com/dgraph-io/badger/v3/vfs"
 	"github.com/dgraph-io/badger/v3/y"
 	"github.com/dgraph-io/ristretto"
 	"github.com/dgraph-io/ristretto/z"
 )
 
 const fileSuffix = ".sst"
+
+// TempSuffix is appended to the name of a table while it is being written. The table is renamed to
+// its final name only once it is complete, so a table file with the final name is never partial.
+const TempSuffix = ".tmp"
 const intSize = int(unsafe.Sizeof(int(0)))
 
 // Options contains configurable options for Table/Builder.
@@ -54,6 +59,13 @@ type Options struct {
 	ReadOnly       bool
 	MetricsEnabled bool
 
+	// FileIO makes tables read and write their files with regular file I/O instead of mapping
+	// them in memory. It is used on network filesystems.
+	FileIO bool
+
+	// FS is the filesystem holding the table files. It defaults to vfs.OS.
+	FS vfs.FS
+
 	// Maximum size of the table.
 	TableSize     uint64
 	tableCapacity uint64 // 0.9x TableSize.
@@ -83,6 +95,18 @@ type Options struct {
 
 	// ZSTDCompressionLevel is the ZSTD compression level used for compressing blocks.
 	ZSTDCompressionLevel int
+
+	// ZSTDDicts holds the zstd dictionaries the blocks may be compressed with. ZSTDDictID is the
+	// ID of the one the builder compresses blocks with, or 0 for none.
+	ZSTDDicts  *y.ZSTDDicts
+	ZSTDDictID uint32
+}
+
+func (o *Options) fs() vfs.FS {
+	if o.FS == nil {
+		return vfs.OS
+	}
+	return o.FS
 }
 
 // TableInterface is useful for testing.
@@ -97,6 +121,7 @@ type TableInterface interface {
 type Table struct {
 	sync.Mutex
 	*z.MmapFile
+	file vfs.File // Used instead of the memory map if opt.FileIO is set.
 
 	tableSize int // Initialized in OpenTable, using fd.Stat().
 
@@ -120,6 +145,8 @@ type Table struct {
 
 type cheapIndex struct {
 	MaxVersion        uint64
+	MinVersion        uint64
+	MaxExpiresAt      uint64
 	KeyCount          uint32
 	UncompressedSize  uint32
 	OnDiskSize        uint32
@@ -135,6 +162,14 @@ func (t *Table) offsetsLength() int { return t.cheapIndex().OffsetsLength }
 // MaxVersion returns the maximum version across all keys stored in this table.
 func (t *Table) MaxVersion() uint64 { return t.cheapIndex().MaxVersion }
 
+// MinVersion returns the minimum version across all keys stored in this table. It is zero for
+// tables written before the minimum version was recorded.
+func (t *Table) MinVersion() uint64 { return t.cheapIndex().MinVersion }
+
+// MaxExpiresAt returns the latest expiry time across all keys stored in this table. It is zero if
+// some key doesn't expire, or for tables written before the expiry time was recorded.
+func (t *Table) MaxExpiresAt() uint64 { return t.cheapIndex().MaxExpiresAt }
+
 // BloomFilterSize returns the size of the bloom filter in bytes stored in memory.
 func (t *Table) BloomFilterSize() int { return t.cheapIndex().BloomFilterLength }
 
@@ -257,21 +292,49 @@ func (b block) verifyCheckSum() error {
 
 func CreateTable(fname string, builder *Builder) (*Table, error) {
 	bd := builder.Done()
-	mf, err := newFile(fname, bd.Size)
+	if builder.opts.FileIO {
+		buf := make([]byte, bd.Size)
+		written := bd.Copy(buf)
+		y.AssertTrue(written == len(buf))
+		return createFileTable(fname, buf, *builder.opts)
+	}
+	fs := builder.opts.fs()
+	mf, err := newFile(fs, fname+TempSuffix, bd.Size)
 	if err != nil {
 		return nil, err
 	}
 
 	written := bd.Copy(mf.Data)
 	y.AssertTrue(written == len(mf.Data))
-	if err := z.Msync(mf.Data); err != nil {
-		return nil, y.Wrapf(err, "while calling msync on %s", fname)
+	if mf, err = publishFile(fs, mf, fname); err != nil {
+		return nil, err
 	}
 	return OpenTable(mf, *builder.opts)
 }
 
-func newFile(fname string, sz int) (*z.MmapFile, error) {
-	mf, err := z.OpenMmapFile(fname, os.O_CREATE|os.O_RDWR|os.O_EXCL, sz)
+// publishFile syncs the table written to fname+TempSuffix, and atomically renames it to fname. The
+// file is closed before the rename, as Windows doesn't allow renaming open files, and reopened
+// under its final name. The temporary file is removed on failure.
+func publishFile(fs vfs.FS, mf *z.MmapFile, fname string) (*z.MmapFile, error) {
+	tmpName := fname + TempSuffix
+	// Close syncs the file before closing it.
+	if err := mf.Close(-1); err != nil {
+		_ = fs.Remove(tmpName)
+		return nil, y.Wrapf(err, "while closing %s", tmpName)
+	}
+	if err := fs.Rename(tmpName, fname); err != nil {
+		_ = fs.Remove(tmpName)
+		return nil, y.Wrapf(err, "while renaming %s to %s", tmpName, fname)
+	}
+	mf, err := fs.OpenMmapFile(fname, os.O_RDWR, 0)
+	if err != nil {
+		return nil, y.Wrapf(err, "while opening table: %s", fname)
+	}
+	return mf, nil
+}
+
+func newFile(fs vfs.FS, fname string, sz int) (*z.MmapFile, error) {
+	mf, err := fs.OpenMmapFile(fname, os.O_CREATE|os.O_RDWR|os.O_EXCL, sz)
 	if err == z.NewFile {
 		// Expected.
 	} else if err != nil {
@@ -283,7 +346,10 @@ func newFile(fname string, sz int) (*z.MmapFile, error) {
 }
 
 func CreateTableFromBuffer(fname string, buf []byte, opts Options) (*Table, error) {
-	mf, err := newFile(fname, len(buf))
+	if opts.FileIO {
+		return createFileTable(fname, buf, opts)
+	}
+	mf, err := newFile(opts.fs(), fname+TempSuffix, len(buf))
 	if err != nil {
 		return nil, err
 	}
@@ -291,36 +357,102 @@ func CreateTableFromBuffer(fname string, buf []byte, opts Options) (*Table, erro
 	// We cannot use the buf directly here because it is not mmapped.
 	written := copy(mf.Data, buf)
 	y.AssertTrue(written == len(mf.Data))
-	if err := z.Msync(mf.Data); err != nil {
-		return nil, y.Wrapf(err, "while calling msync on %s", fname)
+	if mf, err = publishFile(opts.fs(), mf, fname); err != nil {
+		return nil, err
 	}
 	return OpenTable(mf, opts)
 }
 
+// createFileTable writes buf to fname+TempSuffix with regular file I/O, syncs it, and atomically
+// renames it to fname, like publishFile does for the mapped files.
+func createFileTable(fname string, buf []byte, opts Options) (*Table, error) {
+	tmpName := fname + TempSuffix
+	fs := opts.fs()
+	fd, err := fs.OpenFile(tmpName, os.O_CREATE|os.O_RDWR|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, y.Wrapf(err, "while creating table: %s", tmpName)
+	}
+	_, err = fd.Write(buf)
+	if err == nil {
+		err = fd.Sync()
+	}
+	if closeErr := fd.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = fs.Remove(tmpName)
+		return nil, y.Wrapf(err, "while writing table: %s", tmpName)
+	}
+	if err := fs.Rename(tmpName, fname); err != nil {
+		_ = fs.Remove(tmpName)
+		return nil, y.Wrapf(err, "while renaming %s to %s", tmpName, fname)
+	}
+	return OpenTableFile(fname, os.O_RDWR, opts)
+}
+
+// OpenTableFile opens the table in the file fname with the given flags. The file is mapped in
+// memory, unless opts.FileIO is set.
+func OpenTableFile(fname string, flag int, opts Options) (*Table, error) {
+	if !opts.FileIO {
+		mf, err := opts.fs().OpenMmapFile(fname, flag, 0)
+		if err != nil {
+			return nil, y.Wrapf(err, "Opening file: %q", fname)
+		}
+		return OpenTable(mf, opts)
+	}
+	fd, err := opts.fs().OpenFile(fname, flag, 0)
+	if err != nil {
+		return nil, y.Wrapf(err, "Opening file: %q", fname)
+	}
+	return openTable(&z.MmapFile{}, fd, opts)
+}
+
+// closeFile closes the file of a table which failed to open.
+func closeFile(mf *z.MmapFile, fd vfs.File) {
+	if fd != nil {
+		_ = fd.Close()
+		return
+	}
+	_ = mf.Close(-1)
+}
+
 // OpenTable assumes file has only one table and opens it. Takes ownership of fd upon function
 // entry. Returns a table with one reference count on it (decrementing which may delete the file!
 // -- consider t.Close() instead). The fd has to writeable because we call Truncate on it before
 // deleting. Checksum for all blocks of table is verified based on value of chkMode.
 func OpenTable(mf *z.MmapFile, opts Options) (*Table, error) {
+	return openTable(mf, nil, opts)
+}
+
+// openTable opens a table read with file I/O from fd if fd is set, and from the memory map mf
+// otherwise.
+func openTable(mf *z.MmapFile, fd vfs.File, opts Options) (*Table, error) {
 	// BlockSize is used to compute the approximate size of the decompressed
 	// block. It should not be zero if the table is compressed.
 	if opts.BlockSize == 0 && opts.Compression != options.None {
 		return nil, errors.New("Block size cannot be zero")
 	}
-	fileInfo, err := mf.Fd.Stat()
+	var fileInfo os.FileInfo
+	var err error
+	if fd != nil {
+		fileInfo, err = fd.Stat()
+	} else {
+		fileInfo, err = mf.Fd.Stat()
+	}
 	if err != nil {
-		mf.Close(-1)
+		closeFile(mf, fd)
 		return nil, y.Wrap(err, "")
 	}
 
 	filename := fileInfo.Name()
 	id, ok := ParseFileID(filename)
 	if !ok {
-		mf.Close(-1)
+		closeFile(mf, fd)
 		return nil, errors.Errorf("Invalid filename: %s", filename)
 	}
 	t := &Table{
 		MmapFile:   mf,
+		file:       fd,
 		ref:        1, // Caller is given one reference.
 		id:         id,
 		opt:        &opts,
@@ -335,7 +467,7 @@ func OpenTable(mf *z.MmapFile, opts Options) (*Table, error) {
 
 	if opts.ChkMode == options.OnTableRead || opts.ChkMode == options.OnTableAndBlockRead {
 		if err := t.VerifyChecksum(); err != nil {
-			mf.Close(-1)
+			closeFile(mf, fd)
 			return nil, y.Wrapf(err, "failed to verify checksum")
 		}
 	}
@@ -439,9 +571,40 @@ func (t *Table) initBiggestAndSmallest() error {
 }
 
 func (t *Table) read(off, sz int) ([]byte, error) {
+	if t.file != nil {
+		buf := make([]byte, sz)
+		if _, err := t.file.ReadAt(buf, int64(off)); err != nil {
+			return nil, y.Wrapf(err, "while reading table: %s", t.file.Name())
+		}
+		return buf, nil
+	}
 	return t.Bytes(off, sz)
 }
 
+// Close closes the file of the table. The file is truncated to maxSz if maxSz >= 0.
+func (t *Table) Close(maxSz int64) error {
+	if t.file == nil {
+		return t.MmapFile.Close(maxSz)
+	}
+	if maxSz >= 0 {
+		if err := t.file.Truncate(maxSz); err != nil {
+			return y.Wrapf(err, "while truncating table: %s", t.file.Name())
+		}
+	}
+	return t.file.Close()
+}
+
+// Delete closes and deletes the file of the table.
+func (t *Table) Delete() error {
+	if t.file == nil {
+		return t.MmapFile.Delete()
+	}
+	if err := t.file.Close(); err != nil {
+		return y.Wrapf(err, "while closing table: %s", t.file.Name())
+	}
+	return t.opt.fs().Remove(t.file.Name())
+}
+
 func (t *Table) readNoFail(off, sz int) []byte {
 	res, err := t.read(off, sz)
 	y.Check(err)
@@ -480,6 +643,7 @@ func (t *Table) initIndex() (*fb.BlockOffset, error) {
 	data := t.readNoFail(readPos, t.indexLen)
 
 	if err := y.VerifyChecksum(data, expectedChk); err != nil {
+		err = &y.CorruptionError{File: t.Filename(), Offset: int64(readPos), Err: err}
 		return nil, y.Wrapf(err, "failed to verify checksum for table: %s", t.Filename())
 	}
 
@@ -493,6 +657,8 @@ func (t *Table) initIndex() (*fb.BlockOffset, error) {
 	}
 	t._cheap = &cheapIndex{
 		MaxVersion:        index.MaxVersion(),
+		MinVersion:        index.MinVersion(),
+		MaxExpiresAt:      index.MaxExpiresAt(),
 		KeyCount:          index.KeyCount(),
 		UncompressedSize:  index.UncompressedSize(),
 		OnDiskSize:        index.OnDiskSize(),
@@ -559,22 +725,18 @@ func (t *Table) offsets(ko *fb.BlockOffset, i int) bool {
 // slice stored in the block will be reused when the ref becomes zero. The
 // caller should release the block by calling block.decrRef() on it.
 func (t *Table) block(idx int, useCache bool) (*block, error) {
+	if b, ok := t.cachedBlock(idx); ok {
+		return b, nil
+	}
+	return t.readBlock(idx, useCache)
+}
+
+// readBlock reads the block idx from the file, and adds it to the block cache if useCache is set.
+func (t *Table) readBlock(idx int, useCache bool) (*block, error) {
 	y.AssertTruef(idx >= 0, "idx=%d", idx)
 	if idx >= t.offsetsLength() {
 		return nil, errors.New("block out of index")
 	}
-	if t.opt.BlockCache != nil {
-		key := t.blockCacheKey(idx)
-		blk, ok := t.opt.BlockCache.Get(key)
-		if ok && blk != nil {
-			// Use the block only if the increment was successful. The block
-			// could get evicted from the cache between the Get() call and the
-			// incrRef() call.
-			if b := blk.(*block); b.incrRef() {
-				return b, nil
-			}
-		}
-	}
 
 	var ko fb.BlockOffset
 	y.AssertTrue(t.offsets(&ko, idx))
@@ -589,7 +751,7 @@ func (t *Table) block(idx int, useCache bool) (*block, error) {
 	if blk.data, err = t.read(blk.offset, int(ko.Len())); err != nil {
 		return nil, y.Wrapf(err,
 			"failed to read from file: %s at offset: %d, len: %d",
-			t.Fd.Name(), blk.offset, ko.Len())
+			t.Filename(), blk.offset, ko.Len())
 	}
 
 	if t.shouldDecrypt() {
@@ -604,7 +766,7 @@ func (t *Table) block(idx int, useCache bool) (*block, error) {
 	if err = t.decompress(blk); err != nil {
 		return nil, y.Wrapf(err,
 			"failed to decode compressed data in file: %s at offset: %d, len: %d",
-			t.Fd.Name(), blk.offset, ko.Len())
+			t.Filename(), blk.offset, ko.Len())
 	}
 
 	// Read meta data related to block.
@@ -636,9 +798,9 @@ func (t *Table) block(idx int, useCache bool) (*block, error) {
 	blk.data = blk.data[:readPos+4]
 
 	// Verify checksum on if checksum verification mode is OnRead on OnStartAndRead.
-	if t.opt.ChkMode == options.OnBlockRead || t.opt.ChkMode == options.OnTableAndBlockRead {
+	if t.verifiesBlocks() {
 		if err = blk.verifyCheckSum(); err != nil {
-			return nil, err
+			return nil, &y.CorruptionError{File: t.Filename(), Offset: int64(blk.offset), Err: err}
 		}
 	}
 
@@ -659,6 +821,29 @@ func (t *Table) block(idx int, useCache bool) (*block, error) {
 	return blk, nil
 }
 
+// cachedBlock returns the block idx if it is in the block cache. The caller should release the
+// block by calling block.decrRef() on it.
+func (t *Table) cachedBlock(idx int) (*block, bool) {
+	if t.opt.BlockCache == nil {
+		return nil, false
+	}
+	blk, ok := t.opt.BlockCache.Get(t.blockCacheKey(idx))
+	if !ok || blk == nil {
+		return nil, false
+	}
+	// Use the block only if the increment was successful. The block could get evicted from the
+	// cache between the Get() call and the incrRef() call.
+	if b := blk.(*block); b.incrRef() {
+		return b, true
+	}
+	return nil, false
+}
+
+// verifiesBlocks tells if the checksum verification mode of the table verifies blocks on read.
+func (t *Table) verifiesBlocks() bool {
+	return t.opt.ChkMode == options.OnBlockRead || t.opt.ChkMode == options.OnTableAndBlockRead
+}
+
 // blockCacheKey is used to store blocks in the block cache.
 func (t *Table) blockCacheKey(idx int) []byte {
 	y.AssertTrue(t.id < math.MaxUint32)
@@ -695,7 +880,12 @@ func (t *Table) Smallest() []byte { return t.smallest }
 func (t *Table) Biggest() []byte { return t.biggest }
 
 // Filename is NOT the file name.  Just kidding, it is.
-func (t *Table) Filename() string { return t.Fd.Name() }
+func (t *Table) Filename() string {
+	if t.file != nil {
+		return t.file.Name()
+	}
+	return t.Fd.Name()
+}
 
 // ID is the table's ID number (used to make the file name).
 func (t *Table) ID() uint64 { return t.id }
@@ -751,8 +941,9 @@ func (t *Table) VerifyChecksum() error {
 		defer b.decrRef()
 		// OnBlockRead or OnTableAndBlockRead, we don't need to call verify checksum
 		// on block, verification would be done while reading block itself.
-		if !(t.opt.ChkMode == options.OnBlockRead || t.opt.ChkMode == options.OnTableAndBlockRead) {
+		if !t.verifiesBlocks() {
 			if err = b.verifyCheckSum(); err != nil {
+				err = &y.CorruptionError{File: t.Filename(), Offset: int64(b.offset), Err: err}
 				return y.Wrapf(err,
 					"checksum validation failed for table: %s, block: %d, offset:%d",
 					t.Filename(), i, b.offset)
@@ -804,12 +995,12 @@ func ParseFileID(name string) (uint64, bool) {
 	}
 	//	suffix := name[len(fileSuffix):]
 	name = strings.TrimSuffix(name, fileSuffix)
-	id, err := strconv.Atoi(name)
+	// ParseUint instead of Atoi, as int can't hold all the ids on 32-bit platforms.
+	id, err := strconv.ParseUint(name, 10, 64)
 	if err != nil {
 		return 0, false
 	}
-	y.AssertTrue(id >= 0)
-	return uint64(id), true
+	return id, true
 }
 
 // IDToFilename does the inverse of ParseFileID
@@ -849,7 +1040,7 @@ func (t *Table) decompress(b *block) error {
 	case options.ZSTD:
 		sz := int(float64(t.opt.BlockSize) * 1.2)
 		dst = z.Calloc(sz, "Table.Decompress")
-		b.data, err = y.ZSTDDecompress(dst, b.data)
+		b.data, err = t.opt.ZSTDDicts.Decompress(dst, b.data)
 		if err != nil {
 			z.Free(dst)
 			return y.Wrap(err, "failed to decompress")
@@ -895,4 +895,84 @@ func TestMaxVersion(t *testing.T) {
 	table, err := CreateTable(filename, b)
 	require.NoError(t, err)
 	require.Equal(t, N, int(table.MaxVersion()))
+	require.Equal(t, 1, int(table.MinVersion()))
+}
+
+func TestMaxExpiresAt(t *testing.T) {
+	build := func(expiresAt func(i int) uint64) *Table {
+		opt := getTestTableOptions()
+		b := NewTableBuilder(opt)
+		defer b.Close()
+		filename := fmt.Sprintf("%s%s%d.sst", os.TempDir(), string(os.PathSeparator), rand.Uint32())
+		for i := 0; i < 100; i++ {
+			key := y.KeyWithTs([]byte(fmt.Sprintf("foo:%03d", i)), 1)
+			b.Add(key, y.ValueStruct{ExpiresAt: expiresAt(i)}, 0)
+		}
+		table, err := CreateTable(filename, b)
+		require.NoError(t, err)
+		return table
+	}
+
+	table := build(func(i int) uint64 { return uint64(1000 + i%10) })
+	require.Equal(t, uint64(1009), table.MaxExpiresAt())
+	require.NoError(t, table.DecrRef())
+
+	// A single key which doesn't expire is enough for the table to never expire.
+	table = build(func(i int) uint64 {
+		if i == 50 {
+			return 0
+		}
+		return 1000
+	})
+	require.Zero(t, table.MaxExpiresAt())
+	require.NoError(t, table.DecrRef())
+}
+
+func TestIteratorVerify(t *testing.T) {
+	opts := Options{BlockSize: 4 * 1024, BloomFalsePositive: 0.01}
+	tbl := buildTestTable(t, "k", 1000, opts)
+	defer func() { require.NoError(t, tbl.DecrRef()) }()
+	// Flip a byte of the first key, which only the checksum can tell.
+	tbl.Data[5] ^= 0xff
+
+	it := tbl.NewIterator(0)
+	it.Rewind()
+	require.NoError(t, it.Error())
+	require.True(t, it.Valid())
+	require.NoError(t, it.Close())
+
+	it = tbl.NewIterator(VERIFY)
+	defer it.Close()
+	it.Rewind()
+	require.False(t, it.Valid())
+	var corrupt *y.CorruptionError
+	require.IsType(t, corrupt, it.Error())
+}
+
+func TestIteratorCacheOnly(t *testing.T) {
+	opts := getTestTableOptions()
+	cache, err := ristretto.NewCache(&cacheConfig)
+	require.NoError(t, err)
+	defer cache.Close()
+	opts.BlockCache = cache
+	tbl := buildTestTable(t, "k", 1000, opts)
+	defer func() { require.NoError(t, tbl.DecrRef()) }()
+
+	it := tbl.NewIterator(CACHEONLY)
+	it.Rewind()
+	require.False(t, it.Valid())
+	require.Equal(t, ErrNotCached, it.Error())
+	require.NoError(t, it.Close())
+
+	it = tbl.NewIterator(0)
+	it.Rewind()
+	require.True(t, it.Valid())
+	require.NoError(t, it.Close())
+	cache.Wait()
+
+	it = tbl.NewIterator(CACHEONLY)
+	defer it.Close()
+	it.Rewind()
+	require.True(t, it.Valid())
+	require.Equal(t, []byte(key("k", 0)), y.ParseKey(it.Key()))
 }
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"io"
+	"os"
+
+	"github.com/dgraph-io/badger/v3/table"
+	"github.com/dgraph-io/badger/v3/y"
+)
+
+// uploadTables copies new tables to Options.TableFS. It must be called before the MANIFEST refers
+// to the tables.
+func (db *DB) uploadTables(tables []*table.Table) error {
+	if db.opt.TableFS == nil || db.opt.InMemory {
+		return nil
+	}
+	throttle := y.NewThrottle(8)
+	for _, t := range tables {
+		if err := throttle.Do(); err != nil {
+			break
+		}
+		go func(id uint64) {
+			throttle.Done(db.uploadTable(id))
+		}(t.ID())
+	}
+	return throttle.Finish()
+}
+
+func (db *DB) uploadTable(id uint64) error {
+	f, err := db.opt.FS.OpenFile(table.NewFilename(id, db.opt.Dir), os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	err = db.opt.TableFS.Put(table.IDToFilename(id), f, info.Size())
+	return y.Wrapf(err, "while uploading table %d", id)
+}
+
+// deleteRemoteTables deletes tables no longer referenced by the MANIFEST from Options.TableFS. The
+// failures are only logged, the tables left behind are deleted the next time the DB is opened.
+func (db *DB) deleteRemoteTables(tables []*table.Table) {
+	if db.opt.TableFS == nil || db.opt.InMemory {
+		return
+	}
+	for _, t := range tables {
+		if err := db.opt.TableFS.Delete(table.IDToFilename(t.ID())); err != nil {
+			db.opt.Warningf("While deleting table %d from TableFS: %v", t.ID(), err)
+		}
+	}
+}
+
+// restoreTables downloads the tables referenced by the MANIFEST but missing from the directory
+// from Options.TableFS, and adds them to idMap. It also deletes the files of TableFS which aren't
+// referenced by the MANIFEST: they were left behind by a crash, or by a failed deletion.
+func (db *DB) restoreTables(mf *Manifest, idMap map[uint64]struct{}) error {
+	if db.opt.TableFS == nil || db.opt.ReadOnly {
+		return nil
+	}
+	names, err := db.opt.TableFS.List()
+	if err != nil {
+		return y.Wrapf(err, "while listing the tables of TableFS")
+	}
+
+	var missing []uint64
+	for _, name := range names {
+		id, ok := table.ParseFileID(name)
+		if !ok {
+			continue
+		}
+		if _, ok := mf.Tables[id]; !ok {
+			db.opt.Infof("Deleting table %d from TableFS, as it is not referenced in MANIFEST", id)
+			if err := db.opt.TableFS.Delete(name); err != nil {
+				return y.Wrapf(err, "while deleting table %d from TableFS", id)
+			}
+			continue
+		}
+		if _, ok := idMap[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	db.opt.Infof("Downloading %d tables from TableFS", len(missing))
+	throttle := y.NewThrottle(8)
+	for _, id := range missing {
+		if err := throttle.Do(); err != nil {
+			break
+		}
+		go func(id uint64) {
+			throttle.Done(db.downloadTable(id))
+		}(id)
+	}
+	if err := throttle.Finish(); err != nil {
+		return err
+	}
+	if err := db.syncDir(db.opt.Dir); err != nil {
+		return y.Wrapf(err, "while syncing the directory of the downloaded tables")
+	}
+	for _, id := range missing {
+		idMap[id] = struct{}{}
+	}
+	return nil
+}
+
+// downloadTable writes the table to a temporary file first, like table.CreateTable, so that a
+// crash can't leave a partial table behind.
+func (db *DB) downloadTable(id uint64) error {
+	rc, err := db.opt.TableFS.Get(table.IDToFilename(id))
+	if err != nil {
+		return y.Wrapf(err, "while downloading table %d", id)
+	}
+	defer rc.Close()
+
+	fname := table.NewFilename(id, db.opt.Dir)
+	f, err := db.opt.FS.OpenFile(fname+table.TempSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, rc)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = db.opt.FS.Rename(fname+table.TempSuffix, fname)
+	}
+	if err != nil {
+		_ = db.opt.FS.Remove(fname + table.TempSuffix)
+		return y.Wrapf(err, "while downloading table %d", id)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3/objstore"
+	"github.com/dgraph-io/badger/v3/table"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+	remoteDir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(remoteDir)
+	remote := objstore.Local(remoteDir)
+
+	// checkRemote checks that TableFS holds exactly the tables of the DB.
+	checkRemote := func(db *DB) {
+		var want []string
+		for _, ti := range db.Tables() {
+			want = append(want, table.IDToFilename(ti.ID))
+		}
+		sort.Strings(want)
+		got, err := remote.List()
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+	write := func(db *DB, n int) {
+		for i := 0; i < 100; i++ {
+			txnSet(t, db, []byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("val%d", n)), 0)
+		}
+	}
+	check := func(db *DB, n int) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for i := 0; i < 100; i++ {
+				item, err := txn.Get([]byte(fmt.Sprintf("key%03d", i)))
+				require.NoError(t, err)
+				val, err := item.ValueCopy(nil)
+				require.NoError(t, err)
+				require.Equal(t, fmt.Sprintf("val%d", n), string(val))
+			}
+			return nil
+		}))
+	}
+
+	opt := getTestOptions(dir).WithTableFS(remote)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	write(db, 1)
+	require.NoError(t, db.Close())
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	checkRemote(db)
+	require.Len(t, db.Tables(), 1)
+	write(db, 2)
+	require.NoError(t, db.Close())
+
+	db, err = Open(opt)
+	require.NoError(t, err)
+	require.Len(t, db.Tables(), 2)
+	checkRemote(db)
+	// The compacted tables are deleted from TableFS.
+	require.NoError(t, db.CompactRange(nil, nil))
+	checkRemote(db)
+	require.NoError(t, db.Close())
+
+	// The lost tables are downloaded, and the unknown ones deleted.
+	tables, err := filepath.Glob(filepath.Join(dir, "*.sst"))
+	require.NoError(t, err)
+	require.NotEmpty(t, tables)
+	for _, name := range tables {
+		require.NoError(t, os.Remove(name))
+	}
+	require.NoError(t, remote.Put(table.IDToFilename(9999), strings.NewReader("junk"), 4))
+	db, err = Open(opt)
+	require.NoError(t, err)
+	defer db.Close()
+	checkRemote(db)
+	check(db, 2)
+}
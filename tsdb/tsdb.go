@@ -0,0 +1,264 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tsdb stores time series in a Badger DB. Each point of a series is stored under its own
+// key, made of the name of the series followed by the timestamp of the point, so the points of a
+// series are sorted by time and a time range can be scanned with a single iterator.
+//
+// Old points can be removed via DropBefore and Retain, which drop the corresponding key ranges.
+// Old points can also be downsampled during compactions by opening the DB with a compaction filter
+// returned by Downsampler.
+package tsdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidName is returned when the name of a series is empty or contains a zero byte.
+var ErrInvalidName = errors.New("Series name must be non-empty and must not contain a zero byte")
+
+// keyPrefix is the prefix of all the keys written by this package.
+var keyPrefix = []byte("!ts!")
+
+// Point is a single value of a series.
+type Point struct {
+	Time  time.Time
+	Value []byte
+}
+
+// DB stores time series in a Badger DB.
+type DB struct {
+	db *badger.DB
+}
+
+// New returns a DB which stores time series in db.
+func New(db *badger.DB) *DB {
+	return &DB{db: db}
+}
+
+func checkName(series string) error {
+	if len(series) == 0 || bytes.IndexByte([]byte(series), 0) >= 0 {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+// seriesKey returns the prefix of all the keys of the series. The name is terminated by a zero
+// byte, so that no series is a prefix of another one.
+func seriesKey(series string) []byte {
+	key := append(append([]byte{}, keyPrefix...), series...)
+	return append(key, 0)
+}
+
+// encodeTime flips the sign bit of the timestamp, so that the big endian encoding sorts the
+// timestamps before 1970 first.
+func encodeTime(t time.Time) uint64 {
+	return uint64(t.UnixNano()) ^ (1 << 63)
+}
+
+func decodeTime(ts uint64) time.Time {
+	return time.Unix(0, int64(ts^(1<<63)))
+}
+
+func pointKey(series string, t time.Time) []byte {
+	key := seriesKey(series)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], encodeTime(t))
+	return append(key, buf[:]...)
+}
+
+// parseKey splits a key written by this package into the series name and the timestamp.
+func parseKey(key []byte) (series []byte, ts uint64, ok bool) {
+	if !bytes.HasPrefix(key, keyPrefix) || len(key) < len(keyPrefix)+10 {
+		return nil, 0, false
+	}
+	rest := key[len(keyPrefix):]
+	if rest[len(rest)-9] != 0 {
+		return nil, 0, false
+	}
+	return rest[:len(rest)-9], binary.BigEndian.Uint64(rest[len(rest)-8:]), true
+}
+
+// Write writes the points to the series in a single transaction. A point overwrites any other
+// point of the series with the same timestamp.
+func (tdb *DB) Write(series string, points ...Point) error {
+	if err := checkName(series); err != nil {
+		return err
+	}
+	err := tdb.db.Update(func(txn *badger.Txn) error {
+		for _, p := range points {
+			if err := txn.Set(pointKey(series, p.Time), p.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return errors.Wrapf(err, "while writing to series %q", series)
+}
+
+// Scan calls fn for every point of the series in the time range [from, to), in time order. The
+// value of the point is only valid within fn.
+func (tdb *DB) Scan(series string, from, to time.Time, fn func(p Point) error) error {
+	if err := checkName(series); err != nil {
+		return err
+	}
+	end := pointKey(series, to)
+	return tdb.db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.Prefix = seriesKey(series)
+		itr := txn.NewIterator(opt)
+		defer itr.Close()
+
+		for itr.Seek(pointKey(series, from)); itr.Valid(); itr.Next() {
+			item := itr.Item()
+			if bytes.Compare(item.Key(), end) >= 0 {
+				break
+			}
+			_, ts, _ := parseKey(item.Key())
+			err := item.Value(func(val []byte) error {
+				return fn(Point{Time: decodeTime(ts), Value: val})
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Series returns the names of all the series in sorted order.
+func (tdb *DB) Series() ([]string, error) {
+	var names []string
+	err := tdb.db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+		opt.Prefix = keyPrefix
+		itr := txn.NewIterator(opt)
+		defer itr.Close()
+
+		for itr.Rewind(); itr.Valid(); {
+			series, _, ok := parseKey(itr.Item().Key())
+			if !ok {
+				itr.Next()
+				continue
+			}
+			names = append(names, string(series))
+			// Skip over all the other points of this series.
+			next := seriesKey(string(series))
+			next[len(next)-1] = 1
+			itr.Seek(next)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// DropBefore drops all the points of the series older than t.
+func (tdb *DB) DropBefore(series string, t time.Time) error {
+	if err := checkName(series); err != nil {
+		return err
+	}
+	if err := tdb.db.DropRange(seriesKey(series), pointKey(series, t)); err != nil {
+		return errors.Wrapf(err, "while dropping points of series %q", series)
+	}
+	return nil
+}
+
+// Retain drops the points of all the series which are older than the given age.
+func (tdb *DB) Retain(age time.Duration) error {
+	names, err := tdb.Series()
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-age)
+	for _, series := range names {
+		if err := tdb.DropBefore(series, cutoff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Downsample is a downsampling rule. Points older than After are downsampled to at most one point
+// per Interval.
+type Downsample struct {
+	After    time.Duration
+	Interval time.Duration
+}
+
+// Downsampler returns a compaction filter which downsamples the points of all the series as per
+// the given rules. It is meant to be passed to badger.Options.WithCompactionFilter.
+//
+// The filter keeps the oldest point of every interval that a compaction goes over and drops the
+// rest. A point is downsampled by the rule with the largest After that the point is older than.
+// Since compactions only go over a part of the DB at a time, an interval may keep more than one
+// point, but never ends up without any. Compactions run in the background, so there is no
+// guarantee about when a point gets downsampled.
+func Downsampler(rules ...Downsample) func() badger.CompactionFilter {
+	rules = append([]Downsample{}, rules...)
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].After > rules[j].After
+	})
+	return func() badger.CompactionFilter {
+		return &downsampler{rules: rules, now: time.Now()}
+	}
+}
+
+type downsampler struct {
+	rules []Downsample
+	now   time.Time
+
+	// The series, interval and bucket of the last point kept.
+	lastSeries   []byte
+	lastInterval time.Duration
+	lastBucket   int64
+}
+
+func (d *downsampler) Drop(key []byte, userMeta byte) bool {
+	series, ts, ok := parseKey(key)
+	if !ok {
+		return false
+	}
+	t := decodeTime(ts)
+	var rule *Downsample
+	for i := range d.rules {
+		if d.now.Sub(t) > d.rules[i].After {
+			rule = &d.rules[i]
+			break
+		}
+	}
+	if rule == nil || rule.Interval <= 0 {
+		return false
+	}
+	bucket := t.UnixNano() / int64(rule.Interval)
+	if t.UnixNano()%int64(rule.Interval) < 0 {
+		bucket--
+	}
+	if bytes.Equal(series, d.lastSeries) && rule.Interval == d.lastInterval &&
+		bucket == d.lastBucket {
+		return true
+	}
+	d.lastSeries = append(d.lastSeries[:0], series...)
+	d.lastInterval = rule.Interval
+	d.lastBucket = bucket
+	return false
+}
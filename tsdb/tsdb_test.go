@@ -0,0 +1,123 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tsdb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func openDB(t *testing.T, opt badger.Options) *badger.DB {
+	db, err := badger.Open(opt.WithLogger(nil))
+	require.NoError(t, err)
+	return db
+}
+
+func scanTimes(t *testing.T, tdb *DB, series string, from, to time.Time) []time.Time {
+	var times []time.Time
+	require.NoError(t, tdb.Scan(series, from, to, func(p Point) error {
+		times = append(times, p.Time)
+		return nil
+	}))
+	return times
+}
+
+func TestTSDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db := openDB(t, badger.DefaultOptions(dir))
+	defer db.Close()
+	tdb := New(db)
+
+	require.Equal(t, ErrInvalidName, tdb.Write("", Point{}))
+
+	base := time.Unix(1000, 0)
+	var points []Point
+	for i := 0; i < 10; i++ {
+		points = append(points, Point{Time: base.Add(time.Duration(i) * time.Second)})
+	}
+	require.NoError(t, tdb.Write("cpu", points...))
+	require.NoError(t, tdb.Write("cpu2", Point{Time: base}))
+	// Points before 1970 sort first.
+	require.NoError(t, tdb.Write("cpu", Point{Time: time.Unix(-5, 0), Value: []byte("old")}))
+
+	times := scanTimes(t, tdb, "cpu", base.Add(2*time.Second), base.Add(5*time.Second))
+	require.Equal(t, []time.Time{base.Add(2 * time.Second), base.Add(3 * time.Second),
+		base.Add(4 * time.Second)}, times)
+	times = scanTimes(t, tdb, "cpu", time.Unix(-10, 0), base)
+	require.Equal(t, []time.Time{time.Unix(-5, 0)}, times)
+
+	names, err := tdb.Series()
+	require.NoError(t, err)
+	require.Equal(t, []string{"cpu", "cpu2"}, names)
+
+	require.NoError(t, tdb.DropBefore("cpu", base.Add(8*time.Second)))
+	times = scanTimes(t, tdb, "cpu", time.Unix(-10, 0), base.Add(time.Hour))
+	require.Equal(t, []time.Time{base.Add(8 * time.Second), base.Add(9 * time.Second)}, times)
+	require.Len(t, scanTimes(t, tdb, "cpu2", base, base.Add(time.Second)), 1)
+
+	require.NoError(t, tdb.Retain(time.Hour))
+	names, err = tdb.Series()
+	require.NoError(t, err)
+	require.Empty(t, names)
+}
+
+func TestDownsampler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// With a single L0 table allowed, Flatten compacts the L0 tables written below.
+	opt := badger.DefaultOptions(dir).WithNumLevelZeroTables(1).
+		WithCompactionFilter(Downsampler(
+			Downsample{After: time.Hour, Interval: time.Minute},
+			Downsample{After: 24 * time.Hour, Interval: time.Hour},
+		))
+
+	// One point every 10 seconds for 10 minutes, two days ago, two hours ago and now. Each batch
+	// is flushed to its own L0 table by closing the DB.
+	now := time.Now().Truncate(time.Hour)
+	starts := []time.Time{now.Add(-48 * time.Hour), now.Add(-2 * time.Hour), now}
+	for _, start := range starts {
+		db := openDB(t, opt)
+		var points []Point
+		for i := 0; i < 60; i++ {
+			points = append(points, Point{Time: start.Add(time.Duration(i) * 10 * time.Second)})
+		}
+		require.NoError(t, New(db).Write("cpu", points...))
+		require.NoError(t, db.Close())
+	}
+
+	db := openDB(t, opt)
+	defer db.Close()
+	require.NoError(t, db.Flatten(1))
+	tdb := New(db)
+
+	count := func(start time.Time) int {
+		return len(scanTimes(t, tdb, "cpu", start, start.Add(10*time.Minute)))
+	}
+	require.Equal(t, 1, count(starts[0]))
+	require.Equal(t, 10, count(starts[1]))
+	require.Equal(t, 60, count(starts[2]))
+}
@@ -0,0 +1,348 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3/pb"
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
+)
+
+// preparedKey is the prefix of the keys holding the prepared txns. See Txn.Prepare.
+var preparedKey = []byte("!badger!2pc!")
+
+// preparedTxn is a txn which got prepared but isn't committed or rolled back yet. Until then, it
+// holds its reads and writes as locks: the other txns can't commit writes to them.
+type preparedTxn struct {
+	id           string
+	reads        map[uint64]struct{} // Fingerprints of the keys read.
+	conflictKeys map[uint64]struct{} // Fingerprints of the keys written.
+}
+
+// conflictsWith tells if txn writes to the keys locked by p.
+func (p *preparedTxn) conflictsWith(txn *Txn) bool {
+	for fp := range txn.conflictKeys {
+		if _, has := p.reads[fp]; has {
+			return true
+		}
+		if _, has := p.conflictKeys[fp]; has {
+			return true
+		}
+	}
+	return false
+}
+
+// conflictsWithPrepared tells if txn conflicts with the prepared txns other than itself. Must be
+// called under o.Lock.
+func (o *oracle) conflictsWithPrepared(txn *Txn) bool {
+	for _, p := range o.prepared {
+		if p != txn.prepared && p.conflictsWith(txn) {
+			return true
+		}
+	}
+	return false
+}
+
+// updatePrepared registers the prepared txn of txn when it gets prepared, and releases it when it
+// gets committed or rolled back. It returns false if the prepared txn can't be registered, or was
+// already released. Must be called under o.Lock.
+func (o *oracle) updatePrepared(txn *Txn) bool {
+	p := txn.prepared
+	switch {
+	case p == nil:
+		return true
+	case txn.preparing:
+		if _, has := o.prepared[p.id]; has {
+			return false
+		}
+		o.prepared[p.id] = p
+	case o.prepared[p.id] != p:
+		return false
+	default:
+		delete(o.prepared, p.id)
+	}
+	return true
+}
+
+// Prepare is the first phase of a two-phase commit. It checks the transaction for conflicts, like
+// Commit does, and persists its writes under id without applying them, so that badger can take
+// part in a two-phase commit across several stores, or a store and a message queue. Once Prepare
+// succeeds, the transaction is bound to commit: the keys it read and wrote stay locked, so that
+// the other transactions writing to them fail with ErrConflict, until the transaction gets
+// committed with Commit or rolled back with Rollback. No writes can be added to it meanwhile.
+//
+// The prepared state is synced to disk and survives crashes and restarts. Discarding a prepared
+// transaction doesn't roll it back: use DB.PreparedTxns to find the transactions left prepared,
+// and DB.ResumePrepared to commit or roll them back once the coordinator has decided.
+//
+// Prepare requires Options.DetectConflicts, and isn't supported in managed mode.
+func (txn *Txn) Prepare(id []byte) error {
+	db := txn.db
+	switch {
+	case db.opt.managedTxns:
+		return ErrManagedTxn
+	case !db.opt.DetectConflicts:
+		return ErrConflictDetectionDisabled
+	case !txn.update:
+		return ErrReadOnlyTxn
+	case txn.discarded:
+		return ErrDiscardedTxn
+	case txn.prepared != nil:
+		return ErrTxnPrepared
+	case len(id) == 0:
+		return errors.New("Prepared txn id can't be empty")
+	case txn.opID != nil:
+		return errors.New("Prepared txns can't have an operation id")
+	}
+	db.orc.Lock()
+	_, has := db.orc.prepared[string(id)]
+	db.orc.Unlock()
+	if has {
+		return ErrPreparedTxnExists
+	}
+
+	txn.readsLock.Lock()
+	reads := append([]uint64{}, txn.reads...)
+	txn.readsLock.Unlock()
+	p := &preparedTxn{
+		id:           string(id),
+		reads:        make(map[uint64]struct{}, len(reads)),
+		conflictKeys: txn.conflictKeys,
+	}
+	for _, fp := range reads {
+		p.reads[fp] = struct{}{}
+	}
+	val, err := encodePrepared(reads, txn.pendingWrites)
+	if err != nil {
+		return err
+	}
+	if int64(len(val)) > db.opt.ValueLogFileSize {
+		return ErrTxnTooBig
+	}
+
+	// Commit the prepared state in place of the writes, synced whatever the options say.
+	key := append(append([]byte{}, preparedKey...), id...)
+	writes, sync := txn.pendingWrites, txn.sync
+	txn.pendingWrites = map[string]*Entry{string(key): {Key: key, Value: val}}
+	txn.sync = syncAlways
+	txn.prepared, txn.preparing = p, true
+	defer func() {
+		txn.pendingWrites, txn.sync, txn.preparing = writes, sync, false
+		txn.commitTs = 0
+	}()
+
+	cb, err := txn.commitAndSend()
+	if err == nil {
+		err = cb()
+		if err != nil {
+			db.orc.Lock()
+			if db.orc.prepared[p.id] == p {
+				delete(db.orc.prepared, p.id)
+			}
+			db.orc.Unlock()
+		}
+	}
+	if err != nil {
+		txn.prepared = nil
+		return err
+	}
+	return nil
+}
+
+// Rollback is the second phase of a two-phase commit which aborts a transaction prepared with
+// Prepare. It drops the writes of the transaction and releases its locks.
+func (txn *Txn) Rollback() error {
+	if txn.prepared == nil {
+		return ErrTxnNotPrepared
+	}
+	txn.pendingWrites = make(map[string]*Entry)
+	txn.reads = nil
+	txn.conflictKeys = make(map[uint64]struct{})
+	return txn.Commit()
+}
+
+// finishPrepared adds the deletion of the prepared state to the writes of a prepared txn, so that
+// it gets committed along with them.
+func (txn *Txn) finishPrepared() {
+	key := append(append([]byte{}, preparedKey...), txn.prepared.id...)
+	txn.pendingWrites[string(key)] = &Entry{Key: key, meta: bitDelete}
+}
+
+// restorePrepared registers the prepared txn of txn again if its commit failed to be written, so
+// that it keeps its locks and can be resumed.
+func (txn *Txn) restorePrepared(err error) {
+	if err == nil || errors.Cause(err) == ErrConflict {
+		return
+	}
+	orc := txn.db.orc
+	orc.Lock()
+	if _, has := orc.prepared[txn.prepared.id]; !has {
+		orc.prepared[txn.prepared.id] = txn.prepared
+	}
+	orc.Unlock()
+}
+
+// PreparedTxns returns the ids of the transactions prepared with Txn.Prepare which aren't
+// committed or rolled back yet, sorted. They include the ones prepared before the DB was reopened.
+func (db *DB) PreparedTxns() [][]byte {
+	db.orc.Lock()
+	ids := make([][]byte, 0, len(db.orc.prepared))
+	for id := range db.orc.prepared {
+		ids = append(ids, []byte(id))
+	}
+	db.orc.Unlock()
+	sort.Slice(ids, func(i, j int) bool {
+		return bytes.Compare(ids[i], ids[j]) < 0
+	})
+	return ids
+}
+
+// ResumePrepared returns the transaction prepared under id, with its writes, so that it can be
+// committed with Commit or rolled back with Rollback, e.g. after a restart. It returns
+// ErrPreparedTxnNotFound if no transaction is prepared under id. The returned transaction must be
+// discarded like any other.
+func (db *DB) ResumePrepared(id []byte) (*Txn, error) {
+	db.orc.Lock()
+	p, has := db.orc.prepared[string(id)]
+	db.orc.Unlock()
+	if !has {
+		return nil, ErrPreparedTxnNotFound
+	}
+	var val []byte
+	err := db.View(func(txn *Txn) error {
+		item, err := txn.Get(append(append([]byte{}, preparedKey...), id...))
+		if err != nil {
+			return err
+		}
+		val, err = item.ValueCopy(nil)
+		return err
+	})
+	if err == ErrKeyNotFound {
+		return nil, ErrPreparedTxnNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	reads, kvs, err := decodePrepared(val)
+	if err != nil {
+		return nil, y.Wrapf(err, "while decoding prepared txn %q", id)
+	}
+
+	txn := db.NewTransaction(true)
+	for _, kv := range kvs {
+		e := &Entry{
+			Key:       kv.Key,
+			Value:     kv.Value,
+			ExpiresAt: kv.ExpiresAt,
+		}
+		if len(kv.UserMeta) > 0 {
+			e.UserMeta = kv.UserMeta[0]
+		}
+		if len(kv.Meta) > 0 {
+			e.meta = kv.Meta[0]
+		}
+		txn.pendingWrites[string(e.Key)] = e
+	}
+	txn.reads = reads
+	txn.conflictKeys = p.conflictKeys
+	txn.prepared = p
+	return txn, nil
+}
+
+// initPreparedTxns registers the txns left prepared in the DB, so that they hold their locks again.
+func (db *DB) initPreparedTxns() error {
+	return db.View(func(txn *Txn) error {
+		iopts := DefaultIteratorOptions
+		iopts.Prefix = preparedKey
+		iopts.InternalAccess = true
+		itr := txn.NewIterator(iopts)
+		defer itr.Close()
+		for itr.Rewind(); itr.Valid(); itr.Next() {
+			item := itr.Item()
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			reads, kvs, err := decodePrepared(val)
+			if err != nil {
+				return y.Wrapf(err, "while decoding prepared txn %q", item.Key())
+			}
+			p := &preparedTxn{
+				id:           string(item.Key()[len(preparedKey):]),
+				reads:        make(map[uint64]struct{}, len(reads)),
+				conflictKeys: make(map[uint64]struct{}, len(kvs)),
+			}
+			for _, fp := range reads {
+				p.reads[fp] = struct{}{}
+			}
+			for _, kv := range kvs {
+				p.conflictKeys[z.MemHash(kv.Key)] = struct{}{}
+			}
+			db.orc.prepared[p.id] = p
+		}
+		return nil
+	})
+}
+
+// Format of the prepared state of a txn:
+// +-----------------------+----------------------+-----+-------------------+
+// | Number of reads (var) | Read fingerprint (8) | ... | Writes (pb.KVList) |
+// +-----------------------+----------------------+-----+-------------------+
+func encodePrepared(reads []uint64, writes map[string]*Entry) ([]byte, error) {
+	list := &pb.KVList{Kv: make([]*pb.KV, 0, len(writes))}
+	for _, e := range writes {
+		list.Kv = append(list.Kv, &pb.KV{
+			Key:       e.Key,
+			Value:     e.Value,
+			UserMeta:  []byte{e.UserMeta},
+			ExpiresAt: e.ExpiresAt,
+			Meta:      []byte{e.meta & (bitDelete | BitDiscardEarlierVersions | bitMergeEntry)},
+		})
+	}
+	kvs, err := list.Marshal()
+	if err != nil {
+		return nil, y.Wrapf(err, "while encoding prepared txn")
+	}
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+8*len(reads)+len(kvs))
+	buf = buf[:binary.PutUvarint(buf, uint64(len(reads)))]
+	for _, fp := range reads {
+		buf = append(buf, y.U64ToBytes(fp)...)
+	}
+	return append(buf, kvs...), nil
+}
+
+func decodePrepared(buf []byte) ([]uint64, []*pb.KV, error) {
+	n, sz := binary.Uvarint(buf)
+	if sz <= 0 || uint64(len(buf)-sz)/8 < n {
+		return nil, nil, errors.New("truncated reads")
+	}
+	buf = buf[sz:]
+	reads := make([]uint64, n)
+	for i := range reads {
+		reads[i] = y.BytesToU64(buf[8*i:])
+	}
+	var list pb.KVList
+	if err := list.Unmarshal(buf[8*n:]); err != nil {
+		return nil, nil, err
+	}
+	return reads, list.Kv, nil
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnPrepareCommit(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		txnSet(t, db, []byte("read"), []byte("r"), 0)
+
+		txn := db.NewTransaction(true)
+		defer txn.Discard()
+		_, err := txn.Get([]byte("read"))
+		require.NoError(t, err)
+		require.NoError(t, txn.Set([]byte("a"), []byte("1")))
+		require.NoError(t, txn.Delete([]byte("b")))
+		require.NoError(t, txn.Prepare([]byte("t1")))
+		require.Equal(t, ErrTxnPrepared, txn.Prepare([]byte("t1")))
+		require.Equal(t, ErrTxnPrepared, txn.Set([]byte("c"), []byte("3")))
+		require.Equal(t, [][]byte{[]byte("t1")}, db.PreparedTxns())
+
+		other := db.NewTransaction(true)
+		require.Equal(t, ErrPreparedTxnExists, other.Prepare([]byte("t1")))
+		other.Discard()
+
+		// The writes aren't visible until the commit.
+		require.NoError(t, db.View(func(txn *Txn) error {
+			_, err := txn.Get([]byte("a"))
+			require.Equal(t, ErrKeyNotFound, err)
+			return nil
+		}))
+
+		// The keys read and written are locked.
+		for _, key := range []string{"read", "a", "b"} {
+			other := db.NewTransaction(true)
+			require.NoError(t, other.Set([]byte(key), []byte("x")))
+			require.Equal(t, ErrConflict, other.Commit())
+		}
+		txnSet(t, db, []byte("c"), []byte("x"), 0)
+
+		require.NoError(t, txn.Commit())
+		require.Empty(t, db.PreparedTxns())
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get([]byte("a"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("1"), getItemValue(t, item))
+			return nil
+		}))
+		txnSet(t, db, []byte("read"), []byte("x"), 0)
+	})
+}
+
+func TestTxnPrepareConflict(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		txn := db.NewTransaction(true)
+		defer txn.Discard()
+		_, err := txn.Get([]byte("k"))
+		require.Equal(t, ErrKeyNotFound, err)
+		require.NoError(t, txn.Set([]byte("a"), []byte("1")))
+
+		txnSet(t, db, []byte("k"), []byte("v"), 0)
+		require.Equal(t, ErrConflict, txn.Prepare([]byte("t1")))
+		require.Empty(t, db.PreparedTxns())
+		txnSet(t, db, []byte("a"), []byte("v"), 0)
+	})
+}
+
+func TestTxnPrepareRollback(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		txn := db.NewTransaction(true)
+		defer txn.Discard()
+		require.Equal(t, ErrTxnNotPrepared, txn.Rollback())
+		require.NoError(t, txn.Set([]byte("a"), []byte("1")))
+		require.NoError(t, txn.Prepare([]byte("t1")))
+		require.NoError(t, txn.Rollback())
+		require.Empty(t, db.PreparedTxns())
+
+		require.NoError(t, db.View(func(txn *Txn) error {
+			_, err := txn.Get([]byte("a"))
+			require.Equal(t, ErrKeyNotFound, err)
+			return nil
+		}))
+		txnSet(t, db, []byte("a"), []byte("2"), 0)
+	})
+}
+
+func TestTxnPrepareRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+
+	db, err := Open(getTestOptions(dir))
+	require.NoError(t, err)
+	for _, id := range []string{"t1", "t2"} {
+		txn := db.NewTransaction(true)
+		require.NoError(t, txn.Set([]byte("key-"+id), []byte(id)))
+		require.NoError(t, txn.SetEntry(NewEntry([]byte("meta-"+id), nil).WithMeta(7)))
+		require.NoError(t, txn.Prepare([]byte(id)))
+		txn.Discard()
+	}
+	require.NoError(t, db.Close())
+
+	db, err = Open(getTestOptions(dir))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	require.Equal(t, [][]byte{[]byte("t1"), []byte("t2")}, db.PreparedTxns())
+	_, err = db.ResumePrepared([]byte("t3"))
+	require.Equal(t, ErrPreparedTxnNotFound, err)
+
+	// The locks are held again after the restart.
+	other := db.NewTransaction(true)
+	require.NoError(t, other.Set([]byte("key-t1"), []byte("x")))
+	require.Equal(t, ErrConflict, other.Commit())
+
+	txn, err := db.ResumePrepared([]byte("t1"))
+	require.NoError(t, err)
+	require.NoError(t, txn.Commit())
+	txn, err = db.ResumePrepared([]byte("t2"))
+	require.NoError(t, err)
+	require.NoError(t, txn.Rollback())
+	require.Empty(t, db.PreparedTxns())
+
+	require.NoError(t, db.View(func(txn *Txn) error {
+		item, err := txn.Get([]byte("key-t1"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("t1"), getItemValue(t, item))
+		item, err = txn.Get([]byte("meta-t1"))
+		require.NoError(t, err)
+		require.Equal(t, byte(7), item.UserMeta())
+		_, err = txn.Get([]byte("key-t2"))
+		require.Equal(t, ErrKeyNotFound, err)
+		return nil
+	}))
+}
@@ -25,7 +25,9 @@ import (
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/dgraph-io/badger/v3/table"
 	"github.com/dgraph-io/badger/v3/y"
 	"github.com/dgraph-io/ristretto/z"
 	"github.com/pkg/errors"
@@ -56,6 +58,10 @@ type oracle struct {
 
 	// closer is used to stop watermarks.
 	closer *z.Closer
+
+	snapshots *snapshots // Persisted snapshots, holding the discard ts. See DB.CreateSnapshot.
+
+	prepared map[string]*preparedTxn // Prepared txns by id, holding their locks. See Txn.Prepare.
 }
 
 type committedTxn struct {
@@ -75,6 +81,7 @@ func newOracle(opt Options) *oracle {
 		readMark: &y.WaterMark{Name: "badger.PendingReads"},
 		txnMark:  &y.WaterMark{Name: "badger.TxnTimestamp"},
 		closer:   z.NewCloser(2),
+		prepared: make(map[string]*preparedTxn),
 	}
 	orc.readMark.Init(orc.closer)
 	orc.txnMark.Init(orc.closer)
@@ -126,16 +133,22 @@ func (o *oracle) setDiscardTs(ts uint64) {
 }
 
 func (o *oracle) discardAtOrBelow() uint64 {
+	var discardTs uint64
 	if o.isManaged {
 		o.Lock()
-		defer o.Unlock()
-		return o.discardTs
+		discardTs = o.discardTs
+		o.Unlock()
+	} else {
+		discardTs = o.readMark.DoneUntil()
 	}
-	return o.readMark.DoneUntil()
+	return o.snapshots.discardAtOrBelow(discardTs)
 }
 
 // hasConflict must be called while having a lock.
 func (o *oracle) hasConflict(txn *Txn) bool {
+	if o.conflictsWithPrepared(txn) {
+		return true
+	}
 	if len(txn.reads) == 0 {
 		return false
 	}
@@ -164,7 +177,7 @@ func (o *oracle) newCommitTs(txn *Txn) uint64 {
 	o.Lock()
 	defer o.Unlock()
 
-	if o.hasConflict(txn) {
+	if o.hasConflict(txn) || !o.updatePrepared(txn) {
 		return 0
 	}
 
@@ -185,7 +198,8 @@ func (o *oracle) newCommitTs(txn *Txn) uint64 {
 
 	y.AssertTrue(ts >= o.lastCleanupTs)
 
-	if o.detectConflicts {
+	// A txn getting prepared doesn't write its keys yet, see Txn.Prepare.
+	if o.detectConflicts && !txn.preparing {
 		// We should ensure that txns are not added to o.committedTxns slice when
 		// conflict detection is disabled otherwise this slice would keep growing.
 		o.committedTxns = append(o.committedTxns, committedTxn{
@@ -264,7 +278,14 @@ type Txn struct {
 	numIterators int32
 	discarded    bool
 	doneRead     bool
-	update       bool // update is used to conditionally keep track of reads.
+	update       bool     // update is used to conditionally keep track of reads.
+	sync         syncMode // Overrides Options.SyncWrites for the commit. See SetSyncWrites.
+	readOpt      ReadOptions
+	large        bool         // Lifts the size limit, see SetLarge.
+	prepared     *preparedTxn // Set once the txn is prepared, see Prepare.
+	preparing    bool         // Set while the prepared state is committed.
+	opID         []byte       // See SetOperationID.
+	opEvicted    [][]byte     // The operation ids deleted along with the writes, see applyOperation.
 }
 
 type pendingWritesIterator struct {
@@ -346,7 +367,7 @@ func (txn *Txn) checkSize(e *Entry) error {
 	count := txn.count + 1
 	// Extra bytes for the version in key.
 	size := txn.size + e.estimateSizeAndSetThreshold(txn.db.valueThreshold()) + 10
-	if count >= txn.db.opt.maxBatchCount || size >= txn.db.opt.maxBatchSize {
+	if !txn.large && txn.db.tooBig(count, size) {
 		return ErrTxnTooBig
 	}
 	txn.count, txn.size = count, size
@@ -387,6 +408,8 @@ func (txn *Txn) modify(e *Entry) error {
 		return ErrReadOnlyTxn
 	case txn.discarded:
 		return ErrDiscardedTxn
+	case txn.prepared != nil:
+		return ErrTxnPrepared
 	case len(e.Key) == 0:
 		return ErrEmptyKey
 	case bytes.HasPrefix(e.Key, badgerPrefix):
@@ -405,9 +428,15 @@ func (txn *Txn) modify(e *Entry) error {
 	if err := txn.db.isBanned(e.Key); err != nil {
 		return err
 	}
+	if txn.db.opt.AppendOnly {
+		if err := txn.checkAppendOnly(e); err != nil {
+			return err
+		}
+	}
 	if err := txn.checkSize(e); err != nil {
 		return err
 	}
+	txn.db.evictTracker.touch(e.Key)
 
 	// The txn.conflictKeys is used for conflict detection. If conflict detection
 	// is disabled, we don't need to store key hashes in this map.
@@ -425,6 +454,31 @@ func (txn *Txn) modify(e *Entry) error {
 	return nil
 }
 
+// checkAppendOnly returns ErrAppendOnly if the entry would delete, expire or overwrite a key. The
+// key is added to the read set, so that two transactions writing the same new key conflict.
+func (txn *Txn) checkAppendOnly(e *Entry) error {
+	if e.meta&bitDelete > 0 || e.ExpiresAt > 0 {
+		return ErrAppendOnly
+	}
+	if _, ok := txn.pendingWrites[string(e.Key)]; ok {
+		return ErrAppendOnly
+	}
+	// Write batches don't have a read timestamp. Check against everything written so far.
+	readTs := txn.readTs
+	if readTs == 0 {
+		readTs = math.MaxUint64
+	}
+	vs, err := txn.db.get(y.KeyWithTs(e.Key, readTs))
+	if err != nil {
+		return y.Wrapf(err, "while checking if key exists in append-only mode")
+	}
+	txn.addReadKey(e.Key)
+	if vs.Version > 0 && !isDeletedOrExpired(vs.Meta, vs.ExpiresAt) {
+		return ErrAppendOnly
+	}
+	return nil
+}
+
 // Set adds a key-value pair to the database.
 // It will return ErrReadOnlyTxn if update flag was set to false when creating the transaction.
 //
@@ -471,6 +525,7 @@ func (txn *Txn) Get(key []byte) (item *Item, rerr error) {
 	if err := txn.db.isBanned(key); err != nil {
 		return nil, err
 	}
+	txn.db.evictTracker.touch(key)
 
 	item = new(Item)
 	if txn.update {
@@ -494,8 +549,18 @@ func (txn *Txn) Get(key []byte) (item *Item, rerr error) {
 		txn.addReadKey(key)
 	}
 
+	ro := txn.readOpt
+	if txn.db.opt.MetricsEnabled || ro.Trace != nil {
+		if txn.db.opt.MetricsEnabled {
+			defer txn.db.stats.getLatency.since(time.Now())
+		}
+		// Trace the lookup locally, and add it up once done.
+		trace := &ReadTrace{Gets: 1}
+		ro.Trace = trace
+		defer txn.traceRead(trace)
+	}
 	seek := y.KeyWithTs(key, txn.readTs)
-	vs, err := txn.db.get(seek)
+	vs, err := txn.db.getWithOptions(seek, ro)
 	if err != nil {
 		return nil, y.Wrapf(err, "DB::Get key: %q", key)
 	}
@@ -516,6 +581,87 @@ func (txn *Txn) Get(key []byte) (item *Item, rerr error) {
 	return item, nil
 }
 
+// traceRead adds trace to the trace of the read options and to the DB stats.
+func (txn *Txn) traceRead(trace *ReadTrace) {
+	txn.readOpt.Trace.add(trace)
+	if txn.db.opt.MetricsEnabled {
+		txn.db.stats.reads.add(trace)
+	}
+}
+
+// KeyVersion is a single version of a key, as returned by Txn.History.
+type KeyVersion struct {
+	Version   uint64
+	Value     []byte
+	UserMeta  byte
+	ExpiresAt uint64
+	// Deleted is true if this version is a delete marker or has expired. Value is nil then.
+	Deleted bool
+}
+
+// History returns up to limit versions of key visible to the transaction, the newest first. A limit
+// of zero or less returns all the versions. Only the versions kept by Badger can be returned, so
+// Options.NumVersionsToKeep should be set accordingly to keep a longer history. The returned values
+// are copies, so they can be used after the transaction is discarded.
+func (txn *Txn) History(key []byte, limit int) ([]KeyVersion, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	} else if txn.discarded {
+		return nil, ErrDiscardedTxn
+	}
+	if err := txn.db.isBanned(key); err != nil {
+		return nil, err
+	}
+
+	opt := DefaultIteratorOptions
+	opt.PrefetchValues = false
+	itr := txn.NewKeyIterator(key, opt)
+	defer itr.Close()
+
+	var history []KeyVersion
+	for itr.Rewind(); itr.Valid(); itr.Next() {
+		if limit > 0 && len(history) >= limit {
+			break
+		}
+		item := itr.Item()
+		kv := KeyVersion{
+			Version:   item.Version(),
+			UserMeta:  item.UserMeta(),
+			ExpiresAt: item.ExpiresAt(),
+			Deleted:   item.IsDeletedOrExpired(),
+		}
+		if !kv.Deleted {
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return nil, err
+			}
+			kv.Value = val
+		}
+		history = append(history, kv)
+		if item.DiscardEarlierVersions() {
+			// The earlier versions are no longer valid.
+			break
+		}
+	}
+	return history, nil
+}
+
+// HasPrefix returns true if the transaction can see any key with the given prefix. Only the tables
+// whose key range overlaps the prefix are looked at, and it stops at the first key found, so it
+// is cheap to check for a prefix having no data.
+func (txn *Txn) HasPrefix(prefix []byte) (bool, error) {
+	if txn.discarded {
+		return false, ErrDiscardedTxn
+	}
+	opt := DefaultIteratorOptions
+	opt.PrefetchValues = false
+	opt.Prefix = prefix
+	itr := txn.NewIterator(opt)
+	defer itr.Close()
+	itr.Rewind()
+	return itr.Valid(), nil
+}
+
 func (txn *Txn) addReadKey(key []byte) {
 	if txn.update {
 		fp := z.MemHash(key)
@@ -549,6 +695,7 @@ func (txn *Txn) Discard() {
 }
 
 func (txn *Txn) commitAndSend() (func() error, error) {
+	start := time.Now()
 	orc := txn.db.orc
 	// Ensure that the order in which we get the commit timestamp is the same as
 	// the order in which we push these updates to the write channel. So, we
@@ -563,6 +710,7 @@ func (txn *Txn) commitAndSend() (func() error, error) {
 	if commitTs == 0 && !txn.db.opt.managedTxns {
 		return nil, ErrConflict
 	}
+	txn.commitTs = commitTs
 
 	keepTogether := true
 	setVersion := func(e *Entry) {
@@ -622,7 +770,24 @@ func (txn *Txn) commitAndSend() (func() error, error) {
 		entries = append(entries, e)
 	}
 
-	req, err := txn.db.sendToWriteCh(entries)
+	if txn.large && txn.db.tooBig(txn.count, txn.size) {
+		if keepTogether {
+			// The transaction marker is only needed to replay the write-ahead log.
+			entries = entries[:len(entries)-1]
+		}
+		ret := func() error {
+			err := txn.db.writeLevel0(entries)
+			orc.doneCommit(commitTs)
+			if err == nil && txn.db.opt.MetricsEnabled {
+				atomic.AddUint64(&txn.db.stats.writes, uint64(len(entries)))
+				txn.db.stats.commitLatency.since(start)
+			}
+			return err
+		}
+		return ret, nil
+	}
+
+	req, err := txn.db.sendToWriteChWithSync(entries, txn.sync)
 	if err != nil {
 		orc.doneCommit(commitTs)
 		return nil, err
@@ -633,6 +798,10 @@ func (txn *Txn) commitAndSend() (func() error, error) {
 		// We can't defer doneCommit above, because it is being called from a
 		// callback here.
 		orc.doneCommit(commitTs)
+		if err == nil && txn.db.opt.MetricsEnabled {
+			atomic.AddUint64(&txn.db.stats.writes, uint64(len(entries)))
+			txn.db.stats.commitLatency.since(start)
+		}
 		return err
 	}
 	return ret, nil
@@ -660,6 +829,127 @@ func (txn *Txn) commitPrecheck() error {
 	return nil
 }
 
+// SetSyncWrites overrides Options.SyncWrites for the commit of the transaction. With val set, the
+// writes of the transaction are synced to disk before the commit returns, whatever the options
+// say, so that rare critical writes survive hard reboots without syncing every write. With val
+// unset, the commit doesn't wait for a sync, even if Options.SyncWrites is set. The writes are
+// synced anyway if the other writes committed along with them are.
+func (txn *Txn) SetSyncWrites(val bool) {
+	if val {
+		txn.sync = syncAlways
+	} else {
+		txn.sync = syncNever
+	}
+}
+
+// ReadTier tells which tiers of the DB a read may touch.
+type ReadTier int
+
+const (
+	// ReadAll reads the memtables and the LSM tree. This is the default.
+	ReadAll ReadTier = iota
+	// ReadMemtables reads the memtables only, so that the read never waits for the disk. Keys
+	// which aren't in the memtables fail with ErrNotCached.
+	ReadMemtables
+	// ReadMemoryOnly reads the memtables, the tables kept in memory and the blocks in the block
+	// cache. Reads which would have to read a block from the disk fail with ErrNotCached, so
+	// that the caller can serve a fast path and read the key from the disk asynchronously.
+	ReadMemoryOnly
+)
+
+// inMemory tells if the reads can only touch memory.
+func (rt ReadTier) inMemory() bool {
+	return rt == ReadMemtables || rt == ReadMemoryOnly
+}
+
+// ReadOptions tunes the reads done by a transaction. See Txn.SetReadOptions.
+type ReadOptions struct {
+	// VerifyChecksum verifies the checksums of the table blocks and of the values read from the
+	// value log, whatever Options.ChecksumVerificationMode and Options.VerifyValueChecksum say.
+	VerifyChecksum bool
+	// DontFillCache keeps the table blocks read out of the block cache, so that one-off scans
+	// don't evict the blocks of the hot keys.
+	DontFillCache bool
+	// Tier limits the reads to some tiers of the DB. See ReadTier.
+	Tier ReadTier
+	// Trace, if set, accumulates what the reads touched. See ReadTrace.
+	Trace *ReadTrace
+}
+
+// ReadTrace counts what reads touched, to measure their read amplification: how much work a read
+// takes beyond fetching the key. Gets account for all the fields, and values read by iterators
+// account for ValueLogReads. The fields are updated atomically, so a ReadTrace can be shared by
+// concurrent transactions and read with atomic loads while they run.
+type ReadTrace struct {
+	// Gets is the number of calls to Txn.Get.
+	Gets uint64 `json:"gets"`
+	// Memtables is the number of memtables looked up.
+	Memtables uint64 `json:"memtables"`
+	// Tables is the number of tables which might hold the key, and BloomNegatives is the number
+	// of them skipped because their bloom filter doesn't have the key.
+	Tables         uint64 `json:"tables"`
+	BloomNegatives uint64 `json:"bloom_negatives"`
+	// Blocks is the number of table blocks searched, and BlockReads is the number of them which
+	// weren't in the block cache and were read from the table files.
+	Blocks     uint64 `json:"blocks"`
+	BlockReads uint64 `json:"block_reads"`
+	// ValueLogReads is the number of values read from the value log.
+	ValueLogReads uint64 `json:"value_log_reads"`
+}
+
+// add adds the counts of o to rt atomically. rt can be nil.
+func (rt *ReadTrace) add(o *ReadTrace) {
+	if rt == nil {
+		return
+	}
+	atomic.AddUint64(&rt.Gets, o.Gets)
+	atomic.AddUint64(&rt.Memtables, o.Memtables)
+	atomic.AddUint64(&rt.Tables, o.Tables)
+	atomic.AddUint64(&rt.BloomNegatives, o.BloomNegatives)
+	atomic.AddUint64(&rt.Blocks, o.Blocks)
+	atomic.AddUint64(&rt.BlockReads, o.BlockReads)
+	atomic.AddUint64(&rt.ValueLogReads, o.ValueLogReads)
+}
+
+// load returns a copy of rt loaded atomically.
+func (rt *ReadTrace) load() ReadTrace {
+	return ReadTrace{
+		Gets:           atomic.LoadUint64(&rt.Gets),
+		Memtables:      atomic.LoadUint64(&rt.Memtables),
+		Tables:         atomic.LoadUint64(&rt.Tables),
+		BloomNegatives: atomic.LoadUint64(&rt.BloomNegatives),
+		Blocks:         atomic.LoadUint64(&rt.Blocks),
+		BlockReads:     atomic.LoadUint64(&rt.BlockReads),
+		ValueLogReads:  atomic.LoadUint64(&rt.ValueLogReads),
+	}
+}
+
+// tableFlags returns the table iterator flags for the options.
+func (ro ReadOptions) tableFlags() int {
+	var flags int
+	if ro.VerifyChecksum {
+		flags |= table.VERIFY
+	}
+	if ro.DontFillCache {
+		flags |= table.NOCACHE
+	}
+	if ro.Tier == ReadMemoryOnly {
+		flags |= table.CACHEONLY
+	}
+	return flags
+}
+
+// SetReadOptions sets the options of the reads done by Get and by the iterators created after the
+// call. The transaction reads the snapshot of its read timestamp, whatever the options. With
+// ReadMemtables, Get fails fast with ErrNotCached for keys not found in the memtables, and
+// iterators only see the keys which are in the memtables. With ReadMemoryOnly, Get fails with
+// ErrNotCached if it would have to read a table block from the disk, and the iteration over a
+// table stops at its first block which isn't in memory. With both tiers, reading a value stored
+// in the value log fails with ErrNotCached.
+func (txn *Txn) SetReadOptions(opt ReadOptions) {
+	txn.readOpt = opt
+}
+
 // Commit commits the transaction, following these steps:
 //
 // 1. If there are no writes, return immediately.
@@ -678,7 +968,27 @@ func (txn *Txn) commitPrecheck() error {
 //
 // If error is nil, the transaction is successfully committed. In case of a non-nil error, the LSM
 // tree won't be updated, so there's no need for any rollback.
+//
+// The writes of a transaction are all or nothing, also across crashes. They are written to the
+// write-ahead log as one group of entries closed by a commit marker, and the recovery stops at the
+// first group without its marker, so no part of a transaction cut short by a crash is replayed.
+// Whether a transaction acknowledged just before a crash survives it depends on the syncing of the
+// writes, see Txn.SetSyncWrites. This doesn't hold for the entries set with their own versions in
+// managed mode, see WriteBatch.SetEntryAt, nor across the transactions a WriteBatch is split into.
 func (txn *Txn) Commit() error {
+	if txn.prepared != nil && !txn.discarded {
+		txn.finishPrepared()
+	}
+	if txn.opID != nil {
+		applied, err := txn.applyOperation()
+		if err != nil {
+			return err
+		}
+		if applied {
+			txn.Discard()
+			return nil
+		}
+	}
 	// txn.conflictKeys can be zero if conflict detection is turned off. So we
 	// should check txn.pendingWrites.
 	if len(txn.pendingWrites) == 0 {
@@ -686,19 +996,31 @@ func (txn *Txn) Commit() error {
 	}
 	// Precheck before discarding txn.
 	if err := txn.commitPrecheck(); err != nil {
+		txn.finishOperation(err)
 		return err
 	}
 	defer txn.Discard()
 
 	txnCb, err := txn.commitAndSend()
 	if err != nil {
+		txn.finishOperation(err)
 		return err
 	}
 	// If batchSet failed, LSM would not have been updated. So, no need to rollback anything.
 
 	// TODO: What if some of the txns successfully make it to value log, but others fail.
 	// Nothing gets updated to LSM, until a restart happens.
-	return txnCb()
+	err = txnCb()
+	txn.finishCommit(err)
+	return err
+}
+
+// finishCommit updates the state tracked along with the writes of txn once they are written.
+func (txn *Txn) finishCommit(err error) {
+	if txn.prepared != nil {
+		txn.restorePrepared(err)
+	}
+	txn.finishOperation(err)
 }
 
 type txnCb struct {
@@ -731,6 +1053,19 @@ func (txn *Txn) CommitWith(cb func(error)) {
 	if cb == nil {
 		panic("Nil callback provided to CommitWith")
 	}
+	if txn.prepared != nil && !txn.discarded {
+		txn.finishPrepared()
+	}
+	if txn.opID != nil {
+		applied, err := txn.applyOperation()
+		if applied || err != nil {
+			if applied {
+				txn.Discard()
+			}
+			go runTxnCallback(&txnCb{user: cb, err: err})
+			return
+		}
+	}
 
 	if len(txn.pendingWrites) == 0 {
 		// Do not run these callbacks from here, because the CommitWith and the
@@ -742,6 +1077,7 @@ func (txn *Txn) CommitWith(cb func(error)) {
 
 	// Precheck before discarding txn.
 	if err := txn.commitPrecheck(); err != nil {
+		txn.finishOperation(err)
 		cb(err)
 		return
 	}
@@ -750,10 +1086,19 @@ func (txn *Txn) CommitWith(cb func(error)) {
 
 	commitCb, err := txn.commitAndSend()
 	if err != nil {
+		txn.finishOperation(err)
 		go runTxnCallback(&txnCb{user: cb, err: err})
 		return
 	}
 
+	if txn.prepared != nil || txn.opID != nil {
+		commit := commitCb
+		commitCb = func() error {
+			err := commit()
+			txn.finishCommit(err)
+			return err
+		}
+	}
 	go runTxnCallback(&txnCb{user: cb, commit: commitCb})
 }
 
@@ -762,6 +1107,15 @@ func (txn *Txn) ReadTs() uint64 {
 	return txn.readTs
 }
 
+// CommitTs returns the commit timestamp of the transaction, which is the version of all the keys
+// written by it. It is zero until the transaction gets committed. The commit timestamp is
+// assigned when Commit or CommitWith is called, so it should only be relied upon once the commit
+// has succeeded. Callers can use it for optimistic concurrency, by passing it back to
+// DB.WriteIf as a Condition version, or to track how far their writes have progressed.
+func (txn *Txn) CommitTs() uint64 {
+	return txn.commitTs
+}
+
 // NewTransaction creates a new transaction. Badger supports concurrent execution of transactions,
 // providing serializable snapshot isolation, avoiding write skews. Badger achieves this by tracking
 // the keys read and at Commit time, ensuring that these read keys weren't concurrently modified by
@@ -847,3 +1201,50 @@ func (db *DB) Update(fn func(txn *Txn) error) error {
 
 	return txn.Commit()
 }
+
+// History returns up to limit versions of key, the newest first. See Txn.History for details.
+func (db *DB) History(key []byte, limit int) ([]KeyVersion, error) {
+	var history []KeyVersion
+	err := db.View(func(txn *Txn) error {
+		var err error
+		history, err = txn.History(key, limit)
+		return err
+	})
+	return history, err
+}
+
+// HasPrefix returns true if there is any key with the given prefix. See Txn.HasPrefix for details.
+func (db *DB) HasPrefix(prefix []byte) (bool, error) {
+	var has bool
+	err := db.View(func(txn *Txn) error {
+		var err error
+		has, err = txn.HasPrefix(prefix)
+		return err
+	})
+	return has, err
+}
+
+// GetItem looks for the latest version of key and returns the corresponding Item. The Item
+// carries the version, user metadata, expiry and value size of the key, while the value itself is
+// only read when Item.Value or Item.ValueCopy is called. Unlike the items returned by Txn.Get, the
+// Item can be used after GetItem returns. Note that a value stored in the value log should be
+// read soon, since it can no longer be read once value log GC has moved it. If the key is not
+// found, ErrKeyNotFound is returned.
+//
+// GetItem returns the context error if ctx is done before the lookup.
+func (db *DB) GetItem(ctx context.Context, key []byte) (*Item, error) {
+	if db.opt.managedTxns {
+		return nil, ErrManagedTxn
+	}
+	if db.IsClosed() {
+		return nil, ErrDBClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	txn := db.NewTransaction(false)
+	defer txn.Discard()
+
+	// The item keeps a reference to the key, so pass a copy.
+	return txn.Get(y.SafeCopy(nil, key))
+}
@@ -17,8 +17,10 @@
 package badger
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"strconv"
 	"sync"
@@ -28,6 +30,7 @@ import (
 
 	"github.com/dgraph-io/badger/v3/y"
 	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
 
 	"github.com/stretchr/testify/require"
 )
@@ -55,6 +58,179 @@ func TestTxnSimple(t *testing.T) {
 	})
 }
 
+func TestTxnCommitTs(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		txn := db.NewTransaction(true)
+		require.NoError(t, txn.Set([]byte("foo"), []byte("bar")))
+		require.Zero(t, txn.CommitTs())
+		require.NoError(t, txn.Commit())
+		require.NotZero(t, txn.CommitTs())
+
+		require.NoError(t, db.View(func(rtxn *Txn) error {
+			item, err := rtxn.Get([]byte("foo"))
+			require.NoError(t, err)
+			require.Equal(t, txn.CommitTs(), item.Version())
+			return nil
+		}))
+
+		wb := db.NewWriteBatch()
+		defer wb.Cancel()
+		require.NoError(t, wb.Set([]byte("foo"), []byte("baz")))
+		require.NoError(t, wb.Flush())
+		require.Greater(t, wb.MaxVersion(), txn.CommitTs())
+	})
+}
+
+func TestGetItem(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		ctx := context.Background()
+		_, err := db.GetItem(ctx, []byte("foo"))
+		require.Equal(t, ErrKeyNotFound, err)
+
+		txn := db.NewTransaction(true)
+		e := NewEntry([]byte("foo"), []byte("bar")).WithMeta(0x04).WithTTL(time.Hour)
+		require.NoError(t, txn.SetEntry(e))
+		require.NoError(t, txn.Commit())
+
+		item, err := db.GetItem(ctx, []byte("foo"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("foo"), item.Key())
+		require.Equal(t, txn.CommitTs(), item.Version())
+		require.Equal(t, byte(0x04), item.UserMeta())
+		require.Equal(t, e.ExpiresAt, item.ExpiresAt())
+		require.Equal(t, int64(3), item.ValueSize())
+		require.Equal(t, []byte("bar"), getItemValue(t, item))
+
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = db.GetItem(ctx, []byte("foo"))
+		require.Equal(t, context.Canceled, err)
+	})
+}
+
+func TestHistory(t *testing.T) {
+	opt := getTestOptions("")
+	opt.NumVersionsToKeep = math.MaxInt32
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		key := []byte("foo")
+		_, err := db.History(nil, 0)
+		require.Equal(t, ErrEmptyKey, err)
+
+		var versions []uint64
+		for i := 0; i < 5; i++ {
+			txn := db.NewTransaction(true)
+			if i == 3 {
+				require.NoError(t, txn.Delete(key))
+			} else {
+				require.NoError(t, txn.SetEntry(NewEntry(key, []byte(fmt.Sprintf("val%d", i)))))
+			}
+			require.NoError(t, txn.Commit())
+			versions = append(versions, txn.CommitTs())
+		}
+		txnSet(t, db, []byte("other"), []byte("val"), 0)
+
+		history, err := db.History(key, 0)
+		require.NoError(t, err)
+		require.Len(t, history, 5)
+		for i, kv := range history {
+			idx := 4 - i
+			require.Equal(t, versions[idx], kv.Version)
+			if idx == 3 {
+				require.True(t, kv.Deleted)
+				require.Nil(t, kv.Value)
+				continue
+			}
+			require.False(t, kv.Deleted)
+			require.Equal(t, []byte(fmt.Sprintf("val%d", idx)), kv.Value)
+		}
+
+		history, err = db.History(key, 2)
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		require.Equal(t, versions[4], history[0].Version)
+
+		// Versions before a discard marker are not part of the history.
+		txn := db.NewTransaction(true)
+		require.NoError(t, txn.SetEntry(NewEntry(key, []byte("new")).WithDiscard()))
+		require.NoError(t, txn.Commit())
+		history, err = db.History(key, 0)
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		require.Equal(t, []byte("new"), history[0].Value)
+	})
+}
+
+func TestHasPrefix(t *testing.T) {
+	runBadgerTest(t, nil, func(t *testing.T, db *DB) {
+		has := func(prefix string) bool {
+			ok, err := db.HasPrefix([]byte(prefix))
+			require.NoError(t, err)
+			return ok
+		}
+		require.False(t, has("tenant1/"))
+
+		txnSet(t, db, []byte("tenant1/a"), []byte("val"), 0)
+		txnSet(t, db, []byte("tenant2/a"), []byte("val"), 0)
+		require.True(t, has("tenant1/"))
+		require.True(t, has("tenant2/"))
+		require.True(t, has(""))
+		require.False(t, has("tenant3/"))
+
+		txnDelete(t, db, []byte("tenant1/a"))
+		require.False(t, has("tenant1/"))
+
+		// Uncommitted writes are visible to the transaction.
+		txn := db.NewTransaction(true)
+		defer txn.Discard()
+		require.NoError(t, txn.Set([]byte("tenant3/a"), []byte("val")))
+		ok, err := txn.HasPrefix([]byte("tenant3/"))
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.False(t, has("tenant3/"))
+	})
+}
+
+func TestAppendOnly(t *testing.T) {
+	opt := getTestOptions("").WithAppendOnly(true)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		key := []byte("ledger/1")
+		txnSet(t, db, key, []byte("val"), 0)
+
+		require.Equal(t, ErrAppendOnly, db.Update(func(txn *Txn) error {
+			return txn.Set(key, []byte("new"))
+		}))
+		require.Equal(t, ErrAppendOnly, db.Update(func(txn *Txn) error {
+			return txn.Delete(key)
+		}))
+		require.Equal(t, ErrAppendOnly, db.Update(func(txn *Txn) error {
+			return txn.SetEntry(NewEntry([]byte("ledger/2"), nil).WithTTL(time.Hour))
+		}))
+		require.Equal(t, ErrAppendOnly, db.Update(func(txn *Txn) error {
+			require.NoError(t, txn.Set([]byte("ledger/2"), []byte("a")))
+			return txn.Set([]byte("ledger/2"), []byte("b"))
+		}))
+
+		wb := db.NewWriteBatch()
+		require.Equal(t, ErrAppendOnly, wb.Set(key, []byte("new")))
+		wb.Cancel()
+
+		// Two transactions writing the same new key conflict.
+		txn1 := db.NewTransaction(true)
+		txn2 := db.NewTransaction(true)
+		require.NoError(t, txn1.Set([]byte("ledger/3"), []byte("a")))
+		require.NoError(t, txn2.Set([]byte("ledger/3"), []byte("b")))
+		require.NoError(t, txn1.Commit())
+		require.Equal(t, ErrConflict, txn2.Commit())
+
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get(key)
+			require.NoError(t, err)
+			require.Equal(t, []byte("val"), getItemValue(t, item))
+			return nil
+		}))
+	})
+}
+
 func TestTxnReadAfterWrite(t *testing.T) {
 	test := func(t *testing.T, db *DB) {
 		var wg sync.WaitGroup
@@ -943,3 +1119,217 @@ func TestConflict(t *testing.T) {
 		runTest(t, testAndSetItr)
 	})
 }
+
+func TestTxnSetSyncWrites(t *testing.T) {
+	for _, syncWrites := range []bool{false, true} {
+		db := &DB{opt: DefaultOptions("").WithSyncWrites(syncWrites)}
+		req := func(sync syncMode) *request { return &request{sync: sync} }
+		require.Equal(t, syncWrites, db.needsSync([]*request{req(syncDefault)}))
+		require.True(t, db.needsSync([]*request{req(syncNever), req(syncAlways)}))
+		require.False(t, db.needsSync([]*request{req(syncNever), req(syncNever)}))
+		require.Equal(t, syncWrites, db.needsSync([]*request{req(syncNever), req(syncDefault)}))
+	}
+	// With MaxSyncDelay, the writes are only synced right away if they ask for it.
+	db := &DB{opt: DefaultOptions("").WithSyncWrites(true).WithMaxSyncDelay(time.Second)}
+	require.False(t, db.needsSync([]*request{{sync: syncDefault}}))
+	require.True(t, db.needsSync([]*request{{sync: syncAlways}}))
+
+	opt := getTestOptions("").WithSyncWrites(true).WithMaxSyncDelay(time.Hour)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		txn := db.NewTransaction(true)
+		txn.SetSyncWrites(true)
+		require.NoError(t, txn.Set([]byte("critical"), []byte("val")))
+		require.NoError(t, txn.Commit())
+		// The write was synced along with its commit, so no sync is pending.
+		require.Len(t, db.syncCh, 0)
+
+		wb := db.NewWriteBatch()
+		wb.SetSyncWrites(false)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, wb.Set([]byte(fmt.Sprintf("key%d", i)), []byte("val")))
+		}
+		require.NoError(t, wb.Flush())
+
+		require.NoError(t, db.View(func(txn *Txn) error {
+			item, err := txn.Get([]byte("critical"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("val"), getItemValue(t, item))
+			_, err = txn.Get([]byte("key99"))
+			return err
+		}))
+	})
+}
+
+func TestTxnSetReadOptions(t *testing.T) {
+	opt := getTestOptions("")
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		createAndOpenWithOptions(db, []keyValVersion{{key: "disk", val: "v", version: 1}}, 1, nil)
+		txnSet(t, db, []byte("mem"), []byte("v"), 0)
+
+		get := func(ro ReadOptions, key string) error {
+			txn := db.NewTransaction(false)
+			defer txn.Discard()
+			txn.SetReadOptions(ro)
+			_, err := txn.Get([]byte(key))
+			return err
+		}
+		memOnly := ReadOptions{Tier: ReadMemtables}
+		require.NoError(t, get(memOnly, "mem"))
+		require.Equal(t, ErrNotCached, errors.Cause(get(memOnly, "disk")))
+		require.Equal(t, ErrNotCached, errors.Cause(get(memOnly, "missing")))
+		require.Equal(t, ErrKeyNotFound, get(ReadOptions{}, "missing"))
+
+		// The block read without filling the cache isn't added to it.
+		require.NoError(t, get(ReadOptions{DontFillCache: true, VerifyChecksum: true}, "disk"))
+		db.blockCache.Wait()
+		require.Zero(t, db.BlockCacheMetrics().KeysAdded())
+		require.NoError(t, get(ReadOptions{}, "disk"))
+		db.blockCache.Wait()
+		require.Equal(t, uint64(1), db.BlockCacheMetrics().KeysAdded())
+
+		// Iterators limited to the memtables only see the keys in the memtables.
+		txn := db.NewTransaction(false)
+		defer txn.Discard()
+		txn.SetReadOptions(memOnly)
+		it := txn.NewIterator(DefaultIteratorOptions)
+		defer it.Close()
+		var keys []string
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys = append(keys, string(it.Item().Key()))
+		}
+		require.Equal(t, []string{"mem"}, keys)
+	})
+}
+
+func TestTxnReadTrace(t *testing.T) {
+	opt := getTestOptions("").WithValueThreshold(32).WithMetricsEnabled(true)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		createAndOpenWithOptions(db, []keyValVersion{
+			{key: "disk", val: "v", version: 1},
+			{key: "vault", val: "v", version: 1},
+		}, 1, nil)
+		txnSet(t, db, []byte("big"), make([]byte, 64), 0)
+
+		get := func(key string) (ReadTrace, error) {
+			var trace ReadTrace
+			txn := db.NewTransaction(false)
+			defer txn.Discard()
+			txn.SetReadOptions(ReadOptions{Trace: &trace})
+			item, err := txn.Get([]byte(key))
+			if err != nil {
+				return trace, err
+			}
+			return trace, item.Value(func([]byte) error { return nil })
+		}
+
+		// The value of big is in the value log.
+		trace, err := get("big")
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), trace.Gets)
+		require.Equal(t, uint64(1), trace.Memtables)
+		require.Zero(t, trace.Tables)
+		require.Equal(t, uint64(1), trace.ValueLogReads)
+
+		// The block of disk is read from the table once, then from the block cache.
+		trace, err = get("disk")
+		require.NoError(t, err)
+		require.Equal(t, ReadTrace{Gets: 1, Memtables: 1, Tables: 1, Blocks: 1, BlockReads: 1},
+			trace)
+		db.blockCache.Wait()
+		trace, err = get("disk")
+		require.NoError(t, err)
+		require.Equal(t, ReadTrace{Gets: 1, Memtables: 1, Tables: 1, Blocks: 1}, trace)
+
+		// The bloom filter of the table doesn't have the missing key.
+		trace, err = get("maybe")
+		require.Equal(t, ErrKeyNotFound, err)
+		require.Equal(t, ReadTrace{Gets: 1, Memtables: 1, Tables: 1, BloomNegatives: 1}, trace)
+
+		require.Equal(t, ReadTrace{Gets: 4, Memtables: 4, Tables: 3, BloomNegatives: 1, Blocks: 2,
+			BlockReads: 1, ValueLogReads: 1}, db.Stats().Reads)
+	})
+}
+
+func TestTxnReadMemoryOnly(t *testing.T) {
+	opt := getTestOptions("").WithValueThreshold(32)
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		createAndOpenWithOptions(db, []keyValVersion{{key: "disk", val: "v", version: 1}}, 1, nil)
+		txnSet(t, db, []byte("big"), make([]byte, 64), 0)
+
+		memOnly := ReadOptions{Tier: ReadMemoryOnly}
+		get := func(ro ReadOptions, key string) error {
+			txn := db.NewTransaction(false)
+			defer txn.Discard()
+			txn.SetReadOptions(ro)
+			item, err := txn.Get([]byte(key))
+			if err != nil {
+				return err
+			}
+			return item.Value(func([]byte) error { return nil })
+		}
+		require.Equal(t, ErrNotCached, errors.Cause(get(memOnly, "disk")))
+		require.NoError(t, get(ReadOptions{}, "disk"))
+		db.blockCache.Wait()
+		// The block was cached by the read above.
+		require.NoError(t, get(memOnly, "disk"))
+
+		// The value of big is in the value log.
+		require.Equal(t, ErrNotCached, errors.Cause(get(memOnly, "big")))
+		require.NoError(t, get(ReadOptions{}, "big"))
+	})
+}
+
+// TestTxnAtomicAcrossCrash cuts the write-ahead log at every offset within a transaction, like a
+// crash while it is written, and checks that none of its writes are visible after recovery.
+func TestTxnAtomicAcrossCrash(t *testing.T) {
+	first := []*Entry{{Key: []byte("first"), Value: []byte("value")}}
+	entries := append([]*Entry{}, first...)
+	for i := 0; i < 10; i++ {
+		entries = append(entries, &Entry{
+			Key:   []byte(fmt.Sprintf("key%d", i)),
+			Value: []byte(fmt.Sprintf("value%d", i)),
+		})
+	}
+	_, start := createMemFile(t, first)
+	buf, end := createMemFile(t, entries)
+	require.True(t, start < end)
+
+	check := func(cut uint32) {
+		dir, err := ioutil.TempDir("", "badger-test")
+		require.NoError(t, err)
+		defer removeDir(dir)
+		opt := getTestOptions(dir)
+		opt.ValueLogFileSize = 100 * 1024 * 1024 // Like createMemFile.
+		db, err := Open(opt)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+		require.NoError(t, ioutil.WriteFile(db.mtFilePath(1), buf[:cut], 0666))
+
+		db, err = Open(opt)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, db.Close()) }()
+		require.NoError(t, db.View(func(txn *Txn) error {
+			_, err := txn.Get(first[0].Key)
+			require.NoError(t, err)
+			var found int
+			for _, e := range entries[1:] {
+				if _, err := txn.Get(e.Key); err == nil {
+					found++
+				} else {
+					require.Equal(t, ErrKeyNotFound, err)
+				}
+			}
+			if cut < end {
+				require.Zero(t, found, "cut at %d of [%d, %d)", cut, start, end)
+			} else {
+				require.Equal(t, len(entries)-1, found)
+			}
+			return nil
+		}))
+	}
+	for cut := start; cut < end; cut += 9 {
+		check(cut)
+	}
+	check(end - 1)
+	check(end)
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
+)
+
+// Upgrade rewrites the DB at opt.Dir in the current on-disk format. All the data is streamed into
+// a new DB at outOpt.Dir, so that every table and value log file gets written afresh with outOpt.
+// This can also be used to add compression or encryption to an existing DB. Once all the data has
+// been written, the new DB is verified against the old one.
+//
+// The DB at opt.Dir is opened in read-only mode, even if its format requires an upgrade, and it is
+// left untouched. Both the DBs must not be in use while Upgrade runs.
+func Upgrade(opt, outOpt Options) error {
+	opt.ReadOnly = true
+	opt.allowUpgrade = true
+	db, err := OpenManaged(opt)
+	if err != nil {
+		return y.Wrapf(err, "cannot open DB at %s", opt.Dir)
+	}
+	defer db.Close()
+
+	outDB, err := OpenManaged(outOpt)
+	if err != nil {
+		return y.Wrapf(err, "cannot open out DB at %s", outOpt.Dir)
+	}
+	defer outDB.Close()
+
+	writer := outDB.NewStreamWriter()
+	if err := writer.Prepare(); err != nil {
+		return y.Wrapf(err, "cannot create stream writer in out DB at %s", outOpt.Dir)
+	}
+	// Don't copy the tables as they are. Every key has to be rewritten in the new format.
+	stream := db.NewStreamAt(math.MaxUint64)
+	stream.LogPrefix = fmt.Sprintf("Upgrading DB into %s", outOpt.Dir)
+	stream.Send = func(buf *z.Buffer) error {
+		return writer.Write(buf)
+	}
+	if err := stream.Orchestrate(context.Background()); err != nil {
+		writer.Cancel()
+		return y.Wrapf(err, "cannot stream DB to out DB at %s", outOpt.Dir)
+	}
+	if err := writer.Flush(); err != nil {
+		return y.Wrapf(err, "cannot flush writer")
+	}
+
+	count, err := verifyUpgrade(db, outDB)
+	if err != nil {
+		return y.Wrapf(err, "while verifying upgraded DB at %s", outOpt.Dir)
+	}
+	opt.Infof("Upgrade done. Verified %d keys in %s", count, outOpt.Dir)
+	return nil
+}
+
+// verifyUpgrade checks that the latest version of every key is the same in both the DBs. It
+// returns the number of keys verified.
+func verifyUpgrade(db, outDB *DB) (int, error) {
+	txn := db.NewTransactionAt(math.MaxUint64, false)
+	defer txn.Discard()
+	outTxn := outDB.NewTransactionAt(math.MaxUint64, false)
+	defer outTxn.Discard()
+
+	itr := txn.NewIterator(DefaultIteratorOptions)
+	defer itr.Close()
+	outItr := outTxn.NewIterator(DefaultIteratorOptions)
+	defer outItr.Close()
+
+	var count int
+	outItr.Rewind()
+	for itr.Rewind(); itr.Valid(); itr.Next() {
+		item := itr.Item()
+		if !outItr.Valid() {
+			return count, errors.Errorf("key %q is missing", item.Key())
+		}
+		outItem := outItr.Item()
+		if !bytes.Equal(item.Key(), outItem.Key()) {
+			return count, errors.Errorf("expected key %q, got %q", item.Key(), outItem.Key())
+		}
+		if item.Version() != outItem.Version() || item.UserMeta() != outItem.UserMeta() ||
+			item.ExpiresAt() != outItem.ExpiresAt() {
+			return count, errors.Errorf("metadata mismatch for key %q", item.Key())
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return count, err
+		}
+		outVal, err := outItem.ValueCopy(nil)
+		if err != nil {
+			return count, err
+		}
+		if !bytes.Equal(val, outVal) {
+			return count, errors.Errorf("value mismatch for key %q", item.Key())
+		}
+		outItr.Next()
+		count++
+	}
+	if outItr.Valid() {
+		return count, errors.Errorf("unexpected key %q", outItr.Item().Key())
+	}
+	return count, nil
+}
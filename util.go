@@ -18,12 +18,14 @@ package badger
 
 import (
 	"encoding/hex"
-	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"sync/atomic"
 	"time"
 
 	"github.com/dgraph-io/badger/v3/table"
+	"github.com/dgraph-io/badger/v3/vfs"
 	"github.com/dgraph-io/badger/v3/y"
 	"github.com/pkg/errors"
 )
@@ -95,8 +97,8 @@ func (s *levelsController) reserveFileID() uint64 {
 	return id - 1
 }
 
-func getIDMap(dir string) map[uint64]struct{} {
-	fileInfos, err := ioutil.ReadDir(dir)
+func getIDMap(fs vfs.FS, dir string) map[uint64]struct{} {
+	fileInfos, err := fs.ReadDir(dir)
 	y.Check(err)
 	idMap := make(map[uint64]struct{})
 	for _, info := range fileInfos {
@@ -112,6 +114,53 @@ func getIDMap(dir string) map[uint64]struct{} {
 	return idMap
 }
 
+// openExistingFile is y.OpenExistingFile on fs.
+func openExistingFile(fs vfs.FS, filename string, flags y.Flags) (vfs.File, error) {
+	openFlags := os.O_RDWR
+	if flags&y.ReadOnly != 0 {
+		openFlags = os.O_RDONLY
+	}
+	if flags&y.Sync != 0 {
+		openFlags |= y.DatasyncFlag()
+	}
+	return fs.OpenFile(filename, openFlags, 0)
+}
+
+// openTruncFile is y.OpenTruncFile on fs.
+func openTruncFile(fs vfs.FS, filename string, sync bool) (vfs.File, error) {
+	flags := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if sync {
+		flags |= y.DatasyncFlag()
+	}
+	return fs.OpenFile(filename, flags, 0600)
+}
+
+// rewriteFile atomically replaces the file filename in dir with data, writing it to
+// rewriteFilename first.
+func rewriteFile(fs vfs.FS, dir, filename, rewriteFilename string, data []byte) error {
+	rewritePath := filepath.Join(dir, rewriteFilename)
+	fp, err := openTruncFile(fs, rewritePath, false)
+	if err != nil {
+		return err
+	}
+	if _, err := fp.Write(data); err != nil {
+		fp.Close()
+		return err
+	}
+	if err := fp.Sync(); err != nil {
+		fp.Close()
+		return err
+	}
+	// In Windows the files should be closed before doing a Rename.
+	if err := fp.Close(); err != nil {
+		return err
+	}
+	if err := fs.Rename(rewritePath, filepath.Join(dir, filename)); err != nil {
+		return err
+	}
+	return fs.SyncDir(dir)
+}
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
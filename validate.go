@@ -0,0 +1,180 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/dgraph-io/badger/v3/y"
+)
+
+// InvariantReport is the result of DB.CheckInvariants.
+type InvariantReport struct {
+	// Tables is the number of tables checked in each level.
+	Tables []int
+	// Pointers is the number of value pointers checked.
+	Pointers int
+	// Violations describes the invariants which don't hold, if any.
+	Violations []string
+}
+
+// Err returns nil if no invariant is violated, and an error wrapping ErrInvariantViolated
+// otherwise.
+func (r *InvariantReport) Err() error {
+	if len(r.Violations) == 0 {
+		return nil
+	}
+	return errors.Wrapf(ErrInvariantViolated, "%d violations: %s", len(r.Violations),
+		strings.Join(r.Violations, "; "))
+}
+
+// String returns a verbose report, listing what was checked and the violations.
+func (r *InvariantReport) String() string {
+	var b strings.Builder
+	for level, n := range r.Tables {
+		fmt.Fprintf(&b, "Level %d: %d tables checked\n", level, n)
+	}
+	fmt.Fprintf(&b, "Value log: %d pointers checked\n", r.Pointers)
+	if len(r.Violations) == 0 {
+		b.WriteString("No invariant is violated\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "%d invariants violated:\n", len(r.Violations))
+	for _, v := range r.Violations {
+		fmt.Fprintf(&b, "  %s\n", v)
+	}
+	return b.String()
+}
+
+func (r *InvariantReport) violation(format string, args ...interface{}) {
+	r.Violations = append(r.Violations, fmt.Sprintf(format, args...))
+}
+
+// Validate checks the invariants of the DB, as CheckInvariants does. It returns an error wrapping
+// ErrInvariantViolated if any of them is violated.
+func (db *DB) Validate() error {
+	if db.IsClosed() {
+		return ErrDBClosed
+	}
+	return db.CheckInvariants().Err()
+}
+
+// CheckInvariants checks the invariants of the DB and returns a report. The invariants are:
+//
+//   - Level ordering: the smallest key of every table is not greater than its biggest key, and
+//     the tables of the levels below L0 are sorted by key.
+//   - No overlapping tables: the key ranges of the tables of a level below L0 are disjoint. The
+//     tables of L0 may overlap.
+//   - Level sizes: the size of every level is the sum of the sizes of its tables.
+//   - Value pointer reachability: the value pointer of every key visible to a new read-only
+//     transaction points within a value log file.
+//
+// The last check reads the whole LSM tree, so CheckInvariants may take a while on a large DB. It
+// can run while the DB is in use.
+func (db *DB) CheckInvariants() *InvariantReport {
+	r := &InvariantReport{}
+	for _, l := range db.lc.levels {
+		l.checkInvariants(r)
+	}
+	db.checkValuePointers(r)
+	return r
+}
+
+// checkInvariants checks the invariants of the level, which only depend on its tables.
+func (s *levelHandler) checkInvariants(r *InvariantReport) {
+	s.RLock()
+	defer s.RUnlock()
+	for len(r.Tables) <= s.level {
+		r.Tables = append(r.Tables, 0)
+	}
+	r.Tables[s.level] += len(s.tables)
+
+	var size int64
+	for i, t := range s.tables {
+		size += t.Size()
+		if y.CompareKeys(t.Smallest(), t.Biggest()) > 0 {
+			r.violation("L%d: smallest key %q of table %d is greater than its biggest key %q",
+				s.level, y.ParseKey(t.Smallest()), t.ID(), y.ParseKey(t.Biggest()))
+		}
+		if s.level == 0 || i == 0 {
+			continue
+		}
+		if prev := s.tables[i-1]; y.CompareKeys(prev.Biggest(), t.Smallest()) >= 0 {
+			r.violation("L%d: table %d [%q, %q] overlaps or precedes table %d [%q, %q]",
+				s.level, t.ID(), y.ParseKey(t.Smallest()), y.ParseKey(t.Biggest()), prev.ID(),
+				y.ParseKey(prev.Smallest()), y.ParseKey(prev.Biggest()))
+		}
+	}
+	if size != s.totalSize {
+		r.violation("L%d: size is %d, but its tables add up to %d", s.level, s.totalSize, size)
+	}
+}
+
+// checkValuePointers checks that the value pointers of the keys visible to a new read-only
+// transaction point within a value log file.
+func (db *DB) checkValuePointers(r *InvariantReport) {
+	if db.opt.InMemory {
+		return
+	}
+	var txn *Txn
+	if db.opt.managedTxns {
+		txn = db.NewTransactionAt(math.MaxUint64, false)
+	} else {
+		txn = db.NewTransaction(false)
+	}
+	defer txn.Discard()
+
+	opt := DefaultIteratorOptions
+	opt.PrefetchValues = false
+	itr := txn.NewIterator(opt)
+	defer itr.Close()
+	var vp valuePointer
+	for itr.Rewind(); itr.Valid(); itr.Next() {
+		item := itr.Item()
+		if item.meta&bitValuePointer == 0 {
+			continue
+		}
+		r.Pointers++
+		vp.Decode(item.vptr)
+		_, lf, err := db.vlog.readValueBytes(vp)
+		runCallback(db.vlog.getUnlockCallback(lf))
+		if err != nil {
+			r.violation("Value pointer %+v of key %q at version %d is unreachable: %v", vp,
+				item.Key(), item.Version(), err)
+		}
+	}
+}
+
+// checkLevelInvariants logs the violations of the invariants of the levels, if
+// Options.CheckInvariants is set.
+func (s *levelsController) checkLevelInvariants(levels ...*levelHandler) {
+	if !s.kv.opt.CheckInvariants {
+		return
+	}
+	r := &InvariantReport{}
+	for _, l := range levels {
+		l.checkInvariants(r)
+	}
+	for _, v := range r.Violations {
+		s.kv.opt.Errorf("Invariant violated: %s", v)
+		s.kv.events.add("Invariant violated: %s", v)
+	}
+}
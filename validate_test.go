@@ -0,0 +1,68 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	opt := getTestOptions("")
+	opt.ValueThreshold = 32
+	runBadgerTest(t, &opt, func(t *testing.T, db *DB) {
+		for i := 0; i < 100; i++ {
+			txnSet(t, db, []byte(fmt.Sprintf("key%03d", i)), make([]byte, 100), 0)
+		}
+		r := db.CheckInvariants()
+		require.NoError(t, r.Err())
+		require.Equal(t, 100, r.Pointers)
+		require.Len(t, r.Tables, db.opt.MaxLevels)
+		require.Contains(t, r.String(), "No invariant is violated")
+		require.NoError(t, db.Validate())
+
+		// The values can't be reached once their value log file is gone.
+		db.vlog.filesLock.Lock()
+		fid := db.vlog.maxFid
+		lf := db.vlog.filesMap[fid]
+		delete(db.vlog.filesMap, fid)
+		db.vlog.filesLock.Unlock()
+		r = db.CheckInvariants()
+		require.Len(t, r.Violations, 100)
+		require.Contains(t, r.Violations[0], "unreachable")
+		db.vlog.filesLock.Lock()
+		db.vlog.filesMap[fid] = lf
+		db.vlog.filesLock.Unlock()
+
+		// createAndOpen appends the tables to the level without updating its size.
+		createAndOpen(db, []keyValVersion{{"b", "v", 1, 0}, {"c", "v", 1, 0}}, 1)
+		createAndOpen(db, []keyValVersion{{"a", "v", 1, 0}}, 1)
+		r = db.CheckInvariants()
+		require.Equal(t, 2, r.Tables[1])
+		require.Len(t, r.Violations, 2)
+		require.Contains(t, r.Violations[0], "overlaps or precedes")
+		require.Contains(t, r.Violations[1], "tables add up to")
+		require.Contains(t, r.String(), "2 invariants violated")
+
+		err := db.Validate()
+		require.Error(t, err)
+		require.Equal(t, ErrInvariantViolated, errors.Cause(err))
+	})
+}
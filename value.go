@@ -23,7 +23,6 @@ import (
 	"hash"
 	"hash/crc32"
 	"io"
-	"io/ioutil"
 	"math"
 	"os"
 	"sort"
@@ -50,6 +49,10 @@ const (
 	BitDiscardEarlierVersions byte = 1 << 2 // Set if earlier versions can be discarded.
 	// Set if item shouldn't be discarded via compactions (used by merge operator)
 	bitMergeEntry byte = 1 << 3
+	// Set if the value stored in the LSM tree or the value log is compressed. See compressValue.
+	bitCompressed byte = 1 << 4
+	// Set if the value stored in the LSM tree is delta encoded. See encodeDelta.
+	bitDelta byte = 1 << 5
 	// The MSB 2 bits are for transactions.
 	bitTxn    byte = 1 << 6 // Set if the entry is part of a txn.
 	bitFinTxn byte = 1 << 7 // Set if the entry is to indicate end of txn in value log.
@@ -337,6 +340,7 @@ func (vlog *valueLog) rewrite(f *logFile) error {
 	vlog.opt.Infof("Processed %d entries in %d loops", len(wb), loops)
 	vlog.opt.Infof("Total entries: %d. Moved: %d", count, moved)
 	vlog.opt.Infof("Removing fid: %d", f.fid)
+	vlog.db.events.add("Rewrote value log file %d, moving %d of %d entries", f.fid, moved, count)
 	var deleteFileNow bool
 	// Entries written to LSM. Remove the older file now.
 	{
@@ -403,7 +407,10 @@ func (vlog *valueLog) deleteLogFile(lf *logFile) error {
 	// Delete fid from discard stats as well.
 	vlog.discardStats.Update(lf.fid, -1)
 
-	return lf.Delete()
+	if err := lf.Delete(); err != nil {
+		return err
+	}
+	return vlog.db.syncDir(vlog.dirPath)
 }
 
 func (vlog *valueLog) dropAll() (int, error) {
@@ -473,7 +480,7 @@ func (vlog *valueLog) fpath(fid uint32) string {
 func (vlog *valueLog) populateFilesMap() error {
 	vlog.filesMap = make(map[uint32]*logFile)
 
-	files, err := ioutil.ReadDir(vlog.dirPath)
+	files, err := vlog.opt.FS.ReadDir(vlog.dirPath)
 	if err != nil {
 		return errFile(err, vlog.dirPath, "Unable to open log dir.")
 	}
@@ -520,6 +527,10 @@ func (vlog *valueLog) createVlogFile() (*logFile, error) {
 	if err != z.NewFile && err != nil {
 		return nil, err
 	}
+	if err := vlog.db.syncDir(vlog.dirPath); err != nil {
+		_ = lf.Delete()
+		return nil, y.Wrapf(err, "while syncing dir for value log file: %s", path)
+	}
 
 	vlog.filesLock.Lock()
 	vlog.filesMap[fid] = lf
@@ -552,6 +563,10 @@ func (vlog *valueLog) init(db *DB) {
 	vlog.dirPath = vlog.opt.ValueDir
 
 	vlog.garbageCh = make(chan struct{}, 1) // Only allow one GC at a time.
+	// A read-only DB doesn't run the GC, and must not create files.
+	if vlog.opt.ReadOnly {
+		return
+	}
 	lf, err := InitDiscardStats(vlog.opt)
 	y.Check(err)
 	vlog.discardStats = lf
@@ -580,14 +595,18 @@ func (vlog *valueLog) open(db *DB) error {
 		lf, ok := vlog.filesMap[fid]
 		y.AssertTrue(ok)
 
-		// Just open in RDWR mode. This should not create a new log file.
+		// Just open in RDWR mode. This should not create a new log file. A read-only DB opens
+		// the files in RDONLY mode, as another process may be writing them.
 		lf.opt = vlog.opt
-		if err := lf.open(vlog.fpath(fid), os.O_RDWR,
-			2*vlog.opt.ValueLogFileSize); err != nil {
+		flags := os.O_RDWR
+		if vlog.opt.ReadOnly {
+			flags = os.O_RDONLY
+		}
+		if err := lf.open(vlog.fpath(fid), flags, 2*vlog.opt.ValueLogFileSize); err != nil {
 			return y.Wrapf(err, "Open existing file: %q", lf.path)
 		}
 		// We shouldn't delete the maxFid file.
-		if lf.size == vlogHeaderSize && fid != vlog.maxFid {
+		if lf.size == vlogHeaderSize && fid != vlog.maxFid && !vlog.opt.ReadOnly {
 			vlog.opt.Infof("Deleting empty file: %s", lf.path)
 			if err := lf.Delete(); err != nil {
 				return y.Wrapf(err, "while trying to delete empty file: %s", lf.path)
@@ -667,9 +686,19 @@ func (vlog *valueLog) sortedFids() []uint32 {
 	return ret
 }
 
+// syncMode overrides Options.SyncWrites for the writes of a request.
+type syncMode int8
+
+const (
+	syncDefault syncMode = iota // Follows Options.SyncWrites and Options.MaxSyncDelay.
+	syncAlways                  // Synced before it is acknowledged.
+	syncNever                   // Not synced, unless the writes of the same batch are.
+)
+
 type request struct {
 	// Input values
 	Entries []*Entry
+	sync    syncMode
 	// Output values and wait group stuff below
 	Ptrs []valuePointer
 	Wg   sync.WaitGroup
@@ -683,6 +712,7 @@ func (req *request) reset() {
 	req.Wg = sync.WaitGroup{}
 	req.Err = nil
 	req.ref = 0
+	req.sync = syncDefault
 }
 
 func (req *request) IncrRef() {
@@ -725,7 +755,7 @@ func (reqs requests) IncrRef() {
 // if fid >= vlog.maxFid. In some cases such as replay(while opening db), it might be called with
 // fid < vlog.maxFid. To sync irrespective of file id just call it with math.MaxUint32.
 func (vlog *valueLog) sync() error {
-	if vlog.opt.SyncWrites || vlog.opt.InMemory {
+	if vlog.opt.syncEachWrite() || vlog.opt.InMemory {
 		return nil
 	}
 
@@ -804,8 +834,10 @@ func (vlog *valueLog) write(reqs []*request) error {
 	curlf := vlog.filesMap[maxFid]
 	vlog.filesLock.RUnlock()
 
+	// The files rotated below are synced as well, since the WAL might point into them.
+	sync := vlog.db.needsSync(reqs)
 	defer func() {
-		if vlog.opt.SyncWrites {
+		if sync {
 			if err := curlf.Sync(); err != nil {
 				vlog.opt.Errorf("Error while curlf sync: %v\n", err)
 			}
@@ -834,7 +866,7 @@ func (vlog *valueLog) write(reqs []*request) error {
 	toDisk := func() error {
 		if vlog.woffset() > uint32(vlog.opt.ValueLogFileSize) ||
 			vlog.numEntriesWritten > vlog.opt.ValueLogMaxEntries {
-			if err := curlf.doneWriting(vlog.woffset()); err != nil {
+			if err := curlf.doneWriting(vlog.woffset(), sync); err != nil {
 				return err
 			}
 
@@ -872,14 +904,17 @@ func (vlog *valueLog) write(reqs []*request) error {
 			// GC will not be able to iterate on the entire vlog file.
 			// But, we still want the entry to stay intact for the memTable WAL. So, store the meta
 			// in a temporary variable and reassign it after writing to the value log.
-			tmpMeta := e.meta
-			e.meta = e.meta &^ (bitTxn | bitFinTxn)
+			// The compressed value is only stored in the value log file, so it is swapped in the
+			// same way.
+			tmpMeta, tmpValue := e.meta, e.Value
+			vs := vlog.db.compressValue(e.Key, y.ValueStruct{Value: e.Value, Meta: e.meta})
+			e.meta, e.Value = vs.Meta&^(bitTxn|bitFinTxn), vs.Value
 			plen, err := curlf.encodeEntry(buf, e, p.Offset) // Now encode the entry into buffer.
 			if err != nil {
 				return err
 			}
-			// Restore the meta.
-			e.meta = tmpMeta
+			// Restore the meta and the value.
+			e.meta, e.Value = tmpMeta, tmpValue
 
 			p.Len = uint32(plen)
 			b.Ptrs = append(b.Ptrs, p)
@@ -934,7 +969,12 @@ func (vlog *valueLog) getFileRLocked(vp valuePointer) (*logFile, error) {
 
 // Read reads the value log at a given location.
 // TODO: Make this read private.
-func (vlog *valueLog) Read(vp valuePointer, _ *y.Slice) ([]byte, func(), error) {
+func (vlog *valueLog) Read(vp valuePointer, s *y.Slice) ([]byte, func(), error) {
+	return vlog.read(vp, s, vlog.opt.VerifyValueChecksum)
+}
+
+// read is like Read, verifying the checksum of the entry if verify is set.
+func (vlog *valueLog) read(vp valuePointer, s *y.Slice, verify bool) ([]byte, func(), error) {
 	buf, lf, err := vlog.readValueBytes(vp)
 	// log file is locked so, decide whether to lock immediately or let the caller to
 	// unlock it, after caller uses it.
@@ -942,8 +982,15 @@ func (vlog *valueLog) Read(vp valuePointer, _ *y.Slice) ([]byte, func(), error)
 	if err != nil {
 		return nil, cb, err
 	}
+	// Unlock the log file if reading it faults. See catchFault.
+	defer func() {
+		if r := recover(); r != nil {
+			runCallback(cb)
+			panic(r)
+		}
+	}()
 
-	if vlog.opt.VerifyValueChecksum {
+	if verify {
 		hash := crc32.New(y.CastagnoliCrcTable)
 		if _, err := hash.Write(buf[:len(buf)-crc32.Size]); err != nil {
 			runCallback(cb)
@@ -953,7 +1000,9 @@ func (vlog *valueLog) Read(vp valuePointer, _ *y.Slice) ([]byte, func(), error)
 		checksum := buf[len(buf)-crc32.Size:]
 		if hash.Sum32() != y.BytesToU32(checksum) {
 			runCallback(cb)
-			return nil, nil, y.Wrapf(y.ErrChecksumMismatch, "value corrupted for vp: %+v", vp)
+			return nil, nil, y.Wrapf(&y.CorruptionError{
+				File: lf.path, Offset: int64(vp.Offset), Err: y.ErrChecksumMismatch,
+			}, "value corrupted for vp: %+v", vp)
 		}
 	}
 	var h header
@@ -970,9 +1019,45 @@ func (vlog *valueLog) Read(vp valuePointer, _ *y.Slice) ([]byte, func(), error)
 		return nil, nil, errors.Errorf("Invalid read: Len: %d read at:[%d:%d]",
 			len(kv), h.klen, h.klen+h.vlen)
 	}
+	if h.meta&bitCompressed > 0 {
+		// Decompress into s, so the log file can be unlocked right away.
+		val, err := decompressValue(vlog.db.dicts, s, kv[h.klen:h.klen+h.vlen])
+		runCallback(cb)
+		return val, nil, y.Wrapf(err, "while decompressing value at vp: %+v", vp)
+	}
 	return kv[h.klen : h.klen+h.vlen], cb, nil
 }
 
+// foldValue reads the value of key behind the value pointer vp, the value of vs, and returns it as
+// an inline value if it is below the value threshold, so that compactions can store it back in
+// the tables. It returns false if the value is too large or can't be read.
+func (db *DB) foldValue(key []byte, vs y.ValueStruct, vp valuePointer) (y.ValueStruct, bool) {
+	threshold := db.valueThreshold()
+	// The entry holds a header, the key and the checksum besides the value.
+	if int64(vp.Len)-int64(len(key))-crc32.Size-maxHeaderSize >= threshold {
+		return vs, false
+	}
+	val, cb, err := db.vlog.Read(vp, new(y.Slice))
+	defer runCallback(cb)
+	if err != nil {
+		db.opt.Debugf("Not folding the value of key %q: %v", key, err)
+		return vs, false
+	}
+	// Compressed values may be larger once decompressed.
+	if int64(len(val)) >= threshold {
+		return vs, false
+	}
+	// The value was decompressed by the read, if it was compressed in the value log.
+	folded := y.ValueStruct{
+		Value:     y.SafeCopy(nil, val),
+		Meta:      vs.Meta &^ (bitValuePointer | bitCompressed),
+		UserMeta:  vs.UserMeta,
+		ExpiresAt: vs.ExpiresAt,
+		Version:   vs.Version,
+	}
+	return db.compressValue(key, folded), true
+}
+
 // getUnlockCallback will returns a function which unlock the logfile if the logfile is mmaped.
 // otherwise, it unlock the logfile and return nil.
 func (vlog *valueLog) getUnlockCallback(lf *logFile) func() {
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"encoding/binary"
+
+	"github.com/dgraph-io/badger/v3/options"
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+)
+
+// minCompressedValueSize is the size below which the values aren't worth compressing.
+const minCompressedValueSize = 64
+
+// A compressed value is stored in the LSM tree as
+// +-------------------+------------------------+-----------------+
+// | codec (1 byte)    | value length (uvarint) | compressed data |
+// +-------------------+------------------------+-----------------+
+// with bitCompressed set in its meta. The codec is an options.CompressionType. The zstd frames
+// hold the ID of the dictionary they were compressed with, if any, so it isn't stored.
+//
+// The values are compressed where they are stored: bitCompressed is set in the meta of a value
+// stored inline in the LSM tree, or in the header of an entry of the value log. It is ignored in
+// the meta of a value pointer.
+
+// compressValue compresses the value of vs with Options.ValueCompression, and the dictionary of
+// the namespace of key if any. See compressValue.
+func (db *DB) compressValue(key []byte, vs y.ValueStruct) y.ValueStruct {
+	if db.opt.ValueCompression == options.None {
+		return vs
+	}
+	return compressValue(vs, db.opt.ValueCompression, db.dicts, db.dictID(y.ParseKey(key)))
+}
+
+// compressValue returns vs with its value compressed with the given codec, and the zstd dictionary
+// of the given ID if the codec is options.ZSTD and dictID isn't 0. It returns vs unchanged if the
+// value is a tombstone, too small, or doesn't get smaller.
+func compressValue(vs y.ValueStruct, codec options.CompressionType, dicts *y.ZSTDDicts,
+	dictID uint32) y.ValueStruct {
+	// The deltas are left alone, so that compactions can read their base version.
+	if codec == options.None || vs.Meta&(bitDelete|bitValuePointer|bitCompressed|bitDelta) != 0 ||
+		len(vs.Value) < minCompressedValueSize {
+		return vs
+	}
+	var hdr [1 + binary.MaxVarintLen64]byte
+	hdr[0] = byte(codec)
+	n := 1 + binary.PutUvarint(hdr[1:], uint64(len(vs.Value)))
+
+	var data []byte
+	switch codec {
+	case options.Snappy:
+		data = snappy.Encode(nil, vs.Value)
+	case options.ZSTD:
+		var err error
+		if data, err = dicts.Compress(nil, vs.Value, dictID); err != nil {
+			return vs
+		}
+	default:
+		return vs
+	}
+	if n+len(data) >= len(vs.Value) {
+		return vs
+	}
+	buf := make([]byte, n+len(data))
+	copy(buf, hdr[:n])
+	copy(buf[n:], data)
+	vs.Value = buf
+	vs.Meta |= bitCompressed
+	return vs
+}
+
+// decodeCompressedValue returns the codec, the uncompressed length and the compressed data of a
+// value stored with bitCompressed.
+func decodeCompressedValue(val []byte) (options.CompressionType, int, []byte, error) {
+	if len(val) < 2 {
+		return 0, 0, nil, errors.Errorf("compressed value too short: %d bytes", len(val))
+	}
+	sz, n := binary.Uvarint(val[1:])
+	if n <= 0 {
+		return 0, 0, nil, errors.New("invalid length of compressed value")
+	}
+	return options.CompressionType(val[0]), int(sz), val[1+n:], nil
+}
+
+// decompressValue decompresses a value stored with bitCompressed into dst, which is resized as
+// needed. The zstd frames carry the ID of their dictionary, which must be in dicts.
+func decompressValue(dicts *y.ZSTDDicts, dst *y.Slice, val []byte) ([]byte, error) {
+	codec, sz, data, err := decodeCompressedValue(val)
+	if err != nil {
+		return nil, err
+	}
+	out := dst.Resize(sz)
+	switch codec {
+	case options.Snappy:
+		out, err = snappy.Decode(out, data)
+	case options.ZSTD:
+		out, err = dicts.Decompress(out, data)
+	default:
+		return nil, errors.Errorf("unknown codec of compressed value: %d", codec)
+	}
+	if err != nil {
+		return nil, y.Wrapf(err, "while decompressing value")
+	}
+	if len(out) != sz {
+		return nil, errors.Errorf("decompressed value has %d bytes, expected %d", len(out), sz)
+	}
+	return out, nil
+}
+
+// uncompressedValueSize returns the size of a value stored with bitCompressed once decompressed.
+func uncompressedValueSize(val []byte) int {
+	_, sz, _, err := decodeCompressedValue(val)
+	if err != nil {
+		return len(val)
+	}
+	return sz
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3/options"
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressValue(t *testing.T) {
+	compressible := bytes.Repeat([]byte("badger"), 100)
+	random := make([]byte, 600)
+	rand.Read(random)
+	dicts := y.NewZSTDDicts(1)
+
+	for _, codec := range []options.CompressionType{options.Snappy, options.ZSTD} {
+		vs := compressValue(y.ValueStruct{Value: compressible, UserMeta: 3}, codec, dicts, 0)
+		require.Equal(t, bitCompressed, vs.Meta)
+		require.Equal(t, byte(3), vs.UserMeta)
+		require.Less(t, len(vs.Value), len(compressible))
+		require.Equal(t, len(compressible), uncompressedValueSize(vs.Value))
+		val, err := decompressValue(dicts, new(y.Slice), vs.Value)
+		require.NoError(t, err)
+		require.Equal(t, compressible, val)
+
+		// Values which don't get smaller, small values and tombstones are left alone.
+		for _, in := range []y.ValueStruct{
+			{Value: random},
+			{Value: compressible[:minCompressedValueSize-1]},
+			{Value: compressible, Meta: bitDelete},
+		} {
+			require.Equal(t, in, compressValue(in, codec, dicts, 0))
+		}
+	}
+	vs := y.ValueStruct{Value: compressible}
+	require.Equal(t, vs, compressValue(vs, options.None, dicts, 0))
+
+	_, err := decompressValue(dicts, new(y.Slice), []byte{9, 3, 1, 2, 3})
+	require.Error(t, err)
+}
+
+func TestValueCompression(t *testing.T) {
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%04d", i)) }
+	val := func(i int) []byte {
+		if i%10 == 0 {
+			return []byte("short")
+		}
+		return bytes.Repeat([]byte(fmt.Sprintf("value%04d", i)), 50)
+	}
+	check := func(t *testing.T, db *DB, compressed bool) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for i := 0; i < 500; i++ {
+				item, err := txn.Get(key(i))
+				require.NoError(t, err)
+				require.Equal(t, val(i), getItemValue(t, item))
+				require.Equal(t, int64(len(val(i))), item.ValueSize())
+				require.Equal(t, compressed && i%10 != 0, item.meta&bitCompressed > 0)
+			}
+			for _, prefetch := range []bool{false, true} {
+				opt := DefaultIteratorOptions
+				opt.PrefetchValues = prefetch
+				it := txn.NewIterator(opt)
+				i := 0
+				for it.Rewind(); it.Valid(); it.Next() {
+					v, err := it.Item().ValueCopy(nil)
+					require.NoError(t, err)
+					require.Equal(t, val(i), v)
+					i++
+				}
+				it.Close()
+				require.Equal(t, 500, i)
+			}
+			return nil
+		}))
+	}
+
+	for _, codec := range []options.CompressionType{options.Snappy, options.ZSTD} {
+		t.Run(fmt.Sprintf("codec=%d", codec), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "badger-test")
+			require.NoError(t, err)
+			defer removeDir(dir)
+			opt := getTestOptions(dir).WithValueThreshold(1 << 10).WithValueCompression(codec)
+			db, err := Open(opt)
+			require.NoError(t, err)
+			wb := db.NewWriteBatch()
+			for i := 0; i < 500; i++ {
+				require.NoError(t, wb.Set(key(i), val(i)))
+			}
+			require.NoError(t, wb.Flush())
+			check(t, db, true)
+
+			// The compressed values are replayed from the WAL.
+			require.NoError(t, db.Close())
+			db, err = Open(opt.WithValueCompression(options.None))
+			require.NoError(t, err)
+			check(t, db, true)
+
+			// And read back from the tables.
+			require.NoError(t, db.Close())
+			db, err = Open(opt)
+			require.NoError(t, err)
+			check(t, db, true)
+
+			// A backup holds the uncompressed values.
+			var buf bytes.Buffer
+			_, err = db.Backup(&buf, 0)
+			require.NoError(t, err)
+			require.NoError(t, db.Close())
+
+			dir2, err := ioutil.TempDir("", "badger-test")
+			require.NoError(t, err)
+			defer removeDir(dir2)
+			db2, err := Open(getTestOptions(dir2).WithValueThreshold(1 << 10))
+			require.NoError(t, err)
+			defer func() { require.NoError(t, db2.Close()) }()
+			require.NoError(t, db2.Load(&buf, 16))
+			check(t, db2, false)
+		})
+	}
+}
+
+func TestValueCompressionGC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer removeDir(dir)
+	opt := getTestOptions(dir).
+		WithValueLogFileSize(1 << 20).
+		WithBaseTableSize(1 << 15).
+		WithValueThreshold(1 << 10).
+		WithValueCompression(options.Snappy)
+
+	sz := 32 << 10
+	vals := make(map[string][]byte)
+	db, err := Open(opt)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		v := make([]byte, sz)
+		rand.Read(v[:sz/2])
+		key := fmt.Sprintf("key%d", i)
+		vals[key] = v
+		txnSet(t, db, []byte(key), v, 0)
+	}
+	for i := 0; i < 45; i++ {
+		key := fmt.Sprintf("key%d", i)
+		delete(vals, key)
+		txnDelete(t, db, []byte(key))
+	}
+	check := func(inline bool) {
+		require.NoError(t, db.View(func(txn *Txn) error {
+			for key, val := range vals {
+				item, err := txn.Get([]byte(key))
+				require.NoError(t, err)
+				require.Equal(t, val, getItemValue(t, item))
+				require.Equal(t, inline, item.meta&bitValuePointer == 0)
+			}
+			return nil
+		}))
+	}
+	rewriteOldest := func() {
+		db.vlog.filesLock.RLock()
+		lf := db.vlog.filesMap[db.vlog.sortedFids()[0]]
+		db.vlog.filesLock.RUnlock()
+		require.NoError(t, db.vlog.rewrite(lf))
+	}
+
+	// The compressed entries are moved to a new value log file as they are.
+	rewriteOldest()
+	check(false)
+
+	// And inline in the LSM tree if they are below the value threshold.
+	require.NoError(t, db.Close())
+	db, err = Open(opt.WithValueThreshold(1 << 16))
+	require.NoError(t, err)
+	rewriteOldest()
+	check(true)
+	require.NoError(t, db.Close())
+}
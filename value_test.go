@@ -522,6 +522,8 @@ func TestPersistLFDiscardStats(t *testing.T) {
 	}
 
 	time.Sleep(2 * time.Second) // wait for compaction to complete
+	// Compactions update the discard stats, stop them so that they don't block on the lock below.
+	db.stopCompactions()
 
 	persistedMap := make(map[uint64]uint64)
 	db.vlog.discardStats.Lock()
@@ -529,6 +531,7 @@ func TestPersistLFDiscardStats(t *testing.T) {
 	db.vlog.discardStats.Iterate(func(fid, val uint64) {
 		persistedMap[fid] = val
 	})
+	db.vlog.discardStats.Unlock()
 
 	require.NoError(t, db.Close())
 
@@ -1271,3 +1274,53 @@ func TestFirstVlogFile(t *testing.T) {
 	require.NotZero(t, len(fids))
 	require.Equal(t, uint32(1), fids[0])
 }
+
+func TestValueFolding(t *testing.T) {
+	for _, folding := range []bool{false, true} {
+		t.Run(fmt.Sprintf("folding=%v", folding), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "badger-test")
+			require.NoError(t, err)
+			defer removeDir(dir)
+
+			opt := getTestOptions(dir).WithValueThreshold(32)
+			db, err := Open(opt)
+			require.NoError(t, err)
+			key := func(i int) []byte { return []byte(fmt.Sprintf("key%03d", i)) }
+			val := func(i int) []byte { return []byte(fmt.Sprintf("val%061d", i)) }
+			for i := 0; i < 100; i++ {
+				txnSet(t, db, key(i), val(i), 0)
+			}
+			require.NoError(t, db.Close())
+
+			// Raise the threshold, the values in the value log are below it now.
+			db, err = Open(opt.WithValueThreshold(1 << 10).WithValueFolding(folding))
+			require.NoError(t, err)
+			defer db.Close()
+			require.NotZero(t, db.lc.levels[0].numTables())
+			require.NoError(t, db.lc.doCompact(-1,
+				compactionPriority{level: 0, t: db.lc.levelTargets()}))
+
+			require.NoError(t, db.View(func(txn *Txn) error {
+				for i := 0; i < 100; i++ {
+					item, err := txn.Get(key(i))
+					require.NoError(t, err)
+					require.Equal(t, val(i), getItemValue(t, item))
+					require.Equal(t, !folding, item.meta&bitValuePointer > 0)
+				}
+				return nil
+			}))
+
+			db.vlog.discardStats.Lock()
+			defer db.vlog.discardStats.Unlock()
+			var discard uint64
+			db.vlog.discardStats.Iterate(func(fid, stats uint64) {
+				discard += stats
+			})
+			if folding {
+				require.NotZero(t, discard)
+			} else {
+				require.Zero(t, discard)
+			}
+		})
+	}
+}
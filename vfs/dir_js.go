@@ -0,0 +1,73 @@
+// +build js
+
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dgraph-io/badger/v3/y"
+)
+
+// directoryLockGuard holds the pid file of a directory. JavaScript runtimes don't provide file
+// locks, and a single runtime is expected to use the directory.
+type directoryLockGuard struct {
+	// The absolute path to our pid file.
+	path string
+}
+
+// acquireDirectoryLock writes our pid to dirPath/pidFileName for convenience. The directory isn't
+// locked.
+func acquireDirectoryLock(dirPath string, pidFileName string, readOnly bool) (
+	*directoryLockGuard, error) {
+	if readOnly {
+		return &directoryLockGuard{}, nil
+	}
+	// Convert to absolute path so that Close still works even if we do an unbalanced
+	// chdir in the meantime.
+	absPidFilePath, err := filepath.Abs(filepath.Join(dirPath, pidFileName))
+	if err != nil {
+		return nil, y.Wrap(err, "cannot get absolute path for pid lock file")
+	}
+	data := []byte(fmt.Sprintf("%d\n", os.Getpid()))
+	if err := WriteFile(OS, absPidFilePath, data, 0666); err != nil {
+		return nil, y.Wrapf(err, "could not write pid")
+	}
+	return &directoryLockGuard{absPidFilePath}, nil
+}
+
+// Close deletes the pid file.
+func (guard *directoryLockGuard) Close() error {
+	if guard.path == "" {
+		return nil
+	}
+	err := os.Remove(guard.path)
+	guard.path = ""
+	return err
+}
+
+// isOutOfMemory returns true if err is the error returned by mmap when the address space is full.
+// Memory maps are emulated in JavaScript runtimes, so they fail like any other allocation.
+func isOutOfMemory(err error) bool {
+	return false
+}
+
+// JavaScript runtimes don't support syncing directories.
+func syncDir(dir string) error { return nil }
@@ -14,7 +14,7 @@
  * limitations under the License.
  */
 
-package badger
+package vfs
 
 import (
 	"fmt"
@@ -43,7 +43,7 @@ func acquireDirectoryLock(dirPath string, pidFileName string, readOnly bool) (
 		return nil, ErrPlan9NotSupported
 	}
 
-	// Convert to absolute path so that Release still works even if we do an unbalanced
+	// Convert to absolute path so that Close still works even if we do an unbalanced
 	// chdir in the meantime.
 	absPidFilePath, err := filepath.Abs(filepath.Join(dirPath, pidFileName))
 	if err != nil {
@@ -86,8 +86,8 @@ func acquireDirectoryLock(dirPath string, pidFileName string, readOnly bool) (
 	return &directoryLockGuard{f, absPidFilePath}, nil
 }
 
-// Release deletes the pid file and releases our lock on the directory.
-func (guard *directoryLockGuard) release() error {
+// Close deletes the pid file and releases our lock on the directory.
+func (guard *directoryLockGuard) Close() error {
 	// It's important that we remove the pid file first.
 	err := os.Remove(guard.path)
 
@@ -100,6 +100,12 @@ func (guard *directoryLockGuard) release() error {
 	return err
 }
 
+// isOutOfMemory returns true if err is the error returned by mmap when the address space is full.
+// Memory maps are emulated on Plan 9, so they fail like any other allocation.
+func isOutOfMemory(err error) bool {
+	return false
+}
+
 // openDir opens a directory for syncing.
 func openDir(path string) (*os.File, error) { return os.Open(path) }
 
@@ -1,4 +1,4 @@
-// +build !windows,!plan9
+// +build !windows,!plan9,!js
 
 /*
  * Copyright 2017 Dgraph Labs, Inc. and Contributors
@@ -16,7 +16,7 @@
  * limitations under the License.
  */
 
-package badger
+package vfs
 
 import (
 	"fmt"
@@ -44,7 +44,7 @@ type directoryLockGuard struct {
 // dirPath/pidFileName for convenience.
 func acquireDirectoryLock(dirPath string, pidFileName string, readOnly bool) (
 	*directoryLockGuard, error) {
-	// Convert to absolute path so that Release still works even if we do an unbalanced
+	// Convert to absolute path so that Close still works even if we do an unbalanced
 	// chdir in the meantime.
 	absPidFilePath, err := filepath.Abs(filepath.Join(dirPath, pidFileName))
 	if err != nil {
@@ -80,8 +80,8 @@ func acquireDirectoryLock(dirPath string, pidFileName string, readOnly bool) (
 	return &directoryLockGuard{f, absPidFilePath, readOnly}, nil
 }
 
-// Release deletes the pid file and releases our lock on the directory.
-func (guard *directoryLockGuard) release() error {
+// Close deletes the pid file and releases our lock on the directory.
+func (guard *directoryLockGuard) Close() error {
 	var err error
 	if !guard.readOnly {
 		// It's important that we remove the pid file first.
@@ -97,6 +97,11 @@ func (guard *directoryLockGuard) release() error {
 	return err
 }
 
+// isOutOfMemory returns true if err is the error returned by mmap when the address space is full.
+func isOutOfMemory(err error) bool {
+	return err == unix.ENOMEM
+}
+
 // openDir opens a directory for syncing.
 func openDir(path string) (*os.File, error) { return os.Open(path) }
 
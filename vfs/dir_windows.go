@@ -16,7 +16,7 @@
  * limitations under the License.
  */
 
-package badger
+package vfs
 
 // OpenDir opens a directory in windows with write access for syncing.
 import (
@@ -72,7 +72,7 @@ func acquireDirectoryLock(dirPath string, pidFileName string, readOnly bool) (*d
 		return nil, ErrWindowsNotSupported
 	}
 
-	// Convert to absolute path so that Release still works even if we do an unbalanced
+	// Convert to absolute path so that Close still works even if we do an unbalanced
 	// chdir in the meantime.
 	absLockFilePath, err := filepath.Abs(filepath.Join(dirPath, pidFileName))
 	if err != nil {
@@ -99,12 +99,21 @@ func acquireDirectoryLock(dirPath string, pidFileName string, readOnly bool) (*d
 	return &directoryLockGuard{h: h, path: absLockFilePath}, nil
 }
 
-// Release removes the directory lock.
-func (g *directoryLockGuard) release() error {
+// Close removes the directory lock.
+func (g *directoryLockGuard) Close() error {
 	g.path = ""
 	return syscall.CloseHandle(g.h)
 }
 
+// isOutOfMemory returns true if err is the error returned by MapViewOfFile when the address space
+// is full.
+func isOutOfMemory(err error) bool {
+	return err == syscall.Errno(errorNotEnoughMemory)
+}
+
+// ERROR_NOT_ENOUGH_MEMORY, which isn't defined by the syscall package.
+const errorNotEnoughMemory = 8
+
 // Windows doesn't support syncing directories to the file system. See
 // https://github.com/dgraph-io/badger/issues/699#issuecomment-504133587 for more details.
 func syncDir(dir string) error { return nil }
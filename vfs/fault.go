@@ -0,0 +1,159 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vfs
+
+import (
+	"io"
+	"os"
+
+	"github.com/dgraph-io/ristretto/z"
+)
+
+// FaultFS wraps an FS to inject errors into its operations, to test how they are handled.
+type FaultFS struct {
+	FS
+	// Inject is called before each operation with the name of the method, like "OpenFile", "Write"
+	// or "Sync", and the path of the file. The operation fails with the returned error instead of
+	// running if it isn't nil. The reads and writes of memory-mapped files can't be intercepted.
+	Inject func(op, path string) error
+}
+
+var _ FS = (*FaultFS)(nil)
+
+// OpenFile implements FS.
+func (f *FaultFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if err := f.Inject("OpenFile", name); err != nil {
+		return nil, err
+	}
+	file, err := f.FS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: file, inject: f.Inject}, nil
+}
+
+// OpenMmapFile implements FS.
+func (f *FaultFS) OpenMmapFile(name string, flag int, maxSz int) (*z.MmapFile, error) {
+	if err := f.Inject("OpenMmapFile", name); err != nil {
+		return nil, err
+	}
+	return f.FS.OpenMmapFile(name, flag, maxSz)
+}
+
+// Remove implements FS.
+func (f *FaultFS) Remove(name string) error {
+	if err := f.Inject("Remove", name); err != nil {
+		return err
+	}
+	return f.FS.Remove(name)
+}
+
+// RemoveAll implements FS.
+func (f *FaultFS) RemoveAll(path string) error {
+	if err := f.Inject("RemoveAll", path); err != nil {
+		return err
+	}
+	return f.FS.RemoveAll(path)
+}
+
+// Rename implements FS. The path passed to Inject is oldpath.
+func (f *FaultFS) Rename(oldpath, newpath string) error {
+	if err := f.Inject("Rename", oldpath); err != nil {
+		return err
+	}
+	return f.FS.Rename(oldpath, newpath)
+}
+
+// MkdirAll implements FS.
+func (f *FaultFS) MkdirAll(path string, perm os.FileMode) error {
+	if err := f.Inject("MkdirAll", path); err != nil {
+		return err
+	}
+	return f.FS.MkdirAll(path, perm)
+}
+
+// ReadDir implements FS.
+func (f *FaultFS) ReadDir(dir string) ([]os.FileInfo, error) {
+	if err := f.Inject("ReadDir", dir); err != nil {
+		return nil, err
+	}
+	return f.FS.ReadDir(dir)
+}
+
+// Stat implements FS.
+func (f *FaultFS) Stat(name string) (os.FileInfo, error) {
+	if err := f.Inject("Stat", name); err != nil {
+		return nil, err
+	}
+	return f.FS.Stat(name)
+}
+
+// SyncDir implements FS.
+func (f *FaultFS) SyncDir(dir string) error {
+	if err := f.Inject("SyncDir", dir); err != nil {
+		return err
+	}
+	return f.FS.SyncDir(dir)
+}
+
+// Lock implements FS.
+func (f *FaultFS) Lock(dir string, pidFileName string, readOnly bool) (io.Closer, error) {
+	if err := f.Inject("Lock", dir); err != nil {
+		return nil, err
+	}
+	return f.FS.Lock(dir, pidFileName, readOnly)
+}
+
+type faultFile struct {
+	File
+	inject func(op, path string) error
+}
+
+func (f *faultFile) Read(p []byte) (int, error) {
+	if err := f.inject("Read", f.Name()); err != nil {
+		return 0, err
+	}
+	return f.File.Read(p)
+}
+
+func (f *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.inject("ReadAt", f.Name()); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	if err := f.inject("Write", f.Name()); err != nil {
+		return 0, err
+	}
+	return f.File.Write(p)
+}
+
+func (f *faultFile) Sync() error {
+	if err := f.inject("Sync", f.Name()); err != nil {
+		return err
+	}
+	return f.File.Sync()
+}
+
+func (f *faultFile) Truncate(size int64) error {
+	if err := f.inject("Truncate", f.Name()); err != nil {
+		return err
+	}
+	return f.File.Truncate(size)
+}
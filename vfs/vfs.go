@@ -0,0 +1,144 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package vfs defines FS, the interface through which Badger accesses the filesystem, and OS, its
+// implementation on top of the filesystem of the operating system. Wrapping OS, like FaultFS does,
+// allows tests to inject I/O errors into a DB, or a DB to run on an alternative backend without
+// forking Badger.
+package vfs
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/dgraph-io/badger/v3/y"
+	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrWindowsNotSupported is returned by OS.Lock when a shared lock is requested on Windows.
+	ErrWindowsNotSupported = errors.New("Read-only mode is not supported on Windows")
+
+	// ErrPlan9NotSupported is returned by OS.Lock when a shared lock is requested on Plan 9.
+	ErrPlan9NotSupported = errors.New("Read-only mode is not supported on Plan 9")
+)
+
+// File is an open file. *os.File implements it.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Seeker
+	io.Closer
+	Name() string
+	Stat() (os.FileInfo, error)
+	Sync() error
+	Truncate(size int64) error
+}
+
+// FS is a filesystem. The paths use the separator of the operating system, like the ones of the
+// os package.
+type FS interface {
+	// OpenFile opens a file like os.OpenFile.
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	// OpenMmapFile opens a file and maps it in memory like z.OpenMmapFile. It returns z.NewFile
+	// along with the file if the file was created. The returned file is synced, truncated, closed
+	// and deleted by z.MmapFile through its Fd, so it must be backed by a file of the operating
+	// system.
+	OpenMmapFile(name string, flag int, maxSz int) (*z.MmapFile, error)
+	// Remove removes a file or an empty directory like os.Remove.
+	Remove(name string) error
+	// RemoveAll removes a path and its children like os.RemoveAll.
+	RemoveAll(path string) error
+	// Rename renames a file like os.Rename, replacing newpath if it exists.
+	Rename(oldpath, newpath string) error
+	// MkdirAll creates a directory and its parents like os.MkdirAll.
+	MkdirAll(path string, perm os.FileMode) error
+	// ReadDir lists a directory like ioutil.ReadDir.
+	ReadDir(dir string) ([]os.FileInfo, error)
+	// Stat describes a file like os.Stat.
+	Stat(name string) (os.FileInfo, error)
+	// SyncDir makes the creations, renames and removals of the files in dir durable.
+	SyncDir(dir string) error
+	// Lock locks dir for the exclusive use of the caller, or shared use if readOnly is set, and
+	// writes the pid of the process to pidFileName in dir if readOnly isn't set. It returns an
+	// error if dir is locked by another process. Closing the returned Closer releases the lock.
+	Lock(dir string, pidFileName string, readOnly bool) (io.Closer, error)
+}
+
+// OS is the FS of the operating system.
+var OS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		// Don't return a nil *os.File in a non-nil File.
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) OpenMmapFile(name string, flag int, maxSz int) (*z.MmapFile, error) {
+	mf, err := z.OpenMmapFile(name, flag, maxSz)
+	if y.Is32Bit && isOutOfMemory(errors.Cause(err)) {
+		err = errors.Wrapf(err, "out of address space, which is small on 32-bit platforms. Lower "+
+			"the sizes in the Options of the DB, or open fewer DBs")
+	}
+	return mf, err
+}
+
+func (osFS) Remove(name string) error                     { return os.Remove(name) }
+func (osFS) RemoveAll(path string) error                  { return os.RemoveAll(path) }
+func (osFS) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (osFS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+func (osFS) ReadDir(dir string) ([]os.FileInfo, error)    { return ioutil.ReadDir(dir) }
+func (osFS) Stat(name string) (os.FileInfo, error)        { return os.Stat(name) }
+func (osFS) SyncDir(dir string) error                     { return syncDir(dir) }
+
+func (osFS) Lock(dir string, pidFileName string, readOnly bool) (io.Closer, error) {
+	guard, err := acquireDirectoryLock(dir, pidFileName, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return guard, nil
+}
+
+// ReadFile reads a whole file from fs like ioutil.ReadFile.
+func ReadFile(fs FS, name string) ([]byte, error) {
+	f, err := fs.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// WriteFile writes a whole file to fs like ioutil.WriteFile.
+func WriteFile(fs FS, name string, data []byte, perm os.FileMode) error {
+	f, err := fs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
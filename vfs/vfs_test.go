@@ -0,0 +1,128 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vfs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/vfs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOSLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := vfs.OS.Lock(dir, "LOCK", false)
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		// Windows only allows one handle on the lock file, even in the same process.
+		_, err = vfs.OS.Lock(dir, "LOCK", false)
+		require.Error(t, err)
+	}
+	require.NoError(t, l.Close())
+	l, err = vfs.OS.Lock(dir, "LOCK", false)
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+}
+
+func TestReadWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "file")
+	require.NoError(t, vfs.WriteFile(vfs.OS, name, []byte("hello"), 0600))
+	require.NoError(t, vfs.WriteFile(vfs.OS, name, []byte("bye"), 0600))
+	data, err := vfs.ReadFile(vfs.OS, name)
+	require.NoError(t, err)
+	require.Equal(t, "bye", string(data))
+
+	_, err = vfs.ReadFile(vfs.OS, filepath.Join(dir, "missing"))
+	require.True(t, os.IsNotExist(err))
+}
+
+// TestFaultFS checks that the DB accesses its files through Options.FS, and that the injected
+// faults are returned.
+func TestFaultFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	ops := make(map[string]bool)
+	var fail string
+	fs := &vfs.FaultFS{FS: vfs.OS, Inject: func(op, path string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ops[op+" "+filepath.Base(path)] = true
+		if op+" "+filepath.Base(path) == fail {
+			return errors.New("injected fault")
+		}
+		return nil
+	}}
+	opt := badger.DefaultOptions(dir).WithFS(fs).WithLogger(nil)
+
+	db, err := badger.Open(opt)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("key"), []byte("val"))
+	}))
+	require.NoError(t, db.Close())
+	for _, op := range []string{"Lock " + filepath.Base(dir), "OpenFile MANIFEST",
+		"Sync MANIFEST", "OpenFile KEYREGISTRY", "OpenMmapFile 00001.mem",
+		"OpenMmapFile 000001.vlog", "OpenMmapFile 000001.sst.tmp", "Rename 000001.sst.tmp",
+		"SyncDir " + filepath.Base(dir)} {
+		require.True(t, ops[op], "%s not run through FS", op)
+	}
+
+	// A fault while creating the MANIFEST of a new DB fails Open.
+	dir2, err := ioutil.TempDir("", "vfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir2)
+	mu.Lock()
+	fail = "Sync MANIFEST-REWRITE"
+	mu.Unlock()
+	_, err = badger.Open(opt.WithDir(dir2).WithValueDir(dir2))
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "injected fault"), "%v", err)
+
+	// The directory lock was released, so the DB can be opened once the fault is gone.
+	mu.Lock()
+	fail = ""
+	mu.Unlock()
+	db, err = badger.Open(opt.WithDir(dir2).WithValueDir(dir2))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	db, err = badger.Open(opt)
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte("key"))
+		return err
+	}))
+}
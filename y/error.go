@@ -63,13 +63,14 @@ func AssertTruef(b bool, format string, args ...interface{}) {
 	}
 }
 
-// Wrap wraps errors from external lib.
+// Wrap wraps errors from external lib. The wrapped error is returned by errors.Cause, and matched
+// by errors.Is and errors.As.
 func Wrap(err error, msg string) error {
 	if !debugMode {
 		if err == nil {
 			return nil
 		}
-		return fmt.Errorf("%s err: %+v", msg, err)
+		return &wrappedError{msg: fmt.Sprintf("%s err: %+v", msg, err), err: err}
 	}
 	return errors.Wrap(err, msg)
 }
@@ -80,7 +81,39 @@ func Wrapf(err error, format string, args ...interface{}) error {
 		if err == nil {
 			return nil
 		}
-		return fmt.Errorf(format+" error: %+v", append(args, err)...)
+		return &wrappedError{msg: fmt.Sprintf(format+" error: %+v", append(args, err)...), err: err}
 	}
 	return errors.Wrapf(err, format, args...)
 }
+
+// wrappedError is an error returned by Wrap and Wrapf, without the stack trace.
+type wrappedError struct {
+	msg string
+	err error
+}
+
+func (e *wrappedError) Error() string { return e.msg }
+
+// Cause returns the wrapped error, for errors.Cause.
+func (e *wrappedError) Cause() error { return e.err }
+
+// Unwrap returns the wrapped error, for errors.Is and errors.As.
+func (e *wrappedError) Unwrap() error { return e.err }
+
+// CorruptionError is the error returned when the data read from a file doesn't match its checksum,
+// or can't be decoded.
+type CorruptionError struct {
+	File   string
+	Offset int64
+	Err    error // The error reported by the check, e.g. ErrChecksumMismatch.
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("corrupted data in %s at offset %d: %v", e.File, e.Offset, e.Err)
+}
+
+// Cause returns the error reported by the check, for errors.Cause.
+func (e *CorruptionError) Cause() error { return e.Err }
+
+// Unwrap returns the error reported by the check, for errors.Is and errors.As.
+func (e *CorruptionError) Unwrap() error { return e.Err }
@@ -64,6 +64,16 @@ var (
 	CastagnoliCrcTable = crc32.MakeTable(crc32.Castagnoli)
 )
 
+// Is32Bit is true on the platforms with a 32-bit address space, like 386, arm and mips. The memory
+// maps of the DB must fit in their 2-3GB of user address space.
+const Is32Bit = strconv.IntSize == 32
+
+// DatasyncFlag returns the flag of os.OpenFile making writes synchronous, O_DSYNC, on the platforms
+// supporting it, and zero elsewhere.
+func DatasyncFlag() int {
+	return datasyncFileFlag
+}
+
 // OpenExistingFile opens an existing file, errors if it doesn't exist.
 func OpenExistingFile(filename string, flags Flags) (*os.File, error) {
 	openFlags := os.O_RDWR
@@ -11,6 +11,7 @@ import (
 
 	"github.com/dgraph-io/badger/v3/pb"
 	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -304,3 +305,10 @@ func TestAllocatorReuse(t *testing.T) {
 	}
 	t.Logf("Allocator: %s\n", a)
 }
+
+func TestWrapCause(t *testing.T) {
+	err := Wrapf(Wrap(ErrChecksumMismatch, "reading block"), "reading table %d", 1)
+	require.Equal(t, ErrChecksumMismatch, errors.Cause(err))
+	require.Contains(t, err.Error(), "reading table 1 error: reading block err: checksum mismatch")
+	require.Nil(t, Wrap(nil, "nothing"))
+}
@@ -0,0 +1,408 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/huff0"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+const (
+	// zstdDictMagic starts a dictionary in the format of the zstd specification.
+	zstdDictMagic = 0xEC30A437
+	// Dictionary contents are made of segments of dictSegmentLen bytes, scored by the number of
+	// samples containing each of their dictDmerLen byte substrings.
+	dictSegmentLen = 32
+	dictDmerLen    = 8
+	// MinZSTDDictSamples is the number of samples below which TrainZSTDDict fails.
+	MinZSTDDictSamples = 8
+)
+
+// The normalized distributions of the codes predefined by zstd, written in the entropy tables of
+// the dictionaries. See RFC 8878, section 3.1.1.3.2.2.
+var (
+	zstdOffsetCodeNorm = []int16{1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, -1, -1, -1, -1, -1}
+	zstdMatchLengthNorm = []int16{1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+		-1, -1}
+	zstdLiteralLengthNorm = []int16{4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 2, 2, 2, 2, 2,
+		2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1, -1, -1, -1, -1}
+)
+
+// TrainZSTDDict trains a zstd dictionary of at most maxSize bytes over samples, and returns it in
+// the format of the zstd specification, with the given non-zero ID. Like the COVER algorithm of
+// zstd, it fills the dictionary with the segments of the samples made of the substrings common to
+// the most samples. It returns an error if there are fewer than MinZSTDDictSamples samples, or if
+// they have nothing in common.
+func TrainZSTDDict(id uint32, samples [][]byte, maxSize int) ([]byte, error) {
+	if id == 0 {
+		return nil, errors.New("zstd dictionaries can't have ID 0")
+	}
+	if len(samples) < MinZSTDDictSamples {
+		return nil, errors.Errorf("%d samples aren't enough to train a zstd dictionary, need %d",
+			len(samples), MinZSTDDictSamples)
+	}
+
+	// Count the samples containing each dmer.
+	freq := make(map[uint64]int)
+	seen := make(map[uint64]struct{})
+	for _, s := range samples {
+		for k := range seen {
+			delete(seen, k)
+		}
+		for i := 0; i+dictDmerLen <= len(s); i++ {
+			dmer := binary.LittleEndian.Uint64(s[i:])
+			if _, ok := seen[dmer]; !ok {
+				seen[dmer] = struct{}{}
+				freq[dmer]++
+			}
+		}
+	}
+	// A dmer seen in a single sample doesn't help compressing the others.
+	for dmer, n := range freq {
+		if n < 2 {
+			delete(freq, dmer)
+		}
+	}
+
+	// Like COVER, split the samples into epochs and pick the best segment of each, so that the
+	// dictionary covers all of them in a single pass.
+	epochs := maxSize / dictSegmentLen
+	if epochs > len(samples) {
+		epochs = len(samples)
+	}
+	if epochs == 0 {
+		epochs = 1
+	}
+	perEpoch := (len(samples) + epochs - 1) / epochs
+	var segments []dictSegment
+	for i := 0; i < len(samples); i += perEpoch {
+		end := i + perEpoch
+		if end > len(samples) {
+			end = len(samples)
+		}
+		best := bestDictSegment(samples[i:end], freq)
+		if best.score == 0 {
+			continue
+		}
+		// Forget the dmers of the segment, so that the next segments bring new content.
+		for j := 0; j+dictDmerLen <= len(best.data); j++ {
+			delete(freq, binary.LittleEndian.Uint64(best.data[j:]))
+		}
+		segments = append(segments, best)
+	}
+	if len(segments) == 0 {
+		return nil, errors.New("the samples have nothing in common to train a zstd dictionary")
+	}
+
+	// zstd reaches the end of the content with the smallest offsets, so the best segments go last.
+	sort.SliceStable(segments, func(i, j int) bool { return segments[i].score < segments[j].score })
+	if n := len(segments) * dictSegmentLen; n > maxSize {
+		segments = segments[len(segments)-maxSize/dictSegmentLen:]
+	}
+	var content []byte
+	for _, s := range segments {
+		content = append(content, s.data...)
+	}
+	if len(content) > maxSize {
+		content = content[len(content)-maxSize:]
+	}
+	for len(content) < 8 {
+		// The repeat offsets below must fit in the content.
+		content = append([]byte{0}, content...)
+	}
+
+	// The literals table is built over the samples, up to the size of a block, along with every
+	// byte value so that any literal can be encoded with it.
+	var lits []byte
+	for b := 0; b < 256; b++ {
+		lits = append(lits, byte(b))
+	}
+	for _, s := range samples {
+		if n := huff0.BlockSizeMax - len(lits); len(s) > n {
+			lits = append(lits, s[:n]...)
+			break
+		}
+		lits = append(lits, s...)
+	}
+	var scratch huff0.Scratch
+	if _, _, err := huff0.Compress1X(lits, &scratch); err != nil {
+		return nil, errors.Wrapf(err, "while building the literals table of a zstd dictionary")
+	}
+
+	dict := make([]byte, 8, 8+len(scratch.OutTable)+64+12+len(content))
+	binary.LittleEndian.PutUint32(dict, zstdDictMagic)
+	binary.LittleEndian.PutUint32(dict[4:], id)
+	dict = append(dict, scratch.OutTable...)
+	dict = appendNCount(dict, zstdOffsetCodeNorm, 5)
+	dict = appendNCount(dict, zstdMatchLengthNorm, 6)
+	dict = appendNCount(dict, zstdLiteralLengthNorm, 6)
+	for _, rep := range []uint32{1, 4, 8} {
+		dict = append(dict, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(dict[len(dict)-4:], rep)
+	}
+	return append(dict, content...), nil
+}
+
+type dictSegment struct {
+	data  []byte
+	score int
+}
+
+// bestDictSegment returns the segment of samples with the highest sum of the frequencies of its
+// dmers.
+func bestDictSegment(samples [][]byte, freq map[uint64]int) dictSegment {
+	var best dictSegment
+	var scores []int
+	for _, s := range samples {
+		if len(s) < dictDmerLen {
+			continue
+		}
+		scores = scores[:0]
+		for j := 0; j+dictDmerLen <= len(s); j++ {
+			scores = append(scores, freq[binary.LittleEndian.Uint64(s[j:])])
+		}
+		// Slide a window of the dmers of a segment over the sample.
+		window := dictSegmentLen - dictDmerLen + 1
+		score := 0
+		for j, sc := range scores {
+			score += sc
+			if j >= window {
+				score -= scores[j-window]
+			}
+			if score > best.score {
+				start := j + 1 - window
+				if start < 0 {
+					start = 0
+				}
+				best = dictSegment{data: s[start : j+dictDmerLen], score: score}
+			}
+		}
+	}
+	return best
+}
+
+// appendNCount appends the normalized distribution norm of an FSE table in the format of the zstd
+// specification. It is a port of FSE_writeNCount of the reference implementation.
+func appendNCount(dst []byte, norm []int16, tableLog uint) []byte {
+	tableSize := 1 << tableLog
+	remaining := tableSize + 1
+	threshold := tableSize
+	nbBits := tableLog + 1
+	bitStream := uint32(tableLog - 5)
+	bitCount := uint(4)
+	previous0 := false
+	flush := func() {
+		dst = append(dst, byte(bitStream), byte(bitStream>>8))
+		bitStream >>= 16
+		bitCount -= 16
+	}
+	for symbol := 0; symbol < len(norm) && remaining > 1; {
+		if previous0 {
+			start := symbol
+			for norm[symbol] == 0 {
+				symbol++
+			}
+			for symbol >= start+24 {
+				start += 24
+				bitStream += 0xFFFF << bitCount
+				bitCount += 16
+				flush()
+			}
+			for symbol >= start+3 {
+				start += 3
+				bitStream += 3 << bitCount
+				bitCount += 2
+			}
+			bitStream += uint32(symbol-start) << bitCount
+			bitCount += 2
+			if bitCount > 16 {
+				flush()
+			}
+		}
+		count := int(norm[symbol])
+		symbol++
+		max := 2*threshold - 1 - remaining
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		count++ // +1 for extra accuracy.
+		if count >= threshold {
+			count += max
+		}
+		bitStream += uint32(count) << bitCount
+		bitCount += nbBits
+		if count < max {
+			bitCount--
+		}
+		previous0 = count == 1
+		for remaining < threshold {
+			nbBits--
+			threshold >>= 1
+		}
+		if bitCount > 16 {
+			flush()
+		}
+	}
+	for i := uint(0); i < (bitCount+7)/8; i++ {
+		dst = append(dst, byte(bitStream>>(8*i)))
+	}
+	return dst
+}
+
+// ZSTDDictID returns the ID of a dictionary in the format of the zstd specification.
+func ZSTDDictID(dict []byte) (uint32, error) {
+	if len(dict) < 8 || binary.LittleEndian.Uint32(dict) != zstdDictMagic {
+		return 0, errors.New("not a zstd dictionary")
+	}
+	return binary.LittleEndian.Uint32(dict[4:]), nil
+}
+
+// ZSTDDicts is a set of zstd dictionaries. It compresses with the dictionary of a given ID, and
+// decompresses the frames compressed with any of its dictionaries, or without a dictionary. It is
+// safe for concurrent use.
+type ZSTDDicts struct {
+	level int
+
+	mu       sync.RWMutex
+	encoders map[uint32]*zstd.Encoder
+	dicts    [][]byte
+	decoder  *zstdDecoder
+}
+
+// zstdDecoder is a zstd decoder closed once it is replaced and no longer in use. A zstd decoder
+// runs goroutines until it is closed.
+type zstdDecoder struct {
+	*zstd.Decoder
+	refs int32 // One for being the decoder of the set, and one per decompression running.
+}
+
+func (dec *zstdDecoder) release() {
+	if atomic.AddInt32(&dec.refs, -1) == 0 {
+		dec.Close()
+	}
+}
+
+// NewZSTDDicts returns an empty set of dictionaries compressing at the given level.
+func NewZSTDDicts(level int) *ZSTDDicts {
+	return &ZSTDDicts{level: level, encoders: make(map[uint32]*zstd.Encoder)}
+}
+
+// Add adds a dictionary in the format of the zstd specification to the set. Adding a dictionary
+// with the ID of one in the set is a no-op.
+func (d *ZSTDDicts) Add(dict []byte) error {
+	id, err := ZSTDDictID(dict)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.encoders[id]; ok {
+		return nil
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderDict(dict),
+		zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(d.level)), zstd.WithEncoderCRC(false))
+	if err != nil {
+		return errors.Wrapf(err, "while loading zstd dictionary %d", id)
+	}
+	dicts := append(d.dicts[:len(d.dicts):len(d.dicts)], dict)
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderDicts(dicts...))
+	if err != nil {
+		enc.Close()
+		return errors.Wrapf(err, "while loading zstd dictionary %d", id)
+	}
+	// The previous decoder may still be in use, it gets closed by the last decompression.
+	if d.decoder != nil {
+		d.decoder.release()
+	}
+	d.encoders[id] = enc
+	d.dicts = dicts
+	d.decoder = &zstdDecoder{Decoder: dec, refs: 1}
+	return nil
+}
+
+// Close closes the encoders and the decoder of the set, stopping their goroutines. The set must
+// not be used afterwards.
+func (d *ZSTDDicts) Close() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, enc := range d.encoders {
+		enc.Close()
+		delete(d.encoders, id)
+	}
+	if d.decoder != nil {
+		d.decoder.release()
+		d.decoder = nil
+	}
+	d.dicts = nil
+}
+
+// Has returns true if the set holds the dictionary of the given ID.
+func (d *ZSTDDicts) Has(id uint32) bool {
+	if d == nil {
+		return false
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, ok := d.encoders[id]
+	return ok
+}
+
+// Compress compresses src into dst with the dictionary of the given ID, or without a dictionary
+// if id is 0 or the set doesn't hold it.
+func (d *ZSTDDicts) Compress(dst, src []byte, id uint32) ([]byte, error) {
+	if d == nil {
+		return ZSTDCompress(dst, src, 1)
+	}
+	d.mu.RLock()
+	enc, ok := d.encoders[id]
+	d.mu.RUnlock()
+	if !ok {
+		return ZSTDCompress(dst, src, d.level)
+	}
+	return enc.EncodeAll(src, dst[:0]), nil
+}
+
+// Decompress decompresses src into dst, with the dictionary it was compressed with if any.
+func (d *ZSTDDicts) Decompress(dst, src []byte) ([]byte, error) {
+	if d == nil {
+		return ZSTDDecompress(dst, src)
+	}
+	d.mu.RLock()
+	dec := d.decoder
+	if dec != nil {
+		atomic.AddInt32(&dec.refs, 1)
+	}
+	d.mu.RUnlock()
+	if dec == nil {
+		return ZSTDDecompress(dst, src)
+	}
+	defer dec.release()
+	return dec.DecodeAll(src, dst[:0])
+}
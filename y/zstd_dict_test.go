@@ -0,0 +1,123 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func jsonSample(r *rand.Rand) []byte {
+	return []byte(fmt.Sprintf(`{"id":%d,"name":"user-%d","email":"user%d@example.com",`+
+		`"active":%v,"roles":["reader","writer"],"created_at":"2021-%02d-%02dT10:%02d:00Z"}`,
+		r.Intn(1e6), r.Intn(1e4), r.Intn(1e4), r.Intn(2) == 0, 1+r.Intn(12), 1+r.Intn(28),
+		r.Intn(60)))
+}
+
+func TestTrainZSTDDict(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var samples [][]byte
+	// More samples than fit in a block of literals.
+	for i := 0; i < 2000; i++ {
+		samples = append(samples, jsonSample(r))
+	}
+	dict, err := TrainZSTDDict(7, samples, 4<<10)
+	require.NoError(t, err)
+	id, err := ZSTDDictID(dict)
+	require.NoError(t, err)
+	require.Equal(t, uint32(7), id)
+
+	dicts := NewZSTDDicts(1)
+	require.NoError(t, dicts.Add(dict))
+	require.True(t, dicts.Has(7))
+	require.False(t, dicts.Has(8))
+
+	var plain, withDict int
+	for i := 0; i < 100; i++ {
+		v := jsonSample(r)
+		c, err := ZSTDCompress(nil, v, 1)
+		require.NoError(t, err)
+		plain += len(c)
+		cd, err := dicts.Compress(nil, v, 7)
+		require.NoError(t, err)
+		withDict += len(cd)
+
+		// Frames with and without a dictionary are decompressed.
+		for _, in := range [][]byte{c, cd} {
+			out, err := dicts.Decompress(nil, in)
+			require.NoError(t, err)
+			require.Equal(t, v, out)
+		}
+	}
+	require.Less(t, withDict*2, plain, "plain: %d, with dictionary: %d", plain, withDict)
+
+	// A frame compressed with a dictionary missing from the set can't be decompressed.
+	cd, err := dicts.Compress(nil, jsonSample(r), 7)
+	require.NoError(t, err)
+	_, err = NewZSTDDicts(1).Decompress(nil, cd)
+	require.Error(t, err)
+}
+
+func TestZSTDDictsClose(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var samples [][]byte
+	for i := 0; i < 100; i++ {
+		samples = append(samples, jsonSample(r))
+	}
+	before := runtime.NumGoroutine()
+
+	dicts := NewZSTDDicts(1)
+	for id := uint32(1); id <= 3; id++ {
+		dict, err := TrainZSTDDict(id, samples, 4<<10)
+		require.NoError(t, err)
+		require.NoError(t, dicts.Add(dict))
+		cd, err := dicts.Compress(nil, samples[0], id)
+		require.NoError(t, err)
+		out, err := dicts.Decompress(nil, cd)
+		require.NoError(t, err)
+		require.Equal(t, samples[0], out)
+	}
+	dicts.Close()
+
+	// The goroutines of the replaced decoders and of the last one are stopped.
+	for i := 0; runtime.NumGoroutine() > before; i++ {
+		require.Less(t, i, 100, "%d goroutines, %d before", runtime.NumGoroutine(), before)
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTrainZSTDDictErrors(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	_, err := TrainZSTDDict(1, [][]byte{jsonSample(r)}, 1<<10)
+	require.Error(t, err)
+
+	var samples [][]byte
+	for i := 0; i < 20; i++ {
+		b := make([]byte, 100)
+		r.Read(b)
+		samples = append(samples, b)
+	}
+	_, err = TrainZSTDDict(1, samples, 1<<10)
+	require.Error(t, err)
+	_, err = TrainZSTDDict(0, samples, 1<<10)
+	require.Error(t, err)
+}
@@ -0,0 +1,317 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package zorder encodes n-dimensional points into Z-order keys, so that points which are close
+// to each other tend to have keys which are close to each other. A bounding box query is turned
+// into a small set of key ranges, which are scanned in parallel.
+//
+// Every coordinate is a uint32. The Z-order code of a point interleaves the bits of all its
+// coordinates, starting with the most significant bit of the first coordinate, and is 4 bytes
+// long per dimension. Latitudes and longitudes can be mapped to coordinates via LatLng.
+package zorder
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// Encode returns the Z-order code of the point.
+func Encode(point []uint32) []byte {
+	n := len(point)
+	code := make([]byte, 4*n)
+	for b := 0; b < 32; b++ {
+		for d, c := range point {
+			if c&(1<<uint(31-b)) == 0 {
+				continue
+			}
+			pos := b*n + d
+			code[pos/8] |= 1 << uint(7-pos%8)
+		}
+	}
+	return code
+}
+
+// Decode returns the point of a Z-order code with n dimensions. The code must be 4*n bytes long.
+func Decode(code []byte, n int) []uint32 {
+	point := make([]uint32, n)
+	for b := 0; b < 32; b++ {
+		for d := range point {
+			pos := b*n + d
+			if code[pos/8]&(1<<uint(7-pos%8)) != 0 {
+				point[d] |= 1 << uint(31-b)
+			}
+		}
+	}
+	return point
+}
+
+// LatLng maps a latitude and a longitude in degrees to a two dimensional point.
+func LatLng(lat, lng float64) []uint32 {
+	scale := func(v, min, max float64) uint32 {
+		v = math.Max(min, math.Min(max, v))
+		return uint32(math.Round((v - min) / (max - min) * math.MaxUint32))
+	}
+	return []uint32{scale(lat, -90, 90), scale(lng, -180, 180)}
+}
+
+// ToLatLng maps a two dimensional point back to a latitude and a longitude in degrees.
+func ToLatLng(point []uint32) (lat, lng float64) {
+	lat = float64(point[0])/math.MaxUint32*180 - 90
+	lng = float64(point[1])/math.MaxUint32*360 - 180
+	return lat, lng
+}
+
+// Range is a range of Z-order codes. Both ends are inclusive.
+type Range struct {
+	Start []byte
+	End   []byte
+}
+
+// cell is an aligned hypercube of the space, with sides of 2^(32-level).
+type cell struct {
+	min   []uint32
+	level int
+}
+
+func (c cell) max() []uint32 {
+	max := make([]uint32, len(c.min))
+	for d := range c.min {
+		max[d] = c.min[d] | uint32((uint64(1)<<uint(32-c.level))-1)
+	}
+	return max
+}
+
+// The Z-order codes of an aligned cell are contiguous.
+func (c cell) zrange() Range {
+	return Range{Start: Encode(c.min), End: Encode(c.max())}
+}
+
+func (c cell) children() []cell {
+	n := len(c.min)
+	half := uint32(1) << uint(31-c.level)
+	children := make([]cell, 0, 1<<uint(n))
+	for i := 0; i < 1<<uint(n); i++ {
+		child := cell{min: append([]uint32{}, c.min...), level: c.level + 1}
+		for d := 0; d < n; d++ {
+			if i&(1<<uint(n-1-d)) != 0 {
+				child.min[d] |= half
+			}
+		}
+		children = append(children, child)
+	}
+	return children
+}
+
+// Plan returns the key ranges covering the box between min and max, both inclusive, using at most
+// maxRanges ranges. The box is split into cells of decreasing size until the ranges would exceed
+// maxRanges. Cells which are only partly inside the box are then covered as a whole, so the
+// ranges may contain points outside the box, which have to be filtered out by the caller.
+func Plan(min, max []uint32, maxRanges int) ([]Range, error) {
+	if len(min) == 0 || len(min) != len(max) {
+		return nil, errors.Errorf("min and max must have the same number of dimensions")
+	}
+	if maxRanges < 1 {
+		maxRanges = 1
+	}
+	for d := range min {
+		if min[d] > max[d] {
+			return nil, nil
+		}
+	}
+
+	overlap := func(c cell) (inside, outside bool) {
+		cmax := c.max()
+		inside = true
+		for d := range min {
+			if cmax[d] < min[d] || c.min[d] > max[d] {
+				return false, true
+			}
+			if c.min[d] < min[d] || cmax[d] > max[d] {
+				inside = false
+			}
+		}
+		return inside, false
+	}
+
+	var ranges []Range
+	partial := []cell{{min: make([]uint32, len(min))}}
+	for len(partial) > 0 {
+		// Only split the partial cells further if the result can't exceed maxRanges.
+		if partial[0].level == 32 || len(ranges)+len(partial)<<uint(len(min)) > maxRanges {
+			for _, c := range partial {
+				ranges = append(ranges, c.zrange())
+			}
+			break
+		}
+		var next []cell
+		for _, c := range partial {
+			for _, child := range c.children() {
+				switch inside, outside := overlap(child); {
+				case outside:
+				case inside:
+					ranges = append(ranges, child.zrange())
+				default:
+					next = append(next, child)
+				}
+			}
+		}
+		partial = next
+	}
+	return mergeRanges(ranges), nil
+}
+
+// mergeRanges sorts the ranges and merges the adjacent ones.
+func mergeRanges(ranges []Range) []Range {
+	sort.Slice(ranges, func(i, j int) bool {
+		return bytes.Compare(ranges[i].Start, ranges[j].Start) < 0
+	})
+	var merged []Range
+	for _, r := range ranges {
+		if len(merged) > 0 {
+			last := &merged[len(merged)-1]
+			if next, ok := increment(last.End); ok && bytes.Equal(next, r.Start) {
+				last.End = r.End
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// increment returns the code following the given one. It returns false if there is none.
+func increment(code []byte) ([]byte, bool) {
+	next := append([]byte{}, code...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next, true
+		}
+	}
+	return nil, false
+}
+
+// Query is a bounding box query over keys made of a prefix followed by the Z-order code of a
+// point. Any bytes following the code, e.g. the ID of the object at that point, are ignored.
+type Query struct {
+	// Prefix is the prefix of the keys.
+	Prefix []byte
+	// Min and Max are the corners of the box, both inclusive.
+	Min, Max []uint32
+	// MaxRanges is the maximum number of key ranges to scan. More ranges match the box more
+	// closely, so fewer keys outside of the box are read. The default is 64.
+	MaxRanges int
+	// NumGo is the number of ranges scanned concurrently. The default is 8.
+	NumGo int
+}
+
+// Run calls fn for every key within the box, along with its point. The ranges are scanned
+// concurrently within a single read-only transaction, so fn must be safe for concurrent use. The
+// keys within a range are visited in Z-order. The item is only valid within fn.
+func (q Query) Run(db *badger.DB, fn func(point []uint32, item *badger.Item) error) error {
+	maxRanges, numGo := q.MaxRanges, q.NumGo
+	if maxRanges <= 0 {
+		maxRanges = 64
+	}
+	if numGo <= 0 {
+		numGo = 8
+	}
+	ranges, err := Plan(q.Min, q.Max, maxRanges)
+	if err != nil {
+		return err
+	}
+	n := len(q.Min)
+	codeLen := 4 * n
+
+	inBox := func(point []uint32) bool {
+		for d := range point {
+			if point[d] < q.Min[d] || point[d] > q.Max[d] {
+				return false
+			}
+		}
+		return true
+	}
+
+	return db.View(func(txn *badger.Txn) error {
+		scan := func(r Range) error {
+			opt := badger.DefaultIteratorOptions
+			opt.Prefix = q.Prefix
+			itr := txn.NewIterator(opt)
+			defer itr.Close()
+
+			start := append(append([]byte{}, q.Prefix...), r.Start...)
+			for itr.Seek(start); itr.Valid(); itr.Next() {
+				item := itr.Item()
+				key := item.Key()[len(q.Prefix):]
+				if len(key) < codeLen {
+					continue
+				}
+				code := key[:codeLen]
+				if bytes.Compare(code, r.End) > 0 {
+					break
+				}
+				point := Decode(code, n)
+				if !inBox(point) {
+					continue
+				}
+				if err := fn(point, item); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		rangeCh := make(chan Range)
+		errCh := make(chan error, numGo)
+		var wg sync.WaitGroup
+		for i := 0; i < numGo; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for r := range rangeCh {
+					if err := scan(r); err != nil {
+						errCh <- err
+						return
+					}
+				}
+			}()
+		}
+
+		var rerr error
+	loop:
+		for _, r := range ranges {
+			select {
+			case rangeCh <- r:
+			case rerr = <-errCh:
+				break loop
+			}
+		}
+		close(rangeCh)
+		wg.Wait()
+		if rerr == nil {
+			select {
+			case rerr = <-errCh:
+			default:
+			}
+		}
+		return rerr
+	})
+}
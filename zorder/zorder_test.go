@@ -0,0 +1,152 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package zorder
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncode(t *testing.T) {
+	require.Equal(t, []byte{0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa},
+		Encode([]uint32{0xffffffff, 0}))
+	require.Equal(t, []byte{0x80, 0, 0, 0, 0, 0, 0, 0x01}, Encode([]uint32{0x80000000, 1}))
+
+	for i := 0; i < 100; i++ {
+		point := []uint32{rand.Uint32(), rand.Uint32(), rand.Uint32()}
+		require.Equal(t, point, Decode(Encode(point), 3))
+	}
+
+	lat, lng := ToLatLng(LatLng(37.7749, -122.4194))
+	require.InDelta(t, 37.7749, lat, 1e-6)
+	require.InDelta(t, -122.4194, lng, 1e-6)
+}
+
+func TestPlan(t *testing.T) {
+	// The whole space is a single range.
+	ranges, err := Plan([]uint32{0, 0}, []uint32{0xffffffff, 0xffffffff}, 10)
+	require.NoError(t, err)
+	require.Equal(t, []Range{{Start: make([]byte, 8), End: bytes.Repeat([]byte{0xff}, 8)}}, ranges)
+
+	// Every point within the box falls into one of the ranges, and more ranges cover fewer
+	// points outside of the box.
+	min, max := []uint32{1000, 5000}, []uint32{1100, 5050}
+	inRanges := func(ranges []Range, p []uint32) bool {
+		code := Encode(p)
+		for _, r := range ranges {
+			if bytes.Compare(code, r.Start) >= 0 && bytes.Compare(code, r.End) <= 0 {
+				return true
+			}
+		}
+		return false
+	}
+	var prevOutside int
+	for i, maxRanges := range []int{4, 16, 64} {
+		ranges, err := Plan(min, max, maxRanges)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(ranges), maxRanges)
+		require.True(t, sort.SliceIsSorted(ranges, func(i, j int) bool {
+			return bytes.Compare(ranges[i].Start, ranges[j].Start) < 0
+		}))
+
+		var outside int
+		for x := uint32(900); x < 1200; x++ {
+			for y := uint32(4900); y < 5150; y++ {
+				p := []uint32{x, y}
+				in := x >= min[0] && x <= max[0] && y >= min[1] && y <= max[1]
+				if in {
+					require.True(t, inRanges(ranges, p), "point %v is not covered", p)
+				} else if inRanges(ranges, p) {
+					outside++
+				}
+			}
+		}
+		if i > 0 {
+			require.LessOrEqual(t, outside, prevOutside)
+		}
+		prevOutside = outside
+	}
+
+	ranges, err = Plan([]uint32{5}, []uint32{4}, 10)
+	require.NoError(t, err)
+	require.Empty(t, ranges)
+	_, err = Plan([]uint32{1}, []uint32{1, 2}, 10)
+	require.Error(t, err)
+}
+
+func TestQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	prefix := []byte("places/")
+	type place struct {
+		name     string
+		lat, lng float64
+	}
+	places := []place{
+		{"sf", 37.7749, -122.4194},
+		{"oakland", 37.8044, -122.2712},
+		{"berkeley", 37.8715, -122.2730},
+		{"la", 34.0522, -118.2437},
+		{"nyc", 40.7128, -74.0060},
+	}
+	wb := db.NewWriteBatch()
+	for _, p := range places {
+		key := append(append([]byte{}, prefix...), Encode(LatLng(p.lat, p.lng))...)
+		key = append(key, p.name...)
+		require.NoError(t, wb.Set(key, nil))
+	}
+	// Keys with another prefix are not visited.
+	require.NoError(t, wb.Set(Encode(LatLng(37.8, -122.3)), nil))
+	require.NoError(t, wb.Flush())
+
+	var mu sync.Mutex
+	var found []string
+	q := Query{
+		Prefix:    prefix,
+		Min:       LatLng(37.5, -122.5),
+		Max:       LatLng(38, -122),
+		MaxRanges: 16,
+	}
+	require.NoError(t, q.Run(db, func(point []uint32, item *badger.Item) error {
+		mu.Lock()
+		defer mu.Unlock()
+		found = append(found, string(item.Key()[len(prefix)+8:]))
+		return nil
+	}))
+	sort.Strings(found)
+	require.Equal(t, []string{"berkeley", "oakland", "sf"}, found)
+
+	errStop := fmt.Errorf("stop")
+	require.Equal(t, errStop, q.Run(db, func(point []uint32, item *badger.Item) error {
+		return errStop
+	}))
+}